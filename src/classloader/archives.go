@@ -113,14 +113,18 @@ func (archive *Archive) parseManifest(file *zip.File) error {
 
 	data, err := io.ReadAll(rc)
 
-	contents := string(data)
+	contents := strings.ReplaceAll(string(data), "\r\n", "\n")
 
-	lines := strings.Split(contents, "\r\n")
+	// a line that begins with a space continues the previous one, as long values
+	// (such as a Class-Path) are split across lines of at most 72 bytes
+	contents = strings.ReplaceAll(contents, "\n ", "")
+
+	lines := strings.Split(contents, "\n")
 
 	for _, line := range lines {
-		parts := strings.Split(line, ":")
-		if len(parts) > 1 {
-			archive.manifest[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		key, value, found := strings.Cut(line, ":")
+		if found {
+			archive.manifest[strings.TrimSpace(key)] = strings.TrimSpace(value)
 		}
 	}
 
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"jacobin/log"
+	"jacobin/object"
 	"jacobin/shutdown"
 )
 
@@ -18,6 +19,7 @@ type Klass struct {
 	Status byte // I=Initializing,F=formatChecked,V=verified,L=linked,N=instantiated
 	Loader string
 	Data   *ClData
+	Class  *object.Object // the java/lang/Class object of the class, once it's been asked for
 }
 
 type ClData struct {
@@ -223,7 +225,7 @@ func FetchMethodAndCP(className, methName, methType string) (MTentry, error) {
 	}
 
 	methFQN := className + "." + methName + methType // FQN = fully qualified name
-	methEntry := MTable[methFQN]
+	methEntry, _ := MTableFetch(methFQN)
 
 	if methEntry.Meth != nil { // we found the entry in the MTable
 		if methEntry.MType == 'J' {
@@ -259,32 +261,8 @@ func FetchMethodAndCP(className, methName, methType string) (MTentry, error) {
 
 	// the className has been found (k) so check the method table. Then return the
 	// method along with a pointer to the CP
-	var m Method
-	searchName := methName + methType
-	methRef, ok := k.Data.MethodTable[searchName]
-	if ok {
-		m = *methRef
-
-		// create a Java method struct for this method. We know it's a Java method
-		// because if it were a native method it would have been found in the initial
-		// lookup in the MTable (as all native methods are loaded there before
-		// program execution begins.
-		jme := JmEntry{
-			AccessFlags: m.AccessFlags,
-			MaxStack:    m.CodeAttr.MaxStack,
-			MaxLocals:   m.CodeAttr.MaxLocals,
-			Code:        m.CodeAttr.Code,
-			Exceptions:  m.CodeAttr.Exceptions,
-			attribs:     m.CodeAttr.Attributes,
-			params:      m.Parameters,
-			deprecated:  m.Deprecated,
-			Cp:          &k.Data.CP,
-		}
-		MTable[methFQN] = MTentry{
-			Meth:  jme,
-			MType: 'J',
-		}
-		return MTentry{Meth: jme, MType: 'J'}, nil
+	if methEntry, ok := klassMethod(k, methFQN, methName+methType); ok {
+		return methEntry, nil
 	}
 
 	// if we're here, the className did not contain the searched-for method. So, go up the superclasses,
@@ -307,6 +285,73 @@ func FetchMethodAndCP(className, methName, methType string) (MTentry, error) {
 	return MTentry{}, errors.New(msg)
 }
 
+// FetchMethodFor gets a method and the CP for the class of the method, as FetchMethodAndCP
+// does, but with the class named className as the code of the classes whose defining
+// loader is the loader named loader sees it (see MethAreaFetchFor()). The class must
+// already be loaded.
+func FetchMethodFor(loader, className, methName, methType string) (MTentry, error) {
+	if !IsUserLoader(loader) {
+		return FetchMethodAndCP(className, methName, methType)
+	}
+	k := MethAreaFetchFor(loader, className)
+	if k == nil || k.Data == nil {
+		errMsg := fmt.Sprintf("FetchMethodFor: loader %s has not loaded class %s", loader, className)
+		_ = log.Log(errMsg, log.SEVERE)
+		return MTentry{}, errors.New(errMsg)
+	}
+	return FetchKlassMethod(k, methName, methType)
+}
+
+// FetchKlassMethod gets the method methName+methType of the class k, and the CP of the
+// class, from the MTable or, if it's not there yet, from the class, in which case it's
+// placed in the MTable. The method is in the MTable under the name of the class as
+// QualifiedName() gives it. The superclasses of k are not searched.
+func FetchKlassMethod(k *Klass, methName, methType string) (MTentry, error) {
+	methFQN := QualifiedName(k.Loader, k.Data.Name) + "." + methName + methType
+	if methEntry, _ := MTableFetch(methFQN); methEntry.Meth != nil {
+		return methEntry, nil
+	}
+	if methEntry, ok := klassMethod(k, methFQN, methName+methType); ok {
+		return methEntry, nil
+	}
+	msg := "FetchKlassMethod: Found class " + k.Data.Name + ", but it did not contain method: " + methName
+	return MTentry{}, errors.New(msg)
+}
+
+// klassMethod returns the Java method whose name and type are searchName in the class k,
+// and places it in the MTable under methFQN. The bool is false if k has no such method.
+func klassMethod(k *Klass, methFQN, searchName string) (MTentry, bool) {
+	methRef, ok := k.Data.MethodTable[searchName]
+	if !ok {
+		return MTentry{}, false
+	}
+	m := *methRef
+
+	// create a Java method struct for this method. We know it's a Java method
+	// because if it were a native method it would have been found in the initial
+	// lookup in the MTable (as all native methods are loaded there before
+	// program execution begins.
+	jme := JmEntry{
+		AccessFlags: m.AccessFlags,
+		MaxStack:    m.CodeAttr.MaxStack,
+		MaxLocals:   m.CodeAttr.MaxLocals,
+		Code:        m.CodeAttr.Code,
+		Exceptions:  m.CodeAttr.Exceptions,
+		attribs:     m.CodeAttr.Attributes,
+		params:      m.Parameters,
+		deprecated:  m.Deprecated,
+		Cp:          &k.Data.CP,
+		Loader:      k.Loader,
+	}
+	MTmutex.Lock()
+	MTable[methFQN] = MTentry{
+		Meth:  jme,
+		MType: 'J',
+	}
+	MTmutex.Unlock()
+	return MTentry{Meth: jme, MType: 'J'}, true
+}
+
 // error message when main() can't be found
 func noMainError(className string) {
 	_ = log.Log("Error: main() method not found in class "+className+"\n"+
@@ -32,19 +32,23 @@ import (
 // https://docs.oracle.com/javase/specs/jvms/se17/html/jvms-5.html#jvms-5.3
 type Classloader struct {
 	Name       string
-	Parent     string
+	Parent     string // the name of the parent loader, to which loading is delegated first
 	ClassCount int
-	Archives   map[string]*Archive // TODO: I think this should be moved to classpath when we make it a thing
+	Archives   map[string]*Archive // the JAR files opened by this classloader, by filename
 }
 
-// AppCL is the application classloader, which loads most of the app's classes
-var AppCL Classloader
+// archivesMutex guards the Archives of the classloaders, as classes are loaded by many threads
+var archivesMutex sync.Mutex
 
 // BootstrapCL is the classloader that loads most of the standard libraries
-var BootstrapCL Classloader
+var BootstrapCL = Classloader{Name: "bootstrap", Parent: ""}
+
+// PlatformCL is the classloader that loads the rest of the standard libraries
+// (such as java.sql), which are in the modules listed in platformModules
+var PlatformCL = Classloader{Name: "platform", Parent: "bootstrap"}
 
-// ExtensionCL is the classloader typically used for loading custom agents
-var ExtensionCL Classloader
+// AppCL is the application classloader, which loads most of the app's classes
+var AppCL = Classloader{Name: "app", Parent: "platform"}
 
 // ParsedClass contains all the parsed fields
 type ParsedClass struct {
@@ -279,9 +283,11 @@ func LoadFromLoaderChannel(LoaderChannel <-chan string) {
 	globals.LoaderWg.Done()
 }
 
+// LoadClassFromNameOnly loads the class named className (in java/lang/String format)
+// with the application classloader, which delegates to its parents first (see
+// delegation.go). A class that the application classloader has already loaded
+// isn't loaded again.
 func LoadClassFromNameOnly(className string) error {
-	var err error
-
 	if className == "" {
 		errMsg := "LoadClassFromNameOnly(): null class name is invalid"
 		_ = log.Log(errMsg, log.SEVERE)
@@ -289,10 +295,6 @@ func LoadClassFromNameOnly(className string) error {
 		return errors.New(errMsg)
 	}
 
-	// get the jmod file name for this class. We'll use the jmod file to
-	// get the .class file for this class.
-	jmodFileName := JmodMapFetch(className)
-
 	if strings.HasSuffix(className, ";") {
 		msg := fmt.Sprintf("LoadClassFromNameOnly: invalid class name: %s", className)
 		_ = log.Log(msg, log.SEVERE)
@@ -300,37 +302,9 @@ func LoadClassFromNameOnly(className string) error {
 		return errors.New(msg)
 	}
 
-	// Load class from a jmod?
-	if jmodFileName != "" {
-		_ = log.Log("LoadClassFromNameOnly: Load "+className+" from jmod "+jmodFileName, log.CLASS)
-		classBytes, err := GetClassBytes(jmodFileName, className)
-		if err != nil {
-			_ = log.Log("LoadClassFromNameOnly: GetClassBytes className="+className+" from jmodFileName="+jmodFileName+" failed", log.SEVERE)
-			_ = log.Log(err.Error(), log.SEVERE)
-		}
-		_, err = loadClassFromBytes(AppCL, className, classBytes)
-		return err
-	}
-
-	// Load class from a jar file?
-	if len(globals.GetGlobalRef().StartingJar) > 0 {
-		validName := util.ConvertToPlatformPathSeparators(className)
-		_ = log.Log("LoadClassFromNameOnly: LoadClassFromJar "+validName, log.CLASS)
-		_, err = LoadClassFromJar(AppCL, validName, globals.GetGlobalRef().StartingJar)
-		if err != nil {
-			_ = log.Log("LoadClassFromNameOnly: LoadClassFromJar "+validName+" failed", log.SEVERE)
-			_ = log.Log(err.Error(), log.SEVERE)
-		}
-		return err
-	}
-
-	// Loading from a local file system class
-	// TODO: classpath
-	validName := util.ConvertToPlatformPathSeparators(className)
-	_ = log.Log("LoadClassFromNameOnly: Loaded class from file "+validName, log.CLASS)
-	_, err = LoadClassFromFile(AppCL, validName)
+	_, err := AppCL.LoadClass(filepath.ToSlash(className))
 	if err != nil {
-		_ = log.Log("LoadClassFromNameOnly: LoadClassFromFile "+validName+" failed", log.SEVERE)
+		_ = log.Log("LoadClassFromNameOnly: LoadClass "+className+" failed", log.SEVERE)
 		_ = log.Log(err.Error(), log.SEVERE)
 	}
 	return err
@@ -339,6 +313,12 @@ func LoadClassFromNameOnly(className string) error {
 // LoadClassFromFile first canonicalizes the filename, and reads
 // the indicated file, and runs it through the classloader.
 func LoadClassFromFile(cl Classloader, fname string) (string, error) {
+	return loadClassFromFile(cl, fname, "")
+}
+
+// loadClassFromFile is LoadClassFromFile(), for a file that must contain the class named
+// className, unless className is empty (see postClass())
+func loadClassFromFile(cl Classloader, fname string, className string) (string, error) {
 	var filename string
 	if !strings.HasSuffix(fname, ".class") {
 		filename = fname + ".class"
@@ -358,10 +338,13 @@ func LoadClassFromFile(cl Classloader, fname string) (string, error) {
 	}
 	_ = log.Log("LoadClassFromFile: File "+fname+" was read", log.CLASS)
 
-	return loadClassFromBytes(cl, filename, rawBytes)
+	return postClass(&cl, filename, className, rawBytes)
 }
 
 func getJarFile(cl Classloader, jarFileName string) (*Archive, error) {
+	archivesMutex.Lock()
+	defer archivesMutex.Unlock()
+
 	archive, exists := cl.Archives[jarFileName]
 
 	if exists {
@@ -390,6 +373,12 @@ func GetMainClassFromJar(cl Classloader, jarFileName string) (string, error) {
 }
 
 func LoadClassFromJar(cl Classloader, filename string, jarFileName string) (string, error) {
+	return loadClassFromJar(cl, filename, jarFileName, "")
+}
+
+// loadClassFromJar is LoadClassFromJar(), for a file that must contain the class named
+// className, unless className is empty (see postClass())
+func loadClassFromJar(cl Classloader, filename string, jarFileName string, className string) (string, error) {
 	jar, err := getJarFile(cl, jarFileName)
 
 	if err != nil {
@@ -406,7 +395,7 @@ func LoadClassFromJar(cl Classloader, filename string, jarFileName string) (stri
 		return "", fmt.Errorf("unable to find file %s in JAR file %s", filename, jarFileName)
 	}
 
-	return ParseAndPostClass(&cl, filename, *result.Data)
+	return postClass(&cl, filename, className, *result.Data)
 }
 
 func loadClassFromBytes(cl Classloader, filename string, rawBytes []byte) (string, error) {
@@ -416,22 +405,36 @@ func loadClassFromBytes(cl Classloader, filename string, rawBytes []byte) (strin
 // ParseAndPostClass parses a class, presented as a slice of bytes, and
 // if no errors occurred, posts/loads it to the method area.
 func ParseAndPostClass(cl *Classloader, filename string, rawBytes []byte) (string, error) {
+	return postClass(cl, filename, "", rawBytes)
+}
+
+// WrongNameError is returned when a class file that's looked up by the name of the class
+// it should contain holds another class, as when it's in the wrong directory. The JDK
+// throws a NoClassDefFoundError with the same message.
+type WrongNameError struct {
+	Name        string // the name of the class that was looked up
+	DefinedName string // the name of the class in the class file
+}
+
+func (e *WrongNameError) Error() string {
+	return fmt.Sprintf("%s (wrong name: %s)", e.Name, e.DefinedName)
+}
+
+// postClass is ParseAndPostClass(), for a class file that must contain the class named
+// className. If it contains another class, the class isn't posted to the method area,
+// and a WrongNameError is returned. If className is empty, any class is posted.
+func postClass(cl *Classloader, filename string, className string, rawBytes []byte) (string, error) {
 
 	_ = log.Log("ParseAndPostClass: File "+filename+" to be processed", log.CLASS)
-	fullyParsedClass, err := parse(rawBytes)
+	fullyParsedClass, err := parseAndFormatCheck(filename, rawBytes)
 	if err != nil {
-		_ = log.Log("ParseAndPostClass: error parsing "+filename+". Exiting.", log.SEVERE)
-		return "", fmt.Errorf("parsing error")
+		return "", err
 	}
-
-	// format check the class
-	if formatCheckClass(&fullyParsedClass) != nil {
-		_ = log.Log("ParseAndPostClass: error format-checking "+filename+". Exiting.", log.SEVERE)
-		return "", fmt.Errorf("format-checking error")
+	if className != "" && fullyParsedClass.className != className {
+		return "", &WrongNameError{Name: className, DefinedName: fullyParsedClass.className}
 	}
-	_ = log.Log("Class "+fullyParsedClass.className+" has been format-checked.", log.FINEST)
 
-	classToPost := convertToPostableClass(&fullyParsedClass)
+	classToPost := convertToPostableClass(fullyParsedClass)
 	eKF := Klass{
 		Status: 'F', // F = format-checked
 		Loader: cl.Name,
@@ -448,6 +451,24 @@ func ParseAndPostClass(cl *Classloader, filename string, rawBytes []byte) (strin
 	return fullyParsedClass.className, nil
 }
 
+// parseAndFormatCheck parses a class, presented as a slice of bytes read from
+// filename, and format-checks it
+func parseAndFormatCheck(filename string, rawBytes []byte) (*ParsedClass, error) {
+	fullyParsedClass, err := parse(rawBytes)
+	if err != nil {
+		_ = log.Log("ParseAndPostClass: error parsing "+filename+". Exiting.", log.SEVERE)
+		return nil, fmt.Errorf("parsing error")
+	}
+
+	// format check the class
+	if formatCheckClass(&fullyParsedClass) != nil {
+		_ = log.Log("ParseAndPostClass: error format-checking "+filename+". Exiting.", log.SEVERE)
+		return nil, fmt.Errorf("format-checking error")
+	}
+	_ = log.Log("Class "+fullyParsedClass.className+" has been format-checked.", log.FINEST)
+	return &fullyParsedClass, nil
+}
+
 // load the parsed class into a form suitable for posting to the method area (which is
 // exec.MethArea. This mostly involves copying the data, converting most indexes to uint16
 // and removing some fields we needed in parsing, but which are no longer required.
@@ -751,21 +772,21 @@ func normalizeClassReference(ref string) string {
 }
 
 // Init simply initializes the three classloaders and the class area
-// and points the classloaders to each other in the proper order.
-// This function might be substantially revised later.
+// and points the classloaders to each other in the proper order
+// (bootstrap <- platform <- app).
 func Init() error {
 	BootstrapCL.Name = "bootstrap"
 	BootstrapCL.Parent = ""
 	BootstrapCL.ClassCount = 0
 	BootstrapCL.Archives = make(map[string]*Archive)
 
-	ExtensionCL.Name = "extension"
-	ExtensionCL.Parent = "bootstrap"
-	ExtensionCL.ClassCount = 0
-	ExtensionCL.Archives = make(map[string]*Archive)
+	PlatformCL.Name = "platform"
+	PlatformCL.Parent = "bootstrap"
+	PlatformCL.ClassCount = 0
+	PlatformCL.Archives = make(map[string]*Archive)
 
 	AppCL.Name = "app"
-	AppCL.Parent = "extension"
+	AppCL.Parent = "platform"
 	AppCL.ClassCount = 0
 	AppCL.Archives = make(map[string]*Archive)
 
@@ -37,13 +37,13 @@ func TestInitOfClassloaders(t *testing.T) {
 			BootstrapCL.Parent)
 	}
 
-	if ExtensionCL.Parent != "bootstrap" {
-		t.Errorf("Expecting parent of Extension classloader to be Boostrap, got: %s",
-			ExtensionCL.Parent)
+	if PlatformCL.Parent != "bootstrap" {
+		t.Errorf("Expecting parent of Platform classloader to be Boostrap, got: %s",
+			PlatformCL.Parent)
 	}
 
-	if AppCL.Parent != "extension" {
-		t.Errorf("Expecting parent of Application classloader to be Extension, got: %s",
+	if AppCL.Parent != "platform" {
+		t.Errorf("Expecting parent of Application classloader to be Platform, got: %s",
 			AppCL.Parent)
 	}
 
@@ -53,9 +53,9 @@ func TestInitOfClassloaders(t *testing.T) {
 			BootstrapCL.ClassCount)
 	}
 
-	if ExtensionCL.ClassCount != 0 {
-		t.Errorf("Expected size of extension CL's table to be 0, got: %d",
-			ExtensionCL.ClassCount)
+	if PlatformCL.ClassCount != 0 {
+		t.Errorf("Expected size of platform CL's table to be 0, got: %d",
+			PlatformCL.ClassCount)
 	}
 
 	if AppCL.ClassCount != 0 {
@@ -0,0 +1,148 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package classloader
+
+import (
+	"errors"
+	"fmt"
+	"jacobin/globals"
+	"jacobin/log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The classpath is the ordered list of places in which application classes are looked
+// for. It's taken from -cp, -classpath, or --class-path on the command line or, if none
+// of these is given, from the CLASSPATH environment variable; if that isn't set either,
+// the classpath is the current directory. When a program is run with -jar, the
+// classpath is instead the JAR file followed by the entries in the Class-Path attribute
+// of its manifest.
+//
+// Entries are separated by the platform's path-list separator (: or ;), and each is
+// either a directory, which holds class files in subdirectories that follow the
+// packages, or a JAR file. An entry whose last component is * stands for all the JAR
+// files in that directory, in alphabetical order.
+
+// ParseClasspath converts a classpath into its list of entries, expanding wildcards.
+// Empty entries stand for the current directory, as in the JDK.
+func ParseClasspath(classpath string) []string {
+	var entries []string
+	for _, entry := range filepath.SplitList(classpath) {
+		switch {
+		case entry == "":
+			entries = append(entries, ".")
+		case filepath.Base(entry) == "*":
+			entries = append(entries, expandWildcard(filepath.Dir(entry))...)
+		default:
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		entries = append(entries, ".")
+	}
+	return entries
+}
+
+// expandWildcard returns the JAR files in dir, sorted by name. A directory that
+// can't be read contributes no entries.
+func expandWildcard(dir string) []string {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		_ = log.Log("Classpath: cannot read directory "+dir+" to expand wildcard", log.FINE)
+		return nil
+	}
+
+	var jars []string
+	for _, file := range files {
+		if !file.IsDir() && strings.EqualFold(filepath.Ext(file.Name()), ".jar") {
+			jars = append(jars, filepath.Join(dir, file.Name()))
+		}
+	}
+	sort.Strings(jars)
+	return jars
+}
+
+// JarClasspath returns the classpath of a program run with -jar: the JAR file followed
+// by the entries in the Class-Path attribute of its manifest, which are separated by
+// spaces and are relative to the directory that holds the JAR file.
+func JarClasspath(jarFileName string) []string {
+	entries := []string{jarFileName}
+	jar, err := getJarFile(AppCL, jarFileName)
+	if err != nil {
+		return entries
+	}
+
+	dir := filepath.Dir(jarFileName)
+	for _, entry := range strings.Fields(jar.manifest["Class-Path"]) {
+		entry = filepath.FromSlash(entry)
+		if !filepath.IsAbs(entry) {
+			entry = filepath.Join(dir, entry)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// classpath returns the entries of the classpath. If none has been set, which is the
+// case when the classloader is used without the JVM having been started, it's the
+// starting JAR file, if any, or else the current directory.
+func classpath() []string {
+	glob := globals.GetGlobalRef()
+	if len(glob.Classpath) > 0 {
+		return glob.Classpath
+	}
+	if glob.StartingJar != "" {
+		return []string{glob.StartingJar}
+	}
+	return []string{"."}
+}
+
+// LoadClassFromClasspath loads the class whose name is className (in java/lang/String
+// format) from the first entry of the classpath that contains it.
+func LoadClassFromClasspath(cl Classloader, className string) (string, error) {
+	return LoadClassFromPaths(cl, classpath(), className)
+}
+
+// LoadClassFromPaths loads the class whose name is className (in java/lang/String
+// format) from the first of entries, which are directories and JAR files as on the
+// classpath, that contains it. It's how a URLClassLoader finds classes in its URLs.
+// If the class file that's found holds another class, a WrongNameError is returned.
+func LoadClassFromPaths(cl Classloader, entries []string, className string) (string, error) {
+	slashName := filepath.ToSlash(className)
+	dottedName := strings.ReplaceAll(slashName, "/", ".")
+
+	for _, entry := range entries {
+		info, err := os.Stat(entry)
+		if err != nil { // entries that don't exist are skipped, as in the JDK
+			continue
+		}
+
+		if info.IsDir() {
+			filename := filepath.Join(entry, filepath.FromSlash(slashName)+".class")
+			if _, err = os.Stat(filename); err == nil {
+				_ = log.Log("LoadClassFromClasspath: Load "+className+" from "+filename, log.CLASS)
+				return loadClassFromFile(cl, filename, slashName)
+			}
+			continue
+		}
+
+		jar, err := getJarFile(cl, entry)
+		if err != nil {
+			continue
+		}
+		if jar.hasResource(dottedName, ClassFile) {
+			_ = log.Log("LoadClassFromClasspath: Load "+className+" from JAR "+entry, log.CLASS)
+			return loadClassFromJar(cl, dottedName, entry, slashName)
+		}
+	}
+
+	errMsg := fmt.Sprintf("LoadClassFromClasspath: class %s not found on classpath %s",
+		className, strings.Join(entries, string(os.PathListSeparator)))
+	return "", errors.New(errMsg)
+}
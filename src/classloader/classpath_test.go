@@ -0,0 +1,93 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package classloader
+
+import (
+	"archive/zip"
+	"jacobin/globals"
+	"jacobin/log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseClasspath(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.jar", "A.JAR", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "classes.jar"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sep := string(os.PathListSeparator)
+	classpath := "classes" + sep + filepath.Join(dir, "*") + sep + sep + "app.jar"
+	entries := ParseClasspath(classpath)
+
+	expected := []string{"classes", filepath.Join(dir, "A.JAR"), filepath.Join(dir, "b.jar"), ".", "app.jar"}
+	if strings.Join(entries, sep) != strings.Join(expected, sep) {
+		t.Errorf("Expected classpath entries %v, got %v", expected, entries)
+	}
+
+	entries = ParseClasspath("")
+	if len(entries) != 1 || entries[0] != "." {
+		t.Errorf("Expected an empty classpath to be the current directory, got %v", entries)
+	}
+}
+
+func TestJarClasspathFromManifest(t *testing.T) {
+	globals.InitGlobals("test")
+	AppCL.Archives = make(map[string]*Archive)
+
+	dir := t.TempDir()
+	jarName := filepath.Join(dir, "app.jar")
+	file, err := os.Create(jarName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := zip.NewWriter(file)
+	manifest, _ := writer.Create("META-INF/MANIFEST.MF")
+	// the Class-Path is split across two lines, as the JDK's jar tool does with long values
+	_, _ = manifest.Write([]byte("Manifest-Version: 1.0\r\nMain-Class: app.Main\r\n" +
+		"Class-Path: lib/a.jar\r\n  lib/b.jar\r\n\r\n"))
+	_ = writer.Close()
+	_ = file.Close()
+
+	entries := JarClasspath(jarName)
+	expected := []string{jarName, filepath.Join(dir, "lib", "a.jar"), filepath.Join(dir, "lib", "b.jar")}
+	if strings.Join(entries, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected classpath entries %v, got %v", expected, entries)
+	}
+}
+
+func TestLoadClassFromClasspath(t *testing.T) {
+	globals.InitGlobals("test")
+	_ = log.SetLogLevel(log.WARNING)
+	AppCL.Archives = make(map[string]*Archive)
+	InitMethodArea()
+
+	jarName, err := getJarFileName(GOOD_JAR_NAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the class is looked for in the empty directory first, then found in the JAR
+	globals.GetGlobalRef().Classpath = []string{t.TempDir(), jarName}
+	if _, err = LoadClassFromClasspath(AppCL, "jacobin/HelloWorld"); err != nil {
+		t.Fatalf("Expected jacobin/HelloWorld to be loaded from %s, got: %s", jarName, err.Error())
+	}
+	if MethAreaFetch("jacobin/HelloWorld") == nil {
+		t.Errorf("Expected jacobin/HelloWorld to be in the method area")
+	}
+
+	if _, err = LoadClassFromClasspath(AppCL, "jacobin/GoodbyeWorld"); err == nil {
+		t.Errorf("Expected an error loading a class that's not on the classpath")
+	}
+}
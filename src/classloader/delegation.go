@@ -0,0 +1,192 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package classloader
+
+import (
+	"fmt"
+	"jacobin/log"
+	"strings"
+	"sync"
+)
+
+// Classloaders form a hierarchy in which each loader but the bootstrap loader has a
+// parent: bootstrap <- platform <- app. As in the JDK, a loader asked to load a class
+// first delegates the request to its parent, and defines the class itself only if the
+// parent (and so, none of its ancestors) can't load it. So the classes of the standard
+// libraries are always defined by the bootstrap or platform loader, even when an app
+// class that uses them is loaded by the app loader, and an app can't replace them.
+// The loaders an app creates join the hierarchy below these (see userLoaders.go).
+//
+// The loader that defines a class (that is, creates it from its class file) is its
+// defining loader, which is recorded in the Loader field of its Klass. Every loader
+// that's asked to load a class and returns it, whether it defined it or got it from
+// its parent, is an initiating loader of the class. The method area records each class
+// under the loaders that initiated it (see methArea.go), so two loaders can each define
+// a class of the same name, and each sees its own.
+//
+// (See JVMS 5.3: https://docs.oracle.com/javase/specs/jvms/se17/html/jvms-5.html#jvms-5.3)
+
+// platformModules are the modules whose classes are defined by the platform loader,
+// rather than the bootstrap loader, in JDK 17
+var platformModules = map[string]bool{
+	"java.compiler": true, "java.net.http": true, "java.scripting": true,
+	"java.security.jgss": true, "java.smartcardio": true, "java.sql": true,
+	"java.sql.rowset": true, "java.transaction.xa": true, "java.xml.crypto": true,
+	"jdk.accessibility": true, "jdk.charsets": true, "jdk.crypto.cryptoki": true,
+	"jdk.crypto.ec": true, "jdk.dynalink": true, "jdk.httpserver": true,
+	"jdk.jsobject": true, "jdk.localedata": true, "jdk.naming.dns": true,
+	"jdk.security.auth": true, "jdk.security.jgss": true, "jdk.xml.dom": true,
+	"jdk.zipfs": true,
+}
+
+// loaders holds the classloaders by name, so that the parent of a loader, and the
+// defining loader of a class, can be found from their names
+var loaders = map[string]*Classloader{
+	BootstrapCL.Name: &BootstrapCL,
+	PlatformCL.Name:  &PlatformCL,
+	AppCL.Name:       &AppCL,
+}
+var loadersMutex sync.RWMutex
+
+// LoaderNamed returns the classloader whose name is name, or nil if there's none.
+// The empty name is that of the bootstrap loader, which in Java is null.
+func LoaderNamed(name string) *Classloader {
+	if name == "" {
+		return &BootstrapCL
+	}
+	loadersMutex.RLock()
+	defer loadersMutex.RUnlock()
+	return loaders[name]
+}
+
+// GetParent returns the parent of the classloader, or nil for the bootstrap loader
+func (cl *Classloader) GetParent() *Classloader {
+	if cl.Parent == "" {
+		return nil
+	}
+	return LoaderNamed(cl.Parent)
+}
+
+// loadingKey identifies a class that a classloader is loading: the loader's name and the
+// class name
+type loadingKey struct {
+	loader    string
+	className string
+}
+
+// loadingLock is held by the thread that's loading a class with a classloader
+type loadingLock struct {
+	mutex sync.Mutex
+	users int // the number of threads that hold the lock or wait for it
+}
+
+// loadingLocks holds the locks of the classes being loaded. As in a parallel-capable
+// loader of the JDK, a classloader loads a class on one thread at a time, while it can
+// load other classes on other threads. A lock is in the table only while a thread holds
+// it or waits for it. loadingLocksMutex guards the table and the users of every lock.
+var loadingLocks = make(map[loadingKey]*loadingLock)
+var loadingLocksMutex sync.Mutex
+
+// lockLoading locks the loading of the class identified by key, waiting for another
+// thread that's loading it, and returns the lock
+func lockLoading(key loadingKey) *loadingLock {
+	loadingLocksMutex.Lock()
+	lock := loadingLocks[key]
+	if lock == nil {
+		lock = &loadingLock{}
+		loadingLocks[key] = lock
+	}
+	lock.users += 1
+	loadingLocksMutex.Unlock()
+
+	lock.mutex.Lock()
+	return lock
+}
+
+// unlockLoading unlocks the loading of the class identified by key, whose lock is lock
+func unlockLoading(key loadingKey, lock *loadingLock) {
+	loadingLocksMutex.Lock()
+	defer loadingLocksMutex.Unlock()
+	lock.mutex.Unlock()
+	lock.users -= 1
+	if lock.users == 0 {
+		delete(loadingLocks, key)
+	}
+}
+
+// LoadClass returns the class named className (in java/lang/String format), as loaded
+// by the classloader. If the classloader hasn't loaded it already, it asks its parent
+// to load it and, if the parent can't, defines the class itself. The classloader is
+// then recorded as an initiating loader of the class. A thread that asks for a class
+// that another thread is loading waits for it, and then gets the class it loaded.
+func (cl *Classloader) LoadClass(className string) (*Klass, error) {
+	if k := methAreaFetchInitiated(cl.Name, className); k != nil && k.Status != 'I' {
+		return k, nil
+	}
+
+	key := loadingKey{cl.Name, className}
+	lock := lockLoading(key)
+	defer unlockLoading(key, lock)
+	if k := methAreaFetchInitiated(cl.Name, className); k != nil && k.Status != 'I' {
+		return k, nil // another thread loaded it while this one waited
+	}
+
+	var k *Klass
+	var err error
+	if parent := cl.GetParent(); parent != nil {
+		k, err = parent.LoadClass(className)
+	}
+	if k == nil {
+		if k, err = cl.findClass(className); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = recordInitiatingLoader(cl.Name, className, k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// findClass defines the class named className with the classloader, from wherever
+// the classloader finds classes: the bootstrap and platform loaders find them in the
+// jmod files of their modules, and the app loader on the classpath.
+func (cl *Classloader) findClass(className string) (*Klass, error) {
+	var definedName string
+	var err error
+
+	switch cl.Name {
+	case BootstrapCL.Name, PlatformCL.Name:
+		jmodFileName := JmodMapFetch(className)
+		isPlatform := platformModules[strings.TrimSuffix(jmodFileName, ".jmod")]
+		if jmodFileName == "" || isPlatform != (cl.Name == PlatformCL.Name) {
+			return nil, fmt.Errorf("%s loader: class %s not found", cl.Name, className)
+		}
+		_ = log.Log("findClass: Load "+className+" from jmod "+jmodFileName, log.CLASS)
+		var classBytes []byte
+		if classBytes, err = GetClassBytes(jmodFileName, className); err != nil {
+			_ = log.Log("findClass: GetClassBytes className="+className+" from jmodFileName="+
+				jmodFileName+" failed", log.SEVERE)
+			return nil, err
+		}
+		if definedName, err = loadClassFromBytes(*cl, className, classBytes); err != nil {
+			return nil, err
+		}
+	case AppCL.Name:
+		if definedName, err = LoadClassFromClasspath(*cl, className); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%s loader: class %s not found", cl.Name, className)
+	}
+
+	k := methAreaFetchInitiated(cl.Name, definedName)
+	if k == nil || definedName != className {
+		return nil, &WrongNameError{Name: className, DefinedName: definedName}
+	}
+	return k, nil
+}
@@ -0,0 +1,155 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package classloader
+
+import (
+	"jacobin/globals"
+	"jacobin/log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestKlass returns a class named name, defined by the loader named loader
+func newTestKlass(name, loader string) *Klass {
+	return &Klass{Status: 'F', Loader: loader, Data: &ClData{Name: name, Superclass: "java/lang/Object"}}
+}
+
+// sets up an empty method area and a jmod map holding one class of a platform module
+func setUpLoaderTest(t *testing.T) {
+	globals.InitGlobals("test")
+	log.Init()
+	_ = log.SetLogLevel(log.WARNING)
+	AppCL.Archives = make(map[string]*Archive)
+	InitMethodArea()
+
+	savedMap, savedSize := JMODMAP, jmodMapSize
+	JMODMAP = map[string]string{"java/sql/Fake.class": "java.sql.jmod"}
+	jmodMapSize = 1
+	t.Cleanup(func() { JMODMAP, jmodMapSize = savedMap, savedSize })
+}
+
+func TestSameClassNameInTwoLoaders(t *testing.T) {
+	setUpLoaderTest(t)
+
+	appClass := newTestKlass("test/Dup", AppCL.Name)
+	platformClass := newTestKlass("test/Dup", PlatformCL.Name)
+	MethAreaInsert("test/Dup", appClass)
+	MethAreaInsert("test/Dup", platformClass)
+
+	if k := MethAreaFetchFromLoader(AppCL.Name, "test/Dup"); k != appClass {
+		t.Errorf("Expected the app loader to see the class it defined, got: %v", k)
+	}
+	if k := MethAreaFetchFromLoader(PlatformCL.Name, "test/Dup"); k != platformClass {
+		t.Errorf("Expected the platform loader to see the class it defined, got: %v", k)
+	}
+	if k := MethAreaFetchFromLoader(BootstrapCL.Name, "test/Dup"); k != nil {
+		t.Errorf("Expected the bootstrap loader not to see test/Dup, got: %v", k)
+	}
+}
+
+func TestLoadClassDelegatesToParentFirst(t *testing.T) {
+	setUpLoaderTest(t)
+
+	// a class the bootstrap loader has defined is returned to the app loader,
+	// which is recorded as an initiating loader of the class
+	bootClass := newTestKlass("java/lang/Fake", BootstrapCL.Name)
+	MethAreaInsert("java/lang/Fake", bootClass)
+	k, err := AppCL.LoadClass("java/lang/Fake")
+	if err != nil || k != bootClass {
+		t.Fatalf("Expected the app loader to get java/lang/Fake from the bootstrap loader, got %v (error: %v)", k, err)
+	}
+	if methAreaFetchInitiated(AppCL.Name, "java/lang/Fake") != bootClass {
+		t.Errorf("Expected the app loader to be recorded as an initiating loader of java/lang/Fake")
+	}
+
+	// a class on the classpath is defined by the app loader, as its parents can't find it
+	jarName, _ := getJarFileName(GOOD_JAR_NAME)
+	globals.GetGlobalRef().Classpath = []string{jarName}
+	k, err = AppCL.LoadClass("jacobin/HelloWorld")
+	if err != nil || k == nil || k.Loader != AppCL.Name {
+		t.Fatalf("Expected jacobin/HelloWorld to be defined by the app loader, got %v (error: %v)", k, err)
+	}
+	if methAreaFetchInitiated(BootstrapCL.Name, "jacobin/HelloWorld") != nil {
+		t.Errorf("Expected the bootstrap loader not to have loaded jacobin/HelloWorld")
+	}
+
+	// the classes of platform modules aren't defined by the bootstrap loader
+	if _, err = BootstrapCL.findClass("java/sql/Fake"); err == nil {
+		t.Errorf("Expected the bootstrap loader not to define a class of the java.sql module")
+	}
+}
+
+// threads that ask a loader for the same class at the same time get the one class that
+// the loader defines
+func TestLoadClassOnManyThreads(t *testing.T) {
+	setUpLoaderTest(t)
+	jarName, _ := getJarFileName(GOOD_JAR_NAME)
+	globals.GetGlobalRef().Classpath = []string{jarName}
+
+	const count = 8
+	classes := make([]*Klass, count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			classes[i], errs[i] = AppCL.LoadClass("jacobin/HelloWorld")
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < count; i++ {
+		if errs[i] != nil || classes[i] == nil || classes[i] != classes[0] {
+			t.Fatalf("Expected every thread to get the same jacobin/HelloWorld, thread %d got %v (error: %v)",
+				i, classes[i], errs[i])
+		}
+	}
+	loadingLocksMutex.Lock()
+	defer loadingLocksMutex.Unlock()
+	if len(loadingLocks) != 0 {
+		t.Errorf("Expected no loading locks to be left, got %d", len(loadingLocks))
+	}
+}
+
+func TestLoaderConstraints(t *testing.T) {
+	setUpLoaderTest(t)
+
+	// two loaders that have loaded different classes can't be constrained to agree
+	MethAreaInsert("test/Foo", newTestKlass("test/Foo", AppCL.Name))
+	MethAreaInsert("test/Foo", newTestKlass("test/Foo", PlatformCL.Name))
+	if err := AddLoaderConstraint("test/Foo", AppCL.Name, PlatformCL.Name); err == nil {
+		t.Errorf("Expected a loader constraint violation for test/Foo")
+	}
+
+	// once they're constrained, neither can load a class different from the other's
+	if err := AddLoaderConstraint("test/Bar", AppCL.Name, PlatformCL.Name); err != nil {
+		t.Fatalf("Unexpected error constraining test/Bar: %s", err.Error())
+	}
+	MethAreaInsert("test/Bar", newTestKlass("test/Bar", PlatformCL.Name))
+	if err := recordInitiatingLoader(AppCL.Name, "test/Bar", newTestKlass("test/Bar", AppCL.Name)); err == nil {
+		t.Errorf("Expected a loader constraint violation when the app loader loads its own test/Bar")
+	}
+
+	// a call between classes of different loaders constrains the classes in its descriptor
+	callee := newTestKlass("test/Callee", PlatformCL.Name)
+	err := CheckMethodLoaderConstraints(AppCL.Name, "test/Caller", callee, "m", "(Ltest/Foo;I)V")
+	if err == nil || !strings.Contains(err.Error(), "different Class objects for the type test/Foo") {
+		t.Errorf("Expected a loader constraint violation for test/Foo, got: %v", err)
+	}
+	if err = CheckMethodLoaderConstraints(PlatformCL.Name, "test/Caller", callee, "m", "(Ltest/Foo;I)V"); err != nil {
+		t.Errorf("Expected no loader constraints within a loader, got: %s", err.Error())
+	}
+}
+
+func TestDescriptorClassNames(t *testing.T) {
+	names := descriptorClassNames("(IJLjava/lang/String;[[Ltest/Foo;[I)Ljava/util/List;")
+	if strings.Join(names, " ") != "java/lang/String test/Foo java/util/List" {
+		t.Errorf("Expected java/lang/String test/Foo java/util/List, got: %v", names)
+	}
+}
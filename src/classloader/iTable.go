@@ -0,0 +1,62 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package classloader
+
+import (
+	"sync"
+)
+
+// ITables holds the interface method tables (itables) of classes. When INVOKEINTERFACE
+// calls an interface method on an object, the method that's executed depends on the
+// class of the object, and finding it can require a search through the class's
+// superclasses and superinterfaces. Once found, the method is recorded in the itable
+// of the object's class, so that subsequent calls of that interface method on objects
+// of the same class don't need to repeat the search.
+//
+// The key to ITables is the class, as several loaders can define classes of the same
+// name. The key to an individual itable is the fully qualified name of the interface
+// method (e.g., java/lang/Runnable.run()V).
+var ITables = make(map[*Klass]map[string]ITentry)
+
+// ITentry is the method selected for an interface method in a given class. ClName is
+// the name of the class (or interface, in the case of default methods) that declares
+// the method, which is not necessarily the class of the object.
+type ITentry struct {
+	ClName string
+	Meth   MTentry
+}
+
+// ITmutex protects ITables, as multiple threads could be updating it simultaneously.
+var ITmutex sync.RWMutex
+
+// ITableFetch returns the itable entry for the interface method methFQN in the class
+// k. The bool is false if the method is not (yet) in the class's itable.
+func ITableFetch(k *Klass, methFQN string) (ITentry, bool) {
+	ITmutex.RLock()
+	defer ITmutex.RUnlock()
+
+	itable, ok := ITables[k]
+	if !ok {
+		return ITentry{}, false
+	}
+	entry, ok := itable[methFQN]
+	return entry, ok
+}
+
+// ITableInsert records the method selected for interface method methFQN in the
+// itable of class k, creating the itable if necessary.
+func ITableInsert(k *Klass, methFQN string, entry ITentry) {
+	ITmutex.Lock()
+	defer ITmutex.Unlock()
+
+	itable, ok := ITables[k]
+	if !ok {
+		itable = make(map[string]ITentry)
+		ITables[k] = itable
+	}
+	itable[methFQN] = entry
+}
@@ -117,6 +117,7 @@ func getAssertionsEnabledStatus(params []interface{}) interface{} {
 	// note that statics have been preloaded before this function
 	// can be called, and CLI processing has also occurred. So, we
 	// know we have the latest assertion-enabled status.
-	x := Statics["main.$assertionsDisabled"].Value.(int64)
+	assertionsDisabled, _ := GetStatic("main.$assertionsDisabled")
+	x := assertionsDisabled.Value.(int64)
 	return 1 - x // return the 0 if disabled, 1 if not.
 }
@@ -8,12 +8,9 @@ package classloader
 
 import (
 	"container/list"
-	"fmt"
 	"jacobin/frames"
-	"jacobin/globals"
 	"jacobin/log"
 	"jacobin/object"
-	"jacobin/thread"
 )
 
 func Load_Lang_Throwable() map[string]GMeth {
@@ -21,29 +18,19 @@ func Load_Lang_Throwable() map[string]GMeth {
 	MethodSignatures["java/lang/Throwable.fillInStackTrace()Ljava/lang/Throwable;"] =
 		GMeth{
 			ParamSlots: 0,
+			ObjectRef:  true,
 			GFunction:  fillInStackTrace,
 		}
 	return MethodSignatures
 }
 
+// fillInStackTrace is called by the Throwable constructors. For the nonce, the call stack of
+// an uncaught exception is reported from the frame stack at the time it's thrown, so this
+// function simply returns the Throwable (passed in as the object reference), as the JDK does.
+// This might require that we add the logic to the class parse showing the Java code source line number.
+// JACOBIN-224 refers to this.
 func fillInStackTrace(params []interface{}) interface{} {
-	glob := globals.GetGlobalRef()
-	if glob.JVMframeStack == nil { // if we haven't captured the JVM stack before now, we're hosed.
-		_ = log.Log("No stack data available for this error. Incomplete data will be shown.", log.SEVERE)
-		return nil
-	}
-
-	thisThread := params[0].(*thread.ExecThread)
-	thisFrameStack := thisThread.Stack
-	stackListing := GetStackTraces(thisFrameStack)
-	listing := stackListing.FieldTable["stackTrace"].Fvalue.([]*object.Object)
-	fmt.Printf("Stack trace contains %d elements", len(listing))
-
-	// thisFrame := thisFrameStack.Front().Next()
-
-	// This might require that we add the logic to the class parse showing the Java code source line number.
-	// JACOBIN-224 refers to this.
-	return nil
+	return params[0]
 }
 
 // GetStackTraces gets the full JVM stack trace using java.lang.StackTraceElement
@@ -97,7 +84,7 @@ func GetStackTraces(fs *list.List) *object.Object {
 		addField("declaringClass", frame.ClName)
 		addField("methodName", frame.MethName)
 
-		methClass := MethAreaFetch(frame.ClName)
+		methClass := MethAreaFetchFor(frame.Loader, frame.ClName)
 		if methClass == nil {
 			return nil
 		}
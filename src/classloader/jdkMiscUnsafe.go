@@ -8,8 +8,12 @@ package classloader
 
 import (
 	"errors"
+	"fmt"
 	"jacobin/exceptions"
 	"jacobin/object"
+	"jacobin/types"
+	"strings"
+	"sync"
 )
 
 /*
@@ -28,14 +32,186 @@ import (
  could mean an empty slice).
 */
 
+// The JDK's concurrency classes (the atomics, the locks, ConcurrentHashMap, etc.) read
+// and write fields and array elements through jdk.internal.misc.Unsafe, which addresses
+// them by an offset from the start of the object. Jacobin objects have no such layout,
+// so the offsets handed out here are tokens: the offset of a field identifies the
+// field's name, by which it's found in the object's FieldTable (and, for objects that
+// also keep their fields in Fields, at its index there). An array element's offset is
+// its index: arrays have a base offset of 0 and an index scale of 1.
+//
+// Every access through Unsafe is made with the field lock of the object held (see
+// object/fieldLocks.go), which GETFIELD and PUTFIELD hold too, so compare-and-set and
+// the other read-modify-write operations are atomic, and the volatile, acquire/release,
+// and opaque accesses see the most recent value written by any of them. (LockSupport's
+// park() and unpark(), which Unsafe also implements, need the state of the threads, so
+// they're in the jvm package, in threads.go.)
+
+// unsafeMutex guards the field offsets
+var unsafeMutex sync.Mutex
+
+// unsafeFieldOffsets maps a field name to its offset, which is its index in unsafeFieldNames
+var unsafeFieldOffsets = make(map[string]int64)
+var unsafeFieldNames []string
+
+// theUnsafe is the Unsafe object returned by Unsafe.getUnsafe()
+var theUnsafe *object.Object
+var theUnsafeOnce sync.Once
+
+// the kinds of values Unsafe reads and writes, by the name Unsafe's methods use for them
+var unsafeKinds = map[string]string{
+	"Boolean":   types.Bool,
+	"Byte":      types.Byte,
+	"Char":      types.Char,
+	"Short":     types.Short,
+	"Int":       types.Int,
+	"Long":      types.Long,
+	"Float":     types.Float,
+	"Double":    types.Double,
+	"Reference": "Ljava/lang/Object;",
+}
+
 func Load_Misc_Unsafe() map[string]GMeth {
 
 	MethodSignatures["jdk/internal/misc/Unsafe.arrayBaseOffset(Ljava/lang/Class;)I"] = // offset to start of first item in an array
 		GMeth{
 			ParamSlots: 1,
+			ObjectRef:  true,
+			GFunction:  arrayBaseOffset,
+		}
+
+	MethodSignatures["jdk/internal/misc/Unsafe.arrayBaseOffset0(Ljava/lang/Class;)I"] =
+		GMeth{
+			ParamSlots: 1,
+			ObjectRef:  true,
 			GFunction:  arrayBaseOffset,
 		}
 
+	MethodSignatures["jdk/internal/misc/Unsafe.arrayIndexScale(Ljava/lang/Class;)I"] = // distance between items in an array
+		GMeth{
+			ParamSlots: 1,
+			ObjectRef:  true,
+			GFunction:  arrayIndexScale,
+		}
+
+	MethodSignatures["jdk/internal/misc/Unsafe.arrayIndexScale0(Ljava/lang/Class;)I"] =
+		GMeth{
+			ParamSlots: 1,
+			ObjectRef:  true,
+			GFunction:  arrayIndexScale,
+		}
+
+	MethodSignatures["jdk/internal/misc/Unsafe.addressSize()I"] =
+		GMeth{
+			ParamSlots: 0,
+			ObjectRef:  true,
+			GFunction:  addressSize,
+		}
+
+	MethodSignatures["jdk/internal/misc/Unsafe.objectFieldOffset(Ljava/lang/Class;Ljava/lang/String;)J"] =
+		GMeth{
+			ParamSlots: 2,
+			ObjectRef:  true,
+			GFunction:  objectFieldOffset,
+		}
+
+	MethodSignatures["jdk/internal/misc/Unsafe.objectFieldOffset1(Ljava/lang/Class;Ljava/lang/String;)J"] =
+		GMeth{
+			ParamSlots: 2,
+			ObjectRef:  true,
+			GFunction:  objectFieldOffset,
+		}
+
+	MethodSignatures["jdk/internal/misc/Unsafe.getUnsafe()Ljdk/internal/misc/Unsafe;"] =
+		GMeth{
+			ParamSlots: 0,
+			GFunction:  getUnsafe,
+		}
+
+	for _, fence := range []string{"fullFence", "loadFence", "storeFence", "storeStoreFence"} {
+		MethodSignatures["jdk/internal/misc/Unsafe."+fence+"()V"] =
+			GMeth{
+				ParamSlots: 0,
+				ObjectRef:  true,
+				GFunction:  unsafeFence,
+			}
+	}
+
+	// the reads and writes of fields and array elements, in all their access modes
+	for kind, desc := range unsafeKinds {
+		valueSlots := 1
+		if types.UsesTwoSlots(desc) {
+			valueSlots = 2
+		}
+		for _, mode := range []string{"", "Volatile", "Acquire", "Opaque"} {
+			MethodSignatures["jdk/internal/misc/Unsafe.get"+kind+mode+"(Ljava/lang/Object;J)"+desc] =
+				GMeth{
+					ParamSlots: 3, // the object and the offset (a long)
+					ObjectRef:  true,
+					GFunction:  unsafeGet,
+				}
+		}
+		for _, mode := range []string{"", "Volatile", "Release", "Opaque"} {
+			MethodSignatures["jdk/internal/misc/Unsafe.put"+kind+mode+"(Ljava/lang/Object;J"+desc+")V"] =
+				GMeth{
+					ParamSlots: 3 + valueSlots,
+					ObjectRef:  true,
+					GFunction:  unsafePut,
+				}
+		}
+	}
+
+	// the atomic read-modify-write operations
+	for _, kind := range []string{"Int", "Long", "Reference"} {
+		desc := unsafeKinds[kind]
+		valueSlots := 1
+		if kind == "Long" {
+			valueSlots = 2
+		}
+		for _, name := range []string{"compareAndSet", "weakCompareAndSet", "weakCompareAndSetPlain",
+			"weakCompareAndSetAcquire", "weakCompareAndSetRelease"} {
+			MethodSignatures["jdk/internal/misc/Unsafe."+name+kind+"(Ljava/lang/Object;J"+desc+desc+")Z"] =
+				GMeth{
+					ParamSlots: 3 + 2*valueSlots,
+					ObjectRef:  true,
+					GFunction:  compareAndSet,
+				}
+		}
+		for _, name := range []string{"compareAndExchange", "compareAndExchangeAcquire", "compareAndExchangeRelease"} {
+			MethodSignatures["jdk/internal/misc/Unsafe."+name+kind+"(Ljava/lang/Object;J"+desc+desc+")"+desc] =
+				GMeth{
+					ParamSlots: 3 + 2*valueSlots,
+					ObjectRef:  true,
+					GFunction:  compareAndExchange,
+				}
+		}
+		for _, mode := range []string{"", "Acquire", "Release"} {
+			MethodSignatures["jdk/internal/misc/Unsafe.getAndSet"+kind+mode+"(Ljava/lang/Object;J"+desc+")"+desc] =
+				GMeth{
+					ParamSlots: 3 + valueSlots,
+					ObjectRef:  true,
+					GFunction:  getAndSet,
+				}
+			if kind == "Reference" {
+				continue
+			}
+			MethodSignatures["jdk/internal/misc/Unsafe.getAndAdd"+kind+mode+"(Ljava/lang/Object;J"+desc+")"+desc] =
+				GMeth{
+					ParamSlots: 3 + valueSlots,
+					ObjectRef:  true,
+					GFunction:  getAndAdd(kind),
+				}
+			for _, op := range []string{"And", "Or", "Xor"} {
+				MethodSignatures["jdk/internal/misc/Unsafe.getAndBitwise"+op+kind+mode+"(Ljava/lang/Object;J"+desc+")"+desc] =
+					GMeth{
+						ParamSlots: 3 + valueSlots,
+						ObjectRef:  true,
+						GFunction:  getAndBitwise(op),
+					}
+			}
+		}
+	}
+
 	MethodSignatures["jdk/internal/misc/Unsafe.<clinit>()V"] = // offset to start of first item in an array
 		GMeth{
 			ParamSlots: 0,
@@ -48,7 +224,7 @@ func Load_Misc_Unsafe() map[string]GMeth {
 // Return the number of bytes between the beginning of the object and the first element.
 // This is used in computing the pointer to a given element
 func arrayBaseOffset(param []interface{}) interface{} {
-	p := param[0]
+	p := param[1]
 	if p == nil || p == object.Null {
 		errMsg := "jdk.internal.misc.Unsafe::arrayBaseOffset() was passed a null pointer"
 		exceptions.Throw(exceptions.NullPointerException, errMsg)
@@ -57,6 +233,440 @@ func arrayBaseOffset(param []interface{}) interface{} {
 	return int64(0) // this should work...
 }
 
+// Return the number of bytes between consecutive elements of an array. In Jacobin,
+// an array element's offset is its index, so this is always 1.
+func arrayIndexScale(param []interface{}) interface{} {
+	p := param[1]
+	if p == nil || p == object.Null {
+		errMsg := "jdk.internal.misc.Unsafe::arrayIndexScale() was passed a null pointer"
+		exceptions.Throw(exceptions.NullPointerException, errMsg)
+		return errors.New(errMsg)
+	}
+	return int64(1)
+}
+
+// the size of a native pointer
+func addressSize([]interface{}) interface{} {
+	return int64(8)
+}
+
+// objectFieldOffset(Class, String) returns the offset of the named field of the class
+func objectFieldOffset(params []interface{}) interface{} {
+	nameObj, ok := params[2].(*object.Object)
+	if !ok || object.IsNull(nameObj) {
+		errMsg := "jdk.internal.misc.Unsafe::objectFieldOffset() was passed a null field name"
+		exceptions.Throw(exceptions.NullPointerException, errMsg)
+		return errors.New(errMsg)
+	}
+	fieldName := object.GetGoStringFromJavaStringPtr(nameObj)
+
+	// if the class is loaded, the field must be one of its fields or of its superclasses
+	if className := unsafeClassName(params[1]); className != "" && MethAreaFetch(className) != nil {
+		if !classHasField(className, fieldName) {
+			errMsg := fmt.Sprintf("jdk.internal.misc.Unsafe::objectFieldOffset(): %s has no field %s",
+				className, fieldName)
+			exceptions.Throw(exceptions.IllegalArgumentException, errMsg)
+			return errors.New(errMsg)
+		}
+	}
+
+	unsafeMutex.Lock()
+	defer unsafeMutex.Unlock()
+	return fieldOffset(fieldName)
+}
+
+// fieldOffset returns the offset of the field named fieldName, assigning it one if
+// it has none yet. Must be called with unsafeMutex held.
+func fieldOffset(fieldName string) int64 {
+	offset, ok := unsafeFieldOffsets[fieldName]
+	if !ok {
+		offset = int64(len(unsafeFieldNames))
+		unsafeFieldNames = append(unsafeFieldNames, fieldName)
+		unsafeFieldOffsets[fieldName] = offset
+	}
+	return offset
+}
+
+// unsafeClassName returns the name of the class that's passed to Unsafe as a Class,
+// which is either the String pushed by LDC or a loaded class
+func unsafeClassName(class interface{}) string {
+	switch c := class.(type) {
+	case *object.Object:
+		if !object.IsNull(c) && c.Klass != nil && *c.Klass == object.StringClassName {
+			return object.GetGoStringFromJavaStringPtr(c)
+		}
+	case *Klass:
+		if c != nil && c.Data != nil {
+			return c.Data.Name
+		}
+	}
+	return ""
+}
+
+// classHasField reports whether the named class, or one of its superclasses, has
+// a field named fieldName
+func classHasField(className, fieldName string) bool {
+	for className != "" {
+		k := MethAreaFetch(className)
+		if k == nil || k.Data == nil {
+			return false
+		}
+		for _, f := range k.Data.Fields {
+			if k.Data.CP.Utf8Refs[f.Name] == fieldName {
+				return true
+			}
+		}
+		className = k.Data.Superclass
+	}
+	return false
+}
+
+// Unsafe.getUnsafe() returns the Unsafe object
+func getUnsafe([]interface{}) interface{} {
+	theUnsafeOnce.Do(func() {
+		theUnsafe = object.MakeEmptyObject()
+		className := "jdk/internal/misc/Unsafe"
+		theUnsafe.Klass = &className
+	})
+	return theUnsafe
+}
+
+// The fences order the memory accesses before them with those after them, which the
+// field locks already do
+func unsafeFence([]interface{}) interface{} {
+	return nil
+}
+
+// get<Kind>(Object, long) and its volatile, acquire, and opaque variants. The object
+// and offset follow the Unsafe object in params.
+func unsafeGet(params []interface{}) interface{} {
+	lock, err := lockFields(params[1])
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	value, err := unsafeLoad(params[1], params[2].(int64))
+	if err != nil {
+		return err
+	}
+	return value
+}
+
+// put<Kind>(Object, long, value) and its volatile, release, and opaque variants
+func unsafePut(params []interface{}) interface{} {
+	lock, err := lockFields(params[1])
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err = unsafeStore(params[1], params[2].(int64), params[4]); err != nil {
+		return err
+	}
+	return nil
+}
+
+// compareAndSet<Kind>(Object, long, expected, x) sets the field or array element to x
+// if it holds the expected value, and returns whether it did. The weak variants, which
+// may fail spuriously on some hardware, never do here.
+func compareAndSet(params []interface{}) interface{} {
+	witness := compareAndExchange(params)
+	if err, ok := witness.(error); ok {
+		return err
+	}
+	return types.ConvertGoBoolToJavaBool(unsafeSameValue(witness, params[4]))
+}
+
+// compareAndExchange<Kind>(Object, long, expected, x) sets the field or array element
+// to x if it holds the expected value, and returns the value it held
+func compareAndExchange(params []interface{}) interface{} {
+	lock, err := lockFields(params[1])
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	offset := params[2].(int64)
+	expected := params[4]
+	x := params[len(params)-1] // a long or double x is in the last two params
+	current, err := unsafeLoad(params[1], offset)
+	if err != nil {
+		return err
+	}
+	if unsafeSameValue(current, expected) {
+		if err = unsafeStore(params[1], offset, x); err != nil {
+			return err
+		}
+	}
+	return current
+}
+
+// getAndSet<Kind>(Object, long, x) sets the field or array element to x and returns
+// the value it held
+func getAndSet(params []interface{}) interface{} {
+	return unsafeUpdate(params, func(_ interface{}) interface{} { return params[4] })
+}
+
+// getAndAdd returns the function for getAndAdd<kind>(Object, long, delta), which adds
+// delta to the field or array element and returns the value it held. An int wraps
+// around as it does in Java.
+func getAndAdd(kind string) func([]interface{}) interface{} {
+	return func(params []interface{}) interface{} {
+		return unsafeUpdate(params, func(current interface{}) interface{} {
+			sum := current.(int64) + params[4].(int64)
+			if kind == "Int" {
+				return int64(int32(sum))
+			}
+			return sum
+		})
+	}
+}
+
+// getAndBitwise returns the function for getAndBitwise<op><Kind>(Object, long, mask),
+// which applies the mask to the field or array element and returns the value it held
+func getAndBitwise(op string) func([]interface{}) interface{} {
+	return func(params []interface{}) interface{} {
+		return unsafeUpdate(params, func(current interface{}) interface{} {
+			mask := params[4].(int64)
+			switch op {
+			case "And":
+				return current.(int64) & mask
+			case "Or":
+				return current.(int64) | mask
+			default:
+				return current.(int64) ^ mask
+			}
+		})
+	}
+}
+
+// unsafeUpdate atomically replaces the value of the field or array element addressed
+// by params with the value computed from it by update, and returns the original value
+func unsafeUpdate(params []interface{}, update func(interface{}) interface{}) interface{} {
+	lock, err := lockFields(params[1])
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	offset := params[2].(int64)
+	current, err := unsafeLoad(params[1], offset)
+	if err != nil {
+		return err
+	}
+	if err = unsafeStore(params[1], offset, update(current)); err != nil {
+		return err
+	}
+	return current
+}
+
+// unsafeLoad returns the value of the field or array element of target at offset.
+// Must be called with the field lock of target held.
+func unsafeLoad(target interface{}, offset int64) (interface{}, error) {
+	obj, err := unsafeTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if isUnsafeArray(obj) {
+		if err = checkArrayOffset(obj, offset); err != nil {
+			return nil, err
+		}
+		switch arr := obj.Fields[0].Fvalue.(type) {
+		case *[]byte:
+			return int64(int8((*arr)[offset])), nil
+		case *[]int64:
+			return (*arr)[offset], nil
+		case *[]float64:
+			return (*arr)[offset], nil
+		case *[]*object.Object:
+			if (*arr)[offset] == nil {
+				return object.Null, nil
+			}
+			return (*arr)[offset], nil
+		}
+	}
+
+	name, err := unsafeFieldName(obj, offset)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if i := fieldIndex(obj, name); i >= 0 {
+		value = obj.Fields[i].Fvalue
+	} else {
+		value = obj.FieldTable[name].Fvalue
+	}
+	if value == nil { // a reference field that's not been set
+		return object.Null, nil
+	}
+	return value, nil
+}
+
+// unsafeStore sets the field or array element of target at offset to value. Must be
+// called with the field lock of target held.
+func unsafeStore(target interface{}, offset int64, value interface{}) error {
+	obj, err := unsafeTarget(target)
+	if err != nil {
+		return err
+	}
+
+	if isUnsafeArray(obj) {
+		if err = checkArrayOffset(obj, offset); err != nil {
+			return err
+		}
+		switch arr := obj.Fields[0].Fvalue.(type) {
+		case *[]byte:
+			(*arr)[offset] = byte(value.(int64))
+		case *[]int64:
+			(*arr)[offset] = value.(int64)
+		case *[]float64:
+			(*arr)[offset] = value.(float64)
+		case *[]*object.Object:
+			ref, _ := value.(*object.Object)
+			(*arr)[offset] = ref
+		}
+		return nil
+	}
+
+	name, err := unsafeFieldName(obj, offset)
+	if err != nil {
+		return err
+	}
+	// an object without superclasses keeps its fields both in Fields and in FieldTable
+	if i := fieldIndex(obj, name); i >= 0 {
+		obj.Fields[i].Fvalue = value
+	}
+	if f := obj.FieldTable[name]; f != nil {
+		f.Fvalue = value
+	}
+	return nil
+}
+
+// lockFields locks the field lock of target, which must not be null, and returns it
+func lockFields(target interface{}) (*sync.RWMutex, error) {
+	obj, err := unsafeTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	lock := object.FieldLock(obj)
+	lock.Lock()
+	return lock, nil
+}
+
+// unsafeTarget returns the object whose field or element Unsafe accesses, which must not be null
+func unsafeTarget(target interface{}) (*object.Object, error) {
+	obj, ok := target.(*object.Object)
+	if !ok || object.IsNull(obj) {
+		errMsg := "jdk.internal.misc.Unsafe: attempt to access a field or element of a null object"
+		exceptions.Throw(exceptions.NullPointerException, errMsg)
+		return nil, errors.New(errMsg)
+	}
+	return obj, nil
+}
+
+// isUnsafeArray reports whether obj is an array, whose elements are accessed by index
+func isUnsafeArray(obj *object.Object) bool {
+	if len(obj.Fields) != 1 || !strings.HasPrefix(obj.Fields[0].Ftype, types.Array) {
+		return false
+	}
+	return obj.Klass == nil || strings.HasPrefix(*obj.Klass, types.Array)
+}
+
+// checkArrayOffset returns an error if offset is not the index of an element of the array obj
+func checkArrayOffset(obj *object.Object, offset int64) error {
+	var length int
+	switch arr := obj.Fields[0].Fvalue.(type) {
+	case *[]byte:
+		length = len(*arr)
+	case *[]int64:
+		length = len(*arr)
+	case *[]float64:
+		length = len(*arr)
+	case *[]*object.Object:
+		length = len(*arr)
+	}
+	if offset < 0 || offset >= int64(length) {
+		errMsg := fmt.Sprintf("jdk.internal.misc.Unsafe: offset %d is out of bounds for an array of length %d",
+			offset, length)
+		exceptions.Throw(exceptions.ArrayIndexOutOfBoundsException, errMsg)
+		return errors.New(errMsg)
+	}
+	return nil
+}
+
+// unsafeFieldName returns the name of the field of obj at offset
+func unsafeFieldName(obj *object.Object, offset int64) (string, error) {
+	unsafeMutex.Lock()
+	valid := offset >= 0 && offset < int64(len(unsafeFieldNames))
+	var name string
+	if valid {
+		name = unsafeFieldNames[offset]
+	}
+	unsafeMutex.Unlock()
+
+	if valid {
+		if _, ok := obj.FieldTable[name]; ok || fieldIndex(obj, name) >= 0 {
+			return name, nil
+		}
+	}
+	className := "<unknown>"
+	if obj.Klass != nil {
+		className = *obj.Klass
+	}
+	errMsg := fmt.Sprintf("jdk.internal.misc.Unsafe: %s has no field at offset %d", className, offset)
+	exceptions.Throw(exceptions.IllegalArgumentException, errMsg)
+	return "", errors.New(errMsg)
+}
+
+// fieldIndex returns the index in obj.Fields of the field named name, or -1 if obj
+// doesn't keep its fields in Fields. (The fields there are in the order they're
+// declared in the class.)
+func fieldIndex(obj *object.Object, name string) int {
+	if obj.Fields == nil || obj.Klass == nil {
+		return -1
+	}
+	k := ObjectKlass(obj)
+	if k == nil || k.Data == nil {
+		return -1
+	}
+	for i, f := range k.Data.Fields {
+		if k.Data.CP.Utf8Refs[f.Name] == name && i < len(obj.Fields) {
+			return i
+		}
+	}
+	return -1
+}
+
+// unsafeSameValue reports whether two values of a field or array element are the same,
+// which for references means they point to the same object
+func unsafeSameValue(a, b interface{}) bool {
+	refA, isRefA := a.(*object.Object)
+	refB, isRefB := b.(*object.Object)
+	if isRefA || isRefB {
+		if object.IsNull(a) && object.IsNull(b) {
+			return true
+		}
+		return isRefA && isRefB && refA == refB
+	}
+	return a == b
+}
+
+// unsafeClinit takes the place of Unsafe's static initializer, which computes the
+// sizes and offsets that Unsafe publishes as constants
 func unsafeClinit([]interface{}) interface{} {
+	_ = AddStatic("jdk/internal/misc/Unsafe.theUnsafe",
+		Static{Type: "Ljdk/internal/misc/Unsafe;", Value: getUnsafe(nil)})
+	_ = AddStatic("jdk/internal/misc/Unsafe.INVALID_FIELD_OFFSET",
+		Static{Type: types.Int, Value: int64(-1)})
+	_ = AddStatic("jdk/internal/misc/Unsafe.ADDRESS_SIZE",
+		Static{Type: types.Int, Value: int64(8)})
+	for _, kind := range []string{"BOOLEAN", "BYTE", "SHORT", "CHAR", "INT", "LONG", "FLOAT", "DOUBLE", "OBJECT"} {
+		_ = AddStatic("jdk/internal/misc/Unsafe.ARRAY_"+kind+"_BASE_OFFSET",
+			Static{Type: types.Int, Value: int64(0)})
+		_ = AddStatic("jdk/internal/misc/Unsafe.ARRAY_"+kind+"_INDEX_SCALE",
+			Static{Type: types.Int, Value: int64(1)})
+	}
 	return nil
 }
@@ -0,0 +1,177 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package classloader
+
+import (
+	"jacobin/globals"
+	"jacobin/log"
+	"jacobin/object"
+	"jacobin/types"
+	"sync"
+	"testing"
+)
+
+// unsafeSetup loads the Unsafe methods and a class, test/Counter, whose objects keep
+// their fields in Fields as well as in FieldTable
+func unsafeSetup() {
+	globals.InitGlobals("test")
+	log.Init()
+	InitMethodArea()
+	Load_Misc_Unsafe()
+	MethAreaInsert("test/Counter", &Klass{
+		Status: 'X', Loader: "bootstrap",
+		Data: &ClData{
+			Name:       "test/Counter",
+			Superclass: "java/lang/Object",
+			Fields:     []Field{{Name: 0, Desc: 1}, {Name: 2, Desc: 3}},
+			CP:         CPool{Utf8Refs: []string{"count", "I", "next", "Ljava/lang/Object;"}},
+		},
+	})
+}
+
+// newCounter returns a test/Counter object
+func newCounter() *object.Object {
+	obj := object.MakeEmptyObject()
+	className := "test/Counter"
+	obj.Klass = &className
+	obj.Fields = []object.Field{{Ftype: types.Int, Fvalue: int64(0)}, {Ftype: types.Ref, Fvalue: nil}}
+	obj.FieldTable["count"] = &object.Field{Ftype: types.Int, Fvalue: int64(0)}
+	obj.FieldTable["next"] = &object.Field{Ftype: types.Ref, Fvalue: nil}
+	return obj
+}
+
+// callUnsafe calls the Unsafe method sig with the arguments args, which follow the Unsafe object
+func callUnsafe(t *testing.T, sig string, args ...interface{}) interface{} {
+	gmeth, ok := MethodSignatures["jdk/internal/misc/Unsafe."+sig]
+	if !ok {
+		t.Fatalf("Unsafe: Expected %s to be implemented", sig)
+	}
+	return gmeth.GFunction(append([]interface{}{getUnsafe(nil)}, args...))
+}
+
+// fieldOffsetOf returns the offset Unsafe gives the named field of test/Counter
+func fieldOffsetOf(t *testing.T, fieldName string) int64 {
+	className := "test/Counter"
+	class := object.CreateCompactStringFromGoString(&className) // as LDC pushes it
+	name := object.CreateCompactStringFromGoString(&fieldName)
+	offset, ok := callUnsafe(t, "objectFieldOffset(Ljava/lang/Class;Ljava/lang/String;)J", class, name).(int64)
+	if !ok {
+		t.Fatalf("Unsafe: Expected an offset for field %s", fieldName)
+	}
+	return offset
+}
+
+func TestUnsafeFieldAccess(t *testing.T) {
+	unsafeSetup()
+	obj := newCounter()
+	count := fieldOffsetOf(t, "count")
+	next := fieldOffsetOf(t, "next")
+	if count == next || fieldOffsetOf(t, "count") != count {
+		t.Errorf("Unsafe: Expected each field to have an offset of its own, got %d and %d", count, next)
+	}
+
+	callUnsafe(t, "putIntVolatile(Ljava/lang/Object;JI)V", obj, count, count, int64(5))
+	if obj.Fields[0].Fvalue != int64(5) || obj.FieldTable["count"].Fvalue != int64(5) {
+		t.Errorf("Unsafe: Expected the field to be set in Fields and FieldTable, got %v and %v",
+			obj.Fields[0].Fvalue, obj.FieldTable["count"].Fvalue)
+	}
+	if ret := callUnsafe(t, "getInt(Ljava/lang/Object;J)I", obj, count, count); ret != int64(5) {
+		t.Errorf("Unsafe: Expected getInt() to return 5, got %v", ret)
+	}
+	if ret := callUnsafe(t, "getReferenceAcquire(Ljava/lang/Object;J)Ljava/lang/Object;", obj, next, next); ret != object.Null {
+		t.Errorf("Unsafe: Expected a field that's not set to be null, got %v", ret)
+	}
+}
+
+func TestUnsafeCompareAndSet(t *testing.T) {
+	unsafeSetup()
+	obj := newCounter()
+	count := fieldOffsetOf(t, "count")
+	next := fieldOffsetOf(t, "next")
+
+	casInt := "compareAndSetInt(Ljava/lang/Object;JII)Z"
+	if callUnsafe(t, casInt, obj, count, count, int64(1), int64(2)) != types.JavaBoolFalse {
+		t.Errorf("Unsafe: Expected compareAndSetInt() to fail when the field doesn't hold the expected value")
+	}
+	if callUnsafe(t, casInt, obj, count, count, int64(0), int64(2)) != types.JavaBoolTrue ||
+		obj.Fields[0].Fvalue != int64(2) {
+		t.Errorf("Unsafe: Expected compareAndSetInt() to set the field to 2, got %v", obj.Fields[0].Fvalue)
+	}
+
+	node := object.MakeEmptyObject()
+	casRef := "compareAndSetReference(Ljava/lang/Object;JLjava/lang/Object;Ljava/lang/Object;)Z"
+	if callUnsafe(t, casRef, obj, next, next, object.Null, node) != types.JavaBoolTrue {
+		t.Errorf("Unsafe: Expected compareAndSetReference() to replace null")
+	}
+	exchange := "compareAndExchangeReference(Ljava/lang/Object;JLjava/lang/Object;Ljava/lang/Object;)Ljava/lang/Object;"
+	if ret := callUnsafe(t, exchange, obj, next, next, object.MakeEmptyObject(), object.Null); ret != node {
+		t.Errorf("Unsafe: Expected compareAndExchangeReference() to return the current value, got %v", ret)
+	}
+	if obj.FieldTable["next"].Fvalue != node {
+		t.Errorf("Unsafe: Expected a failed compareAndExchangeReference() to leave the field as is")
+	}
+}
+
+func TestUnsafeArrayAccess(t *testing.T) {
+	unsafeSetup()
+	arr := object.Make1DimArray(object.REF, 4)
+	className := "[Ljava/lang/Object;"
+	class := object.CreateCompactStringFromGoString(&className)
+	scale := callUnsafe(t, "arrayIndexScale(Ljava/lang/Class;)I", class)
+	base := callUnsafe(t, "arrayBaseOffset(Ljava/lang/Class;)I", class)
+	offset := base.(int64) + 2*scale.(int64)
+
+	elem := object.MakeEmptyObject()
+	casRef := "compareAndSetReference(Ljava/lang/Object;JLjava/lang/Object;Ljava/lang/Object;)Z"
+	if callUnsafe(t, casRef, arr, offset, offset, object.Null, elem) != types.JavaBoolTrue {
+		t.Errorf("Unsafe: Expected compareAndSetReference() to set an array element")
+	}
+	if (*arr.Fields[0].Fvalue.(*[]*object.Object))[2] != elem {
+		t.Errorf("Unsafe: Expected element 2 of the array to be set")
+	}
+
+	if _, ok := callUnsafe(t, "getReferenceVolatile(Ljava/lang/Object;J)Ljava/lang/Object;", arr, int64(4), int64(4)).(error); !ok {
+		t.Errorf("Unsafe: Expected an error accessing an element past the end of the array")
+	}
+}
+
+// getAndAddInt() is atomic: increments made concurrently are not lost
+func TestUnsafeGetAndAddIsAtomic(t *testing.T) {
+	unsafeSetup()
+	obj := newCounter()
+	count := fieldOffsetOf(t, "count")
+
+	const threads, increments = 8, 1000
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				callUnsafe(t, "getAndAddInt(Ljava/lang/Object;JI)I", obj, count, count, int64(1))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ret := callUnsafe(t, "getIntVolatile(Ljava/lang/Object;J)I", obj, count, count); ret != int64(threads*increments) {
+		t.Errorf("Unsafe: Expected the count to be %d, got %v", threads*increments, ret)
+	}
+}
+
+// an int wraps around, as in Java
+func TestUnsafeGetAndAddIntWraps(t *testing.T) {
+	unsafeSetup()
+	obj := newCounter()
+	count := fieldOffsetOf(t, "count")
+	obj.Fields[0].Fvalue = int64(2147483647)
+
+	callUnsafe(t, "getAndAddInt(Ljava/lang/Object;JI)I", obj, count, count, int64(1))
+	if obj.Fields[0].Fvalue != int64(-2147483648) {
+		t.Errorf("Unsafe: Expected the int to wrap around, got %v", obj.Fields[0].Fvalue)
+	}
+}
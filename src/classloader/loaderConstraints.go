@@ -0,0 +1,153 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package classloader
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// When a class calls a method of a class that was defined by a different loader, the
+// two loaders must agree on the classes named in the method's descriptor: if each
+// loaded a different class called Foo, the caller could pass the callee a Foo it
+// doesn't know how to handle. So the JVM imposes a loader constraint for each class
+// named in the descriptor, which says that the two loaders must load the same class of
+// that name. A constraint is violated, and a LinkageError is thrown, if the loaders
+// have already loaded different classes of that name, or if one of them later loads a
+// class other than the one the other loaded.
+//
+// Constraints are transitive, so the loaders constrained to load the same class of a
+// given name form sets, which are merged as constraints are added.
+//
+// (See JVMS 5.3.4: https://docs.oracle.com/javase/specs/jvms/se17/html/jvms-5.html#jvms-5.3.4)
+
+// loaderConstraints holds, for each class name, the sets of loaders (by name) that
+// must load the same class of that name
+var loaderConstraints = make(map[string][]map[string]bool)
+var loaderConstraintsMutex sync.Mutex
+
+// definingLoader returns the name of the loader that defined klass
+func definingLoader(klass *Klass) string {
+	if klass.Loader == "" {
+		return BootstrapCL.Name
+	}
+	return klass.Loader
+}
+
+// AddLoaderConstraint requires that the loaders named loader1 and loader2 load the
+// same class named className. It returns an error if they, or loaders they're
+// already constrained to agree with, have loaded different classes of that name.
+func AddLoaderConstraint(className, loader1, loader2 string) error {
+	if loader1 == loader2 {
+		return nil
+	}
+
+	loaderConstraintsMutex.Lock()
+	defer loaderConstraintsMutex.Unlock()
+
+	// merge the sets that contain the two loaders
+	merged := map[string]bool{loader1: true, loader2: true}
+	var others []map[string]bool
+	for _, set := range loaderConstraints[className] {
+		if set[loader1] || set[loader2] {
+			for loader := range set {
+				merged[loader] = true
+			}
+		} else {
+			others = append(others, set)
+		}
+	}
+
+	// all the loaders in the merged set that have loaded the class must have loaded the same one
+	var loaded *Klass
+	var loadedBy string
+	for loader := range merged {
+		k := MethAreaFetchFromLoader(loader, className)
+		if k == nil {
+			continue
+		}
+		if loaded != nil && k != loaded {
+			return fmt.Errorf("loader constraint violation: loader '%s' and loader '%s' have "+
+				"different Class objects for the type %s", loadedBy, loader, className)
+		}
+		loaded, loadedBy = k, loader
+	}
+
+	loaderConstraints[className] = append(others, merged)
+	return nil
+}
+
+// checkLoaderConstraints returns an error if recording that the loader named loader
+// has loaded klass, whose name is className, would violate a loader constraint
+func checkLoaderConstraints(loader, className string, klass *Klass) error {
+	loaderConstraintsMutex.Lock()
+	defer loaderConstraintsMutex.Unlock()
+
+	for _, set := range loaderConstraints[className] {
+		if !set[loader] {
+			continue
+		}
+		for other := range set {
+			k := MethAreaFetchFromLoader(other, className)
+			if other != loader && k != nil && k != klass {
+				return fmt.Errorf("loader constraint violation: loader '%s' wants to load class %s. "+
+					"A different class with the same name was previously loaded by '%s'",
+					loader, className, other)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckMethodLoaderConstraints imposes the loader constraints required when the class
+// callerName, whose defining loader is the loader named callerLoader, calls the method
+// methName, whose descriptor is methType, in the class callee. If the two classes were
+// defined by the same loader, there are none. It returns an error, for a LinkageError,
+// if the constraints are violated.
+func CheckMethodLoaderConstraints(callerLoader, callerName string, callee *Klass, methName, methType string) error {
+	if callee == nil || callee.Data == nil {
+		return nil
+	}
+	if callerLoader == "" {
+		callerLoader = BootstrapCL.Name
+	}
+	calleeLoader := definingLoader(callee)
+	if callerLoader == calleeLoader {
+		return nil
+	}
+
+	for _, className := range descriptorClassNames(methType) {
+		if err := AddLoaderConstraint(className, callerLoader, calleeLoader); err != nil {
+			return fmt.Errorf("loader constraint violation: when resolving method %s.%s%s "+
+				"the class loader '%s' of the current class, %s, and the class loader '%s' for "+
+				"the method's defining class, %s, have different Class objects for the type %s "+
+				"used in the signature", callee.Data.Name, methName, methType, callerLoader,
+				callerName, calleeLoader, callee.Data.Name, className)
+		}
+	}
+	return nil
+}
+
+// descriptorClassNames returns the names of the classes named in a method descriptor,
+// including the element classes of arrays, such as java/lang/String for both
+// Ljava/lang/String; and [Ljava/lang/String;
+func descriptorClassNames(descriptor string) []string {
+	var names []string
+	for {
+		start := strings.IndexByte(descriptor, 'L')
+		if start < 0 {
+			return names
+		}
+		end := strings.IndexByte(descriptor[start:], ';')
+		if end < 0 {
+			return names
+		}
+		names = append(names, descriptor[start+1:start+end])
+		descriptor = descriptor[start+end+1:]
+	}
+}
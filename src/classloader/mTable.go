@@ -42,10 +42,15 @@ type MData interface{}
 // GMeth is the entry in the MTable for Go functions. See MTable comments for details.
 // Fu is a go function. All go functions accept a possibly empty slice of interface{} and
 // return a possibly nil interface{}
+//
+// A function whose NeedsContext is true is passed the frame stack (a *list.List) of the
+// thread that calls it as its last parameter, following the method's arguments. It's
+// needed by functions that act on the calling thread or execute Java methods.
 type GMeth struct {
-	ParamSlots int
-	ObjectRef  bool
-	GFunction  func([]interface{}) interface{}
+	ParamSlots   int
+	ObjectRef    bool
+	NeedsContext bool
+	GFunction    func([]interface{}) interface{}
 }
 
 // JmEntry is the entry in the Mtable for Java methods.
@@ -59,6 +64,7 @@ type JmEntry struct {
 	params      []ParamAttrib
 	deprecated  bool
 	Cp          *CPool
+	Loader      string // the defining loader of the method's class
 }
 
 // Function is the generic-style function used for Go entries: a function that accepts a
@@ -67,8 +73,17 @@ type JmEntry struct {
 type Function func([]interface{}) interface{}
 
 // MTmutex is used for updates to the MTable because multiple threads could be
-// updating it simultaneously.
-var MTmutex sync.Mutex
+// updating it simultaneously. Lookups take its read lock (see MTableFetch()).
+var MTmutex sync.RWMutex
+
+// MTableFetch returns the MTable entry for the method whose fully qualified name
+// (class name, method name, and method type) is methFQN, and whether there is one
+func MTableFetch(methFQN string) (MTentry, bool) {
+	MTmutex.RLock()
+	mte, ok := MTable[methFQN]
+	MTmutex.RUnlock()
+	return mte, ok
+}
 
 // MTableLoadNatives loads the Go methods from files that contain them. It does this
 // by calling the Load_* function in each of those files to load whatever Go functions
@@ -93,6 +108,7 @@ func loadlib(tbl *MT, libMeths map[string]GMeth) {
 		gme := GMeth{}
 		gme.ParamSlots = val.ParamSlots
 		gme.ObjectRef = val.ObjectRef
+		gme.NeedsContext = val.NeedsContext
 		gme.GFunction = val.GFunction
 
 		tableEntry := MTentry{
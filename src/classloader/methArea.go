@@ -10,23 +10,82 @@ import (
 	"errors"
 	"fmt"
 	"jacobin/log"
+	"jacobin/object"
 	"jacobin/types"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// MethArea contains all the loaded classes. Key is the class name in java/lang/Object format.
-// var MethArea = make(map[string]Klass)
+// MethArea contains all the loaded classes. Each class is recorded under the name of
+// every loader that initiated its loading (see delegation.go), so the key is the
+// loader's name and the class name in java/lang/Object format (a methAreaKey).
+// var MethArea = make(map[methAreaKey]Klass)
 var MethArea *sync.Map
 var methAreaSize = 0
 var MethAreaMutex sync.RWMutex // All additions or updates to MethArea map come through this mutex
 
+// methAreaKey is the key of a class in the method area
+type methAreaKey struct {
+	loader string // the name of an initiating loader of the class
+	name   string // the name of the class
+}
+
+// methAreaVersion is incremented whenever a class is inserted into the method area.
+// Anything derived from the classes there, such as the inline caches of the
+// interpreter's call sites, is valid only as long as the version doesn't change.
+var methAreaVersion atomic.Uint64
+
+// klassNames maps the address of the Name field of each class in the method area to
+// the class. The objects of a class point their Klass field there (see ObjectKlass()).
+var klassNames sync.Map
+
 // MethAreaFetch retrieves a pointer to a loaded class from the
-// method area. In the event the class is not present there, the
-// function returns nil.
+// method area, as it's seen by the application classloader.
+// In the event the class is not present there, the function returns nil.
+// The classes that a user-defined loader defines are found with
+// MethAreaFetchFor().
 func MethAreaFetch(key string) *Klass {
+	return MethAreaFetchFromLoader(AppCL.Name, key)
+}
+
+// MethAreaFetchFor retrieves a pointer to the class named key, as it's seen by the code
+// of the classes whose defining loader is the classloader named loader. The classes of
+// the built-in loaders see the classes as the application classloader does; those of a
+// user-defined loader see them as that loader does. In the event the class is not
+// present there, the function returns nil.
+func MethAreaFetchFor(loader, key string) *Klass {
+	if !IsUserLoader(loader) {
+		return MethAreaFetch(key)
+	}
+	return MethAreaFetchFromLoader(loader, key)
+}
+
+// ObjectKlass returns the class of the object obj, or nil if it's not in the method
+// area. The objects that are instantiated from a class point their Klass field to the
+// name in the class's data, which identifies the class even when several loaders have
+// defined a class of that name. Other objects are of the class of that name as the
+// application classloader sees it.
+func ObjectKlass(obj *object.Object) *Klass {
+	if obj == nil || obj.Klass == nil {
+		return nil
+	}
+	if k, ok := klassNames.Load(obj.Klass); ok {
+		return k.(*Klass)
+	}
+	return MethAreaFetch(*obj.Klass)
+}
+
+// MethAreaFetchFromLoader retrieves a pointer to the class named key, as it's seen by
+// the classloader named loader: the class if the loader has loaded it, or else the
+// class as seen by the loader's parent. In the event the class is not present there,
+// the function returns nil.
+func MethAreaFetchFromLoader(loader, key string) *Klass {
 	MethAreaMutex.RLock()
-	v, _ := MethArea.Load(key)
+	var v any
+	for cl := LoaderNamed(loader); cl != nil && v == nil; cl = cl.GetParent() {
+		v, _ = MethArea.Load(methAreaKey{cl.Name, key})
+	}
 	MethAreaMutex.RUnlock()
 	if v == nil {
 		_ = log.Log("MethAreaFetch: key("+key+") --> nil", log.CLASS)
@@ -36,13 +95,39 @@ func MethAreaFetch(key string) *Klass {
 	return v.(*Klass)
 }
 
+// methAreaFetchInitiated retrieves a pointer to the class named key if the classloader
+// named loader has loaded it (that is, it's an initiating loader of the class), else nil
+func methAreaFetchInitiated(loader, key string) *Klass {
+	if loader == "" {
+		loader = BootstrapCL.Name
+	}
+	MethAreaMutex.RLock()
+	v, _ := MethArea.Load(methAreaKey{loader, key})
+	MethAreaMutex.RUnlock()
+	if v == nil {
+		return nil
+	}
+	return v.(*Klass)
+}
+
 // MethAreaInsert adds a class to the method area, using a pointer
-// to the parsed class.
+// to the parsed class. It's recorded under its defining loader; a
+// class with no loader, or whose loader is not a registered one
+// (as with the classes some tests create), is recorded under the
+// bootstrap loader.
 func MethAreaInsert(name string, klass *Klass) {
 	_ = log.Log("MethAreaInsert: key("+name+")", log.CLASS)
+	loader := klass.Loader
+	if loader == "" || LoaderNamed(loader) == nil {
+		loader = BootstrapCL.Name
+	}
+	if klass.Data != nil {
+		klassNames.Store(&klass.Data.Name, klass)
+	}
 	MethAreaMutex.Lock()
-	MethArea.Store(name, klass)
+	MethArea.Store(methAreaKey{loader, name}, klass)
 	methAreaSize++
+	methAreaVersion.Add(1)
 	MethAreaMutex.Unlock()
 
 	if klass.Status == 'F' || klass.Status == 'V' || klass.Status == 'L' {
@@ -50,6 +135,22 @@ func MethAreaInsert(name string, klass *Klass) {
 	}
 }
 
+// recordInitiatingLoader records that the classloader named loader has loaded the
+// class klass, whose name is name, unless doing so would violate a loader constraint
+// (see loaderConstraints.go). If the loader defined the class, it's already recorded.
+func recordInitiatingLoader(loader, name string, klass *Klass) error {
+	if err := checkLoaderConstraints(loader, name, klass); err != nil {
+		return err
+	}
+	if klass.Loader == loader || (klass.Loader == "" && loader == BootstrapCL.Name) {
+		return nil
+	}
+	MethAreaMutex.Lock()
+	MethArea.Store(methAreaKey{loader, name}, klass)
+	MethAreaMutex.Unlock()
+	return nil
+}
+
 // Size returns the number of entries in MethArea.
 // Because the golang's sync.Map does not have a len() function
 // we have to track our additions with a counter, which is
@@ -61,6 +162,12 @@ func MethAreaSize() int {
 	return size
 }
 
+// MethAreaVersion returns the current version of the method area, which changes
+// every time a class is inserted into it
+func MethAreaVersion() uint64 {
+	return methAreaVersion.Load()
+}
+
 // Wait for klass.Status to no longer be "I"
 // TODO: must be a better way to do this!
 func WaitForClassStatus(className string) error {
@@ -92,7 +199,24 @@ func InitMethodArea() {
 	ma := sync.Map{}
 	MethArea = &ma
 	methAreaSize = 0
+	methAreaVersion.Add(1)
 	MethAreaMutex.Unlock()
+	klassNames.Range(func(name, _ any) bool {
+		klassNames.Delete(name)
+		return true
+	})
+
+	// the loader constraints, itables, and vtables describe classes in the method area,
+	// so they're reset too
+	loaderConstraintsMutex.Lock()
+	loaderConstraints = make(map[string][]map[string]bool)
+	loaderConstraintsMutex.Unlock()
+	ITmutex.Lock()
+	ITables = make(map[*Klass]map[string]ITentry)
+	ITmutex.Unlock()
+	VTmutex.Lock()
+	VTables = make(map[*Klass]map[string]VTentry)
+	VTmutex.Unlock()
 
 	// preload the synthetic classes for arrays
 	MethAreaPreload()
@@ -48,19 +48,44 @@ type Static struct {
 	// CP        *CPool         // the constant pool for the class
 }
 
+// staticsMutex guards Statics. Statics are read and written only while it's held, so
+// that (as with instance fields; see object/fieldLocks.go) threads that access the same
+// static field don't race, and volatile statics are accessed atomically and in order.
 var staticsMutex = sync.RWMutex{}
 
-// AddStatic adds a static field to the Statics table using a mutex
+// AddStatic adds a static field to the Statics table using a mutex, or replaces it
+// with s if it's present. PUTSTATIC updates a static this way.
 func AddStatic(name string, s Static) error {
 	if name == "" {
 		return errors.New("AddStatic: Attempting to add invalid static entry")
 	}
-	staticsMutex.RLock()
+	staticsMutex.Lock()
 	Statics[name] = s
-	staticsMutex.RUnlock()
+	staticsMutex.Unlock()
 	return nil
 }
 
+// AddStaticIfAbsent adds a static field to the Statics table, unless it's already
+// there, and reports whether it did. A class's statics are added when it's first
+// instantiated; they must not replace a value another thread has stored since.
+func AddStaticIfAbsent(name string, s Static) bool {
+	staticsMutex.Lock()
+	defer staticsMutex.Unlock()
+	if _, present := Statics[name]; present || name == "" {
+		return false
+	}
+	Statics[name] = s
+	return true
+}
+
+// GetStatic returns the static field name from the Statics table, and whether it's there
+func GetStatic(name string) (Static, bool) {
+	staticsMutex.RLock()
+	s, ok := Statics[name]
+	staticsMutex.RUnlock()
+	return s, ok
+}
+
 // StaticsPreload preloads static fields from java.lang.String and other
 // immediately necessary statics. It's called in jvmStart.go
 func StaticsPreload() {
@@ -0,0 +1,54 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package classloader
+
+import (
+	"jacobin/types"
+	"sync"
+	"testing"
+)
+
+func TestAddStaticIfAbsent(t *testing.T) {
+	defer delete(Statics, "test/Class.count")
+	if !AddStaticIfAbsent("test/Class.count", Static{Type: types.Int, Value: int64(0)}) {
+		t.Errorf("AddStaticIfAbsent: Expected a new static to be added")
+	}
+	_ = AddStatic("test/Class.count", Static{Type: types.Int, Value: int64(5)})
+	if AddStaticIfAbsent("test/Class.count", Static{Type: types.Int, Value: int64(0)}) {
+		t.Errorf("AddStaticIfAbsent: Expected a static that's present not to be replaced")
+	}
+	if s, ok := GetStatic("test/Class.count"); !ok || s.Value != int64(5) {
+		t.Errorf("GetStatic: Expected the value 5, got %v", s.Value)
+	}
+}
+
+// statics can be read and written by several threads at once (run with -race)
+func TestStaticsConcurrentAccess(t *testing.T) {
+	defer delete(Statics, "test/Class.value")
+	_ = AddStatic("test/Class.value", Static{Type: types.Long, Value: int64(0)})
+
+	var wg sync.WaitGroup
+	for i := int64(1); i <= 4; i++ {
+		wg.Add(2)
+		go func(i int64) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = AddStatic("test/Class.value", Static{Type: types.Long, Value: i})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if s, ok := GetStatic("test/Class.value"); !ok || s.Type != types.Long {
+					t.Errorf("GetStatic: Expected a long static, got %v", s)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,202 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package classloader
+
+import (
+	"fmt"
+	"jacobin/log"
+	"strings"
+	"sync"
+)
+
+// Besides the built-in loaders, an app can create classloaders of its own by subclassing
+// java.lang.ClassLoader or by using a URLClassLoader. Each of these Java objects is
+// represented here by a user-defined Classloader, which is created by NewClassloader()
+// and whose parent is the loader that the object's parent represents. The object defines
+// a class by passing the bytes of its class file to ClassLoader.defineClass(), which
+// calls DefineClass(), so that its Classloader becomes the defining loader of the class.
+//
+// Loading a class with such a loader means calling the object's loadClass() method,
+// which the app can override, so it's done by the JVM (see jvm/classLoaders.go), which
+// records the result here with RecordLoadedClass().
+
+// ClassDefError is returned by DefineClass when it can't define a class. Exception is
+// the class of the Java exception that's thrown as a result, such as java/lang/LinkageError.
+type ClassDefError struct {
+	Exception string
+	Msg       string
+}
+
+func (e *ClassDefError) Error() string {
+	return e.Exception + ": " + e.Msg
+}
+
+// defineMutex makes checking that a loader hasn't already loaded a class and adding the
+// class it defines to the method area a single step, as two threads can define a class
+// of the same name at once
+var defineMutex sync.Mutex
+
+// IsBuiltinLoader reports whether the loader named name is one of the built-in loaders
+// (bootstrap, platform, and app) rather than a user-defined one. The empty name is that
+// of the bootstrap loader.
+func IsBuiltinLoader(name string) bool {
+	return name == "" || name == BootstrapCL.Name || name == PlatformCL.Name || name == AppCL.Name
+}
+
+// IsUserLoader reports whether the loader named name is a user-defined loader, created
+// by NewClassloader(). (Some classes, such as those the tests create, name a loader
+// that's neither; they're treated as classes of the built-in loaders.)
+func IsUserLoader(name string) bool {
+	return !IsBuiltinLoader(name) && LoaderNamed(name) != nil
+}
+
+// QualifiedName returns the name under which the tables of the JVM that are keyed by
+// class name, such as the MTable and the Statics table, hold the entries of the class
+// named className whose defining loader is the loader named loader. For the classes of
+// the built-in loaders, it's the class name; for those of a user-defined loader, the
+// name is qualified by the loader's, so that the classes of the same name that several
+// loaders define each have entries of their own.
+func QualifiedName(loader, className string) string {
+	if !IsUserLoader(loader) {
+		return className
+	}
+	return loader + "::" + className
+}
+
+// NewClassloader creates a user-defined classloader named name, whose parent is the
+// loader named parent, and registers it so that LoaderNamed() can find it. It returns
+// an error if there's already a loader of that name.
+func NewClassloader(name, parent string) (*Classloader, error) {
+	loadersMutex.Lock()
+	defer loadersMutex.Unlock()
+
+	if _, exists := loaders[name]; exists || IsBuiltinLoader(name) {
+		return nil, fmt.Errorf("NewClassloader: there is already a classloader named %s", name)
+	}
+	if parent == "" {
+		parent = BootstrapCL.Name
+	}
+	cl := &Classloader{Name: name, Parent: parent, Archives: make(map[string]*Archive)}
+	loaders[name] = cl
+	return cl, nil
+}
+
+// RemoveClassloader unregisters the user-defined loader named name, as when its
+// ClassLoader object has been garbage collected, and forgets the classes it loaded and
+// the loader constraints on it. A loader that has defined classes can't be removed, as
+// they stay in the method area for the life of the VM.
+func RemoveClassloader(name string) error {
+	if IsBuiltinLoader(name) || LoaderNamed(name) == nil {
+		return fmt.Errorf("RemoveClassloader: there is no user-defined classloader named %s", name)
+	}
+
+	MethAreaMutex.Lock()
+	var initiated []any
+	defined := false
+	MethArea.Range(func(key, v any) bool {
+		if key.(methAreaKey).loader == name {
+			initiated = append(initiated, key)
+			defined = defined || v.(*Klass).Loader == name
+		}
+		return true
+	})
+	if defined {
+		MethAreaMutex.Unlock()
+		return fmt.Errorf("RemoveClassloader: classloader %s has defined classes", name)
+	}
+	for _, key := range initiated {
+		MethArea.Delete(key)
+	}
+	MethAreaMutex.Unlock()
+
+	loadersMutex.Lock()
+	delete(loaders, name)
+	loadersMutex.Unlock()
+
+	loaderConstraintsMutex.Lock()
+	for _, sets := range loaderConstraints {
+		for _, set := range sets {
+			delete(set, name)
+		}
+	}
+	loaderConstraintsMutex.Unlock()
+	return nil
+}
+
+// FindLoadedClass returns the class named className (in java/lang/String format) if the
+// classloader has loaded it (that is, it's an initiating loader of the class), else nil
+func (cl *Classloader) FindLoadedClass(className string) *Klass {
+	if k := methAreaFetchInitiated(cl.Name, className); k != nil && k.Status != 'I' {
+		return k
+	}
+	return nil
+}
+
+// RecordLoadedClass records that the classloader has loaded klass, whose name is
+// className, as when the loadClass() method of a user-defined loader returns it. It
+// returns an error if that would violate a loader constraint.
+func (cl *Classloader) RecordLoadedClass(className string, klass *Klass) error {
+	return recordInitiatingLoader(cl.Name, className, klass)
+}
+
+// DefineClass creates a class from the bytes of its class file, with the classloader
+// as its defining loader, and adds it to the method area. className, if not empty, is
+// the name (in java/lang/String format) that the class is expected to have. The class
+// is parsed and format-checked as any other is; if it can't be defined, the error
+// returned is a ClassDefError.
+func DefineClass(cl *Classloader, className string, rawBytes []byte) (*Klass, error) {
+	filename := className
+	if filename == "" {
+		filename = "<unnamed class>"
+	}
+	_ = log.Log("DefineClass: "+filename+" to be defined by loader "+cl.Name, log.CLASS)
+
+	parsedClass, err := parseAndFormatCheck(filename, rawBytes)
+	if err != nil {
+		return nil, &ClassDefError{Exception: "java/lang/ClassFormatError",
+			Msg: fmt.Sprintf("%s (%s)", strings.ReplaceAll(filename, "/", "."), err.Error())}
+	}
+
+	definedName := parsedClass.className
+	if className != "" && className != definedName {
+		wrongName := &WrongNameError{Name: className, DefinedName: definedName}
+		return nil, &ClassDefError{Exception: "java/lang/NoClassDefFoundError", Msg: wrongName.Error()}
+	}
+
+	// only the bootstrap and platform loaders can define the classes of the java packages
+	if !IsBuiltinLoader(cl.Name) && strings.HasPrefix(definedName, "java/") {
+		pkg := definedName[:strings.LastIndex(definedName, "/")]
+		return nil, &ClassDefError{Exception: "java/lang/SecurityException",
+			Msg: "Prohibited package name: " + strings.ReplaceAll(pkg, "/", ".")}
+	}
+
+	classToPost := convertToPostableClass(parsedClass)
+	klass := &Klass{
+		Status: 'F', // F = format-checked
+		Loader: cl.Name,
+		Data:   &classToPost,
+	}
+
+	defineMutex.Lock()
+	defer defineMutex.Unlock()
+
+	if methAreaFetchInitiated(cl.Name, definedName) != nil {
+		return nil, &ClassDefError{Exception: "java/lang/LinkageError",
+			Msg: fmt.Sprintf("loader %s attempted duplicate class definition for %s.",
+				cl.Name, strings.ReplaceAll(definedName, "/", "."))}
+	}
+	if err = checkLoaderConstraints(cl.Name, definedName, klass); err != nil {
+		return nil, &ClassDefError{Exception: "java/lang/LinkageError", Msg: err.Error()}
+	}
+	MethAreaInsert(definedName, klass)
+
+	ClassesLock.Lock()
+	cl.ClassCount += 1
+	ClassesLock.Unlock()
+	_ = log.Log("DefineClass: "+definedName+" defined by loader "+cl.Name, log.CLASS)
+	return klass, nil
+}
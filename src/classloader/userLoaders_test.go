@@ -0,0 +1,113 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package classloader
+
+import (
+	"testing"
+)
+
+// helloWorldBytes returns the class file of jacobin/HelloWorld, from the test JAR file
+func helloWorldBytes(t *testing.T) []byte {
+	jarName, _ := getJarFileName(GOOD_JAR_NAME)
+	jar, err := getJarFile(AppCL, jarName)
+	if err != nil {
+		t.Fatalf("Error opening %s: %s", jarName, err.Error())
+	}
+	result, err := jar.loadClass("jacobin.HelloWorld")
+	if err != nil || !result.Success {
+		t.Fatalf("Error reading jacobin/HelloWorld from %s: %v", jarName, err)
+	}
+	return *result.Data
+}
+
+func TestDefineClassWithUserDefinedLoader(t *testing.T) {
+	setUpLoaderTest(t)
+	classBytes := helloWorldBytes(t)
+
+	cl, err := NewClassloader("test.Loader @1", AppCL.Name)
+	if err != nil {
+		t.Fatalf("Unexpected error creating a classloader: %s", err.Error())
+	}
+	if _, err = NewClassloader("test.Loader @1", AppCL.Name); err == nil {
+		t.Errorf("Expected an error creating a second classloader of the same name")
+	}
+
+	k, err := DefineClass(cl, "jacobin/HelloWorld", classBytes)
+	if err != nil {
+		t.Fatalf("Unexpected error defining jacobin/HelloWorld: %s", err.Error())
+	}
+	if k.Loader != cl.Name || cl.FindLoadedClass("jacobin/HelloWorld") != k {
+		t.Errorf("Expected jacobin/HelloWorld to be defined by %s, got loader: %s", cl.Name, k.Loader)
+	}
+	if MethAreaFetchFromLoader(AppCL.Name, "jacobin/HelloWorld") != nil {
+		t.Errorf("Expected the app loader not to see the class defined by %s", cl.Name)
+	}
+
+	// the same loader can't define the class twice, but another loader can define its own
+	_, err = DefineClass(cl, "", classBytes)
+	if defErr, ok := err.(*ClassDefError); !ok || defErr.Exception != "java/lang/LinkageError" {
+		t.Errorf("Expected a LinkageError for a duplicate class definition, got: %v", err)
+	}
+	other, _ := NewClassloader("test.Loader @2", AppCL.Name)
+	if k2, err := DefineClass(other, "", classBytes); err != nil || k2 == k {
+		t.Errorf("Expected %s to define its own jacobin/HelloWorld, got: %v (error: %v)", other.Name, k2, err)
+	}
+}
+
+func TestDefineClassErrors(t *testing.T) {
+	setUpLoaderTest(t)
+	cl, _ := NewClassloader("test.Loader @3", "")
+	if cl.GetParent() != &BootstrapCL {
+		t.Errorf("Expected a loader with no parent to delegate to the bootstrap loader")
+	}
+
+	tests := []struct {
+		className string
+		bytes     []byte
+		exception string
+	}{
+		{"jacobin/GoodbyeWorld", helloWorldBytes(t), "java/lang/NoClassDefFoundError"},
+		{"jacobin/HelloWorld", []byte{0xCA, 0xFE, 0xBA, 0xBE, 0x00}, "java/lang/ClassFormatError"},
+	}
+	for _, test := range tests {
+		_, err := DefineClass(cl, test.className, test.bytes)
+		if defErr, ok := err.(*ClassDefError); !ok || defErr.Exception != test.exception {
+			t.Errorf("Expected %s defining %s, got: %v", test.exception, test.className, err)
+		}
+	}
+	if cl.FindLoadedClass("jacobin/HelloWorld") != nil {
+		t.Errorf("Expected no class to be defined after the errors")
+	}
+}
+
+func TestRemoveClassloader(t *testing.T) {
+	setUpLoaderTest(t)
+	classBytes := helloWorldBytes(t)
+
+	cl, _ := NewClassloader("test.Loader @4", AppCL.Name)
+	MethAreaInsert("test/Foo", &Klass{Status: 'F', Loader: AppCL.Name, Data: &ClData{Name: "test/Foo"}})
+	if err := cl.RecordLoadedClass("test/Foo", MethAreaFetch("test/Foo")); err != nil {
+		t.Fatalf("Unexpected error recording test/Foo: %s", err.Error())
+	}
+	if err := RemoveClassloader(cl.Name); err != nil {
+		t.Fatalf("Unexpected error removing %s: %s", cl.Name, err.Error())
+	}
+	if LoaderNamed(cl.Name) != nil || methAreaFetchInitiated(cl.Name, "test/Foo") != nil {
+		t.Errorf("Expected %s and the classes it loaded to be forgotten", cl.Name)
+	}
+
+	// neither a built-in loader nor one that has defined a class can be removed
+	definer, _ := NewClassloader("test.Loader @5", AppCL.Name)
+	if _, err := DefineClass(definer, "", classBytes); err != nil {
+		t.Fatalf("Unexpected error defining jacobin/HelloWorld: %s", err.Error())
+	}
+	for _, name := range []string{AppCL.Name, definer.Name} {
+		if err := RemoveClassloader(name); err == nil || LoaderNamed(name) == nil {
+			t.Errorf("Expected an error removing %s", name)
+		}
+	}
+}
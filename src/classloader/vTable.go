@@ -0,0 +1,100 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package classloader
+
+import (
+	"sync"
+)
+
+// VTables holds the virtual method tables (vtables) of classes. When INVOKEVIRTUAL calls
+// a method on an object, the method that's executed is the one declared in the object's
+// class or, if the class doesn't override it, in the nearest superclass that does. A
+// class's vtable maps the name and type of every instance method the class declares or
+// inherits (e.g., toString()Ljava/lang/String;) to the class whose version of the method
+// objects of the class execute.
+//
+// A vtable is built the first time it's needed--that is, when the class is linked for
+// dispatch--by copying the vtable of the superclass and then adding or overriding the
+// entries for the methods declared in the class itself. The key to VTables is the class,
+// as several loaders can define classes of the same name. The superclass of a class is
+// the class of that name as the class's defining loader sees it.
+var VTables = make(map[*Klass]map[string]VTentry)
+
+// VTentry is the version of a method that's executed for objects of a given class.
+// ClName is the name of the class that declares that version, and Klass the class
+// itself. IsAbstract is true if that version is abstract, in which case calling it
+// is an error.
+type VTentry struct {
+	ClName     string
+	Klass      *Klass
+	IsAbstract bool
+}
+
+// VTmutex protects VTables, as multiple threads could be updating it simultaneously.
+var VTmutex sync.RWMutex
+
+// VTableFetch returns the vtable entry for the method methName+methType in the class
+// k, building the class's vtable if it doesn't yet exist. The bool is false if the
+// method is not in the vtable, or if the class is nil.
+func VTableFetch(k *Klass, methName, methType string) (VTentry, bool) {
+	VTmutex.RLock()
+	vtable, ok := VTables[k]
+	VTmutex.RUnlock()
+
+	if !ok {
+		vtable = buildVTable(k)
+		if vtable == nil {
+			return VTentry{}, false
+		}
+	}
+
+	entry, ok := vtable[methName+methType]
+	return entry, ok
+}
+
+// buildVTable creates the vtable for the class k, building the vtables of its
+// superclasses first, loading them as needed. Returns nil if the class is nil.
+func buildVTable(k *Klass) map[string]VTentry {
+	if k == nil || k.Data == nil {
+		return nil
+	}
+
+	vtable := make(map[string]VTentry)
+	if superclass := k.Data.Superclass; superclass != "" {
+		if MethAreaFetchFor(k.Loader, superclass) == nil && !IsUserLoader(k.Loader) {
+			_ = LoadClassFromNameOnly(superclass)
+		}
+		super := MethAreaFetchFor(k.Loader, superclass)
+
+		VTmutex.RLock()
+		superVtable, ok := VTables[super]
+		VTmutex.RUnlock()
+		if !ok {
+			superVtable = buildVTable(super)
+		}
+		for methSig, entry := range superVtable {
+			vtable[methSig] = entry
+		}
+	}
+
+	for methSig, m := range k.Data.MethodTable {
+		// static and private methods, and constructors, are not dispatched virtually
+		if m.AccessFlags&0x000A != 0 || methSig[0] == '<' { // 0x0008 = static, 0x0002 = private
+			continue
+		}
+		vtable[methSig] = VTentry{
+			ClName:     k.Data.Name,
+			Klass:      k,
+			IsAbstract: m.AccessFlags&0x0400 != 0, // 0x0400 = abstract
+		}
+	}
+
+	VTmutex.Lock()
+	VTables[k] = vtable
+	VTmutex.Unlock()
+	return vtable
+}
@@ -47,6 +47,7 @@ const (
 	IllegalMonitorStateException
 	IllegalPathStateException
 	IllegalStateException
+	IllegalThreadStateException
 	IllformedLocaleException
 	ImagingOpException
 	InaccessibleObjectException
@@ -185,11 +186,13 @@ const (
 	XMLStreamException
 
 	// Java exceptions
+	AbstractMethodError
 	AnnotationFormatError
 	AssertionError
 	AWTError
 	CoderMalfunctionError
 	FactoryConfigurationError
+	IncompatibleClassChangeError
 	IOError
 	LinkageError
 	SchemaFactoryConfigurationError
@@ -9,6 +9,7 @@ package frames
 import (
 	"container/list"
 	"fmt"
+	"jacobin/globals"
 	"jacobin/log"
 	"unsafe"
 )
@@ -23,24 +24,46 @@ type Number interface {
 }
 
 // Frame is the fundamental execution environment for a single function/method call.
-// Note that the operand stack (opStack) is made up of int64 items, rather than the JVM-
+// Note that the operand stack (opStack) is made up of 64-bit items, rather than the JVM-
 // prescribed 32-bit entries. The rationale is that longs and doubles can be stored
 // without manipulation at this width. (However, there will still be need for the dummy
-// second stack entry for these data items.
+// second stack entry for these data items.)
+//
+// The operand stack and the local variables each consist of two parallel arrays of
+// slots, so that primitive values are not boxed into interfaces. Primitives (which
+// are all held as int64 or float64 values) are stored in OpPrims and LocalPrims: an
+// int64 as is, a float64 as its IEEE 754 bits. The corresponding slot of OpStack or
+// Locals then holds PrimInt or PrimFloat to show which of the two it is. All other
+// values (references, return addresses, etc.) are stored in OpStack and Locals. As
+// the JVMS requires, longs and doubles occupy two slots, both of which hold the value.
 type Frame struct {
-	Thread   int
-	MethName string // method name
-	ClName   string // class name
-	Meth     []byte // bytecode of method
-	// ExceptionTable *[]classloader.CodeException // list of code exceptions
-	CP      interface{}   // will hold a *classloader.CPool (constant pool ptr) but due to circularity must be done this way
-	Locals  []interface{} // local variables
-	OpStack []interface{} // operand stack
-	TOS     int           // top of the operand stack
-	PC      int           // program counter (index into the bytecode of the method)
-	Ftype   byte          // type of method in frame: 'J' = java, 'G' = Golang, 'N' = native
+	Thread     int
+	MethName   string        // method name
+	MethType   string        // method type (signature), used with the class and method names to look up the method
+	ClName     string        // class name
+	Loader     string        // the name of the defining loader of the class
+	Meth       []byte        // bytecode of method
+	CP         interface{}   // will hold a *classloader.CPool (constant pool ptr) but due to circularity must be done this way
+	Code       interface{}   // the translated bytecode (a *jvm.quickCode), set when first needed. See jvm/quicken.go
+	Locals     []interface{} // local variables
+	LocalPrims []int64       // the values of local variables that hold primitives
+	OpStack    []interface{} // operand stack
+	OpPrims    []int64       // the values of operand stack entries that are primitives
+	TOS        int           // top of the operand stack
+	PC         int           // program counter (index into the bytecode of the method)
+	Ftype      byte          // type of method in frame: 'J' = java, 'G' = Golang, 'N' = native
+	Monitor    interface{}   // for a synchronized method, the object (or class) whose monitor it holds
 }
 
+// PrimSlot is the value of a slot in OpStack or Locals whose value is held in the
+// corresponding slot of OpPrims or LocalPrims. It tells how to interpret that value.
+type PrimSlot byte
+
+const (
+	PrimInt   PrimSlot = 'I' // the value is an int64 (a boolean, byte, char, short, int, or long)
+	PrimFloat PrimSlot = 'F' // the value is the bits of a float64 (a float or double)
+)
+
 // CreateFrameStack creates a stack of frames. Implemented as a list in which
 // the current running frame is always the frame at the head
 func CreateFrameStack() *list.List {
@@ -58,9 +81,8 @@ func CreateFrame(opStackSize int) *Frame {
 	}
 
 	// allocate the operand stack
-	for j := 0; j < opStackSize; j++ {
-		fram.OpStack = append(fram.OpStack, 0)
-	}
+	fram.OpStack = make([]interface{}, opStackSize)
+	fram.OpPrims = make([]int64, opStackSize)
 
 	// set top of stack to an empty stack
 	fram.TOS = -1
@@ -68,8 +90,14 @@ func CreateFrame(opStackSize int) *Frame {
 	return &fram
 }
 
-// PushFrame pushes a frame. This simply adds a frame to the head of the list.
+// PushFrame pushes a frame. This simply adds a frame to the head of the list, unless
+// the list already holds the maximum number of frames, in which case an error is returned.
 func PushFrame(fs *list.List, f *Frame) error {
+	maxFrames := globals.GetGlobalRef().MaxFrames
+	if maxFrames > 0 && fs.Len() >= maxFrames {
+		return fmt.Errorf("stack overflow: frame stack is at its limit of %d frames", maxFrames)
+	}
+
 	fs.PushFront(f)
 	// TODO: move this to instrumentation system
 	if log.Level == log.FINEST {
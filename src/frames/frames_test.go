@@ -6,7 +6,11 @@
 
 package frames
 
-import "testing"
+import (
+	"container/list"
+	"jacobin/globals"
+	"testing"
+)
 
 func TestNewFrame(t *testing.T) {
 	f := CreateFrame(6)
@@ -52,3 +56,21 @@ func TestFramePeek(t *testing.T) {
 		t.Errorf("Peeked at prior frame. Expected size of opstack to be 1, got: %d", len(peek.OpStack))
 	}
 }
+
+// the limit on the number of frames applies to the frame stack of each thread
+func TestPushFrameLimitIsPerStack(t *testing.T) {
+	globals.InitGlobals("test")
+	globals.GetGlobalRef().MaxFrames = 2
+
+	first, second := CreateFrameStack(), CreateFrameStack()
+	for _, fs := range []*list.List{first, second} {
+		for i := 0; i < 2; i++ {
+			if err := PushFrame(fs, CreateFrame(1)); err != nil {
+				t.Fatalf("Expected each stack to hold 2 frames, got: %s", err.Error())
+			}
+		}
+	}
+	if PushFrame(first, CreateFrame(1)) == nil {
+		t.Error("Expected a third frame on a stack to exceed the limit")
+	}
+}
@@ -40,6 +40,7 @@ type Globals struct {
 	StartingJar   string
 	AppArgs       []string
 	Options       map[string]Option
+	Classpath     []string // the directories and JAR files searched for app classes, in order
 
 	// ---- classloading items ----
 	MaxJavaVersion    int // the Java version as commonly known, i.e. Java 11
@@ -59,6 +60,7 @@ type Globals struct {
 	Threads    map[int]interface{} // in reality the interface is a threads.ExecThread, but
 	// due to circularity has to be described this way here.
 	ThreadNumber int
+	MaxFrames    int // the maximum number of frames on a thread's frame stack (0 = no limit)
 
 	// ---- execution context ----
 	JacobinBuildData map[string]string
@@ -83,6 +85,16 @@ type Globals struct {
 	FileEncoding string // what file encoding are we using?
 }
 
+// The size of a thread's stack can be set with -Xss. Jacobin's frames are not allocated
+// on a stack of fixed size, so the stack size is converted into a limit on the depth of
+// the thread's frame stack (that is, on the depth of nested method calls), allowing
+// StackBytesPerFrame bytes per frame. The default stack size is the JDK's: 1MB.
+const (
+	DefaultStackSize   = 1024 * 1024
+	StackBytesPerFrame = 100
+	DefaultMaxFrames   = DefaultStackSize / StackBytesPerFrame
+)
+
 // LoaderWg is a wait group for various channels used for parallel loading of classes.
 var LoaderWg sync.WaitGroup
 
@@ -105,6 +117,7 @@ func InitGlobals(progName string) Globals {
 		MaxJavaVersionRaw: 61, // this value and MaxJavaVersion must *always* be in sync
 		// Threads:            ThreadList{list.New(), sync.Mutex{}},
 		ThreadNumber:       0, // first thread will be numbered 1, as increment occurs prior
+		MaxFrames:          DefaultMaxFrames,
 		JacobinBuildData:   nil,
 		StrictJDK:          false,
 		ArrayAddressList:   InitArrayAddressList(),
@@ -0,0 +1,947 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"jacobin/classloader"
+	"jacobin/frames"
+	"jacobin/globals"
+	"jacobin/log"
+	"jacobin/object"
+	"jacobin/types"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// An app creates classloaders of its own by subclassing java.lang.ClassLoader or by using
+// a URLClassLoader, and defines classes with them by passing the bytes of class files to
+// ClassLoader.defineClass(). The methods of ClassLoader (including its natives) and of
+// URLClassLoader are implemented here in golang; they're placed in the MTable by
+// loadClassLoaderMethods(), so they take the place of the JDK's implementation.
+//
+// Each ClassLoader object is represented by a classloader.Classloader, which is the
+// defining loader of the classes the object defines (see classloader/userLoaders.go).
+// Its state is kept here, in a javaLoader, rather than in the object's fields. The
+// built-in app and platform loaders are represented by objects too, which are created
+// the first time they're asked for; the bootstrap loader, as in the JDK, is null.
+//
+// The state of a ClassLoader object doesn't keep the object alive: it's keyed by the
+// object's address, and released, along with the loader, when the object is garbage
+// collected. The classes a loader defines, however, stay in the method area for the
+// life of the VM and refer to the loader, so once it has defined a class, the loader
+// and its object stay too.
+//
+// loadClass() works as it does in the JDK: it returns the class if the loader has
+// already loaded it, or else asks the parent loader to load it and, if the parent
+// can't, calls findClass(), which subclasses override to find and define the class.
+// The classes that the code of a class refers to are loaded with the class's defining
+// loader (see loadReferencedClass()), so the classes that a user-defined loader defines
+// can refer to others that only it can find.
+//
+// Each class has a java.lang.Class object, created when it's first asked for, whose
+// getClassLoader() returns the object of the class's defining loader. A URLClassLoader
+// finds classes in the directories and JAR files named by its file: URLs; other kinds
+// of URL are not supported.
+
+const (
+	classLoaderClass       = "java/lang/ClassLoader"
+	appLoaderClass         = "jdk/internal/loader/ClassLoaders$AppClassLoader"
+	platformLoaderClass    = "jdk/internal/loader/ClassLoaders$PlatformClassLoader"
+	classNotFoundException = "java/lang/ClassNotFoundException"
+	loadClassType          = "(Ljava/lang/String;)Ljava/lang/Class;"
+	findClassType          = "(Ljava/lang/String;)Ljava/lang/Class;"
+	nullPointerException   = "java/lang/NullPointerException"
+	noClassDefFoundError   = "java/lang/NoClassDefFoundError"
+)
+
+// javaLoader is the state of a java.lang.ClassLoader object
+type javaLoader struct {
+	cl     *classloader.Classloader // the loader that the object represents
+	parent *object.Object           // the object of the parent loader, nil for the bootstrap loader
+	name   string                   // the name given to the constructor, if any
+	urls   []*object.Object         // for a URLClassLoader, its URLs
+	paths  []string                 // for a URLClassLoader, the directories and JAR files its file: URLs name
+}
+
+// objectKey identifies an object by its address, without keeping it alive, so that the
+// state kept here for the object can be released by a finalizer when it's collected
+type objectKey uintptr
+
+func keyOf(obj *object.Object) objectKey {
+	return objectKey(uintptr(unsafe.Pointer(obj)))
+}
+
+// javaLoaders holds the state of every live ClassLoader object, and urlSpecs the string
+// form of every live URL object. loaderObjects holds the objects of the loaders that the
+// classes in the method area refer to, by the loader's name: those of the built-in
+// loaders and of the user-defined loaders that have defined classes. javaLoadersMutex
+// guards all three, as well as the fields of the javaLoaders and the Class field of the
+// classes.
+var javaLoaders = make(map[objectKey]*javaLoader)
+var urlSpecs = make(map[objectKey]string)
+var loaderObjects = make(map[string]*object.Object)
+var javaLoadersMutex sync.Mutex
+
+// loaderCount numbers the user-defined loaders, so that each has a name of its own
+var loaderCount atomic.Uint64
+
+// loadClassLoaderMethods places the golang implementations of the methods of
+// java.lang.ClassLoader and java.net.URLClassLoader in the MTable, along with those of
+// java.lang.Class and java.net.URL that they use. Their static initializers do nothing,
+// as the state they set up is kept here instead.
+func loadClassLoaderMethods() {
+	postSyntheticClass(appLoaderClass, classLoaderClass)
+	postSyntheticClass(platformLoaderClass, classLoaderClass)
+
+	classLoaderMethods := map[string]classloader.GMeth{
+		"<clinit>()V":                      {ParamSlots: 0, GFunction: staticInitNoOp},
+		"<init>()V":                        {ParamSlots: 0, ObjectRef: true, GFunction: classLoaderInit},
+		"<init>(Ljava/lang/ClassLoader;)V": {ParamSlots: 1, ObjectRef: true, GFunction: classLoaderInit},
+		"<init>(Ljava/lang/String;Ljava/lang/ClassLoader;)V":      {ParamSlots: 2, ObjectRef: true, GFunction: classLoaderInit},
+		"loadClass" + loadClassType:                               {ParamSlots: 1, ObjectRef: true, NeedsContext: true, GFunction: classLoaderLoadClass},
+		"loadClass(Ljava/lang/String;Z)Ljava/lang/Class;":         {ParamSlots: 2, ObjectRef: true, NeedsContext: true, GFunction: classLoaderLoadClass},
+		"findClass" + findClassType:                               {ParamSlots: 1, ObjectRef: true, GFunction: classLoaderFindClass},
+		"findLoadedClass(Ljava/lang/String;)Ljava/lang/Class;":    {ParamSlots: 1, ObjectRef: true, GFunction: classLoaderFindLoadedClass},
+		"findLoadedClass0(Ljava/lang/String;)Ljava/lang/Class;":   {ParamSlots: 1, ObjectRef: true, GFunction: classLoaderFindLoadedClass},
+		"findBootstrapClass(Ljava/lang/String;)Ljava/lang/Class;": {ParamSlots: 1, GFunction: classLoaderFindBootstrapClass},
+		"findSystemClass(Ljava/lang/String;)Ljava/lang/Class;":    {ParamSlots: 1, ObjectRef: true, GFunction: classLoaderFindSystemClass},
+		"defineClass([BII)Ljava/lang/Class;":                      {ParamSlots: 3, ObjectRef: true, GFunction: classLoaderDefineClass},
+		"defineClass(Ljava/lang/String;[BII)Ljava/lang/Class;":    {ParamSlots: 4, ObjectRef: true, GFunction: classLoaderDefineClass},
+		"defineClass(Ljava/lang/String;[BIILjava/security/ProtectionDomain;)Ljava/lang/Class;": {
+			ParamSlots: 5, ObjectRef: true, GFunction: classLoaderDefineClass},
+		"defineClass0(Ljava/lang/ClassLoader;Ljava/lang/Class;Ljava/lang/String;[BIILjava/security/ProtectionDomain;ZILjava/lang/Object;)Ljava/lang/Class;": {
+			ParamSlots: 10, GFunction: classLoaderDefineClass0},
+		"defineClass1(Ljava/lang/ClassLoader;Ljava/lang/String;[BIILjava/security/ProtectionDomain;Ljava/lang/String;)Ljava/lang/Class;": {
+			ParamSlots: 7, GFunction: classLoaderDefineClass1},
+		"resolveClass(Ljava/lang/Class;)V":                          {ParamSlots: 1, ObjectRef: true, GFunction: classLoaderResolveClass},
+		"getParent()Ljava/lang/ClassLoader;":                        {ParamSlots: 0, ObjectRef: true, GFunction: classLoaderGetParent},
+		"getName()Ljava/lang/String;":                               {ParamSlots: 0, ObjectRef: true, GFunction: classLoaderGetName},
+		"getClassLoadingLock(Ljava/lang/String;)Ljava/lang/Object;": {ParamSlots: 1, ObjectRef: true, GFunction: classLoaderGetClassLoadingLock},
+		"getSystemClassLoader()Ljava/lang/ClassLoader;":             {ParamSlots: 0, GFunction: classLoaderGetSystemClassLoader},
+		"getPlatformClassLoader()Ljava/lang/ClassLoader;":           {ParamSlots: 0, GFunction: classLoaderGetPlatformClassLoader},
+		"registerAsParallelCapable()Z":                              {ParamSlots: 0, GFunction: classLoaderRegisterAsParallelCapable},
+	}
+	urlClassLoaderMethods := map[string]classloader.GMeth{
+		"<clinit>()V":              {ParamSlots: 0, GFunction: staticInitNoOp},
+		"<init>([Ljava/net/URL;)V": {ParamSlots: 1, ObjectRef: true, GFunction: urlClassLoaderInit},
+		"<init>([Ljava/net/URL;Ljava/lang/ClassLoader;)V":                   {ParamSlots: 2, ObjectRef: true, GFunction: urlClassLoaderInit},
+		"<init>(Ljava/lang/String;[Ljava/net/URL;Ljava/lang/ClassLoader;)V": {ParamSlots: 3, ObjectRef: true, GFunction: urlClassLoaderInit},
+		"newInstance([Ljava/net/URL;)Ljava/net/URLClassLoader;":             {ParamSlots: 1, NeedsContext: true, GFunction: urlClassLoaderNewInstance},
+		"newInstance([Ljava/net/URL;Ljava/lang/ClassLoader;)Ljava/net/URLClassLoader;": {
+			ParamSlots: 2, NeedsContext: true, GFunction: urlClassLoaderNewInstance},
+		"findClass" + findClassType: {ParamSlots: 1, ObjectRef: true, GFunction: urlClassLoaderFindClass},
+		"addURL(Ljava/net/URL;)V":   {ParamSlots: 1, ObjectRef: true, GFunction: urlClassLoaderAddURL},
+		"getURLs()[Ljava/net/URL;":  {ParamSlots: 0, ObjectRef: true, GFunction: urlClassLoaderGetURLs},
+		"close()V":                  {ParamSlots: 0, ObjectRef: true, GFunction: urlClassLoaderClose},
+	}
+	urlMethods := map[string]classloader.GMeth{
+		"<clinit>()V":                        {ParamSlots: 0, GFunction: staticInitNoOp},
+		"<init>(Ljava/lang/String;)V":        {ParamSlots: 1, ObjectRef: true, GFunction: urlInit},
+		"toString()Ljava/lang/String;":       {ParamSlots: 0, ObjectRef: true, GFunction: urlToString},
+		"toExternalForm()Ljava/lang/String;": {ParamSlots: 0, ObjectRef: true, GFunction: urlToString},
+		"getProtocol()Ljava/lang/String;":    {ParamSlots: 0, ObjectRef: true, GFunction: urlGetProtocol},
+		"getPath()Ljava/lang/String;":        {ParamSlots: 0, ObjectRef: true, GFunction: urlGetPath},
+	}
+	classMethods := map[string]classloader.GMeth{
+		"getName()Ljava/lang/String;":             {ParamSlots: 0, ObjectRef: true, GFunction: classGetName},
+		"getClassLoader()Ljava/lang/ClassLoader;": {ParamSlots: 0, ObjectRef: true, GFunction: classGetClassLoader},
+		"newInstance()Ljava/lang/Object;":         {ParamSlots: 0, ObjectRef: true, NeedsContext: true, GFunction: classNewInstance},
+	}
+
+	classloader.MTmutex.Lock()
+	for sig, gmeth := range classLoaderMethods {
+		classloader.MTable["java/lang/ClassLoader."+sig] = classloader.MTentry{MType: 'G', Meth: gmeth}
+	}
+	for sig, gmeth := range urlClassLoaderMethods {
+		classloader.MTable["java/net/URLClassLoader."+sig] = classloader.MTentry{MType: 'G', Meth: gmeth}
+	}
+	for sig, gmeth := range urlMethods {
+		classloader.MTable["java/net/URL."+sig] = classloader.MTentry{MType: 'G', Meth: gmeth}
+	}
+	for sig, gmeth := range classMethods {
+		classloader.MTable["java/lang/Class."+sig] = classloader.MTentry{MType: 'G', Meth: gmeth}
+	}
+	classloader.MTable["java/lang/Object.getClass()Ljava/lang/Class;"] = classloader.MTentry{MType: 'G',
+		Meth: classloader.GMeth{ParamSlots: 0, ObjectRef: true, GFunction: objectGetClass}}
+	classloader.MTable["java/security/SecureClassLoader.<clinit>()V"] = classloader.MTentry{MType: 'G',
+		Meth: classloader.GMeth{ParamSlots: 0, GFunction: staticInitNoOp}}
+	classloader.MTmutex.Unlock()
+}
+
+// staticInitNoOp is the static initializer of the classes whose state is kept here
+func staticInitNoOp(params []interface{}) interface{} {
+	return nil
+}
+
+// getJavaLoader returns the state of the ClassLoader object obj, or nil if it has none,
+// which is the case if its constructor has not run
+func getJavaLoader(obj *object.Object) *javaLoader {
+	javaLoadersMutex.Lock()
+	defer javaLoadersMutex.Unlock()
+	return javaLoaders[keyOf(obj)]
+}
+
+// uninitializedLoader returns the error for a ClassLoader object obj that has no state
+func uninitializedLoader(obj *object.Object) error {
+	glob := globals.GetGlobalRef()
+	glob.ErrorGoStack = string(debug.Stack())
+	errMsg := fmt.Sprintf("ClassLoader: the constructor of %s has not been run", *obj.Klass)
+	_ = log.Log(errMsg, log.SEVERE)
+	return errors.New(errMsg)
+}
+
+// loaderObject returns the ClassLoader object of the loader named name, or nil for the
+// bootstrap loader. The objects of the app and platform loaders are created the first
+// time they're asked for; that of a user-defined loader is found only once the loader
+// has defined a class (see keepLoader()). Must be called with javaLoadersMutex held.
+func loaderObject(name string) *object.Object {
+	cl := classloader.LoaderNamed(name)
+	if cl == nil || cl.Name == classloader.BootstrapCL.Name {
+		return nil
+	}
+	if obj := loaderObjects[cl.Name]; obj != nil || !classloader.IsBuiltinLoader(cl.Name) {
+		return obj
+	}
+
+	className := appLoaderClass
+	if cl.Name == classloader.PlatformCL.Name {
+		className = platformLoaderClass
+	}
+	obj := newSyntheticObject(className, nil)
+	javaLoaders[keyOf(obj)] = &javaLoader{cl: cl, parent: loaderObject(cl.Parent), name: cl.Name}
+	loaderObjects[cl.Name] = obj
+	return obj
+}
+
+// systemClassLoader returns the object of the app loader, which is the default parent
+// of the loaders that an app creates
+func systemClassLoader() *object.Object {
+	javaLoadersMutex.Lock()
+	defer javaLoadersMutex.Unlock()
+	return loaderObject(classloader.AppCL.Name)
+}
+
+// newUserLoader makes the ClassLoader object obj a user-defined loader whose name is
+// name (which can be empty) and whose parent is the loader whose object is parent.
+// As in the JDK, the loader's name is the object's name or class, and a number that
+// identifies the loader.
+func newUserLoader(obj *object.Object, name string, parent *object.Object) interface{} {
+	javaLoadersMutex.Lock()
+	defer javaLoadersMutex.Unlock()
+
+	parentName := classloader.BootstrapCL.Name
+	if object.IsNull(parent) {
+		parent = nil
+	} else {
+		jl := javaLoaders[keyOf(parent)]
+		if jl == nil {
+			return uninitializedLoader(parent)
+		}
+		parentName = jl.cl.Name
+	}
+
+	id := loaderCount.Add(1)
+	loaderName := fmt.Sprintf("%s @%x", strings.ReplaceAll(*obj.Klass, "/", "."), id)
+	if name != "" {
+		loaderName = fmt.Sprintf("'%s' @%x", name, id)
+	}
+	cl, err := classloader.NewClassloader(loaderName, parentName)
+	if err != nil {
+		return err
+	}
+	if javaLoaders[keyOf(obj)] == nil {
+		runtime.SetFinalizer(obj, releaseUserLoader)
+	}
+	javaLoaders[keyOf(obj)] = &javaLoader{cl: cl, parent: parent, name: name}
+	return nil
+}
+
+// releaseUserLoader is the finalizer of the object of a user-defined loader, which
+// releases its state and removes the loader
+func releaseUserLoader(obj *object.Object) {
+	javaLoadersMutex.Lock()
+	jl := javaLoaders[keyOf(obj)]
+	delete(javaLoaders, keyOf(obj))
+	javaLoadersMutex.Unlock()
+
+	if jl != nil {
+		if err := classloader.RemoveClassloader(jl.cl.Name); err != nil {
+			_ = log.Log(err.Error(), log.WARNING)
+		}
+	}
+}
+
+// keepLoader records obj, whose state is jl, as the object of its loader, which has
+// defined a class, so that the loader can be found from the class
+func keepLoader(obj *object.Object, jl *javaLoader) {
+	javaLoadersMutex.Lock()
+	loaderObjects[jl.cl.Name] = obj
+	javaLoadersMutex.Unlock()
+}
+
+// javaStringParam returns the Go string of a String parameter, and false if it's null
+func javaStringParam(param interface{}) (string, bool) {
+	str, ok := param.(*object.Object)
+	if !ok || object.IsNull(str) {
+		return "", false
+	}
+	s, _ := objectToString(str, nil)
+	return s, true
+}
+
+// classKlass returns the class of a Class object, or nil if c is not one. (Some golang
+// methods, such as Class.getPrimitiveClass(), return the class itself, which is
+// accepted too.)
+func classKlass(c interface{}) *classloader.Klass {
+	switch c := c.(type) {
+	case *classloader.Klass:
+		return c
+	case *object.Object:
+		if !object.IsNull(c) && *c.Klass == "java/lang/Class" && len(c.Fields) > 0 {
+			k, _ := c.Fields[0].Fvalue.(*classloader.Klass)
+			return k
+		}
+	}
+	return nil
+}
+
+// classObject returns the Class object of the class k, which is created the first time
+// it's asked for, so that each class has only one
+func classObject(k *classloader.Klass) *object.Object {
+	javaLoadersMutex.Lock()
+	defer javaLoadersMutex.Unlock()
+
+	if k.Class == nil {
+		k.Class = newSyntheticObject("java/lang/Class", k)
+	}
+	return k.Class
+}
+
+// loadClassWith loads the class named className (in java/lang/String format) with the
+// loader whose ClassLoader object is loader, or with the bootstrap loader if loader is
+// null. It returns nil if the loader can't find the class.
+func loadClassWith(fs *list.List, loader *object.Object, className string) (*classloader.Klass, error) {
+	cl := classloader.LoaderNamed(classloader.BootstrapCL.Name)
+	if !object.IsNull(loader) {
+		jl := getJavaLoader(loader)
+		if jl == nil {
+			return nil, uninitializedLoader(loader)
+		}
+		cl = jl.cl
+	}
+
+	// the built-in loaders are asked directly, as their loadClass() can't be overridden
+	if classloader.IsBuiltinLoader(cl.Name) {
+		if k, err := cl.LoadClass(className); err == nil {
+			return k, nil
+		}
+		return nil, nil
+	}
+	return callLoaderMethod(fs, loader, "loadClass", loadClassType, className)
+}
+
+// callLoaderMethod calls the method methName, whose descriptor is methType, of the
+// ClassLoader object loader (as its class implements it) to load or find the class
+// named className, and returns the class that the method returns. It returns nil if
+// the method throws ClassNotFoundException or returns null.
+func callLoaderMethod(fs *list.List, loader *object.Object, methName, methType, className string) (
+	*classloader.Klass, error) {
+
+	entry, excType, err := selectMethod(classloader.ObjectKlass(loader), methName, methType)
+	if err != nil {
+		return nil, newGException(selectionErrorClass(excType), err.Error())
+	}
+
+	name := strings.ReplaceAll(className, "/", ".")
+	ret, err := runMethodFromGo(fs, entry.Meth, entry.ClName, methName, methType, loader,
+		object.CreateCompactStringFromGoString(&name))
+	if exc, ok := err.(*gException); ok && isClassNotFound(exc) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return classKlass(ret), nil
+}
+
+// isClassNotFound reports whether exc stands for a ClassNotFoundException, including
+// one of a subclass, which a loader's method throws for a class that it can't find
+func isClassNotFound(exc *gException) bool {
+	if exc.excObj == nil {
+		return exc.className == classNotFoundException
+	}
+	return isSubclassOf(classloader.ObjectKlass(exc.excObj), fetchClass(classNotFoundException))
+}
+
+// loadClassDefault loads the class named className (in java/lang/String format) with the
+// ClassLoader object obj, whose state is jl, as ClassLoader.loadClass() does: if the
+// loader hasn't already loaded the class, its parent is asked to load it and, if the
+// parent can't, the object's findClass() is called. Like the JDK's loaders that are not
+// parallel capable, the loader loads one class at a time, holding the object's monitor.
+// It returns nil if the class can't be found.
+func loadClassDefault(fs *list.List, obj *object.Object, jl *javaLoader, className string) (
+	*classloader.Klass, error) {
+
+	if classloader.IsBuiltinLoader(jl.cl.Name) {
+		return loadClassWith(fs, obj, className)
+	}
+
+	thread := currentThreadID(fs)
+	object.MonitorEnter(obj, thread)
+	defer object.MonitorExit(obj, thread)
+
+	if k := jl.cl.FindLoadedClass(className); k != nil {
+		return k, nil
+	}
+	k, err := loadClassWith(fs, jl.parent, className)
+	if err == nil && k == nil {
+		k, err = callLoaderMethod(fs, obj, "findClass", findClassType, className)
+	}
+	if k == nil || err != nil {
+		return nil, err
+	}
+
+	if err = jl.cl.RecordLoadedClass(className, k); err != nil {
+		return nil, newGException("java/lang/LinkageError", err.Error())
+	}
+	return k, nil
+}
+
+// loadReferencedClass loads the class named className, which the code running in frame
+// f refers to, with the defining loader of that code's class if it's a user-defined
+// loader, which is how the classes that a user-defined loader defines find the other
+// classes they use. (The classes of the built-in loaders are found by name alone.)
+func loadReferencedClass(fs *list.List, f *frames.Frame, className string) error {
+	if className == f.ClName || strings.HasPrefix(className, "[") {
+		return nil
+	}
+	if !classloader.IsUserLoader(f.Loader) {
+		return nil
+	}
+
+	javaLoadersMutex.Lock()
+	loader := loaderObjects[f.Loader]
+	javaLoadersMutex.Unlock()
+	if loader == nil {
+		return nil
+	}
+
+	// a class that's not found is reported when it's looked for by name
+	_, err := loadClassWith(fs, loader, className)
+	return err
+}
+
+// defineClass defines a class, from the bytes of its class file in the byte array
+// bytesArg from offset off for length bytes, with the loader whose object is loader
+// (or with the bootstrap loader, if it's null). nameArg, if not null, is the binary name
+// that the class is expected to have. It returns the Class object of the class or, if
+// the class can't be defined, the exception to throw.
+func defineClass(loader *object.Object, nameArg, bytesArg interface{}, off, length int64) interface{} {
+	cl := classloader.LoaderNamed(classloader.BootstrapCL.Name)
+	var jl *javaLoader
+	if !object.IsNull(loader) {
+		if jl = getJavaLoader(loader); jl == nil {
+			return uninitializedLoader(loader)
+		}
+		cl = jl.cl
+	}
+
+	var className string
+	if name, ok := javaStringParam(nameArg); ok {
+		if strings.Contains(name, "/") || strings.HasPrefix(name, "[") {
+			return newGException(noClassDefFoundError, "IllegalName: "+name)
+		}
+		className = strings.ReplaceAll(name, ".", "/")
+	}
+
+	bytesObj, ok := bytesArg.(*object.Object)
+	if !ok || object.IsNull(bytesObj) || len(bytesObj.Fields) == 0 {
+		return newGException(nullPointerException, "")
+	}
+	rawBytes, ok := bytesObj.Fields[0].Fvalue.(*[]byte)
+	if !ok {
+		return newGException(nullPointerException, "")
+	}
+	if off < 0 || length < 0 || off+length > int64(len(*rawBytes)) {
+		return newGException("java/lang/IndexOutOfBoundsException",
+			fmt.Sprintf("Range [%d, %d + %d) out of bounds for length %d", off, off, length, len(*rawBytes)))
+	}
+
+	// the class is defined from a copy, as the app can change the array afterwards
+	classBytes := make([]byte, length)
+	copy(classBytes, (*rawBytes)[off:off+length])
+
+	k, err := classloader.DefineClass(cl, className, classBytes)
+	if err != nil {
+		if defErr, ok := err.(*classloader.ClassDefError); ok {
+			return newGException(defErr.Exception, defErr.Msg)
+		}
+		return err
+	}
+	if jl != nil {
+		keepLoader(loader, jl)
+	}
+	return classObject(k)
+}
+
+// java/lang/ClassLoader.<init>(), <init>(ClassLoader), and <init>(String, ClassLoader)
+// make the object a user-defined loader. Its parent is the app loader unless another
+// (which is the bootstrap loader if null) is given.
+func classLoaderInit(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	var name string
+	var parent *object.Object
+	switch len(params) {
+	case 1:
+		parent = systemClassLoader()
+	case 2:
+		parent, _ = params[1].(*object.Object)
+	default:
+		var ok bool
+		if name, ok = javaStringParam(params[1]); ok && name == "" {
+			return newGException("java/lang/IllegalArgumentException", "name must be non-empty or null")
+		}
+		parent, _ = params[2].(*object.Object)
+	}
+	return newUserLoader(obj, name, parent)
+}
+
+// java/lang/ClassLoader.loadClass(String) and loadClass(String, boolean) return the Class
+// object of the class with the given binary name, as loaded by the loader, or throw
+// ClassNotFoundException
+func classLoaderLoadClass(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	fs := params[len(params)-1].(*list.List)
+	name, ok := javaStringParam(params[1])
+	if !ok {
+		return newGException(nullPointerException, "")
+	}
+	if strings.Contains(name, "/") {
+		return newGException(classNotFoundException, name)
+	}
+
+	jl := getJavaLoader(obj)
+	if jl == nil {
+		return uninitializedLoader(obj)
+	}
+	k, err := loadClassDefault(fs, obj, jl, strings.ReplaceAll(name, ".", "/"))
+	if err != nil {
+		return err
+	}
+	if k == nil {
+		return newGException(classNotFoundException, name)
+	}
+	return classObject(k)
+}
+
+// java/lang/ClassLoader.findClass(String) throws ClassNotFoundException, as loaders that
+// find classes override it
+func classLoaderFindClass(params []interface{}) interface{} {
+	name, _ := javaStringParam(params[1])
+	return newGException(classNotFoundException, name)
+}
+
+// java/lang/ClassLoader.findLoadedClass(String) returns the Class object of the class with
+// the given binary name if the loader has loaded it, else null
+func classLoaderFindLoadedClass(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	name, ok := javaStringParam(params[1])
+	if !ok {
+		return object.Null
+	}
+	jl := getJavaLoader(obj)
+	if jl == nil {
+		return uninitializedLoader(obj)
+	}
+	if k := jl.cl.FindLoadedClass(strings.ReplaceAll(name, ".", "/")); k != nil {
+		return classObject(k)
+	}
+	return object.Null
+}
+
+// java/lang/ClassLoader.findBootstrapClass(String) returns the Class object of the class
+// with the given binary name, as loaded by the bootstrap loader, or null if it can't load it
+func classLoaderFindBootstrapClass(params []interface{}) interface{} {
+	name, ok := javaStringParam(params[0])
+	if !ok {
+		return object.Null
+	}
+	k, err := classloader.BootstrapCL.LoadClass(strings.ReplaceAll(name, ".", "/"))
+	if err != nil {
+		return object.Null
+	}
+	return classObject(k)
+}
+
+// java/lang/ClassLoader.findSystemClass(String) returns the Class object of the class with
+// the given binary name, as loaded by the app loader, or throws ClassNotFoundException
+func classLoaderFindSystemClass(params []interface{}) interface{} {
+	name, ok := javaStringParam(params[1])
+	if !ok {
+		return newGException(nullPointerException, "")
+	}
+	k, err := classloader.AppCL.LoadClass(strings.ReplaceAll(name, ".", "/"))
+	if err != nil {
+		return newGException(classNotFoundException, name)
+	}
+	return classObject(k)
+}
+
+// java/lang/ClassLoader.defineClass(byte[], int, int), defineClass(String, byte[], int, int),
+// and defineClass(String, byte[], int, int, ProtectionDomain). (Protection domains are not
+// supported, so the last is the same as the second.)
+func classLoaderDefineClass(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	if len(params) == 4 {
+		return defineClass(obj, nil, params[1], params[2].(int64), params[3].(int64))
+	}
+	return defineClass(obj, params[1], params[2], params[3].(int64), params[4].(int64))
+}
+
+// java/lang/ClassLoader.defineClass0(ClassLoader, Class, String, byte[], int, int,
+// ProtectionDomain, boolean, int, Object), the native by which MethodHandles.Lookup
+// defines classes. Hidden classes are not supported, so the class is defined as a
+// normal one.
+func classLoaderDefineClass0(params []interface{}) interface{} {
+	loader, _ := params[0].(*object.Object)
+	return defineClass(loader, params[2], params[3], params[4].(int64), params[5].(int64))
+}
+
+// java/lang/ClassLoader.defineClass1(ClassLoader, String, byte[], int, int,
+// ProtectionDomain, String), the native that defineClass() calls in the JDK
+func classLoaderDefineClass1(params []interface{}) interface{} {
+	loader, _ := params[0].(*object.Object)
+	return defineClass(loader, params[1], params[2], params[3].(int64), params[4].(int64))
+}
+
+// java/lang/ClassLoader.resolveClass(Class) links the class, which here happens when
+// the class is first used, so it only checks that there is a class
+func classLoaderResolveClass(params []interface{}) interface{} {
+	if classKlass(params[1]) == nil {
+		return newGException(nullPointerException, "")
+	}
+	return nil
+}
+
+// java/lang/ClassLoader.getParent()
+func classLoaderGetParent(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	jl := getJavaLoader(obj)
+	if jl == nil {
+		return uninitializedLoader(obj)
+	}
+	if jl.parent == nil {
+		return object.Null
+	}
+	return jl.parent
+}
+
+// java/lang/ClassLoader.getName() returns the name given to the constructor, if any
+func classLoaderGetName(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	jl := getJavaLoader(obj)
+	if jl == nil {
+		return uninitializedLoader(obj)
+	}
+	if jl.name == "" {
+		return object.Null
+	}
+	return object.CreateCompactStringFromGoString(&jl.name)
+}
+
+// java/lang/ClassLoader.getClassLoadingLock(String) returns the loader itself, whose
+// monitor loadClass() holds, as the loaders here are not parallel capable
+func classLoaderGetClassLoadingLock(params []interface{}) interface{} {
+	return params[0]
+}
+
+// java/lang/ClassLoader.getSystemClassLoader()
+func classLoaderGetSystemClassLoader(params []interface{}) interface{} {
+	return systemClassLoader()
+}
+
+// java/lang/ClassLoader.getPlatformClassLoader()
+func classLoaderGetPlatformClassLoader(params []interface{}) interface{} {
+	javaLoadersMutex.Lock()
+	defer javaLoadersMutex.Unlock()
+	return loaderObject(classloader.PlatformCL.Name)
+}
+
+// java/lang/ClassLoader.registerAsParallelCapable() reports success, although loaders
+// load one class at a time in any case
+func classLoaderRegisterAsParallelCapable(params []interface{}) interface{} {
+	return types.JavaBoolTrue
+}
+
+// java/net/URLClassLoader.<init>(URL[]), <init>(URL[], ClassLoader), and
+// <init>(String, URL[], ClassLoader) make the object a user-defined loader that finds
+// classes in the directories and JAR files of the given file: URLs
+func urlClassLoaderInit(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	var name string
+	var urls, parent *object.Object
+	switch len(params) {
+	case 2:
+		urls, _ = params[1].(*object.Object)
+		parent = systemClassLoader()
+	case 3:
+		urls, _ = params[1].(*object.Object)
+		parent, _ = params[2].(*object.Object)
+	default:
+		name, _ = javaStringParam(params[1])
+		urls, _ = params[2].(*object.Object)
+		parent, _ = params[3].(*object.Object)
+	}
+	if object.IsNull(urls) {
+		return newGException(nullPointerException, "")
+	}
+
+	if ret := newUserLoader(obj, name, parent); ret != nil {
+		return ret
+	}
+	for _, u := range *urls.Fields[0].Fvalue.(*[]*object.Object) {
+		if ret := addURL(obj, u); ret != nil {
+			return ret
+		}
+	}
+	return nil
+}
+
+// java/net/URLClassLoader.newInstance(URL[]) and newInstance(URL[], ClassLoader)
+func urlClassLoaderNewInstance(params []interface{}) interface{} {
+	fs := params[len(params)-1].(*list.List)
+	obj, err := InstantiateClass("java/net/URLClassLoader", fs)
+	if err != nil {
+		return err
+	}
+	args := append([]interface{}{obj}, params[:len(params)-1]...)
+	if ret := urlClassLoaderInit(args); ret != nil {
+		return ret
+	}
+	return obj
+}
+
+// addURL adds the URL u to those in which the URLClassLoader obj finds classes. A file:
+// URL names a directory if it ends with a slash and otherwise a JAR file; other kinds of
+// URL are kept but not searched.
+func addURL(obj *object.Object, u *object.Object) interface{} {
+	if object.IsNull(u) {
+		return newGException(nullPointerException, "")
+	}
+
+	javaLoadersMutex.Lock()
+	defer javaLoadersMutex.Unlock()
+
+	jl := javaLoaders[keyOf(obj)]
+	if jl == nil {
+		return uninitializedLoader(obj)
+	}
+	jl.urls = append(jl.urls, u)
+
+	spec := urlSpecs[keyOf(u)]
+	parsed, err := url.Parse(spec)
+	if err != nil || parsed.Scheme != "file" {
+		_ = log.Log("URLClassLoader: only file: URLs are searched for classes, not "+spec, log.WARNING)
+		return nil
+	}
+	path := parsed.Path
+	if path == "" {
+		path = parsed.Opaque // a relative file: URL, such as file:lib/a.jar
+	}
+	jl.paths = append(jl.paths, filepath.FromSlash(path))
+	return nil
+}
+
+// java/net/URLClassLoader.findClass(String) defines the class with the given binary name
+// from the first of the loader's directories and JAR files that holds it
+func urlClassLoaderFindClass(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	name, ok := javaStringParam(params[1])
+	if !ok {
+		return newGException(nullPointerException, "")
+	}
+
+	javaLoadersMutex.Lock()
+	jl := javaLoaders[keyOf(obj)]
+	var paths []string
+	if jl != nil {
+		paths = append(paths, jl.paths...)
+	}
+	javaLoadersMutex.Unlock()
+	if jl == nil {
+		return uninitializedLoader(obj)
+	}
+
+	className := strings.ReplaceAll(name, ".", "/")
+	definedName, err := classloader.LoadClassFromPaths(*jl.cl, paths, className)
+	if wrongName, ok := err.(*classloader.WrongNameError); ok {
+		return newGException(noClassDefFoundError, wrongName.Error())
+	}
+	if err != nil {
+		return newGException(classNotFoundException, name)
+	}
+	keepLoader(obj, jl)
+	return classObject(jl.cl.FindLoadedClass(definedName))
+}
+
+// java/net/URLClassLoader.addURL(URL)
+func urlClassLoaderAddURL(params []interface{}) interface{} {
+	return addURL(params[0].(*object.Object), params[1].(*object.Object))
+}
+
+// java/net/URLClassLoader.getURLs()
+func urlClassLoaderGetURLs(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	javaLoadersMutex.Lock()
+	defer javaLoadersMutex.Unlock()
+
+	jl := javaLoaders[keyOf(obj)]
+	if jl == nil {
+		return uninitializedLoader(obj)
+	}
+	urls := object.Make1DimArray(object.REF, int64(len(jl.urls)))
+	copy(*urls.Fields[0].Fvalue.(*[]*object.Object), jl.urls)
+	return urls
+}
+
+// java/net/URLClassLoader.close() has nothing to release, as the JAR files that the
+// loader opens stay open for the life of the VM
+func urlClassLoaderClose(params []interface{}) interface{} {
+	return nil
+}
+
+// java/net/URL.<init>(String)
+func urlInit(params []interface{}) interface{} {
+	spec, ok := javaStringParam(params[1])
+	if !ok {
+		return newGException("java/net/MalformedURLException", "")
+	}
+	if parsed, err := url.Parse(spec); err != nil || parsed.Scheme == "" {
+		return newGException("java/net/MalformedURLException", "no protocol: "+spec)
+	}
+
+	obj := params[0].(*object.Object)
+	javaLoadersMutex.Lock()
+	if _, ok := urlSpecs[keyOf(obj)]; !ok {
+		runtime.SetFinalizer(obj, releaseURL)
+	}
+	urlSpecs[keyOf(obj)] = spec
+	javaLoadersMutex.Unlock()
+	return nil
+}
+
+// releaseURL is the finalizer of a URL object, which releases its string form
+func releaseURL(obj *object.Object) {
+	javaLoadersMutex.Lock()
+	delete(urlSpecs, keyOf(obj))
+	javaLoadersMutex.Unlock()
+}
+
+// urlSpec returns the string form of the URL object obj
+func urlSpec(obj *object.Object) string {
+	javaLoadersMutex.Lock()
+	defer javaLoadersMutex.Unlock()
+	return urlSpecs[keyOf(obj)]
+}
+
+// java/net/URL.toString() and toExternalForm()
+func urlToString(params []interface{}) interface{} {
+	spec := urlSpec(params[0].(*object.Object))
+	return object.CreateCompactStringFromGoString(&spec)
+}
+
+// java/net/URL.getProtocol()
+func urlGetProtocol(params []interface{}) interface{} {
+	parsed, _ := url.Parse(urlSpec(params[0].(*object.Object)))
+	return object.CreateCompactStringFromGoString(&parsed.Scheme)
+}
+
+// java/net/URL.getPath()
+func urlGetPath(params []interface{}) interface{} {
+	parsed, _ := url.Parse(urlSpec(params[0].(*object.Object)))
+	path := parsed.Path
+	if path == "" {
+		path = parsed.Opaque
+	}
+	return object.CreateCompactStringFromGoString(&path)
+}
+
+// java/lang/Class.getName() returns the binary name of the class
+func classGetName(params []interface{}) interface{} {
+	k := classKlass(params[0])
+	if k == nil || k.Data == nil {
+		return newGException(nullPointerException, "")
+	}
+	name := strings.ReplaceAll(k.Data.Name, "/", ".")
+	return object.CreateCompactStringFromGoString(&name)
+}
+
+// java/lang/Class.getClassLoader() returns the object of the class's defining loader,
+// which is null for the bootstrap loader
+func classGetClassLoader(params []interface{}) interface{} {
+	k := classKlass(params[0])
+	if k == nil {
+		return newGException(nullPointerException, "")
+	}
+
+	javaLoadersMutex.Lock()
+	defer javaLoadersMutex.Unlock()
+	if loader := loaderObject(k.Loader); loader != nil {
+		return loader
+	}
+	return object.Null
+}
+
+// java/lang/Class.newInstance() creates an object of the class with its no-arg constructor
+func classNewInstance(params []interface{}) interface{} {
+	k := classKlass(params[0])
+	fs := params[len(params)-1].(*list.List)
+	if k == nil || k.Data == nil {
+		return newGException(nullPointerException, "")
+	}
+
+	className := k.Data.Name
+	_, hasInit := k.Data.MethodTable["<init>()V"]
+	if !hasInit || k.Data.Access.ClassIsAbstract || k.Data.Access.ClassIsInterface {
+		return newGException("java/lang/InstantiationException", strings.ReplaceAll(className, "/", "."))
+	}
+
+	obj, err := instantiateKlass(k, fs)
+	if err != nil {
+		return err
+	}
+	mtEntry, err := classloader.FetchKlassMethod(k, "<init>", "()V")
+	if err != nil {
+		return err
+	}
+	if _, err = runMethodFromGo(fs, mtEntry, className, "<init>", "()V", obj); err != nil {
+		return err
+	}
+	return obj
+}
+
+// java/lang/Object.getClass() returns the Class object of the object's class
+func objectGetClass(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	k := classloader.ObjectKlass(obj)
+	if k == nil {
+		k = fetchClass(*obj.Klass)
+	}
+	if k == nil {
+		return newGException(noClassDefFoundError, strings.ReplaceAll(*obj.Klass, "/", "."))
+	}
+	return classObject(k)
+}
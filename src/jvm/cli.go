@@ -58,9 +58,10 @@ func HandleCli(osArgs []string, Global *globals.Globals) (err error) {
 			continue // skip the arg if there was a problem. (Might want to revisit this.)
 		}
 
-		// if the option is the name of the class to execute, note that then get
-		// all successive arguments and store them as app args in Global
-		if strings.HasSuffix(option, ".class") {
+		// if the arg is the class to execute--either a .class file or, as it isn't an
+		// option, the fully qualified name of a class on the classpath--note that, then
+		// get all successive arguments and store them as app args in Global
+		if strings.HasSuffix(option, ".class") || !strings.HasPrefix(args[i], "-") {
 			Global.StartingClass = option
 			for i = i + 1; i < len(args); i++ {
 				Global.AppArgs = append(Global.AppArgs, args[i])
@@ -91,12 +92,17 @@ func getOptionRootAndArgs(option string) (string, string, error) {
 		return "", "", errors.New("empty option error")
 	}
 
-	// if the option has an embedded arg value, it'll come after a : or an =
-	argMarker := strings.Index(option, ":")
-	if argMarker == -1 {
-		argMarker = strings.Index(option, "=")
+	// a few options, such as -Xss, have their arg value appended directly to the option
+	for _, root := range []string{"-Xss"} {
+		if strings.HasPrefix(option, root) {
+			return root, option[len(root):], nil
+		}
 	}
 
+	// if the option has an embedded arg value, it'll come after the first : or =
+	// (the value itself can contain either, as in --class-path=lib/a.jar:lib/b.jar)
+	argMarker := strings.IndexAny(option, ":=")
+
 	// if there's no embedded : or = then the option doesn't contain an arg value
 	if argMarker == -1 {
 		return option, "", nil
@@ -143,7 +149,8 @@ func ShowUsage(outStream *os.File) {
 	userMessage :=
 		`
 Usage: jacobin [options] <mainclass> [args...]
-	        (to execute a class)
+	        (to execute a class, given by its fully qualified name
+	         or as a .class file)
    or jacobin [options] -jar <jarfile> [args...]
 	        (to execute a jar file)
 Arguments following the main class, source file, -jar <jarfile>,
@@ -151,6 +158,11 @@ are passed as the arguments to main class.
 
 where options include:
 	-client       to select the "client" VM
+	-cp <class search path of directories and zip/jar files>
+	-classpath <class search path of directories and zip/jar files>
+	--class-path <class search path of directories and zip/jar files>
+				  A : separated list of directories, JAR archives,
+				    and ZIP archives to search for class files.
 	-verbose:[class|info|fine|finest]  enable verbose output
                   info, fine, finest are Jacobin-specific options providing
                     increasing amounts of detail. The finest level is used
@@ -162,10 +174,17 @@ where options include:
 	-showversion  print product version to the error stream and continue
 	--show-version
 				  print product version to the output stream and continue
+	-Xss<size>    set the size of a thread's stack (for example, -Xss512k or -Xss2m)
 
 Jacobin-specific options:
 	-strictJDK    make user messages conform closely to the JDK's format
-	-trace:inst   display instruction-level tracing data to the console`
+	-trace:inst   display instruction-level tracing data to the console
+	-Xtier:[interpreter|closures]
+				  execute methods with the interpreter only (the default), or also
+				    compile hot methods into closures
+	-XX:DeterministicScheduling[=<seed>]
+				  run threads one at a time, switching between them in an order
+				    determined by the seed, so that a run can be reproduced`
 
 	_, _ = fmt.Fprintln(outStream, userMessage)
 }
@@ -541,3 +541,182 @@ func TestEmptyOptionForEmbeddedArg(t *testing.T) {
 		t.Error("Empty option should fail test for embedded args, but did not.")
 	}
 }
+
+func TestSetThreadStackSize(t *testing.T) {
+	global := globals.InitGlobals("test")
+	LoadOptionsTable(global)
+
+	normalStdout := os.Stdout
+	_, wout, _ := os.Pipe()
+	os.Stdout = wout
+
+	args := []string{"jacobin", "-Xss2m"}
+	_ = HandleCli(args, &global)
+
+	_ = wout.Close()
+	os.Stdout = normalStdout
+
+	if global.MaxFrames != 2*1024*1024/globals.StackBytesPerFrame {
+		t.Errorf("-Xss2m: Expected MaxFrames of %d, got: %d",
+			2*1024*1024/globals.StackBytesPerFrame, global.MaxFrames)
+	}
+	if !global.Options["-Xss"].Set {
+		t.Error("-Xss2m: Expected the -Xss option to be marked as set")
+	}
+
+	// a size of 0 is the default size, and a size too small for a frame has room for one
+	for size, expected := range map[string]int{"0": globals.DefaultMaxFrames, "0k": globals.DefaultMaxFrames, "10": 1} {
+		_ = HandleCli([]string{"jacobin", "-Xss" + size}, &global)
+		if global.MaxFrames != expected {
+			t.Errorf("-Xss%s: Expected MaxFrames of %d, got: %d", size, expected, global.MaxFrames)
+		}
+	}
+
+	sizes := map[string]int64{"4096": 4096, "512k": 512 * 1024, "512K": 512 * 1024,
+		"1M": 1024 * 1024, "1g": 1024 * 1024 * 1024}
+	for size, expected := range sizes {
+		bytes, err := parseMemorySize(size)
+		if err != nil || bytes != expected {
+			t.Errorf("-Xss%s: Expected a size of %d bytes, got: %d (error: %v)", size, expected, bytes, err)
+		}
+	}
+}
+
+func TestInvalidThreadStackSize(t *testing.T) {
+	global := globals.InitGlobals("test")
+	LoadOptionsTable(global)
+
+	normalStdout := os.Stdout
+	_, wout, _ := os.Pipe()
+	os.Stdout = wout
+
+	normalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	args := []string{"jacobin", "-Xss2q"}
+	_ = HandleCli(args, &global)
+
+	_ = w.Close()
+	out, _ := io.ReadAll(r)
+	os.Stderr = normalStderr
+
+	_ = wout.Close()
+	os.Stdout = normalStdout
+
+	msg := string(out[:])
+	if !strings.Contains(msg, "Invalid thread stack size: -Xss2q") {
+		t.Errorf("-Xss2q: Expected an invalid stack size message, got: %s", msg)
+	}
+	if global.MaxFrames != globals.DefaultMaxFrames {
+		t.Errorf("-Xss2q: Expected MaxFrames to be unchanged, got: %d", global.MaxFrames)
+	}
+
+	for _, size := range []string{"", "k", "-1m", "1.5m"} {
+		if _, err := parseMemorySize(size); err == nil {
+			t.Errorf("-Xss%s: Expected an error for an invalid size, but got none", size)
+		}
+	}
+}
+
+func TestSetExecutionTier(t *testing.T) {
+	global := globals.InitGlobals("test")
+	LoadOptionsTable(global)
+	defer func(enabled bool) { closureTier = enabled }(closureTier)
+
+	closureTier = false
+	args := []string{"jacobin", "-Xtier:closures"}
+	_ = HandleCli(args, &global)
+	if !closureTier {
+		t.Error("-Xtier:closures: Expected the closure tier to be enabled")
+	}
+	if !global.Options["-Xtier"].Set {
+		t.Error("-Xtier:closures: Expected the -Xtier option to be marked as set")
+	}
+
+	if _, err := setExecutionTier(0, "interpreter", &global); err != nil || closureTier {
+		t.Errorf("-Xtier:interpreter: Expected the closure tier to be disabled (error: %v)", err)
+	}
+
+	normalStderr := os.Stderr
+	_, w, _ := os.Pipe()
+	os.Stderr = w
+	_, err := setExecutionTier(0, "jit", &global)
+	_ = w.Close()
+	os.Stderr = normalStderr
+	if err == nil || closureTier {
+		t.Error("-Xtier:jit: Expected an error and the closure tier to remain disabled")
+	}
+}
+
+func TestDeterministicSchedulingOption(t *testing.T) {
+	global := globals.InitGlobals("test")
+	log.Init()
+	LoadOptionsTable(global)
+	defer func() { scheduler = nil }()
+
+	normalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	args := []string{"jacobin", "-XX:DeterministicScheduling=42"}
+	_ = HandleCli(args, &global)
+	_, err := setAdvancedOption(0, "DeterministicScheduling=forty-two", &global)
+	_ = w.Close()
+	os.Stderr = normalStderr
+	out, _ := io.ReadAll(r)
+
+	if scheduler == nil || !global.Options["-XX"].Set {
+		t.Fatalf("-XX:DeterministicScheduling=42: Expected threads to be scheduled deterministically")
+	}
+	if !strings.Contains(string(out), "with seed 42") {
+		t.Errorf("-XX:DeterministicScheduling=42: Expected the seed to be logged, got: %s", string(out))
+	}
+	if err == nil {
+		t.Errorf("-XX:DeterministicScheduling=forty-two: Expected an error for an invalid seed")
+	}
+}
+
+func TestClasspathOptions(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	for _, option := range []string{"-cp", "-classpath", "--class-path"} {
+		global := globals.InitGlobals("test")
+		LoadOptionsTable(global)
+
+		args := []string{"jacobin", option, "classes" + sep + "lib/app.jar", "Main.class", "arg"}
+		_ = HandleCli(args, &global)
+
+		if len(global.Classpath) != 2 || global.Classpath[0] != "classes" || global.Classpath[1] != "lib/app.jar" {
+			t.Errorf("%s: Expected classpath [classes lib/app.jar], got %v", option, global.Classpath)
+		}
+		if global.StartingClass != "Main.class" || len(global.AppArgs) != 1 {
+			t.Errorf("%s: Expected starting class Main.class with 1 app arg, got %s with %v",
+				option, global.StartingClass, global.AppArgs)
+		}
+		if !global.Options[option].Set {
+			t.Errorf("%s: Expected the option to be marked as set", option)
+		}
+	}
+
+	global := globals.InitGlobals("test")
+	LoadOptionsTable(global)
+	args := []string{"jacobin", "--class-path=classes" + sep + "lib/app.jar", "Main.class"}
+	_ = HandleCli(args, &global)
+	if len(global.Classpath) != 2 || global.Classpath[1] != "lib/app.jar" {
+		t.Errorf("--class-path=: Expected classpath [classes lib/app.jar], got %v", global.Classpath)
+	}
+}
+
+func TestFoundClassNameWithArgs(t *testing.T) {
+	global := globals.InitGlobals("test")
+	LoadOptionsTable(global)
+
+	args := []string{"jacobin", "-cp", "build", "com.acme.app.Main", "arg1", "-arg2"}
+	_ = HandleCli(args, &global)
+
+	if global.StartingClass != "com.acme.app.Main" {
+		t.Errorf("Expected com.acme.app.Main as the starting class, got: %s", global.StartingClass)
+	}
+	if len(global.AppArgs) != 2 || global.AppArgs[0] != "arg1" || global.AppArgs[1] != "-arg2" {
+		t.Errorf("Expected app args [arg1 -arg2], got: %v", global.AppArgs)
+	}
+}
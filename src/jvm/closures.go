@@ -0,0 +1,689 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"jacobin/frames"
+	"jacobin/log"
+	"jacobin/opcodes"
+	"math"
+)
+
+// The closure tier is an alternative to interpreting a method's bytecode one instruction
+// at a time with the switch in runFrame(). It's enabled with -Xtier:closures. When a
+// method becomes hot--that is, when it has been invoked tierInvocationThreshold times or
+// has jumped backwards (as loops do) tierBackedgeThreshold times--its bytecode is compiled
+// into trees of golang closures, in which the operands of the instructions (local
+// variable indexes, constants, jump targets) are bound when the closures are created.
+//
+// The bytecode is compiled a statement at a time. A statement is a run of instructions
+// that ends with one that stores a value in a local variable, increments one, or jumps.
+// The instructions of a statement that push values (loads and constants) and compute them
+// (arithmetic, conversions, and comparisons) become a tree of closures that computes the
+// values directly, without pushing them onto the operand stack. So, for example:
+//
+//	ILOAD_1, ILOAD_2, IADD, ISTORE_1
+//
+// is compiled to one closure that stores the result of an add closure, which calls two
+// closures that load the local variables. Values used by a statement that were pushed
+// before it started are read from the operand stack, and values that the statement
+// computes but does not use are pushed onto it when the statement ends.
+//
+// Only instructions on primitive values are compiled. The others--invokes, returns, field
+// and array accesses, and the like--are left to the interpreter, as are instructions that
+// can throw an exception. The compiled method is executed by the interpreter loop: when
+// it reaches an instruction that's the start of a statement, it executes the statement's
+// closure (and those of the statements that follow), and otherwise it interprets the
+// instruction. Because of this, the closure tier needs no support for exceptions, method
+// calls, or tracing, which run as they always do. (When tracing, the tier is not used.)
+
+// closureTier is set when the closure tier is enabled (by -Xtier:closures)
+var closureTier = false
+
+// The thresholds at which a method is compiled. The counts are kept in the method's
+// quickCode.
+var tierInvocationThreshold int32 = 1000
+var tierBackedgeThreshold int32 = 10000
+
+// closureOp executes a statement of a compiled method in frame f and returns the PC of
+// the next instruction to execute, or interpretStatement if the interpreter must execute
+// the statement's instructions instead
+type closureOp func(f *frames.Frame) int
+
+// interpretStatement is returned by a statement that can't be executed in the closure
+// tier because the operand stack would overflow or underflow. The statement returns it
+// before it changes anything, so the interpreter then executes the statement's
+// instructions and reports the error at the instruction that causes it.
+const interpretStatement = -1
+
+// closureCode is a compiled method. Its statements are indexed by the PC of their first
+// instruction. Where an entry is nil, the instruction at that PC is interpreted.
+type closureCode struct {
+	ops []closureOp
+}
+
+// run executes the statements of the compiled method in frame f, starting at f.PC, until
+// it reaches an instruction that's not the start of a statement or the end of the method
+func (c *closureCode) run(f *frames.Frame) {
+	for f.PC < len(c.ops) {
+		op := c.ops[f.PC]
+		if op == nil {
+			return
+		}
+		next := op(f)
+		if next == interpretStatement {
+			return
+		}
+		f.PC = next
+	}
+}
+
+// tierState is used by runFrame() to count the invocations and backward jumps of the
+// methods it interprets. It holds the frame and the PC of the last instruction.
+type tierState struct {
+	frame *frames.Frame
+	pc    int
+}
+
+// execute runs the method in frame f in the closure tier, if it's compiled or has become
+// hot enough to be compiled. Otherwise, it counts the invocation of the method (when f is
+// a frame that has not yet executed an instruction) or the backward jump that led to f.PC.
+func (t *tierState) execute(f *frames.Frame) {
+	q := getQuickCode(f)
+	if q == nil {
+		return
+	}
+	c := q.compiled.Load()
+	if c == nil {
+		if f != t.frame {
+			if f.PC == 0 {
+				q.invocations.Add(1)
+			}
+		} else if f.PC < t.pc {
+			q.backedges.Add(1)
+		}
+		t.frame, t.pc = f, f.PC
+		if q.invocations.Load() < tierInvocationThreshold && q.backedges.Load() < tierBackedgeThreshold {
+			return
+		}
+		c = compileMethod(f, q)
+	}
+	c.run(f)
+}
+
+// compileMethod compiles the method executing in frame f, whose quickCode is q
+func compileMethod(f *frames.Frame, q *quickCode) *closureCode {
+	c := compileClosures(f.Meth, q)
+	if !q.compiled.CompareAndSwap(nil, c) { // another thread compiled it first
+		return q.compiled.Load()
+	}
+
+	statements := 0
+	for _, op := range c.ops {
+		if op != nil {
+			statements++
+		}
+	}
+	_ = log.Log(fmt.Sprintf("Closure tier: compiled %s.%s%s into %d statements",
+		f.ClName, f.MethName, f.MethType, statements), log.FINE)
+	return c
+}
+
+// expr is a tree of closures that computes a primitive value. eval returns the value as
+// it's held in a slot of OpPrims: an int64 or the bits of a float64.
+type expr struct {
+	eval func(f *frames.Frame) int64
+	kind frames.PrimSlot
+	wide bool // a long or a double, which occupies two slots
+}
+
+// slotCount returns the number of slots of the operand stack that the value occupies
+func (e expr) slotCount() int {
+	if e.wide {
+		return 2
+	}
+	return 1
+}
+
+// closureCompiler holds the state of the compilation of a method
+type closureCompiler struct {
+	code    []byte
+	q       *quickCode
+	ops     []closureOp
+	leaders []bool // the PCs to which instructions jump, where a new statement must start
+
+	// the statement being compiled
+	start    int    // the PC of its first instruction
+	pending  []expr // the values it has computed, which have not been used yet
+	consumed int    // the number of slots of the operand stack it has used
+}
+
+// compileClosures compiles a method's bytecode, whose quickCode is q. Compilation stops
+// at an invalid instruction, which is then left to the interpreter to report.
+func compileClosures(code []byte, q *quickCode) *closureCode {
+	c := closureCompiler{code: code, q: q, ops: make([]closureOp, len(code)), leaders: findLeaders(code)}
+	pc := 0
+	for pc < len(code) {
+		length := instrLength(code, pc)
+		if length == 0 || pc+length > len(code) {
+			break
+		}
+		if c.leaders[pc] && pc > c.start {
+			c.endStatement(pc)
+		}
+		next := pc + length
+		if !c.compile(pc, next) { // the instruction is interpreted
+			c.endStatement(pc)
+			c.start = next
+		}
+		pc = next
+	}
+	c.endStatement(pc)
+	return &closureCode{ops: c.ops}
+}
+
+// findLeaders returns the PCs to which the instructions in code jump
+func findLeaders(code []byte) []bool {
+	leaders := make([]bool, len(code))
+	mark := func(target int) {
+		if target >= 0 && target < len(code) {
+			leaders[target] = true
+		}
+	}
+	for pc := 0; pc < len(code); {
+		length := instrLength(code, pc)
+		if length == 0 || pc+length > len(code) {
+			break
+		}
+		switch op := code[pc]; {
+		case op >= opcodes.IFEQ && op <= opcodes.JSR, op == opcodes.IFNULL, op == opcodes.IFNONNULL:
+			mark(pc + int(int16(binary.BigEndian.Uint16(code[pc+1:pc+3]))))
+		case op == opcodes.GOTO_W, op == opcodes.JSR_W:
+			mark(pc + int(int32(binary.BigEndian.Uint32(code[pc+1:pc+5]))))
+		case op == opcodes.TABLESWITCH, op == opcodes.LOOKUPSWITCH:
+			operandsPC := pc + 1 + (3 - (pc % 4))
+			offset := func(at int) int { return int(int32(binary.BigEndian.Uint32(code[at : at+4]))) }
+			mark(pc + offset(operandsPC)) // the default
+
+			// a TABLESWITCH's offsets follow its low and high values; a LOOKUPSWITCH's
+			// follow its pair count, and each is paired with the value it matches
+			first, step := operandsPC+12, 4
+			if op == opcodes.LOOKUPSWITCH {
+				step = 8
+			}
+			for at := first; at+4 <= pc+length; at += step {
+				mark(pc + offset(at))
+			}
+		}
+		pc += length
+	}
+	return leaders
+}
+
+// endStatement ends the statement being compiled at pc, where the next instruction to be
+// executed begins. Its unused values are pushed onto the operand stack.
+func (c *closureCompiler) endStatement(pc int) {
+	if c.start >= pc {
+		return
+	}
+	s := c.settle()
+	if s == nil { // the statement has no effect
+		c.ops[c.start] = func(f *frames.Frame) int { return pc }
+	} else {
+		c.ops[c.start] = func(f *frames.Frame) int {
+			if !s.fits(f) {
+				return interpretStatement
+			}
+			s.apply(f)
+			return pc
+		}
+	}
+	c.start = pc
+}
+
+// finish ends the statement being compiled with an instruction that takes the action
+// of op, and starts a new statement at next
+func (c *closureCompiler) finish(op closureOp, next int) {
+	c.ops[c.start] = op
+	c.start = next
+}
+
+// settling is what a statement does to the operand stack: it removes the slots the
+// statement used and pushes the values it computed but did not use
+type settling struct {
+	values   []expr
+	consumed int // the number of slots removed
+	pushed   int // the number of slots pushed
+}
+
+// settle returns the settling of the statement being compiled, or nil if the statement
+// leaves the operand stack as it is. The state of the statement is reset.
+func (c *closureCompiler) settle() *settling {
+	s := settling{values: c.pending, consumed: c.consumed}
+	c.pending, c.consumed = nil, 0
+	if len(s.values) == 0 && s.consumed == 0 {
+		return nil
+	}
+	for _, e := range s.values {
+		s.pushed += e.slotCount()
+	}
+	return &s
+}
+
+// fits tells whether the operand stack of frame f holds the slots the statement uses and
+// has room for those it pushes. A statement checks this before it reads the stack.
+func (s *settling) fits(f *frames.Frame) bool {
+	return f.TOS+1 >= s.consumed && f.TOS-s.consumed+s.pushed < len(f.OpStack)
+}
+
+// apply settles the operand stack of frame f
+func (s *settling) apply(f *frames.Frame) {
+	var buf [8]int64
+	results := buf[:0]
+	for _, e := range s.values { // all values are computed before the stack changes
+		results = append(results, e.eval(f))
+	}
+	f.TOS -= s.consumed
+	for i, e := range s.values {
+		pushPrim(f, e.kind, results[i])
+		if e.wide {
+			pushPrim(f, e.kind, results[i])
+		}
+	}
+}
+
+// push adds a value computed by the statement
+func (c *closureCompiler) push(e expr) {
+	c.pending = append(c.pending, e)
+}
+
+// operand returns the value the next instruction of the statement uses: the last value
+// the statement computed or, if there is none, the value on top of the operand stack
+// as it was before the statement, less the slots the statement already used
+func (c *closureCompiler) operand(kind frames.PrimSlot, wide bool) expr {
+	if n := len(c.pending); n > 0 {
+		e := c.pending[n-1]
+		c.pending = c.pending[:n-1]
+		return e
+	}
+	e := stackExpr(c.consumed, kind, wide)
+	c.consumed += e.slotCount()
+	return e
+}
+
+// compile compiles the instruction at pc, whose successor is at next. It returns false
+// if the instruction is to be interpreted.
+func (c *closureCompiler) compile(pc, next int) bool {
+	code := c.code
+	op := code[pc]
+	switch {
+	case op == opcodes.NOP:
+	case op >= opcodes.ICONST_M1 && op <= opcodes.ICONST_5:
+		c.push(constExpr(frames.PrimInt, false, int64(op)-int64(opcodes.ICONST_0)))
+	case op == opcodes.LCONST_0 || op == opcodes.LCONST_1:
+		c.push(constExpr(frames.PrimInt, true, int64(op-opcodes.LCONST_0)))
+	case op >= opcodes.FCONST_0 && op <= opcodes.FCONST_2:
+		c.push(floatConstExpr(false, float64(op-opcodes.FCONST_0)))
+	case op == opcodes.DCONST_0 || op == opcodes.DCONST_1:
+		c.push(floatConstExpr(true, float64(op-opcodes.DCONST_0)))
+	case op == opcodes.BIPUSH:
+		c.push(constExpr(frames.PrimInt, false, byteToInt64(code[pc+1])))
+	case op == opcodes.SIPUSH:
+		c.push(constExpr(frames.PrimInt, false, int64(int16(binary.BigEndian.Uint16(code[pc+1:pc+3])))))
+	case op == opcodes.LDC || op == opcodes.LDC_W || op == opcodes.LDC2_W:
+		// constants are compiled if the instruction has been quickened, as it then holds the value
+		r := c.q.instrs[pc].resolved.Load()
+		if r == nil || (r.value.value != frames.PrimInt && r.value.value != frames.PrimFloat) {
+			return false
+		}
+		c.push(constExpr(r.value.value.(frames.PrimSlot), op == opcodes.LDC2_W, r.value.prim))
+
+	case op == opcodes.ILOAD || op == opcodes.LLOAD:
+		c.push(localIntExpr(int(code[pc+1]), op == opcodes.LLOAD))
+	case op == opcodes.FLOAD || op == opcodes.DLOAD:
+		c.push(localFloatExpr(int(code[pc+1]), op == opcodes.DLOAD))
+	case op >= opcodes.ILOAD_0 && op <= opcodes.ILOAD_3:
+		c.push(localIntExpr(int(op-opcodes.ILOAD_0), false))
+	case op >= opcodes.LLOAD_0 && op <= opcodes.LLOAD_3:
+		c.push(localIntExpr(int(op-opcodes.LLOAD_0), true))
+	case op >= opcodes.FLOAD_0 && op <= opcodes.FLOAD_3:
+		c.push(localFloatExpr(int(op-opcodes.FLOAD_0), false))
+	case op >= opcodes.DLOAD_0 && op <= opcodes.DLOAD_3:
+		c.push(localFloatExpr(int(op-opcodes.DLOAD_0), true))
+
+	case op == opcodes.ISTORE || op == opcodes.LSTORE || op == opcodes.FSTORE || op == opcodes.DSTORE:
+		kind, wide := storeKind(op - opcodes.ISTORE)
+		c.compileStore(int(code[pc+1]), kind, wide, next)
+	case op >= opcodes.ISTORE_0 && op <= opcodes.DSTORE_3:
+		kind, wide := storeKind((op - opcodes.ISTORE_0) / 4)
+		c.compileStore(int((op-opcodes.ISTORE_0)%4), kind, wide, next)
+	case op == opcodes.IINC:
+		index, increment := int(code[pc+1]), byteToInt64(code[pc+2])
+		s := c.settle() // the values computed before are read before the local changes
+		c.finish(func(f *frames.Frame) int {
+			if s != nil {
+				if !s.fits(f) {
+					return interpretStatement
+				}
+				s.apply(f)
+			}
+			storeInt(f, index, loadInt(f, index)+increment)
+			return next
+		}, next)
+
+	case op == opcodes.POP || op == opcodes.POP2 || op == opcodes.DUP:
+		// these are compiled only when they handle values computed by the statement
+		n := len(c.pending)
+		switch {
+		case n == 0:
+			return false
+		case op == opcodes.POP && !c.pending[n-1].wide:
+			c.pending = c.pending[:n-1]
+		case op == opcodes.POP2 && c.pending[n-1].wide:
+			c.pending = c.pending[:n-1]
+		case op == opcodes.POP2 && n >= 2 && !c.pending[n-1].wide && !c.pending[n-2].wide:
+			c.pending = c.pending[:n-2]
+		case op == opcodes.DUP && !c.pending[n-1].wide:
+			c.push(c.pending[n-1]) // the value is computed twice, which is safe as exprs have no side effects
+		default:
+			return false
+		}
+
+	case op == opcodes.IADD || op == opcodes.LADD || op == opcodes.ISUB || op == opcodes.LSUB ||
+		op == opcodes.IMUL || op == opcodes.LMUL || op == opcodes.IAND || op == opcodes.LAND ||
+		op == opcodes.IOR || op == opcodes.LOR || op == opcodes.IXOR || op == opcodes.LXOR:
+		wide := op%2 == 1 // the long versions of these opcodes are odd
+		b := c.operand(frames.PrimInt, wide)
+		a := c.operand(frames.PrimInt, wide)
+		c.push(expr{eval: intArithmetic(op, a.eval, b.eval), kind: frames.PrimInt, wide: wide})
+	case op == opcodes.FADD || op == opcodes.FSUB || op == opcodes.FMUL || op == opcodes.FDIV ||
+		op == opcodes.FREM || op == opcodes.DADD || op == opcodes.DSUB || op == opcodes.DMUL ||
+		op == opcodes.DDIV:
+		wide := op%2 == 1 // the double versions of these opcodes are odd
+		b := c.operand(frames.PrimFloat, wide)
+		a := c.operand(frames.PrimFloat, wide)
+		c.push(expr{eval: floatArithmetic(op, a.eval, b.eval), kind: frames.PrimFloat, wide: wide})
+	case op == opcodes.INEG || op == opcodes.LNEG:
+		a := c.operand(frames.PrimInt, op == opcodes.LNEG).eval
+		c.push(expr{eval: func(f *frames.Frame) int64 { return -a(f) }, kind: frames.PrimInt, wide: op == opcodes.LNEG})
+	case op == opcodes.FNEG || op == opcodes.DNEG:
+		a := c.operand(frames.PrimFloat, op == opcodes.DNEG).eval
+		c.push(expr{eval: func(f *frames.Frame) int64 { return floatBits(-math.Float64frombits(uint64(a(f)))) },
+			kind: frames.PrimFloat, wide: op == opcodes.DNEG})
+	case op == opcodes.I2L || op == opcodes.L2I || op == opcodes.I2F || op == opcodes.I2D ||
+		op == opcodes.L2F || op == opcodes.L2D || op == opcodes.F2I || op == opcodes.F2L ||
+		op == opcodes.F2D || op == opcodes.D2I || op == opcodes.D2L || op == opcodes.D2F ||
+		op == opcodes.I2C || op == opcodes.I2S:
+		c.compileConversion(op)
+	case op == opcodes.LCMP:
+		b := c.operand(frames.PrimInt, true).eval
+		a := c.operand(frames.PrimInt, true).eval
+		c.push(expr{eval: func(f *frames.Frame) int64 { return compareLongs(a(f), b(f)) }, kind: frames.PrimInt})
+	case op == opcodes.FCMPL || op == opcodes.FCMPG || op == opcodes.DCMPL || op == opcodes.DCMPG:
+		wide := op == opcodes.DCMPL || op == opcodes.DCMPG
+		nanResult := int64(-1)
+		if op == opcodes.FCMPG || op == opcodes.DCMPG {
+			nanResult = 1
+		}
+		b := c.operand(frames.PrimFloat, wide).eval
+		a := c.operand(frames.PrimFloat, wide).eval
+		c.push(expr{eval: func(f *frames.Frame) int64 {
+			return compareFloats(math.Float64frombits(uint64(a(f))), math.Float64frombits(uint64(b(f))), nanResult)
+		}, kind: frames.PrimInt})
+
+	case op >= opcodes.IFEQ && op <= opcodes.IF_ICMPLE:
+		if (op == opcodes.IFEQ || op == opcodes.IFNE) && len(c.pending) == 0 {
+			return false // the value might be a boolean, which the interpreter handles
+		}
+		target := pc + int(int16(binary.BigEndian.Uint16(code[pc+1:pc+3])))
+		cond := c.condition(op)
+		s := c.settle()
+		c.finish(func(f *frames.Frame) int {
+			if s == nil {
+				if cond(f) {
+					return target
+				}
+				return next
+			}
+			if !s.fits(f) {
+				return interpretStatement
+			}
+			taken := cond(f)
+			s.apply(f)
+			if taken {
+				return target
+			}
+			return next
+		}, next)
+	case op == opcodes.GOTO:
+		target := pc + int(int16(binary.BigEndian.Uint16(code[pc+1:pc+3])))
+		s := c.settle()
+		c.finish(func(f *frames.Frame) int {
+			if s != nil {
+				if !s.fits(f) {
+					return interpretStatement
+				}
+				s.apply(f)
+			}
+			return target
+		}, next)
+
+	default:
+		return false
+	}
+	return true
+}
+
+// storeKind returns the kind of value stored by ISTORE, LSTORE, FSTORE, or DSTORE, which
+// are given as 0, 1, 2, or 3
+func storeKind(store byte) (frames.PrimSlot, bool) {
+	switch store {
+	case 0:
+		return frames.PrimInt, false
+	case 1:
+		return frames.PrimInt, true
+	case 2:
+		return frames.PrimFloat, false
+	default:
+		return frames.PrimFloat, true
+	}
+}
+
+// compileStore compiles an instruction that stores a value of the given kind in local
+// variable index, which ends the statement
+func (c *closureCompiler) compileStore(index int, kind frames.PrimSlot, wide bool, next int) {
+	value := c.operand(kind, wide).eval
+	s := c.settle()
+	if s == nil && !wide {
+		c.finish(func(f *frames.Frame) int {
+			storePrim(f, index, kind, value(f))
+			return next
+		}, next)
+		return
+	}
+	c.finish(func(f *frames.Frame) int {
+		if s != nil && !s.fits(f) {
+			return interpretStatement
+		}
+		v := value(f)
+		if s != nil {
+			s.apply(f)
+		}
+		storePrim(f, index, kind, v)
+		if wide { // longs and doubles are stored in two local variables
+			storePrim(f, index+1, kind, v)
+		}
+		return next
+	}, next)
+}
+
+// compileConversion compiles an instruction that converts a value from one type to another
+func (c *closureCompiler) compileConversion(op byte) {
+	var from, to frames.PrimSlot = frames.PrimInt, frames.PrimInt
+	fromWide, toWide := false, false
+	var convert func(int64) int64
+	switch op {
+	case opcodes.I2L: // ints are already 64-bits, so the value just takes up a second slot
+		toWide = true
+		convert = func(v int64) int64 { return v }
+	case opcodes.L2I:
+		fromWide = true
+		convert = func(v int64) int64 { return (v << 32) >> 32 }
+	case opcodes.I2F, opcodes.L2F:
+		fromWide, to = op == opcodes.L2F, frames.PrimFloat
+		convert = func(v int64) int64 { return floatBits(float64(float32(v))) }
+	case opcodes.I2D, opcodes.L2D:
+		fromWide, to, toWide = op == opcodes.L2D, frames.PrimFloat, true
+		convert = func(v int64) int64 { return floatBits(float64(v)) }
+	case opcodes.F2I, opcodes.D2I:
+		from, fromWide = frames.PrimFloat, op == opcodes.D2I
+		convert = func(v int64) int64 { return floatToInt(math.Float64frombits(uint64(v))) }
+	case opcodes.F2L, opcodes.D2L:
+		from, fromWide, toWide = frames.PrimFloat, op == opcodes.D2L, true
+		convert = func(v int64) int64 { return floatToLong(math.Float64frombits(uint64(v))) }
+	case opcodes.F2D:
+		from, to, toWide = frames.PrimFloat, frames.PrimFloat, true
+		convert = func(v int64) int64 { return v }
+	case opcodes.D2F:
+		from, fromWide, to = frames.PrimFloat, true, frames.PrimFloat
+		convert = func(v int64) int64 {
+			return floatBits(float64(float32(math.Float64frombits(uint64(v)))))
+		}
+	case opcodes.I2C: // Java chars are 16-bit unsigned values
+		convert = func(v int64) int64 { return int64(uint16(v)) }
+	case opcodes.I2S:
+		convert = func(v int64) int64 { return int64(int32(v)) }
+	}
+	a := c.operand(from, fromWide).eval
+	c.push(expr{eval: func(f *frames.Frame) int64 { return convert(a(f)) }, kind: to, wide: toWide})
+}
+
+// condition returns the closure that tests the condition of a conditional jump. The
+// comparisons are those the interpreter makes.
+func (c *closureCompiler) condition(op byte) func(f *frames.Frame) bool {
+	if op <= opcodes.IFLE { // compare an int with zero
+		a := c.operand(frames.PrimInt, false).eval
+		switch op {
+		case opcodes.IFEQ:
+			return func(f *frames.Frame) bool { return a(f) == 0 }
+		case opcodes.IFNE:
+			return func(f *frames.Frame) bool { return a(f) != 0 }
+		case opcodes.IFLT:
+			return func(f *frames.Frame) bool { return a(f) < 0 }
+		case opcodes.IFGE:
+			return func(f *frames.Frame) bool { return a(f) >= 0 }
+		case opcodes.IFGT:
+			return func(f *frames.Frame) bool { return a(f) > 0 }
+		default:
+			return func(f *frames.Frame) bool { return a(f) <= 0 }
+		}
+	}
+
+	b := c.operand(frames.PrimInt, false).eval
+	a := c.operand(frames.PrimInt, false).eval
+	switch op {
+	case opcodes.IF_ICMPEQ:
+		return func(f *frames.Frame) bool { return int32(a(f)) == int32(b(f)) }
+	case opcodes.IF_ICMPNE:
+		return func(f *frames.Frame) bool { return int32(a(f)) != int32(b(f)) }
+	case opcodes.IF_ICMPLT:
+		return func(f *frames.Frame) bool { return a(f) < b(f) }
+	case opcodes.IF_ICMPGE:
+		return func(f *frames.Frame) bool { return a(f) >= b(f) }
+	case opcodes.IF_ICMPGT:
+		return func(f *frames.Frame) bool { return int32(a(f)) > int32(b(f)) }
+	default:
+		return func(f *frames.Frame) bool { return a(f) <= b(f) }
+	}
+}
+
+// ---- the leaves and nodes of the trees ----
+
+// constExpr returns an expr that computes a constant, given as it's held in a slot
+func constExpr(kind frames.PrimSlot, wide bool, v int64) expr {
+	return expr{eval: func(*frames.Frame) int64 { return v }, kind: kind, wide: wide}
+}
+
+// floatConstExpr returns an expr that computes a float or double constant
+func floatConstExpr(wide bool, v float64) expr {
+	return constExpr(frames.PrimFloat, wide, floatBits(v))
+}
+
+// localIntExpr returns an expr that loads the int or long in local variable index
+func localIntExpr(index int, wide bool) expr {
+	return expr{eval: func(f *frames.Frame) int64 { return loadInt(f, index) }, kind: frames.PrimInt, wide: wide}
+}
+
+// localFloatExpr returns an expr that loads the float or double in local variable index
+func localFloatExpr(index int, wide bool) expr {
+	return expr{eval: func(f *frames.Frame) int64 { return floatBits(loadFloat(f, index)) },
+		kind: frames.PrimFloat, wide: wide}
+}
+
+// stackExpr returns an expr that reads the value depth slots below the top of the
+// operand stack. The statement that uses it has checked that the slot exists.
+func stackExpr(depth int, kind frames.PrimSlot, wide bool) expr {
+	return expr{eval: func(f *frames.Frame) int64 { return f.OpPrims[f.TOS-depth] }, kind: kind, wide: wide}
+}
+
+// intArithmetic returns the closure that computes a op b for an int or long operation
+func intArithmetic(op byte, a, b func(*frames.Frame) int64) func(*frames.Frame) int64 {
+	switch op {
+	case opcodes.IADD, opcodes.LADD:
+		return func(f *frames.Frame) int64 { return a(f) + b(f) }
+	case opcodes.ISUB, opcodes.LSUB:
+		return func(f *frames.Frame) int64 { return a(f) - b(f) }
+	case opcodes.IMUL, opcodes.LMUL:
+		return func(f *frames.Frame) int64 { return a(f) * b(f) }
+	case opcodes.IAND, opcodes.LAND:
+		return func(f *frames.Frame) int64 { return a(f) & b(f) }
+	case opcodes.IOR, opcodes.LOR:
+		return func(f *frames.Frame) int64 { return a(f) | b(f) }
+	default:
+		return func(f *frames.Frame) int64 { return a(f) ^ b(f) }
+	}
+}
+
+// floatArithmetic returns the closure that computes a op b for a float or double
+// operation. Floats are computed with 32-bit precision, as the interpreter does.
+func floatArithmetic(op byte, a, b func(*frames.Frame) int64) func(*frames.Frame) int64 {
+	float := func(eval func(*frames.Frame) int64, f *frames.Frame) float64 {
+		return math.Float64frombits(uint64(eval(f)))
+	}
+	single := func(eval func(*frames.Frame) int64, f *frames.Frame) float32 {
+		return float32(float(eval, f))
+	}
+	switch op {
+	case opcodes.FADD:
+		return func(f *frames.Frame) int64 { return floatBits(float64(single(a, f) + single(b, f))) }
+	case opcodes.FSUB:
+		return func(f *frames.Frame) int64 { return floatBits(float64(single(a, f) - single(b, f))) }
+	case opcodes.FMUL:
+		return func(f *frames.Frame) int64 { return floatBits(float64(single(a, f) * single(b, f))) }
+	case opcodes.FDIV:
+		return func(f *frames.Frame) int64 { return floatBits(float64(single(a, f) / single(b, f))) }
+	case opcodes.FREM:
+		return func(f *frames.Frame) int64 {
+			return floatBits(toFloat32(math.Mod(float64(single(a, f)), float64(single(b, f)))))
+		}
+	case opcodes.DADD:
+		return func(f *frames.Frame) int64 { return floatBits(float(a, f) + float(b, f)) }
+	case opcodes.DSUB:
+		return func(f *frames.Frame) int64 { return floatBits(float(a, f) - float(b, f)) }
+	case opcodes.DMUL:
+		return func(f *frames.Frame) int64 { return floatBits(float(a, f) * float(b, f)) }
+	default: // DDIV
+		return func(f *frames.Frame) int64 { return floatBits(divideDoubles(float(a, f), float(b, f))) }
+	}
+}
+
+// floatBits returns a float64 as it's held in a slot
+func floatBits(v float64) int64 {
+	return int64(math.Float64bits(v))
+}
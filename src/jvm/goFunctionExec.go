@@ -13,28 +13,65 @@ import (
 	"jacobin/classloader"
 	"jacobin/frames"
 	"jacobin/log"
+	"jacobin/object"
 	"strings"
 )
 
 // Similar to global tracing but just for this source file.
 var localDebugging bool = false
 
+// gException is returned by a golang function to throw a Java exception, which is
+// thrown in the method that called the function, so it can be caught there or in the
+// methods below it on the frame stack. (Errors returned by golang functions otherwise
+// end execution.) It's also returned by runMethodFromGo() for an exception that the
+// Java method it runs doesn't catch, in which case excObj is the exception itself and
+// frames are those it was thrown through, which are shown if it's never caught.
+type gException struct {
+	className string          // the class of the exception, such as java/lang/InterruptedException
+	msg       string          // the exception's detail message, if any
+	excObj    *object.Object  // the exception object, if it was thrown by Java code
+	frames    []*frames.Frame // the frames the exception object was thrown through
+}
+
+func (e *gException) Error() string {
+	return e.className + ": " + e.msg
+}
+
+// newGException returns a gException that throws an exception of class className
+func newGException(className, msg string) *gException {
+	return &gException{className: className, msg: msg}
+}
+
+// throwGException throws the exception that exc stands for in the method running in
+// the frame at the head of fs, and returns the frame in which execution resumes. If the
+// exception is not caught, an error is returned (see uncaughtException()).
+func throwGException(fs *list.List, exc *gException) (*frames.Frame, error) {
+	if exc.excObj == nil {
+		return throwJVMexception(fs, exc.className, exc.msg)
+	}
+	if catchFrame := throwException(fs, exc.excObj); catchFrame != nil {
+		return catchFrame, nil
+	}
+	return nil, uncaughtException(fs, exc.excObj, exc.frames)
+}
+
 // This function is called from run(). It executes a frame whose method is
 // a native method implemented in golang. It copies the parameters from the
 // operand stack and passes them to the golang function, called GFunction,
 // as an array of interface{}, which can be nil if there are no arguments.
 // Any return value from the method is returned to run() as an interface{}
 // (which is nil in the case of a void function), where it is placed
-// by run() on the operand stack of the calling function.
-func runGframe(fr *frames.Frame) (interface{}, int, error) {
-	if localDebugging || MainThread.Trace {
+// by run() on the operand stack of the calling function. fs is the frame stack
+// whose head is fr, which is passed to functions that need it (see GMeth).
+func runGframe(fs *list.List, fr *frames.Frame) (interface{}, int, error) {
+	if localDebugging || traced(fr) {
 		traceInfo := fmt.Sprintf("runGframe %s.%s, f.OpStack:", fr.ClName, fr.MethName)
 		_ = log.Log(traceInfo, log.WARNING)
 		logTraceStack(fr)
 	}
 
 	// get the go method from the MTable
-	me := classloader.MTable[fr.ClName+"."+fr.MethName]
+	me, _ := classloader.MTableFetch(fr.ClName + "." + fr.MethName)
 	if me.Meth == nil {
 		return nil, 0, errors.New("runGframe: go method not found: " +
 			fr.ClName + "." + fr.MethName)
@@ -42,22 +79,24 @@ func runGframe(fr *frames.Frame) (interface{}, int, error) {
 
 	// pull arguments for the function off the frame's operand stack and put them in a slice
 	var params = new([]interface{})
-	for _, v := range fr.OpStack {
-		*params = append(*params, v)
+	for i := range fr.OpStack {
+		*params = append(*params, slotValue(fr.OpStack[i], fr.OpPrims[i]))
 	}
 
-	// TODO Validate that a thread pointer is not needed.
-	// pass a pointer to the thread as the last parameter to the function;
-	// from the thread, the frame stack (and the individual frame) become accessible
-	// glob := globals.GetGlobalRef()
-	// thread := glob.Threads[fr.Thread]
-	// if thread != nil { // will be nil only in unit tests
-	//	threadPtr := thread.(*jvmThread.ExecThread)
-	//	*params = append(*params, threadPtr)
-	// }
+	// functions that act on the calling thread are passed its frame stack as the
+	// last parameter; from it, the thread and the individual frames are accessible
+	gmeth := me.Meth.(classloader.GMeth)
+	if gmeth.NeedsContext {
+		*params = append(*params, fs)
+	}
 
 	// call the function passing a pointer to the slice of arguments
-	ret := me.Meth.(classloader.GMeth).GFunction(*params)
+	ret := gmeth.GFunction(*params)
+
+	// a go function that fails returns an error, rather than a value to push
+	if err, ok := ret.(error); ok {
+		return nil, 0, err
+	}
 
 	// how many slots does the return value consume on the op stack?
 	// the last char in the method name indicates the data type of the return
@@ -90,7 +129,7 @@ func runGmethod(mt classloader.MTentry, fs *list.List, className, methodName, me
 
 	// Get the GMeth paramSlots value.
 	paramSlots := mt.Meth.(classloader.GMeth).ParamSlots
-	if localDebugging || MainThread.Trace {
+	if localDebugging || traced(f) {
 		traceInfo := fmt.Sprintf("runGmethod %s.%s%s, objectRef: %v, paramSlots: %d, f.OpStack:",
 			className, methodName, methodType, ObjectRef, paramSlots)
 		_ = log.Log(traceInfo, log.WARNING)
@@ -126,7 +165,7 @@ func runGmethod(mt classloader.MTentry, fs *list.List, className, methodName, me
 	// For each paramSlot, pop from the current frame and append it to argList.
 	for i := 0; i < npops; i++ {
 		arg := pop(f)
-		if localDebugging || MainThread.Trace {
+		if localDebugging || traced(f) {
 			traceInfo := fmt.Sprintf("runGmethod popped arg type=%T, value=%v", arg, arg)
 			_ = log.Log(traceInfo, log.WARNING)
 		}
@@ -145,7 +184,7 @@ func runGmethod(mt classloader.MTentry, fs *list.List, className, methodName, me
 
 	// Set the Go frame TOS = parent frame TOS.
 	gf.TOS = len(gf.OpStack) - 1
-	if localDebugging || MainThread.Trace {
+	if localDebugging || traced(gf) {
 		_ = log.Log("runGmethod G method OpStack:", log.WARNING)
 		logTraceStack(gf)
 	}
@@ -155,7 +194,16 @@ func runGmethod(mt classloader.MTentry, fs *list.List, className, methodName, me
 	f = fs.Front().Value.(*frames.Frame) // point f to the new head
 
 	// then run the frame, which will call run(), which will eventually call runGFrame()
+	// a Java exception thrown by the function is passed on to the caller to throw, after
+	// the function's frame is popped off
 	err := runFrame(fs)
+	if exc, ok := err.(*gException); ok {
+		if exc.excObj != nil {
+			exc.frames = append(exc.frames, f)
+		}
+		fs.Remove(fs.Front())
+		return nil, err
+	}
 	if err != nil {
 		_ = log.Log("Error: "+err.Error(), log.SEVERE)
 		return nil, err
@@ -13,7 +13,9 @@ import (
 	"jacobin/classloader"
 	"jacobin/frames"
 	"jacobin/log"
+	"jacobin/object"
 	"jacobin/types"
+	"sync"
 )
 
 // Initialization blocks are code blocks that for all intents are methods. They're gathered up by the
@@ -22,59 +24,171 @@ import (
 // just like a regular method with stack frames and depending on the interpreter in run.go
 // In addition, we have to make sure that the initialization blocks of superclasses have been
 // previously executed.
-func runInitializationBlock(k *classloader.Klass, superClasses []string, fs *list.List) error {
-	if superClasses == nil || len(superClasses) == 0 {
-		// show we're running <clinit>. This prevents circularity errors.
-		k.Data.ClInit = types.ClInitInProgress
+//
+// A class is initialized by one thread only, as the JVM spec requires (JVMS §5.5). The
+// thread that finds the class not yet initialized marks it as in progress and runs its
+// initializer. Another thread that uses the class in the meantime waits until the
+// initialization ends, in success or failure, while the thread that's initializing the
+// class, which can use the class again from its initializer, goes on at once.
+
+// classInit is the state of an initialization in progress
+type classInit struct {
+	owner int        // the ID of the thread that's initializing the class
+	ended *sync.Cond // broadcast when the initialization ends
+}
+
+// classInits holds the initializations in progress, keyed by class. classInitsMutex
+// guards it and the initialization state (ClInit) of every class.
+var classInits = make(map[*classloader.Klass]*classInit)
+var classInitsMutex sync.Mutex
+
+// runInitializationBlock initializes the class k, if it hasn't been initialized, on the
+// thread whose frame stack is fs. superClasses, if not empty, holds k and the superclasses
+// it has other than java.lang.Object, whose initializers are run first.
+func runInitializationBlock(k *classloader.Klass, superClasses []*classloader.Klass, fs *list.List) error {
+	thread := initThreadID(fs)
+	if run, err := beginClassInit(k, thread); !run {
+		return err
+	}
 
+	if superClasses == nil || len(superClasses) == 0 {
 		// if no superclasses were previously looked up
 		// get list of the superclasses up to but not including java.lang.Object
-		var superclasses []string
+		var superclasses []*classloader.Klass
 
 		// put the present class at the bottom of the list of superclasses,
 		// because we'll need to run its clinit() code, if any
-		superclasses = append(superclasses, k.Data.Name)
+		superclasses = append(superclasses, k)
 
-		superclass := k.Data.Superclass
+		// the superclasses are those that the class's defining loader sees
+		subclass, superclass := k, k.Data.Superclass
 		for {
 			if superclass == "java/lang/Object" {
 				break
 			}
 
-			err := loadThisClass(superclass) // load the superclass
-			if err != nil {                  // error message will have been displayed
+			// load the superclass. If it can't be loaded, the error will have been displayed.
+			loadedSuperclass, err := loadSuperclass(subclass, superclass)
+			if err != nil {
+				endClassInit(k, types.ClInitFailed)
 				return err
 			}
-
-			// load only superclasses that have a clInit block that has not been run
-			loadedSuperclass := classloader.MethAreaFetch(superclass)
-			if loadedSuperclass.Data.ClInit == types.ClInitNotRun {
-				superclasses = append(superclasses, superclass)
-			}
+			superclasses = append(superclasses, loadedSuperclass)
 
 			// now loop to see whether this superclass has a superclass
-			superclass = loadedSuperclass.Data.Superclass
+			subclass, superclass = loadedSuperclass, loadedSuperclass.Data.Superclass
 		}
 		superClasses = superclasses
 	}
 
-	// now execute any encountered <clinit> code in this class
+	// now initialize the superclasses, starting with the topmost one. A class whose
+	// superclass failed to initialize can't be initialized either.
 	for i := len(superClasses) - 1; i >= 0; i-- {
-		className := superClasses[i]
-		me, err := classloader.FetchMethodAndCP(className, "<clinit>", "()V")
-		if err == nil {
-			switch me.MType {
-			case 'J': // it's a Java initializer (the most common case)
-				err = runJavaInitializer(me.Meth, k, fs)
-			case 'G': // it's a golang implementation of the initializer
-				err = runNativeInitializer(me, k, fs)
-			}
-			if err != nil {
-				return err
-			}
-		} // if no <clinit> method, then skip that superclass
+		class := superClasses[i]
+		if class == k {
+			continue
+		}
+		run, err := beginClassInit(class, thread)
+		if run {
+			err = runClassInitializer(class, fs)
+		}
+		if err != nil {
+			endClassInit(k, types.ClInitFailed)
+			return err
+		}
+	}
+	return runClassInitializer(k, fs)
+}
+
+// initThreadID returns the ID of the thread whose frame stack is fs, as the owner of the
+// initializations it runs. Frames created outside of a thread run on the main thread, as
+// do the initializers run on a frame stack of their own, so the main thread's ID is 0.
+func initThreadID(fs *list.List) int {
+	if fs == nil || fs.Len() == 0 {
+		return 0
+	}
+	if id := fs.Front().Value.(*frames.Frame).Thread; !isMainThread(id) {
+		return id
+	}
+	return 0
+}
+
+// beginClassInit begins the initialization of the class k by the thread whose ID is
+// thread (see initThreadID()), waiting first for another thread that's initializing it.
+// It returns true if the thread is to run the class's initializer. Otherwise, the class
+// has been initialized, is being initialized by the thread, or has no initializer; or
+// its initialization failed, in which case the error to throw is returned.
+func beginClassInit(k *classloader.Klass, thread int) (bool, error) {
+	classInitsMutex.Lock()
+	defer classInitsMutex.Unlock()
+
+	for k.Data.ClInit == types.ClInitInProgress {
+		init := classInits[k]
+		if init == nil || init.owner == thread {
+			break
+		}
+		if object.Yield != nil { // the thread that's initializing the class must be given the turn
+			classInitsMutex.Unlock()
+			object.Yield(thread)
+			classInitsMutex.Lock()
+			continue
+		}
+		init.ended.Wait()
+	}
+
+	switch k.Data.ClInit {
+	case types.ClInitNotRun:
+		k.Data.ClInit = types.ClInitInProgress
+		classInits[k] = &classInit{owner: thread, ended: sync.NewCond(&classInitsMutex)}
+		return true, nil
+	case types.ClInitFailed:
+		return false, classInitFailedError(k)
+	}
+	return false, nil
+}
+
+// endClassInit ends the initialization of the class k, whose state is then state, and
+// wakes the threads waiting for it
+func endClassInit(k *classloader.Klass, state byte) {
+	classInitsMutex.Lock()
+	defer classInitsMutex.Unlock()
+
+	k.Data.ClInit = state
+	if init := classInits[k]; init != nil {
+		delete(classInits, k)
+		init.ended.Broadcast()
 	}
-	return nil
+}
+
+// classInitState returns the initialization state (ClInit) of the class k
+func classInitState(k *classloader.Klass) byte {
+	classInitsMutex.Lock()
+	defer classInitsMutex.Unlock()
+	return k.Data.ClInit
+}
+
+// runClassInitializer runs the <clinit> of the class class, whose initialization this
+// thread has begun, and ends the initialization. The class is erroneous if an exception
+// is thrown out of the initializer, which is returned as an initializerError.
+func runClassInitializer(class *classloader.Klass, fs *list.List) error {
+	me, err := classloader.FetchKlassMethod(class, "<clinit>", "()V")
+	if err != nil { // if no <clinit> method, then there's nothing to run
+		endClassInit(class, types.ClInitRun)
+		return nil
+	}
+
+	switch me.MType {
+	case 'J': // it's a Java initializer (the most common case)
+		err = runJavaInitializer(me.Meth, class, fs)
+	case 'G': // it's a golang implementation of the initializer
+		err = runNativeInitializer(me, class, fs)
+	}
+	if _, ok := err.(*initializerError); ok {
+		endClassInit(class, types.ClInitFailed)
+	} else {
+		endClassInit(class, types.ClInitRun) // flag showing we've run this class's <clinit>
+	}
+	return err
 }
 
 // Run the <clinit>() initializer code as a Java method. This effectively duplicates
@@ -87,31 +201,38 @@ func runJavaInitializer(m classloader.MData, k *classloader.Klass, fs *list.List
 	meth := m.(classloader.JmEntry)
 	f := frames.CreateFrame(meth.MaxStack + 2) // create a new frame (adding 2 b/c of unexplained bytecode needs)
 	f.MethName = "<clinit>"
+	f.MethType = "()V"
 	f.ClName = k.Data.Name
-	f.CP = meth.Cp                        // add its pointer to the class CP
-	f.Meth = append(f.Meth, meth.Code...) // copy the bytecodes over
+	f.Loader = meth.Loader
+	f.CP = meth.Cp     // add its pointer to the class CP
+	f.Meth = meth.Code // the bytecodes, which are shared by all frames of the method
+	if fs.Len() > 0 {
+		f.Thread = fs.Front().Value.(*frames.Frame).Thread
+	}
 
 	// allocate the local variables
 	for j := 0; j < meth.MaxLocals; j++ {
 		f.Locals = append(f.Locals, 0)
 	}
 
-	k.Data.ClInit = types.ClInitInProgress
-
 	if frames.PushFrame(fs, f) != nil {
 		errMsg := "memory exception allocating frame in runJavaInitializer()"
 		_ = log.Log(errMsg, log.SEVERE)
 		return errors.New(errMsg)
 	}
 
-	if MainThread.Trace {
+	if traced(f) {
 		traceInfo := fmt.Sprintf("Start init: class=%s, meth=%s, maxStack=%d, maxLocals=%d, code size=%d",
 			f.ClName, f.MethName, meth.MaxStack, meth.MaxLocals, len(meth.Code))
 		_ = log.Log(traceInfo, log.TRACE_INST)
 	}
 
 	err := runFrame(fs)
-	k.Data.ClInit = types.ClInitRun // flag showing we've run this class's <clinit>
+	if _, ok := err.(*initializerError); ok {
+		// an exception was thrown out of <clinit>, so the class can't be used
+		frames.PopFrame(fs)
+		return err
+	}
 	if err != nil {
 		return err
 	}
@@ -122,6 +243,5 @@ func runJavaInitializer(m classloader.MData, k *classloader.Klass, fs *list.List
 
 func runNativeInitializer(mt classloader.MTentry, k *classloader.Klass, fs *list.List) error {
 	runGmethod(mt, fs, k.Data.Name, "<clinit>", "()V")
-	k.Data.ClInit = types.ClInitRun // flag showing we've run this class's <clinit>
 	return nil
 }
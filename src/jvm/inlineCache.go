@@ -0,0 +1,153 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"fmt"
+	"jacobin/classloader"
+	"jacobin/frames"
+	"jacobin/log"
+	"jacobin/object"
+	"jacobin/opcodes"
+	"sync"
+	"sync/atomic"
+)
+
+// The method that INVOKEVIRTUAL and INVOKEINTERFACE execute is selected by the class of
+// the object the method is called on (the receiver), which takes a vtable or itable
+// lookup and then a search of the MTable. At most call sites, though, the receiver is
+// always of the same class (the site is monomorphic) or of one of a few classes (it's
+// polymorphic). So each of these call sites has an inline cache,
+// which holds the methods selected for the receiver classes the site has seen. When the
+// receiver is of one of those classes, the method is taken from the cache. The classes
+// are compared by identity rather than name, as several loaders can define classes of
+// the same name.
+//
+// The selection depends only on the classes in the method area, so the entries of an
+// inline cache are valid only as long as no class is added to it. Each cache records
+// the version of the method area (see classloader.MethAreaVersion()) its entries were
+// selected in, and when the version changes, the entries are dropped.
+//
+// The hits and misses of every inline cache are counted and are logged at the end of
+// the program when the logging level is FINEST (-verbose:finest).
+
+// inlineCacheSize is the number of receiver classes an inline cache holds. A call site
+// that sees more classes than this is megamorphic: its cache keeps the first classes it
+// saw and calls on objects of the other classes always select the method.
+const inlineCacheSize = 4
+
+// inlineCache is the inline cache of one call site. It's created when the site's
+// instruction is quickened and is held in the instruction's resolvedOp.
+type inlineCache struct {
+	site       string // the call site and the method it calls, for the statistics
+	paramSlots int    // the number of operand-stack slots taken by the method's parameters
+	state      atomic.Pointer[icState]
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+}
+
+// icState is the contents of an inline cache. It's never modified once it's in the
+// cache: adding an entry replaces it with a new icState.
+type icState struct {
+	version uint64 // the method area version in which the entries were selected
+	entries []icEntry
+}
+
+// icEntry is the method selected for calls on objects of one receiver class
+type icEntry struct {
+	receiver *classloader.Klass  // the receiver's class
+	clName   string              // the class whose version of the method is executed
+	mtEntry  classloader.MTentry // the method
+}
+
+// inlineCaches holds all the inline caches created so far, for the statistics
+var inlineCaches []*inlineCache
+var inlineCachesMutex sync.Mutex
+
+// newInlineCache returns an inline cache for the call site at pc in the method executing
+// in frame f, which calls className.methName+methType
+func newInlineCache(f *frames.Frame, pc int, className, methName, methType string) *inlineCache {
+	return &inlineCache{
+		site: fmt.Sprintf("%s.%s%s PC %d (%s) -> %s.%s%s", f.ClName, f.MethName, f.MethType, pc,
+			opcodes.BytecodeNames[int(f.Meth[pc])], className, methName, methType),
+		paramSlots: countParamSlots(methType),
+	}
+}
+
+// registerInlineCache adds an inline cache to those whose statistics are logged. It's
+// called once the cache's instruction is quickened.
+func registerInlineCache(ic *inlineCache) {
+	inlineCachesMutex.Lock()
+	inlineCaches = append(inlineCaches, ic)
+	inlineCachesMutex.Unlock()
+}
+
+// receiverClass returns the class of the object at index objIndex of the operand stack
+// of frame f, or false if there's no object there whose class is known
+func receiverClass(f *frames.Frame, objIndex int) (*classloader.Klass, bool) {
+	if objIndex < 0 || objIndex > f.TOS {
+		return nil, false
+	}
+	obj, ok := f.OpStack[objIndex].(*object.Object)
+	if !ok || object.IsNull(obj) {
+		return nil, false
+	}
+	k := classloader.ObjectKlass(obj)
+	return k, k != nil
+}
+
+// lookup returns the cached entry for receiver objects of class receiver, if there is one,
+// and counts the hit or miss
+func (ic *inlineCache) lookup(receiver *classloader.Klass) (icEntry, bool) {
+	if s := ic.state.Load(); s != nil && s.version == classloader.MethAreaVersion() {
+		for _, e := range s.entries {
+			if e.receiver == receiver {
+				ic.hits.Add(1)
+				return e, true
+			}
+		}
+	}
+	ic.misses.Add(1)
+	return icEntry{}, false
+}
+
+// add caches the method selected for receiver objects of class receiver in method area
+// version version, which the caller gets before selecting the method: if a class is
+// loaded during the selection, the entry is dropped at the next lookup. If the cache is
+// full, it's left as is. Two threads adding entries at the same time might lose one of
+// them, in which case it will be added the next time it's missed.
+func (ic *inlineCache) add(version uint64, receiver *classloader.Klass, clName string,
+	mtEntry classloader.MTentry) {
+	var entries []icEntry
+	if s := ic.state.Load(); s != nil && s.version == version {
+		if len(s.entries) >= inlineCacheSize {
+			return
+		}
+		entries = make([]icEntry, len(s.entries), len(s.entries)+1)
+		copy(entries, s.entries)
+	}
+	entries = append(entries, icEntry{receiver: receiver, clName: clName, mtEntry: mtEntry})
+	ic.state.Store(&icState{version: version, entries: entries})
+}
+
+// logInlineCacheStats logs the hits and misses of every inline cache, when the logging
+// level is FINEST. It's called when the program ends.
+func logInlineCacheStats() {
+	if log.Level < log.FINEST {
+		return
+	}
+	inlineCachesMutex.Lock()
+	defer inlineCachesMutex.Unlock()
+	for _, ic := range inlineCaches {
+		classes := 0
+		if s := ic.state.Load(); s != nil {
+			classes = len(s.entries)
+		}
+		_ = log.Log(fmt.Sprintf("Inline cache: %s: %d hits, %d misses, %d receiver classes",
+			ic.site, ic.hits.Load(), ic.misses.Load(), classes), log.FINEST)
+	}
+}
@@ -40,10 +40,6 @@ func InstantiateClass(classname string, frameStack *list.List) (*object.Object,
 
 	// At this point, classname is ready
 	k := classloader.MethAreaFetch(classname)
-	obj := object.Object{
-		Klass: &classname,
-	}
-
 	if k == nil {
 		errMsg := "Class is nil after loading, class: " + classname
 		_ = log.Log(errMsg, log.SEVERE)
@@ -56,9 +52,48 @@ func InstantiateClass(classname string, frameStack *list.List) (*object.Object,
 		return nil, errors.New(errMsg)
 	}
 
+	obj, err := instantiateKlass(k, frameStack)
+	if obj != nil && k.Data.Name != classname {
+		// some classes, such as the synthetic classes of arrays, don't bear the name
+		// they're found under, which their objects keep
+		obj.Klass = &classname
+	}
+	return obj, err
+}
+
+// instantiateClassFor creates an object of the class named classname, as the loader
+// named loader sees it. For the built-in loaders, that's the class InstantiateClass()
+// creates an object of.
+func instantiateClassFor(loader, classname string, frameStack *list.List) (*object.Object, error) {
+	if !classloader.IsUserLoader(loader) {
+		return InstantiateClass(classname, frameStack)
+	}
+	k := fetchClassFor(loader, classname)
+	if k == nil || k.Data == nil {
+		errMsg := fmt.Sprintf("instantiateClass: Failed to load class %s with loader %s", classname, loader)
+		_ = log.Log(errMsg, log.SEVERE)
+		return nil, errors.New(errMsg)
+	}
+	return instantiateKlass(k, frameStack)
+}
+
+// instantiateKlass creates an object of the class k, which is loaded, running the
+// class's static initializer if it has not run yet. The object's Klass field points
+// to the name in the class's data, which identifies the class (see
+// classloader.ObjectKlass()). The superclasses of k are those that its defining loader
+// sees.
+func instantiateKlass(k *classloader.Klass, frameStack *list.List) (*object.Object, error) {
+	classname := k.Data.Name
+	if classname == "java/lang/String" {
+		return object.NewString(), nil
+	}
+	obj := object.Object{
+		Klass: &k.Data.Name,
+	}
+
 	// go up the chain of superclasses until we hit java/lang/Object
-	superclasses := []string{}
-	superclass := k.Data.Superclass
+	superclasses := []*classloader.Klass{}
+	subclass, superclass := k, k.Data.Superclass
 	for {
 		// if the present class is Object, it has no superclass. If the present
 		// class's superclass is Object, we've reached the top of the superclass
@@ -67,16 +102,15 @@ func InstantiateClass(classname string, frameStack *list.List) (*object.Object,
 			break
 		}
 
-		err := loadThisClass(superclass) // load the superclass
-		if err != nil {                  // error message will have been displayed
+		// load the superclass. If it can't be loaded, the error will have been displayed.
+		loadedSuperclass, err := loadSuperclass(subclass, superclass)
+		if err != nil {
 			return nil, err
-		} else {
-			superclasses = append(superclasses, superclass)
 		}
+		superclasses = append(superclasses, loadedSuperclass)
 
-		loadedSuperclass := classloader.MethAreaFetch(superclass)
 		// now loop to see whether this superclass has a superclass
-		superclass = loadedSuperclass.Data.Superclass
+		subclass, superclass = loadedSuperclass, loadedSuperclass.Data.Superclass
 	}
 
 	// the object's mark field contains the lower 32-bits of the object's
@@ -108,7 +142,7 @@ func InstantiateClass(classname string, frameStack *list.List) (*object.Object,
 				_ = log.Log(reciteField, log.FINE)
 			}
 
-			fieldToAdd, err := createField(f, k, classname)
+			fieldToAdd, err := createField(f, k, k)
 			if err != nil {
 				return nil, err
 			}
@@ -126,16 +160,9 @@ func InstantiateClass(classname string, frameStack *list.List) (*object.Object,
 	// and work our way down to the present class, adding fields to FieldTable.
 	// so we add the present class into position[0] and then loop through
 	// the slice of class names
-	superclasses = append([]string{classname}, superclasses...)
+	superclasses = append([]*classloader.Klass{k}, superclasses...)
 	for j := len(superclasses) - 1; j >= 0; j-- {
-		superclassName := superclasses[j]
-		c := classloader.MethAreaFetch(superclassName)
-		if c == nil {
-			errMsg := fmt.Sprintf("Error in class instantiation, cannot find superclass: %s",
-				superclassName)
-			_ = log.Log(errMsg, log.SEVERE)
-			return nil, errors.New(errMsg)
-		}
+		c := superclasses[j]
 		for i := 0; i < len(c.Data.Fields); i++ {
 			f := c.Data.Fields[i]
 			desc := c.Data.CP.Utf8Refs[f.Desc]
@@ -146,7 +173,7 @@ func InstantiateClass(classname string, frameStack *list.List) (*object.Object,
 				_ = log.Log(reciteField, log.FINE)
 			}
 
-			fieldToAdd, err := createField(f, c, classname)
+			fieldToAdd, err := createField(f, c, k)
 			if err != nil {
 				return nil, err
 			}
@@ -158,21 +185,23 @@ func InstantiateClass(classname string, frameStack *list.List) (*object.Object,
 
 runInitializer:
 	// run intialization blocks
-	_, ok := k.Data.MethodTable["<clinit>()V"]
-	if ok && k.Data.ClInit == types.ClInitNotRun {
-		err := runInitializationBlock(k, superclasses, frameStack)
-		if err != nil {
-			errMsg := fmt.Sprintf("error encountered running %s.<clinit>()", classname)
-			_ = log.Log(errMsg, log.SEVERE)
+	if err := runInitializationBlock(k, superclasses, frameStack); err != nil {
+		if isInitializationError(err) { // it's thrown by the code that instantiated the class
 			return nil, err
 		}
+		errMsg := fmt.Sprintf("error encountered running %s.<clinit>()", classname)
+		_ = log.Log(errMsg, log.SEVERE)
+		return nil, err
 	}
 
 	return &obj, nil
 }
 
-// creates a field for insertion into the object representation
-func createField(f classloader.Field, k *classloader.Klass, classname string) (*object.Field, error) {
+// creates a field for insertion into the object representation. k is the class that
+// declares the field, and instantiated the class being instantiated, under whose name
+// a static field is placed in the Statics table.
+func createField(f classloader.Field, k *classloader.Klass, instantiated *classloader.Klass) (*object.Field, error) {
+	classname := instantiated.Data.Name
 	desc := k.Data.CP.Utf8Refs[f.Desc]
 	name := k.Data.CP.Utf8Refs[f.Name]
 	if log.Level == log.FINE {
@@ -244,16 +273,32 @@ func createField(f classloader.Field, k *classloader.Klass, classname string) (*
 		}
 		// add the field to the Statics table
 		fieldName := k.Data.CP.Utf8Refs[f.Name]
-		fullFieldName := classname + "." + fieldName
+		fullFieldName := classloader.QualifiedName(instantiated.Loader, classname) + "." + fieldName
 
-		_, alreadyPresent := classloader.Statics[fullFieldName]
-		if !alreadyPresent { // add only if field has not been pre-loaded
-			_ = classloader.AddStatic(fullFieldName, s)
-		}
+		// add only if field has not been pre-loaded
+		classloader.AddStaticIfAbsent(fullFieldName, s)
 	}
 	return fieldToAdd, nil
 }
 
+// loadSuperclass returns the superclass of the class k, which is named superclass, as
+// k's defining loader sees it, loading it if need be
+func loadSuperclass(k *classloader.Klass, superclass string) (*classloader.Klass, error) {
+	if !classloader.IsUserLoader(k.Loader) {
+		if err := loadThisClass(superclass); err != nil {
+			return nil, err
+		}
+		return classloader.MethAreaFetch(superclass), nil
+	}
+	loaded := fetchClassFor(k.Loader, superclass)
+	if loaded == nil || loaded.Data == nil {
+		errMsg := fmt.Sprintf("instantiateClass: Failed to load class %s with loader %s", superclass, k.Loader)
+		_ = log.Log(errMsg, log.SEVERE)
+		return nil, errors.New(errMsg)
+	}
+	return loaded, nil
+}
+
 // Loads the class (if it's not already loaded) and makes sure it's accessible in the method area
 func loadThisClass(className string) error {
 	alreadyLoaded := classloader.MethAreaFetch(className)
@@ -0,0 +1,225 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"errors"
+	"fmt"
+	"jacobin/classloader"
+	"jacobin/exceptions"
+)
+
+// Selecting the method to run for an INVOKEINTERFACE call follows JVMS 5.4.6:
+// first the class of the object and its superclasses are searched for an instance
+// method with the name and type of the interface method. If none is found, the
+// superinterfaces of the class are searched for the maximally-specific default
+// method--that is, a non-abstract method declared in an interface that has no
+// subinterface among the class's superinterfaces that also declares the method.
+// The selected method is cached in the itable of the object's class. The same
+// search, minus the itable, is used for the targets of lambdas and method references.
+
+// selectInterfaceMethod finds the method to execute when the interface method
+// methName+methType of the interface intf is called on an object of class k. If no
+// method can be selected, the returned int holds the exception to throw, and the
+// error describes the problem.
+func selectInterfaceMethod(k, intf *classloader.Klass, methName, methType string) (classloader.ITentry, int, error) {
+	if k == nil || k.Data == nil || intf == nil || intf.Data == nil {
+		errMsg := fmt.Sprintf("Class or interface not found for interface method %s", methName+methType)
+		return classloader.ITentry{}, exceptions.IncompatibleClassChangeError, errors.New(errMsg)
+	}
+
+	methFQN := classloader.QualifiedName(intf.Loader, intf.Data.Name) + "." + methName + methType
+	if entry, ok := classloader.ITableFetch(k, methFQN); ok {
+		return entry, 0, nil
+	}
+
+	if !implementsInterface(k, intf) {
+		errMsg := fmt.Sprintf("Class %s does not implement the requested interface %s",
+			k.Data.Name, intf.Data.Name)
+		return classloader.ITentry{}, exceptions.IncompatibleClassChangeError, errors.New(errMsg)
+	}
+
+	entry, excType, err := selectMethod(k, methName, methType)
+	if err != nil {
+		if excType == exceptions.AbstractMethodError {
+			errMsg := fmt.Sprintf("Receiver class %s does not define or inherit an "+
+				"implementation of the resolved method 'abstract %s' of interface %s.",
+				k.Data.Name, methName+methType, intf.Data.Name)
+			err = errors.New(errMsg)
+		}
+		return classloader.ITentry{}, excType, err
+	}
+	classloader.ITableInsert(k, methFQN, entry)
+	return entry, 0, nil
+}
+
+// selectMethod finds the method that's executed when an instance method
+// methName+methType is called on an object of class k: either the method
+// in the class or its nearest superclass that declares it or, failing that, the
+// maximally-specific default method in the class's superinterfaces. If no method
+// can be selected, the returned int holds the exception to throw. The superclasses
+// and superinterfaces of a class are those its defining loader sees.
+func selectMethod(k *classloader.Klass, methName, methType string) (classloader.ITentry, int, error) {
+	if k == nil || k.Data == nil {
+		errMsg := fmt.Sprintf("Receiver class of the resolved method '%s' not found.", methName+methType)
+		return classloader.ITentry{}, exceptions.AbstractMethodError, errors.New(errMsg)
+	}
+
+	// first search the class and its superclasses
+	methSig := methName + methType
+	for c := k; c != nil && c.Data != nil; {
+		entry, found, isAbstract := findInstanceMethod(c, methName, methType)
+		if found {
+			if isAbstract {
+				errMsg := fmt.Sprintf("Receiver class %s does not define or inherit an "+
+					"implementation of the resolved method 'abstract %s'.", k.Data.Name, methSig)
+				return classloader.ITentry{}, exceptions.AbstractMethodError, errors.New(errMsg)
+			}
+			return entry, 0, nil
+		}
+		if c.Data.Superclass == "" {
+			break
+		}
+		c = fetchClassFor(c.Loader, c.Data.Superclass)
+	}
+
+	// then look for the maximally-specific default method in the superinterfaces
+	var candidates []*classloader.Klass
+	for _, intf := range getSuperinterfaces(k) {
+		if _, found, _ := findInstanceMethod(intf, methName, methType); found {
+			candidates = append(candidates, intf)
+		}
+	}
+
+	var defaults []classloader.ITentry
+	for _, candidate := range candidates {
+		if isOverriddenByCandidate(candidate, candidates) {
+			continue
+		}
+		entry, _, isAbstract := findInstanceMethod(candidate, methName, methType)
+		if !isAbstract {
+			defaults = append(defaults, entry)
+		}
+	}
+
+	switch len(defaults) {
+	case 1:
+		return defaults[0], 0, nil
+	case 0:
+		errMsg := fmt.Sprintf("Receiver class %s does not define or inherit an "+
+			"implementation of the resolved method 'abstract %s'.", k.Data.Name, methSig)
+		return classloader.ITentry{}, exceptions.AbstractMethodError, errors.New(errMsg)
+	default:
+		errMsg := fmt.Sprintf("Conflicting default methods: %s.%s and %s.%s",
+			defaults[0].ClName, methSig, defaults[1].ClName, methSig)
+		return classloader.ITentry{}, exceptions.IncompatibleClassChangeError, errors.New(errMsg)
+	}
+}
+
+// selectionErrorClass returns the class of the exception whose type is excType, as
+// returned by selectMethod() and selectInterfaceMethod(), so that it can be thrown
+func selectionErrorClass(excType int) string {
+	switch excType {
+	case exceptions.AbstractMethodError:
+		return "java/lang/AbstractMethodError"
+	case exceptions.IncompatibleClassChangeError:
+		return "java/lang/IncompatibleClassChangeError"
+	}
+	return "java/lang/LinkageError"
+}
+
+// findInstanceMethod looks for a non-static, non-private method methName+methType
+// declared in the class k. found reports whether such a method exists, and isAbstract
+// whether it's abstract. For non-abstract methods, the MTable entry is returned in an
+// ITentry.
+func findInstanceMethod(k *classloader.Klass, methName, methType string) (
+	entry classloader.ITentry, found bool, isAbstract bool) {
+
+	if k == nil || k.Data == nil {
+		return classloader.ITentry{}, false, false
+	}
+	clName := k.Data.Name
+
+	// methods implemented in Go are found only in the MTable
+	mtEntry, ok := classloader.MTableFetch(classloader.QualifiedName(k.Loader, clName) + "." + methName + methType)
+	if ok && mtEntry.MType == 'G' {
+		return classloader.ITentry{ClName: clName, Meth: mtEntry}, true, false
+	}
+
+	m, ok := k.Data.MethodTable[methName+methType]
+	if !ok || m.AccessFlags&0x000A != 0 { // 0x0008 = static, 0x0002 = private
+		return classloader.ITentry{}, false, false
+	}
+
+	if m.AccessFlags&0x0400 != 0 { // 0x0400 = abstract
+		return classloader.ITentry{}, true, true
+	}
+
+	mtEntry, err := classloader.FetchKlassMethod(k, methName, methType)
+	if err != nil || mtEntry.Meth == nil {
+		return classloader.ITentry{}, false, false
+	}
+	return classloader.ITentry{ClName: clName, Meth: mtEntry}, true, false
+}
+
+// getSuperinterfaces returns all the interfaces implemented by the class k, including
+// those implemented by its superclasses and those extended by other interfaces, as
+// the defining loaders of the classes that name them see them. If k is itself an
+// interface, it's not included.
+func getSuperinterfaces(k *classloader.Klass) []*classloader.Klass {
+	var superinterfaces []*classloader.Klass
+	seen := make(map[*classloader.Klass]bool)
+
+	var addInterfaces func(c *classloader.Klass)
+	addInterfaces = func(c *classloader.Klass) {
+		for _, index := range c.Data.Interfaces {
+			if int(index) >= len(c.Data.CP.Utf8Refs) {
+				continue
+			}
+			intf := fetchClassFor(c.Loader, c.Data.CP.Utf8Refs[index])
+			if intf == nil || intf.Data == nil || seen[intf] {
+				continue
+			}
+			seen[intf] = true
+			superinterfaces = append(superinterfaces, intf)
+			addInterfaces(intf)
+		}
+	}
+
+	for c := k; c != nil && c.Data != nil; {
+		addInterfaces(c)
+		if c.Data.Superclass == "" {
+			break
+		}
+		c = fetchClassFor(c.Loader, c.Data.Superclass)
+	}
+	return superinterfaces
+}
+
+// implementsInterface reports whether the class k implements the interface intf.
+func implementsInterface(k, intf *classloader.Klass) bool {
+	if k == intf {
+		return true
+	}
+	for _, superinterface := range getSuperinterfaces(k) {
+		if superinterface == intf {
+			return true
+		}
+	}
+	return false
+}
+
+// isOverriddenByCandidate reports whether one of the other candidate interfaces is
+// a subinterface of intf, in which case intf's method is not maximally specific.
+func isOverriddenByCandidate(intf *classloader.Klass, candidates []*classloader.Klass) bool {
+	for _, other := range candidates {
+		if other != intf && implementsInterface(other, intf) {
+			return true
+		}
+	}
+	return false
+}
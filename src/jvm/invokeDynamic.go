@@ -0,0 +1,439 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"jacobin/classloader"
+	"jacobin/frames"
+	"jacobin/log"
+	"jacobin/object"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// INVOKEDYNAMIC calls a method that's determined at run time by a bootstrap method.
+// The first time an invokedynamic instruction (a "call site") is executed, the bootstrap
+// method specified in the class's BootstrapMethods attribute is run to link the call
+// site to its target. The target is then cached, so that subsequent executions of the
+// same instruction go directly to it.
+//
+// Rather than running the bootstrap methods in java.lang.invoke, which would require a
+// full implementation of method handles, Jacobin recognizes the bootstrap methods that
+// javac generates and links the call site to a golang function that does the same work.
+// The first of these is StringConcatFactory, which javac (9 and later) uses for every
+// string concatenation done with +. The second is LambdaMetafactory, which javac uses
+// for lambdas and method references (see lambdas.go).
+
+// callSiteTarget is the function that an invokedynamic call site is linked to. It pops
+// its arguments off the operand stack of frame f and pushes its result, if any.
+type callSiteTarget func(f *frames.Frame, fs *list.List) error
+
+// callSiteKey identifies an individual invokedynamic instruction: the CP of its
+// class, the method (name and type) that contains it, and its location in the method.
+type callSiteKey struct {
+	cp     *classloader.CPool
+	method string
+	pc     int
+}
+
+var callSites = make(map[callSiteKey]callSiteTarget)
+var callSitesMutex sync.RWMutex
+
+// invokeDynamic executes the invokedynamic instruction at f.PC, whose CP entry is at
+// CPslot, linking the call site first if this is the first time it's executed.
+func invokeDynamic(f *frames.Frame, fs *list.List, CPslot int) error {
+	CP := f.CP.(*classloader.CPool)
+	key := callSiteKey{cp: CP, method: f.ClName + "." + f.MethName + f.MethType, pc: f.PC}
+
+	callSitesMutex.RLock()
+	target, ok := callSites[key]
+	callSitesMutex.RUnlock()
+
+	if !ok {
+		var err error
+		target, err = linkCallSite(f, CPslot)
+		if err != nil {
+			return err
+		}
+		callSitesMutex.Lock()
+		callSites[key] = target
+		callSitesMutex.Unlock()
+	}
+	return target(f, fs)
+}
+
+// linkCallSite finds the bootstrap method for the invokedynamic CP entry at CPslot and
+// returns the target it links the call site to.
+func linkCallSite(f *frames.Frame, CPslot int) (callSiteTarget, error) {
+	CP := f.CP.(*classloader.CPool)
+	if CPslot < 1 || CPslot >= len(CP.CpIndex) || CP.CpIndex[CPslot].Type != classloader.InvokeDynamic {
+		errMsg := fmt.Sprintf("INVOKEDYNAMIC: Expected an invokedynamic CP entry at %d in %s.%s",
+			CPslot, f.ClName, f.MethName)
+		_ = log.Log(errMsg, log.SEVERE)
+		return nil, errors.New(errMsg)
+	}
+	indy := CP.InvokeDynamics[CP.CpIndex[CPslot].Slot]
+
+	// the name and type of the call site
+	nAndT := CP.NameAndTypes[CP.CpIndex[indy.NameAndType].Slot]
+	callSiteName := classloader.FetchUTF8stringFromCPEntryNumber(CP, nAndT.NameIndex)
+	callSiteType := classloader.FetchUTF8stringFromCPEntryNumber(CP, nAndT.DescIndex)
+
+	// the bootstrap method is in the class's BootstrapMethods attribute
+	k := classloader.MethAreaFetchFor(f.Loader, f.ClName)
+	if k == nil || k.Data == nil || int(indy.BootstrapIndex) >= len(k.Data.Bootstraps) {
+		errMsg := fmt.Sprintf("INVOKEDYNAMIC: Bootstrap method %d not found in class %s",
+			indy.BootstrapIndex, f.ClName)
+		_ = log.Log(errMsg, log.SEVERE)
+		return nil, errors.New(errMsg)
+	}
+	bsm := k.Data.Bootstraps[indy.BootstrapIndex]
+
+	// the bootstrap method is identified by a method handle, which points to a method ref
+	mhEntry := CP.CpIndex[bsm.MethodRef]
+	if mhEntry.Type != classloader.MethodHandle {
+		errMsg := fmt.Sprintf("INVOKEDYNAMIC: Invalid method handle for bootstrap method in class %s",
+			f.ClName)
+		_ = log.Log(errMsg, log.SEVERE)
+		return nil, errors.New(errMsg)
+	}
+	mh := CP.MethodHandles[mhEntry.Slot]
+	bsmClass, bsmName, _ := getMethInfoFromCPmethref(CP, int(mh.RefIndex))
+
+	if traced(f) {
+		traceInfo := fmt.Sprintf("INVOKEDYNAMIC: linking call site %s%s in %s.%s using %s.%s",
+			callSiteName, callSiteType, f.ClName, f.MethName, bsmClass, bsmName)
+		_ = log.Log(traceInfo, log.TRACE_INST)
+	}
+
+	if bsmClass == "java/lang/invoke/StringConcatFactory" {
+		switch bsmName {
+		case "makeConcatWithConstants":
+			return linkStringConcat(CP, bsm, callSiteType)
+		case "makeConcat": // no recipe, so every argument is simply appended
+			params := parseParamTypes(callSiteType)
+			return stringConcatTarget(strings.Repeat("\u0001", len(params)), nil, params), nil
+		}
+	}
+
+	if bsmClass == "java/lang/invoke/LambdaMetafactory" &&
+		(bsmName == "metafactory" || bsmName == "altMetafactory") {
+		return linkLambda(f, CP, bsm, bsmName, callSiteName, callSiteType)
+	}
+
+	errMsg := fmt.Sprintf("INVOKEDYNAMIC: Unsupported bootstrap method %s.%s for %s%s in %s.%s",
+		bsmClass, bsmName, callSiteName, callSiteType, f.ClName, f.MethName)
+	_ = log.Log(errMsg, log.SEVERE)
+	return nil, errors.New(errMsg)
+}
+
+// linkStringConcat links a call site bootstrapped by StringConcatFactory.makeConcatWithConstants.
+// The first static argument is the recipe: a string in which \u0001 marks where the next
+// argument goes and \u0002 marks where the next of the remaining static arguments (the
+// constants) goes. All other characters in the recipe are copied as is.
+func linkStringConcat(CP *classloader.CPool, bsm classloader.BootstrapMethod,
+	callSiteType string) (callSiteTarget, error) {
+	if len(bsm.Args) < 1 {
+		errMsg := "INVOKEDYNAMIC: makeConcatWithConstants called without a recipe"
+		_ = log.Log(errMsg, log.SEVERE)
+		return nil, errors.New(errMsg)
+	}
+
+	recipeEntry := FetchCPentry(CP, int(bsm.Args[0]))
+	if recipeEntry.retType != IS_STRING_ADDR {
+		errMsg := "INVOKEDYNAMIC: Invalid recipe for makeConcatWithConstants"
+		_ = log.Log(errMsg, log.SEVERE)
+		return nil, errors.New(errMsg)
+	}
+	recipe := *recipeEntry.stringVal
+
+	var constants []string
+	for _, arg := range bsm.Args[1:] {
+		entry := FetchCPentry(CP, int(arg))
+		switch entry.retType {
+		case IS_STRING_ADDR:
+			constants = append(constants, *entry.stringVal)
+		case IS_INT64:
+			constants = append(constants, strconv.FormatInt(entry.intVal, 10))
+		case IS_FLOAT64:
+			if entry.entryType == classloader.FloatConst {
+				constants = append(constants, javaFloatToString(entry.floatVal, 32))
+			} else {
+				constants = append(constants, javaFloatToString(entry.floatVal, 64))
+			}
+		default:
+			errMsg := fmt.Sprintf("INVOKEDYNAMIC: Invalid constant at CP entry %d for makeConcatWithConstants", arg)
+			_ = log.Log(errMsg, log.SEVERE)
+			return nil, errors.New(errMsg)
+		}
+	}
+
+	return stringConcatTarget(recipe, constants, parseParamTypes(callSiteType)), nil
+}
+
+// stringConcatTarget returns the call site target for a string concatenation, which
+// builds the string from the recipe, the constants, and the arguments whose types are
+// given in params.
+func stringConcatTarget(recipe string, constants []string, params []string) callSiteTarget {
+	return func(f *frames.Frame, fs *list.List) error {
+		// the arguments are on the operand stack with the last one on top
+		args := make([]interface{}, len(params))
+		for i := len(params) - 1; i >= 0; i-- {
+			if params[i] == "J" || params[i] == "D" { // longs and doubles take two slots
+				pop(f)
+			}
+			args[i] = pop(f)
+		}
+
+		var sb strings.Builder
+		argIndex, constIndex := 0, 0
+		for _, ch := range recipe {
+			switch ch {
+			case '\u0001':
+				if argIndex >= len(args) {
+					return errors.New("INVOKEDYNAMIC: String concatenation recipe has too many arguments")
+				}
+				str, err := concatArgToString(params[argIndex], args[argIndex], fs)
+				if err != nil {
+					return err
+				}
+				sb.WriteString(str)
+				argIndex += 1
+			case '\u0002':
+				if constIndex >= len(constants) {
+					return errors.New("INVOKEDYNAMIC: String concatenation recipe has too many constants")
+				}
+				sb.WriteString(constants[constIndex])
+				constIndex += 1
+			default:
+				sb.WriteRune(ch)
+			}
+		}
+
+		str := sb.String()
+		push(f, object.CreateCompactStringFromGoString(&str))
+		return nil
+	}
+}
+
+// concatArgToString converts an argument of type paramType to a string in the same
+// way that String.valueOf() does.
+func concatArgToString(paramType string, arg interface{}, fs *list.List) (string, error) {
+	switch paramType {
+	case "Z":
+		if arg.(int64) != 0 {
+			return "true", nil
+		}
+		return "false", nil
+	case "C":
+		return string(rune(arg.(int64))), nil
+	case "B", "S", "I", "J":
+		return strconv.FormatInt(arg.(int64), 10), nil
+	case "F":
+		return javaFloatToString(arg.(float64), 32), nil
+	case "D":
+		return javaFloatToString(arg.(float64), 64), nil
+	}
+
+	if object.IsNull(arg) {
+		return "null", nil
+	}
+	obj, ok := arg.(*object.Object)
+	if !ok {
+		return fmt.Sprintf("%v", arg), nil
+	}
+	return objectToString(obj, fs)
+}
+
+// objectToString returns the string that obj.toString() would return. Strings and
+// boxed primitives are converted directly. For other objects, the toString() method of
+// the object's class (or its nearest superclass that has one) is executed. If the only
+// toString() is that of java.lang.Object, the result is the class name and hash code.
+// An exception thrown by toString() is returned as a gException, so that the caller
+// can throw it on.
+func objectToString(obj *object.Object, fs *list.List) (string, error) {
+	className := *obj.Klass
+	if className == "java/lang/String" && len(obj.Fields) > 0 {
+		switch value := obj.Fields[0].Fvalue.(type) {
+		case *[]byte:
+			return string(*value), nil
+		case string:
+			return value, nil
+		}
+	}
+
+	if len(obj.Fields) > 0 {
+		value := obj.Fields[0].Fvalue
+		switch className {
+		case "java/lang/Boolean":
+			return concatArgToString("Z", value, fs)
+		case "java/lang/Character":
+			return concatArgToString("C", value, fs)
+		case "java/lang/Byte", "java/lang/Short", "java/lang/Integer", "java/lang/Long":
+			return concatArgToString("J", value, fs)
+		case "java/lang/Float":
+			return concatArgToString("F", value, fs)
+		case "java/lang/Double":
+			return concatArgToString("D", value, fs)
+		}
+	}
+
+	for k := classloader.ObjectKlass(obj); k != nil && k.Data != nil && k.Data.Name != "java/lang/Object"; {
+		clName := k.Data.Name
+		mtEntry, ok := classloader.MTableFetch(classloader.QualifiedName(k.Loader, clName) +
+			".toString()Ljava/lang/String;")
+		if !ok {
+			if _, found := k.Data.MethodTable["toString()Ljava/lang/String;"]; !found {
+				if k.Data.Superclass == "" {
+					break
+				}
+				k = fetchClassFor(k.Loader, k.Data.Superclass)
+				continue
+			}
+			var err error
+			mtEntry, err = classloader.FetchKlassMethod(k, "toString", "()Ljava/lang/String;")
+			if err != nil {
+				return "", err
+			}
+		}
+
+		ret, err := runMethodFromGo(fs, mtEntry, clName, "toString", "()Ljava/lang/String;", obj)
+		if err != nil {
+			return "", err
+		}
+		if object.IsNull(ret) {
+			return "null", nil
+		}
+		return objectToString(ret.(*object.Object), fs)
+	}
+
+	// the default toString() in java.lang.Object
+	return fmt.Sprintf("%s@%x", strings.ReplaceAll(className, "/", "."), obj.Mark.Hash), nil
+}
+
+// runMethodFromGo runs a Java method (or a golang method) to completion from within
+// golang code and returns its return value, if any. objRef is the object the method
+// is called on, or nil if the method is static, and args are the method's arguments.
+// The method is run on its own frame stack, whose bottom frame, which stands for the
+// golang code, receives the return value. An exception that the method doesn't catch
+// is returned as a gException, which the golang code passes on (see throw.go).
+func runMethodFromGo(fs *list.List, mtEntry classloader.MTentry, className, methName, methType string,
+	objRef interface{}, args ...interface{}) (interface{}, error) {
+
+	base := frames.CreateFrame(len(args)*2 + 3)
+	base.Ftype = 'G'
+	base.ClName = className
+	base.MethName = methName
+	if fs != nil && fs.Len() > 0 {
+		base.Thread = fs.Front().Value.(*frames.Frame).Thread
+	}
+
+	if objRef != nil {
+		push(base, objRef)
+	}
+	paramTypes := parseParamTypes(methType)
+	for i, arg := range args {
+		push(base, arg)
+		if i < len(paramTypes) && (paramTypes[i] == "J" || paramTypes[i] == "D") {
+			push(base, arg) // longs and doubles take two slots
+		}
+	}
+
+	stack := frames.CreateFrameStack()
+	stack.PushFront(base)
+
+	if mtEntry.MType == 'G' {
+		if _, err := runGmethod(mtEntry, stack, className, methName, methType); err != nil {
+			return nil, err
+		}
+	} else {
+		m := mtEntry.Meth.(classloader.JmEntry)
+		fram, err := createAndInitNewFrame(className, methName, methType, &m, objRef != nil, base)
+		if err != nil {
+			return nil, err
+		}
+		stack.PushFront(fram)
+
+		// runFrame() runs the method, including any methods it calls, until it returns
+		if err = runFrame(stack); err != nil {
+			return nil, err
+		}
+		stack.Remove(stack.Front())
+	}
+
+	if base.TOS < 0 {
+		return nil, nil
+	}
+	return pop(base), nil
+}
+
+// parseParamTypes returns the types of the parameters in a method descriptor, such as
+// (ILjava/lang/String;[J)V, as a slice of type strings: I, Ljava/lang/String;, [J.
+// Unlike util.ParseIncomingParamsFromMethTypeString(), it does not reduce the types,
+// as booleans and chars need to be distinguished from ints.
+func parseParamTypes(desc string) []string {
+	var params []string
+	end := strings.Index(desc, ")")
+	if !strings.HasPrefix(desc, "(") || end < 0 {
+		return params
+	}
+
+	for i := 1; i < end; i++ {
+		start := i
+		for desc[i] == '[' {
+			i++
+		}
+		if desc[i] == 'L' {
+			i += strings.Index(desc[i:], ";")
+		}
+		params = append(params, desc[start:i+1])
+	}
+	return params
+}
+
+// javaFloatToString formats a float or double (as given by bitSize, 32 or 64) the way
+// Java's Float.toString() and Double.toString() do: values from 10^-3 up to 10^7 are
+// shown in decimal notation with at least one digit after the decimal point. Others
+// are shown in computerized scientific notation, such as 1.0E10.
+func javaFloatToString(value float64, bitSize int) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "Infinity"
+	case math.IsInf(value, -1):
+		return "-Infinity"
+	case value == 0:
+		if math.Signbit(value) {
+			return "-0.0"
+		}
+		return "0.0"
+	}
+
+	abs := math.Abs(value)
+	if abs >= 1e-3 && abs < 1e7 {
+		str := strconv.FormatFloat(value, 'f', -1, bitSize)
+		if !strings.Contains(str, ".") {
+			str += ".0"
+		}
+		return str
+	}
+
+	// Go formats these as, e.g., 1.5e+10, which becomes 1.5E10
+	str := strconv.FormatFloat(value, 'e', -1, bitSize)
+	mantissa, exponent, _ := strings.Cut(str, "e")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	exp, _ := strconv.Atoi(exponent)
+	return mantissa + "E" + strconv.Itoa(exp)
+}
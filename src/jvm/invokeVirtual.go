@@ -0,0 +1,85 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"errors"
+	"fmt"
+	"jacobin/classloader"
+	"jacobin/exceptions"
+	"jacobin/frames"
+	"jacobin/object"
+)
+
+// INVOKEVIRTUAL names a method by the class in the CP, but the method that's executed
+// is selected by the class of the object it's called on (JVMS 5.4.6): the version in
+// that class or, if the class doesn't override the method, in its nearest superclass
+// that does. This is what makes polymorphism work, as in:
+//
+//	Animal a = new Dog();
+//	a.speak(); // calls Dog.speak()
+//
+// The selection is made using the vtable of the object's class (see classloader/vTable.go).
+// Methods not in the vtable--default methods inherited from interfaces and methods
+// implemented only in golang--are found by the same search INVOKEINTERFACE uses.
+
+// selectVirtualMethod returns the method executed when INVOKEVIRTUAL calls the method
+// methName+methType of the class className on the object in frame f's operand stack,
+// along with the name of the class whose version of the method it is. k is the class
+// named className, as the calling code sees it, or nil if it isn't in the method area.
+// If the method can't be selected, the returned int holds the exception to throw and
+// the error describes the problem. If the method isn't found, the entry's Meth is nil.
+func selectVirtualMethod(f *frames.Frame, className string, k *classloader.Klass, methName, methType string) (
+	classloader.ITentry, int, error) {
+
+	resolved := func() (classloader.ITentry, int, error) {
+		var mtEntry classloader.MTentry
+		if k != nil && k.Data != nil {
+			mtEntry, _ = classloader.FetchKlassMethod(k, methName, methType)
+		} else {
+			mtEntry, _ = classloader.FetchMethodFor(f.Loader, className, methName, methType)
+		}
+		return classloader.ITentry{ClName: className, Meth: mtEntry}, 0, nil
+	}
+
+	objIndex := f.TOS - countParamSlots(methType)
+	if objIndex < 0 || objIndex >= len(f.OpStack) {
+		return resolved()
+	}
+	obj, ok := f.OpStack[objIndex].(*object.Object)
+	if !ok || object.IsNull(obj) || obj.Klass == nil {
+		return resolved()
+	}
+	objClass := classloader.ObjectKlass(obj)
+	if objClass == nil {
+		return resolved()
+	}
+
+	// private methods are not overridden, so the resolved method is the one executed
+	if k != nil && k.Data != nil {
+		if m, ok := k.Data.MethodTable[methName+methType]; ok && m.AccessFlags&0x0002 != 0 { // private
+			return resolved()
+		}
+	}
+
+	entry, ok := classloader.VTableFetch(objClass, methName, methType)
+	if ok {
+		if entry.IsAbstract {
+			errMsg := fmt.Sprintf("Receiver class %s does not define or inherit an "+
+				"implementation of the resolved method 'abstract %s' of abstract class %s.",
+				objClass.Data.Name, methName+methType, className)
+			return classloader.ITentry{}, exceptions.AbstractMethodError, errors.New(errMsg)
+		}
+		mtEntry, _ := classloader.FetchKlassMethod(entry.Klass, methName, methType)
+		return classloader.ITentry{ClName: entry.ClName, Meth: mtEntry}, 0, nil
+	}
+
+	if selected, _, err := selectMethod(objClass, methName, methType); err == nil {
+		return selected, 0, nil
+	}
+	return resolved() // leave it to the caller to report the missing method
+}
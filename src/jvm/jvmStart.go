@@ -7,6 +7,7 @@
 package jvm
 
 import (
+	"errors"
 	"fmt"
 	"jacobin/classloader"
 	"jacobin/exceptions"
@@ -16,6 +17,7 @@ import (
 	"jacobin/thread"
 	"jacobin/types"
 	"os"
+	"strings"
 )
 
 var Global globals.Globals
@@ -66,6 +68,8 @@ func JVMrun() int {
 	if err != nil {
 		return shutdown.Exit(shutdown.JVM_EXCEPTION)
 	}
+	// the frame-stack limit (set by -Xss) is read from the global singleton
+	globals.GetGlobalRef().MaxFrames = Global.MaxFrames
 	// some CLI options, like -version, show data and immediately exit. This tests for that.
 	if Global.ExitNow == true {
 		return shutdown.Exit(shutdown.OK)
@@ -78,10 +82,20 @@ func JVMrun() int {
 	}
 	classloader.LoadBaseClasses() // must follow classloader.Init
 
+	// set the classpath, which is read from the global singleton by the classloader.
+	// With -jar, it comes from the JAR; otherwise, if it isn't on the command line,
+	// from the CLASSPATH environment variable (see classloader/classpath.go)
+	if Global.StartingJar != "" {
+		Global.Classpath = classloader.JarClasspath(Global.StartingJar)
+	} else if Global.Classpath == nil {
+		Global.Classpath = classloader.ParseClasspath(os.Getenv("CLASSPATH"))
+	}
+	globals.GetGlobalRef().Classpath = Global.Classpath
+
 	var mainClass string
 
 	if Global.StartingJar != "" {
-		manifestClass, err := classloader.GetMainClassFromJar(classloader.BootstrapCL, Global.StartingJar)
+		manifestClass, err := classloader.GetMainClassFromJar(classloader.AppCL, Global.StartingJar)
 
 		if err != nil {
 			_ = log.Log(err.Error(), log.INFO)
@@ -92,15 +106,20 @@ func JVMrun() int {
 			_ = log.Log(fmt.Sprintf("no main manifest attribute, in %s", Global.StartingJar), log.INFO)
 			return shutdown.Exit(shutdown.APP_EXCEPTION)
 		}
-		mainClass, err = classloader.LoadClassFromJar(classloader.BootstrapCL, manifestClass, Global.StartingJar)
+		mainClass, err = classloader.LoadClassFromJar(classloader.AppCL, manifestClass, Global.StartingJar)
 		if err != nil { // the exceptions message will already have been shown to user
 			return shutdown.Exit(shutdown.JVM_EXCEPTION)
 		}
-	} else if Global.StartingClass != "" {
-		mainClass, err = classloader.LoadClassFromFile(classloader.BootstrapCL, Global.StartingClass)
+	} else if strings.HasSuffix(Global.StartingClass, ".class") {
+		mainClass, err = classloader.LoadClassFromFile(classloader.AppCL, Global.StartingClass)
 		if err != nil { // the exceptions message will already have been shown to user
 			return shutdown.Exit(shutdown.JVM_EXCEPTION)
 		}
+	} else if Global.StartingClass != "" {
+		mainClass, err = loadMainClass(Global.StartingClass)
+		if err != nil {
+			return shutdown.Exit(shutdown.JVM_EXCEPTION)
+		}
 	} else {
 		_ = log.Log("Error: No executable program specified. Exiting.", log.INFO)
 		ShowUsage(os.Stdout)
@@ -121,17 +140,51 @@ func JVMrun() int {
 	// initialize the MTable (table caching methods)
 	classloader.MTable = make(map[string]classloader.MTentry)
 	classloader.MTableLoadNatives()
+	loadThreadMethods()
+	loadClassLoaderMethods()
+	dumpThreadsOnSignal()
 
 	// create the main thread
 	MainThread = thread.CreateThread()
 	MainThread.AddThreadToTable(&Global)
+	startScheduling()
 
 	// begin execution
 	_ = log.Log("Starting execution with: "+mainClass, log.INFO)
 	status = StartExec(mainClass, &MainThread, &Global)
 
+	// the VM exits only when all the non-daemon threads have ended
+	waitForThreads()
+	logInlineCacheStats()
+
 	if status != nil {
 		return shutdown.Exit(shutdown.APP_EXCEPTION)
 	}
 	return shutdown.Exit(shutdown.OK)
 }
+
+// loadMainClass loads the main class given by its fully qualified name (such as
+// com.acme.app.Main, or com/acme/app/Main) from the classpath, and returns its name
+// in the internal format (com/acme/app/Main). If the class can't be loaded, it shows
+// the user the same error as the JDK does.
+func loadMainClass(name string) (string, error) {
+	className := strings.ReplaceAll(name, ".", "/")
+	mainClass, err := classloader.LoadClassFromClasspath(classloader.AppCL, className)
+
+	// the class file that was found must declare the class that was asked for; if it's
+	// in the wrong directory, it might not (a class in package com.acme.app, say, that
+	// was found at the root of a directory on the classpath), and it's not loaded
+	if wrongName, ok := err.(*classloader.WrongNameError); ok {
+		errMsg := fmt.Sprintf("Error: Could not find or load main class %s\n"+
+			"Caused by: java.lang.NoClassDefFoundError: %s", name, wrongName.Error())
+		_ = log.Log(errMsg, log.SEVERE)
+		return "", errors.New(errMsg)
+	}
+	if err != nil {
+		errMsg := fmt.Sprintf("Error: Could not find or load main class %s\n"+
+			"Caused by: java.lang.ClassNotFoundException: %s", name, strings.ReplaceAll(name, "/", "."))
+		_ = log.Log(errMsg, log.SEVERE)
+		return "", err
+	}
+	return mainClass, nil
+}
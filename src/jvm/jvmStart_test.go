@@ -7,8 +7,10 @@
 package jvm
 
 import (
+	"archive/zip"
 	"bytes"
 	"io"
+	"jacobin/classloader"
 	"jacobin/globals"
 	"jacobin/log"
 	"os"
@@ -108,3 +110,56 @@ func TestNoMainClassInJar(t *testing.T) {
 		t.Errorf("jvmRun() with a jar that has no manifest should have given no main manifest attribute error, got %s", errMsg)
 	}
 }
+
+// a main class given by its fully qualified name is loaded from the classpath; if it
+// can't be, the user gets the JDK's error message
+func TestLoadMainClassByName(t *testing.T) {
+	cwd, _ := os.Getwd()
+	jarName := filepath.Join(cwd, "..", "..", "testdata", "hello.jar")
+
+	g := globals.GetGlobalRef()
+	globals.InitGlobals("test")
+	log.Init()
+	classloader.AppCL.Archives = make(map[string]*classloader.Archive)
+	classloader.InitMethodArea()
+
+	// put a copy of jacobin/HelloWorld.class at the root of a directory, where it has the wrong name
+	dir := t.TempDir()
+	jar, err := zip.OpenReader(jarName)
+	if err != nil {
+		t.Fatalf("Error opening %s: %s", jarName, err.Error())
+	}
+	class, _ := jar.Open("jacobin/HelloWorld.class")
+	classBytes, _ := io.ReadAll(class)
+	_ = jar.Close()
+	_ = os.WriteFile(filepath.Join(dir, "HelloWorld.class"), classBytes, 0644)
+	g.Classpath = []string{dir, jarName}
+
+	normalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	_, missingErr := loadMainClass("com.acme.app.Main")
+	_, wrongNameErr := loadMainClass("HelloWorld")
+	_ = w.Close()
+	os.Stderr = normalStderr
+	out, _ := io.ReadAll(r)
+	msg := string(out)
+
+	// the class with the wrong name is not loaded
+	if classloader.MethAreaFetch("jacobin/HelloWorld") != nil || classloader.MethAreaFetch("HelloWorld") != nil {
+		t.Errorf("Expected the class found under the wrong name not to be in the method area")
+	}
+	mainClass, err := loadMainClass("jacobin.HelloWorld")
+	if err != nil || mainClass != "jacobin/HelloWorld" {
+		t.Errorf("Expected jacobin.HelloWorld to be loaded as jacobin/HelloWorld, got %s (error: %v)", mainClass, err)
+	}
+
+	if missingErr == nil || !strings.Contains(msg, "Error: Could not find or load main class com.acme.app.Main\n"+
+		"Caused by: java.lang.ClassNotFoundException: com.acme.app.Main") {
+		t.Errorf("Expected a ClassNotFoundException for com.acme.app.Main, got: %s", msg)
+	}
+	if wrongNameErr == nil || !strings.Contains(msg, "Error: Could not find or load main class HelloWorld\n"+
+		"Caused by: java.lang.NoClassDefFoundError: HelloWorld (wrong name: jacobin/HelloWorld)") {
+		t.Errorf("Expected a NoClassDefFoundError for HelloWorld, got: %s", msg)
+	}
+}
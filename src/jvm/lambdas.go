@@ -0,0 +1,411 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"jacobin/classloader"
+	"jacobin/frames"
+	"jacobin/log"
+	"jacobin/object"
+	"jacobin/types"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Lambdas and method references are compiled by javac into invokedynamic call sites
+// bootstrapped by LambdaMetafactory.metafactory() or altMetafactory(). The call site
+// returns an object that implements a functional interface--that is, an interface
+// with a single abstract method (the SAM), such as Runnable.run(). When the SAM is
+// called, it executes the lambda's code, which javac places in a private method
+// (e.g., lambda$main$0) of the class, or the referenced method in the case of method
+// references. Any values the lambda captures are passed to the call site as arguments.
+//
+// Jacobin links these call sites by creating a synthetic class that implements the
+// functional interface. Its SAM is a golang method that calls the target method (the
+// "implementation method") with the captured values, which are stored as fields of
+// the lambda object, followed by the arguments passed to the SAM. Each call site gets
+// its own synthetic class, named like the JDK's: the enclosing class name followed by
+// $$Lambda$ and a number.
+
+// the kinds of method handles (JVMS 4.4.8) that can be the targets of lambdas
+const (
+	refInvokeVirtual    = 5
+	refInvokeStatic     = 6
+	refInvokeSpecial    = 7
+	refNewInvokeSpecial = 8
+	refInvokeInterface  = 9
+)
+
+// the flags passed to altMetafactory()
+const (
+	lambdaFlagMarkers = 2
+	lambdaFlagBridges = 4
+)
+
+// lambdaCount is used to give each synthetic lambda class a unique name
+var lambdaCount int64
+
+// lambdaTarget is the implementation method of a lambda, as specified by a method handle
+type lambdaTarget struct {
+	kind      uint16
+	loader    string // the defining loader of the class whose CP holds the method handle
+	className string
+	methName  string
+	methType  string
+}
+
+// linkLambda links a call site bootstrapped by LambdaMetafactory. The static arguments
+// of the bootstrap method are the erased type of the SAM, the method handle of the
+// implementation method, and the instantiated type of the SAM. altMetafactory() adds
+// flags, followed by any marker interfaces and bridge method types the flags call for.
+func linkLambda(f *frames.Frame, CP *classloader.CPool, bsm classloader.BootstrapMethod,
+	bsmName, samName, callSiteType string) (callSiteTarget, error) {
+
+	if len(bsm.Args) < 3 {
+		errMsg := fmt.Sprintf("INVOKEDYNAMIC: LambdaMetafactory.%s called with %d arguments, expected at least 3",
+			bsmName, len(bsm.Args))
+		_ = log.Log(errMsg, log.SEVERE)
+		return nil, errors.New(errMsg)
+	}
+
+	samType := fetchMethodTypeFromCP(CP, int(bsm.Args[0]))
+	target, err := fetchLambdaTarget(CP, int(bsm.Args[1]))
+	if samType == "" || err != nil {
+		errMsg := fmt.Sprintf("INVOKEDYNAMIC: Invalid arguments for LambdaMetafactory.%s in %s.%s",
+			bsmName, f.ClName, f.MethName)
+		_ = log.Log(errMsg, log.SEVERE)
+		return nil, errors.New(errMsg)
+	}
+
+	// the call site returns an instance of the functional interface
+	interfaces := []string{strings.TrimSuffix(strings.TrimPrefix(
+		callSiteType[strings.Index(callSiteType, ")")+1:], "L"), ";")}
+	samTypes := []string{samType}
+
+	if bsmName == "altMetafactory" && len(bsm.Args) > 3 {
+		flags := FetchCPentry(CP, int(bsm.Args[3])).intVal
+		argIndex := 4
+		if flags&lambdaFlagMarkers != 0 && argIndex < len(bsm.Args) {
+			count := int(FetchCPentry(CP, int(bsm.Args[argIndex])).intVal)
+			argIndex += 1
+			for i := 0; i < count && argIndex < len(bsm.Args); i++ {
+				marker := FetchCPentry(CP, int(bsm.Args[argIndex]))
+				if marker.retType == IS_STRING_ADDR {
+					interfaces = append(interfaces, *marker.stringVal)
+				}
+				argIndex += 1
+			}
+		}
+		if flags&lambdaFlagBridges != 0 && argIndex < len(bsm.Args) {
+			count := int(FetchCPentry(CP, int(bsm.Args[argIndex])).intVal)
+			argIndex += 1
+			for i := 0; i < count && argIndex < len(bsm.Args); i++ {
+				samTypes = append(samTypes, fetchMethodTypeFromCP(CP, int(bsm.Args[argIndex])))
+				argIndex += 1
+			}
+		}
+	}
+
+	capturedTypes := parseParamTypes(callSiteType)
+	target.loader = f.Loader
+	lambdaKlass := createLambdaClass(f.Loader, f.ClName, interfaces, samName, samTypes, capturedTypes, target)
+	lambdaClass := lambdaKlass.Data.Name
+
+	if traced(f) {
+		traceInfo := fmt.Sprintf("INVOKEDYNAMIC: created %s implementing %s.%s%s with target %s.%s%s",
+			lambdaClass, interfaces[0], samName, samType, target.className, target.methName, target.methType)
+		_ = log.Log(traceInfo, log.TRACE_INST)
+	}
+
+	// a lambda that captures no values always returns the same instance
+	var singleton *object.Object
+	if len(capturedTypes) == 0 {
+		singleton = object.MakeEmptyObject()
+		singleton.Klass = &lambdaKlass.Data.Name
+	}
+
+	return func(f *frames.Frame, _ *list.List) error {
+		if singleton != nil {
+			push(f, singleton)
+			return nil
+		}
+
+		lambda := object.MakeEmptyObject()
+		lambda.Klass = &lambdaKlass.Data.Name
+		lambda.Fields = make([]object.Field, len(capturedTypes))
+		for i := len(capturedTypes) - 1; i >= 0; i-- {
+			if capturedTypes[i] == types.Long || capturedTypes[i] == types.Double {
+				pop(f) // longs and doubles take two slots
+			}
+			lambda.Fields[i] = object.Field{Ftype: capturedTypes[i], Fvalue: pop(f)}
+		}
+		push(f, lambda)
+		return nil
+	}, nil
+}
+
+// createLambdaClass posts a synthetic class for a lambda to the method area and adds
+// its SAM (and any bridge methods, which have the same name but a different type) to
+// the MTable as golang methods. The class has the same defining loader, enclosingLoader,
+// as the class whose code creates the lambda. It returns the class.
+func createLambdaClass(enclosingLoader, enclosingClass string, interfaces []string, samName string,
+	samTypes []string, capturedTypes []string, target lambdaTarget) *classloader.Klass {
+
+	className := enclosingClass + "$$Lambda$" + strconv.FormatInt(atomic.AddInt64(&lambdaCount, 1), 10)
+
+	klass := classloader.ClData{
+		Name:        className,
+		Superclass:  "java/lang/Object",
+		MethodTable: make(map[string]*classloader.Method),
+	}
+	for i, intf := range interfaces {
+		klass.CP.Utf8Refs = append(klass.CP.Utf8Refs, intf)
+		klass.Interfaces = append(klass.Interfaces, uint16(i))
+	}
+	klass.Access.ClassIsFinal = true
+	klass.Access.ClassIsSynthetic = true
+
+	loader := enclosingLoader
+	if k := classloader.MethAreaFetchFor(enclosingLoader, enclosingClass); k != nil {
+		loader = k.Loader
+	}
+	lambdaKlass := &classloader.Klass{Status: 'N', Loader: loader, Data: &klass}
+	classloader.MethAreaInsert(className, lambdaKlass)
+
+	qualifiedName := classloader.QualifiedName(loader, className)
+	classloader.MTmutex.Lock()
+	for _, samType := range samTypes {
+		classloader.MTable[qualifiedName+"."+samName+samType] = classloader.MTentry{
+			MType: 'G',
+			Meth: classloader.GMeth{
+				ParamSlots:   countParamSlots(samType),
+				ObjectRef:    true,
+				NeedsContext: true,
+				GFunction:    lambdaSAM(samType, capturedTypes, target),
+			},
+		}
+	}
+	classloader.MTmutex.Unlock()
+	return lambdaKlass
+}
+
+// lambdaSAM returns the golang function that implements the SAM of type samType. The
+// function is passed the lambda object followed by the SAM's arguments (with longs and
+// doubles appearing twice, as they do on the operand stack) and the frame stack of the
+// calling thread, so that the target runs on that thread. It calls the target with
+// the captured values followed by the SAM's arguments and returns the target's result,
+// boxing or unboxing values where the types of the SAM and the target differ.
+func lambdaSAM(samType string, capturedTypes []string, target lambdaTarget) func([]interface{}) interface{} {
+	samParams := parseParamTypes(samType)
+	samReturn := samType[strings.Index(samType, ")")+1:]
+	targetParams := parseParamTypes(target.methType)
+	targetReturn := target.methType[strings.Index(target.methType, ")")+1:]
+
+	return func(params []interface{}) interface{} {
+		lambda := params[0].(*object.Object)
+		var fs *list.List
+		if stack, ok := params[len(params)-1].(*list.List); ok {
+			fs = stack
+			params = params[:len(params)-1]
+		}
+
+		// gather the arguments and their types: captured values first, then the SAM's
+		var args []interface{}
+		var argTypes []string
+		for _, field := range lambda.Fields {
+			args = append(args, field.Fvalue)
+			argTypes = append(argTypes, field.Ftype)
+		}
+		slot := 1
+		for _, param := range samParams {
+			if slot >= len(params) {
+				break
+			}
+			args = append(args, params[slot])
+			argTypes = append(argTypes, param)
+			slot += 1
+			if param == types.Long || param == types.Double {
+				slot += 1
+			}
+		}
+
+		ret, err := invokeLambdaTarget(fs, target, targetParams, args, argTypes)
+		if err != nil {
+			return err
+		}
+		if samReturn == "V" {
+			return nil
+		}
+		return convertLambdaValue(ret, targetReturn, samReturn)
+	}
+}
+
+// invokeLambdaTarget calls the implementation method of a lambda with the arguments in
+// args, whose types are in argTypes, on the thread whose frame stack is fs. For instance
+// methods, the first argument is the object the method is called on.
+func invokeLambdaTarget(fs *list.List, target lambdaTarget, targetParams []string,
+	args []interface{}, argTypes []string) (interface{}, error) {
+
+	var objRef interface{}
+	if target.kind == refInvokeVirtual || target.kind == refInvokeInterface || target.kind == refInvokeSpecial {
+		if len(args) == 0 || object.IsNull(args[0]) {
+			errMsg := fmt.Sprintf("Cannot invoke %s.%s%s because the object is null",
+				target.className, target.methName, target.methType)
+			return nil, newGException(nullPointerException, errMsg)
+		}
+		objRef = args[0]
+		args = args[1:]
+		argTypes = argTypes[1:]
+	}
+
+	// convert the arguments to the types the target expects
+	for i := range args {
+		if i < len(targetParams) && i < len(argTypes) {
+			args[i] = convertLambdaValue(args[i], argTypes[i], targetParams[i])
+		}
+	}
+
+	className := target.className
+	var mtEntry classloader.MTentry
+	var err error
+
+	switch target.kind {
+	case refInvokeVirtual, refInvokeInterface: // the method is selected by the object's class
+		objClass := classloader.ObjectKlass(objRef.(*object.Object))
+		var entry classloader.ITentry
+		var excType int
+		entry, excType, err = selectMethod(objClass, target.methName, target.methType)
+		if err != nil {
+			return nil, newGException(selectionErrorClass(excType), err.Error())
+		}
+		className, mtEntry = entry.ClName, entry.Meth
+
+	case refNewInvokeSpecial: // a constructor reference, such as ArrayList::new
+		obj, err := instantiateClassFor(target.loader, className, frames.CreateFrameStack())
+		if err != nil {
+			return nil, err
+		}
+		if className+"."+target.methName+target.methType != "java/lang/Object.<init>()V" {
+			mtEntry, err = classloader.FetchMethodFor(target.loader, className, target.methName, target.methType)
+			if err != nil {
+				return nil, err
+			}
+			if _, err = runMethodFromGo(fs, mtEntry, className, target.methName, target.methType,
+				obj, args...); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+
+	default: // static and special methods are called directly
+		mtEntry, err = classloader.FetchMethodFor(target.loader, className, target.methName, target.methType)
+		if err != nil {
+			return nil, err
+		}
+		if target.kind == refInvokeStatic {
+			k := classloader.MethAreaFetchFor(target.loader, className)
+			if k != nil && k.Data != nil {
+				if err = runInitializationBlock(k, nil, fs); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return runMethodFromGo(fs, mtEntry, className, target.methName, target.methType, objRef, args...)
+}
+
+// fetchLambdaTarget returns the implementation method of a lambda from the method
+// handle at CP entry index.
+func fetchLambdaTarget(CP *classloader.CPool, index int) (lambdaTarget, error) {
+	if index < 1 || index >= len(CP.CpIndex) || CP.CpIndex[index].Type != classloader.MethodHandle {
+		return lambdaTarget{}, errors.New("not a method handle")
+	}
+	mh := CP.MethodHandles[CP.CpIndex[index].Slot]
+
+	target := lambdaTarget{kind: mh.RefKind}
+	switch CP.CpIndex[mh.RefIndex].Type {
+	case classloader.MethodRef:
+		target.className, target.methName, target.methType = getMethInfoFromCPmethref(CP, int(mh.RefIndex))
+	case classloader.Interface:
+		target.className, target.methName, target.methType = getMethInfoFromCPinterfaceRef(CP, int(mh.RefIndex))
+	default:
+		return lambdaTarget{}, errors.New("method handle does not refer to a method")
+	}
+	return target, nil
+}
+
+// fetchMethodTypeFromCP returns the method descriptor of the MethodType CP entry at
+// index, or "" if the entry is not a MethodType.
+func fetchMethodTypeFromCP(CP *classloader.CPool, index int) string {
+	if index < 1 || index >= len(CP.CpIndex) || CP.CpIndex[index].Type != classloader.MethodType {
+		return ""
+	}
+	descIndex := CP.MethodTypes[CP.CpIndex[index].Slot]
+	return classloader.FetchUTF8stringFromCPEntryNumber(CP, descIndex)
+}
+
+// countParamSlots returns the number of operand stack slots taken up by the
+// parameters in a method descriptor, counting two slots for longs and doubles.
+func countParamSlots(desc string) int {
+	slots := 0
+	for _, param := range parseParamTypes(desc) {
+		slots += 1
+		if param == types.Long || param == types.Double {
+			slots += 1
+		}
+	}
+	return slots
+}
+
+// the classes of boxed primitives, keyed by the primitive type
+var boxClasses = map[string]string{
+	types.Bool:   "java/lang/Boolean",
+	types.Byte:   "java/lang/Byte",
+	types.Char:   "java/lang/Character",
+	types.Short:  "java/lang/Short",
+	types.Int:    "java/lang/Integer",
+	types.Long:   "java/lang/Long",
+	types.Float:  "java/lang/Float",
+	types.Double: "java/lang/Double",
+}
+
+// convertLambdaValue converts a value of type fromType to toType where the two differ
+// in the ways allowed between a SAM and its implementation method: primitives are
+// boxed or unboxed, and integral values are widened to floating point.
+func convertLambdaValue(value interface{}, fromType, toType string) interface{} {
+	fromBoxClass, fromPrimitive := boxClasses[fromType]
+	_, toPrimitive := boxClasses[toType]
+
+	switch {
+	case fromPrimitive && !toPrimitive: // box
+		if _, isObject := value.(*object.Object); isObject {
+			return value
+		}
+		box := object.MakeEmptyObject()
+		box.Klass = &fromBoxClass
+		box.Fields = append(box.Fields, object.Field{Ftype: fromType, Fvalue: value})
+		return box
+
+	case !fromPrimitive && toPrimitive: // unbox
+		box, ok := value.(*object.Object)
+		if !ok || object.IsNull(box) || len(box.Fields) == 0 {
+			return value
+		}
+		return convertLambdaValue(box.Fields[0].Fvalue, box.Fields[0].Ftype, toType)
+
+	case fromPrimitive && toPrimitive:
+		if intValue, ok := value.(int64); ok && (toType == types.Float || toType == types.Double) {
+			return float64(intValue)
+		}
+	}
+	return value
+}
@@ -13,8 +13,13 @@ import (
 	"jacobin/execdata"
 	"jacobin/globals"
 	"jacobin/log"
+	"jacobin/shutdown"
 	"jacobin/types"
+	"math"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // This set of routines loads the Global.Options table with the various
@@ -31,6 +36,7 @@ import (
 //                              // 0 = no argument      1 = value follows a :
 //                              // 2 = value follows =  4 = value follows a space
 //                              // 8 = option has multiple values separated by a ; (such as -cp)
+//                              // 16 = value is appended to the option (such as -Xss1m)
 //	        action  func(position int, name string, gl pointer to globasl) error
 //                              // which is the action to perform when this option found.
 //      }
@@ -53,7 +59,8 @@ import (
 //  2) Add x to the GlobalOptions table, using the string of the option as the key
 //     Note that in options with parameters after an : or an = (types 1 or 2 in
 //     param3 in step 1), you enter only the root as the key. For example, see
-//     the -verbose entry below.
+//     the -verbose entry below. The roots of options whose values are appended to
+//     them (type 16) must also be added to getOptionRootAndArgs() in cli.go.
 //  3) create the function referred to in param 3 in step 1. This function accepts
 //     the position in the command line where the present option is located (first
 //     option is at position zero), a string which contains any parameters (if it has
@@ -68,6 +75,11 @@ func LoadOptionsTable(Global globals.Globals) {
 	Global.Options["-client"] = client
 	client.Set = true
 
+	classpath := globals.Option{true, false, 4, setClasspath}
+	Global.Options["-cp"] = classpath
+	Global.Options["-classpath"] = classpath
+	Global.Options["--class-path"] = classpath
+
 	dryRun := globals.Option{false, false, 0, notSupported}
 	Global.Options["--dry-run"] = dryRun
 	dryRun.Set = true
@@ -102,6 +114,15 @@ func LoadOptionsTable(Global globals.Globals) {
 	verboseClass := globals.Option{true, false, 1, verbosityLevel}
 	Global.Options["-verbose"] = verboseClass
 
+	xss := globals.Option{true, false, 16, setThreadStackSize}
+	Global.Options["-Xss"] = xss
+
+	xtier := globals.Option{true, false, 1, setExecutionTier}
+	Global.Options["-Xtier"] = xtier
+
+	xx := globals.Option{true, false, 1, setAdvancedOption}
+	Global.Options["-XX"] = xx
+
 	version := globals.Option{true, false, 1, versionStderrThenExit}
 	Global.Options["-version"] = version
 
@@ -135,6 +156,28 @@ func getJarFilename(pos int, name string, gl *globals.Globals) (int, error) {
 	}
 }
 
+// for -cp, -classpath, and --class-path. Get the next arg (or, for --class-path=<path>,
+// the embedded value), which is the classpath: a list of directories, JAR files, and
+// directories ending in * (meaning all the JAR files in them), separated by the
+// platform's path-list separator. See classloader/classpath.go.
+func setClasspath(pos int, argValue string, gl *globals.Globals) (int, error) {
+	option := gl.Args[pos]
+	if argValue == "" && !strings.Contains(option, "=") {
+		if len(gl.Args) <= pos+1 {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %s requires class path specification\n", option)
+			shutdown.Exit(shutdown.JVM_EXCEPTION)
+			return pos, os.ErrInvalid
+		}
+		pos++
+		argValue = gl.Args[pos]
+	}
+
+	gl.Classpath = classloader.ParseClasspath(argValue)
+	log.Log("Classpath: "+strings.Join(gl.Classpath, string(os.PathListSeparator)), log.FINE)
+	setOptionToSeen(strings.SplitN(option, "=", 2)[0], gl)
+	return pos, nil
+}
+
 // generic notification function that an option is not supported
 func notSupported(pos int, arg string, gl *globals.Globals) (int, error) {
 	name := gl.Args[pos]
@@ -198,6 +241,99 @@ func enableAssertions(pos int, name string, gl *globals.Globals) (int, error) {
 	return pos, nil
 }
 
+// -Xtier selects how methods are executed: by the interpreter alone (-Xtier:interpreter,
+// the default) or by the interpreter and, once they're hot, the closure tier
+// (-Xtier:closures). See closures.go.
+func setExecutionTier(pos int, argValue string, gl *globals.Globals) (int, error) {
+	switch argValue {
+	case "interpreter":
+		closureTier = false
+	case "closures":
+		closureTier = true
+	default:
+		log.Log("Error: "+argValue+" is not a valid execution tier. Ignored.", log.WARNING)
+		return pos, errors.New("Invalid execution tier specified: " + argValue)
+	}
+	setOptionToSeen("-Xtier", gl)
+	return pos, nil
+}
+
+// -XX: sets one of the JDK's advanced options. The one Jacobin supports is
+// -XX:DeterministicScheduling=<seed>, which runs threads one at a time, in an order
+// chosen by the seed (see scheduler.go). If no seed is given, one is chosen and logged,
+// so that the run can be repeated.
+func setAdvancedOption(pos int, argValue string, gl *globals.Globals) (int, error) {
+	name, value, hasValue := strings.Cut(argValue, "=")
+	switch name {
+	case "DeterministicScheduling":
+		seed := time.Now().UnixNano()
+		if hasValue {
+			var err error
+			if seed, err = strconv.ParseInt(value, 10, 64); err != nil {
+				log.Log("Error: "+value+" is not a valid scheduling seed. Ignored.", log.WARNING)
+				return pos, errors.New("Invalid scheduling seed specified: " + value)
+			}
+		}
+		scheduler = newThreadScheduler(seed)
+		log.Log("Scheduling threads deterministically with seed "+strconv.FormatInt(seed, 10), log.WARNING)
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "-XX:%s is not currently supported in Jacobin\n", argValue)
+		return pos, nil
+	}
+	setOptionToSeen("-XX", gl)
+	return pos, nil
+}
+
+// -Xss sets the size of a thread's stack, which Jacobin converts into a limit on the
+// depth of the thread's frame stack. The size is in bytes, unless it's followed by
+// k or K (kilobytes), m or M (megabytes), or g or G (gigabytes), as in the JDK. As in
+// the JDK, a size of 0 means the default size. The limit applies to the frame stack of
+// each thread, which frames.PushFrame() enforces, not to all the threads together.
+func setThreadStackSize(pos int, argValue string, gl *globals.Globals) (int, error) {
+	size, err := parseMemorySize(argValue)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid thread stack size: -Xss%s\n", argValue)
+		shutdown.Exit(shutdown.JVM_EXCEPTION)
+		return pos, err
+	}
+
+	switch {
+	case size == 0:
+		gl.MaxFrames = globals.DefaultMaxFrames
+	case size < globals.StackBytesPerFrame: // every thread needs room for at least one frame
+		gl.MaxFrames = 1
+	default:
+		gl.MaxFrames = int(size / globals.StackBytesPerFrame)
+	}
+	setOptionToSeen("-Xss", gl)
+	return pos, nil
+}
+
+// parseMemorySize converts a size such as 512k or 2m into a number of bytes.
+func parseMemorySize(size string) (int64, error) {
+	digits := size
+	multiplier := int64(1)
+	if len(size) > 0 {
+		switch size[len(size)-1] {
+		case 'k', 'K':
+			multiplier = 1024
+		case 'm', 'M':
+			multiplier = 1024 * 1024
+		case 'g', 'G':
+			multiplier = 1024 * 1024 * 1024
+		}
+		if multiplier > 1 {
+			digits = size[:len(size)-1]
+		}
+	}
+
+	value, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || value < 0 || value > math.MaxInt64/multiplier {
+		return 0, errors.New("invalid memory size: " + size)
+	}
+	return value * multiplier, nil
+}
+
 // set verbosity level. Note Jacobin starts up at WARNING level, so there is no
 // need to set it to that level. You cannot set the level to coarser than WARNING
 // which is why there is no way to set the verbosity to SEVERE only.
@@ -0,0 +1,327 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"jacobin/classloader"
+	"jacobin/frames"
+	"jacobin/globals"
+	"jacobin/log"
+	"jacobin/opcodes"
+	"jacobin/types"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// The first time a method is executed, its bytecode is translated into a quickCode: an
+// array of the method's instructions, which holds the resolved constant-pool (CP)
+// operands of the instructions that have one. Instructions that refer to the CP (LDC,
+// GETSTATIC, INVOKEVIRTUAL, etc.) must resolve the entry they refer to: they walk the
+// CP from the entry to the names of the class, field, or method, and then look these
+// up. This is done the first time the instruction is executed, and the result (the
+// value of the constant, the method's entry in the MTable, etc.) is then stored in the
+// instruction--it is "quickened"--so that later executions skip the resolution.
+//
+// As the JVMS requires, an instruction is resolved only when it's executed, so any
+// resolution error is raised by its first execution, just as if it weren't quickened.
+// An instruction whose resolution fails is not quickened.
+//
+// The quickCode of a method is keyed by its bytecode, which all frames of the method
+// share, so each method is translated only once. A frame holds its method's quickCode
+// in its Code field after it first needs it.
+
+// quickCode is the translated form of a method's bytecode. Its instructions are
+// indexed by the PC of their opcode in the bytecode, so that the bytecode's jump
+// offsets apply to both.
+type quickCode struct {
+	instrs []instr
+
+	// the counts that decide when the method is compiled by the closure tier, and the
+	// compiled method. See closures.go.
+	invocations atomic.Int32
+	backedges   atomic.Int32
+	compiled    atomic.Pointer[closureCode]
+}
+
+// instr is an instruction in a quickCode. For instructions that refer to the CP, resolved
+// is the resolved CP entry, which is nil until the instruction is first executed.
+type instr struct {
+	opcode   byte
+	resolved atomic.Pointer[resolvedOp]
+}
+
+// resolvedOp is the resolved CP entry of an instruction. Which fields are used
+// depends on the instruction:
+//
+//	LDC, LDC_W, LDC2_W: value (the constant to push)
+//	GETSTATIC, PUTSTATIC: name (the field's name, qualified by its class name)
+//	INVOKEVIRTUAL, INVOKEINTERFACE: className, name, and methodType, of the method,
+//	    and ic (the call site's inline cache, see inlineCache.go)
+//	INVOKESPECIAL: as INVOKEVIRTUAL, plus mtEntry (the method)
+//	INVOKESTATIC: as INVOKESPECIAL, plus klass (the method's class)
+//	NEW: className
+type resolvedOp struct {
+	value      slot
+	className  string
+	name       string
+	methodType string
+	mtEntry    classloader.MTentry
+	klass      *classloader.Klass
+	ic         *inlineCache
+}
+
+// quickCodes holds the quickCode of every method executed so far, keyed by the address
+// of the first byte of the method's bytecode
+var quickCodes sync.Map
+
+// getQuickCode returns the quickCode of the method executing in frame f, translating
+// its bytecode if this is the method's first execution
+func getQuickCode(f *frames.Frame) *quickCode {
+	if q, ok := f.Code.(*quickCode); ok {
+		return q
+	}
+	if len(f.Meth) == 0 {
+		return nil
+	}
+	key := &f.Meth[0]
+	q, ok := quickCodes.Load(key)
+	if !ok {
+		q, _ = quickCodes.LoadOrStore(key, translate(f.Meth))
+	}
+	f.Code = q
+	return q.(*quickCode)
+}
+
+// translate translates a method's bytecode into a quickCode. If the bytecode contains
+// an invalid opcode, translation stops there. The instructions from that point on are
+// never quickened and the error will be reported if and when one of them is executed.
+func translate(code []byte) *quickCode {
+	q := quickCode{instrs: make([]instr, len(code))}
+	for pc := 0; pc < len(code); {
+		length := instrLength(code, pc)
+		if length == 0 || pc+length > len(code) {
+			break
+		}
+		q.instrs[pc].opcode = code[pc]
+		pc += length
+	}
+	return &q
+}
+
+// instrLength returns the length in bytes of the instruction at code[pc], including its
+// operands, or 0 if the opcode is invalid
+func instrLength(code []byte, pc int) int {
+	switch op := code[pc]; op {
+	case opcodes.BIPUSH, opcodes.LDC, opcodes.RET, opcodes.NEWARRAY,
+		opcodes.ILOAD, opcodes.LLOAD, opcodes.FLOAD, opcodes.DLOAD, opcodes.ALOAD,
+		opcodes.ISTORE, opcodes.LSTORE, opcodes.FSTORE, opcodes.DSTORE, opcodes.ASTORE:
+		return 2
+	case opcodes.SIPUSH, opcodes.LDC_W, opcodes.LDC2_W, opcodes.IINC,
+		opcodes.GETSTATIC, opcodes.PUTSTATIC, opcodes.GETFIELD, opcodes.PUTFIELD,
+		opcodes.INVOKEVIRTUAL, opcodes.INVOKESPECIAL, opcodes.INVOKESTATIC,
+		opcodes.NEW, opcodes.ANEWARRAY, opcodes.CHECKCAST, opcodes.INSTANCEOF,
+		opcodes.IFNULL, opcodes.IFNONNULL:
+		return 3
+	case opcodes.MULTIANEWARRAY:
+		return 4
+	case opcodes.INVOKEINTERFACE, opcodes.INVOKEDYNAMIC, opcodes.GOTO_W, opcodes.JSR_W:
+		return 5
+	case opcodes.WIDE:
+		if pc+1 < len(code) && code[pc+1] == opcodes.IINC {
+			return 6
+		}
+		return 4
+	case opcodes.TABLESWITCH, opcodes.LOOKUPSWITCH:
+		// the operands begin at the next 4-byte boundary, with the default offset
+		operandsPC := pc + 1 + (3 - (pc % 4))
+		if operandsPC+12 > len(code) {
+			return 0
+		}
+		if op == opcodes.TABLESWITCH { // then the low and high values and the offsets
+			low := int32(binary.BigEndian.Uint32(code[operandsPC+4 : operandsPC+8]))
+			high := int32(binary.BigEndian.Uint32(code[operandsPC+8 : operandsPC+12]))
+			if high < low {
+				return 0
+			}
+			return operandsPC + 12 + int(high-low+1)*4 - pc
+		}
+		npairs := int32(binary.BigEndian.Uint32(code[operandsPC+4 : operandsPC+8]))
+		if npairs < 0 {
+			return 0
+		}
+		return operandsPC + 8 + int(npairs)*8 - pc
+	default:
+		if op >= opcodes.IFEQ && op <= opcodes.JSR { // the branches, which have a 2-byte offset
+			return 3
+		}
+		if op <= opcodes.BREAKPOINT { // all other valid opcodes have no operands
+			return 1
+		}
+		return 0
+	}
+}
+
+// quickened returns the resolved CP entry of the instruction at f.PC, or nil if
+// the instruction has not been quickened yet
+func quickened(f *frames.Frame) *resolvedOp {
+	q := getQuickCode(f)
+	if q == nil || f.PC >= len(q.instrs) {
+		return nil
+	}
+	return q.instrs[f.PC].resolved.Load()
+}
+
+// quicken stores the resolved CP entry of the instruction at pc in the method executing
+// in frame f, so that later executions of the instruction use it
+func quicken(f *frames.Frame, pc int, r *resolvedOp) {
+	q := getQuickCode(f)
+	if q == nil || pc >= len(q.instrs) || q.instrs[pc].opcode != f.Meth[pc] {
+		return // the instruction was not translated
+	}
+	q.instrs[pc].resolved.Store(r)
+	if r.ic != nil {
+		registerInlineCache(r.ic)
+	}
+}
+
+// resolveStaticField returns the name, qualified by its class name, of the static field
+// that the GETSTATIC or PUTSTATIC instruction at f.PC refers to, and moves f.PC past the
+// instruction. On the instruction's first execution, the field is resolved, which loads
+// and initializes its class if need be. If the class's initialization fails, the error
+// returned is one that the instruction throws (see isInitializationError()).
+func resolveStaticField(f *frames.Frame, fs *list.List, opName string) (string, error) {
+	if r := quickened(f); r != nil {
+		f.PC += 2
+		return r.name, nil
+	}
+
+	pc := f.PC
+	CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2]) // next 2 bytes point to CP entry
+	f.PC += 2
+	CP := f.CP.(*classloader.CPool)
+	CPentry := CP.CpIndex[CPslot]
+	if CPentry.Type != classloader.FieldRef { // the pointed-to CP entry must be a field reference
+		glob := globals.GetGlobalRef()
+		glob.ErrorGoStack = string(debug.Stack())
+		errMsg := fmt.Sprintf("%s: Expected a field ref, but got %d in"+
+			"location %d in method %s of class %s\n",
+			opName, CPentry.Type, f.PC, f.MethName, f.ClName)
+		_ = log.Log(errMsg, log.SEVERE)
+		return "", errors.New(errMsg)
+	}
+
+	// get the field entry
+	field := CP.FieldRefs[CPentry.Slot]
+
+	// get the class entry from the field entry for this field. It's the class name.
+	classRef := field.ClassIndex
+	classNameIndex := CP.ClassRefs[CP.CpIndex[classRef].Slot]
+	classNameEntry := CP.CpIndex[classNameIndex]
+	className := CP.Utf8Refs[classNameEntry.Slot]
+
+	// process the name and type entry for this field
+	nAndTindex := field.NameAndType
+	nAndTentry := CP.CpIndex[nAndTindex]
+	nAndTslot := nAndTentry.Slot
+	nAndT := CP.NameAndTypes[nAndTslot]
+	fieldNameIndex := nAndT.NameIndex
+	fieldName := classloader.FetchUTF8stringFromCPEntryNumber(CP, fieldNameIndex)
+	if err := loadReferencedClass(fs, f, className); err != nil {
+		return "", err
+	}
+
+	// the statics of a class are held under its name, qualified by that of its loader
+	// if it's user-defined. Those of a class whose initialization failed can't be used.
+	k := classloader.MethAreaFetchFor(f.Loader, className)
+	if k != nil {
+		fieldName = classloader.QualifiedName(k.Loader, className) + "." + fieldName
+	} else {
+		fieldName = className + "." + fieldName
+	}
+	if k != nil && k.Data != nil && classInitState(k) == types.ClInitFailed {
+		return "", classInitFailedError(k)
+	}
+
+	// was this static field previously loaded? Is so, get its location and move on.
+	_, ok := classloader.GetStatic(fieldName)
+	if !ok { // if field is not already loaded, then
+		// the class has not been instantiated, so
+		// instantiate the class
+		_, err := instantiateClassFor(f.Loader, className, fs)
+		if err == nil {
+			_, ok = classloader.GetStatic(fieldName)
+		} else if isInitializationError(err) {
+			return "", err
+		} else {
+			glob := globals.GetGlobalRef()
+			glob.ErrorGoStack = string(debug.Stack())
+			errMsg := fmt.Sprintf("%s: could not load class %s", opName, className)
+			_ = log.Log(errMsg, log.SEVERE)
+			return "", errors.New(errMsg)
+		}
+	}
+
+	// if the field can't be found even after instantiating the
+	// containing class, something is wrong so get out of here.
+	if !ok {
+		glob := globals.GetGlobalRef()
+		glob.ErrorGoStack = string(debug.Stack())
+		errMsg := fmt.Sprintf("%s: could not find static field %s in class %s"+
+			"\n", opName, fieldName, className)
+		_ = log.Log(errMsg, log.SEVERE)
+		return "", errors.New(errMsg)
+	}
+
+	quicken(f, pc, &resolvedOp{name: fieldName})
+	return fieldName, nil
+}
+
+// resolveMethodRef returns the class name, method name, and method type of the method ref
+// that the instruction at f.PC refers to. It's used on the first execution of the
+// instruction; the caller quickens the instruction with the result.
+func resolveMethodRef(f *frames.Frame, opName string) (*resolvedOp, error) {
+	CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2]) // next 2 bytes point to CP entry
+	CP := f.CP.(*classloader.CPool)
+	CPentry := CP.CpIndex[CPslot]
+	if CPentry.Type != classloader.MethodRef { // the pointed-to CP entry must be a method reference
+		glob := globals.GetGlobalRef()
+		glob.ErrorGoStack = string(debug.Stack())
+		errMsg := fmt.Sprintf("%s: Expected a method ref, but got %d in"+
+			"location %d in method %s of class %s\n",
+			opName, CPentry.Type, f.PC, f.MethName, f.ClName)
+		_ = log.Log(errMsg, log.SEVERE)
+		return nil, errors.New(errMsg)
+	}
+
+	// get the methodRef entry
+	method := CP.MethodRefs[CPentry.Slot]
+
+	// get the class entry from this method
+	classRef := method.ClassIndex
+	classNameIndex := CP.ClassRefs[CP.CpIndex[classRef].Slot]
+	classNameEntry := CP.CpIndex[classNameIndex]
+	className := CP.Utf8Refs[classNameEntry.Slot]
+
+	// get the method name for this method
+	nAndTindex := method.NameAndType
+	nAndTentry := CP.CpIndex[nAndTindex]
+	nAndTslot := nAndTentry.Slot
+	nAndT := CP.NameAndTypes[nAndTslot]
+	methodNameIndex := nAndT.NameIndex
+	methodName := classloader.FetchUTF8stringFromCPEntryNumber(CP, methodNameIndex)
+
+	// get the signature for this method
+	methodSigIndex := nAndT.DescIndex
+	methodType := classloader.FetchUTF8stringFromCPEntryNumber(CP, methodSigIndex)
+
+	return &resolvedOp{className: className, name: methodName, methodType: methodType}, nil
+}
@@ -31,6 +31,17 @@ import (
 
 var MainThread thread.ExecThread
 
+// returnAddress is the value JSR and JSR_W push onto the operand stack: the location of
+// the instruction that follows the JSR. It's stored in a local by ASTORE and used by RET.
+type returnAddress int
+
+// errOperandStackOverflow and errOperandStackUnderflow are raised by push(), pop() and
+// peek() (by panicking, as they have no way to return an error) when an instruction
+// pushes onto a full operand stack or pops from an empty one. runFrame() recovers them
+// and returns them as errors.
+var errOperandStackOverflow = errors.New("operand stack overflow")
+var errOperandStackUnderflow = errors.New("operand stack underflow")
+
 // StartExec is where execution begins. It initializes various structures, such as
 // the MTable, then using the passed-in name of the starting class, finds its main() method
 // in the method area (it's guaranteed to already be loaded), grabs the executable
@@ -56,9 +67,11 @@ func StartExec(className string, mainThread *thread.ExecThread, globals *globals
 	f := frames.CreateFrame(m.MaxStack + 2) // create a new frame (the +2 is arbitrary, but needed)
 	f.Thread = MainThread.ID
 	f.MethName = "main"
+	f.MethType = "([Ljava/lang/String;)V"
 	f.ClName = className
-	f.CP = m.Cp                        // add its pointer to the class CP
-	f.Meth = append(f.Meth, m.Code...) // copy the bytecodes over
+	f.Loader = m.Loader
+	f.CP = m.Cp     // add its pointer to the class CP
+	f.Meth = m.Code // the bytecodes, which are shared by all frames of the method
 	// f.ExceptionTable = &m.Exceptions
 
 	// allocate the local variables
@@ -74,6 +87,9 @@ func StartExec(className string, mainThread *thread.ExecThread, globals *globals
 
 	// must first instantiate the class, so that any static initializers are run
 	_, instantiateError := InstantiateClass(className, MainThread.Stack)
+	if isInitializationError(instantiateError) { // there's no code to catch it, so it's reported
+		_, instantiateError = throwInitializationError(MainThread.Stack, instantiateError)
+	}
 	if instantiateError != nil {
 		return errors.New("Error instantiating: " + className + ".main()")
 	}
@@ -138,17 +154,44 @@ func runThread(t *thread.ExecThread) error {
 // golang function in the present frame. If it is a golang function, it's sent to
 // a different function for execution. Otherwise, bytecode interpretation takes
 // place through a giant switch statement.
-func runFrame(fs *list.List) error {
+//
+// runFrame() executes the frame at the head of the frame stack until that frame's
+// method returns. Methods it invokes are executed in the same loop: the invoke
+// instructions push the new frame and switch to it, and the return instructions pop
+// it and switch back to the caller. So, the depth of Java calls does not add to the
+// depth of the golang stack; it's limited only by the frame limit (see pushInvokedFrame()).
+// The frame that runFrame() was called to execute is left on the frame stack when it
+// returns, for the caller of runFrame() to pop.
+func runFrame(fs *list.List) (err error) {
 	// the current frame is always the head of the linked list of frames.
 	// the next statement converts the address of that frame to the more readable 'f'
 	f := fs.Front().Value.(*frames.Frame)
+	entryDepth := fs.Len() // when the frame at this depth returns, runFrame() is done
+
+	// an overflow or underflow of the operand stack is an error in the bytecode. It's
+	// reported here, along with the method and the instruction in which it occurred.
+	// All other panics are passed on.
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errOperandStackOverflow && r != errOperandStackUnderflow {
+				panic(r)
+			}
+			cf := fs.Front().Value.(*frames.Frame)
+			glob := globals.GetGlobalRef()
+			glob.ErrorGoStack = string(debug.Stack())
+			methName := fmt.Sprintf("%s.%s", cf.ClName, cf.MethName)
+			errMsg := fmt.Sprintf("%s, Method: %-40s PC: %03d", r.(error).Error(), methName, cf.PC)
+			_ = log.Log(errMsg, log.SEVERE)
+			err = errors.New(errMsg)
+		}
+	}()
 
 	// if the frame contains a golang method, execute it using runGframe(),
 	// which returns a value (possibly nil) and an exceptions code. Presuming no exceptions,
 	// if the return value (here, retval) is not nil, it is placed on the stack
 	// of the calling frame.
 	if f.Ftype == 'G' {
-		retval, slotCount, err := runGframe(f)
+		retval, slotCount, err := runGframe(fs, f)
 
 		if retval != nil {
 			f = fs.Front().Next().Value.(*frames.Frame)
@@ -163,8 +206,20 @@ func runFrame(fs *list.List) error {
 
 	// the frame's method is not a golang method, so it's Java bytecode, which
 	// is interpreted in the rest of this function.
+	trace := traced(f)                            // tracing is set for each thread
+	scheduled := scheduler != nil                 // see scheduler.go
+	tiered := closureTier && !trace && !scheduled // see closures.go
+	var tier tierState
 	for f.PC < len(f.Meth) {
-		if MainThread.Trace && f.Meth[f.PC] != opcodes.IMPDEP2 {
+		if scheduled {
+			scheduler.yield(schedulingID(f.Thread))
+		}
+		if tiered {
+			if tier.execute(f); f.PC >= len(f.Meth) {
+				continue // the method ran to its end
+			}
+		}
+		if trace {
 			traceInfo := emitTraceData(f)
 			_ = log.Log(traceInfo, log.TRACE_INST)
 		}
@@ -176,42 +231,38 @@ func runFrame(fs *list.List) error {
 			// push(f, int64(0)) // replaced in JACOBIN-286
 			push(f, object.Null)
 		case opcodes.ICONST_M1: //	x02	(push -1 onto opStack)
-			push(f, int64(-1))
+			pushInt(f, -1)
 		case opcodes.ICONST_0: // 	0x03	(push int 0 onto opStack)
-			push(f, int64(0))
+			pushInt(f, 0)
 		case opcodes.ICONST_1: //  	0x04	(push int 1 onto opStack)
-			push(f, int64(1))
+			pushInt(f, 1)
 		case opcodes.ICONST_2: //   0x05	(push 2 onto opStack)
-			push(f, int64(2))
+			pushInt(f, 2)
 		case opcodes.ICONST_3: //   0x06	(push 3 onto opStack)
-			push(f, int64(3))
+			pushInt(f, 3)
 		case opcodes.ICONST_4: //   0x07	(push 4 onto opStack)
-			push(f, int64(4))
+			pushInt(f, 4)
 		case opcodes.ICONST_5: //   0x08	(push 5 onto opStack)
-			push(f, int64(5))
+			pushInt(f, 5)
 		case opcodes.LCONST_0: //   0x09    (push long 0 onto opStack)
-			push(f, int64(0)) // b/c longs take two slots on the stack, it's pushed twice
-			push(f, int64(0))
+			pushLong(f, 0) // b/c longs take two slots on the stack, it's pushed twice
 		case opcodes.LCONST_1: //   0x0A    (push long 1 on to opStack)
-			push(f, int64(1)) // b/c longs take two slots on the stack, it's pushed twice
-			push(f, int64(1))
+			pushLong(f, 1) // b/c longs take two slots on the stack, it's pushed twice
 		case opcodes.FCONST_0: // 0x0B
-			push(f, 0.0)
+			pushFloat(f, 0.0)
 		case opcodes.FCONST_1: // 0x0C
-			push(f, 1.0)
+			pushFloat(f, 1.0)
 		case opcodes.FCONST_2: // 0x0D
-			push(f, 2.0)
+			pushFloat(f, 2.0)
 		case opcodes.DCONST_0: // 0x0E
-			push(f, 0.0)
-			push(f, 0.0)
+			pushDouble(f, 0.0)
 		case opcodes.DCONST_1: // 0xoF
-			push(f, 1.0)
-			push(f, 1.0)
+			pushDouble(f, 1.0)
 		case opcodes.BIPUSH: //	0x10	(push the following byte as an int onto the stack)
 			wbyte := f.Meth[f.PC+1]
 			wint64 := byteToInt64(wbyte)
 			f.PC += 1
-			push(f, wint64)
+			pushInt(f, wint64)
 		case opcodes.SIPUSH: //	0x11	(create int from next two bytes and push the int)
 			wbyte1 := f.Meth[f.PC+1]
 			wbyte2 := f.Meth[f.PC+2]
@@ -229,8 +280,14 @@ func runFrame(fs *list.List) error {
 				wint64 = (int64(wbyte1) * 256) + int64(wbyte2)
 			}
 			f.PC += 2
-			push(f, wint64)
+			pushInt(f, wint64)
 		case opcodes.LDC: // 	0x12   	(push constant from CP indexed by next byte)
+			if r := quickened(f); r != nil {
+				pushSlot(f, r.value)
+				f.PC += 1
+				break
+			}
+			pc := f.PC
 			idx := f.Meth[f.PC+1]
 			f.PC += 1
 
@@ -242,9 +299,9 @@ func runFrame(fs *list.List) error {
 				CPe.entryType != classloader.DoubleConst &&
 				CPe.entryType != classloader.LongConst { // if no error
 				if CPe.retType == IS_INT64 {
-					push(f, CPe.intVal)
+					pushInt(f, CPe.intVal)
 				} else if CPe.retType == IS_FLOAT64 {
-					push(f, CPe.floatVal)
+					pushFloat(f, CPe.floatVal)
 				} else if CPe.retType == IS_STRUCT_ADDR {
 					push(f, (*object.Object)(unsafe.Pointer(CPe.addrVal)))
 				} else if CPe.retType == IS_STRING_ADDR {
@@ -260,6 +317,9 @@ func runFrame(fs *list.List) error {
 					}
 					push(f, stringAddr)
 				}
+				if CPe.retType != IS_ERROR { // the constant was pushed
+					quicken(f, pc, &resolvedOp{value: peekSlot(f)})
+				}
 			} else { // TODO: Determine what exception to throw
 				glob := globals.GetGlobalRef()
 				glob.ErrorGoStack = string(debug.Stack())
@@ -268,6 +328,12 @@ func runFrame(fs *list.List) error {
 				return errors.New("LDC: invalid type")
 			}
 		case opcodes.LDC_W: // 	0x13	(push constant from CP indexed by next two bytes)
+			if r := quickened(f); r != nil {
+				pushSlot(f, r.value)
+				f.PC += 2
+				break
+			}
+			pc := f.PC
 			idx := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2])
 			f.PC += 2
 
@@ -276,9 +342,9 @@ func runFrame(fs *list.List) error {
 				CPe.entryType != classloader.DoubleConst &&
 				CPe.entryType != classloader.LongConst { // if no error
 				if CPe.retType == IS_INT64 {
-					push(f, CPe.intVal)
+					pushInt(f, CPe.intVal)
 				} else if CPe.retType == IS_FLOAT64 {
-					push(f, CPe.floatVal)
+					pushFloat(f, CPe.floatVal)
 				} else if CPe.retType == IS_STRUCT_ADDR {
 					push(f, (*object.Object)(unsafe.Pointer(CPe.addrVal)))
 				} else if CPe.retType == IS_STRING_ADDR {
@@ -294,6 +360,9 @@ func runFrame(fs *list.List) error {
 					}
 					push(f, stringAddr)
 				}
+				if CPe.retType != IS_ERROR { // the constant was pushed
+					quicken(f, pc, &resolvedOp{value: peekSlot(f)})
+				}
 			} else { // TODO: Determine what exception to throw
 				glob := globals.GetGlobalRef()
 				glob.ErrorGoStack = string(debug.Stack())
@@ -302,16 +371,21 @@ func runFrame(fs *list.List) error {
 				return errors.New(errMsg)
 			}
 		case opcodes.LDC2_W: // 0x14 	(push long or double from CP indexed by next two bytes)
+			if r := quickened(f); r != nil {
+				pushSlot(f, r.value) // pushed twice due to the 64-bit width
+				pushSlot(f, r.value)
+				f.PC += 2
+				break
+			}
+			pc := f.PC
 			idx := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2])
 			f.PC += 2
 
 			CPe := FetchCPentry(f.CP.(*classloader.CPool), idx)
 			if CPe.retType == IS_INT64 { // push value twice (due to 64-bit width)
-				push(f, CPe.intVal)
-				push(f, CPe.intVal)
+				pushLong(f, CPe.intVal)
 			} else if CPe.retType == IS_FLOAT64 {
-				push(f, CPe.floatVal)
-				push(f, CPe.floatVal)
+				pushDouble(f, CPe.floatVal)
 			} else { // TODO: Determine what exception to throw
 				glob := globals.GetGlobalRef()
 				glob.ErrorGoStack = string(debug.Stack())
@@ -319,77 +393,72 @@ func runFrame(fs *list.List) error {
 				exceptions.Throw(exceptions.InaccessibleObjectException, errMsg)
 				return errors.New(errMsg)
 			}
-		case opcodes.ILOAD, // 0x15	(push int from local var, using next byte as index)
-			opcodes.FLOAD, //  0x17 (push float from local var, using next byte as index)
-			opcodes.ALOAD: //  0x19 (push ref from local var, using next byte as index)
+			quicken(f, pc, &resolvedOp{value: peekSlot(f)})
+		case opcodes.ILOAD: // 0x15	(push int from local var, using next byte as index)
 			index := int(f.Meth[f.PC+1])
 			f.PC += 1
-			push(f, f.Locals[index])
+			pushInt(f, loadInt(f, index))
 		case opcodes.LLOAD: // 0x16 (push long from local var, using next byte as index)
 			index := int(f.Meth[f.PC+1])
 			f.PC += 1
-			val := f.Locals[index].(int64)
-			push(f, val)
-			push(f, val) // push twice due to item being 64 bits wide
+			pushLong(f, loadInt(f, index)) // pushed twice due to item being 64 bits wide
+		case opcodes.FLOAD: //  0x17 (push float from local var, using next byte as index)
+			index := int(f.Meth[f.PC+1])
+			f.PC += 1
+			pushFloat(f, loadFloat(f, index))
 		case opcodes.DLOAD: // 0x18 (push double from local var, using next byte as index)
 			index := int(f.Meth[f.PC+1])
 			f.PC += 1
-			val := f.Locals[index].(float64)
-			push(f, val)
-			push(f, val) // push twice due to item being 64 bits wide
+			pushDouble(f, loadFloat(f, index)) // pushed twice due to item being 64 bits wide
+		case opcodes.ALOAD: //  0x19 (push ref from local var, using next byte as index)
+			index := int(f.Meth[f.PC+1])
+			f.PC += 1
+			pushSlot(f, loadSlot(f, index))
 		case opcodes.ILOAD_0: // 	0x1A    (push local variable 0)
-			push(f, f.Locals[0].(int64))
+			pushInt(f, loadInt(f, 0))
 		case opcodes.ILOAD_1: //    OX1B    (push local variable 1)
-			push(f, f.Locals[1].(int64))
+			pushInt(f, loadInt(f, 1))
 		case opcodes.ILOAD_2: //    0X1C    (push local variable 2)
-			push(f, f.Locals[2].(int64))
+			pushInt(f, loadInt(f, 2))
 		case opcodes.ILOAD_3: //  	0x1D   	(push local variable 3)
-			push(f, f.Locals[3].(int64))
+			pushInt(f, loadInt(f, 3))
 		// LLOAD use two slots, so the same value is pushed twice
 		case opcodes.LLOAD_0: //	0x1E	(push local variable 0, as long)
-			push(f, f.Locals[0].(int64))
-			push(f, f.Locals[0].(int64))
+			pushLong(f, loadInt(f, 0))
 		case opcodes.LLOAD_1: //	0x1F	(push local variable 1, as long)
-			push(f, f.Locals[1].(int64))
-			push(f, f.Locals[1].(int64))
+			pushLong(f, loadInt(f, 1))
 		case opcodes.LLOAD_2: //	0x20	(push local variable 2, as long)
-			push(f, f.Locals[2].(int64))
-			push(f, f.Locals[2].(int64))
+			pushLong(f, loadInt(f, 2))
 		case opcodes.LLOAD_3: //	0x21	(push local variable 3, as long)
-			push(f, f.Locals[3].(int64))
-			push(f, f.Locals[3].(int64))
+			pushLong(f, loadInt(f, 3))
 		case opcodes.FLOAD_0: // 0x22
-			push(f, f.Locals[0])
+			pushFloat(f, loadFloat(f, 0))
 		case opcodes.FLOAD_1: // 0x23
-			push(f, f.Locals[1])
+			pushFloat(f, loadFloat(f, 1))
 		case opcodes.FLOAD_2: // 0x24
-			push(f, f.Locals[2])
+			pushFloat(f, loadFloat(f, 2))
 		case opcodes.FLOAD_3: // 0x25
-			push(f, f.Locals[3])
+			pushFloat(f, loadFloat(f, 3))
 		case opcodes.DLOAD_0: //	0x26	(push local variable 0, as double)
-			push(f, f.Locals[0])
-			push(f, f.Locals[0])
+			pushDouble(f, loadFloat(f, 0))
 		case opcodes.DLOAD_1: //	0x27	(push local variable 1, as double)
-			push(f, f.Locals[1])
-			push(f, f.Locals[1])
+			pushDouble(f, loadFloat(f, 1))
 		case opcodes.DLOAD_2: //	0x28	(push local variable 2, as double)
-			push(f, f.Locals[2])
-			push(f, f.Locals[2])
+			pushDouble(f, loadFloat(f, 2))
 		case opcodes.DLOAD_3: //	0x29	(push local variable 3, as double)
-			push(f, f.Locals[3])
-			push(f, f.Locals[3])
+			pushDouble(f, loadFloat(f, 3))
 		case opcodes.ALOAD_0: //	0x2A	(push reference stored in local variable 0)
-			push(f, f.Locals[0])
+			pushSlot(f, loadSlot(f, 0))
 		case opcodes.ALOAD_1: //	0x2B	(push reference stored in local variable 1)
-			push(f, f.Locals[1])
+			pushSlot(f, loadSlot(f, 1))
 		case opcodes.ALOAD_2: //	0x2C    (push reference stored in local variable 2)
-			push(f, f.Locals[2])
+			pushSlot(f, loadSlot(f, 2))
 		case opcodes.ALOAD_3: //	0x2D	(push reference stored in local variable 3)
-			push(f, f.Locals[3])
+			pushSlot(f, loadSlot(f, 3))
 		case opcodes.IALOAD, //		0x2E	(push contents of an int array element)
 			opcodes.CALOAD, //		0x34	(push contents of a (two-byte) char array element)
 			opcodes.SALOAD: //		0x35    (push contents of a short array element)
-			index := pop(f).(int64)
+			index := popInt(f)
 			iAref := pop(f).(*object.Object) // ptr to array object
 			if iAref == object.Null {
 				glob := globals.GetGlobalRef()
@@ -409,9 +478,9 @@ func runFrame(fs *list.List) error {
 				return errors.New(errMsg)
 			}
 			var value = array[index]
-			push(f, value)
+			pushInt(f, value)
 		case opcodes.LALOAD: //		0x2F	(push contents of a long array element)
-			index := pop(f).(int64)
+			index := popInt(f)
 			iAref := pop(f).(*object.Object) // ptr to array object
 			if iAref == nil {
 				glob := globals.GetGlobalRef()
@@ -430,11 +499,10 @@ func runFrame(fs *list.List) error {
 				return errors.New("LALOAD error")
 			}
 			var value = array[index]
-			push(f, value)
-			push(f, value) // pushed twice due to JDK longs being 64 bits wide
+			pushLong(f, value) // pushed twice due to JDK longs being 64 bits wide
 
 		case opcodes.FALOAD: //		0x30	(push contents of an float array element)
-			index := pop(f).(int64)
+			index := popInt(f)
 			ref := pop(f) // ptr to array object
 			// fAref := (*object.JacobinFloatArray)(ref)
 			if ref == nil || ref == object.Null {
@@ -455,10 +523,10 @@ func runFrame(fs *list.List) error {
 				return errors.New(errMsg)
 			}
 			var value = array[index]
-			push(f, value)
+			pushFloat(f, value)
 
 		case opcodes.DALOAD: //		0x31	(push contents of a double array element)
-			index := pop(f).(int64)
+			index := popInt(f)
 			fAref := pop(f).(*object.Object) // ptr to array object
 			if fAref == nil {
 				glob := globals.GetGlobalRef()
@@ -477,10 +545,9 @@ func runFrame(fs *list.List) error {
 				return errors.New(errMsg)
 			}
 			var value = array[index]
-			push(f, value)
-			push(f, value)
+			pushDouble(f, value)
 		case opcodes.AALOAD: // 0x32    (push contents of a reference array element)
-			index := pop(f).(int64)
+			index := popInt(f)
 			rAref := pop(f) // the array object. Can't be cast to *Object b/c might be nil
 			if rAref == nil {
 				glob := globals.GetGlobalRef()
@@ -504,7 +571,7 @@ func runFrame(fs *list.List) error {
 			push(f, value)
 
 		case opcodes.BALOAD: // 0x33	(push contents of a byte/boolean array element)
-			index := pop(f).(int64)
+			index := popInt(f)
 			ref := pop(f) // the array object
 			if ref == nil || ref == object.Null {
 				glob := globals.GetGlobalRef()
@@ -527,93 +594,75 @@ func runFrame(fs *list.List) error {
 			}
 			array := *(arrayPtr)
 			var value = array[index]
-			push(f, int64(value))
+			pushInt(f, int64(value))
 
-		case opcodes.ISTORE, //  0x36 	(store popped top of stack int into local[index])
-			opcodes.LSTORE: //  0x37 (store popped top of stack long into local[index])
-			bytecode := f.Meth[f.PC]
+		case opcodes.ISTORE: //  0x36 	(store popped top of stack int into local[index])
+			index := int(f.Meth[f.PC+1])
+			f.PC += 1
+			storeInt(f, index, popInt(f))
+		case opcodes.LSTORE: //  0x37 (store popped top of stack long into local[index])
 			index := int(f.Meth[f.PC+1])
 			f.PC += 1
-			f.Locals[index] = pop(f).(int64)
 			// longs and doubles are stored in localvar[x] and again in localvar[x+1]
-			if bytecode == opcodes.LSTORE {
-				f.Locals[index+1] = pop(f).(int64)
-			}
+			storeLong(f, index, popLong(f))
 		case opcodes.FSTORE: //  0x38 (store popped top of stack float into local[index])
 			index := int(f.Meth[f.PC+1])
 			f.PC += 1
-			f.Locals[index] = pop(f).(float64)
+			storeFloat(f, index, popFloat(f))
 		case opcodes.DSTORE: //  0x39 (store popped top of stack double into local[index])
 			index := int(f.Meth[f.PC+1])
 			f.PC += 1
-			f.Locals[index] = pop(f).(float64)
 			// longs and doubles are stored in localvar[x] and again in localvar[x+1]
-			f.Locals[index+1] = pop(f).(float64)
+			storeDouble(f, index, popDouble(f))
 		case opcodes.ASTORE: //  0x3A (store popped top of stack ref into localc[index])
 			index := int(f.Meth[f.PC+1])
 			f.PC += 1
-			f.Locals[index] = pop(f)
+			storeSlot(f, index, popSlot(f))
 		case opcodes.ISTORE_0: //   0x3B    (store popped top of stack int into local 0)
-			f.Locals[0] = pop(f).(int64)
+			storeInt(f, 0, popInt(f))
 		case opcodes.ISTORE_1: //   0x3C   	(store popped top of stack int into local 1)
-			f.Locals[1] = pop(f).(int64)
+			storeInt(f, 1, popInt(f))
 		case opcodes.ISTORE_2: //   0x3D   	(store popped top of stack int into local 2)
-			f.Locals[2] = pop(f).(int64)
+			storeInt(f, 2, popInt(f))
 		case opcodes.ISTORE_3: //   0x3E    (store popped top of stack int into local 3)
-			f.Locals[3] = pop(f).(int64)
+			storeInt(f, 3, popInt(f))
 		case opcodes.LSTORE_0: //   0x3F    (store long from top of stack into locals 0 and 1)
-			var v = pop(f).(int64)
-			f.Locals[0] = v
-			f.Locals[1] = v
-			pop(f)
+			storeLong(f, 0, popLong(f))
 		case opcodes.LSTORE_1: //   0x40    (store long from top of stack into locals 1 and 2)
-			var v = pop(f).(int64)
-			f.Locals[1] = v
-			f.Locals[2] = v
-			pop(f)
+			storeLong(f, 1, popLong(f))
 		case opcodes.LSTORE_2: //   0x41    (store long from top of stack into locals 2 and 3)
-			var v = pop(f).(int64)
-			f.Locals[2] = v
-			f.Locals[3] = v
-			pop(f)
+			storeLong(f, 2, popLong(f))
 		case opcodes.LSTORE_3: //   0x42    (store long from top of stack into locals 3 and 4)
-			var v = pop(f).(int64)
-			f.Locals[3] = v
-			f.Locals[4] = v
-			pop(f)
+			storeLong(f, 3, popLong(f))
 		case opcodes.FSTORE_0: // 0x43
-			f.Locals[0] = pop(f).(float64)
+			storeFloat(f, 0, popFloat(f))
 		case opcodes.FSTORE_1: // 0x44
-			f.Locals[1] = pop(f).(float64)
+			storeFloat(f, 1, popFloat(f))
 		case opcodes.FSTORE_2: // 0x45
-			f.Locals[2] = pop(f).(float64)
+			storeFloat(f, 2, popFloat(f))
 		case opcodes.FSTORE_3: // 0x46
-			f.Locals[3] = pop(f).(float64)
+			storeFloat(f, 3, popFloat(f))
 		case opcodes.DSTORE_0: // 0x47
-			f.Locals[0] = pop(f).(float64)
-			f.Locals[1] = pop(f).(float64)
+			storeDouble(f, 0, popDouble(f))
 		case opcodes.DSTORE_1: // 0x48
-			f.Locals[1] = pop(f).(float64)
-			f.Locals[2] = pop(f).(float64)
+			storeDouble(f, 1, popDouble(f))
 		case opcodes.DSTORE_2: // 0x49
-			f.Locals[2] = pop(f).(float64)
-			f.Locals[3] = pop(f).(float64)
+			storeDouble(f, 2, popDouble(f))
 		case opcodes.DSTORE_3: // 0x4A
-			f.Locals[3] = pop(f).(float64)
-			f.Locals[4] = pop(f).(float64)
+			storeDouble(f, 3, popDouble(f))
 		case opcodes.ASTORE_0: //	0x4B	(pop reference into local variable 0)
-			f.Locals[0] = pop(f)
+			storeSlot(f, 0, popSlot(f))
 		case opcodes.ASTORE_1: //   0x4C	(pop reference into local variable 1)
-			f.Locals[1] = pop(f)
+			storeSlot(f, 1, popSlot(f))
 		case opcodes.ASTORE_2: // 	0x4D	(pop reference into local variable 2)
-			f.Locals[2] = pop(f)
+			storeSlot(f, 2, popSlot(f))
 		case opcodes.ASTORE_3: //	0x4E	(pop reference into local variable 3)
-			f.Locals[3] = pop(f)
+			storeSlot(f, 3, popSlot(f))
 		case opcodes.IASTORE, //	0x4F	(store int in an array)
 			opcodes.CASTORE, //		0x55 	(store char (2 bytes) in an array)
 			opcodes.SASTORE: //    	0x56	(store a short in an array)
-			value := pop(f).(int64)
-			index := pop(f).(int64)
+			value := popInt(f)
+			index := popInt(f)
 			arrObj := pop(f).(*object.Object) // the array object
 			if arrObj == nil {
 				glob := globals.GetGlobalRef()
@@ -645,9 +694,8 @@ func runFrame(fs *list.List) error {
 			array[index] = value
 
 		case opcodes.LASTORE: // 0x50	(store a long in a long array)
-			value := pop(f).(int64)
-			pop(f) // second pop b/c longs use two slots
-			index := pop(f).(int64)
+			value := popLong(f) // popLong() pops both slots of the long
+			index := popInt(f)
 			lAref := pop(f).(*object.Object) // ptr to array object
 			if lAref == nil {
 				glob := globals.GetGlobalRef()
@@ -683,8 +731,8 @@ func runFrame(fs *list.List) error {
 			array[index] = value
 
 		case opcodes.FASTORE: // 0x51	(store a float in a float array)
-			value := pop(f).(float64)
-			index := pop(f).(int64)
+			value := popFloat(f)
+			index := popInt(f)
 			fAref := pop(f).(*object.Object) // ptr to array object
 			if fAref == nil {
 				glob := globals.GetGlobalRef()
@@ -715,12 +763,11 @@ func runFrame(fs *list.List) error {
 					"FASTORE: Invalid array subscript")
 				return errors.New("FASTORE: Invalid array index")
 			}
-			array[index] = value
+			array[index] = toFloat32(value)
 
 		case opcodes.DASTORE: // 0x52	(store a double in a doubles array)
-			value := pop(f).(float64)
-			pop(f) // second pop b/c doubles take two slots on the operand stack
-			index := pop(f).(int64)
+			value := popDouble(f) // popDouble() pops both slots of the double
+			index := popInt(f)
 			dAref := pop(f).(*object.Object)
 			if dAref == nil {
 				glob := globals.GetGlobalRef()
@@ -756,7 +803,7 @@ func runFrame(fs *list.List) error {
 
 		case opcodes.AASTORE: // 0x53   (store a reference in a reference array)
 			value := pop(f).(*object.Object)  // reference we're inserting
-			index := pop(f).(int64)           // index into the array
+			index := popInt(f)                // index into the array
 			ptrObj := pop(f).(*object.Object) // ptr to the array object
 
 			if ptrObj == nil {
@@ -797,7 +844,7 @@ func runFrame(fs *list.List) error {
 			var value byte = 0
 			rawValue := pop(f)
 			value = convertInterfaceToByte(rawValue)
-			index := pop(f).(int64)
+			index := popInt(f)
 			ptrObj := pop(f).(*object.Object) // ptr to array object
 			if ptrObj == nil {
 				glob := globals.GetGlobalRef()
@@ -832,151 +879,124 @@ func runFrame(fs *list.List) error {
 
 		case opcodes.POP: // 0x57 	(pop an item off the stack and discard it)
 			if f.TOS < 0 {
-				glob := globals.GetGlobalRef()
-				glob.ErrorGoStack = string(debug.Stack())
-				exceptions.FormatStackUnderflowError(f)
-				break // the error will be picked up on the next instruction
+				panic(errOperandStackUnderflow)
 			}
 			f.TOS -= 1
 
 		case opcodes.POP2: // 0x58	(pop 2 items from stack and discard them)
 			if f.TOS < 1 {
-				glob := globals.GetGlobalRef()
-				glob.ErrorGoStack = string(debug.Stack())
-				exceptions.FormatStackUnderflowError(f)
-				break // the error will be picked up on the next instruction
+				panic(errOperandStackUnderflow)
 			}
 			f.TOS -= 2
 
 		case opcodes.DUP: // 0x59 			(push an item equal to the current top of the stack
-			tosItem := peek(f)
-			if len(f.Meth) > 1 && f.Meth[f.PC+1] == opcodes.IMPDEP2 {
-				break
-			} // if invalid peek break now
-			push(f, tosItem)
+			tosItem := peekSlot(f)
+			pushSlot(f, tosItem)
 		case opcodes.DUP_X1: // 0x5A		(Duplicate the top stack value and insert two values down)
-			top := pop(f)
-			next := pop(f)
-			push(f, top)
-			push(f, next)
-			push(f, top)
+			top := popSlot(f)
+			next := popSlot(f)
+			pushSlot(f, top)
+			pushSlot(f, next)
+			pushSlot(f, top)
 		case opcodes.DUP_X2: // 0x5B		(Duplicate top stack value and insert it three slots earlier)
-			top := pop(f)
-			next := pop(f)
-			third := pop(f)
-			push(f, top)
-			push(f, third)
-			push(f, next)
-			push(f, top)
+			top := popSlot(f)
+			next := popSlot(f)
+			third := popSlot(f)
+			pushSlot(f, top)
+			pushSlot(f, third)
+			pushSlot(f, next)
+			pushSlot(f, top)
 		case opcodes.DUP2: // 0x5C			(Duplicate the top two stack values)
-			top := pop(f)
-			next := peek(f)
-			push(f, top)
-			push(f, next)
-			push(f, top)
+			top := popSlot(f)
+			next := peekSlot(f)
+			pushSlot(f, top)
+			pushSlot(f, next)
+			pushSlot(f, top)
 		case opcodes.DUP2_X1: // 0x5D		(Duplicate the top two values, three slots down)
-			top := pop(f)
-			next := pop(f)
-			third := pop(f)
-			push(f, next) // so: top-next-third -> top-next-third->top->next
-			push(f, top)
-			push(f, third)
-			push(f, next)
-			push(f, top)
+			top := popSlot(f)
+			next := popSlot(f)
+			third := popSlot(f)
+			pushSlot(f, next) // so: top-next-third -> top-next-third->top->next
+			pushSlot(f, top)
+			pushSlot(f, third)
+			pushSlot(f, next)
+			pushSlot(f, top)
 		case opcodes.DUP2_X2: // 0x5E		(Duplicate the top two values, four slots down)
-			top := pop(f)
-			next := pop(f)
-			third := pop(f)
-			fourth := pop(f)
-			push(f, next) // so: top-next-third-fourth -> top-next-third-fourth-top-next
-			push(f, top)
-			push(f, fourth)
-			push(f, third)
-			push(f, next)
-			push(f, top)
+			top := popSlot(f)
+			next := popSlot(f)
+			third := popSlot(f)
+			fourth := popSlot(f)
+			pushSlot(f, next) // so: top-next-third-fourth -> top-next-third-fourth-top-next
+			pushSlot(f, top)
+			pushSlot(f, fourth)
+			pushSlot(f, third)
+			pushSlot(f, next)
+			pushSlot(f, top)
 		case opcodes.SWAP: // 0x5F 	(swap top two items on stack)
-			top := pop(f)
-			next := pop(f)
-			push(f, top)
-			push(f, next)
+			top := popSlot(f)
+			next := popSlot(f)
+			pushSlot(f, top)
+			pushSlot(f, next)
 		case opcodes.IADD: //  0x60		(add top 2 integers on operand stack, push result)
-			i2 := pop(f).(int64)
-			i1 := pop(f).(int64)
+			i2 := popInt(f)
+			i1 := popInt(f)
 			sum := add(i1, i2)
-			push(f, sum)
+			pushInt(f, sum)
 		case opcodes.LADD: //  0x61     (add top 2 longs on operand stack, push result)
-			l2 := pop(f).(int64) //    longs occupy two slots, hence double pushes and pops
-			pop(f)
-			l1 := pop(f).(int64)
-			pop(f)
+			l2 := popLong(f) //    longs occupy two slots, hence double pushes and pops
+			l1 := popLong(f)
 			sum := add(l1, l2)
-			push(f, sum)
-			push(f, sum)
+			pushLong(f, sum)
 		case opcodes.FADD: // 0x62
-			lhs := float32(pop(f).(float64))
-			rhs := float32(pop(f).(float64))
-			push(f, float64(lhs+rhs))
+			lhs := float32(popFloat(f))
+			rhs := float32(popFloat(f))
+			pushFloat(f, float64(lhs+rhs))
 		case opcodes.DADD: // 0x63
-			lhs := pop(f).(float64)
-			pop(f)
-			rhs := pop(f).(float64)
-			pop(f)
+			lhs := popDouble(f)
+			rhs := popDouble(f)
 			res := add(lhs, rhs)
-			push(f, res)
-			push(f, res)
+			pushDouble(f, res)
 		case opcodes.ISUB: //  0x64	(subtract top 2 integers on operand stack, push result)
-			i2 := pop(f).(int64)
-			i1 := pop(f).(int64)
+			i2 := popInt(f)
+			i1 := popInt(f)
 			diff := subtract(i1, i2)
-			push(f, diff)
+			pushInt(f, diff)
 		case opcodes.LSUB: //  0x65 (subtract top 2 longs on operand stack, push result)
-			i2 := pop(f).(int64) //    longs occupy two slots, hence double pushes and pops
-			pop(f)
-			i1 := pop(f).(int64)
-			pop(f)
+			i2 := popLong(f) //    longs occupy two slots, hence double pushes and pops
+			i1 := popLong(f)
 			diff := subtract(i1, i2)
 
-			push(f, diff)
-			push(f, diff)
+			pushLong(f, diff)
 		case opcodes.FSUB: // 0x66
-			i2 := float32(pop(f).(float64))
-			i1 := float32(pop(f).(float64))
-			push(f, float64(i1-i2))
+			i2 := float32(popFloat(f))
+			i1 := float32(popFloat(f))
+			pushFloat(f, float64(i1-i2))
 		case opcodes.DSUB: // 0x67
-			val2 := pop(f).(float64)
-			pop(f)
-			val1 := pop(f).(float64)
-			pop(f)
+			val2 := popDouble(f)
+			val1 := popDouble(f)
 			res := val1 - val2
-			push(f, res)
-			push(f, res)
+			pushDouble(f, res)
 		case opcodes.IMUL: //  0x68  	(multiply 2 integers on operand stack, push result)
-			i2 := pop(f).(int64)
-			i1 := pop(f).(int64)
+			i2 := popInt(f)
+			i1 := popInt(f)
 			product := multiply(i1, i2)
-			push(f, product)
+			pushInt(f, product)
 		case opcodes.LMUL: //  0x69     (multiply 2 longs on operand stack, push result)
-			l2 := pop(f).(int64) //    longs occupy two slots, hence double pushes and pops
-			pop(f)
-			l1 := pop(f).(int64)
-			pop(f)
+			l2 := popLong(f) //    longs occupy two slots, hence double pushes and pops
+			l1 := popLong(f)
 			product := multiply(l1, l2)
-			push(f, product)
-			push(f, product)
+			pushLong(f, product)
 		case opcodes.FMUL: // 0x6A
-			val1 := float32(pop(f).(float64))
-			val2 := float32(pop(f).(float64))
-			push(f, float64(val1*val2))
+			val1 := float32(popFloat(f))
+			val2 := float32(popFloat(f))
+			pushFloat(f, float64(val1*val2))
 		case opcodes.DMUL: // 0x6B
-			val1 := pop(f).(float64)
-			pop(f)
-			val2 := pop(f).(float64)
-			pop(f)
+			val1 := popDouble(f)
+			val2 := popDouble(f)
 			res := multiply(val1, val2)
-			push(f, res)
-			push(f, res)
+			pushDouble(f, res)
 		case opcodes.IDIV: //  0x6C (integer divide tos-1 by tos)
-			val1 := pop(f).(int64)
+			val1 := popInt(f)
 			if val1 == 0 {
 				glob := globals.GetGlobalRef()
 				glob.ErrorGoStack = string(debug.Stack())
@@ -984,12 +1004,11 @@ func runFrame(fs *list.List) error {
 					"IDIV: Arithmetic Exception: divide by zero")
 				return errors.New("IDIV: Arithmetic Exception: divide by zero")
 			} else {
-				val2 := pop(f).(int64)
-				push(f, val2/val1)
+				val2 := popInt(f)
+				pushInt(f, val2/val1)
 			}
 		case opcodes.LDIV: //  0x6D   (long divide tos-2 by tos)
-			val2 := pop(f).(int64)
-			pop(f) //    longs occupy two slots, hence double pushes and pops
+			val2 := popLong(f)
 			if val2 == 0 {
 				glob := globals.GetGlobalRef()
 				glob.ErrorGoStack = string(debug.Stack())
@@ -997,48 +1016,24 @@ func runFrame(fs *list.List) error {
 				exceptions.Throw(exceptions.ArithmeticException, errMsg)
 				return errors.New(errMsg)
 			} else {
-				val1 := pop(f).(int64)
-				pop(f)
+				val1 := popLong(f)
 				res := val1 / val2
-				push(f, res)
-				push(f, res)
+				pushLong(f, res)
 			}
 
 		case opcodes.FDIV: // 0x6E
-			val1 := pop(f).(float64)
-			val2 := pop(f).(float64)
-			if val1 == 0.0 {
-				if val2 == 0.0 {
-					push(f, math.NaN())
-				} else if math.Signbit(val1) { // this test for negative zero
-					push(f, math.Inf(-1)) // but alas there is no -0 in golang (as of 1.20)
-				} else {
-					push(f, math.Inf(1))
-				}
-			} else {
-				push(f, float64(float32(val2)/float32(val1)))
-			}
+			// division by zero follows IEEE 754: the result is NaN for 0/0 and otherwise
+			// an infinity whose sign depends on those of both operands (including -0)
+			val1 := float32(popFloat(f))
+			val2 := float32(popFloat(f))
+			pushFloat(f, float64(val2/val1))
 
 		case opcodes.DDIV: // 0x6F
-			val1 := pop(f).(float64)
-			pop(f)
-			val2 := pop(f).(float64)
-			pop(f)
-			if val1 == 0.0 {
-				if val2 == 0.0 {
-					push(f, math.NaN())
-				} else if math.Signbit(val1) { // this tests for negative zero
-					push(f, math.Inf(-1)) // but golang has no -0 as of v. 1.20
-				} else {
-					push(f, math.Inf(1))
-				}
-			} else {
-				res := val2 / val1
-				push(f, res)
-				push(f, res)
-			}
+			val1 := popDouble(f)
+			val2 := popDouble(f)
+			pushDouble(f, divideDoubles(val2, val1))
 		case opcodes.IREM: // 	0x70	(remainder after int division, modulo)
-			val2 := pop(f).(int64)
+			val2 := popInt(f)
 			if val2 == 0 {
 				glob := globals.GetGlobalRef()
 				glob.ErrorGoStack = string(debug.Stack())
@@ -1046,13 +1041,12 @@ func runFrame(fs *list.List) error {
 				exceptions.Throw(exceptions.ArithmeticException, errMsg)
 				return errors.New(errMsg)
 			} else {
-				val1 := pop(f).(int64)
+				val1 := popInt(f)
 				res := val1 % val2
-				push(f, res)
+				pushInt(f, res)
 			}
 		case opcodes.LREM: // 	0x71	(remainder after long division)
-			val2 := pop(f).(int64)
-			pop(f) //    longs occupy two slots, hence double pushes and pops
+			val2 := popLong(f)
 			if val2 == 0 {
 				glob := globals.GetGlobalRef()
 				glob.ErrorGoStack = string(debug.Stack())
@@ -1060,244 +1054,187 @@ func runFrame(fs *list.List) error {
 				exceptions.Throw(exceptions.ArithmeticException, errMsg)
 				return errors.New(errMsg)
 			} else {
-				val1 := pop(f).(int64)
-				pop(f)
+				val1 := popLong(f)
 				res := val1 % val2
-				push(f, res)
-				push(f, res)
+				pushLong(f, res)
 			}
 		case opcodes.FREM: // 0x72
-			val2 := pop(f).(float64)
-			val1 := pop(f).(float64)
-			push(f, float64(float32(math.Remainder(val1, val2))))
+			// Java's remainder truncates the quotient, as fmod() in C does, so it
+			// has the sign of the dividend. (math.Remainder() rounds the quotient.)
+			val2 := float32(popFloat(f))
+			val1 := float32(popFloat(f))
+			pushFloat(f, toFloat32(math.Mod(float64(val1), float64(val2))))
 		case opcodes.DREM: // 0x73
-			val2 := pop(f).(float64)
-			pop(f)
-			val1 := pop(f).(float64)
-			pop(f)
+			val2 := popDouble(f)
+			val1 := popDouble(f)
 			drem := math.Remainder(val1, val2)
-			push(f, drem)
-			push(f, drem)
+			pushDouble(f, drem)
 		case opcodes.INEG: //	0x74 	(negate an int)
-			val := pop(f).(int64)
-			push(f, -val)
+			val := popInt(f)
+			pushInt(f, -val)
 		case opcodes.LNEG: //   0x75	(negate a long)
-			val := pop(f).(int64)
-			pop(f) // pop a second time because it's a long, which occupies 2 slots
+			val := popLong(f)
 			val = val * (-1)
-			push(f, val)
-			push(f, val)
+			pushLong(f, val)
 		case opcodes.FNEG: //	0x76	(negate a float)
-			val := pop(f).(float64)
-			push(f, -val)
+			val := popFloat(f)
+			pushFloat(f, -val)
 		case opcodes.DNEG: // 0x77
-			pop(f)
-			val := pop(f).(float64)
-			push(f, -val)
-			push(f, -val)
+			val := popDouble(f)
+			pushDouble(f, -val)
 		case opcodes.ISHL: //	0x78 	(shift int left)
-			shiftBy := pop(f).(int64)
-			val1 := pop(f).(int64)
+			shiftBy := popInt(f)
+			val1 := popInt(f)
 			var val2 int64
 			if val1 < 0 { // if neg, shift as pos, then make neg
 				val2 = (-val1) << (shiftBy & 0x1F) // only the bottom five bits are used
-				push(f, -val2)
+				pushInt(f, -val2)
 			} else {
-				push(f, val1<<(shiftBy&0x1F))
+				pushInt(f, val1<<(shiftBy&0x1F))
 			}
 		case opcodes.LSHL: // 	0x79	(shift value1 (long) left by value2 (int) bits)
-			shiftBy := pop(f).(int64)
+			shiftBy := popInt(f)
 			ushiftBy := uint64(shiftBy) & 0x3f // must be unsigned in golang; 0-63 bits per JVM
-			val1 := pop(f).(int64)
-			pop(f)
+			val1 := popLong(f)
 			val3 := val1 << ushiftBy
-			push(f, val3)
-			push(f, val3)
+			pushLong(f, val3)
 		case opcodes.ISHR: //  0x7A	(shift int value right)
-			shiftBy := pop(f).(int64)
-			val1 := pop(f).(int64)
+			shiftBy := popInt(f)
+			val1 := popInt(f)
 			var val2 int64
 			if val1 < 0 { // if neg, shift as pos, then make neg
 				val2 = (-val1) >> (shiftBy & 0x1F) // only the bottom five bits are used
-				push(f, -val2)
+				pushInt(f, -val2)
 			} else {
-				push(f, val1>>(shiftBy&0x1F))
+				pushInt(f, val1>>(shiftBy&0x1F))
 			}
 		case opcodes.LSHR, // 	0x7B	(shift value1 (long) right by value2 (int) bits)
 			opcodes.LUSHR: // 	0x70
-			shiftBy := pop(f).(int64)
+			shiftBy := popInt(f)
 			ushiftBy := uint64(shiftBy) & 0x3f // must be unsigned in golang; 0-63 bits per JVM
-			val1 := pop(f).(int64)
-			pop(f)
+			val1 := popLong(f)
 			val3 := val1 >> ushiftBy
-			push(f, val3)
-			push(f, val3)
+			pushLong(f, val3)
 		case opcodes.IUSHR: // 0x7C (unsigned shift right of int)
-			shiftBy := pop(f).(int64) // TODO: verify the result against JDK
-			val1 := pop(f).(int64)
+			shiftBy := popInt(f) // TODO: verify the result against JDK
+			val1 := popInt(f)
 			if val1 < 0 {
 				val1 = -val1
 			}
-			push(f, val1>>(shiftBy&0x1F)) // only the bottom five bits are used
+			pushInt(f, val1>>(shiftBy&0x1F)) // only the bottom five bits are used
 		case opcodes.IAND: //	0x7E	(logical and of two ints, push result)
-			val1 := pop(f).(int64)
-			val2 := pop(f).(int64)
-			push(f, val1&val2)
+			val1 := popInt(f)
+			val2 := popInt(f)
+			pushInt(f, val1&val2)
 		case opcodes.LAND: //   0x7F    (logical and of two longs, push result)
-			val1 := pop(f).(int64)
-			pop(f)
-			val2 := pop(f).(int64)
-			pop(f)
+			val1 := popLong(f)
+			val2 := popLong(f)
 			val3 := val1 & val2
-			push(f, val3)
-			push(f, val3)
+			pushLong(f, val3)
 		case opcodes.IOR: // 0x 80 (logical OR of two ints, push result)
-			val1 := pop(f).(int64)
-			val2 := pop(f).(int64)
-			push(f, val1|val2)
+			val1 := popInt(f)
+			val2 := popInt(f)
+			pushInt(f, val1|val2)
 		case opcodes.LOR: // 0x81  (logical OR of two longs, push result)
-			val1 := pop(f).(int64)
-			pop(f)
-			val2 := pop(f).(int64)
-			pop(f)
+			val1 := popLong(f)
+			val2 := popLong(f)
 			val3 := val1 | val2
-			push(f, val3)
-			push(f, val3)
+			pushLong(f, val3)
 		case opcodes.IXOR: // 	0x82	(logical XOR of two ints, push result)
-			val1 := pop(f).(int64)
-			val2 := pop(f).(int64)
-			push(f, val1^val2)
+			val1 := popInt(f)
+			val2 := popInt(f)
+			pushInt(f, val1^val2)
 		case opcodes.LXOR: // 	0x83  	(logical XOR of two longs, push result)
-			val1 := pop(f).(int64)
-			pop(f)
-			val2 := pop(f).(int64)
-			pop(f)
+			val1 := popLong(f)
+			val2 := popLong(f)
 			val3 := val1 ^ val2
-			push(f, val3)
-			push(f, val3)
+			pushLong(f, val3)
 		case opcodes.IINC: // 	0x84    (increment local variable by a signed byte constant)
-			localVarIndex := int64(f.Meth[f.PC+1])
+			localVarIndex := int(f.Meth[f.PC+1])
 			wbyte := f.Meth[f.PC+2]
 			increment := byteToInt64(wbyte)
-			orig := f.Locals[localVarIndex].(int64)
-			f.Locals[localVarIndex] = orig + increment
+			storeInt(f, localVarIndex, loadInt(f, localVarIndex)+increment)
 			f.PC += 2
 		case opcodes.I2F: //	0x86 	( convert int to float)
-			intVal := pop(f).(int64)
-			push(f, float64(intVal))
+			intVal := popInt(f)
+			pushFloat(f, float64(float32(intVal))) // ints above 2^24 are rounded
 		case opcodes.I2L: // 	0x85     (convert int to long)
-			// 	ints are already 64-bits, so this just pushes a second instance
-			val := peek(f).(int64) // look without popping
-			push(f, val)           // push the int a second time
+			// 	ints are already 64-bits, so the value just takes up a second slot
+			val := popInt(f)
+			pushLong(f, val)
 		case opcodes.I2D: // 	0x87	(convert int to double)
-			intVal := pop(f).(int64)
+			intVal := popInt(f)
 			dval := float64(intVal)
-			push(f, dval) // doubles use two slots, hence two pushes
-			push(f, dval)
+			pushDouble(f, dval) // doubles use two slots, hence two pushes
 		case opcodes.L2I: // 	0x88 	(convert long to int)
-			longVal := pop(f).(int64)
-			pop(f)
+			longVal := popLong(f)
 			intVal := longVal << 32 // remove high-end 4 bytes. this maintains the sign
 			intVal >>= 32
-			push(f, intVal)
+			pushInt(f, intVal)
 		case opcodes.L2F: // 	0x89 	(convert long to float)
-			longVal := pop(f).(int64)
-			pop(f)
+			longVal := popLong(f)
 			float32Val := float32(longVal) //
 			float64Val := float64(float32Val)
-			push(f, float64Val) // floats tke up only 1 slot in the JVM
+			pushFloat(f, float64Val) // floats tke up only 1 slot in the JVM
 		case opcodes.L2D: // 	0x8A (convert long to double)
-			longVal := pop(f).(int64)
-			pop(f)
+			longVal := popLong(f)
 			dblVal := float64(longVal)
-			push(f, dblVal)
-			push(f, dblVal)
+			pushDouble(f, dblVal)
 		case opcodes.D2I: // 0xBE
-			pop(f)
+			popPrim(f)
 			fallthrough
 		case opcodes.F2I: // 0x8B
-			floatVal := pop(f).(float64)
-			push(f, int64(math.Trunc(floatVal)))
+			floatVal := popFloat(f)
+			pushInt(f, floatToInt(floatVal))
 		case opcodes.F2D: // 0x8D
-			floatVal := pop(f).(float64)
-			push(f, floatVal)
-			push(f, floatVal)
+			floatVal := popFloat(f)
+			pushDouble(f, floatVal)
 		case opcodes.D2L: // 	0x8F convert double to long
-			pop(f)
+			popPrim(f)
 			fallthrough
 		case opcodes.F2L: // 	0x8C convert float to long
-			floatVal := pop(f).(float64)
-			truncated := int64(math.Trunc(floatVal))
-			push(f, truncated)
-			push(f, truncated)
+			floatVal := popFloat(f)
+			pushLong(f, floatToLong(floatVal))
 		case opcodes.D2F: // 	0x90 Double to float
-			floatVal := float32(pop(f).(float64))
-			pop(f)
-			push(f, float64(floatVal))
+			floatVal := float32(popDouble(f))
+			pushFloat(f, float64(floatVal))
 		case opcodes.I2B: //	0x91 convert into to byte preserving sign
-			intVal := pop(f).(int64)
+			intVal := popInt(f)
 			byteVal := intVal & 0xFF
 			if !(intVal > 0 && byteVal > 0) &&
 				!(intVal < 0 && byteVal < 0) {
 				byteVal = -byteVal
 			}
-			push(f, byteVal)
+			pushInt(f, byteVal)
 		case opcodes.I2C: //	0x92 convert to 16-bit char
 			// determine what happens in Java if the int is negative
-			intVal := pop(f).(int64)
+			intVal := popInt(f)
 			charVal := uint16(intVal) // Java chars are 16-bit unsigned value
-			push(f, int64(charVal))
+			pushInt(f, int64(charVal))
 		case opcodes.I2S: //	0x93 convert int to short
-			intVal := pop(f).(int64)
+			intVal := popInt(f)
 			shortVal := int32(intVal)
-			push(f, int64(shortVal))
+			pushInt(f, int64(shortVal))
 		case opcodes.LCMP: // 	0x94 (compare two longs, push int -1, 0, or 1, depending on result)
-			value2 := pop(f).(int64)
-			pop(f)
-			value1 := pop(f).(int64)
-			pop(f)
-			if value1 == value2 {
-				push(f, int64(0))
-			} else if value1 > value2 {
-				push(f, int64(1))
-			} else {
-				push(f, int64(-1))
-			}
+			value2 := popLong(f)
+			value1 := popLong(f)
+			pushInt(f, compareLongs(value1, value2))
 		case opcodes.FCMPL, opcodes.FCMPG: // Ox95, 0x96 - float comparison - they differ only in NaN treatment
-			value2 := pop(f).(float64)
-			value1 := pop(f).(float64)
-			if math.IsNaN(value1) || math.IsNaN(value2) {
-				if f.Meth[f.PC] == opcodes.FCMPG {
-					push(f, int64(1))
-				} else {
-					push(f, int64(-1))
-				}
-			} else if value1 > value2 {
-				push(f, int64(1))
-			} else if value1 < value2 {
-				push(f, int64(-1))
-			} else {
-				push(f, int64(0))
+			value2 := popFloat(f)
+			value1 := popFloat(f)
+			nanResult := int64(-1)
+			if f.Meth[f.PC] == opcodes.FCMPG {
+				nanResult = 1
 			}
+			pushInt(f, compareFloats(value1, value2, nanResult))
 		case opcodes.DCMPL, opcodes.DCMPG: // 0x98, 0x97 - double comparison - they only differ in NaN treatment
-			value2 := pop(f).(float64)
-			pop(f)
-			value1 := pop(f).(float64)
-			pop(f)
-
-			if math.IsNaN(value1) || math.IsNaN(value2) {
-				if f.Meth[f.PC] == opcodes.DCMPG {
-					push(f, int64(1))
-				} else {
-					push(f, int64(-1))
-				}
-			} else if value1 > value2 {
-				push(f, int64(1))
-			} else if value1 < value2 {
-				push(f, int64(-1))
-			} else {
-				push(f, int64(0))
+			value2 := popDouble(f)
+			value1 := popDouble(f)
+			nanResult := int64(-1)
+			if f.Meth[f.PC] == opcodes.DCMPG {
+				nanResult = 1
 			}
+			pushInt(f, compareFloats(value1, value2, nanResult))
 		case opcodes.IFEQ: // 0x99 pop int, if it's == 0, go to the jump location
 			// specified in the next two bytes
 			popValue := pop(f)
@@ -1344,7 +1281,7 @@ func runFrame(fs *list.List) error {
 			}
 		case opcodes.IFLT: // 0x9B pop int, if it's < 0, go to the jump location
 			// specified in the next two bytes
-			value := pop(f).(int64)
+			value := popInt(f)
 			if value < 0 {
 				jumpTo := (int16(f.Meth[f.PC+1]) * 256) + int16(f.Meth[f.PC+2])
 				f.PC = f.PC + int(jumpTo) - 1
@@ -1353,7 +1290,7 @@ func runFrame(fs *list.List) error {
 			}
 		case opcodes.IFGE: // 0x9C pop int, if it's >= 0, go to the jump location
 			// specified in the next two bytes
-			value := pop(f).(int64)
+			value := popInt(f)
 			if value >= 0 {
 				jumpTo := (int16(f.Meth[f.PC+1]) * 256) + int16(f.Meth[f.PC+2])
 				f.PC = f.PC + int(jumpTo) - 1
@@ -1362,7 +1299,7 @@ func runFrame(fs *list.List) error {
 			}
 		case opcodes.IFGT: // 0x9D pop int, if it's > 0, go to the jump location
 			// specified in the next two bytes
-			value := pop(f).(int64)
+			value := popInt(f)
 			if value > 0 {
 				jumpTo := (int16(f.Meth[f.PC+1]) * 256) + int16(f.Meth[f.PC+2])
 				f.PC = f.PC + int(jumpTo) - 1
@@ -1371,7 +1308,7 @@ func runFrame(fs *list.List) error {
 			}
 		case opcodes.IFLE: // 0x9E pop int, if it's <= 0, go to the jump location
 			// specified in the next two bytes
-			value := pop(f).(int64)
+			value := popInt(f)
 			if value <= 0 {
 				jumpTo := (int16(f.Meth[f.PC+1]) * 256) + int16(f.Meth[f.PC+2])
 				f.PC = f.PC + int(jumpTo) - 1
@@ -1379,8 +1316,8 @@ func runFrame(fs *list.List) error {
 				f.PC += 2
 			}
 		case opcodes.IF_ICMPEQ: //  0x9F 	(jump if top two ints are equal)
-			val2 := pop(f).(int64)
-			val1 := pop(f).(int64)
+			val2 := popInt(f)
+			val1 := popInt(f)
 			if int32(val1) == int32(val2) { // if comp succeeds, next 2 bytes hold instruction index
 				jumpTo := (int16(f.Meth[f.PC+1]) * 256) + int16(f.Meth[f.PC+2])
 				f.PC = f.PC + int(jumpTo) - 1 // -1 b/c on the next iteration, pc is bumped by 1
@@ -1388,8 +1325,8 @@ func runFrame(fs *list.List) error {
 				f.PC += 2
 			}
 		case opcodes.IF_ICMPNE: //  0xA0    (jump if top two ints are not equal)
-			val2 := pop(f).(int64)
-			val1 := pop(f).(int64)
+			val2 := popInt(f)
+			val1 := popInt(f)
 			if int32(val1) != int32(val2) { // if comp succeeds, next 2 bytes hold instruction index
 				jumpTo := (int16(f.Meth[f.PC+1]) * 256) + int16(f.Meth[f.PC+2])
 				f.PC = f.PC + int(jumpTo) - 1 // -1 b/c on the next iteration, pc is bumped by 1
@@ -1397,8 +1334,8 @@ func runFrame(fs *list.List) error {
 				f.PC += 2
 			}
 		case opcodes.IF_ICMPLT: //  0xA1    (jump if popped val1 < popped val2)
-			val2 := pop(f).(int64)
-			val1 := pop(f).(int64)
+			val2 := popInt(f)
+			val1 := popInt(f)
 			val1a := val1
 			val2a := val2
 			if val1a < val2a { // if comp succeeds, next 2 bytes hold instruction index
@@ -1408,8 +1345,8 @@ func runFrame(fs *list.List) error {
 				f.PC += 2
 			}
 		case opcodes.IF_ICMPGE: //  0xA2    (jump if popped val1 >= popped val2)
-			val2 := pop(f).(int64)
-			val1 := pop(f).(int64)
+			val2 := popInt(f)
+			val1 := popInt(f)
 			if val1 >= val2 { // if comp succeeds, next 2 bytes hold instruction index
 				jumpTo := (int16(f.Meth[f.PC+1]) * 256) + int16(f.Meth[f.PC+2])
 				f.PC = f.PC + int(jumpTo) - 1 // -1 b/c on the next iteration, pc is bumped by 1
@@ -1417,8 +1354,8 @@ func runFrame(fs *list.List) error {
 				f.PC += 2
 			}
 		case opcodes.IF_ICMPGT: //  0xA3    (jump if popped val1 > popped val2)
-			val2 := pop(f).(int64)
-			val1 := pop(f).(int64)
+			val2 := popInt(f)
+			val1 := popInt(f)
 			if int32(val1) > int32(val2) { // if comp succeeds, next 2 bytes hold instruction index
 				jumpTo := (int16(f.Meth[f.PC+1]) * 256) + int16(f.Meth[f.PC+2])
 				f.PC = f.PC + int(jumpTo) - 1 // -1 b/c on the next iteration, pc is bumped by 1
@@ -1426,8 +1363,8 @@ func runFrame(fs *list.List) error {
 				f.PC += 2
 			}
 		case opcodes.IF_ICMPLE: //	0xA4	(jump if popped val1 <= popped val2)
-			val2 := pop(f).(int64)
-			val1 := pop(f).(int64)
+			val2 := popInt(f)
+			val1 := popInt(f)
 			if val1 <= val2 { // if comp succeeds, next 2 bytes hold instruction index
 				jumpTo := (int16(f.Meth[f.PC+1]) * 256) + int16(f.Meth[f.PC+2])
 				f.PC = f.PC + int(jumpTo) - 1 // -1 b/c on the next iteration, pc is bumped by 1
@@ -1455,98 +1392,121 @@ func runFrame(fs *list.List) error {
 		case opcodes.GOTO: // 0xA7     (goto an instruction)
 			jumpTo := (int16(f.Meth[f.PC+1]) * 256) + int16(f.Meth[f.PC+2])
 			f.PC = f.PC + int(jumpTo) - 1 // -1 because this loop will increment f.PC by 1
+		case opcodes.JSR: // 0xA8 (jump to a subroutine, pushing the address of the next instruction)
+			push(f, returnAddress(f.PC+3))
+			jumpTo := (int16(f.Meth[f.PC+1]) * 256) + int16(f.Meth[f.PC+2])
+			f.PC = f.PC + int(jumpTo) - 1 // -1 because this loop will increment f.PC by 1
+		case opcodes.RET: // 0xA9 (return from a subroutine to the address in local[index])
+			index := int(f.Meth[f.PC+1])
+			if err := retFromSubroutine(f, index); err != nil {
+				return err
+			}
+			continue // f.PC already points to the next instruction
+		case opcodes.TABLESWITCH: // 0xAA (jump to an offset chosen by an index into a table of jump offsets)
+			// the operands begin at the next 4-byte boundary relative to the start
+			// of the method. They are: default offset, low value, high value, and then
+			// (high - low + 1) jump offsets. All are signed 4-byte values and all jump
+			// offsets are relative to the address of this instruction.
+			basePC := f.PC
+			paddingBytes := 3 - (basePC % 4)
+			operandsPC := basePC + 1 + paddingBytes
+
+			defaultOffset := int(int32(binary.BigEndian.Uint32(f.Meth[operandsPC : operandsPC+4])))
+			low := int64(int32(binary.BigEndian.Uint32(f.Meth[operandsPC+4 : operandsPC+8])))
+			high := int64(int32(binary.BigEndian.Uint32(f.Meth[operandsPC+8 : operandsPC+12])))
+			index := popInt(f)
+
+			jumpOffset := defaultOffset
+			if index >= low && index <= high {
+				offsetPC := operandsPC + 12 + int(index-low)*4
+				jumpOffset = int(int32(binary.BigEndian.Uint32(f.Meth[offsetPC : offsetPC+4])))
+			}
+			f.PC = basePC + jumpOffset - 1 // -1 because this loop will increment f.PC by 1
+		case opcodes.LOOKUPSWITCH: // 0xAB (jump to an offset chosen by matching a key in a table of key/offset pairs)
+			// the operands begin at the next 4-byte boundary relative to the start
+			// of the method. They are: default offset, number of pairs, and then the
+			// pairs, each consisting of a match value and a jump offset. The pairs are
+			// sorted by match value. Jump offsets are relative to this instruction.
+			basePC := f.PC
+			paddingBytes := 3 - (basePC % 4)
+			operandsPC := basePC + 1 + paddingBytes
+
+			defaultOffset := int(int32(binary.BigEndian.Uint32(f.Meth[operandsPC : operandsPC+4])))
+			npairs := int(int32(binary.BigEndian.Uint32(f.Meth[operandsPC+4 : operandsPC+8])))
+			key := popInt(f)
+
+			jumpOffset := defaultOffset
+			pairsPC := operandsPC + 8
+			for i := 0; i < npairs; i++ {
+				pairPC := pairsPC + i*8
+				match := int64(int32(binary.BigEndian.Uint32(f.Meth[pairPC : pairPC+4])))
+				if match == key {
+					jumpOffset = int(int32(binary.BigEndian.Uint32(f.Meth[pairPC+4 : pairPC+8])))
+					break
+				}
+				if match > key { // the pairs are sorted, so there can be no later match
+					break
+				}
+			}
+			f.PC = basePC + jumpOffset - 1 // -1 because this loop will increment f.PC by 1
 		case opcodes.IRETURN: // 0xAC (return an int and exit current frame)
-			valToReturn := pop(f)
-			f = fs.Front().Next().Value.(*frames.Frame)
-			push(f, valToReturn) // TODO: check what happens when main() ends on IRETURN
-			return nil
+			valToReturn := popSlot(f)
+			caller := fs.Front().Next().Value.(*frames.Frame)
+			pushSlot(caller, valToReturn) // TODO: check what happens when main() ends on IRETURN
+			if f, err = returnToCaller(fs, entryDepth); f == nil {
+				return err
+			}
+			continue // the caller's PC already points past the invoke instruction
 		case opcodes.LRETURN: // 0xAD (return a long and exit current frame)
-			valToReturn := pop(f).(int64)
-			f = fs.Front().Next().Value.(*frames.Frame)
-			push(f, valToReturn) // pushed twice b/c a long uses two slots
-			push(f, valToReturn)
-			return nil
+			valToReturn := popLong(f)
+			caller := fs.Front().Next().Value.(*frames.Frame)
+			pushLong(caller, valToReturn) // pushed twice b/c a long uses two slots
+			if f, err = returnToCaller(fs, entryDepth); f == nil {
+				return err
+			}
+			continue
 		case opcodes.FRETURN: // 0xAE
-			valToReturn := pop(f).(float64)
-			f = fs.Front().Next().Value.(*frames.Frame)
-			push(f, valToReturn)
-			return nil
+			valToReturn := popFloat(f)
+			caller := fs.Front().Next().Value.(*frames.Frame)
+			pushFloat(caller, valToReturn)
+			if f, err = returnToCaller(fs, entryDepth); f == nil {
+				return err
+			}
+			continue
 		case opcodes.DRETURN: // 0xAF (return a double and exit current frame)
-			valToReturn := pop(f).(float64)
-			f = fs.Front().Next().Value.(*frames.Frame)
-			push(f, valToReturn) // pushed twice b/c a float uses two slots
-			push(f, valToReturn)
-			return nil
+			valToReturn := popDouble(f)
+			caller := fs.Front().Next().Value.(*frames.Frame)
+			pushDouble(caller, valToReturn) // pushed twice b/c a double uses two slots
+			if f, err = returnToCaller(fs, entryDepth); f == nil {
+				return err
+			}
+			continue
 		case opcodes.ARETURN: // 0xB0	(return a reference)
-			valToReturn := pop(f)
-			// prevFrame := f
-			f = fs.Front().Next().Value.(*frames.Frame)
-			push(f, valToReturn)
-			// fs.PushFront(prevFrame) //
-			return nil
+			valToReturn := popSlot(f)
+			caller := fs.Front().Next().Value.(*frames.Frame)
+			pushSlot(caller, valToReturn)
+			if f, err = returnToCaller(fs, entryDepth); f == nil {
+				return err
+			}
+			continue
 		case opcodes.RETURN: // 0xB1    (return from void function)
 			f.TOS = -1 // empty the stack
-			return nil
-		case opcodes.GETSTATIC: // 0xB2		(get static field)
-			CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2]) // next 2 bytes point to CP entry
-			f.PC += 2
-			CP := f.CP.(*classloader.CPool)
-			CPentry := CP.CpIndex[CPslot]
-			if CPentry.Type != classloader.FieldRef { // the pointed-to CP entry must be a field reference
-				glob := globals.GetGlobalRef()
-				glob.ErrorGoStack = string(debug.Stack())
-				errMsg := fmt.Sprintf("GETSTATIC: Expected a field ref, but got %d in"+
-					"location %d in method %s of class %s\n",
-					CPentry.Type, f.PC, f.MethName, f.ClName)
-				_ = log.Log(errMsg, log.SEVERE)
-				return errors.New(errMsg)
+			if f, err = returnToCaller(fs, entryDepth); f == nil {
+				return err
 			}
-
-			// get the field entry
-			field := CP.FieldRefs[CPentry.Slot]
-
-			// get the class entry from the field entry for this field. It's the class name.
-			classRef := field.ClassIndex
-			classNameIndex := CP.ClassRefs[CP.CpIndex[classRef].Slot]
-			classNameEntry := CP.CpIndex[classNameIndex]
-			className := CP.Utf8Refs[classNameEntry.Slot]
-
-			// process the name and type entry for this field
-			nAndTindex := field.NameAndType
-			nAndTentry := CP.CpIndex[nAndTindex]
-			nAndTslot := nAndTentry.Slot
-			nAndT := CP.NameAndTypes[nAndTslot]
-			fieldNameIndex := nAndT.NameIndex
-			fieldName := classloader.FetchUTF8stringFromCPEntryNumber(CP, fieldNameIndex)
-			fieldName = className + "." + fieldName
-
-			// was this static field previously loaded? Is so, get its location and move on.
-			prevLoaded, ok := classloader.Statics[fieldName]
-			if !ok { // if field is not already loaded, then
-				// the class has not been instantiated, so
-				// instantiate the class
-				_, err := InstantiateClass(className, fs)
-				if err == nil {
-					prevLoaded, ok = classloader.Statics[fieldName]
-				} else {
-					glob := globals.GetGlobalRef()
-					glob.ErrorGoStack = string(debug.Stack())
-					errMsg := fmt.Sprintf("GETSTATIC: could not load class %s", className)
-					_ = log.Log(errMsg, log.SEVERE)
-					return errors.New(errMsg)
+			continue
+		case opcodes.GETSTATIC: // 0xB2		(get static field)
+			fieldName, err := resolveStaticField(f, fs, "GETSTATIC")
+			if isInitializationError(err) {
+				if f, err = throwInitializationError(fs, err); err != nil {
+					return err
 				}
+				continue
 			}
-
-			// if the field can't be found even after instantiating the
-			// containing class, something is wrong so get out of here.
-			if !ok {
-				glob := globals.GetGlobalRef()
-				glob.ErrorGoStack = string(debug.Stack())
-				errMsg := fmt.Sprintf("GETSTATIC: could not find static field %s in class %s"+
-					"\n", fieldName, className)
-				_ = log.Log(errMsg, log.SEVERE)
-				return errors.New(errMsg)
+			if err != nil {
+				return err
 			}
+			prevLoaded, _ := classloader.GetStatic(fieldName)
 
 			switch prevLoaded.Value.(type) {
 			case bool:
@@ -1574,65 +1534,18 @@ func runFrame(fs *list.List) error {
 				push(f, prevLoaded.Value)
 			}
 
-		case opcodes.PUTSTATIC: // 0xB2		(get static field)
-			CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2]) // next 2 bytes point to CP entry
-			f.PC += 2
-			CP := f.CP.(*classloader.CPool)
-			CPentry := CP.CpIndex[CPslot]
-			if CPentry.Type != classloader.FieldRef { // the pointed-to CP entry must be a field reference
-				glob := globals.GetGlobalRef()
-				glob.ErrorGoStack = string(debug.Stack())
-				errMsg := fmt.Sprintf("PUTSTATIC: Expected a field ref, but got %d in"+
-					"location %d in method %s of class %s\n",
-					CPentry.Type, f.PC, f.MethName, f.ClName)
-				_ = log.Log(errMsg, log.SEVERE)
-				return errors.New(errMsg)
-			}
-
-			// get the field entry
-			field := CP.FieldRefs[CPentry.Slot]
-
-			// get the class entry from the field entry for this field. It's the class name.
-			classRef := field.ClassIndex
-			classNameIndex := CP.ClassRefs[CP.CpIndex[classRef].Slot]
-			classNameEntry := CP.CpIndex[classNameIndex]
-			className := CP.Utf8Refs[classNameEntry.Slot]
-
-			// process the name and type entry for this field
-			nAndTindex := field.NameAndType
-			nAndTentry := CP.CpIndex[nAndTindex]
-			nAndTslot := nAndTentry.Slot
-			nAndT := CP.NameAndTypes[nAndTslot]
-			fieldNameIndex := nAndT.NameIndex
-			fieldName := classloader.FetchUTF8stringFromCPEntryNumber(CP, fieldNameIndex)
-			fieldName = className + "." + fieldName
-
-			// was this static field previously loaded? Is so, get its location and move on.
-			prevLoaded, ok := classloader.Statics[fieldName]
-			if !ok { // if field is not already loaded, then
-				// the class has not been instantiated, so
-				// instantiate the class
-				_, err := InstantiateClass(className, fs)
-				if err == nil {
-					prevLoaded, ok = classloader.Statics[fieldName]
-				} else {
-					glob := globals.GetGlobalRef()
-					glob.ErrorGoStack = string(debug.Stack())
-					errMsg := fmt.Sprintf("PUTSTATIC: could not load class %s", className)
-					_ = log.Log(errMsg, log.SEVERE)
-					return errors.New(errMsg)
+		case opcodes.PUTSTATIC: // 0xB3		(put static field)
+			fieldName, err := resolveStaticField(f, fs, "PUTSTATIC")
+			if isInitializationError(err) {
+				if f, err = throwInitializationError(fs, err); err != nil {
+					return err
 				}
+				continue
 			}
-
-			// if the field can't be found even after instantiating the
-			// containing class, something is wrong so get out of here.
-			if !ok {
-				glob := globals.GetGlobalRef()
-				glob.ErrorGoStack = string(debug.Stack())
-				errMsg := fmt.Sprintf("PUTSTATIC: could not find static field %s", fieldName)
-				_ = log.Log(errMsg, log.SEVERE)
-				return errors.New(errMsg)
+			if err != nil {
+				return err
 			}
+			prevLoaded, _ := classloader.GetStatic(fieldName)
 
 			var value interface{}
 			switch prevLoaded.Type {
@@ -1641,16 +1554,16 @@ func runFrame(fs *list.List) error {
 				// be stored as a boolean, a byte (in an array), or int64
 				// We want all forms normalized to int64
 				value = pop(f).(int64) & 0x01
-				classloader.Statics[fieldName] = classloader.Static{
+				_ = classloader.AddStatic(fieldName, classloader.Static{
 					Type:  prevLoaded.Type,
 					Value: value,
-				}
+				})
 			case types.Char, types.Short, types.Int, types.Long:
 				value = pop(f).(int64)
-				classloader.Statics[fieldName] = classloader.Static{
+				_ = classloader.AddStatic(fieldName, classloader.Static{
 					Type:  prevLoaded.Type,
 					Value: value,
-				}
+				})
 			case types.Byte:
 				var val byte
 				v := pop(f)
@@ -1661,16 +1574,22 @@ func runFrame(fs *list.List) error {
 				case byte:
 					val = v.(byte)
 				}
-				classloader.Statics[fieldName] = classloader.Static{
+				_ = classloader.AddStatic(fieldName, classloader.Static{
 					Type:  prevLoaded.Type,
 					Value: val,
-				}
-			case types.Float, types.Double:
+				})
+			case types.Float:
+				value = toFloat32(pop(f).(float64))
+				_ = classloader.AddStatic(fieldName, classloader.Static{
+					Type:  prevLoaded.Type,
+					Value: value,
+				})
+			case types.Double:
 				value = pop(f).(float64)
-				classloader.Statics[fieldName] = classloader.Static{
+				_ = classloader.AddStatic(fieldName, classloader.Static{
 					Type:  prevLoaded.Type,
 					Value: value,
-				}
+				})
 
 			default:
 				// if it's not a primitive or a pointer to a class,
@@ -1679,10 +1598,10 @@ func runFrame(fs *list.List) error {
 				value = pop(f)
 				switch value.(type) {
 				case *object.Object:
-					classloader.Statics[fieldName] = classloader.Static{
+					_ = classloader.AddStatic(fieldName, classloader.Static{
 						Type:  prevLoaded.Type,
 						Value: value,
-					}
+					})
 				case *classloader.Klass:
 					// convert to an *object.Object
 					kPtr := value.(*classloader.Klass)
@@ -1695,10 +1614,10 @@ func runFrame(fs *list.List) error {
 					obj.Fields = append(obj.Fields, objField)
 					obj.FieldTable = nil
 
-					classloader.Statics[fieldName] = classloader.Static{
+					_ = classloader.AddStatic(fieldName, classloader.Static{
 						Type:  objField.Ftype,
 						Value: value,
-					}
+					})
 				default:
 					glob := globals.GetGlobalRef()
 					glob.ErrorGoStack = string(debug.Stack())
@@ -1730,6 +1649,8 @@ func runFrame(fs *list.List) error {
 			}
 
 			ref := pop(f).(*object.Object)
+			lock := object.FieldLock(ref) // see object/fieldLocks.go
+			lock.RLock()
 			obj := *ref
 
 			// var fieldName string
@@ -1751,6 +1672,7 @@ func runFrame(fs *list.List) error {
 				objField := obj.FieldTable[fieldName]
 				fieldValue = objField.Fvalue
 			}
+			lock.RUnlock()
 			push(f, fieldValue)
 
 			// doubles and longs consume two slots on the op stack
@@ -1792,6 +1714,8 @@ func runFrame(fs *list.List) error {
 				ref = pop(f).(*object.Object)
 			}
 
+			lock := object.FieldLock(ref.(*object.Object))
+			lock.Lock()
 			obj := *(ref.(*object.Object))
 
 			// if the value we're inserting is a reference to an
@@ -1818,6 +1742,7 @@ func runFrame(fs *list.List) error {
 				// the slot number in CP.Fields. It will be the same
 				// index into the object's fields.
 				if strings.HasPrefix(obj.Fields[fieldEntry.Slot].Ftype, types.Static) {
+					lock.Unlock()
 					glob := globals.GetGlobalRef()
 					glob.ErrorGoStack = string(debug.Stack())
 					errMsg := fmt.Sprintf("PUTFIELD: invalid attempt to update a static variable in %s.%s",
@@ -1826,6 +1751,9 @@ func runFrame(fs *list.List) error {
 					logTraceStack(f)
 					return errors.New(errMsg)
 				} else {
+					if v, ok := value.(float64); ok && obj.Fields[fieldEntry.Slot].Ftype == types.Float {
+						value = toFloat32(v)
+					}
 					obj.Fields[fieldEntry.Slot].Fvalue = value
 				}
 			} else {
@@ -1840,51 +1768,53 @@ func runFrame(fs *list.List) error {
 				fieldName := CP.Utf8Refs[nameCPentry.Slot]
 
 				objField := obj.FieldTable[fieldName]
+				if v, ok := value.(float64); ok && objField.Ftype == types.Float {
+					value = toFloat32(v)
+				}
 				objField.Fvalue = value
-				obj.FieldTable[fieldName] = objField
 			}
+			lock.Unlock()
 
 		case opcodes.INVOKEVIRTUAL: // 	0xB6 invokevirtual (create new frame, invoke function)
 			var err error
-			CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2]) // next 2 bytes point to CP entry
-			f.PC += 2
-			CP := f.CP.(*classloader.CPool)
-			CPentry := CP.CpIndex[CPslot]
-			if CPentry.Type != classloader.MethodRef { // the pointed-to CP entry must be a method reference
-				glob := globals.GetGlobalRef()
-				glob.ErrorGoStack = string(debug.Stack())
-				errMsg := fmt.Sprintf("INVOKEVIRTUAL: Expected a method ref, but got %d in"+
-					"location %d in method %s of class %s\n",
-					CPentry.Type, f.PC, f.MethName, f.ClName)
-				_ = log.Log(errMsg, log.SEVERE)
-				return errors.New(errMsg)
+			r := quickened(f)
+			if r == nil {
+				if r, err = resolveMethodRef(f, "INVOKEVIRTUAL"); err != nil {
+					return err
+				}
+				if err = loadReferencedClass(fs, f, r.className); err != nil {
+					return err
+				}
+				r.klass = fetchClassFor(f.Loader, r.className)
+				if r.klass != nil {
+					if err = checkLoaderConstraints(f, r.className, r.name, r.methodType); err != nil {
+						return err
+					}
+				}
+				r.ic = newInlineCache(f, f.PC, r.className, r.name, r.methodType)
+				quicken(f, f.PC, r)
 			}
+			f.PC += 2
+			className, methodName, methodType := r.className, r.name, r.methodType
+
+			// the method to execute is selected by the class of the object, which might
+			// override it. The site's inline cache holds the methods already selected.
+			receiver, haveReceiver := receiverClass(f, f.TOS-r.ic.paramSlots)
+			var mtEntry classloader.MTentry
+			if cached, ok := r.ic.lookup(receiver); haveReceiver && ok {
+				className, mtEntry = cached.clName, cached.mtEntry
+			} else {
+				version := classloader.MethAreaVersion()
+				selected, excType, err := selectVirtualMethod(f, className, r.klass, methodName, methodType)
+				if err != nil {
+					if f, err = throwJVMexception(fs, selectionErrorClass(excType), err.Error()); err != nil {
+						return err
+					}
+					continue
+				}
 
-			// get the methodRef entry
-			method := CP.MethodRefs[CPentry.Slot]
-
-			// get the class entry from this method
-			classRef := method.ClassIndex
-			classNameIndex := CP.ClassRefs[CP.CpIndex[classRef].Slot]
-			classNameEntry := CP.CpIndex[classNameIndex]
-			className := CP.Utf8Refs[classNameEntry.Slot]
-
-			// get the method name for this method
-			nAndTindex := method.NameAndType
-			nAndTentry := CP.CpIndex[nAndTindex]
-			nAndTslot := nAndTentry.Slot
-			nAndT := CP.NameAndTypes[nAndTslot]
-			methodNameIndex := nAndT.NameIndex
-			methodName := classloader.FetchUTF8stringFromCPEntryNumber(CP, methodNameIndex)
-
-			// get the signature for this method
-			methodSigIndex := nAndT.DescIndex
-			methodType := classloader.FetchUTF8stringFromCPEntryNumber(CP, methodSigIndex)
-
-			mtEntry := classloader.MTable[className+"."+methodName+methodType]
-			if mtEntry.Meth == nil { // if the method is not in the method table, find it
-				mtEntry, err = classloader.FetchMethodAndCP(className, methodName, methodType)
-				if err != nil || mtEntry.Meth == nil {
+				className, mtEntry = selected.ClName, selected.Meth
+				if mtEntry.Meth == nil {
 					// TODO: search the classpath and retry
 					glob := globals.GetGlobalRef()
 					glob.ErrorGoStack = string(debug.Stack())
@@ -1892,10 +1822,19 @@ func runFrame(fs *list.List) error {
 					_ = log.Log(errMsg, log.SEVERE)
 					return errors.New(errMsg)
 				}
+				if haveReceiver {
+					r.ic.add(version, receiver, className, mtEntry)
+				}
 			}
 
 			if mtEntry.MType == 'G' { // so we have a golang function
 				_, err = runGmethod(mtEntry, fs, className, methodName, methodType)
+				if exc, ok := err.(*gException); ok { // the method threw a Java exception
+					if f, err = throwGException(fs, exc); err != nil {
+						return err
+					}
+					continue
+				}
 				if err != nil {
 					// any exception message will already have been displayed to the user
 					glob := globals.GetGlobalRef()
@@ -1925,61 +1864,62 @@ func runFrame(fs *list.List) error {
 					errMsg := "INVOKEVIRTUAL: Error creating frame in: " + className + "." + methodName
 					return errors.New(errMsg)
 				}
-				f.PC += 1                            // move to next bytecode before exiting
-				fs.PushFront(fram)                   // push the new frame
-				f = fs.Front().Value.(*frames.Frame) // point f to the new head
-				return runFrame(fs)
-				/*
-					err = runFrame(fs)                   // 2nd on stack from new crash site
-					if err != nil {
-						return err
-					}
+				f.PC += 1 // move to the next bytecode before switching frames
+				if f, err = pushInvokedFrame(fs, f, fram); err != nil {
+					return err
+				}
+				continue // the invoked method is now the one being executed
+			}
+		case opcodes.INVOKESPECIAL: //	0xB7 invokespecial (invoke constructors, private methods, etc.)
+			r := quickened(f)
+			if r == nil {
+				CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2]) // next 2 bytes point to CP entry
+				CP := f.CP.(*classloader.CPool)
+				r = &resolvedOp{}
+				r.className, r.name, r.methodType = getMethInfoFromCPmethref(CP, CPslot)
+				if err := loadReferencedClass(fs, f, r.className); err != nil {
+					return err
+				}
 
-					// if the method is main(), then when we get here the
-					// frame stack will be empty to exit from here, otherwise
-					// there's still a frame on the stack, pop it off and continue.
-					if fs.Len() == 0 {
-						return nil
+				// a call to java/lang/Object."<init>":()V, which happens frequently, simply
+				// returns, so there's no method to fetch (see the test below)
+				if r.className+"."+r.name+r.methodType != "java/lang/Object.<init>()V" {
+					mtEntry, err := classloader.FetchMethodFor(f.Loader, r.className, r.name, r.methodType)
+					if err != nil || mtEntry.Meth == nil {
+						// TODO: search the classpath and retry
+						glob := globals.GetGlobalRef()
+						glob.ErrorGoStack = string(debug.Stack())
+						errMsg := "INVOKESPECIAL: Class method not found: " + r.className + "." + r.name
+						_ = log.Log(errMsg, log.SEVERE)
+						return errors.New(errMsg)
 					}
-					fs.Remove(fs.Front()) // pop the frame off
-
-					// the previous frame pop might have been main()
-					// if so, then we can't reset f to a non-existent frame
-					// so we test for this before resetting f.
-					if fs.Len() != 0 {
-						f = fs.Front().Value.(*frames.Frame)
-					} else {
-						return nil
+					if err = checkLoaderConstraints(f, r.className, r.name, r.methodType); err != nil {
+						return err
 					}
-
-				*/
+					r.mtEntry = mtEntry
+				}
+				quicken(f, f.PC, r)
 			}
-		case opcodes.INVOKESPECIAL: //	0xB7 invokespecial (invoke constructors, private methods, etc.)
-			CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2]) // next 2 bytes point to CP entry
 			f.PC += 2
-			CP := f.CP.(*classloader.CPool)
-			className, methName, methSig := getMethInfoFromCPmethref(CP, CPslot)
+			className, methName, methSig := r.className, r.name, r.methodType
 
 			// if it's a call to java/lang/Object."<init>":()V, which happens frequently,
 			// that function simply returns. So test for it here and if it is, skip the rest
-			fullConstructorName := className + "." + methName + methSig
-			if fullConstructorName == "java/lang/Object.<init>()V" {
+			if r.mtEntry.Meth == nil {
 				break
 			}
-
-			mtEntry, err := classloader.FetchMethodAndCP(className, methName, methSig)
-			if err != nil || mtEntry.Meth == nil {
-				// TODO: search the classpath and retry
-				glob := globals.GetGlobalRef()
-				glob.ErrorGoStack = string(debug.Stack())
-				errMsg := "INVOKESPECIAL: Class method not found: " + className + "." + methName
-				_ = log.Log(errMsg, log.SEVERE)
-				return errors.New(errMsg)
-			}
+			mtEntry := r.mtEntry
+			var err error
 
 			if mtEntry.MType == 'G' { // it's a golang method
 				// f, err = runGmethod(mtEntry, fs, className, className+"."+methName, methSig)
 				f, err = runGmethod(mtEntry, fs, className, methName, methSig)
+				if exc, ok := err.(*gException); ok { // the method threw a Java exception
+					if f, err = throwGException(fs, exc); err != nil {
+						return err
+					}
+					continue
+				}
 				if err != nil {
 					glob := globals.GetGlobalRef()
 					glob.ErrorGoStack = string(debug.Stack())
@@ -1998,67 +1938,90 @@ func runFrame(fs *list.List) error {
 					return errors.New(errMsg)
 				}
 
-				f.PC += 1
-				fs.PushFront(fram)                   // push the new frame
-				f = fs.Front().Value.(*frames.Frame) // point f to the new head
-				return runFrame(fs)
+				f.PC += 1 // move to the next bytecode before switching frames
+				if f, err = pushInvokedFrame(fs, f, fram); err != nil {
+					return err
+				}
+				continue // the invoked method is now the one being executed
 			}
 		case opcodes.INVOKESTATIC: // 	0xB8 invokestatic (create new frame, invoke static function)
-			CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2]) // next 2 bytes point to CP entry
-			f.PC += 2
-			CP := f.CP.(*classloader.CPool)
-			CPentry := CP.CpIndex[CPslot]
-			// get the methodRef entry
-			method := CP.MethodRefs[CPentry.Slot]
-
-			// get the class entry from this method
-			classRef := method.ClassIndex
-			classNameIndex := CP.ClassRefs[CP.CpIndex[classRef].Slot]
-			classNameEntry := CP.CpIndex[classNameIndex]
-			className := CP.Utf8Refs[classNameEntry.Slot]
-
-			// get the method name for this method
-			nAndTindex := method.NameAndType
-			nAndTentry := CP.CpIndex[nAndTindex]
-			nAndTslot := nAndTentry.Slot
-			nAndT := CP.NameAndTypes[nAndTslot]
-			methodNameIndex := nAndT.NameIndex
-			methodName := classloader.FetchUTF8stringFromCPEntryNumber(CP, methodNameIndex)
-
-			// get the signature for this method
-			methodSigIndex := nAndT.DescIndex
-			methodType := classloader.FetchUTF8stringFromCPEntryNumber(
-				CP, methodSigIndex)
-
-			mtEntry, err := classloader.FetchMethodAndCP(className, methodName, methodType)
-			if err != nil || mtEntry.Meth == nil {
-				// TODO: search the classpath and retry
-				glob := globals.GetGlobalRef()
-				glob.ErrorGoStack = string(debug.Stack())
-				errMsg := "INVOKESTATIC: Class method not found: " + className + "." + methodName
-				_ = log.Log(errMsg, log.SEVERE)
-				return errors.New(errMsg)
+			r := quickened(f)
+			if r == nil {
+				CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2]) // next 2 bytes point to CP entry
+				CP := f.CP.(*classloader.CPool)
+				CPentry := CP.CpIndex[CPslot]
+				// get the methodRef entry
+				method := CP.MethodRefs[CPentry.Slot]
+
+				// get the class entry from this method
+				classRef := method.ClassIndex
+				classNameIndex := CP.ClassRefs[CP.CpIndex[classRef].Slot]
+				classNameEntry := CP.CpIndex[classNameIndex]
+				className := CP.Utf8Refs[classNameEntry.Slot]
+
+				// get the method name for this method
+				nAndTindex := method.NameAndType
+				nAndTentry := CP.CpIndex[nAndTindex]
+				nAndTslot := nAndTentry.Slot
+				nAndT := CP.NameAndTypes[nAndTslot]
+				methodNameIndex := nAndT.NameIndex
+				methodName := classloader.FetchUTF8stringFromCPEntryNumber(CP, methodNameIndex)
+
+				// get the signature for this method
+				methodSigIndex := nAndT.DescIndex
+				methodType := classloader.FetchUTF8stringFromCPEntryNumber(
+					CP, methodSigIndex)
+
+				if err := loadReferencedClass(fs, f, className); err != nil {
+					return err
+				}
+				mtEntry, err := classloader.FetchMethodFor(f.Loader, className, methodName, methodType)
+				if err != nil || mtEntry.Meth == nil {
+					// TODO: search the classpath and retry
+					glob := globals.GetGlobalRef()
+					glob.ErrorGoStack = string(debug.Stack())
+					errMsg := "INVOKESTATIC: Class method not found: " + className + "." + methodName
+					_ = log.Log(errMsg, log.SEVERE)
+					return errors.New(errMsg)
+				}
+				if err = checkLoaderConstraints(f, className, methodName, methodType); err != nil {
+					return err
+				}
+				r = &resolvedOp{className: className, name: methodName, methodType: methodType,
+					mtEntry: mtEntry, klass: fetchClassFor(f.Loader, className)}
+				quicken(f, f.PC, r)
 			}
+			f.PC += 2
+			className, methodName, methodType, mtEntry := r.className, r.name, r.methodType, r.mtEntry
+			var err error
 
 			// before we can run the method, we need to either instantiate the class and/or
 			// make sure that its static intializer block (if any) has been run. At this point,
 			// all we know the class exists and has been loaded.
-			k := classloader.MethAreaFetch(className)
-			if k.Data.ClInit == types.ClInitNotRun {
-				err = runInitializationBlock(k, nil, fs)
-				if err != nil {
-					glob := globals.GetGlobalRef()
-					glob.ErrorGoStack = string(debug.Stack())
-					errMsg := fmt.Sprintf("INVOKESTATIC: error running initializer block in %s",
-						className)
-					_ = log.Log(errMsg, log.SEVERE)
-					return errors.New(errMsg)
+			err = runInitializationBlock(r.klass, nil, fs)
+			if isInitializationError(err) {
+				if f, err = throwInitializationError(fs, err); err != nil {
+					return err
 				}
+				continue
+			}
+			if err != nil {
+				glob := globals.GetGlobalRef()
+				glob.ErrorGoStack = string(debug.Stack())
+				errMsg := fmt.Sprintf("INVOKESTATIC: error running initializer block in %s",
+					className)
+				_ = log.Log(errMsg, log.SEVERE)
+				return errors.New(errMsg)
 			}
 
 			if mtEntry.MType == 'G' {
 				f, err = runGmethod(mtEntry, fs, className, methodName, methodType)
-
+				if exc, ok := err.(*gException); ok { // the method threw a Java exception
+					if f, err = throwGException(fs, exc); err != nil {
+						return err
+					}
+					continue
+				}
 				if err != nil {
 					// any exceptions message will already have been displayed to the user
 					glob := globals.GetGlobalRef()
@@ -2077,56 +2040,192 @@ func runFrame(fs *list.List) error {
 						className + "." + methodName)
 				}
 
-				f.PC += 1                            // point to the next bytecode before exiting
-				fs.PushFront(fram)                   // push the new frame
-				f = fs.Front().Value.(*frames.Frame) // point f to the new head
-				return runFrame(fs)
-				// err = runFrame(fs)                   // 2nd on stack from new crash site
-				// if err != nil {
-				// 	return err
-				// }
-
-				/*
-					// if the static method is main(), when we get here the
-					// frame stack will be empty to exit from here, otherwise
-					// there's still a frame on the stack, pop it off and continue.
-					if fs.Len() == 0 {
-						return nil
-					}
-					fs.Remove(fs.Front()) // pop the frame off
+				f.PC += 1 // move to the next bytecode before switching frames
+				if f, err = pushInvokedFrame(fs, f, fram); err != nil {
+					return err
+				}
+				continue // the invoked method is now the one being executed
+			}
+		case opcodes.INVOKEINTERFACE: // 0xB9 invokeinterface (invoke interface method on an object)
+			// the two bytes after the opcode point to an interface method ref in the CP.
+			// They're followed by the count of argument slots (including the object
+			// reference) and a zero byte.
+			r := quickened(f)
+			if r == nil {
+				CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2])
+				CP := f.CP.(*classloader.CPool)
+				if CPslot < 1 || CPslot >= len(CP.CpIndex) || CP.CpIndex[CPslot].Type != classloader.Interface {
+					glob := globals.GetGlobalRef()
+					glob.ErrorGoStack = string(debug.Stack())
+					errMsg := fmt.Sprintf("INVOKEINTERFACE: Expected an interface method ref at CP entry %d "+
+						"in method %s of class %s", CPslot, f.MethName, f.ClName)
+					_ = log.Log(errMsg, log.SEVERE)
+					return errors.New(errMsg)
+				}
+				r = &resolvedOp{}
+				r.className, r.name, r.methodType = getMethInfoFromCPinterfaceRef(CP, CPslot)
 
-					// the previous frame pop might have been main()
-					// if so, then we can't reset f to a non-existent frame
-					// so we test for this before resetting f.
-					if fs.Len() != 0 {
-						f = fs.Front().Value.(*frames.Frame)
-					} else {
-						return nil
+				if err = loadReferencedClass(fs, f, r.className); err != nil {
+					return err
+				}
+
+				// the resolved class must be an interface
+				k := fetchClassFor(f.Loader, r.className)
+				if k != nil && k.Data != nil && !k.Data.Access.ClassIsInterface {
+					errMsg := fmt.Sprintf("Found class %s, but interface was expected",
+						strings.ReplaceAll(r.className, "/", "."))
+					if f, err = throwJVMexception(fs, "java/lang/IncompatibleClassChangeError", errMsg); err != nil {
+						return err
 					}
+					continue
+				}
+				if err = checkLoaderConstraints(f, r.className, r.name, r.methodType); err != nil {
+					return err
+				}
+				r.klass = k
+				r.ic = newInlineCache(f, f.PC, r.className, r.name, r.methodType)
+				quicken(f, f.PC, r)
+			}
+			count := int(f.Meth[f.PC+3])
+			f.PC += 4
+			interfaceName, methodName, methodType := r.className, r.name, r.methodType
 
-				*/
+			if count < 1 || f.TOS-(count-1) < 0 {
+				glob := globals.GetGlobalRef()
+				glob.ErrorGoStack = string(debug.Stack())
+				errMsg := fmt.Sprintf("INVOKEINTERFACE: Invalid argument count %d for %s.%s%s",
+					count, interfaceName, methodName, methodType)
+				_ = log.Log(errMsg, log.SEVERE)
+				return errors.New(errMsg)
 			}
-		case opcodes.NEW: // 0xBB 	new: create and instantiate a new object
-			CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2]) // next 2 bytes point to CP entry
-			f.PC += 2
-			CP := f.CP.(*classloader.CPool)
-			CPentry := CP.CpIndex[CPslot]
-			if CPentry.Type != classloader.ClassRef && CPentry.Type != classloader.Interface {
+
+			// the object reference sits beneath the arguments on the operand stack
+			objRef := f.OpStack[f.TOS-(count-1)]
+			if object.IsNull(objRef) {
+				errMsg := fmt.Sprintf("Cannot invoke \"%s.%s%s\" because the object is null",
+					strings.ReplaceAll(interfaceName, "/", "."), methodName, methodType)
+				if f, err = throwJVMexception(fs, "java/lang/NullPointerException", errMsg); err != nil {
+					return err
+				}
+				continue
+			}
+			obj := objRef.(*object.Object)
+
+			// the method is selected by the object's class, unless the site's inline
+			// cache already holds the method selected for that class
+			var itEntry classloader.ITentry
+			receiver := classloader.ObjectKlass(obj)
+			if cached, ok := r.ic.lookup(receiver); receiver != nil && ok {
+				itEntry = classloader.ITentry{ClName: cached.clName, Meth: cached.mtEntry}
+			} else {
+				version := classloader.MethAreaVersion()
+				var excType int
+				itEntry, excType, err = selectInterfaceMethod(receiver, r.klass,
+					methodName, methodType)
+				if err != nil {
+					if f, err = throwJVMexception(fs, selectionErrorClass(excType), err.Error()); err != nil {
+						return err
+					}
+					continue
+				}
+				if receiver != nil {
+					r.ic.add(version, receiver, itEntry.ClName, itEntry.Meth)
+				}
+			}
+
+			if itEntry.Meth.MType == 'G' { // so we have a golang function
+				_, err = runGmethod(itEntry.Meth, fs, itEntry.ClName, methodName, methodType)
+				if exc, ok := err.(*gException); ok { // the method threw a Java exception
+					if f, err = throwGException(fs, exc); err != nil {
+						return err
+					}
+					continue
+				}
+				if err != nil {
+					// any exception message will already have been displayed to the user
+					glob := globals.GetGlobalRef()
+					glob.ErrorGoStack = string(debug.Stack())
+					errMsg := fmt.Sprintf("INVOKEINTERFACE: Error encountered in: %s.%s",
+						itEntry.ClName, methodName)
+					return errors.New(errMsg)
+				}
+				break
+			}
+
+			m := itEntry.Meth.Meth.(classloader.JmEntry)
+			if m.AccessFlags&0x0100 > 0 {
+				// Native code
 				glob := globals.GetGlobalRef()
 				glob.ErrorGoStack = string(debug.Stack())
-				errMsg := fmt.Sprintf("NEW: Invalid type for new object")
+				errMsg := "INVOKEINTERFACE: Native method requested: " + itEntry.ClName + "." + methodName
 				_ = log.Log(errMsg, log.SEVERE)
 				return errors.New(errMsg)
 			}
+			fram, err := createAndInitNewFrame(
+				itEntry.ClName, methodName, methodType, &m, true, f)
+			if err != nil {
+				glob := globals.GetGlobalRef()
+				glob.ErrorGoStack = string(debug.Stack())
+				errMsg := "INVOKEINTERFACE: Error creating frame in: " + itEntry.ClName + "." + methodName
+				return errors.New(errMsg)
+			}
+			f.PC += 1 // move to the next bytecode before switching frames
+			if f, err = pushInvokedFrame(fs, f, fram); err != nil {
+				return err
+			}
+			continue // the invoked method is now the one being executed
+		case opcodes.INVOKEDYNAMIC: // 0xBA invokedynamic (invoke the method linked to this call site)
+			// the two bytes after the opcode point to an invokedynamic entry in the CP.
+			// They're followed by two zero bytes. See invokeDynamic.go for details.
+			CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2])
+			err := invokeDynamic(f, fs, CPslot)
+			if exc, ok := err.(*gException); ok { // e.g., a toString() in a concatenation threw
+				if f, err = throwGException(fs, exc); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				glob := globals.GetGlobalRef()
+				glob.ErrorGoStack = string(debug.Stack())
+				return err
+			}
+			f.PC += 4
+		case opcodes.NEW: // 0xBB 	new: create and instantiate a new object
+			r := quickened(f)
+			if r == nil {
+				CPslot := (int(f.Meth[f.PC+1]) * 256) + int(f.Meth[f.PC+2]) // next 2 bytes point to CP entry
+				CP := f.CP.(*classloader.CPool)
+				CPentry := CP.CpIndex[CPslot]
+				if CPentry.Type != classloader.ClassRef && CPentry.Type != classloader.Interface {
+					glob := globals.GetGlobalRef()
+					glob.ErrorGoStack = string(debug.Stack())
+					errMsg := fmt.Sprintf("NEW: Invalid type for new object")
+					_ = log.Log(errMsg, log.SEVERE)
+					return errors.New(errMsg)
+				}
 
-			// the classref points to a UTF8 record with the name of the class to instantiate
-			var className string
-			if CPentry.Type == classloader.ClassRef {
-				utf8Index := CP.ClassRefs[CPentry.Slot]
-				className = classloader.FetchUTF8stringFromCPEntryNumber(CP, utf8Index)
+				// the classref points to a UTF8 record with the name of the class to instantiate
+				r = &resolvedOp{}
+				if CPentry.Type == classloader.ClassRef {
+					utf8Index := CP.ClassRefs[CPentry.Slot]
+					r.className = classloader.FetchUTF8stringFromCPEntryNumber(CP, utf8Index)
+				}
+				if err := loadReferencedClass(fs, f, r.className); err != nil {
+					return err
+				}
+				quicken(f, f.PC, r)
 			}
+			f.PC += 2
+			className := r.className
 
-			ref, err := InstantiateClass(className, fs)
+			ref, err := instantiateClassFor(f.Loader, className, fs)
+			if isInitializationError(err) {
+				if f, err = throwInitializationError(fs, err); err != nil {
+					return err
+				}
+				continue
+			}
 			if err != nil {
 				glob := globals.GetGlobalRef()
 				glob.ErrorGoStack = string(debug.Stack())
@@ -2238,13 +2337,12 @@ func runFrame(fs *list.List) error {
 				return errors.New(errMsg)
 			}
 
-			// capture the golang stack
-			stack := string(debug.Stack())
-			glob := globals.GetGlobalRef()
-			glob.ErrorGoStack = stack
-
-			// capture the JVM frame stack
-			glob.JVMframeStack = exceptions.GrabFrameStack(fs)
+			// find the handler for this exception, which might be in this method or
+			// in a calling method. If found, execution resumes there.
+			if f, err = throwObject(fs, objectRef.(*object.Object)); err != nil {
+				return err
+			}
+			continue
 
 		case opcodes.CHECKCAST: // 0xC0 same as INSTANCEOF but throws exception on null
 			// because this uses the same logic as INSTANCEOF, any change here should
@@ -2292,7 +2390,7 @@ func runFrame(fs *list.List) error {
 				}
 
 				className = *(classNamePtr.stringVal)
-				if MainThread.Trace {
+				if trace {
 					var traceInfo string
 					if strings.HasPrefix(className, "[") {
 						traceInfo = fmt.Sprintf("CHECKCAST: class is an array = %s", className)
@@ -2324,17 +2422,14 @@ func runFrame(fs *list.List) error {
 						return errors.New(errMsg)
 					}
 				} else { // the object being checked is a class
-					classPtr := classloader.MethAreaFetch(className)
-					if classPtr == nil { // class wasn't loaded, so load it now
-						if classloader.LoadClassFromNameOnly(className) != nil {
-							glob := globals.GetGlobalRef()
-							glob.ErrorGoStack = string(debug.Stack())
-							return errors.New("CHECKCAST: Could not load class: " + className)
-						}
-						classPtr = classloader.MethAreaFetch(className)
+					classPtr := fetchClassFor(f.Loader, className) // loads the class if need be
+					if classPtr == nil {
+						glob := globals.GetGlobalRef()
+						glob.ErrorGoStack = string(debug.Stack())
+						return errors.New("CHECKCAST: Could not load class: " + className)
 					}
 
-					if classPtr != classloader.MethAreaFetch(*obj.Klass) {
+					if classPtr != classloader.ObjectKlass(obj) {
 						glob := globals.GetGlobalRef()
 						glob.ErrorGoStack = string(debug.Stack())
 						errMsg := fmt.Sprintf("CHECKCAST: %s is not castable with respect to %s", className, classPtr.Data.Name)
@@ -2380,23 +2475,20 @@ func runFrame(fs *list.List) error {
 							return errors.New(errMsg)
 						} else {
 							className = *(classNamePtr.stringVal)
-							if MainThread.Trace {
+							if trace {
 								traceInfo := fmt.Sprintf("INSTANCEOF: className = %s", className)
 								_ = log.Log(traceInfo, log.TRACE_INST)
 							}
 						}
-						classPtr := classloader.MethAreaFetch(className)
-						if classPtr == nil { // class wasn't loaded, so load it now
-							if classloader.LoadClassFromNameOnly(className) != nil {
-								glob := globals.GetGlobalRef()
-								glob.ErrorGoStack = string(debug.Stack())
-								errMsg := "INSTANCEOF: Could not load class: " + className
-								_ = log.Log(errMsg, log.SEVERE)
-								return errors.New(errMsg)
-							}
-							classPtr = classloader.MethAreaFetch(className)
+						classPtr := fetchClassFor(f.Loader, className) // loads the class if need be
+						if classPtr == nil {
+							glob := globals.GetGlobalRef()
+							glob.ErrorGoStack = string(debug.Stack())
+							errMsg := "INSTANCEOF: Could not load class: " + className
+							_ = log.Log(errMsg, log.SEVERE)
+							return errors.New(errMsg)
 						}
-						if classPtr == classloader.MethAreaFetch(*obj.Klass) {
+						if classPtr == classloader.ObjectKlass(&obj) {
 							push(f, int64(1))
 						} else {
 							push(f, int64(0))
@@ -2405,9 +2497,66 @@ func runFrame(fs *list.List) error {
 				}
 			}
 
-		case opcodes.MONITORENTER, opcodes.MONITOREXIT: // OxC2 and OxC3. These  are not implemented in the JDK JVM
-			_ = pop(f) // so just pop off the reference on the stack
+		case opcodes.MONITORENTER: // 0xC2 (enter the monitor of the object on the stack)
+			ref := pop(f)
+			if object.IsNull(ref) {
+				if f, err = throwJVMexception(fs, "java/lang/NullPointerException",
+					"MONITORENTER: Invalid (null) reference to an object"); err != nil {
+					return err
+				}
+				continue
+			}
+			object.MonitorEnter(ref, f.Thread) // blocks while another thread holds the monitor
+		case opcodes.MONITOREXIT: // 0xC3 (exit the monitor of the object on the stack)
+			ref := pop(f)
+			if object.IsNull(ref) {
+				if f, err = throwJVMexception(fs, "java/lang/NullPointerException",
+					"MONITOREXIT: Invalid (null) reference to an object"); err != nil {
+					return err
+				}
+				continue
+			}
+			if !object.MonitorExit(ref, f.Thread) { // the thread doesn't hold the monitor
+				if f, err = throwJVMexception(fs, "java/lang/IllegalMonitorStateException",
+					"current thread is not owner"); err != nil {
+					return err
+				}
+				continue
+			}
 
+		case opcodes.WIDE: // 0xC4 (the following load, store, iinc, or ret uses a two-byte local index)
+			opcode := f.Meth[f.PC+1]
+			index := int(binary.BigEndian.Uint16(f.Meth[f.PC+2 : f.PC+4]))
+			switch opcode {
+			case opcodes.ILOAD, opcodes.FLOAD, opcodes.ALOAD:
+				pushSlot(f, loadSlot(f, index))
+			case opcodes.LLOAD, opcodes.DLOAD:
+				pushSlot(f, loadSlot(f, index))
+				pushSlot(f, loadSlot(f, index)) // push twice due to item being 64 bits wide
+			case opcodes.ISTORE, opcodes.FSTORE, opcodes.ASTORE:
+				storeSlot(f, index, popSlot(f))
+			case opcodes.LSTORE, opcodes.DSTORE:
+				// longs and doubles are stored in localvar[x] and again in localvar[x+1]
+				storeSlot(f, index, popSlot(f))
+				storeSlot(f, index+1, popSlot(f))
+			case opcodes.IINC: // the increment is a signed two-byte value
+				increment := int64(int16(binary.BigEndian.Uint16(f.Meth[f.PC+4 : f.PC+6])))
+				storeInt(f, index, loadInt(f, index)+increment)
+				f.PC += 2
+			case opcodes.RET:
+				if err := retFromSubroutine(f, index); err != nil {
+					return err
+				}
+				continue // f.PC already points to the next instruction
+			default:
+				glob := globals.GetGlobalRef()
+				glob.ErrorGoStack = string(debug.Stack())
+				errMsg := fmt.Sprintf("WIDE: Invalid bytecode %s (0x%X) at location %d in method %s() of class %s",
+					opcodes.BytecodeNames[opcode], opcode, f.PC+1, f.MethName, f.ClName)
+				_ = log.Log(errMsg, log.SEVERE)
+				return errors.New(errMsg)
+			}
+			f.PC += 3
 		case opcodes.MULTIANEWARRAY: // 0xC5 create multi-dimensional array
 			var arrayDesc string
 			var arrayType uint8
@@ -2540,50 +2689,13 @@ func runFrame(fs *list.List) error {
 				f.PC += 2
 			}
 
-		case opcodes.IMPDEP2: // 0xFF private bytecode to flag an error. Next byte shows error type.
-			glob := globals.GetGlobalRef()
-			glob.ErrorGoStack = string(debug.Stack())
-			errCode := f.Meth[2]
-			switch errCode {
-			case 0x01: // stack overflow
-				bytes := make([]byte, 2)
-				bytes[0] = f.Meth[3]
-				bytes[1] = f.Meth[4]
-				location := int16(binary.BigEndian.Uint16(bytes))
-
-				methName := fmt.Sprintf("%s.%s", f.ClName, f.MethName)
-				rootCause := "stack overflow"
-				exceptions.ShowPanicCause(rootCause)
-				errMsg := fmt.Sprintf("Method: %-40s PC: %03d", methName, location)
-				_ = log.Log(errMsg, log.SEVERE)
-
-				fs.Remove(fs.Front()) // having reported on this frame's error, pop the frame off
-				// return errors.New(rootCause)
-				return errors.New(string(debug.Stack()))
-
-			case 0x02: // stack underflow
-				bytes := make([]byte, 2)
-				bytes[0] = f.Meth[3]
-				bytes[1] = f.Meth[4]
-				location := int16(binary.BigEndian.Uint16(bytes))
-				methName := fmt.Sprintf("%s.%s", f.ClName, f.MethName)
-				rootCause := "stack underflow"
-				exceptions.ShowPanicCause(rootCause)
-				errMsg := fmt.Sprintf("Method: %-40s PC: %03d", methName, location)
-				_ = log.Log(errMsg, log.SEVERE)
-
-				// stack := getStackTraces(fs)
-				// rawStackTraces := *(stack.FieldTable["stackTrace"])
-				// traces := rawStackTraces.Fvalue.([]*object.Object)
-				// msg := fmt.Sprintf("Size of Java stack trace : %d entries", len(traces))
-				// _ = log.Log(msg, log.SEVERE)
-
-				fs.Remove(fs.Front()) // having reported on this frame's error, pop the frame off
-				return errors.New(string(debug.Stack()))
-
-			default:
-				return errors.New("unknown error encountered")
-			}
+		case opcodes.GOTO_W: // 0xC8 (goto an instruction, using a four-byte offset)
+			jumpTo := int32(binary.BigEndian.Uint32(f.Meth[f.PC+1 : f.PC+5]))
+			f.PC = f.PC + int(jumpTo) - 1 // -1 because this loop will increment f.PC by 1
+		case opcodes.JSR_W: // 0xC9 (jump to a subroutine, using a four-byte offset)
+			push(f, returnAddress(f.PC+5))
+			jumpTo := int32(binary.BigEndian.Uint32(f.Meth[f.PC+1 : f.PC+5]))
+			f.PC = f.PC + int(jumpTo) - 1 // -1 because this loop will increment f.PC by 1
 
 		default:
 			missingOpCode := fmt.Sprintf("%d (0x%X)", f.Meth[f.PC], f.Meth[f.PC])
@@ -2604,6 +2716,74 @@ func runFrame(fs *list.List) error {
 	return nil
 }
 
+// pushInvokedFrame pushes the frame of a method called by one of the invoke
+// instructions onto the frame stack fs, so that runFrame() can switch to it, and
+// returns it. f is the frame of the calling method. If the frame stack is already at
+// its limit (see -Xss), a java/lang/StackOverflowError is thrown instead, and the
+// frame of its handler is returned. An error is returned only if it's not caught.
+func pushInvokedFrame(fs *list.List, f, fram *frames.Frame) (*frames.Frame, error) {
+	err := frames.PushFrame(fs, fram)
+	if err != nil {
+		_ = log.Log(fmt.Sprintf("%s, calling %s.%s%s", err.Error(),
+			fram.ClName, fram.MethName, fram.MethType), log.FINE)
+		f.PC -= 1 // the error is thrown by the invoke instruction, so point back into it
+		exitMethodMonitor(fram)
+		return throwJVMexception(fs, "java/lang/StackOverflowError", "")
+	}
+	return fram, nil
+}
+
+// returnToCaller is called by runFrame() when the method in the frame at the head of
+// fs returns. If that frame is the one runFrame() was called to execute (whose depth
+// in fs is entryDepth), it's left on fs and nil is returned. Otherwise, the frame is
+// popped off and the frame of the calling method, in which execution resumes, is returned.
+//
+// If the method is synchronized, the monitor it entered is exited first. If the thread
+// no longer holds that monitor, the return instruction throws an
+// IllegalMonitorStateException instead, and the frame of its handler is returned. An
+// error is returned only if the exception is not caught.
+func returnToCaller(fs *list.List, entryDepth int) (*frames.Frame, error) {
+	if f := fs.Front().Value.(*frames.Frame); f.Monitor != nil {
+		monitor := f.Monitor
+		f.Monitor = nil
+		if !object.MonitorExit(monitor, f.Thread) {
+			return throwJVMexception(fs, "java/lang/IllegalMonitorStateException",
+				"current thread is not owner")
+		}
+	}
+
+	if fs.Len() <= entryDepth {
+		return nil, nil
+	}
+	fs.Remove(fs.Front())
+	return fs.Front().Value.(*frames.Frame), nil
+}
+
+// enterMethodMonitor enters the monitor that a synchronized method holds while it runs
+// in frame fram: that of the object it's called on (in local 0) or, if it's static, that
+// of its class. It's called when the method's frame is created.
+func enterMethodMonitor(fram *frames.Frame, m *classloader.JmEntry) {
+	if m.AccessFlags&0x0020 == 0 { // 0x0020 = synchronized
+		return
+	}
+	if m.AccessFlags&0x0008 != 0 { // 0x0008 = static
+		fram.Monitor = classloader.MethAreaFetchFor(fram.Loader, fram.ClName)
+	} else {
+		fram.Monitor = getLocal(fram, 0)
+	}
+	object.MonitorEnter(fram.Monitor, fram.Thread)
+}
+
+// exitMethodMonitor exits the monitor that the method in frame fram holds, if it's
+// synchronized. It's called when the method exits by an exception or its frame is not
+// pushed. (The return instructions check that the thread still holds the monitor.)
+func exitMethodMonitor(fram *frames.Frame) {
+	if fram.Monitor != nil {
+		object.MonitorExit(fram.Monitor, fram.Thread)
+		fram.Monitor = nil
+	}
+}
+
 // Log the existing stack
 // Could be called for tracing -or- supply info for an error section
 func logTraceStack(f *frames.Frame) {
@@ -2614,21 +2794,21 @@ func logTraceStack(f *frames.Frame) {
 		return
 	}
 	for ii := 0; ii <= f.TOS; ii++ {
-		switch f.OpStack[ii].(type) {
+		value := slotValue(f.OpStack[ii], f.OpPrims[ii])
+		switch value.(type) {
 		case *object.Object:
-			if object.IsNull(f.OpStack[ii].(*object.Object)) {
+			if object.IsNull(value.(*object.Object)) {
 				output = fmt.Sprintf("<null>")
 			} else {
-				objPtr := f.OpStack[ii].(*object.Object)
+				objPtr := value.(*object.Object)
 				output = objPtr.FormatField()
 			}
 		case *[]uint8:
-			value := f.OpStack[ii]
 			strPtr := value.(*[]byte)
 			str := string(*strPtr)
 			output = fmt.Sprintf("*[]byte: %-10s", str)
 		default:
-			output = fmt.Sprintf("%T %v ", f.OpStack[ii], f.OpStack[ii])
+			output = fmt.Sprintf("%T %v ", value, value)
 		}
 		if f.TOS == ii {
 			traceInfo = fmt.Sprintf("%55s TOS   [%d] %s", "", ii, output)
@@ -2646,22 +2826,22 @@ func emitTraceData(f *frames.Frame) string {
 	var stackTop = ""
 	if f.TOS != -1 {
 		tos = fmt.Sprintf("%2d", f.TOS)
-		switch f.OpStack[f.TOS].(type) {
+		value := slotValue(f.OpStack[f.TOS], f.OpPrims[f.TOS])
+		switch value.(type) {
 		// if the value at TOS is a string, say so and print the first 10 chars of the string
 		case *object.Object:
-			if object.IsNull(f.OpStack[f.TOS].(*object.Object)) {
+			if object.IsNull(value.(*object.Object)) {
 				stackTop = fmt.Sprintf("<null>")
 			} else {
-				objPtr := f.OpStack[f.TOS].(*object.Object)
+				objPtr := value.(*object.Object)
 				stackTop = objPtr.FormatField()
 			}
 		case *[]uint8:
-			value := f.OpStack[f.TOS]
 			strPtr := value.(*[]byte)
 			str := string(*strPtr)
 			stackTop = fmt.Sprintf("*[]byte: %-10s", str)
 		default:
-			stackTop = fmt.Sprintf("%T %v ", f.OpStack[f.TOS], f.OpStack[f.TOS])
+			stackTop = fmt.Sprintf("%T %v ", value, value)
 		}
 	}
 
@@ -2678,88 +2858,71 @@ func emitTraceData(f *frames.Frame) string {
 
 // pop from the operand stack.
 func pop(f *frames.Frame) interface{} {
-	var value interface{}
+	s := popSlot(f)
+	return slotValue(s.value, s.prim)
+}
 
+// tracePop shows the value being popped off the operand stack. As with all
+// traces, it shows the TOS *before* its value is changed.
+func tracePop(f *frames.Frame, value interface{}) {
+	var traceInfo string
 	if f.TOS == -1 {
-		glob := globals.GetGlobalRef()
-		glob.ErrorGoStack = string(debug.Stack())
-		exceptions.FormatStackUnderflowError(f)
-		value = nil
+		traceInfo = fmt.Sprintf("%74s", "POP           TOS:  -")
 	} else {
-		value = f.OpStack[f.TOS]
-	}
-
-	// we show trace info of the TOS *before* we change its value--
-	// all traces show TOS before the instruction is executed.
-	if MainThread.Trace {
-		var traceInfo string
-		if f.TOS == -1 {
-			traceInfo = fmt.Sprintf("%74s", "POP           TOS:  -")
+		if value == nil {
+			traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
+				fmt.Sprintf("%3d <nil>", f.TOS)
 		} else {
-			if value == nil {
-				traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
-					fmt.Sprintf("%3d <nil>", f.TOS)
-			} else {
-				switch value.(type) {
-				case *object.Object:
-					obj := value.(*object.Object)
-					if obj == nil {
-						traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
-							fmt.Sprintf("%3d null", f.TOS)
-						break
-					}
-					if len(obj.Fields) > 0 {
-						if obj.Fields[0].Ftype == "[B" {
-							if obj.Fields[0].Fvalue == nil {
-								traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
-									fmt.Sprintf("%3d []byte]: <nil>", f.TOS)
-							} else {
-								strVal := (obj.Fields[0].Fvalue).(*[]byte)
-								str := string(*strVal)
-								traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
-									fmt.Sprintf("%3d String: %-10s", f.TOS, str)
-							}
+			switch value.(type) {
+			case *object.Object:
+				obj := value.(*object.Object)
+				if obj == nil {
+					traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
+						fmt.Sprintf("%3d null", f.TOS)
+					break
+				}
+				if len(obj.Fields) > 0 {
+					if obj.Fields[0].Ftype == "[B" {
+						if obj.Fields[0].Fvalue == nil {
+							traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
+								fmt.Sprintf("%3d []byte]: <nil>", f.TOS)
 						} else {
+							strVal := (obj.Fields[0].Fvalue).(*[]byte)
+							str := string(*strVal)
 							traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
-								fmt.Sprintf("%3d *Object: %v", f.TOS, value)
+								fmt.Sprintf("%3d String: %-10s", f.TOS, str)
 						}
 					} else {
 						traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
 							fmt.Sprintf("%3d *Object: %v", f.TOS, value)
 					}
-				case *[]uint8:
-					strPtr := value.(*[]byte)
-					str := string(*strPtr)
-					traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
-						fmt.Sprintf("%3d *[]byte: %-10s", f.TOS, str)
-				default:
+				} else {
 					traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
-						fmt.Sprintf("%3d %T %v", f.TOS, value, value)
+						fmt.Sprintf("%3d *Object: %v", f.TOS, value)
 				}
+			case *[]uint8:
+				strPtr := value.(*[]byte)
+				str := string(*strPtr)
+				traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
+					fmt.Sprintf("%3d *[]byte: %-10s", f.TOS, str)
+			default:
+				traceInfo = fmt.Sprintf("%74s", "POP           TOS:") +
+					fmt.Sprintf("%3d %T %v", f.TOS, value, value)
 			}
 		}
-		_ = log.Log(traceInfo, log.TRACE_INST)
 	}
-
-	f.TOS -= 1 // adjust TOS
-	if MainThread.Trace {
-		logTraceStack(f)
-	} // trace the resultant stack
-	return value
+	_ = log.Log(traceInfo, log.TRACE_INST)
 }
 
 // returns the value at the top of the stack without popping it off.
 func peek(f *frames.Frame) interface{} {
 	if f.TOS == -1 {
-		glob := globals.GetGlobalRef()
-		glob.ErrorGoStack = string(debug.Stack())
-		exceptions.FormatStackUnderflowError(f)
-		return nil
+		panic(errOperandStackUnderflow)
 	}
 
-	if MainThread.Trace {
+	value := slotValue(f.OpStack[f.TOS], f.OpPrims[f.TOS])
+	if traced(f) {
 		var traceInfo string
-		value := f.OpStack[f.TOS]
 		if f.TOS == -1 {
 			traceInfo = fmt.Sprintf("                                                          " +
 				"PEEK TOS:  - ")
@@ -2793,79 +2956,68 @@ func peek(f *frames.Frame) interface{} {
 		}
 		_ = log.Log(traceInfo, log.TRACE_INST)
 	}
-	if MainThread.Trace {
+	if traced(f) {
 		logTraceStack(f)
 	} // trace the stack
-	return f.OpStack[f.TOS]
+	return value
 }
 
 // push onto the operand stack
 func push(f *frames.Frame, x interface{}) {
-	if f.TOS == len(f.OpStack)-1 {
-		// next step will set up error reporting and dump of frame stack
-		exceptions.FormatStackOverflowError(f)
-		return
-	}
-	// we show trace info of the TOS *before* we change its value--
-	// all traces show TOS before the instruction is executed.
-	if MainThread.Trace {
-		var traceInfo string
+	pushSlot(f, slot{x, 0}) // pushSlot() unboxes x, if it's a primitive
+}
 
-		if f.TOS == -1 {
-			traceInfo = fmt.Sprintf("%77s", "PUSH          TOS:  -")
+// tracePush shows the value being pushed onto the operand stack. As with all
+// traces, it shows the TOS *before* its value is changed.
+func tracePush(f *frames.Frame, x interface{}) {
+	var traceInfo string
+
+	if f.TOS == -1 {
+		traceInfo = fmt.Sprintf("%77s", "PUSH          TOS:  -")
+	} else {
+		if x == nil {
+			traceInfo = fmt.Sprintf("%74s", "PUSH          TOS:") +
+				fmt.Sprintf("%3d <nil>", f.TOS)
 		} else {
-			if x == nil {
+			if x == object.Null {
 				traceInfo = fmt.Sprintf("%74s", "PUSH          TOS:") +
-					fmt.Sprintf("%3d <nil>", f.TOS)
+					fmt.Sprintf("%3d null", f.TOS)
 			} else {
-				if x == object.Null {
-					traceInfo = fmt.Sprintf("%74s", "PUSH          TOS:") +
-						fmt.Sprintf("%3d null", f.TOS)
-				} else {
-					switch x.(type) {
-					case *object.Object:
-						obj := x.(*object.Object)
-						if len(obj.Fields) > 0 {
-							if obj.Fields[0].Ftype == "[B" {
-								if obj.Fields[0].Fvalue == nil {
-									traceInfo = fmt.Sprintf("%56s", " ") +
-										fmt.Sprintf("PUSH          TOS:%3d []byte: <nil>", f.TOS)
-								} else {
-									strVal := (obj.Fields[0].Fvalue).(*[]byte)
-									str := string(*strVal)
-									traceInfo = fmt.Sprintf("%56s", " ") +
-										fmt.Sprintf("PUSH          TOS:%3d String: %-10s", f.TOS, str)
-								}
+				switch x.(type) {
+				case *object.Object:
+					obj := x.(*object.Object)
+					if len(obj.Fields) > 0 {
+						if obj.Fields[0].Ftype == "[B" {
+							if obj.Fields[0].Fvalue == nil {
+								traceInfo = fmt.Sprintf("%56s", " ") +
+									fmt.Sprintf("PUSH          TOS:%3d []byte: <nil>", f.TOS)
 							} else {
+								strVal := (obj.Fields[0].Fvalue).(*[]byte)
+								str := string(*strVal)
 								traceInfo = fmt.Sprintf("%56s", " ") +
-									fmt.Sprintf("PUSH          TOS:%3d *Object: %v", f.TOS, x)
+									fmt.Sprintf("PUSH          TOS:%3d String: %-10s", f.TOS, str)
 							}
 						} else {
 							traceInfo = fmt.Sprintf("%56s", " ") +
 								fmt.Sprintf("PUSH          TOS:%3d *Object: %v", f.TOS, x)
 						}
-					case *[]uint8:
-						strPtr := x.(*[]byte)
-						str := string(*strPtr)
-						traceInfo = fmt.Sprintf("%74s", "PUSH          TOS:") +
-							fmt.Sprintf("%3d *[]byte: %-10s", f.TOS, str)
-					default:
+					} else {
 						traceInfo = fmt.Sprintf("%56s", " ") +
-							fmt.Sprintf("PUSH          TOS:%3d %T %v", f.TOS, x, x)
+							fmt.Sprintf("PUSH          TOS:%3d *Object: %v", f.TOS, x)
 					}
+				case *[]uint8:
+					strPtr := x.(*[]byte)
+					str := string(*strPtr)
+					traceInfo = fmt.Sprintf("%74s", "PUSH          TOS:") +
+						fmt.Sprintf("%3d *[]byte: %-10s", f.TOS, str)
+				default:
+					traceInfo = fmt.Sprintf("%56s", " ") +
+						fmt.Sprintf("PUSH          TOS:%3d %T %v", f.TOS, x, x)
 				}
 			}
 		}
-		_ = log.Log(traceInfo, log.TRACE_INST)
 	}
-
-	// the actual push
-	f.TOS += 1
-	f.OpStack[f.TOS] = x
-	if MainThread.Trace {
-		logTraceStack(f)
-	} // trace the resultant stack
-
+	_ = log.Log(traceInfo, log.TRACE_INST)
 }
 
 func add[N frames.Number](num1, num2 N) N {
@@ -2881,6 +3033,76 @@ func subtract[N frames.Number](num1, num2 N) N {
 	return num1 - num2
 }
 
+// divide two doubles, as DDIV does
+func divideDoubles(dividend, divisor float64) float64 {
+	if divisor == 0.0 {
+		if dividend == 0.0 {
+			return math.NaN()
+		} else if math.Signbit(divisor) { // this tests for negative zero
+			return math.Inf(-1) // but golang has no -0 as of v. 1.20
+		}
+		return math.Inf(1)
+	}
+	return dividend / divisor
+}
+
+// toFloat32 rounds a value to a Java float. Floats are held as float64s, so the
+// instructions that compute or store a float round it with this to IEEE binary32.
+func toFloat32(v float64) float64 {
+	return float64(float32(v))
+}
+
+// floatToInt converts a float or double to an int, as F2I and D2I do: the value is
+// truncated toward zero, NaN converts to 0, and values outside the range of an int
+// convert to its smallest or largest value (JVMS 6.5)
+func floatToInt(v float64) int64 {
+	if math.IsNaN(v) {
+		return 0
+	} else if v >= math.MaxInt32 {
+		return math.MaxInt32
+	} else if v <= math.MinInt32 {
+		return math.MinInt32
+	}
+	return int64(v)
+}
+
+// floatToLong converts a float or double to a long, as F2L and D2L do, with the same
+// rules as floatToInt but the range of a long
+func floatToLong(v float64) int64 {
+	if math.IsNaN(v) {
+		return 0
+	} else if v >= math.MaxInt64 { // the constant rounds to 2^63
+		return math.MaxInt64
+	} else if v <= math.MinInt64 {
+		return math.MinInt64
+	}
+	return int64(v)
+}
+
+// compare two longs, as LCMP does: the result is 0 if they're equal, 1 if value1 is
+// greater, and -1 if value2 is greater
+func compareLongs(value1, value2 int64) int64 {
+	if value1 == value2 {
+		return 0
+	} else if value1 > value2 {
+		return 1
+	}
+	return -1
+}
+
+// compare two floats or doubles, as FCMPx and DCMPx do. They differ only in the result
+// when either value is NaN, which is nanResult.
+func compareFloats(value1, value2 float64, nanResult int64) int64 {
+	if math.IsNaN(value1) || math.IsNaN(value2) {
+		return nanResult
+	} else if value1 > value2 {
+		return 1
+	} else if value1 < value2 {
+		return -1
+	}
+	return 0
+}
+
 // converts an interface{} value to int8. Used for BASTORE
 func convertInterfaceToByte(val interface{}) byte {
 	switch t := val.(type) {
@@ -2925,7 +3147,7 @@ func createAndInitNewFrame(
 	includeObjectRef bool,
 	currFrame *frames.Frame) (*frames.Frame, error) {
 
-	if MainThread.Trace {
+	if traced(currFrame) {
 		traceInfo := fmt.Sprintf("\tcreateAndInitNewFrame: class=%s, meth=%s%s, includeObjectRef=%v, maxStack=%d, maxLocals=%d",
 			className, methodName, methodType, includeObjectRef, m.MaxStack, m.MaxLocals)
 		_ = log.Log(traceInfo, log.TRACE_INST)
@@ -2945,15 +3167,17 @@ func createAndInitNewFrame(
 	fram := frames.CreateFrame(stackSize)
 	fram.Thread = currFrame.Thread
 	fram.ClName = className
+	fram.Loader = m.Loader
 	fram.MethName = methodName
-	fram.CP = m.Cp                           // add its pointer to the class CP
-	fram.Meth = append(fram.Meth, m.Code...) // copy the method's bytecodes over
+	fram.MethType = methodType
+	fram.CP = m.Cp     // add its pointer to the class CP
+	fram.Meth = m.Code // the bytecodes, which are shared by all frames of the method
 
 	// pop the parameters off the present stack and put them in
 	// the new frame's locals. This is done in reverse order so
 	// that the parameters are pushed in the right order to be
 	// popped off by the receiving function
-	var argList []interface{}
+	var argList []slot
 	paramsToPass :=
 		util.ParseIncomingParamsFromMethTypeString(methodType)
 
@@ -2989,7 +3213,7 @@ func createAndInitNewFrame(
 			// to objects (lower arrays) regardless of the
 			// lowest level of primitive in the array
 			arg := pop(f).(*object.Object)
-			argList = append(argList, arg)
+			argList = append(argList, slot{arg, 0})
 			continue
 		}
 
@@ -3001,37 +3225,25 @@ func createAndInitNewFrame(
 			value := pop(f)
 			arg := object.MakeArrayFromRawArray(value)
 			// arg := pop(f).(*object.Object)
-			argList = append(argList, arg)
+			argList = append(argList, slot{arg, 0})
 			continue
 		}
 
 		switch primitive { // it's not an array
-		case 'D': // double
-			arg := pop(f).(float64)
+		case 'D', 'J': // double, long
+			arg := popSlot(f) // these occupy two slots, which hold the same value
 			argList = append(argList, arg)
 			argList = append(argList, arg)
-			pop(f)
-		case 'F': // float
-			arg := pop(f).(float64)
-			argList = append(argList, arg)
+			popSlot(f)
 		case 'B', 'C', 'I', 'S': // byte, char, integer, short
-			arg := pop(f)
-			switch arg.(type) {
+			arg := popSlot(f)
+			switch arg.value.(type) {
 			case int: // the arg should be int64, but is occasionally int. Tracking this down.
-				arg = int64(arg.(int))
+				arg = slot{frames.PrimInt, int64(arg.value.(int))}
 			}
 			argList = append(argList, arg)
-		case 'J': // long
-			arg := pop(f).(int64)
-			argList = append(argList, arg)
-			argList = append(argList, arg)
-			pop(f)
-		case 'L': // pointer/reference
-			// arg := pop(f).(*object.Object)
-			arg := pop(f) // can't be case to *Object b/c it could be nil, which would panic
-			argList = append(argList, arg)
-		default:
-			arg := pop(f)
+		default: // float, pointer/reference
+			arg := popSlot(f) // can't be cast to *Object b/c it could be nil, which would panic
 			argList = append(argList, arg)
 		}
 	}
@@ -3046,35 +3258,39 @@ func createAndInitNewFrame(
 		lenLocals = 1
 	}
 
-	// allocate the local variables
-	for k := 0; k < lenLocals; k++ {
-		fram.Locals = append(fram.Locals, int64(0))
-	}
-
 	// if includeObjectRef is true then objectRef != nil.
 	// Insert it in the local[0]
 	// This is used in invokevirtual, invokespecial, and invokeinterface.
 	destLocal := 0
 	if includeObjectRef {
-		fram.Locals[0] = pop(f)
-		fram.Locals = append(fram.Locals, int64(0)) // add the slot taken up by objectRef
-		destLocal = 1                               // The first parameter starts at index 1
-		lenLocals++                                 // There is 1 more local needed
+		destLocal = 1 // The first parameter starts at index 1
+		lenLocals++   // There is 1 more local needed
 	}
 
-	if MainThread.Trace {
+	// allocate the local variables, which start out as int 0s
+	fram.Locals = make([]interface{}, lenLocals)
+	fram.LocalPrims = make([]int64, lenLocals)
+	for k := range fram.Locals {
+		fram.Locals[k] = frames.PrimInt
+	}
+	if includeObjectRef {
+		storeSlot(fram, 0, popSlot(f))
+	}
+
+	if traced(currFrame) {
 		traceInfo := fmt.Sprintf("\tcreateAndInitNewFrame: lenArgList=%d, lenLocals=%d, stackSize=%d",
 			lenArgList, lenLocals, stackSize)
 		_ = log.Log(traceInfo, log.TRACE_INST)
 	}
 
 	for j := lenArgList - 1; j >= 0; j-- {
-		fram.Locals[destLocal] = argList[j]
+		storeSlot(fram, destLocal, argList[j])
 		destLocal += 1
 	}
 
 	fram.TOS = -1
 
+	enterMethodMonitor(fram, m)
 	return fram, nil
 }
 
@@ -3092,3 +3308,19 @@ func byteToInt64(bite byte) int64 {
 	// Not negative (left-most bit off) : just cast bite as an int64
 	return int64(bite)
 }
+
+// retFromSubroutine sets f.PC to the return address held in local[index], as RET
+// (and WIDE RET) do at the end of a subroutine called by JSR or JSR_W.
+func retFromSubroutine(f *frames.Frame, index int) error {
+	retAddr, ok := f.Locals[index].(returnAddress)
+	if !ok {
+		glob := globals.GetGlobalRef()
+		glob.ErrorGoStack = string(debug.Stack())
+		errMsg := fmt.Sprintf("RET: local %d does not hold a return address in method %s() of class %s",
+			index, f.MethName, f.ClName)
+		_ = log.Log(errMsg, log.SEVERE)
+		return errors.New(errMsg)
+	}
+	f.PC = int(retAddr)
+	return nil
+}
@@ -9,6 +9,10 @@ package jvm
 
 import (
 	"jacobin/classloader"
+	"jacobin/exceptions"
+	"jacobin/frames"
+	"jacobin/globals"
+	"runtime/debug"
 	"unsafe"
 )
 
@@ -174,3 +178,96 @@ func getMethInfoFromCPmethref(CP *classloader.CPool, cpIndex int) (string, strin
 
 	return className, methName, methSig
 }
+
+// getMethInfoFromCPinterfaceRef is the counterpart of getMethInfoFromCPmethref for
+// interface method refs. It returns the interface name, method name, and method type.
+func getMethInfoFromCPinterfaceRef(CP *classloader.CPool, cpIndex int) (string, string, string) {
+	if cpIndex < 1 || cpIndex >= len(CP.CpIndex) {
+		return "", "", ""
+	}
+
+	if CP.CpIndex[cpIndex].Type != classloader.Interface {
+		return "", "", ""
+	}
+	interfaceRef := CP.InterfaceRefs[CP.CpIndex[cpIndex].Slot]
+
+	classRefIdx := CP.CpIndex[interfaceRef.ClassIndex].Slot
+	classIdx := CP.ClassRefs[classRefIdx]
+	interfaceName := CP.Utf8Refs[CP.CpIndex[classIdx].Slot]
+
+	nameAndTypeIndex := CP.CpIndex[interfaceRef.NameAndType].Slot
+	nameAndTypeEntry := CP.NameAndTypes[nameAndTypeIndex]
+	methName := CP.Utf8Refs[CP.CpIndex[nameAndTypeEntry.NameIndex].Slot]
+	methSig := CP.Utf8Refs[CP.CpIndex[nameAndTypeEntry.DescIndex].Slot]
+
+	return interfaceName, methName, methSig
+}
+
+// isSubclassOf reports whether the class k is the class superclass or one of its
+// subclasses. The superclass of a class is the class of that name as the class's
+// defining loader sees it. Classes that are not yet loaded are loaded as the
+// superclass chain is ascended.
+func isSubclassOf(k, superclass *classloader.Klass) bool {
+	for k != nil && k.Data != nil && superclass != nil {
+		if k == superclass {
+			return true
+		}
+		if k.Data.Name == "java/lang/Object" || k.Data.Superclass == "" {
+			return false
+		}
+		k = fetchClassFor(k.Loader, k.Data.Superclass)
+	}
+	return false
+}
+
+// fetchClass returns the class named className from the method area, loading
+// it first if it's not already there. Returns nil if the class can't be loaded.
+func fetchClass(className string) *classloader.Klass {
+	k := classloader.MethAreaFetch(className)
+	if k == nil {
+		if classloader.LoadClassFromNameOnly(className) != nil {
+			return nil
+		}
+		k = classloader.MethAreaFetch(className)
+	}
+	return k
+}
+
+// fetchClassFor returns the class named className as the code of the classes whose
+// defining loader is the loader named loader sees it (see classloader.MethAreaFetchFor()),
+// loading it first if it's not already there. A user-defined loader loads it by
+// delegating to its parent, as the classes that its own code refers to have already
+// been loaded with it (see loadReferencedClass()). Returns nil if the class can't be
+// loaded.
+func fetchClassFor(loader, className string) *classloader.Klass {
+	if !classloader.IsUserLoader(loader) {
+		return fetchClass(className)
+	}
+	if k := classloader.MethAreaFetchFor(loader, className); k != nil {
+		return k
+	}
+	cl := classloader.LoaderNamed(loader)
+	if cl == nil {
+		return nil
+	}
+	k, err := cl.LoadClass(className)
+	if err != nil {
+		return nil
+	}
+	return k
+}
+
+// checkLoaderConstraints imposes the loader constraints required for a call from the
+// method executing in frame f to the method methName, whose descriptor is methType, in
+// the class className (see classloader/loaderConstraints.go). If they're violated, it
+// throws a LinkageError and returns an error.
+func checkLoaderConstraints(f *frames.Frame, className, methName, methType string) error {
+	callee := classloader.MethAreaFetchFor(f.Loader, className)
+	if err := classloader.CheckMethodLoaderConstraints(f.Loader, f.ClName, callee, methName, methType); err != nil {
+		glob := globals.GetGlobalRef()
+		glob.ErrorGoStack = string(debug.Stack())
+		exceptions.Throw(exceptions.LinkageError, err.Error())
+		return err
+	}
+	return nil
+}
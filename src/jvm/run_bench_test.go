@@ -0,0 +1,256 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"jacobin/classloader"
+	"jacobin/frames"
+	"jacobin/globals"
+	"jacobin/log"
+	"jacobin/object"
+	"jacobin/opcodes"
+	"jacobin/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Benchmarks of the interpreter. The loops are the kind of numeric code that spends
+// its time pushing, popping, loading, and storing ints, longs, and doubles. Run with:
+//     go test -run XXX -bench . ./jvm/
+
+// int sum = 0; for (int i = 0; i < n; i++) { sum += i; }
+var intLoop = []byte{
+	opcodes.ICONST_0,            // 0:
+	opcodes.ISTORE_1,            // 1: sum = 0
+	opcodes.ICONST_0,            // 2:
+	opcodes.ISTORE_2,            // 3: i = 0
+	opcodes.ILOAD_2,             // 4:
+	opcodes.ILOAD_0,             // 5:
+	opcodes.IF_ICMPGE, 0x00, 13, // 6: if i >= n, go to 19
+	opcodes.ILOAD_1,    // 9:
+	opcodes.ILOAD_2,    // 10:
+	opcodes.IADD,       // 11:
+	opcodes.ISTORE_1,   // 12: sum += i
+	opcodes.IINC, 2, 1, // 13: i++
+	opcodes.GOTO, 0xFF, 0xF4, // 16: go to 4
+	opcodes.ILOAD_1, // 19: leave sum on the stack
+}
+
+// long sum = 0; for (int i = 0; i < n; i++) { sum += i; }
+var longLoop = []byte{
+	opcodes.LCONST_0,            // 0:
+	opcodes.LSTORE_1,            // 1: sum = 0
+	opcodes.ICONST_0,            // 2:
+	opcodes.ISTORE_3,            // 3: i = 0
+	opcodes.ILOAD_3,             // 4:
+	opcodes.ILOAD_0,             // 5:
+	opcodes.IF_ICMPGE, 0x00, 14, // 6: if i >= n, go to 20
+	opcodes.LLOAD_1,    // 9:
+	opcodes.ILOAD_3,    // 10:
+	opcodes.I2L,        // 11:
+	opcodes.LADD,       // 12:
+	opcodes.LSTORE_1,   // 13: sum += i
+	opcodes.IINC, 3, 1, // 14: i++
+	opcodes.GOTO, 0xFF, 0xF3, // 17: go to 4
+	opcodes.LLOAD_1, // 20: leave sum on the stack
+}
+
+// double x = 1.0; for (int i = 0; i < n; i++) { x = x / 2.0 + 1.0; }
+var doubleLoop = []byte{
+	opcodes.DCONST_1,            // 0:
+	opcodes.DSTORE_1,            // 1: x = 1.0
+	opcodes.ICONST_0,            // 2:
+	opcodes.ISTORE_3,            // 3: i = 0
+	opcodes.ILOAD_3,             // 4:
+	opcodes.ILOAD_0,             // 5:
+	opcodes.IF_ICMPGE, 0x00, 17, // 6: if i >= n, go to 23
+	opcodes.DLOAD_1,    // 9:
+	opcodes.DCONST_1,   // 10:
+	opcodes.DCONST_1,   // 11:
+	opcodes.DADD,       // 12:
+	opcodes.DDIV,       // 13:
+	opcodes.DCONST_1,   // 14:
+	opcodes.DADD,       // 15:
+	opcodes.DSTORE_1,   // 16: x = x / 2.0 + 1.0
+	opcodes.IINC, 3, 1, // 17: i++
+	opcodes.GOTO, 0xFF, 0xF0, // 20: go to 4
+	opcodes.DLOAD_1, // 23: leave x on the stack
+}
+
+// runLoop runs one of the loops above, with n in local 0, b.N times
+func runLoop(b *testing.B, code []byte, n int64) {
+	globals.InitGlobals("test")
+	log.Init()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f := frames.CreateFrame(8)
+		f.Ftype = 'J'
+		f.Meth = code
+		f.Locals = []interface{}{n, int64(0), int64(0), int64(0), int64(0)}
+
+		fs := frames.CreateFrameStack()
+		fs.PushFront(f)
+		if err := runFrame(fs); err != nil {
+			b.Fatalf("Loop failed: %s", err.Error())
+		}
+	}
+}
+
+func BenchmarkIntLoop(b *testing.B) {
+	runLoop(b, intLoop, 1000)
+}
+
+func BenchmarkLongLoop(b *testing.B) {
+	runLoop(b, longLoop, 1000)
+}
+
+func BenchmarkDoubleLoop(b *testing.B) {
+	runLoop(b, doubleLoop, 1000)
+}
+
+// The same loops in the closure tier (see closures.go), which compiles them when they're
+// first executed
+func BenchmarkIntLoopClosures(b *testing.B) {
+	defer setClosureTier(true, 0, 0)()
+	runLoop(b, intLoop, 1000)
+}
+
+func BenchmarkLongLoopClosures(b *testing.B) {
+	defer setClosureTier(true, 0, 0)()
+	runLoop(b, longLoop, 1000)
+}
+
+func BenchmarkDoubleLoopClosures(b *testing.B) {
+	defer setClosureTier(true, 0, 0)()
+	runLoop(b, doubleLoop, 1000)
+}
+
+// sum(n) = n + sum(n-1), which is mostly the passing of ints to and from methods
+func BenchmarkRecursion(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		f := recursionSetup(1000)
+		fs := frames.CreateFrameStack()
+		fs.PushFront(&f)
+		b.StartTimer()
+		if err := runFrame(fs); err != nil {
+			b.Fatalf("Recursion failed: %s", err.Error())
+		}
+	}
+}
+
+// loadTestdataMethod loads a class from testdata and returns one of its methods. The
+// classes that main() uses from the JDK are stubbed, so that it runs without one: the
+// few methods of PrintStream that the programs call are native.
+func loadTestdataMethod(b *testing.B, className, methName, methType string) classloader.JmEntry {
+	testdata := os.Getenv("JACOBIN_TESTDATA")
+	if testdata == "" {
+		testdata = filepath.Join("..", "..", "testdata")
+	}
+	rawBytes, err := os.ReadFile(filepath.Join(testdata, className+".class"))
+	if err != nil {
+		b.Skip(className + ".class not found in testdata. Specify its directory in JACOBIN_TESTDATA")
+	}
+
+	globals.InitGlobals("test")
+	log.Init()
+	classloader.InitMethodArea()
+	classloader.MTableLoadNatives()
+	for _, stub := range []string{"java/lang/Object", "java/lang/String", "java/lang/System",
+		"java/io/PrintStream"} {
+		classloader.MethAreaInsert(stub, &(classloader.Klass{
+			Status: 'X', Loader: "bootstrap",
+			Data: &classloader.ClData{Name: stub, ClInit: types.ClInitRun,
+				MethodTable: make(map[string]*classloader.Method)}}))
+	}
+	_ = classloader.AddStatic("java/lang/System.out", classloader.Static{Type: "L", Value: object.Null})
+
+	if _, err = classloader.ParseAndPostClass(&classloader.AppCL, className+".class", rawBytes); err != nil {
+		b.Fatalf("%s.class could not be loaded: %s", className, err.Error())
+	}
+	mte, err := classloader.FetchMethodAndCP(className, methName, methType)
+	if err != nil {
+		b.Fatalf("%s.%s() not found: %s", className, methName, err.Error())
+	}
+	return mte.Meth.(classloader.JmEntry)
+}
+
+// runTestdataMethod runs a method loaded by loadTestdataMethod b.N times, each time
+// from a frame of its own with the locals that setLocals puts in it
+func runTestdataMethod(b *testing.B, className, methName, methType string,
+	setLocals func(locals []interface{}, i int)) {
+	m := loadTestdataMethod(b, className, methName, methType)
+
+	// the programs print their results, which aren't wanted in the benchmark's output
+	stdout := os.Stdout
+	if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		os.Stdout = devNull
+		defer func() { os.Stdout = stdout; _ = devNull.Close() }()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		caller := frames.CreateFrame(4)
+		caller.Ftype = 'J'
+		f := frames.CreateFrame(m.MaxStack + 2)
+		f.Ftype = 'J'
+		f.ClName = className
+		f.MethName = methName
+		f.MethType = methType
+		f.CP = m.Cp
+		f.Meth = m.Code
+		f.Locals = make([]interface{}, m.MaxLocals)
+		setLocals(f.Locals, i)
+
+		fs := frames.CreateFrameStack()
+		fs.PushFront(caller)
+		fs.PushFront(f)
+		if err := runFrame(fs); err != nil {
+			b.Fatalf("%s.%s() failed: %s", className, methName, err.Error())
+		}
+	}
+}
+
+// runTestdataMain runs the main() method of a program in testdata b.N times
+func runTestdataMain(b *testing.B, className string) {
+	runTestdataMethod(b, className, "main", "([Ljava/lang/String;)V",
+		func(locals []interface{}, _ int) { locals[0] = object.Null })
+}
+
+// Hello3 in testdata calls addTwo(i, i-1), which calls multTwo(i, i-1). Here, addTwo()
+// is called from a frame of its own, as main() would call it, b.N times.
+func BenchmarkHello3AddTwo(b *testing.B) {
+	runTestdataMethod(b, "Hello3", "addTwo", "(II)I", func(locals []interface{}, i int) {
+		locals[0] = int64(i)
+		locals[1] = int64(i - 1)
+	})
+}
+
+// The programs in testdata, run in full. Each prints a few lines of results from loops
+// of static calls (Hello2, Hello3), shifts (testBitShifts), or arrays of each primitive
+// type (testArrays, arrlen).
+func BenchmarkHello2(b *testing.B) {
+	runTestdataMain(b, "Hello2")
+}
+
+func BenchmarkHello3(b *testing.B) {
+	runTestdataMain(b, "Hello3")
+}
+
+func BenchmarkTestBitShifts(b *testing.B) {
+	runTestdataMain(b, "testBitShifts")
+}
+
+func BenchmarkTestArrays(b *testing.B) {
+	runTestdataMain(b, "testArrays")
+}
+
+func BenchmarkArrlen(b *testing.B) {
+	runTestdataMain(b, "arrlen")
+}
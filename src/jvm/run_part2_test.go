@@ -7,6 +7,8 @@
 package jvm
 
 import (
+	"archive/zip"
+	"container/list"
 	"io"
 	"jacobin/classloader"
 	"jacobin/frames"
@@ -16,9 +18,15 @@ import (
 	"jacobin/opcodes"
 	"jacobin/thread"
 	"jacobin/types"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 	"unsafe"
 )
 
@@ -39,7 +47,7 @@ func TestIinc(t *testing.T) {
 	if f.TOS != -1 {
 		t.Errorf("Top of stack, expected -1, got: %d", f.TOS)
 	}
-	value := f.Locals[1]
+	value := getLocal(&f, 1)
 	if value != int64(37) {
 		t.Errorf("IINC: Expected popped value to be 37, got: %d", value)
 	}
@@ -59,7 +67,7 @@ func TestIincNeg(t *testing.T) {
 	if f.TOS != -1 {
 		t.Errorf("Top of stack, expected -1, got: %d", f.TOS)
 	}
-	value := f.Locals[1]
+	value := getLocal(&f, 1)
 	if value != int64(-17) {
 		t.Errorf("IINC: Expected popped value to be -17, got: %d", value)
 	}
@@ -160,104 +168,6 @@ func TestIload3(t *testing.T) {
 	}
 }
 
-// IMPDEP2: bytecode for discretionary use, here for certain error conditions
-// Note: this is a quick unit test. More thorough testing of this bytecode is
-// done in errors_test.go
-func TestImpdep2StackOverflow(t *testing.T) {
-	g := globals.GetGlobalRef()
-	globals.InitGlobals("test")
-	g.JacobinName = "test"
-	g.StrictJDK = false
-
-	log.Init()
-	_ = log.SetLogLevel(log.INFO)
-
-	// redirect stderr & stdout to capture results from stderr
-	normalStderr := os.Stderr
-	r, w, _ := os.Pipe()
-	os.Stderr = w
-
-	normalStdout := os.Stdout
-	_, wout, _ := os.Pipe()
-	os.Stdout = wout
-
-	f := newFrame(opcodes.NOP)               // see errors.go for why this is necessary
-	f.Meth = append(f.Meth, opcodes.IMPDEP2) //
-	f.Meth = append(f.Meth, 0x01)            // stack overflow error
-	f.Meth = append(f.Meth, 0x00)            // store current PC to be 04
-	f.Meth = append(f.Meth, 0x04)
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-
-	// restore stderr and stdout to what they were before
-	_ = w.Close()
-	os.Stderr = normalStderr
-	msg, _ := io.ReadAll(r)
-
-	_ = wout.Close()
-	os.Stdout = normalStdout
-
-	errMsg := string(msg)
-
-	if !strings.Contains(errMsg, "stack overflow") {
-		t.Errorf("IMPDEP2: Got unexpected message re stack overflow error: %s", errMsg)
-	}
-
-	if !strings.Contains(errMsg, "004") { // should show the stored CP value
-		t.Errorf("IMPDEP2: Got unexpected message re stack overflow error: %s", errMsg)
-	}
-}
-
-// IMPDEP2: bytecode for discretionary use, here for certain error conditions
-// Note: this is a quick unit test. More thorough testing of this bytecode is
-// done in errors_test.go
-func TestImpdep2StackUnderflow(t *testing.T) {
-	g := globals.GetGlobalRef()
-	globals.InitGlobals("test")
-	g.JacobinName = "test"
-	g.StrictJDK = false
-
-	log.Init()
-	_ = log.SetLogLevel(log.INFO)
-
-	// redirect stderr & stdout to capture results from stderr
-	normalStderr := os.Stderr
-	r, w, _ := os.Pipe()
-	os.Stderr = w
-
-	normalStdout := os.Stdout
-	_, wout, _ := os.Pipe()
-	os.Stdout = wout
-
-	f := newFrame(opcodes.NOP)               // see errors.go for why this is necessary
-	f.Meth = append(f.Meth, opcodes.IMPDEP2) //
-	f.Meth = append(f.Meth, 0x02)            // stack underflow error
-	f.Meth = append(f.Meth, 0x00)            // store current PC to be 04
-	f.Meth = append(f.Meth, 0x05)
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-
-	// restore stderr and stdout to what they were before
-	_ = w.Close()
-	os.Stderr = normalStderr
-	msg, _ := io.ReadAll(r)
-
-	_ = wout.Close()
-	os.Stdout = normalStdout
-
-	errMsg := string(msg)
-
-	if !strings.Contains(errMsg, "stack underflow") {
-		t.Errorf("IMPDEP2: Got unexpected message re stack overflow error: %s", errMsg)
-	}
-
-	if !strings.Contains(errMsg, "005") { // should show the stored CP value
-		t.Errorf("IMPDEP2: Got unexpected message re stack overflow error: %s", errMsg)
-	}
-}
-
 // Test IMUL (pop 2 values, multiply them, push result)
 func TestImul(t *testing.T) {
 	f := newFrame(opcodes.IMUL)
@@ -366,1174 +276,1745 @@ func TestInstanceofString(t *testing.T) {
 	}
 }
 
-// INVOKEVIRTUAL : invoke method -- here testing for error
-func TestInvokevirtualInvalid(t *testing.T) {
-	f := newFrame(opcodes.INVOKEVIRTUAL)
-	f.Meth = append(f.Meth, 0x00)
-	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
+// INVOKEDYNAMIC: set up a class whose CP has an invokedynamic entry at [1] for a call
+// site of type callSiteType, bootstrapped by StringConcatFactory.bsmName with the
+// recipe and the constants passed in. Returns a frame that executes the call site.
+func invokedynamicSetup(className, callSiteType, bsmName, recipe string, constants []string) frames.Frame {
+	globals.InitGlobals("test")
+	log.Init()
+	classloader.InitMethodArea()
 
 	CP := classloader.CPool{}
-	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
-	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
-	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.ClassRef, Slot: 0} // should be a method ref
-	// now create the pointed-to FieldRef
-	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
-	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
-	f.CP = &CP
-
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	err := runFrame(fs)
-
-	if err == nil {
-		t.Errorf("INVOKEVIRTUAL: Expected error but did not get one.")
-	} else {
-		errMsg := err.Error()
-		if !strings.Contains(errMsg, "Expected a method ref, but got") {
-			t.Errorf("INVOKEVIRTUAL: Did not get expected error message, got: %s", errMsg)
-		}
-	}
+	CP.CpIndex = []classloader.CpEntry{
+		{Type: 0, Slot: 0},
+		{Type: classloader.InvokeDynamic, Slot: 0}, // [1]
+		{Type: classloader.NameAndType, Slot: 0},   // [2] call site name and type
+		{Type: classloader.UTF8, Slot: 0},          // [3]
+		{Type: classloader.UTF8, Slot: 1},          // [4]
+		{Type: classloader.MethodHandle, Slot: 0},  // [5] bootstrap method handle
+		{Type: classloader.MethodRef, Slot: 0},     // [6] bootstrap method
+		{Type: classloader.ClassRef, Slot: 0},      // [7]
+		{Type: classloader.UTF8, Slot: 2},          // [8]
+		{Type: classloader.NameAndType, Slot: 1},   // [9]
+		{Type: classloader.UTF8, Slot: 3},          // [10]
+		{Type: classloader.UTF8, Slot: 4},          // [11]
+		{Type: classloader.UTF8, Slot: 5},          // [12] recipe
+	}
+	CP.InvokeDynamics = []classloader.InvokeDynamicEntry{{BootstrapIndex: 0, NameAndType: 2}}
+	CP.NameAndTypes = []classloader.NameAndTypeEntry{{NameIndex: 3, DescIndex: 4}, {NameIndex: 10, DescIndex: 11}}
+	CP.MethodHandles = []classloader.MethodHandleEntry{{RefKind: 6, RefIndex: 6}}
+	CP.MethodRefs = []classloader.MethodRefEntry{{ClassIndex: 7, NameAndType: 9}}
+	CP.ClassRefs = []uint16{8}
+	CP.Utf8Refs = []string{bsmName, callSiteType, "java/lang/invoke/StringConcatFactory", bsmName,
+		"(Ljava/lang/invoke/MethodHandles$Lookup;Ljava/lang/String;Ljava/lang/invoke/MethodType;" +
+			"Ljava/lang/String;[Ljava/lang/Object;)Ljava/lang/invoke/CallSite;", recipe}
+
+	bsm := classloader.BootstrapMethod{MethodRef: 5, Args: []uint16{12}}
+	for _, constant := range constants {
+		CP.CpIndex = append(CP.CpIndex, classloader.CpEntry{Type: classloader.UTF8, Slot: uint16(len(CP.Utf8Refs))})
+		CP.Utf8Refs = append(CP.Utf8Refs, constant)
+		bsm.Args = append(bsm.Args, uint16(len(CP.CpIndex)-1))
+	}
+
+	classloader.MethAreaInsert(className, &(classloader.Klass{
+		Status: 'X', Loader: "app",
+		Data: &classloader.ClData{Name: className, Superclass: "java/lang/Object",
+			Bootstraps: []classloader.BootstrapMethod{bsm}, CP: CP}}))
+
+	f := *frames.CreateFrame(12) // large enough for all the arguments in these tests
+	f.Ftype = 'J'
+	f.Meth = []byte{opcodes.INVOKEDYNAMIC, 0x00, 0x01, 0x00, 0x00} // CP slot 1
+	f.ClName = className
+	f.MethName = "concat"
+	f.MethType = "()V"
+	f.CP = &classloader.MethAreaFetch(className).Data.CP
+	return f
 }
 
-// IOR: Logical OR of two ints
-func TestIor(t *testing.T) {
-	f := newFrame(opcodes.IOR)
-	push(&f, int64(21))
-	push(&f, int64(22))
+// INVOKEDYNAMIC: string concatenation of all the primitive types and strings,
+// using a recipe that has both arguments and constants
+func TestInvokedynamicStringConcat(t *testing.T) {
+	f := invokedynamicSetup("test/ConcatA", "(ILjava/lang/String;CZJDF)Ljava/lang/String;",
+		"makeConcatWithConstants",
+		"i=\u0001 s=\u0001 c=\u0001 b=\u0001 l=\u0001 d=\u0001 f=\u0001 k=\u0002", []string{"\u0001!"})
+
+	push(&f, int64(42))
+	push(&f, object.NewStringFromGoString("abc"))
+	push(&f, int64('x'))
+	push(&f, types.JavaBoolTrue)
+	push(&f, int64(-7)) // longs and doubles take two slots
+	push(&f, int64(-7))
+	push(&f, 1.5)
+	push(&f, 1.5)
+	push(&f, 1.0e10)
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-
-	value := pop(&f).(int64)
+	err := runFrame(fs)
+	if err != nil {
+		t.Fatalf("INVOKEDYNAMIC: Unexpected error: %s", err.Error())
+	}
 
-	if value != 23 { // 21 | 22 = 23
-		t.Errorf("IOR: expected a result of 23, but got: %d", value)
+	if f.TOS != 0 {
+		t.Errorf("INVOKEDYNAMIC: Expected TOS to be 0, got: %d", f.TOS)
 	}
-	if f.TOS != -1 {
-		t.Errorf("IOR: Expected an empty stack, but got a tos of: %d", f.TOS)
+	str := object.GetGoStringFromJavaStringPtr(pop(&f).(*object.Object))
+	expected := "i=42 s=abc c=x b=true l=-7 d=1.5 f=1.0E10 k=\u0001!"
+	if str != expected {
+		t.Errorf("INVOKEDYNAMIC: Expected %q, got: %q", expected, str)
+	}
+	if f.PC != 5 {
+		t.Errorf("INVOKEDYNAMIC: Expected PC to be 5, got: %d", f.PC)
 	}
 }
 
-// IREM: int modulo
-func TestIrem(t *testing.T) {
-	f := newFrame(opcodes.IREM)
-	push(&f, int64(74))
-	push(&f, int64(6))
+// INVOKEDYNAMIC: string concatenation of null and of objects, including one whose
+// class has a toString() method written in Java
+func TestInvokedynamicStringConcatObjects(t *testing.T) {
+	f := invokedynamicSetup("test/ConcatB",
+		"(Ljava/lang/Object;Ljava/lang/Integer;Ltest/Point;)Ljava/lang/String;",
+		"makeConcatWithConstants", "\u0001, \u0001, \u0001", nil)
+
+	classloader.MethAreaInsert("java/lang/String", &(classloader.Klass{
+		Status: 'X', Loader: "bootstrap",
+		Data: &classloader.ClData{Name: "java/lang/String", Superclass: "java/lang/Object"}}))
+
+	// test/Point.toString() returns the string in its CP entry [1]
+	pointCP := classloader.CPool{}
+	pointCP.CpIndex = []classloader.CpEntry{{Type: 0, Slot: 0}, {Type: classloader.UTF8, Slot: 0}}
+	pointCP.Utf8Refs = []string{"Point(1, 2)"}
+	classloader.MethAreaInsert("test/Point", &(classloader.Klass{
+		Status: 'X', Loader: "app",
+		Data: &classloader.ClData{Name: "test/Point", Superclass: "java/lang/Object", CP: pointCP,
+			MethodTable: map[string]*classloader.Method{
+				"toString()Ljava/lang/String;": {
+					AccessFlags: 0x0001,
+					CodeAttr: classloader.CodeAttrib{
+						MaxStack: 1, MaxLocals: 1,
+						Code: []byte{opcodes.LDC, 0x01, opcodes.ARETURN},
+					},
+				},
+			}}}))
+
+	integerClass := "java/lang/Integer"
+	integer := object.MakeEmptyObject()
+	integer.Klass = &integerClass
+	integer.Fields = append(integer.Fields, object.Field{Ftype: types.Int, Fvalue: int64(5)})
+
+	pointClass := "test/Point"
+	point := object.MakeEmptyObject()
+	point.Klass = &pointClass
+
+	push(&f, object.Null)
+	push(&f, integer)
+	push(&f, point)
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-
-	if f.TOS != 0 { // product is pushed twice b/c it's a long, which occupies 2 slots
-		t.Errorf("IREM, Top of stack, expected 1, got: %d", f.TOS)
+	err := runFrame(fs)
+	if err != nil {
+		t.Fatalf("INVOKEDYNAMIC: Unexpected error: %s", err.Error())
 	}
 
-	value := pop(&f).(int64)
-	if value != 2 {
-		t.Errorf("IREM: Expected result to be 2, got: %d", value)
+	str := object.GetGoStringFromJavaStringPtr(pop(&f).(*object.Object))
+	if str != "null, 5, Point(1, 2)" {
+		t.Errorf("INVOKEDYNAMIC: Expected \"null, 5, Point(1, 2)\", got: %q", str)
 	}
 }
 
-// IREM: int modulo -- divide by zero
-func TestIremDivideByZero(t *testing.T) {
-	f := newFrame(opcodes.IREM)
-	push(&f, int64(6))
-	push(&f, int64(0))
+// INVOKEDYNAMIC: an exception thrown by the toString() of an object being concatenated
+// is caught by the handler around the concatenation, rather than reported as uncaught
+func TestInvokedynamicStringConcatToStringThrows(t *testing.T) {
+	f := invokedynamicSetup("test/ConcatE", "(Ljava/lang/Object;)Ljava/lang/String;",
+		"makeConcatWithConstants", "x=\u0001", nil)
+	f.Meth = append(f.Meth, opcodes.NOP) // the handler
+	classloader.MTable["test/ConcatE.concat()V"] = classloader.MTentry{
+		MType: 'J',
+		Meth: classloader.JmEntry{Cp: f.CP.(*classloader.CPool),
+			Exceptions: []classloader.CodeException{{StartPc: 0, EndPc: 5, HandlerPc: 5, CatchType: 0}}},
+	}
+
+	classloader.MethAreaInsert("java/lang/Throwable", &(classloader.Klass{
+		Status: 'X', Loader: "bootstrap",
+		Data: &classloader.ClData{Name: "java/lang/Throwable", Superclass: "java/lang/Object"}}))
+
+	// test/Oops is a Throwable whose toString() throws the object itself
+	classloader.MethAreaInsert("test/Oops", &(classloader.Klass{
+		Status: 'X', Loader: "app",
+		Data: &classloader.ClData{Name: "test/Oops", Superclass: "java/lang/Throwable",
+			MethodTable: map[string]*classloader.Method{
+				"toString()Ljava/lang/String;": {
+					AccessFlags: 0x0001,
+					CodeAttr: classloader.CodeAttrib{
+						MaxStack: 1, MaxLocals: 1,
+						Code: []byte{opcodes.ALOAD_0, opcodes.ATHROW},
+					},
+				},
+			}}}))
+
+	oopsClass := "test/Oops"
+	oops := object.MakeEmptyObject()
+	oops.Klass = &oopsClass
+	push(&f, oops)
+
+	normalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	err := runFrame(fs)
-	errMsg := err.Error()
-	if !strings.Contains(errMsg, "divide by zero") {
-		t.Errorf("IREM: Expected divide by zero error msg, got: %s", errMsg)
-	}
-}
 
-// IRETURN: push an int on to the op stack of the calling method and exit the present method/frame
-func TestIreturn(t *testing.T) {
-	f0 := newFrame(0)
-	push(&f0, int64(20))
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f0)
-	f1 := newFrame(opcodes.IRETURN)
-	push(&f1, int64(21))
-	fs.PushFront(&f1)
-	_ = runFrame(fs)
-	_ = frames.PopFrame(fs)
-	f3 := fs.Front().Value.(*frames.Frame)
-	newVal := pop(f3).(int64)
-	if newVal != 21 {
-		t.Errorf("After IRETURN, expected a value of 21 in previous frame, got: %d", newVal)
+	_ = w.Close()
+	os.Stderr = normalStderr
+	out, _ := io.ReadAll(r)
+
+	if err != nil {
+		t.Fatalf("INVOKEDYNAMIC: Expected the exception to be caught, got error: %s", err.Error())
 	}
-	prevVal := pop(f3).(int64)
-	if prevVal != 20 {
-		t.Errorf("After IRETURN, expected a value of 20 in 2nd place of previous frame, got: %d", prevVal)
+	if len(out) != 0 {
+		t.Errorf("INVOKEDYNAMIC: Expected the exception not to be reported, got: %s", string(out))
+	}
+	if f.PC != 6 {
+		t.Errorf("INVOKEDYNAMIC: Expected the handler at PC 5 to be run, PC is: %d", f.PC)
+	}
+	if f.TOS != 0 || pop(&f) != oops {
+		t.Errorf("INVOKEDYNAMIC: Expected the handler to have the thrown exception on the stack")
 	}
 }
 
-// ISHL: Left shift of long
-func TestIshl(t *testing.T) {
-	f := newFrame(opcodes.ISHL)
-	push(&f, int64(22)) // longs require two slots, so pushed twice
-	push(&f, int64(3))  // shift left 3 bits
+// INVOKEDYNAMIC: a call site is linked only once, after which the cached target is used
+func TestInvokedynamicCallSiteCaching(t *testing.T) {
+	f := invokedynamicSetup("test/ConcatC", "(I)Ljava/lang/String;", "makeConcat", "", nil)
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
+	push(&f, int64(1))
+	if err := runFrame(fs); err != nil {
+		t.Fatalf("INVOKEDYNAMIC: Unexpected error: %s", err.Error())
+	}
+	first := object.GetGoStringFromJavaStringPtr(pop(&f).(*object.Object))
 
-	value := pop(&f).(int64) // longs require two slots, so popped twice
+	// remove the bootstrap method, so that linking the call site again would fail
+	classloader.MethAreaFetch("test/ConcatC").Data.Bootstraps = nil
 
-	if value != 176 { // 22 << 3 = 176
-		t.Errorf("ISHL: expected a result of 176, but got: %d", value)
+	f.PC = 0
+	push(&f, int64(2))
+	if err := runFrame(fs); err != nil {
+		t.Fatalf("INVOKEDYNAMIC: Expected the cached call site to be used, got error: %s", err.Error())
 	}
-	if f.TOS != -1 {
-		t.Errorf("ISHL: Expected an empty stack, but got a tos of: %d", f.TOS)
+	second := object.GetGoStringFromJavaStringPtr(pop(&f).(*object.Object))
+
+	if first != "1" || second != "2" {
+		t.Errorf("INVOKEDYNAMIC: Expected \"1\" and \"2\", got: %q and %q", first, second)
 	}
 }
 
-// ISHR: Right shift of int
-func TestIshr(t *testing.T) {
-	f := newFrame(opcodes.ISHR)
-	push(&f, int64(200))
-	push(&f, int64(3)) // shift right 3 bits
+// INVOKEDYNAMIC: a bootstrap method that's not supported results in an error
+func TestInvokedynamicUnsupportedBootstrap(t *testing.T) {
+	f := invokedynamicSetup("test/ConcatD", "()Ljava/lang/Runnable;", "metafactory", "", nil)
+	cp := f.CP.(*classloader.CPool)
+	cp.Utf8Refs[2] = "java/lang/invoke/SomeOtherFactory"
+
+	normalStderr := os.Stderr
+	_, w, _ := os.Pipe()
+	os.Stderr = w
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
+	err := runFrame(fs)
 
-	value := pop(&f).(int64) // longs require two slots, so popped twice
+	_ = w.Close()
+	os.Stderr = normalStderr
 
-	if value != 25 { // 200 >> 3 = 25
-		t.Errorf("ISHR: expected a result of 25, but got: %d", value)
-	}
-	if f.TOS != -1 {
-		t.Errorf("ISHR: Expected an empty stack, but got a tos of: %d", f.TOS)
+	if err == nil || !strings.Contains(err.Error(), "Unsupported bootstrap method") {
+		t.Errorf("INVOKEDYNAMIC: Expected an error for an unsupported bootstrap method, got: %v", err)
 	}
 }
 
-// ISHR: Right shift of negative int
-func TestIshrNeg(t *testing.T) {
-	f := newFrame(opcodes.ISHR)
-	push(&f, int64(-200))
-	push(&f, int64(3)) // shift right 3 bits
+// INVOKEDYNAMIC: set up a class whose CP has a call site bootstrapped by LambdaMetafactory.
+// The static arguments are the SAM type, a method handle of kind refKind for the target
+// method, and the instantiated SAM type, followed by any extra arguments (flags, counts,
+// and bridge types for altMetafactory), which are given as CP entries added by the caller.
+func lambdaSetup(className, bsmName, samName, callSiteType, samType string, refKind uint16,
+	targetClass, targetName, targetType string, methods map[string]*classloader.Method) (frames.Frame, *classloader.CPool) {
+	globals.InitGlobals("test")
+	log.Init()
+	classloader.InitMethodArea()
+	classloader.MethAreaInsert("java/lang/Object", &(classloader.Klass{
+		Status: 'X', Loader: "bootstrap",
+		Data: &classloader.ClData{Name: "java/lang/Object", Superclass: ""}}))
 
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
+	CP := classloader.CPool{}
+	CP.CpIndex = []classloader.CpEntry{
+		{Type: 0, Slot: 0},
+		{Type: classloader.InvokeDynamic, Slot: 0}, // [1]
+		{Type: classloader.NameAndType, Slot: 0},   // [2] call site name and type
+		{Type: classloader.UTF8, Slot: 0},          // [3]
+		{Type: classloader.UTF8, Slot: 1},          // [4]
+		{Type: classloader.MethodHandle, Slot: 0},  // [5] bootstrap method handle
+		{Type: classloader.MethodRef, Slot: 0},     // [6] bootstrap method
+		{Type: classloader.ClassRef, Slot: 0},      // [7]
+		{Type: classloader.UTF8, Slot: 2},          // [8]
+		{Type: classloader.NameAndType, Slot: 1},   // [9]
+		{Type: classloader.UTF8, Slot: 3},          // [10]
+		{Type: classloader.UTF8, Slot: 4},          // [11]
+		{Type: classloader.MethodType, Slot: 0},    // [12] SAM type
+		{Type: classloader.UTF8, Slot: 5},          // [13]
+		{Type: classloader.MethodHandle, Slot: 1},  // [14] target method handle
+		{Type: classloader.MethodRef, Slot: 1},     // [15] target method
+		{Type: classloader.ClassRef, Slot: 1},      // [16]
+		{Type: classloader.UTF8, Slot: 6},          // [17]
+		{Type: classloader.NameAndType, Slot: 2},   // [18]
+		{Type: classloader.UTF8, Slot: 7},          // [19]
+		{Type: classloader.UTF8, Slot: 8},          // [20]
+		{Type: classloader.MethodType, Slot: 0},    // [21] instantiated SAM type
+	}
+	CP.InvokeDynamics = []classloader.InvokeDynamicEntry{{BootstrapIndex: 0, NameAndType: 2}}
+	CP.NameAndTypes = []classloader.NameAndTypeEntry{
+		{NameIndex: 3, DescIndex: 4}, {NameIndex: 10, DescIndex: 11}, {NameIndex: 19, DescIndex: 20}}
+	CP.MethodHandles = []classloader.MethodHandleEntry{{RefKind: 6, RefIndex: 6}, {RefKind: refKind, RefIndex: 15}}
+	CP.MethodRefs = []classloader.MethodRefEntry{{ClassIndex: 7, NameAndType: 9}, {ClassIndex: 16, NameAndType: 18}}
+	CP.MethodTypes = []uint16{13}
+	CP.ClassRefs = []uint16{8, 17}
+	CP.Utf8Refs = []string{samName, callSiteType, "java/lang/invoke/LambdaMetafactory", bsmName,
+		"(Ljava/lang/invoke/MethodHandles$Lookup;Ljava/lang/String;Ljava/lang/invoke/MethodType;" +
+			"Ljava/lang/invoke/MethodType;Ljava/lang/invoke/MethodHandle;Ljava/lang/invoke/MethodType;)" +
+			"Ljava/lang/invoke/CallSite;", samType, targetClass, targetName, targetType}
+
+	if methods == nil {
+		methods = make(map[string]*classloader.Method)
+	}
+	classloader.MethAreaInsert(className, &(classloader.Klass{
+		Status: 'X', Loader: "app",
+		Data: &classloader.ClData{Name: className, Superclass: "java/lang/Object", MethodTable: methods,
+			Bootstraps: []classloader.BootstrapMethod{{MethodRef: 5, Args: []uint16{12, 14, 21}}}, CP: CP}}))
+
+	f := *frames.CreateFrame(6)
+	f.Ftype = 'J'
+	f.Meth = []byte{opcodes.INVOKEDYNAMIC, 0x00, 0x01, 0x00, 0x00} // CP slot 1
+	f.ClName = className
+	f.MethName = "main"
+	f.MethType = "([Ljava/lang/String;)V"
+	f.CP = &classloader.MethAreaFetch(className).Data.CP
+	return f, f.CP.(*classloader.CPool)
+}
 
-	value := pop(&f).(int64) // longs require two slots, so popped twice
+// INVOKEDYNAMIC: run the call site in f and return the lambda object it creates
+func lambdaRun(t *testing.T, f *frames.Frame) *object.Object {
+	fs := frames.CreateFrameStack()
+	fs.PushFront(f) // push the new frame
+	err := runFrame(fs)
+	if err != nil {
+		t.Fatalf("INVOKEDYNAMIC: Unexpected error: %s", err.Error())
+	}
 
-	if value != -25 { // 200 >> 3 = -25
-		t.Errorf("ISHR: expected a result of -25, but got: %d", value)
+	lambda, ok := pop(f).(*object.Object)
+	if !ok || object.IsNull(lambda) {
+		t.Fatalf("INVOKEDYNAMIC: Expected a lambda object on the stack")
 	}
+	return lambda
+}
+
+// INVOKEDYNAMIC: a lambda that captures a value and is implemented by a private
+// static method, as javac generates for: int base = 5; Adder a = x -> base + x;
+func TestInvokedynamicLambdaCapturing(t *testing.T) {
+	methods := map[string]*classloader.Method{
+		"lambda$main$0(II)I": {
+			AccessFlags: 0x100A, // private static synthetic
+			CodeAttr: classloader.CodeAttrib{
+				MaxStack:  2,
+				MaxLocals: 2,
+				Code:      []byte{opcodes.ILOAD_0, opcodes.ILOAD_1, opcodes.IADD, opcodes.IRETURN},
+			},
+		},
+	}
+	f, _ := lambdaSetup("test/LambdaA", "metafactory", "add", "(I)Ltest/Adder;", "(I)I",
+		6, "test/LambdaA", "lambda$main$0", "(II)I", methods)
+	push(&f, int64(5)) // the captured value
+
+	lambda := lambdaRun(t, &f)
 	if f.TOS != -1 {
-		t.Errorf("ISHR: Expected an empty stack, but got a tos of: %d", f.TOS)
+		t.Errorf("INVOKEDYNAMIC: Expected an empty stack, got TOS: %d", f.TOS)
 	}
-	/*
-		// The following code runs correctly and prints -25 to the
-		// console during test results.
-		var printArray = make([]interface{}, 2)
-		printArray[0] = 0
-		printArray[1] = value
-		classloader.PrintlnI(printArray)
-	*/
 
+	lambdaClass := *lambda.Klass
+	if !strings.HasPrefix(lambdaClass, "test/LambdaA$$Lambda$") {
+		t.Errorf("INVOKEDYNAMIC: Unexpected lambda class name: %s", lambdaClass)
+	}
+	invokeinterfaceAddClass("test/Adder", "java/lang/Object", true, nil, nil)
+	if !implementsInterface(classloader.ObjectKlass(lambda), classloader.MethAreaFetch("test/Adder")) {
+		t.Errorf("INVOKEDYNAMIC: Expected %s to implement test/Adder", lambdaClass)
+	}
+
+	sam, ok := classloader.MTable[lambdaClass+".add(I)I"]
+	if !ok || sam.MType != 'G' {
+		t.Fatalf("INVOKEDYNAMIC: SAM of %s not found in the MTable", lambdaClass)
+	}
+	ret := sam.Meth.(classloader.GMeth).GFunction([]interface{}{lambda, int64(3)})
+	if ret != int64(8) {
+		t.Errorf("INVOKEDYNAMIC: Expected the lambda to return 8, got: %v", ret)
+	}
+}
+
+// INVOKEDYNAMIC: a non-capturing lambda linked by altMetafactory with a bridge method.
+// The SAM is generic, so its arguments and return value are boxed, while the target
+// takes and returns an int. Every execution of the call site returns the same object.
+func TestInvokedynamicLambdaAltMetafactoryBridge(t *testing.T) {
+	methods := map[string]*classloader.Method{
+		"lambda$main$1(I)I": {
+			AccessFlags: 0x100A, // private static synthetic
+			CodeAttr: classloader.CodeAttrib{
+				MaxStack:  2,
+				MaxLocals: 1,
+				Code:      []byte{opcodes.ILOAD_0, opcodes.ILOAD_0, opcodes.IMUL, opcodes.IRETURN},
+			},
+		},
+	}
+	f, CP := lambdaSetup("test/LambdaB", "altMetafactory", "apply", "()Ltest/Function;",
+		"(Ljava/lang/Object;)Ljava/lang/Object;", 6, "test/LambdaB", "lambda$main$1", "(I)I", methods)
+
+	// add the flags (FLAG_BRIDGES), the bridge count, and the bridge type
+	CP.IntConsts = []int32{4, 1}
+	CP.CpIndex = append(CP.CpIndex,
+		classloader.CpEntry{Type: classloader.IntConst, Slot: 0},   // [22]
+		classloader.CpEntry{Type: classloader.IntConst, Slot: 1},   // [23]
+		classloader.CpEntry{Type: classloader.MethodType, Slot: 1}, // [24]
+		classloader.CpEntry{Type: classloader.UTF8, Slot: 9})       // [25]
+	CP.MethodTypes = append(CP.MethodTypes, 25)
+	CP.Utf8Refs = append(CP.Utf8Refs, "(Ljava/lang/Integer;)Ljava/lang/Integer;")
+	k := classloader.MethAreaFetch("test/LambdaB")
+	k.Data.Bootstraps[0].Args = append(k.Data.Bootstraps[0].Args, 22, 23, 24)
+
+	lambda := lambdaRun(t, &f)
+	f.PC = 0
+	if again := lambdaRun(t, &f); again != lambda {
+		t.Errorf("INVOKEDYNAMIC: Expected a non-capturing lambda to be reused")
+	}
+
+	for _, samType := range []string{"(Ljava/lang/Object;)Ljava/lang/Object;", "(Ljava/lang/Integer;)Ljava/lang/Integer;"} {
+		sam, ok := classloader.MTable[*lambda.Klass+".apply"+samType]
+		if !ok {
+			t.Fatalf("INVOKEDYNAMIC: apply%s not found in the MTable", samType)
+		}
+
+		arg := object.MakeEmptyObject()
+		argClass := "java/lang/Integer"
+		arg.Klass = &argClass
+		arg.Fields = []object.Field{{Ftype: types.Int, Fvalue: int64(7)}}
+
+		ret, ok := sam.Meth.(classloader.GMeth).GFunction([]interface{}{lambda, arg}).(*object.Object)
+		if !ok || *ret.Klass != "java/lang/Integer" || ret.Fields[0].Fvalue != int64(49) {
+			t.Errorf("INVOKEDYNAMIC: Expected apply%s to return a boxed 49, got: %v", samType, ret)
+		}
+	}
 }
 
-// ISTORE: Store integer from stack into local specified by following byte.
-func TestIstore(t *testing.T) {
-	f := newFrame(opcodes.ISTORE)
-	f.Meth = append(f.Meth, 0x02) // use local var #2
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	push(&f, int64(0x22223))
+// INVOKEDYNAMIC: a method reference to an instance method, such as Counter::getValue.
+// The receiver is the first argument of the SAM, and the method is selected by its class.
+func TestInvokedynamicMethodRefVirtual(t *testing.T) {
+	f, _ := lambdaSetup("test/LambdaC", "metafactory", "applyAsInt", "()Ltest/ToIntFunction;",
+		"(Ljava/lang/Object;)I", 5, "test/CounterC", "getValue", "()I", nil)
+	invokeinterfaceAddClass("test/CounterC", "java/lang/Object", false, nil, nil)
+	invokeinterfaceAddClass("test/SubCounterC", "test/CounterC", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(9)})
 
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
+	lambda := lambdaRun(t, &f)
+	sam := classloader.MTable[*lambda.Klass+".applyAsInt(Ljava/lang/Object;)I"].Meth.(classloader.GMeth)
 
-	if f.Locals[2] != int64(0x22223) {
-		t.Errorf("ISTORE: Expecting 0x22223 in locals[2], got: 0x%x", f.Locals[2])
+	counter := object.MakeEmptyObject()
+	counterClass := "test/SubCounterC"
+	counter.Klass = &counterClass
+	if ret := sam.GFunction([]interface{}{lambda, counter}); ret != int64(9) {
+		t.Errorf("INVOKEDYNAMIC: Expected the method reference to return 9, got: %v", ret)
 	}
 
-	if f.TOS != -1 {
-		t.Errorf("ISTORE: Expecting an empty stack, but tos points to item: %d", f.TOS)
+	// a null receiver results in a NullPointerException
+	normalStderr := os.Stderr
+	_, w, _ := os.Pipe()
+	os.Stderr = w
+	ret := sam.GFunction([]interface{}{lambda, object.Null})
+	_ = w.Close()
+	os.Stderr = normalStderr
+
+	if err, ok := ret.(error); !ok || !strings.Contains(err.Error(), "null") {
+		t.Errorf("INVOKEDYNAMIC: Expected an error for a null receiver, got: %v", ret)
 	}
 }
 
-// ISTORE_0: Store integer from stack into localVar[0]
-func TestIstore0(t *testing.T) {
-	f := newFrame(opcodes.ISTORE_0)
-	f.Locals = append(f.Locals, zero)
-	push(&f, int64(220))
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-	if f.Locals[0] != int64(220) {
-		t.Errorf("ISTORE_0: expected lcoals[0] to be 220, got: %d", f.Locals[0])
-	}
-	if f.TOS != -1 {
-		t.Errorf("ISTORE_0: Expected op stack to be empty, got tos: %d", f.TOS)
+// INVOKEINTERFACE: set up the method area for the INVOKEINTERFACE tests. Each class
+// is given a CP containing the names of the interfaces it implements and a method
+// table containing the methods passed in.
+func invokeinterfaceSetup() {
+	globals.InitGlobals("test")
+	log.Init()
+	classloader.InitMethodArea()
+
+	classloader.MethAreaInsert("java/lang/Object", &(classloader.Klass{
+		Status: 'X', Loader: "bootstrap",
+		Data: &classloader.ClData{Name: "java/lang/Object", Superclass: ""}}))
+	for class, superclass := range map[string]string{
+		"java/lang/Throwable":                    "java/lang/Object",
+		"java/lang/Error":                        "java/lang/Throwable",
+		"java/lang/LinkageError":                 "java/lang/Error",
+		"java/lang/IncompatibleClassChangeError": "java/lang/LinkageError",
+		"java/lang/AbstractMethodError":          "java/lang/IncompatibleClassChangeError",
+		"java/lang/Exception":                    "java/lang/Throwable",
+		"java/lang/RuntimeException":             "java/lang/Exception",
+		"java/lang/NullPointerException":         "java/lang/RuntimeException",
+	} {
+		classloader.MethAreaInsert(class, &(classloader.Klass{
+			Status: 'X', Loader: "bootstrap",
+			Data: &classloader.ClData{Name: class, Superclass: superclass}}))
 	}
 }
 
-// ISTORE1
-func TestIstore1(t *testing.T) {
-	f := newFrame(opcodes.ISTORE_1)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	push(&f, int64(221))
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-	if f.Locals[1] != int64(221) {
-		t.Errorf("ISTORE_1: expected locals[1] to be 221, got: %d", f.Locals[1])
-	}
-	if f.TOS != -1 {
-		t.Errorf("ISTORE_1: Expected op stack to be empty, got tos: %d", f.TOS)
+// add a class or interface to the method area for the INVOKEINTERFACE tests
+func invokeinterfaceAddClass(name, superclass string, isInterface bool,
+	interfaces []string, methods map[string]*classloader.Method) {
+	klass := classloader.ClData{
+		Name:        name,
+		Superclass:  superclass,
+		MethodTable: methods,
 	}
-}
-
-// ISTORE2
-func TestIstore2(t *testing.T) {
-	f := newFrame(opcodes.ISTORE_2)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	push(&f, int64(222))
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-	if f.Locals[2] != int64(222) {
-		t.Errorf("ISTORE_2: expected locals[2] to be 222, got: %d", f.Locals[2])
+	klass.Access.ClassIsInterface = isInterface
+	for i, intf := range interfaces {
+		klass.CP.Utf8Refs = append(klass.CP.Utf8Refs, intf)
+		klass.Interfaces = append(klass.Interfaces, uint16(i))
 	}
-	if f.TOS != -1 {
-		t.Errorf("ISTORE_2: Expected op stack to be empty, got tos: %d", f.TOS)
+	if klass.MethodTable == nil {
+		klass.MethodTable = make(map[string]*classloader.Method)
 	}
+	classloader.MethAreaInsert(name, &(classloader.Klass{Status: 'X', Loader: "app", Data: &klass}))
 }
 
-func TestIstore3(t *testing.T) {
-	f := newFrame(opcodes.ISTORE_3)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	push(&f, int64(223))
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-	if f.Locals[3] != int64(223) {
-		t.Errorf("ISTORE_3: expected locals[3] to be 223, got: %d", f.Locals[3])
-	}
-	if f.TOS != -1 {
-		t.Errorf("ISTORE_3: Expected op stack to be empty, got tos: %d", f.TOS)
+// a method that returns the int value passed in
+func invokeinterfaceMethod(value byte) *classloader.Method {
+	return &classloader.Method{
+		AccessFlags: 0x0001, // public
+		CodeAttr: classloader.CodeAttrib{
+			MaxStack: 1,
+			Code:     []byte{opcodes.BIPUSH, value, opcodes.IRETURN},
+		},
 	}
 }
 
-// ISUB: integer subtraction
-func TestIsub(t *testing.T) {
-	f := newFrame(opcodes.ISUB)
-	push(&f, int64(10))
-	push(&f, int64(7))
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-	if f.TOS != 0 {
-		t.Errorf("ISUB, Top of stack, expected 0, got: %d", f.TOS)
-	}
-	value := pop(&f).(int64)
-	if value != 3 {
-		t.Errorf("ISUB: Expected popped value to be 3, got: %d", value)
+// create a frame that calls interfaceName.getValue()I on an object of class className
+func invokeinterfaceFrame(interfaceName, className string) frames.Frame {
+	f := newFrame(opcodes.INVOKEINTERFACE)
+	f.Meth = append(f.Meth, 0x00, 0x01, 0x01, 0x00) // CP slot 1, count 1
+
+	CP := classloader.CPool{}
+	CP.CpIndex = make([]classloader.CpEntry, 7, 7)
+	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
+	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.Interface, Slot: 0}
+	CP.CpIndex[2] = classloader.CpEntry{Type: classloader.ClassRef, Slot: 0}
+	CP.CpIndex[3] = classloader.CpEntry{Type: classloader.UTF8, Slot: 0}
+	CP.CpIndex[4] = classloader.CpEntry{Type: classloader.NameAndType, Slot: 0}
+	CP.CpIndex[5] = classloader.CpEntry{Type: classloader.UTF8, Slot: 1}
+	CP.CpIndex[6] = classloader.CpEntry{Type: classloader.UTF8, Slot: 2}
+	CP.InterfaceRefs = []classloader.InterfaceRefEntry{{ClassIndex: 2, NameAndType: 4}}
+	CP.ClassRefs = []uint16{3}
+	CP.NameAndTypes = []classloader.NameAndTypeEntry{{NameIndex: 5, DescIndex: 6}}
+	CP.Utf8Refs = []string{interfaceName, "getValue", "()I"}
+	f.CP = &CP
+
+	if className != "" {
+		obj := object.MakeEmptyObject()
+		obj.Klass = &className
+		push(&f, obj)
+	} else {
+		push(&f, object.Null)
 	}
+	return f
 }
 
-// IUSHR: unsigned right shift of int
-func TestIushr(t *testing.T) {
-	f := newFrame(opcodes.IUSHR)
-	push(&f, int64(-200))
-	push(&f, int64(3)) // shift right 3 bits
+// run the INVOKEINTERFACE frame f, returning the error, if any, with stderr suppressed
+func invokeinterfaceRun(f *frames.Frame) error {
+	normalStderr := os.Stderr
+	_, w, _ := os.Pipe()
+	os.Stderr = w
 
 	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
+	fs.PushFront(f) // push the new frame
+	err := runFrame(fs)
 
-	value := pop(&f).(int64) // longs require two slots, so popped twice
+	_ = w.Close()
+	os.Stderr = normalStderr
+	return err
+}
 
-	if value != 25 { // 200 >> 3 = 25
-		t.Errorf("IUSHR: expected a result of 25, but got: %d", value)
+// run the INVOKEINTERFACE or INVOKEVIRTUAL frame f in a method that catches all the
+// exceptions its invoke instruction throws, with a handler (a NOP) after it, and check
+// that the exception caught is of class excClass and its message contains msg
+func invokeinterfaceCatch(t *testing.T, f *frames.Frame, excClass, msg string) {
+	opName := opcodes.BytecodeNames[f.Meth[0]]
+	f.ClName, f.MethName, f.MethType = "test/Caller", "call", "()V"
+	handlerPC := len(f.Meth)
+	f.Meth = append(f.Meth, opcodes.NOP)
+	classloader.MTable["test/Caller.call()V"] = classloader.MTentry{
+		MType: 'J',
+		Meth: classloader.JmEntry{Exceptions: []classloader.CodeException{
+			{StartPc: 0, EndPc: handlerPC, HandlerPc: handlerPC, CatchType: 0}}},
 	}
-	if f.TOS != -1 {
-		t.Errorf("IUSHR: Expected an empty stack, but got a tos of: %d", f.TOS)
+
+	if err := invokeinterfaceRun(f); err != nil {
+		t.Fatalf("%s: Expected the %s to be caught, got: %s", opName, excClass, err.Error())
+	}
+	exc, ok := peek(f).(*object.Object)
+	if !ok || f.TOS != 0 || f.PC != handlerPC+1 {
+		t.Fatalf("%s: Expected the %s to be caught by the handler", opName, excClass)
+	}
+	if *exc.Klass != excClass || !strings.Contains(getExceptionMessage(exc), msg) {
+		t.Errorf("%s: Expected a %s whose message contains %q, got: %s: %s",
+			opName, excClass, msg, *exc.Klass, getExceptionMessage(exc))
 	}
 }
 
-// IXOR: Logical XOR of two ints
-func TestIxor(t *testing.T) {
-	f := newFrame(opcodes.IXOR)
-	push(&f, int64(21))
-	push(&f, int64(22))
+// INVOKEINTERFACE: call a method implemented in the object's class
+func TestInvokeinterfaceImplementedInClass(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/IntfA", "java/lang/Object", true, nil,
+		map[string]*classloader.Method{"getValue()I": {AccessFlags: 0x0401}}) // public abstract
+	invokeinterfaceAddClass("test/ImplA", "java/lang/Object", false, []string{"test/IntfA"},
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(7)})
 
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
+	f := invokeinterfaceFrame("test/IntfA", "test/ImplA")
+	err := invokeinterfaceRun(&f)
+	if err != nil {
+		t.Fatalf("INVOKEINTERFACE: Unexpected error: %s", err.Error())
+	}
 
-	value := pop(&f).(int64)
-	if value != 3 { // 21 ^ 22 = 3
-		t.Errorf("IXOR: expected a result of 3, but got: %d", value)
+	if f.TOS != 0 || pop(&f).(int64) != 7 {
+		t.Errorf("INVOKEINTERFACE: Expected the method to return 7")
 	}
-	if f.TOS != -1 {
-		t.Errorf("IXOR: Expected an empty stack, but got a tos of: %d", f.TOS)
+	if f.PC != 5 {
+		t.Errorf("INVOKEINTERFACE: Expected PC to be 5, got: %d", f.PC)
+	}
+
+	entry, ok := classloader.ITableFetch(classloader.MethAreaFetch("test/ImplA"), "test/IntfA.getValue()I")
+	if !ok || entry.ClName != "test/ImplA" {
+		t.Errorf("INVOKEINTERFACE: Expected the selected method to be in the itable of test/ImplA")
 	}
 }
 
-// L2D: Convert long to double
-func TestL2d(t *testing.T) {
-	f := newFrame(opcodes.L2D)
-	push(&f, int64(21)) // longs require two slots, so pushed twice
-	push(&f, int64(21))
+// INVOKEINTERFACE: call a method implemented in a superclass of the object's class
+func TestInvokeinterfaceImplementedInSuperclass(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/IntfB", "java/lang/Object", true, nil,
+		map[string]*classloader.Method{"getValue()I": {AccessFlags: 0x0401}})
+	invokeinterfaceAddClass("test/SuperB", "java/lang/Object", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(8)})
+	invokeinterfaceAddClass("test/ImplB", "test/SuperB", false, []string{"test/IntfB"}, nil)
+
+	f := invokeinterfaceFrame("test/IntfB", "test/ImplB")
+	err := invokeinterfaceRun(&f)
+	if err != nil {
+		t.Fatalf("INVOKEINTERFACE: Unexpected error: %s", err.Error())
+	}
 
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
+	if f.TOS != 0 || pop(&f).(int64) != 8 {
+		t.Errorf("INVOKEINTERFACE: Expected the superclass method to return 8")
+	}
+}
 
-	val := pop(&f).(float64)
-	if val != 21.0 {
-		t.Errorf("L2D: expected a result of 21.0, but got: %f", val)
+// INVOKEINTERFACE: call a default method, which is chosen from the most specific
+// superinterface that declares it
+func TestInvokeinterfaceDefaultMethod(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/IntfC", "java/lang/Object", true, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(9)})
+	invokeinterfaceAddClass("test/SubIntfC", "java/lang/Object", true, []string{"test/IntfC"},
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(10)})
+	invokeinterfaceAddClass("test/ImplC", "java/lang/Object", false,
+		[]string{"test/IntfC", "test/SubIntfC"}, nil)
+
+	f := invokeinterfaceFrame("test/IntfC", "test/ImplC")
+	err := invokeinterfaceRun(&f)
+	if err != nil {
+		t.Fatalf("INVOKEINTERFACE: Unexpected error: %s", err.Error())
 	}
-	if f.TOS != 0 {
-		t.Errorf("L2D: Expected stack with 1 item, but got a TOS of: %d", f.TOS)
+
+	if f.TOS != 0 || pop(&f).(int64) != 10 {
+		t.Errorf("INVOKEINTERFACE: Expected the default method of test/SubIntfC to return 10")
 	}
 }
 
-// L2F: Convert long to float
-func TestL2f(t *testing.T) {
-	f := newFrame(opcodes.L2F)
-	push(&f, int64(21)) // longs require two slots, so pushed twice
-	push(&f, int64(21))
+// INVOKEINTERFACE: two unrelated superinterfaces with default methods is an error
+func TestInvokeinterfaceConflictingDefaults(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/IntfD1", "java/lang/Object", true, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(11)})
+	invokeinterfaceAddClass("test/IntfD2", "java/lang/Object", true, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(12)})
+	invokeinterfaceAddClass("test/ImplD", "java/lang/Object", false,
+		[]string{"test/IntfD1", "test/IntfD2"}, nil)
+
+	f := invokeinterfaceFrame("test/IntfD1", "test/ImplD")
+	invokeinterfaceCatch(t, &f, "java/lang/IncompatibleClassChangeError", "Conflicting default methods")
+}
 
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
+// INVOKEINTERFACE: an interface method that has no implementation
+func TestInvokeinterfaceAbstractMethod(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/IntfE", "java/lang/Object", true, nil,
+		map[string]*classloader.Method{"getValue()I": {AccessFlags: 0x0401}})
+	invokeinterfaceAddClass("test/ImplE", "java/lang/Object", false, []string{"test/IntfE"}, nil)
 
-	val := pop(&f).(float64)
-	if val != 21.0 {
-		t.Errorf("L2D: expected a result of 21.0, but got: %f", val)
+	f := invokeinterfaceFrame("test/IntfE", "test/ImplE")
+	invokeinterfaceCatch(t, &f, "java/lang/AbstractMethodError", "does not define or inherit an implementation")
+}
+
+// INVOKEINTERFACE: the object's class does not implement the interface
+func TestInvokeinterfaceNotImplemented(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/IntfF", "java/lang/Object", true, nil,
+		map[string]*classloader.Method{"getValue()I": {AccessFlags: 0x0401}})
+	invokeinterfaceAddClass("test/ImplF", "java/lang/Object", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(13)})
+
+	f := invokeinterfaceFrame("test/IntfF", "test/ImplF")
+	invokeinterfaceCatch(t, &f, "java/lang/IncompatibleClassChangeError", "does not implement the requested interface")
+}
+
+// INVOKEINTERFACE: the resolved class must be an interface
+func TestInvokeinterfaceOnClass(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/ImplG", "java/lang/Object", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(14)})
+
+	f := invokeinterfaceFrame("test/ImplG", "test/ImplG")
+	invokeinterfaceCatch(t, &f, "java/lang/IncompatibleClassChangeError", "but interface was expected")
+}
+
+// INVOKEINTERFACE: calling an interface method on a null object
+func TestInvokeinterfaceNullObject(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/IntfH", "java/lang/Object", true, nil,
+		map[string]*classloader.Method{"getValue()I": {AccessFlags: 0x0401}})
+
+	f := invokeinterfaceFrame("test/IntfH", "")
+	invokeinterfaceCatch(t, &f, "java/lang/NullPointerException", "because the object is null")
+}
+
+// INVOKEVIRTUAL: create a frame that calls className.getValue()I on an object of
+// class objClass. The classes are added with invokeinterfaceAddClass().
+func invokevirtualFrame(className, objClass string) frames.Frame {
+	f := newFrame(opcodes.INVOKEVIRTUAL)
+	f.Meth = append(f.Meth, 0x00, 0x01) // CP slot 1
+
+	CP := classloader.CPool{}
+	CP.CpIndex = make([]classloader.CpEntry, 7, 7)
+	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
+	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.MethodRef, Slot: 0}
+	CP.CpIndex[2] = classloader.CpEntry{Type: classloader.ClassRef, Slot: 0}
+	CP.CpIndex[3] = classloader.CpEntry{Type: classloader.UTF8, Slot: 0}
+	CP.CpIndex[4] = classloader.CpEntry{Type: classloader.NameAndType, Slot: 0}
+	CP.CpIndex[5] = classloader.CpEntry{Type: classloader.UTF8, Slot: 1}
+	CP.CpIndex[6] = classloader.CpEntry{Type: classloader.UTF8, Slot: 2}
+	CP.MethodRefs = []classloader.MethodRefEntry{{ClassIndex: 2, NameAndType: 4}}
+	CP.ClassRefs = []uint16{3}
+	CP.NameAndTypes = []classloader.NameAndTypeEntry{{NameIndex: 5, DescIndex: 6}}
+	CP.Utf8Refs = []string{className, "getValue", "()I"}
+	f.CP = &CP
+
+	obj := object.MakeEmptyObject()
+	obj.Klass = &objClass
+	push(&f, obj)
+	return f
+}
+
+// INVOKEVIRTUAL: a method overridden in the object's class is the one called,
+// even though the CP names the superclass (Animal a = new Dog(); a.getValue())
+func TestInvokevirtualOverridden(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/AnimalA", "java/lang/Object", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(1)})
+	invokeinterfaceAddClass("test/DogA", "test/AnimalA", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(2)})
+
+	f := invokevirtualFrame("test/AnimalA", "test/DogA")
+	err := invokeinterfaceRun(&f)
+	if err != nil {
+		t.Fatalf("INVOKEVIRTUAL: Unexpected error: %s", err.Error())
 	}
-	if f.TOS != -1 {
-		t.Errorf("L2D: Expected stack with 0 items, but got a TOS of: %d", f.TOS)
+	if ret := pop(&f).(int64); ret != 2 {
+		t.Errorf("INVOKEVIRTUAL: Expected the overriding method to return 2, got: %d", ret)
 	}
 }
 
-// L2I: Convert long to int
-func TestL2i(t *testing.T) {
-	f := newFrame(opcodes.L2I)
-	push(&f, int64(21)) // longs require two slots, so pushed twice
-	push(&f, int64(21))
+// INVOKEVIRTUAL: a method the object's class inherits is found in the nearest
+// superclass that declares it
+func TestInvokevirtualInherited(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/AnimalB", "java/lang/Object", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(1)})
+	invokeinterfaceAddClass("test/DogB", "test/AnimalB", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(2)})
+	invokeinterfaceAddClass("test/PuppyB", "test/DogB", false, nil, nil)
+
+	f := invokevirtualFrame("test/PuppyB", "test/PuppyB")
+	err := invokeinterfaceRun(&f)
+	if err != nil {
+		t.Fatalf("INVOKEVIRTUAL: Unexpected error: %s", err.Error())
+	}
+	if ret := pop(&f).(int64); ret != 2 {
+		t.Errorf("INVOKEVIRTUAL: Expected the method inherited from DogB to return 2, got: %d", ret)
+	}
 
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
+	entry, ok := classloader.VTableFetch(classloader.MethAreaFetch("test/PuppyB"), "getValue", "()I")
+	if !ok || entry.ClName != "test/DogB" {
+		t.Errorf("INVOKEVIRTUAL: Expected PuppyB's vtable to select DogB.getValue(), got: %v", entry)
+	}
+}
 
-	val := pop(&f).(int64)
-	if val != 21 {
-		t.Errorf("L2I: expected a result of 21, but got: %d", val)
+// INVOKEVIRTUAL: a private method is not overridden by a method of the same name
+// in a subclass
+func TestInvokevirtualPrivate(t *testing.T) {
+	private := invokeinterfaceMethod(1)
+	private.AccessFlags = 0x0002 // private
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/AnimalC", "java/lang/Object", false, nil,
+		map[string]*classloader.Method{"getValue()I": private})
+	invokeinterfaceAddClass("test/DogC", "test/AnimalC", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(2)})
+
+	f := invokevirtualFrame("test/AnimalC", "test/DogC")
+	err := invokeinterfaceRun(&f)
+	if err != nil {
+		t.Fatalf("INVOKEVIRTUAL: Unexpected error: %s", err.Error())
 	}
-	if f.TOS != -1 {
-		t.Errorf("L2I: Expected stack with 0 items, but got a TOS of: %d", f.TOS)
+	if ret := pop(&f).(int64); ret != 1 {
+		t.Errorf("INVOKEVIRTUAL: Expected the private method to return 1, got: %d", ret)
 	}
 }
 
-// L2I: Convert long to int (test with negative value)
-func TestL2ineg(t *testing.T) {
-	f := newFrame(opcodes.L2I)
-	push(&f, int64(-21)) // longs require two slots, so pushed twice
-	push(&f, int64(-21))
+// INVOKEVIRTUAL: calling an abstract method that the object's class doesn't
+// implement results in an AbstractMethodError
+func TestInvokevirtualAbstract(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/ShapeD", "java/lang/Object", false, nil,
+		map[string]*classloader.Method{"getValue()I": {AccessFlags: 0x0401}}) // public abstract
+	invokeinterfaceAddClass("test/SquareD", "test/ShapeD", false, nil, nil)
+
+	f := invokevirtualFrame("test/ShapeD", "test/SquareD")
+	invokeinterfaceCatch(t, &f, "java/lang/AbstractMethodError", "does not define or inherit an implementation")
+}
+
+// INVOKEVIRTUAL : invoke method -- here testing for error
+func TestInvokevirtualInvalid(t *testing.T) {
+	f := newFrame(opcodes.INVOKEVIRTUAL)
+	f.Meth = append(f.Meth, 0x00)
+	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
+
+	CP := classloader.CPool{}
+	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
+	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
+	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.ClassRef, Slot: 0} // should be a method ref
+	// now create the pointed-to FieldRef
+	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
+	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
+	f.CP = &CP
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
+	err := runFrame(fs)
 
-	val := pop(&f).(int64)
-	if val != -21 {
-		t.Errorf("L2I: expected a result of -21, but got: %d", val)
-	}
-	if f.TOS != -1 {
-		t.Errorf("L2I: Expected stack with 0 items, but got a TOS of: %d", f.TOS)
+	if err == nil {
+		t.Errorf("INVOKEVIRTUAL: Expected error but did not get one.")
+	} else {
+		errMsg := err.Error()
+		if !strings.Contains(errMsg, "Expected a method ref, but got") {
+			t.Errorf("INVOKEVIRTUAL: Did not get expected error message, got: %s", errMsg)
+		}
 	}
 }
 
-// LADD: Add two longs
-func TestLadd(t *testing.T) {
-	f := newFrame(opcodes.LADD)
-	push(&f, int64(21)) // longs require two slots, so pushed twice
+// IOR: Logical OR of two ints
+func TestIor(t *testing.T) {
+	f := newFrame(opcodes.IOR)
 	push(&f, int64(21))
-
-	push(&f, int64(22))
 	push(&f, int64(22))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	value := pop(&f).(int64) // longs require two slots, so popped twice
-	pop(&f)
+	value := pop(&f).(int64)
 
-	if value != 43 {
-		t.Errorf("LADD: expected a result of 43, but got: %d", value)
+	if value != 23 { // 21 | 22 = 23
+		t.Errorf("IOR: expected a result of 23, but got: %d", value)
 	}
 	if f.TOS != -1 {
-		t.Errorf("LADD: Expected an empty stack, but got a TOS of: %d", f.TOS)
+		t.Errorf("IOR: Expected an empty stack, but got a tos of: %d", f.TOS)
 	}
 }
 
-// LAND: Logical and of two longs, push result
-func TestLand(t *testing.T) {
-	f := newFrame(opcodes.LAND)
-	push(&f, int64(21)) // longs require two slots, so pushed twice
-	push(&f, int64(21))
-
-	push(&f, int64(22))
-	push(&f, int64(22))
+// IREM: int modulo
+func TestIrem(t *testing.T) {
+	f := newFrame(opcodes.IREM)
+	push(&f, int64(74))
+	push(&f, int64(6))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	value := pop(&f).(int64) // longs require two slots, so popped twice
-	pop(&f)
-
-	if value != 20 { // 21 & 22 = 20
-		t.Errorf("LAND: expected a result of 20, but got: %d", value)
+	if f.TOS != 0 { // product is pushed twice b/c it's a long, which occupies 2 slots
+		t.Errorf("IREM, Top of stack, expected 1, got: %d", f.TOS)
 	}
-	if f.TOS != -1 {
-		t.Errorf("LAND: Expected an empty stack, but got a TOS of: %d", f.TOS)
+
+	value := pop(&f).(int64)
+	if value != 2 {
+		t.Errorf("IREM: Expected result to be 2, got: %d", value)
 	}
 }
 
-// LCMP: compare two longs (using two equal values)
-func TestLcmpEQ(t *testing.T) {
-	f := newFrame(opcodes.LCMP)
-	push(&f, int64(21)) // longs require two slots, so pushed twice
-	push(&f, int64(21))
+// IREM: int modulo -- divide by zero
+func TestIremDivideByZero(t *testing.T) {
+	f := newFrame(opcodes.IREM)
+	push(&f, int64(6))
+	push(&f, int64(0))
 
-	push(&f, int64(21))
-	push(&f, int64(21))
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+	errMsg := err.Error()
+	if !strings.Contains(errMsg, "divide by zero") {
+		t.Errorf("IREM: Expected divide by zero error msg, got: %s", errMsg)
+	}
+}
+
+// IRETURN: push an int on to the op stack of the calling method and exit the present method/frame
+func TestIreturn(t *testing.T) {
+	f0 := newFrame(0)
+	push(&f0, int64(20))
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f0)
+	f1 := newFrame(opcodes.IRETURN)
+	push(&f1, int64(21))
+	fs.PushFront(&f1)
+	_ = runFrame(fs)
+	_ = frames.PopFrame(fs)
+	f3 := fs.Front().Value.(*frames.Frame)
+	newVal := pop(f3).(int64)
+	if newVal != 21 {
+		t.Errorf("After IRETURN, expected a value of 21 in previous frame, got: %d", newVal)
+	}
+	prevVal := pop(f3).(int64)
+	if prevVal != 20 {
+		t.Errorf("After IRETURN, expected a value of 20 in 2nd place of previous frame, got: %d", prevVal)
+	}
+}
+
+// ISHL: Left shift of long
+func TestIshl(t *testing.T) {
+	f := newFrame(opcodes.ISHL)
+	push(&f, int64(22)) // longs require two slots, so pushed twice
+	push(&f, int64(3))  // shift left 3 bits
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	value := pop(&f).(int64)
-	if value != 0 {
-		t.Errorf("LCMP: Expected comparison to result in 0, got: %d", value)
+	value := pop(&f).(int64) // longs require two slots, so popped twice
+
+	if value != 176 { // 22 << 3 = 176
+		t.Errorf("ISHL: expected a result of 176, but got: %d", value)
 	}
 	if f.TOS != -1 {
-		t.Errorf("LCMP: Expected an empty stack, but got a tos of: %d", f.TOS)
+		t.Errorf("ISHL: Expected an empty stack, but got a tos of: %d", f.TOS)
 	}
 }
 
-// LCMP: compare two longs (with val1 > val2)
-func TestLcmpGT(t *testing.T) {
-	f := newFrame(opcodes.LCMP)
-	push(&f, int64(22)) // longs require two slots, so pushed twice
-	push(&f, int64(22))
-
-	push(&f, int64(21))
-	push(&f, int64(21))
+// ISHR: Right shift of int
+func TestIshr(t *testing.T) {
+	f := newFrame(opcodes.ISHR)
+	push(&f, int64(200))
+	push(&f, int64(3)) // shift right 3 bits
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	value := pop(&f).(int64)
-	if value != 1 {
-		t.Errorf("LCMP: Expected comparison to result in 1, got: %d", value)
+	value := pop(&f).(int64) // longs require two slots, so popped twice
+
+	if value != 25 { // 200 >> 3 = 25
+		t.Errorf("ISHR: expected a result of 25, but got: %d", value)
 	}
 	if f.TOS != -1 {
-		t.Errorf("LCMP: Expected an empty stack, but got a tos of: %d", f.TOS)
+		t.Errorf("ISHR: Expected an empty stack, but got a tos of: %d", f.TOS)
 	}
 }
 
-// LCMP: compare two longs (using val1 < val2)
-func TestLcmpLT(t *testing.T) {
-	f := newFrame(opcodes.LCMP)
-	push(&f, int64(21)) // longs require two slots, so pushed twice
-	push(&f, int64(21))
-
-	push(&f, int64(22))
-	push(&f, int64(22))
+// ISHR: Right shift of negative int
+func TestIshrNeg(t *testing.T) {
+	f := newFrame(opcodes.ISHR)
+	push(&f, int64(-200))
+	push(&f, int64(3)) // shift right 3 bits
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	value := pop(&f).(int64)
-	if value != -1 {
-		t.Errorf("LCMP: Expected comparison to result in -1, got: %d", value)
+	value := pop(&f).(int64) // longs require two slots, so popped twice
+
+	if value != -25 { // 200 >> 3 = -25
+		t.Errorf("ISHR: expected a result of -25, but got: %d", value)
 	}
 	if f.TOS != -1 {
-		t.Errorf("LCMP: Expected an empty stack, but got a tos of: %d", f.TOS)
+		t.Errorf("ISHR: Expected an empty stack, but got a tos of: %d", f.TOS)
 	}
+	/*
+		// The following code runs correctly and prints -25 to the
+		// console during test results.
+		var printArray = make([]interface{}, 2)
+		printArray[0] = 0
+		printArray[1] = value
+		classloader.PrintlnI(printArray)
+	*/
+
 }
 
-// LCONST_0: push a long 0 onto opStack
-func TestLconst0(t *testing.T) {
-	f := newFrame(opcodes.LCONST_0)
+// ISTORE: Store integer from stack into local specified by following byte.
+func TestIstore(t *testing.T) {
+	f := newFrame(opcodes.ISTORE)
+	f.Meth = append(f.Meth, 0x02) // use local var #2
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	push(&f, int64(0x22223))
+
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	if f.TOS != 1 {
-		t.Errorf("Top of stack, expected 1, got: %d", f.TOS)
+
+	if getLocal(&f, 2) != int64(0x22223) {
+		t.Errorf("ISTORE: Expecting 0x22223 in locals[2], got: 0x%x", getLocal(&f, 2))
 	}
-	value := pop(&f).(int64)
-	if value != 0 {
-		t.Errorf("LCONST_0: Expected popped value to be 0, got: %d", value)
+
+	if f.TOS != -1 {
+		t.Errorf("ISTORE: Expecting an empty stack, but tos points to item: %d", f.TOS)
 	}
 }
 
-// LCONST_1: push a long 1 onto opStack
-func TestLconst1(t *testing.T) {
-	f := newFrame(opcodes.LCONST_1)
+// ISTORE_0: Store integer from stack into localVar[0]
+func TestIstore0(t *testing.T) {
+	f := newFrame(opcodes.ISTORE_0)
+	f.Locals = append(f.Locals, zero)
+	push(&f, int64(220))
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	if f.TOS != 1 {
-		t.Errorf("Top of stack, expected 1, got: %d", f.TOS)
+	if getLocal(&f, 0) != int64(220) {
+		t.Errorf("ISTORE_0: expected lcoals[0] to be 220, got: %d", getLocal(&f, 0))
 	}
-	value := pop(&f).(int64)
-	if value != 1 {
-		t.Errorf("LCONST_1: Expected popped value to be 1, got: %d", value)
+	if f.TOS != -1 {
+		t.Errorf("ISTORE_0: Expected op stack to be empty, got tos: %d", f.TOS)
 	}
 }
 
-// LDC_W: get CP entry indexed by following byte
-func TestLdc(t *testing.T) {
-	f := newFrame(opcodes.LDC)
-	f.Meth = append(f.Meth, 0x01)
-
-	cp := classloader.CPool{}
-	f.CP = &cp
-	CP := f.CP.(*classloader.CPool)
-	// now create a skeletal, two-entry CP
-	var ints = make([]int32, 1)
-	CP.IntConsts = ints
-	CP.IntConsts[0] = 25
-
-	CP.CpIndex = []classloader.CpEntry{}
-	dummyEntry := classloader.CpEntry{}
-	doubleEntry := classloader.CpEntry{
-		Type: classloader.IntConst, Slot: 0,
+// ISTORE1
+func TestIstore1(t *testing.T) {
+	f := newFrame(opcodes.ISTORE_1)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	push(&f, int64(221))
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+	if getLocal(&f, 1) != int64(221) {
+		t.Errorf("ISTORE_1: expected locals[1] to be 221, got: %d", getLocal(&f, 1))
 	}
-	CP.CpIndex = append(CP.CpIndex, dummyEntry)
-	CP.CpIndex = append(CP.CpIndex, doubleEntry)
+	if f.TOS != -1 {
+		t.Errorf("ISTORE_1: Expected op stack to be empty, got tos: %d", f.TOS)
+	}
+}
 
+// ISTORE2
+func TestIstore2(t *testing.T) {
+	f := newFrame(opcodes.ISTORE_2)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	push(&f, int64(222))
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	if f.TOS != 0 {
-		t.Errorf("Top of stack, expected 0, got: %d", f.TOS)
+	if getLocal(&f, 2) != int64(222) {
+		t.Errorf("ISTORE_2: expected locals[2] to be 222, got: %d", getLocal(&f, 2))
 	}
-	value := pop(&f).(int64)
-	if value != 25 {
-		t.Errorf("LDC_W: Expected popped value to be 25, got: %d", value)
+	if f.TOS != -1 {
+		t.Errorf("ISTORE_2: Expected op stack to be empty, got tos: %d", f.TOS)
 	}
 }
 
-// Test LDC_W: get int64 CP entry indexed by two bytes
-func TestLdcw(t *testing.T) {
-	f := newFrame(opcodes.LDC_W)
-	f.Meth = append(f.Meth, 0x00)
-	f.Meth = append(f.Meth, 0x01)
-
-	cp := classloader.CPool{}
-	f.CP = &cp
-	CP := f.CP.(*classloader.CPool)
-	// now create a skeletal, two-entry CP
-	var ints = make([]int32, 1)
-	CP.IntConsts = ints
-	CP.IntConsts[0] = 25
-
-	CP.CpIndex = []classloader.CpEntry{}
-	dummyEntry := classloader.CpEntry{}
-	doubleEntry := classloader.CpEntry{
-		Type: classloader.IntConst, Slot: 0,
+func TestIstore3(t *testing.T) {
+	f := newFrame(opcodes.ISTORE_3)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	push(&f, int64(223))
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+	if getLocal(&f, 3) != int64(223) {
+		t.Errorf("ISTORE_3: expected locals[3] to be 223, got: %d", getLocal(&f, 3))
 	}
-	CP.CpIndex = append(CP.CpIndex, dummyEntry)
-	CP.CpIndex = append(CP.CpIndex, doubleEntry)
+	if f.TOS != -1 {
+		t.Errorf("ISTORE_3: Expected op stack to be empty, got tos: %d", f.TOS)
+	}
+}
 
+// ISUB: integer subtraction
+func TestIsub(t *testing.T) {
+	f := newFrame(opcodes.ISUB)
+	push(&f, int64(10))
+	push(&f, int64(7))
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 	if f.TOS != 0 {
-		t.Errorf("Top of stack, expected 0, got: %d", f.TOS)
+		t.Errorf("ISUB, Top of stack, expected 0, got: %d", f.TOS)
 	}
 	value := pop(&f).(int64)
-	if value != 25 {
-		t.Errorf("LDC_W: Expected popped value to be 25, got: %d", value)
+	if value != 3 {
+		t.Errorf("ISUB: Expected popped value to be 3, got: %d", value)
 	}
 }
 
-// LDC_W: get float64 CP entry indexed by two bytes
-func TestLdcwFloat(t *testing.T) {
-	f := newFrame(opcodes.LDC_W)
-	f.Meth = append(f.Meth, 0x00)
-	f.Meth = append(f.Meth, 0x01)
-
-	cp := classloader.CPool{}
-	f.CP = &cp
-	CP := f.CP.(*classloader.CPool)
-	// now create a skeletal, two-entry CP
-	var floats = make([]float32, 1)
-	CP.Floats = floats
-	CP.Floats[0] = 25.0
-
-	CP.CpIndex = []classloader.CpEntry{}
-	dummyEntry := classloader.CpEntry{}
-	floatEntry := classloader.CpEntry{
-		Type: classloader.FloatConst, Slot: 0,
-	}
-	CP.CpIndex = append(CP.CpIndex, dummyEntry)
-	CP.CpIndex = append(CP.CpIndex, floatEntry)
+// IUSHR: unsigned right shift of int
+func TestIushr(t *testing.T) {
+	f := newFrame(opcodes.IUSHR)
+	push(&f, int64(-200))
+	push(&f, int64(3)) // shift right 3 bits
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	if f.TOS != 0 {
-		t.Errorf("Top of stack, expected 0, got: %d", f.TOS)
+
+	value := pop(&f).(int64) // longs require two slots, so popped twice
+
+	if value != 25 { // 200 >> 3 = 25
+		t.Errorf("IUSHR: expected a result of 25, but got: %d", value)
 	}
-	value := pop(&f).(float64)
-	if value != 25.0 {
-		t.Errorf("LDC_W: Expected popped value to be 25.0, got: %f", value)
+	if f.TOS != -1 {
+		t.Errorf("IUSHR: Expected an empty stack, but got a tos of: %d", f.TOS)
 	}
 }
 
-// LDC2_W: get CP entry for long or double indexed by following 2 bytes
-func TestLdc2w(t *testing.T) {
-	f := newFrame(opcodes.LDC2_W)
-	f.Meth = append(f.Meth, 0x00)
-	f.Meth = append(f.Meth, 0x01)
-
-	cp := classloader.CPool{}
-	f.CP = &cp
-	CP := f.CP.(*classloader.CPool)
-	// now create a skeletal, two-entry CP
-	var doubles = make([]float64, 1)
-	CP.Doubles = doubles
-	CP.Doubles[0] = 25.0
-
-	CP.CpIndex = []classloader.CpEntry{}
-	dummyEntry := classloader.CpEntry{}
-	doubleEntry := classloader.CpEntry{
-		Type: classloader.DoubleConst, Slot: 0,
-	}
-	CP.CpIndex = append(CP.CpIndex, dummyEntry)
-	CP.CpIndex = append(CP.CpIndex, doubleEntry)
+// IXOR: Logical XOR of two ints
+func TestIxor(t *testing.T) {
+	f := newFrame(opcodes.IXOR)
+	push(&f, int64(21))
+	push(&f, int64(22))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	if f.TOS != 1 {
-		t.Errorf("Top of stack, expected 1, got: %d", f.TOS)
+
+	value := pop(&f).(int64)
+	if value != 3 { // 21 ^ 22 = 3
+		t.Errorf("IXOR: expected a result of 3, but got: %d", value)
 	}
-	value := pop(&f).(float64)
-	if value != 25.0 {
-		t.Errorf("LDC2_W: Expected popped value to be 25.0, got: %f", value)
+	if f.TOS != -1 {
+		t.Errorf("IXOR: Expected an empty stack, but got a tos of: %d", f.TOS)
 	}
 }
 
-// LDIV: (pop 2 longs, divide second term by top of stack, push result)
-func TestLdiv(t *testing.T) {
-	f := newFrame(opcodes.LDIV)
-	push(&f, int64(70))
-	push(&f, int64(70))
-
-	push(&f, int64(10))
-	push(&f, int64(10))
+// JSR: jump to a subroutine that stores the return address in a local, sets
+// local 0 to 7, and returns with RET. The caller then pushes local 0.
+func TestJsrAndRet(t *testing.T) {
+	f := newFrame(opcodes.JSR)
+	f.Meth = append(f.Meth, 0x00, 0x07)             // 0: JSR to 7
+	f.Meth = append(f.Meth, opcodes.ILOAD_0)        // 3:
+	f.Meth = append(f.Meth, opcodes.GOTO, 0x00, 9)  // 4: GOTO the end of the method
+	f.Meth = append(f.Meth, opcodes.ASTORE_1)       // 7: subroutine: store the return address
+	f.Meth = append(f.Meth, opcodes.BIPUSH, 0x07)   // 8:
+	f.Meth = append(f.Meth, opcodes.ISTORE_0)       // 10:
+	f.Meth = append(f.Meth, opcodes.RET, 0x01)      // 11: return to 3
+	f.Locals = append(f.Locals, int64(0), int64(0)) // two locals
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-
-	if f.TOS != 1 { // product is pushed twice b/c it's a long, which occupies 2 slots
-		t.Errorf("LDIV, Top of stack, expected 1, got: %d", f.TOS)
+	err := runFrame(fs)
+	if err != nil {
+		t.Fatalf("JSR: Unexpected error: %s", err.Error())
 	}
 
-	value := pop(&f).(int64)
-	pop(&f)
-	if value != 7 {
-		t.Errorf("LDIV: Expected popped value to be 70, got: %d", value)
+	if getLocal(&f, 1) != returnAddress(3) {
+		t.Errorf("JSR: Expected return address 3 in local 1, got: %v", getLocal(&f, 1))
+	}
+	if f.TOS != 0 {
+		t.Fatalf("JSR: Expected one item on the stack, got a tos of: %d", f.TOS)
+	}
+	if value := pop(&f).(int64); value != 7 {
+		t.Errorf("JSR: Expected the subroutine to set local 0 to 7, got: %d", value)
 	}
 }
 
-// LDIV: with divide by zero error
-func TestLdivDivideByZero(t *testing.T) {
-	f := newFrame(opcodes.LDIV)
-	push(&f, int64(10))
-	push(&f, int64(10))
-
-	push(&f, int64(0))
-	push(&f, int64(0))
+// JSR_W: jump to a subroutine using a four-byte offset
+func TestJsrWAndRet(t *testing.T) {
+	f := newFrame(opcodes.JSR_W)
+	f.Meth = append(f.Meth, 0x00, 0x00, 0x00, 0x09) // 0: JSR_W to 9
+	f.Meth = append(f.Meth, opcodes.ILOAD_0)        // 5:
+	f.Meth = append(f.Meth, opcodes.GOTO, 0x00, 9)  // 6: GOTO the end of the method
+	f.Meth = append(f.Meth, opcodes.ASTORE_1)       // 9: subroutine: store the return address
+	f.Meth = append(f.Meth, opcodes.BIPUSH, 0x09)   // 10:
+	f.Meth = append(f.Meth, opcodes.ISTORE_0)       // 12:
+	f.Meth = append(f.Meth, opcodes.RET, 0x01)      // 13: return to 5
+	f.Locals = append(f.Locals, int64(0), int64(0)) // two locals
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
-	res := runFrame(fs)
+	err := runFrame(fs)
+	if err != nil {
+		t.Fatalf("JSR_W: Unexpected error: %s", err.Error())
+	}
 
-	if !strings.Contains(res.Error(), "divide by zero") {
-		t.Errorf("LDIV: Expected err msg re divide by zero, got: %s", res.Error())
+	if getLocal(&f, 1) != returnAddress(5) {
+		t.Errorf("JSR_W: Expected return address 5 in local 1, got: %v", getLocal(&f, 1))
+	}
+	if f.TOS != 0 {
+		t.Fatalf("JSR_W: Expected one item on the stack, got a tos of: %d", f.TOS)
+	}
+	if value := pop(&f).(int64); value != 9 {
+		t.Errorf("JSR_W: Expected the subroutine to set local 0 to 9, got: %d", value)
 	}
 }
 
-// LLOAD: test load of long in locals[index] on to stack
-func TestLload(t *testing.T) {
-	f := newFrame(opcodes.LLOAD)
-	f.Meth = append(f.Meth, 0x04) // use local var #4
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, int64(0x1234562)) // put value in locals[4]
+// L2D: Convert long to double
+func TestL2d(t *testing.T) {
+	f := newFrame(opcodes.L2D)
+	push(&f, int64(21)) // longs require two slots, so pushed twice
+	push(&f, int64(21))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	x := pop(&f).(int64)
-	pop(&f) // pop twice due to two entries on op stack due to 64-bit width of data type
-	if x != 0x1234562 {
-		t.Errorf("LLOAD: Expecting 0x1234562 on stack, got: 0x%x", x)
-	}
-	if f.TOS != -1 {
-		t.Errorf("LLOAD: Expecting an empty stack, but tos points to item: %d", f.TOS)
+
+	val := pop(&f).(float64)
+	if val != 21.0 {
+		t.Errorf("L2D: expected a result of 21.0, but got: %f", val)
 	}
-	if f.PC != 2 {
-		t.Errorf("LLOAD: Expected pc to be pointing at byte 2, got: %d", f.PC)
+	if f.TOS != 0 {
+		t.Errorf("L2D: Expected stack with 1 item, but got a TOS of: %d", f.TOS)
 	}
 }
 
-// LLOAD_0: Load long from locals[0]
-func TestLload0(t *testing.T) {
-	f := newFrame(opcodes.LLOAD_0)
-
-	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[0]
-	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[1] // lload uses two local consecutive
+// L2F: Convert long to float
+func TestL2f(t *testing.T) {
+	f := newFrame(opcodes.L2F)
+	push(&f, int64(21)) // longs require two slots, so pushed twice
+	push(&f, int64(21))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	x := pop(&f).(int64)
-	pop(&f) // due to longs taking 2 slots
-	if x != 0x12345678 {
-		t.Errorf("LLOAD_0: Expecting 0x12345678 on stack, got: 0x%x", x)
-	}
 
-	if f.Locals[1] != x {
-		t.Errorf("LLOAD_0: Local variable[1] holds invalid value: 0x%x", f.Locals[2])
+	val := pop(&f).(float64)
+	if val != 21.0 {
+		t.Errorf("L2D: expected a result of 21.0, but got: %f", val)
 	}
-
 	if f.TOS != -1 {
-		t.Errorf("LLOAD_0: Expecting an empty stack, but tos points to item: %d", f.TOS)
+		t.Errorf("L2D: Expected stack with 0 items, but got a TOS of: %d", f.TOS)
 	}
 }
 
-// LLOAD_1: Load long from locals[1]
-func TestLload1(t *testing.T) {
-	f := newFrame(opcodes.LLOAD_1)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[1]
-	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[2] // lload uses two local consecutive
+// L2I: Convert long to int
+func TestL2i(t *testing.T) {
+	f := newFrame(opcodes.L2I)
+	push(&f, int64(21)) // longs require two slots, so pushed twice
+	push(&f, int64(21))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	x := pop(&f).(int64)
-	pop(&f) // due to longs taking two slots
-	if x != 0x12345678 {
-		t.Errorf("LLOAD_1: Expecting 0x12345678 on stack, got: 0x%x", x)
-	}
 
-	if f.Locals[2] != x {
-		t.Errorf("LLOAD_1: Local variable[2] holds invalid value: 0x%x", f.Locals[2])
+	val := pop(&f).(int64)
+	if val != 21 {
+		t.Errorf("L2I: expected a result of 21, but got: %d", val)
 	}
-
 	if f.TOS != -1 {
-		t.Errorf("LLOAD_1: Expecting an empty stack, but tos points to item: %d", f.TOS)
+		t.Errorf("L2I: Expected stack with 0 items, but got a TOS of: %d", f.TOS)
 	}
 }
 
-// LLOAD_2: Load long from locals[2]
-func TestLload2(t *testing.T) {
-	f := newFrame(opcodes.LLOAD_2)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[2]
-	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[3] // lload uses two local consecutive
+// L2I: Convert long to int (test with negative value)
+func TestL2ineg(t *testing.T) {
+	f := newFrame(opcodes.L2I)
+	push(&f, int64(-21)) // longs require two slots, so pushed twice
+	push(&f, int64(-21))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	x := pop(&f).(int64)
-	pop(&f) // due to longs taking two slots
-	if x != 0x12345678 {
-		t.Errorf("LLOAD_12: Expecting 0x12345678 on stack, got: 0x%x", x)
-	}
 
-	if f.Locals[3] != x {
-		t.Errorf("LLOAD_2: Local variable[3] holds invalid value: 0x%x", f.Locals[3])
+	val := pop(&f).(int64)
+	if val != -21 {
+		t.Errorf("L2I: expected a result of -21, but got: %d", val)
 	}
-
 	if f.TOS != -1 {
-		t.Errorf("LLOAD_1: Expecting an empty stack, but tos points to item: %d", f.TOS)
+		t.Errorf("L2I: Expected stack with 0 items, but got a TOS of: %d", f.TOS)
 	}
 }
 
-// LLOAD_3: Load long from locals[3]
-func TestLload3(t *testing.T) {
-	f := newFrame(opcodes.LLOAD_3)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[3]
-	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[4] // lload uses two local consecutive
+// LADD: Add two longs
+func TestLadd(t *testing.T) {
+	f := newFrame(opcodes.LADD)
+	push(&f, int64(21)) // longs require two slots, so pushed twice
+	push(&f, int64(21))
+
+	push(&f, int64(22))
+	push(&f, int64(22))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	x := pop(&f).(int64)
-	pop(&f) // due to longs taking two slots
-	if x != 0x12345678 {
-		t.Errorf("LLOAD_3: Expecting 0x12345678 on stack, got: 0x%x", x)
-	}
 
-	if f.Locals[4] != x {
-		t.Errorf("LLOAD_3: Local variable[4] holds invalid value: 0x%x", f.Locals[4])
-	}
+	value := pop(&f).(int64) // longs require two slots, so popped twice
+	pop(&f)
 
+	if value != 43 {
+		t.Errorf("LADD: expected a result of 43, but got: %d", value)
+	}
 	if f.TOS != -1 {
-		t.Errorf("LLOAD_3: Expecting an empty stack, but tos points to item: %d", f.TOS)
+		t.Errorf("LADD: Expected an empty stack, but got a TOS of: %d", f.TOS)
 	}
 }
 
-// LMUL: pop 2 longs, multiply them, push result
-func TestLmul(t *testing.T) {
-	f := newFrame(opcodes.LMUL)
-	push(&f, int64(10))
-	push(&f, int64(10))
+// LAND: Logical and of two longs, push result
+func TestLand(t *testing.T) {
+	f := newFrame(opcodes.LAND)
+	push(&f, int64(21)) // longs require two slots, so pushed twice
+	push(&f, int64(21))
 
-	push(&f, int64(7))
-	push(&f, int64(7))
+	push(&f, int64(22))
+	push(&f, int64(22))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.TOS != 1 { // product is pushed twice b/c it's a long, which occupies 2 slots
-		t.Errorf("LMUL, Top of stack, expected 1, got: %d", f.TOS)
-	}
-
-	value := pop(&f).(int64)
+	value := pop(&f).(int64) // longs require two slots, so popped twice
 	pop(&f)
-	if value != 70 {
-		t.Errorf("LMUL: Expected popped value to be 70, got: %d", value)
+
+	if value != 20 { // 21 & 22 = 20
+		t.Errorf("LAND: expected a result of 20, but got: %d", value)
+	}
+	if f.TOS != -1 {
+		t.Errorf("LAND: Expected an empty stack, but got a TOS of: %d", f.TOS)
 	}
 }
 
-// LNEG: negate a long
-func TestLneg(t *testing.T) {
-	f := newFrame(opcodes.LNEG)
-	push(&f, int64(10))
-	push(&f, int64(10))
+// LCMP: compare two longs (using two equal values)
+func TestLcmpEQ(t *testing.T) {
+	f := newFrame(opcodes.LCMP)
+	push(&f, int64(21)) // longs require two slots, so pushed twice
+	push(&f, int64(21))
+
+	push(&f, int64(21))
+	push(&f, int64(21))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.TOS != 1 { // product is pushed twice b/c it's a long, which occupies 2 slots
-		t.Errorf("LNEG, Top of stack, expected 1, got: %d", f.TOS)
-	}
-
 	value := pop(&f).(int64)
-	pop(&f)
-	if value != -10 {
-		t.Errorf("LNEG: Expected popped value to be -10, got: %d", value)
+	if value != 0 {
+		t.Errorf("LCMP: Expected comparison to result in 0, got: %d", value)
+	}
+	if f.TOS != -1 {
+		t.Errorf("LCMP: Expected an empty stack, but got a tos of: %d", f.TOS)
 	}
 }
 
-// LOR: Logical OR of two longs
-func TestLor(t *testing.T) {
-	f := newFrame(opcodes.LOR)
-	push(&f, int64(21)) // longs require two slots, so pushed twice
-	push(&f, int64(21))
-
-	push(&f, int64(22))
+// LCMP: compare two longs (with val1 > val2)
+func TestLcmpGT(t *testing.T) {
+	f := newFrame(opcodes.LCMP)
+	push(&f, int64(22)) // longs require two slots, so pushed twice
 	push(&f, int64(22))
 
+	push(&f, int64(21))
+	push(&f, int64(21))
+
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	value := pop(&f).(int64) // longs require two slots, so popped twice
-	pop(&f)
-
-	if value != 23 { // 21 | 22 = 23
-		t.Errorf("LOR: expected a result of 23, but got: %d", value)
+	value := pop(&f).(int64)
+	if value != 1 {
+		t.Errorf("LCMP: Expected comparison to result in 1, got: %d", value)
 	}
 	if f.TOS != -1 {
-		t.Errorf("LOR: Expected an empty stack, but got a tos of: %d", f.TOS)
+		t.Errorf("LCMP: Expected an empty stack, but got a tos of: %d", f.TOS)
 	}
 }
 
-// LREM: remainder of long division (the % operator)
-func TestLrem(t *testing.T) {
-	f := newFrame(opcodes.LREM)
-	push(&f, int64(74))
-	push(&f, int64(74))
+// LCMP: compare two longs (using val1 < val2)
+func TestLcmpLT(t *testing.T) {
+	f := newFrame(opcodes.LCMP)
+	push(&f, int64(21)) // longs require two slots, so pushed twice
+	push(&f, int64(21))
 
-	push(&f, int64(6))
-	push(&f, int64(6))
+	push(&f, int64(22))
+	push(&f, int64(22))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.TOS != 1 { // product is pushed twice b/c it's a long, which occupies 2 slots
-		t.Errorf("LREM, Top of stack, expected 1, got: %d", f.TOS)
-	}
-
 	value := pop(&f).(int64)
-	pop(&f)
-	if value != 2 {
-		t.Errorf("LREM: Expected popped value to be 2, got: %d", value)
+	if value != -1 {
+		t.Errorf("LCMP: Expected comparison to result in -1, got: %d", value)
+	}
+	if f.TOS != -1 {
+		t.Errorf("LCMP: Expected an empty stack, but got a tos of: %d", f.TOS)
 	}
 }
 
-// LREM: long modulo -- divide by zero
-func TestLremDivideByZero(t *testing.T) {
-	f := newFrame(opcodes.LREM)
-	push(&f, int64(6))
-	push(&f, int64(6))
-	push(&f, int64(0))
-	push(&f, int64(0))
-
+// LCONST_0: push a long 0 onto opStack
+func TestLconst0(t *testing.T) {
+	f := newFrame(opcodes.LCONST_0)
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
-	err := runFrame(fs)
-	errMsg := err.Error()
-	if !strings.Contains(errMsg, "divide by zero") {
-		t.Errorf("LREM: Expected divide by zero error msg, got: %s", errMsg)
+	_ = runFrame(fs)
+	if f.TOS != 1 {
+		t.Errorf("Top of stack, expected 1, got: %d", f.TOS)
+	}
+	value := pop(&f).(int64)
+	if value != 0 {
+		t.Errorf("LCONST_0: Expected popped value to be 0, got: %d", value)
 	}
 }
 
-// LRETURN: Return a long from a function
-func TestLreturn(t *testing.T) {
-	f0 := newFrame(0)
-	push(&f0, int64(20))
+// LCONST_1: push a long 1 onto opStack
+func TestLconst1(t *testing.T) {
+	f := newFrame(opcodes.LCONST_1)
 	fs := frames.CreateFrameStack()
-	fs.PushFront(&f0)
-	f1 := newFrame(opcodes.LRETURN)
-	push(&f1, int64(21))
-	push(&f1, int64(21))
-	fs.PushFront(&f1)
+	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	_ = frames.PopFrame(fs)
-	f3 := fs.Front().Value.(*frames.Frame)
-	newVal := pop(f3).(int64)
-	if newVal != 21 {
-		t.Errorf("After LRETURN, expected a value of 21 in previous frame, got: %d", newVal)
+	if f.TOS != 1 {
+		t.Errorf("Top of stack, expected 1, got: %d", f.TOS)
 	}
-	pop(f3) // popped a second time due to longs taking two slots
-
-	prevVal := pop(f3).(int64)
-	if prevVal != 20 {
-		t.Errorf("After LRETURN, expected a value of 20 in 2nd place of previous frame, got: %d", prevVal)
+	value := pop(&f).(int64)
+	if value != 1 {
+		t.Errorf("LCONST_1: Expected popped value to be 1, got: %d", value)
 	}
 }
 
-// LSHL: Left shift of long
-func TestLshl(t *testing.T) {
-	f := newFrame(opcodes.LSHL)
-	push(&f, int64(22)) // longs require two slots, so pushed twice
-	push(&f, int64(22))
+// LDC_W: get CP entry indexed by following byte
+func TestLdc(t *testing.T) {
+	f := newFrame(opcodes.LDC)
+	f.Meth = append(f.Meth, 0x01)
 
-	push(&f, int64(3)) // shift left 3 bits
+	cp := classloader.CPool{}
+	f.CP = &cp
+	CP := f.CP.(*classloader.CPool)
+	// now create a skeletal, two-entry CP
+	var ints = make([]int32, 1)
+	CP.IntConsts = ints
+	CP.IntConsts[0] = 25
+
+	CP.CpIndex = []classloader.CpEntry{}
+	dummyEntry := classloader.CpEntry{}
+	doubleEntry := classloader.CpEntry{
+		Type: classloader.IntConst, Slot: 0,
+	}
+	CP.CpIndex = append(CP.CpIndex, dummyEntry)
+	CP.CpIndex = append(CP.CpIndex, doubleEntry)
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-
-	value := pop(&f).(int64) // longs require two slots, so popped twice
-	pop(&f)
-
-	if value != 176 { // 22 << 3 = 176
-		t.Errorf("LSHL: expected a result of 176, but got: %d", value)
+	if f.TOS != 0 {
+		t.Errorf("Top of stack, expected 0, got: %d", f.TOS)
 	}
-	if f.TOS != -1 {
-		t.Errorf("LSHL: Expected an empty stack, but got a tos of: %d", f.TOS)
+	value := pop(&f).(int64)
+	if value != 25 {
+		t.Errorf("LDC_W: Expected popped value to be 25, got: %d", value)
 	}
 }
 
-// LSHR: Right shift of long
-func TestLshr(t *testing.T) {
-	f := newFrame(opcodes.LSHR)
-	push(&f, int64(200)) // longs require two slots, so pushed twice
-	push(&f, int64(200))
+// Test LDC_W: get int64 CP entry indexed by two bytes
+func TestLdcw(t *testing.T) {
+	f := newFrame(opcodes.LDC_W)
+	f.Meth = append(f.Meth, 0x00)
+	f.Meth = append(f.Meth, 0x01)
 
-	push(&f, int64(3)) // shift left 3 bits
+	cp := classloader.CPool{}
+	f.CP = &cp
+	CP := f.CP.(*classloader.CPool)
+	// now create a skeletal, two-entry CP
+	var ints = make([]int32, 1)
+	CP.IntConsts = ints
+	CP.IntConsts[0] = 25
+
+	CP.CpIndex = []classloader.CpEntry{}
+	dummyEntry := classloader.CpEntry{}
+	doubleEntry := classloader.CpEntry{
+		Type: classloader.IntConst, Slot: 0,
+	}
+	CP.CpIndex = append(CP.CpIndex, dummyEntry)
+	CP.CpIndex = append(CP.CpIndex, doubleEntry)
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-
-	value := pop(&f).(int64) // longs require two slots, so popped twice
-	pop(&f)
-
-	if value != 25 { // 200 >> 3 = 25
-		t.Errorf("LSHR: expected a result of 25, but got: %d", value)
+	if f.TOS != 0 {
+		t.Errorf("Top of stack, expected 0, got: %d", f.TOS)
 	}
-	if f.TOS != -1 {
-		t.Errorf("LSHR: Expected an empty stack, but got a tos of: %d", f.TOS)
+	value := pop(&f).(int64)
+	if value != 25 {
+		t.Errorf("LDC_W: Expected popped value to be 25, got: %d", value)
 	}
 }
 
-// LSTORE: Store long from stack into local specified by following byte, and the local var after it.
-func TestLstore(t *testing.T) {
-	f := newFrame(opcodes.LSTORE)
-	f.Meth = append(f.Meth, 0x02) // use local var #2
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero)
-	push(&f, int64(0x22223))
-	push(&f, int64(0x22223)) // push twice due to longs using two slots
-
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-
-	if f.Locals[2] != int64(0x22223) {
-		t.Errorf("LSTORE: Expecting 0x22223 in locals[2], got: 0x%x", f.Locals[2])
-	}
+// LDC_W: get float64 CP entry indexed by two bytes
+func TestLdcwFloat(t *testing.T) {
+	f := newFrame(opcodes.LDC_W)
+	f.Meth = append(f.Meth, 0x00)
+	f.Meth = append(f.Meth, 0x01)
 
-	if f.Locals[3] != int64(0x22223) {
-		t.Errorf("LSTORE: Expecting 0x22223 in locals[3], got: 0x%x", f.Locals[3])
-	}
+	cp := classloader.CPool{}
+	f.CP = &cp
+	CP := f.CP.(*classloader.CPool)
+	// now create a skeletal, two-entry CP
+	var floats = make([]float32, 1)
+	CP.Floats = floats
+	CP.Floats[0] = 25.0
 
-	if f.TOS != -1 {
-		t.Errorf("LSTORE: Expecting an empty stack, but tos points to item: %d", f.TOS)
+	CP.CpIndex = []classloader.CpEntry{}
+	dummyEntry := classloader.CpEntry{}
+	floatEntry := classloader.CpEntry{
+		Type: classloader.FloatConst, Slot: 0,
 	}
-}
-
-// LSTORE_0: Store long from stack in localVar[0] and again in localVar[1]
-func TestLstore0(t *testing.T) {
-	f := newFrame(opcodes.LSTORE_0)
-	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero) // LSTORE instructions fill two local variables (with the same value)
-	push(&f, int64(0x12345678))
-	push(&f, int64(0x12345678))
+	CP.CpIndex = append(CP.CpIndex, dummyEntry)
+	CP.CpIndex = append(CP.CpIndex, floatEntry)
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-
-	if f.Locals[0] != int64(0x12345678) {
-		t.Errorf("LSTORE_0: expected locals[0] to be 0x12345678, got: %d", f.Locals[0])
+	if f.TOS != 0 {
+		t.Errorf("Top of stack, expected 0, got: %d", f.TOS)
 	}
-
-	if f.Locals[1] != int64(0x12345678) {
-		t.Errorf("LSTORE_0: expected locals[1] to be 0x12345678, got: %d", f.Locals[1])
+	value := pop(&f).(float64)
+	if value != 25.0 {
+		t.Errorf("LDC_W: Expected popped value to be 25.0, got: %f", value)
 	}
+}
 
-	if f.TOS != -1 {
-		t.Errorf("LSTORE_0: Expected op stack to be empty, got tos: %d", f.TOS)
+// LDC2_W: get CP entry for long or double indexed by following 2 bytes
+func TestLdc2w(t *testing.T) {
+	f := newFrame(opcodes.LDC2_W)
+	f.Meth = append(f.Meth, 0x00)
+	f.Meth = append(f.Meth, 0x01)
+
+	cp := classloader.CPool{}
+	f.CP = &cp
+	CP := f.CP.(*classloader.CPool)
+	// now create a skeletal, two-entry CP
+	var doubles = make([]float64, 1)
+	CP.Doubles = doubles
+	CP.Doubles[0] = 25.0
+
+	CP.CpIndex = []classloader.CpEntry{}
+	dummyEntry := classloader.CpEntry{}
+	doubleEntry := classloader.CpEntry{
+		Type: classloader.DoubleConst, Slot: 0,
+	}
+	CP.CpIndex = append(CP.CpIndex, dummyEntry)
+	CP.CpIndex = append(CP.CpIndex, doubleEntry)
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+	if f.TOS != 1 {
+		t.Errorf("Top of stack, expected 1, got: %d", f.TOS)
+	}
+	value := pop(&f).(float64)
+	if value != 25.0 {
+		t.Errorf("LDC2_W: Expected popped value to be 25.0, got: %f", value)
 	}
 }
 
-// LSTORE_1: Store long from stack in localVar[1] and again in localVar[2]
-func TestLstore1(t *testing.T) {
-	f := newFrame(opcodes.LSTORE_1)
+// LDIV: (pop 2 longs, divide second term by top of stack, push result)
+func TestLdiv(t *testing.T) {
+	f := newFrame(opcodes.LDIV)
+	push(&f, int64(70))
+	push(&f, int64(70))
+
+	push(&f, int64(10))
+	push(&f, int64(10))
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+
+	if f.TOS != 1 { // product is pushed twice b/c it's a long, which occupies 2 slots
+		t.Errorf("LDIV, Top of stack, expected 1, got: %d", f.TOS)
+	}
+
+	value := pop(&f).(int64)
+	pop(&f)
+	if value != 7 {
+		t.Errorf("LDIV: Expected popped value to be 70, got: %d", value)
+	}
+}
+
+// LDIV: with divide by zero error
+func TestLdivDivideByZero(t *testing.T) {
+	f := newFrame(opcodes.LDIV)
+	push(&f, int64(10))
+	push(&f, int64(10))
+
+	push(&f, int64(0))
+	push(&f, int64(0))
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	res := runFrame(fs)
+
+	if !strings.Contains(res.Error(), "divide by zero") {
+		t.Errorf("LDIV: Expected err msg re divide by zero, got: %s", res.Error())
+	}
+}
+
+// LLOAD: test load of long in locals[index] on to stack
+func TestLload(t *testing.T) {
+	f := newFrame(opcodes.LLOAD)
+	f.Meth = append(f.Meth, 0x04) // use local var #4
 	f.Locals = append(f.Locals, zero)
 	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero) // LSTORE instructions fill two local variables (with the same value)
-	push(&f, int64(0x12345678))
-	push(&f, int64(0x12345678))
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, int64(0x1234562)) // put value in locals[4]
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
+	x := pop(&f).(int64)
+	pop(&f) // pop twice due to two entries on op stack due to 64-bit width of data type
+	if x != 0x1234562 {
+		t.Errorf("LLOAD: Expecting 0x1234562 on stack, got: 0x%x", x)
+	}
+	if f.TOS != -1 {
+		t.Errorf("LLOAD: Expecting an empty stack, but tos points to item: %d", f.TOS)
+	}
+	if f.PC != 2 {
+		t.Errorf("LLOAD: Expected pc to be pointing at byte 2, got: %d", f.PC)
+	}
+}
+
+// LLOAD_0: Load long from locals[0]
+func TestLload0(t *testing.T) {
+	f := newFrame(opcodes.LLOAD_0)
+
+	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[0]
+	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[1] // lload uses two local consecutive
 
-	if f.Locals[1] != int64(0x12345678) {
-		t.Errorf("LSTORE_1: expected locals[1] to be 0x12345678, got: %d", f.Locals[1])
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+	x := pop(&f).(int64)
+	pop(&f) // due to longs taking 2 slots
+	if x != 0x12345678 {
+		t.Errorf("LLOAD_0: Expecting 0x12345678 on stack, got: 0x%x", x)
 	}
 
-	if f.Locals[2] != int64(0x12345678) {
-		t.Errorf("LSTORE_1: expected locals[2] to be 0x12345678, got: %d", f.Locals[2])
+	if getLocal(&f, 1) != x {
+		t.Errorf("LLOAD_0: Local variable[1] holds invalid value: 0x%x", getLocal(&f, 2))
 	}
 
 	if f.TOS != -1 {
-		t.Errorf("LSTORE_1: Expected op stack to be empty, got tos: %d", f.TOS)
+		t.Errorf("LLOAD_0: Expecting an empty stack, but tos points to item: %d", f.TOS)
 	}
 }
 
-// LSTORE_2: Store long from stack in localVar[2] and again in localVar[3]
-func TestLstore2(t *testing.T) {
-	f := newFrame(opcodes.LSTORE_2)
+// LLOAD_1: Load long from locals[1]
+func TestLload1(t *testing.T) {
+	f := newFrame(opcodes.LLOAD_1)
 	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[1]
+	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[2] // lload uses two local consecutive
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+	x := pop(&f).(int64)
+	pop(&f) // due to longs taking two slots
+	if x != 0x12345678 {
+		t.Errorf("LLOAD_1: Expecting 0x12345678 on stack, got: 0x%x", x)
+	}
+
+	if getLocal(&f, 2) != x {
+		t.Errorf("LLOAD_1: Local variable[2] holds invalid value: 0x%x", getLocal(&f, 2))
+	}
+
+	if f.TOS != -1 {
+		t.Errorf("LLOAD_1: Expecting an empty stack, but tos points to item: %d", f.TOS)
+	}
+}
+
+// LLOAD_2: Load long from locals[2]
+func TestLload2(t *testing.T) {
+	f := newFrame(opcodes.LLOAD_2)
 	f.Locals = append(f.Locals, zero)
 	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero) // LSTORE instructions fill two local variables (with the same value)
-	push(&f, int64(0x12345678))
-	push(&f, int64(0x12345678))
+	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[2]
+	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[3] // lload uses two local consecutive
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-
-	if f.Locals[2] != int64(0x12345678) {
-		t.Errorf("LSTORE_2: expected locals[2] to be 0x12345678, got: %d", f.Locals[2])
+	x := pop(&f).(int64)
+	pop(&f) // due to longs taking two slots
+	if x != 0x12345678 {
+		t.Errorf("LLOAD_12: Expecting 0x12345678 on stack, got: 0x%x", x)
 	}
 
-	if f.Locals[3] != int64(0x12345678) {
-		t.Errorf("LSTORE_2: expected locals[3] to be 0x12345678, got: %d", f.Locals[3])
+	if getLocal(&f, 3) != x {
+		t.Errorf("LLOAD_2: Local variable[3] holds invalid value: 0x%x", getLocal(&f, 3))
 	}
 
 	if f.TOS != -1 {
-		t.Errorf("LSTORE_2: Expected op stack to be empty, got tos: %d", f.TOS)
+		t.Errorf("LLOAD_1: Expecting an empty stack, but tos points to item: %d", f.TOS)
 	}
 }
 
-// LSTORE_3: Store long from stack in localVar[3] and again in localVar[]
-func TestLstore3(t *testing.T) {
-	f := newFrame(opcodes.LSTORE_3)
-	f.Locals = append(f.Locals, zero)
+// LLOAD_3: Load long from locals[3]
+func TestLload3(t *testing.T) {
+	f := newFrame(opcodes.LLOAD_3)
 	f.Locals = append(f.Locals, zero)
 	f.Locals = append(f.Locals, zero)
 	f.Locals = append(f.Locals, zero)
-	f.Locals = append(f.Locals, zero) // LSTORE instructions fill two local variables (with the same value)
-	push(&f, int64(0x12345678))
-	push(&f, int64(0x12345678))
+	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[3]
+	f.Locals = append(f.Locals, int64(0x12345678)) // put value in locals[4] // lload uses two local consecutive
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-
-	if f.Locals[3] != int64(0x12345678) {
-		t.Errorf("LSTORE_3: expected locals[3] to be 0x12345678, got: %d", f.Locals[3])
+	x := pop(&f).(int64)
+	pop(&f) // due to longs taking two slots
+	if x != 0x12345678 {
+		t.Errorf("LLOAD_3: Expecting 0x12345678 on stack, got: 0x%x", x)
 	}
 
-	if f.Locals[4] != int64(0x12345678) {
-		t.Errorf("LSTORE_3: expected locals[4] to be 0x12345678, got: %d", f.Locals[4])
+	if getLocal(&f, 4) != x {
+		t.Errorf("LLOAD_3: Local variable[4] holds invalid value: 0x%x", getLocal(&f, 4))
 	}
 
 	if f.TOS != -1 {
-		t.Errorf("LSTORE_3: Expected op stack to be empty, got tos: %d", f.TOS)
+		t.Errorf("LLOAD_3: Expecting an empty stack, but tos points to item: %d", f.TOS)
 	}
 }
 
-// LSUB: Subtract two longs
-func TestLsub(t *testing.T) {
-	f := newFrame(opcodes.LSUB)
-	push(&f, int64(10)) // longs occupy two slots, hence the double pops and pushes
+// LMUL: pop 2 longs, multiply them, push result
+func TestLmul(t *testing.T) {
+	f := newFrame(opcodes.LMUL)
+	push(&f, int64(10))
 	push(&f, int64(10))
 
 	push(&f, int64(7))
@@ -1543,44 +2024,138 @@ func TestLsub(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
+	if f.TOS != 1 { // product is pushed twice b/c it's a long, which occupies 2 slots
+		t.Errorf("LMUL, Top of stack, expected 1, got: %d", f.TOS)
+	}
+
 	value := pop(&f).(int64)
 	pop(&f)
+	if value != 70 {
+		t.Errorf("LMUL: Expected popped value to be 70, got: %d", value)
+	}
+}
 
-	if f.TOS != -1 {
-		t.Errorf("LSUB, Top of stack, expected -1, got: %d", f.TOS)
+// LNEG: negate a long
+func TestLneg(t *testing.T) {
+	f := newFrame(opcodes.LNEG)
+	push(&f, int64(10))
+	push(&f, int64(10))
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+
+	if f.TOS != 1 { // product is pushed twice b/c it's a long, which occupies 2 slots
+		t.Errorf("LNEG, Top of stack, expected 1, got: %d", f.TOS)
 	}
 
-	if value != 3 {
-		t.Errorf("LSUB: Expected popped value to be 3, got: %d", value)
+	value := pop(&f).(int64)
+	pop(&f)
+	if value != -10 {
+		t.Errorf("LNEG: Expected popped value to be -10, got: %d", value)
 	}
 }
 
-// LUSHR: Right unsigned shift of long
-func TestLushr(t *testing.T) {
-	f := newFrame(opcodes.LUSHR)
-	push(&f, int64(200)) // longs require two slots, so pushed twice
-	push(&f, int64(200))
+// Both TABLESWITCH and LOOKUPSWITCH are tested using methods assembled by this function.
+// The method consists of nops (so that the switch starts at different alignments), the
+// switch instruction, and then a series of target blocks. Target block i pushes
+// (i+1)*10 and then jumps to the end of the method. The operands are passed in as 4-byte
+// values, except that jump offsets are specified as the number of the target block and
+// flagged by their position in isTarget.
+func assembleSwitch(nops int, opcode byte, operands []int32, isTarget []bool, blockCount int) []byte {
+	var code []byte
+	for i := 0; i < nops; i++ {
+		code = append(code, opcodes.NOP)
+	}
+
+	switchPC := len(code)
+	code = append(code, opcode)
+	for len(code)%4 != 0 {
+		code = append(code, 0) // padding
+	}
+
+	firstBlockPC := len(code) + len(operands)*4
+	endPC := firstBlockPC + blockCount*5
+	for i, operand := range operands {
+		value := operand
+		if isTarget[i] {
+			value = int32(firstBlockPC + int(operand)*5 - switchPC)
+		}
+		code = append(code, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+	}
 
-	push(&f, int64(3)) // shift left 3 bits
+	for i := 0; i < blockCount; i++ {
+		blockPC := len(code)
+		code = append(code, opcodes.BIPUSH, byte((i+1)*10))
+		jumpTo := int16(endPC - (blockPC + 2))
+		code = append(code, opcodes.GOTO, byte(jumpTo>>8), byte(jumpTo))
+	}
+	return code
+}
+
+// run an assembled switch method with the given key on the stack and return the value
+// pushed by the target block that was executed.
+func runSwitch(t *testing.T, code []byte, key int64) int64 {
+	f := newFrame(0)
+	f.Meth = code
+	push(&f, key)
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
+	err := runFrame(fs)
+	if err != nil {
+		t.Errorf("Unexpected error running switch: %s", err.Error())
+		return 0
+	}
 
-	value := pop(&f).(int64) // longs require two slots, so popped twice
-	pop(&f)
+	if f.TOS != 0 {
+		t.Errorf("Expected TOS to be 0 after switch, got: %d", f.TOS)
+		return 0
+	}
+	return pop(&f).(int64)
+}
 
-	if value != 25 { // 200 >> 3 = 25
-		t.Errorf("LUSHR: expected a result of 25, but got: %d", value)
+// LOOKUPSWITCH: jump to the target of the matching key, or to the default target.
+// Tested at all four alignments of the instruction.
+func TestLookupswitch(t *testing.T) {
+	// default -> block 0; keys -5, 2, 1000 -> blocks 1, 2, 3
+	operands := []int32{0, 3, -5, 1, 2, 2, 1000, 3}
+	isTarget := []bool{true, false, false, true, false, true, false, true}
+
+	tests := []struct {
+		key      int64
+		expected int64
+	}{
+		{-5, 20}, {2, 30}, {1000, 40}, {0, 10}, {-6, 10}, {3, 10}, {2000, 10},
+	}
+
+	for nops := 0; nops < 4; nops++ {
+		code := assembleSwitch(nops, opcodes.LOOKUPSWITCH, operands, isTarget, 4)
+		for _, test := range tests {
+			value := runSwitch(t, code, test.key)
+			if value != test.expected {
+				t.Errorf("LOOKUPSWITCH: at PC %d with key %d, expected %d, got: %d",
+					nops, test.key, test.expected, value)
+			}
+		}
 	}
-	if f.TOS != -1 {
-		t.Errorf("LUSHR: Expected an empty stack, but got a tos of: %d", f.TOS)
+}
+
+// LOOKUPSWITCH: with no key/offset pairs, every key goes to the default target
+func TestLookupswitchNoPairs(t *testing.T) {
+	operands := []int32{1, 0}
+	isTarget := []bool{true, false}
+	code := assembleSwitch(1, opcodes.LOOKUPSWITCH, operands, isTarget, 2)
+
+	value := runSwitch(t, code, 0)
+	if value != 20 {
+		t.Errorf("LOOKUPSWITCH: expected the default target to push 20, got: %d", value)
 	}
 }
 
-// LXOR: Logical XOR of two longs
-func TestLxor(t *testing.T) {
-	f := newFrame(opcodes.LXOR)
+// LOR: Logical OR of two longs
+func TestLor(t *testing.T) {
+	f := newFrame(opcodes.LOR)
 	push(&f, int64(21)) // longs require two slots, so pushed twice
 	push(&f, int64(21))
 
@@ -1594,262 +2169,435 @@ func TestLxor(t *testing.T) {
 	value := pop(&f).(int64) // longs require two slots, so popped twice
 	pop(&f)
 
-	if value != 3 { // 21 ^ 22 = 3
-		t.Errorf("LXOR: expected a result of 3, but got: %d", value)
+	if value != 23 { // 21 | 22 = 23
+		t.Errorf("LOR: expected a result of 23, but got: %d", value)
 	}
 	if f.TOS != -1 {
-		t.Errorf("LXOR: Expected an empty stack, but got a tos of: %d", f.TOS)
+		t.Errorf("LOR: Expected an empty stack, but got a tos of: %d", f.TOS)
 	}
 }
 
-// MONITORENTER: The JDK JVM does not implement this, nor do we. So just pop the ref off stack
-func TestMonitorEnter(t *testing.T) {
-	f := newFrame(opcodes.MONITORENTER)
-	push(&f, &f) // push any value and make sure it gets popped off
+// LREM: remainder of long division (the % operator)
+func TestLrem(t *testing.T) {
+	f := newFrame(opcodes.LREM)
+	push(&f, int64(74))
+	push(&f, int64(74))
+
+	push(&f, int64(6))
+	push(&f, int64(6))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.TOS != -1 {
-		t.Errorf("MONITORENTER: Expected an empty stack, but got a tos of: %d", f.TOS)
+	if f.TOS != 1 { // product is pushed twice b/c it's a long, which occupies 2 slots
+		t.Errorf("LREM, Top of stack, expected 1, got: %d", f.TOS)
+	}
+
+	value := pop(&f).(int64)
+	pop(&f)
+	if value != 2 {
+		t.Errorf("LREM: Expected popped value to be 2, got: %d", value)
 	}
 }
 
-// MONITOREXIT: The JDK JVM does not implement this, nor do we. So just pop the ref off stack
-func TestMonitorExit(t *testing.T) {
-	f := newFrame(opcodes.MONITOREXIT)
-	push(&f, &f) // push any value and make sure it gets popped off
+// LREM: long modulo -- divide by zero
+func TestLremDivideByZero(t *testing.T) {
+	f := newFrame(opcodes.LREM)
+	push(&f, int64(6))
+	push(&f, int64(6))
+	push(&f, int64(0))
+	push(&f, int64(0))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+	errMsg := err.Error()
+	if !strings.Contains(errMsg, "divide by zero") {
+		t.Errorf("LREM: Expected divide by zero error msg, got: %s", errMsg)
+	}
+}
+
+// LRETURN: Return a long from a function
+func TestLreturn(t *testing.T) {
+	f0 := newFrame(0)
+	push(&f0, int64(20))
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f0)
+	f1 := newFrame(opcodes.LRETURN)
+	push(&f1, int64(21))
+	push(&f1, int64(21))
+	fs.PushFront(&f1)
 	_ = runFrame(fs)
+	_ = frames.PopFrame(fs)
+	f3 := fs.Front().Value.(*frames.Frame)
+	newVal := pop(f3).(int64)
+	if newVal != 21 {
+		t.Errorf("After LRETURN, expected a value of 21 in previous frame, got: %d", newVal)
+	}
+	pop(f3) // popped a second time due to longs taking two slots
 
-	if f.TOS != -1 {
-		t.Errorf("MONITOREXIT: Expected an empty stack, but got a tos of: %d", f.TOS)
+	prevVal := pop(f3).(int64)
+	if prevVal != 20 {
+		t.Errorf("After LRETURN, expected a value of 20 in 2nd place of previous frame, got: %d", prevVal)
 	}
 }
 
-// NEW: Instantiate object -- here with an error
-func TestNewWithError(t *testing.T) {
-	f := newFrame(opcodes.NEW)
-	f.Meth = append(f.Meth, 0x00)
-	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
+// LSHL: Left shift of long
+func TestLshl(t *testing.T) {
+	f := newFrame(opcodes.LSHL)
+	push(&f, int64(22)) // longs require two slots, so pushed twice
+	push(&f, int64(22))
 
-	CP := classloader.CPool{}
-	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
-	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
-	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.FieldRef, Slot: 0} // should be class or interface
-	// now create the pointed-to FieldRef
-	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
-	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
-	f.CP = &CP
+	push(&f, int64(3)) // shift left 3 bits
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
-	err := runFrame(fs)
+	_ = runFrame(fs)
 
-	if err == nil {
-		t.Errorf("NEW: Expected error message, but got none")
-	}
+	value := pop(&f).(int64) // longs require two slots, so popped twice
+	pop(&f)
 
-	errMsg := err.Error()
-	if !strings.Contains(errMsg, "Invalid type for new object") {
-		t.Errorf("NEW: got unexpected error message: %s", errMsg)
+	if value != 176 { // 22 << 3 = 176
+		t.Errorf("LSHL: expected a result of 176, but got: %d", value)
+	}
+	if f.TOS != -1 {
+		t.Errorf("LSHL: Expected an empty stack, but got a tos of: %d", f.TOS)
 	}
 }
 
-// POP: pop item off stack and discard it
-func TestPop(t *testing.T) {
-	f := newFrame(opcodes.POP)
-	push(&f, int64(34)) // push three different values
-	push(&f, int64(21))
-	push(&f, int64(0))
+// LSHR: Right shift of long
+func TestLshr(t *testing.T) {
+	f := newFrame(opcodes.LSHR)
+	push(&f, int64(200)) // longs require two slots, so pushed twice
+	push(&f, int64(200))
+
+	push(&f, int64(3)) // shift left 3 bits
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.TOS != 1 {
-		t.Errorf("POP: Expected stack with 2 items, but got a tos of: %d", f.TOS)
-	}
-
-	top := pop(&f).(int64)
+	value := pop(&f).(int64) // longs require two slots, so popped twice
+	pop(&f)
 
-	if top != 21 {
-		t.Errorf("POP: expected top's value to be 21, but got: %d", top)
+	if value != 25 { // 200 >> 3 = 25
+		t.Errorf("LSHR: expected a result of 25, but got: %d", value)
+	}
+	if f.TOS != -1 {
+		t.Errorf("LSHR: Expected an empty stack, but got a tos of: %d", f.TOS)
 	}
 }
 
-// POP with tracing enabled
-func TestPopWithTracing(t *testing.T) {
-	f := newFrame(opcodes.POP)
-	push(&f, int64(34)) // push three different values
-	push(&f, int64(21))
-	push(&f, int64(0))
+// LSTORE: Store long from stack into local specified by following byte, and the local var after it.
+func TestLstore(t *testing.T) {
+	f := newFrame(opcodes.LSTORE)
+	f.Meth = append(f.Meth, 0x02) // use local var #2
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	push(&f, int64(0x22223))
+	push(&f, int64(0x22223)) // push twice due to longs using two slots
 
-	MainThread = thread.CreateThread()
-	MainThread.Stack = frames.CreateFrameStack()
-	// fs := frames.CreateFrameStack()
-	MainThread.Stack.PushFront(&f) // push the new frame
-	MainThread.Trace = true        // turn on tracing
-	_ = runFrame(MainThread.Stack)
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
 
-	if f.TOS != 1 {
-		t.Errorf("POP: Expected stack with 2 items, but got a tos of: %d", f.TOS)
+	if getLocal(&f, 2) != int64(0x22223) {
+		t.Errorf("LSTORE: Expecting 0x22223 in locals[2], got: 0x%x", getLocal(&f, 2))
 	}
 
-	top := pop(&f).(int64)
-
-	if top != 21 {
-		t.Errorf("POP: expected top's value to be 21, but got: %d", top)
+	if getLocal(&f, 3) != int64(0x22223) {
+		t.Errorf("LSTORE: Expecting 0x22223 in locals[3], got: 0x%x", getLocal(&f, 3))
 	}
 
-	if MainThread.Trace != true {
-		t.Errorf("POP: MainThread.Trace was not re-enabled after the POP execution")
+	if f.TOS != -1 {
+		t.Errorf("LSTORE: Expecting an empty stack, but tos points to item: %d", f.TOS)
 	}
 }
 
-// POP2: pop two items
-func TestPop2(t *testing.T) {
-	_ = log.SetLogLevel(log.WARNING)
-
-	f := newFrame(opcodes.POP2)
-	push(&f, int64(34)) // push three different values; 34 at bottom
-	push(&f, int64(21))
-	push(&f, int64(10))
+// LSTORE_0: Store long from stack in localVar[0] and again in localVar[1]
+func TestLstore0(t *testing.T) {
+	f := newFrame(opcodes.LSTORE_0)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero) // LSTORE instructions fill two local variables (with the same value)
+	push(&f, int64(0x12345678))
+	push(&f, int64(0x12345678))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.TOS != 0 {
-		t.Errorf("POP2: Expected stack with 1 item, but got a tos of: %d", f.TOS)
+	if getLocal(&f, 0) != int64(0x12345678) {
+		t.Errorf("LSTORE_0: expected locals[0] to be 0x12345678, got: %d", getLocal(&f, 0))
 	}
 
-	top := pop(&f).(int64)
+	if getLocal(&f, 1) != int64(0x12345678) {
+		t.Errorf("LSTORE_0: expected locals[1] to be 0x12345678, got: %d", getLocal(&f, 1))
+	}
 
-	if top != 34 {
-		t.Errorf("POP2: expected top's value to be 34, but got: %d", top)
+	if f.TOS != -1 {
+		t.Errorf("LSTORE_0: Expected op stack to be empty, got tos: %d", f.TOS)
 	}
 }
 
-// POP2: pop two items off stack -- make sure tracing doesn't affect the output
-func TestPop2WithTrace(t *testing.T) {
-	_ = log.SetLogLevel(log.WARNING)
-	f := newFrame(opcodes.POP2)
-	push(&f, int64(34)) // push three different values; 34 at bottom
-	push(&f, int64(21))
-	push(&f, int64(10))
+// LSTORE_1: Store long from stack in localVar[1] and again in localVar[2]
+func TestLstore1(t *testing.T) {
+	f := newFrame(opcodes.LSTORE_1)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero) // LSTORE instructions fill two local variables (with the same value)
+	push(&f, int64(0x12345678))
+	push(&f, int64(0x12345678))
 
-	MainThread = thread.CreateThread()
-	MainThread.Stack = frames.CreateFrameStack()
-	MainThread.Stack.PushFront(&f) // push the new frame
-	MainThread.Trace = true        // turn on tracing
-	_ = runFrame(MainThread.Stack)
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
 
-	if f.TOS != 0 {
-		t.Errorf("POP2: Expected stack with 1 item, but got a tos of: %d", f.TOS)
+	if getLocal(&f, 1) != int64(0x12345678) {
+		t.Errorf("LSTORE_1: expected locals[1] to be 0x12345678, got: %d", getLocal(&f, 1))
 	}
 
-	top := pop(&f).(int64)
-
-	if top != 34 {
-		t.Errorf("POP2: expected top's value to be 34, but got: %d", top)
+	if getLocal(&f, 2) != int64(0x12345678) {
+		t.Errorf("LSTORE_1: expected locals[2] to be 0x12345678, got: %d", getLocal(&f, 2))
 	}
 
-	if MainThread.Trace != true {
-		t.Errorf("POP2: MainThread.Trace was not re-enabled after the POP2 execution")
+	if f.TOS != -1 {
+		t.Errorf("LSTORE_1: Expected op stack to be empty, got tos: %d", f.TOS)
 	}
 }
 
-// PUTFIELD: Update a non-static field
-func TestPutFieldSimpleInt(t *testing.T) {
-	f := newFrame(opcodes.PUTFIELD)
-	f.Meth = append(f.Meth, 0x00)
-	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
-
-	CP := classloader.CPool{}
-	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
-	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
-	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.FieldRef, Slot: 0}
-	// now create the pointed-to FieldRef
-	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
-	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
-	f.CP = &CP
-
-	// now create the object we're updating, with one int field
-	obj := object.MakeEmptyObject()
-	obj.Fields = make([]object.Field, 1, 1)
-	obj.Fields[0].Fvalue = int64(42) // set the field = 42
-	obj.Fields[0].Ftype = types.Int
-	push(&f, obj)
-
-	push(&f, int64(26)) // update the field to 26
+// LSTORE_2: Store long from stack in localVar[2] and again in localVar[3]
+func TestLstore2(t *testing.T) {
+	f := newFrame(opcodes.LSTORE_2)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero) // LSTORE instructions fill two local variables (with the same value)
+	push(&f, int64(0x12345678))
+	push(&f, int64(0x12345678))
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
-	err := runFrame(fs)
+	_ = runFrame(fs)
 
-	if err != nil {
-		t.Errorf("PUTFIELD: Got unexpected error msg: %s", err.Error())
+	if getLocal(&f, 2) != int64(0x12345678) {
+		t.Errorf("LSTORE_2: expected locals[2] to be 0x12345678, got: %d", getLocal(&f, 2))
 	}
 
-	res := obj.Fields[0].Fvalue.(int64)
-	if res != 26 {
-		t.Errorf("PUTFIELD: Expected a new value of 26, got: %d", res)
+	if getLocal(&f, 3) != int64(0x12345678) {
+		t.Errorf("LSTORE_2: expected locals[3] to be 0x12345678, got: %d", getLocal(&f, 3))
 	}
-}
 
-// PUTFIELD
-func TestPutFieldDouble(t *testing.T) {
-	f := newFrame(opcodes.PUTFIELD)
-	f.Meth = append(f.Meth, 0x00)
-	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
+	if f.TOS != -1 {
+		t.Errorf("LSTORE_2: Expected op stack to be empty, got tos: %d", f.TOS)
+	}
+}
 
-	CP := classloader.CPool{}
-	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
-	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
-	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.FieldRef, Slot: 0}
-	// now create the pointed-to FieldRef
-	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
-	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
-	f.CP = &CP
+// LSTORE_3: Store long from stack in localVar[3] and again in localVar[]
+func TestLstore3(t *testing.T) {
+	f := newFrame(opcodes.LSTORE_3)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero)
+	f.Locals = append(f.Locals, zero) // LSTORE instructions fill two local variables (with the same value)
+	push(&f, int64(0x12345678))
+	push(&f, int64(0x12345678))
 
-	// now create the object we're updating, with one int field
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+
+	if getLocal(&f, 3) != int64(0x12345678) {
+		t.Errorf("LSTORE_3: expected locals[3] to be 0x12345678, got: %d", getLocal(&f, 3))
+	}
+
+	if getLocal(&f, 4) != int64(0x12345678) {
+		t.Errorf("LSTORE_3: expected locals[4] to be 0x12345678, got: %d", getLocal(&f, 4))
+	}
+
+	if f.TOS != -1 {
+		t.Errorf("LSTORE_3: Expected op stack to be empty, got tos: %d", f.TOS)
+	}
+}
+
+// LSUB: Subtract two longs
+func TestLsub(t *testing.T) {
+	f := newFrame(opcodes.LSUB)
+	push(&f, int64(10)) // longs occupy two slots, hence the double pops and pushes
+	push(&f, int64(10))
+
+	push(&f, int64(7))
+	push(&f, int64(7))
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+
+	value := pop(&f).(int64)
+	pop(&f)
+
+	if f.TOS != -1 {
+		t.Errorf("LSUB, Top of stack, expected -1, got: %d", f.TOS)
+	}
+
+	if value != 3 {
+		t.Errorf("LSUB: Expected popped value to be 3, got: %d", value)
+	}
+}
+
+// LUSHR: Right unsigned shift of long
+func TestLushr(t *testing.T) {
+	f := newFrame(opcodes.LUSHR)
+	push(&f, int64(200)) // longs require two slots, so pushed twice
+	push(&f, int64(200))
+
+	push(&f, int64(3)) // shift left 3 bits
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+
+	value := pop(&f).(int64) // longs require two slots, so popped twice
+	pop(&f)
+
+	if value != 25 { // 200 >> 3 = 25
+		t.Errorf("LUSHR: expected a result of 25, but got: %d", value)
+	}
+	if f.TOS != -1 {
+		t.Errorf("LUSHR: Expected an empty stack, but got a tos of: %d", f.TOS)
+	}
+}
+
+// LXOR: Logical XOR of two longs
+func TestLxor(t *testing.T) {
+	f := newFrame(opcodes.LXOR)
+	push(&f, int64(21)) // longs require two slots, so pushed twice
+	push(&f, int64(21))
+
+	push(&f, int64(22))
+	push(&f, int64(22))
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+
+	value := pop(&f).(int64) // longs require two slots, so popped twice
+	pop(&f)
+
+	if value != 3 { // 21 ^ 22 = 3
+		t.Errorf("LXOR: expected a result of 3, but got: %d", value)
+	}
+	if f.TOS != -1 {
+		t.Errorf("LXOR: Expected an empty stack, but got a tos of: %d", f.TOS)
+	}
+}
+
+// MONITORENTER: enter the monitor of an object, which can be entered again by the same thread
+func TestMonitorEnter(t *testing.T) {
 	obj := object.MakeEmptyObject()
-	obj.Fields = make([]object.Field, 1, 1)
-	obj.Fields[0].Fvalue = float64(42.0) // set the field = 42
-	obj.Fields[0].Ftype = types.Double
+	f := newFrame(opcodes.MONITORENTER)
+	f.Meth = append(f.Meth, opcodes.ALOAD_0, opcodes.MONITORENTER)
+	f.Locals = append(f.Locals, obj)
 	push(&f, obj)
 
-	push(&f, float64(26.8)) // update the field to 26.8
-	push(&f, float64(26.8)) // push a second time b/c it's a double
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+
+	if f.TOS != -1 {
+		t.Errorf("MONITORENTER: Expected an empty stack, but got a tos of: %d", f.TOS)
+	}
+	if !object.HoldsMonitor(obj, f.Thread) {
+		t.Errorf("MONITORENTER: Expected the thread to hold the object's monitor")
+	}
+	object.MonitorExit(obj, f.Thread)
+	if !object.HoldsMonitor(obj, f.Thread) {
+		t.Errorf("MONITORENTER: Expected the monitor to be held until it's exited twice")
+	}
+	object.MonitorExit(obj, f.Thread)
+	if object.HoldsMonitor(obj, f.Thread) {
+		t.Errorf("MONITORENTER: Expected the monitor to be released")
+	}
+}
+
+// MONITOREXIT: exit the monitor of an object, which is released when it's been
+// exited as many times as it was entered
+func TestMonitorExit(t *testing.T) {
+	obj := object.MakeEmptyObject()
+	object.MonitorEnter(obj, 0)
+	object.MonitorEnter(obj, 0)
+	f := newFrame(opcodes.MONITOREXIT)
+	push(&f, obj)
 
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
-	err := runFrame(fs)
+	if err := runFrame(fs); err != nil {
+		t.Fatalf("MONITOREXIT: Unexpected error: %s", err.Error())
+	}
+	if f.TOS != -1 {
+		t.Errorf("MONITOREXIT: Expected an empty stack, but got a tos of: %d", f.TOS)
+	}
+	if !object.HoldsMonitor(obj, 0) {
+		t.Errorf("MONITOREXIT: Expected the monitor to be held until it's exited twice")
+	}
 
-	if err != nil {
-		t.Errorf("PUTFIELD: Got unexpected error msg: %s", err.Error())
+	f = newFrame(opcodes.MONITOREXIT)
+	push(&f, obj)
+	fs = frames.CreateFrameStack()
+	fs.PushFront(&f)
+	_ = runFrame(fs)
+	if object.HoldsMonitor(obj, 0) {
+		t.Errorf("MONITOREXIT: Expected the monitor to be released")
 	}
+}
 
-	res := obj.Fields[0].Fvalue.(float64)
-	if res != 26.8 {
-		t.Errorf("PUTFIELD: Expected a new value of 26.8, got: %f", res)
+// MONITOREXIT: exiting a monitor the thread doesn't hold throws an IllegalMonitorStateException
+func TestMonitorExitNotOwner(t *testing.T) {
+	monitorSetup()
+	obj := object.MakeEmptyObject()
+	object.MonitorEnter(obj, 2) // held by another thread
+	defer object.MonitorExit(obj, 2)
+
+	f := newFrame(opcodes.MONITOREXIT)
+	push(&f, obj)
+
+	normalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	_ = w.Close()
+	os.Stderr = normalStderr
+	msg, _ := io.ReadAll(r)
+
+	if err == nil || !strings.Contains(err.Error(), "java/lang/IllegalMonitorStateException") {
+		t.Errorf("MONITOREXIT: Expected an uncaught IllegalMonitorStateException, got: %v", err)
+	}
+	if !strings.Contains(string(msg), "java.lang.IllegalMonitorStateException: current thread is not owner") {
+		t.Errorf("MONITOREXIT: Expected the exception to be reported, got: %s", string(msg))
+	}
+	if !object.HoldsMonitor(obj, 2) {
+		t.Errorf("MONITOREXIT: Expected the other thread to still hold the monitor")
 	}
 }
 
-// PUTFIELD: Update a field in an object -- error doesn't point to a field
-func TestPutFieldNonFieldCPentry(t *testing.T) {
-	f := newFrame(opcodes.PUTFIELD)
+// NEW: Instantiate object -- here with an error
+func TestNewWithError(t *testing.T) {
+	f := newFrame(opcodes.NEW)
 	f.Meth = append(f.Meth, 0x00)
 	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
 
 	CP := classloader.CPool{}
 	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
 	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
-	CP.CpIndex[1] = classloader.CpEntry{Type: 8, Slot: 0} // point to non-fieldRef
+	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.FieldRef, Slot: 0} // should be class or interface
+	// now create the pointed-to FieldRef
 	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
 	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
 	f.CP = &CP
@@ -1858,228 +2606,2960 @@ func TestPutFieldNonFieldCPentry(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	err := runFrame(fs)
 
-	msg := err.Error()
-	if !strings.Contains(msg, "PUTFIELD: Expected a field ref, but") {
-		t.Errorf("PUTFIELD: Did not get expected error msg: %s", msg)
+	if err == nil {
+		t.Errorf("NEW: Expected error message, but got none")
+	}
+
+	errMsg := err.Error()
+	if !strings.Contains(errMsg, "Invalid type for new object") {
+		t.Errorf("NEW: got unexpected error message: %s", errMsg)
+	}
+}
+
+// POP: pop item off stack and discard it
+func TestPop(t *testing.T) {
+	f := newFrame(opcodes.POP)
+	push(&f, int64(34)) // push three different values
+	push(&f, int64(21))
+	push(&f, int64(0))
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+
+	if f.TOS != 1 {
+		t.Errorf("POP: Expected stack with 2 items, but got a tos of: %d", f.TOS)
+	}
+
+	top := pop(&f).(int64)
+
+	if top != 21 {
+		t.Errorf("POP: expected top's value to be 21, but got: %d", top)
+	}
+}
+
+// POP with tracing enabled
+func TestPopWithTracing(t *testing.T) {
+	f := newFrame(opcodes.POP)
+	push(&f, int64(34)) // push three different values
+	push(&f, int64(21))
+	push(&f, int64(0))
+
+	MainThread = thread.CreateThread()
+	MainThread.Stack = frames.CreateFrameStack()
+	// fs := frames.CreateFrameStack()
+	MainThread.Stack.PushFront(&f) // push the new frame
+	MainThread.Trace = true        // turn on tracing
+	_ = runFrame(MainThread.Stack)
+
+	if f.TOS != 1 {
+		t.Errorf("POP: Expected stack with 2 items, but got a tos of: %d", f.TOS)
+	}
+
+	top := pop(&f).(int64)
+
+	if top != 21 {
+		t.Errorf("POP: expected top's value to be 21, but got: %d", top)
+	}
+
+	if MainThread.Trace != true {
+		t.Errorf("POP: MainThread.Trace was not re-enabled after the POP execution")
+	}
+}
+
+// POP2: pop two items
+func TestPop2(t *testing.T) {
+	_ = log.SetLogLevel(log.WARNING)
+
+	f := newFrame(opcodes.POP2)
+	push(&f, int64(34)) // push three different values; 34 at bottom
+	push(&f, int64(21))
+	push(&f, int64(10))
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+
+	if f.TOS != 0 {
+		t.Errorf("POP2: Expected stack with 1 item, but got a tos of: %d", f.TOS)
+	}
+
+	top := pop(&f).(int64)
+
+	if top != 34 {
+		t.Errorf("POP2: expected top's value to be 34, but got: %d", top)
+	}
+}
+
+// POP2: pop two items off stack -- make sure tracing doesn't affect the output
+func TestPop2WithTrace(t *testing.T) {
+	_ = log.SetLogLevel(log.WARNING)
+	f := newFrame(opcodes.POP2)
+	push(&f, int64(34)) // push three different values; 34 at bottom
+	push(&f, int64(21))
+	push(&f, int64(10))
+
+	MainThread = thread.CreateThread()
+	MainThread.Stack = frames.CreateFrameStack()
+	MainThread.Stack.PushFront(&f) // push the new frame
+	MainThread.Trace = true        // turn on tracing
+	_ = runFrame(MainThread.Stack)
+
+	if f.TOS != 0 {
+		t.Errorf("POP2: Expected stack with 1 item, but got a tos of: %d", f.TOS)
+	}
+
+	top := pop(&f).(int64)
+
+	if top != 34 {
+		t.Errorf("POP2: expected top's value to be 34, but got: %d", top)
+	}
+
+	if MainThread.Trace != true {
+		t.Errorf("POP2: MainThread.Trace was not re-enabled after the POP2 execution")
+	}
+}
+
+// PUTFIELD: Update a non-static field
+func TestPutFieldSimpleInt(t *testing.T) {
+	f := newFrame(opcodes.PUTFIELD)
+	f.Meth = append(f.Meth, 0x00)
+	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
+
+	CP := classloader.CPool{}
+	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
+	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
+	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.FieldRef, Slot: 0}
+	// now create the pointed-to FieldRef
+	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
+	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
+	f.CP = &CP
+
+	// now create the object we're updating, with one int field
+	obj := object.MakeEmptyObject()
+	obj.Fields = make([]object.Field, 1, 1)
+	obj.Fields[0].Fvalue = int64(42) // set the field = 42
+	obj.Fields[0].Ftype = types.Int
+	push(&f, obj)
+
+	push(&f, int64(26)) // update the field to 26
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	if err != nil {
+		t.Errorf("PUTFIELD: Got unexpected error msg: %s", err.Error())
+	}
+
+	res := obj.Fields[0].Fvalue.(int64)
+	if res != 26 {
+		t.Errorf("PUTFIELD: Expected a new value of 26, got: %d", res)
+	}
+}
+
+// PUTFIELD
+func TestPutFieldDouble(t *testing.T) {
+	f := newFrame(opcodes.PUTFIELD)
+	f.Meth = append(f.Meth, 0x00)
+	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
+
+	CP := classloader.CPool{}
+	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
+	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
+	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.FieldRef, Slot: 0}
+	// now create the pointed-to FieldRef
+	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
+	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
+	f.CP = &CP
+
+	// now create the object we're updating, with one int field
+	obj := object.MakeEmptyObject()
+	obj.Fields = make([]object.Field, 1, 1)
+	obj.Fields[0].Fvalue = float64(42.0) // set the field = 42
+	obj.Fields[0].Ftype = types.Double
+	push(&f, obj)
+
+	push(&f, float64(26.8)) // update the field to 26.8
+	push(&f, float64(26.8)) // push a second time b/c it's a double
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	if err != nil {
+		t.Errorf("PUTFIELD: Got unexpected error msg: %s", err.Error())
+	}
+
+	res := obj.Fields[0].Fvalue.(float64)
+	if res != 26.8 {
+		t.Errorf("PUTFIELD: Expected a new value of 26.8, got: %f", res)
+	}
+}
+
+// PUTFIELD: a float field holds the value rounded to 32 bits
+func TestPutFieldFloat(t *testing.T) {
+	f := newFrame(opcodes.PUTFIELD)
+	f.Meth = append(f.Meth, 0x00)
+	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
+
+	CP := classloader.CPool{}
+	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
+	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
+	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.FieldRef, Slot: 0}
+	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
+	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
+	f.CP = &CP
+
+	obj := object.MakeEmptyObject()
+	obj.Fields = make([]object.Field, 1, 1)
+	obj.Fields[0].Fvalue = float64(42.0)
+	obj.Fields[0].Ftype = types.Float
+	push(&f, obj)
+	push(&f, float64(26.8)) // not a float: 26.8f is 26.799999237060547
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	if err != nil {
+		t.Errorf("PUTFIELD: Got unexpected error msg: %s", err.Error())
+	}
+
+	res := obj.Fields[0].Fvalue.(float64)
+	if res != float64(float32(26.8)) {
+		t.Errorf("PUTFIELD: Expected a new value of 26.799999237060547, got: %.15f", res)
+	}
+}
+
+// PUTFIELD: Update a field in an object -- error doesn't point to a field
+func TestPutFieldNonFieldCPentry(t *testing.T) {
+	f := newFrame(opcodes.PUTFIELD)
+	f.Meth = append(f.Meth, 0x00)
+	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
+
+	CP := classloader.CPool{}
+	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
+	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
+	CP.CpIndex[1] = classloader.CpEntry{Type: 8, Slot: 0} // point to non-fieldRef
+	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
+	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
+	f.CP = &CP
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	msg := err.Error()
+	if !strings.Contains(msg, "PUTFIELD: Expected a field ref, but") {
+		t.Errorf("PUTFIELD: Did not get expected error msg: %s", msg)
+	}
+}
+
+// PUTFIELD: Error: attempt to update a non-static field
+func TestPutFieldErrorUpdatingStatic(t *testing.T) {
+	f := newFrame(opcodes.PUTFIELD)
+	f.Meth = append(f.Meth, 0x00)
+	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
+
+	CP := classloader.CPool{}
+	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
+	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
+	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.FieldRef, Slot: 0}
+	// now create the pointed-to FieldRef
+	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
+	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
+	f.CP = &CP
+
+	// now create the object we're updating, with one int field
+	obj := object.MakeEmptyObject()
+	obj.Fields = make([]object.Field, 1, 1)
+	obj.Fields[0].Fvalue = int64(42) // set the field = 42
+	obj.Fields[0].Ftype = types.Static + types.Int
+	push(&f, obj)
+
+	push(&f, int64(26)) // update the field to 26
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	if err == nil {
+		t.Errorf("PUTFIELD: Expected error message but got none")
+	}
+
+	errMsg := err.Error()
+	if !strings.Contains(errMsg, "invalid attempt to update a static variable") {
+		t.Errorf("PUTFIELD: Did not get expected error message, got %s", errMsg)
+	}
+}
+
+// PUTSTATIC: Update a static field -- invalid b/c does not point to a field ref in the CP
+func TestPutStaticInvalid(t *testing.T) {
+	f := newFrame(opcodes.PUTSTATIC)
+	f.Meth = append(f.Meth, 0x00)
+	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
+
+	CP := classloader.CPool{}
+	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
+	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
+	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.ClassRef, Slot: 0} // should be a field ref
+	// now create the pointed-to FieldRef
+	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
+	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
+	f.CP = &CP
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	if err == nil {
+		t.Errorf("PUTSTATIC: Expected error but did not get one.")
+	} else {
+		errMsg := err.Error()
+		if !strings.Contains(errMsg, "Expected a field ref, but got") {
+			t.Errorf("PUTSTATIC: Did not get expected error message, got: %s", errMsg)
+		}
+	}
+}
+
+// RET: the local must hold a return address
+func TestRetInvalidLocal(t *testing.T) {
+	f := newFrame(opcodes.RET)
+	f.Meth = append(f.Meth, 0x00)
+	f.Locals = append(f.Locals, int64(3)) // an int, not a return address
+
+	normalStderr := os.Stderr
+	_, w, _ := os.Pipe()
+	os.Stderr = w
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	_ = w.Close()
+	os.Stderr = normalStderr
+
+	if err == nil || !strings.Contains(err.Error(), "does not hold a return address") {
+		t.Errorf("RET: Expected an error for a local without a return address, got: %v", err)
+	}
+}
+
+// RETURN: Does a function return correctly?
+func TestReturn(t *testing.T) {
+	f := newFrame(opcodes.RETURN)
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	ret := runFrame(fs)
+	if f.TOS != -1 {
+		t.Errorf("Top of stack, expected -1, got: %d", f.TOS)
+	}
+
+	if ret != nil {
+		t.Error("RETURN: Expected popped value to be nil, got: " + ret.Error())
+	}
+}
+
+// SIPUSH: create int from next two bytes and push the int
+func TestSipush(t *testing.T) {
+	f := newFrame(opcodes.SIPUSH)
+	f.Meth = append(f.Meth, 0x01)
+	f.Meth = append(f.Meth, 0x02)
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+	if f.TOS != 0 {
+		t.Errorf("BIPUSH: Top of stack, expected 0, got: %d", f.TOS)
+	}
+	value := pop(&f).(int64)
+	if value != 258 {
+		t.Errorf("SIPUSH: Expected popped value to be 258, got: %d", value)
+	}
+
+	if f.PC != 3 {
+		t.Errorf("SIPUSH: Expected PC to be 3, got: %d", f.PC)
+	}
+}
+
+// SIPUSH: create a negative int from next two bytes and push the int
+func TestSipushNegative(t *testing.T) {
+	f := newFrame(opcodes.SIPUSH)
+	val := -1
+	f.Meth = append(f.Meth, byte(val))
+	f.Meth = append(f.Meth, 0x02)
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+	if f.TOS != 0 {
+		t.Errorf("BIPUSH: Top of stack, expected 0, got: %d", f.TOS)
+	}
+	value := pop(&f).(int64)
+	if value >= 0 {
+		t.Errorf("SIPUSH: Expected popped value to be negative, got: %d", value)
+	}
+
+	if f.PC != 3 {
+		t.Errorf("SIPUSH: Expected PC to be 3, got: %d", f.PC)
+	}
+}
+
+// SWAP: Swap top two items on stack
+func TestSwap(t *testing.T) {
+	// set the logger to low granularity, so that logging messages are not also captured in this test
+	_ = log.SetLogLevel(log.WARNING)
+
+	f := newFrame(opcodes.SWAP)
+	push(&f, int64(34)) // push two different values
+	push(&f, int64(21)) // TOS now = 21
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+
+	top := pop(&f).(int64)
+	next := pop(&f).(int64)
+
+	if top != 34 {
+		t.Errorf("SWAP: expected top's value to be 34, but got: %d", top)
+	}
+
+	if next != 21 {
+		t.Errorf("SWAP: expected next's value to be 21, but got: %d", next)
+	}
+
+	if f.TOS != -1 {
+		t.Errorf("SWAP: Expected an empty stack, but got a tos of: %d", f.TOS)
+	}
+}
+
+// TABLESWITCH: jump to the target at key-low in the table, or to the default target
+// if the key is out of range. Tested at all four alignments of the instruction.
+func TestTableswitch(t *testing.T) {
+	// default -> block 0; low = -1, high = 2; -1, 0, 1, 2 -> blocks 1, 2, 3, 1
+	operands := []int32{0, -1, 2, 1, 2, 3, 1}
+	isTarget := []bool{true, false, false, true, true, true, true}
+
+	tests := []struct {
+		key      int64
+		expected int64
+	}{
+		{-1, 20}, {0, 30}, {1, 40}, {2, 20}, {-2, 10}, {3, 10}, {-100000, 10}, {100000, 10},
+	}
+
+	for nops := 0; nops < 4; nops++ {
+		code := assembleSwitch(nops, opcodes.TABLESWITCH, operands, isTarget, 4)
+		for _, test := range tests {
+			value := runSwitch(t, code, test.key)
+			if value != test.expected {
+				t.Errorf("TABLESWITCH: at PC %d with key %d, expected %d, got: %d",
+					nops, test.key, test.expected, value)
+			}
+		}
+	}
+}
+
+// TABLESWITCH: jump offsets are signed, so a switch can jump backwards
+func TestTableswitchBackwardJump(t *testing.T) {
+	code := []byte{
+		opcodes.GOTO, 0x00, 0x08, // 0: jump to the switch at 8
+		opcodes.BIPUSH, 99, //       3: the target of the backward jump
+		opcodes.GOTO, 0x00, 0x1B, // 5: jump to the end of the method at 32
+		opcodes.TABLESWITCH, 0, 0, 0, // 8: switch and 3 bytes of padding
+		0xFF, 0xFF, 0xFF, 0xFB, // 12: default: -5, to PC 3
+		0x00, 0x00, 0x00, 0x00, // 16: low: 0
+		0x00, 0x00, 0x00, 0x00, // 20: high: 0
+		0xFF, 0xFF, 0xFF, 0xFB, // 24: offset for 0: -5, to PC 3
+		opcodes.NOP, opcodes.NOP, opcodes.NOP, opcodes.NOP, // 28: never executed
+	}
+
+	for _, key := range []int64{0, 1} {
+		value := runSwitch(t, code, key)
+		if value != 99 {
+			t.Errorf("TABLESWITCH: with key %d, expected backward jump to push 99, got: %d", key, value)
+		}
+	}
+}
+
+// WIDE: ILOAD and ISTORE with two-byte local indexes
+func TestWideIloadIstore(t *testing.T) {
+	f := newFrame(opcodes.WIDE)
+	f.Meth = append(f.Meth, opcodes.ILOAD, 0x01, 0x2C)                // load local 300
+	f.Meth = append(f.Meth, opcodes.WIDE, opcodes.ISTORE, 0x01, 0x2D) // store it in local 301
+	f.Locals = make([]interface{}, 302)
+	f.Locals[300] = int64(42)
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+	if err != nil {
+		t.Fatalf("WIDE: Unexpected error: %s", err.Error())
+	}
+
+	if getLocal(&f, 301) != int64(42) {
+		t.Errorf("WIDE: Expected local 301 to hold 42, got: %v", getLocal(&f, 301))
+	}
+	if f.TOS != -1 {
+		t.Errorf("WIDE: Expected an empty stack, but got a tos of: %d", f.TOS)
+	}
+}
+
+// WIDE: LSTORE and LLOAD with two-byte local indexes (longs take two locals)
+func TestWideLstoreLload(t *testing.T) {
+	f := newFrame(opcodes.WIDE)
+	f.Meth = append(f.Meth, opcodes.LSTORE, 0x01, 0x00)              // store in local 256
+	f.Meth = append(f.Meth, opcodes.WIDE, opcodes.LLOAD, 0x01, 0x00) // load it back
+	f.Locals = make([]interface{}, 258)
+	push(&f, int64(-123456789)) // longs require two slots, so pushed twice
+	push(&f, int64(-123456789))
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+	if err != nil {
+		t.Fatalf("WIDE: Unexpected error: %s", err.Error())
+	}
+
+	if getLocal(&f, 256) != int64(-123456789) || getLocal(&f, 257) != int64(-123456789) {
+		t.Errorf("WIDE: Expected locals 256 and 257 to hold -123456789, got: %v, %v",
+			getLocal(&f, 256), getLocal(&f, 257))
+	}
+	if f.TOS != 1 {
+		t.Errorf("WIDE: Expected two items on the stack, but got a tos of: %d", f.TOS)
+	}
+	if value := pop(&f).(int64); value != -123456789 {
+		t.Errorf("WIDE: Expected LLOAD to push -123456789, got: %d", value)
+	}
+}
+
+// WIDE: IINC with a two-byte local index and a signed two-byte increment
+func TestWideIinc(t *testing.T) {
+	f := newFrame(opcodes.WIDE)
+	f.Meth = append(f.Meth, opcodes.IINC, 0x01, 0x00, 0xFC, 0x18) // local 256 += -1000
+	f.Meth = append(f.Meth, opcodes.BIPUSH, 0x05)
+	f.Locals = make([]interface{}, 257)
+	f.Locals[256] = int64(5)
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+	if err != nil {
+		t.Fatalf("WIDE: Unexpected error: %s", err.Error())
+	}
+
+	if getLocal(&f, 256) != int64(-995) {
+		t.Errorf("WIDE: Expected local 256 to hold -995, got: %v", getLocal(&f, 256))
+	}
+	if f.TOS != 0 || pop(&f).(int64) != 5 { // make sure the next instruction was executed
+		t.Errorf("WIDE: Expected the instruction after IINC to push 5")
+	}
+}
+
+// WIDE: RET with a two-byte local index
+func TestWideRet(t *testing.T) {
+	f := newFrame(opcodes.WIDE)
+	f.Meth = append(f.Meth, opcodes.RET, 0x01, 0x04) // return to the address in local 260
+	f.Meth = append(f.Meth, opcodes.ICONST_1)        // 4: skipped
+	f.Meth = append(f.Meth, opcodes.BIPUSH, 0x03)    // 5:
+	f.Locals = make([]interface{}, 261)
+	f.Locals[260] = returnAddress(5)
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+	if err != nil {
+		t.Fatalf("WIDE: Unexpected error: %s", err.Error())
+	}
+
+	if f.TOS != 0 || pop(&f).(int64) != 3 {
+		t.Errorf("WIDE: Expected RET to go to BIPUSH, which should push 3 and only 3")
+	}
+}
+
+// WIDE: only loads, stores, IINC, and RET can be widened
+func TestWideInvalidOpcode(t *testing.T) {
+	f := newFrame(opcodes.WIDE)
+	f.Meth = append(f.Meth, opcodes.BIPUSH, 0x00, 0x01)
+
+	normalStderr := os.Stderr
+	_, w, _ := os.Pipe()
+	os.Stderr = w
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	_ = w.Close()
+	os.Stderr = normalStderr
+
+	if err == nil || !strings.Contains(err.Error(), "WIDE: Invalid bytecode BIPUSH") {
+		t.Errorf("WIDE: Expected an error for widening BIPUSH, got: %v", err)
+	}
+}
+
+func TestInvalidInstruction(t *testing.T) {
+	// set the logger to low granularity, so that logging messages are not also captured in this test
+	Global := globals.InitGlobals("test")
+	_ = log.SetLogLevel(log.WARNING)
+	LoadOptionsTable(Global)
+
+	// to avoid cluttering the test results, redirect stdout
+	normalStdout := os.Stdout
+	_, wout, _ := os.Pipe()
+	os.Stdout = wout
+
+	// to inspect usage message, redirect stderr
+	normalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	f := newFrame(252)
+
+	MainThread = thread.CreateThread()
+	MainThread.Stack = frames.CreateFrameStack()
+	MainThread.Stack.PushFront(&f) // push the new frame
+	MainThread.Trace = false       // turn off tracing
+	ret := runFrame(MainThread.Stack)
+
+	if ret == nil {
+		t.Errorf("Invalid instruction: Expected an error returned, but got nil.")
+	}
+
+	// restore stderr to what it was before
+	_ = w.Close()
+	out, _ := io.ReadAll(r)
+
+	_ = wout.Close()
+	os.Stdout = normalStdout
+	os.Stderr = normalStderr
+
+	msg := string(out[:])
+
+	if !strings.Contains(msg, "Invalid bytecode") {
+		t.Errorf("Error message for invalid bytecode not as expected, got: %s", msg)
+	}
+}
+
+func TestConvertInterfaceToUint64(t *testing.T) {
+	var i64 int64 = 200
+	var f64 float64 = 345.0
+	var ptr = unsafe.Pointer(&f64)
+
+	ret := convertInterfaceToUint64(i64)
+	if ret != 200 {
+		t.Errorf("Expected TestConvertInterfaceToUint64() to retun 200, got %d\n",
+			ret)
+	}
+
+	ret = convertInterfaceToUint64(f64)
+	if ret != 345 {
+		t.Errorf("Expected TestConvertInterfaceToUint64() to retun 345, got %d\n",
+			ret)
+	}
+
+	ret = convertInterfaceToUint64(ptr)
+	if ret == 0 { // a minimal test
+		t.Error("Expected TestConvertInterfaceToUint64() to !=0, got 0\n")
+	}
+}
+
+// Floats and doubles in string concatenations are formatted as by Java's toString()
+func TestJavaFloatToString(t *testing.T) {
+	tests := []struct {
+		value    float64
+		bitSize  int
+		expected string
+	}{
+		{1.0, 64, "1.0"},
+		{-2.5, 64, "-2.5"},
+		{0.001, 64, "0.001"},
+		{0.0001, 64, "1.0E-4"},
+		{1234567.0, 64, "1234567.0"},
+		{1.0e7, 64, "1.0E7"},
+		{1.25e-10, 64, "1.25E-10"},
+		{float64(float32(0.1)), 32, "0.1"},
+		{float64(float32(3.4e38)), 32, "3.4E38"},
+		{0.0, 64, "0.0"},
+		{math.Copysign(0, -1), 64, "-0.0"},
+		{math.NaN(), 64, "NaN"},
+		{math.Inf(1), 32, "Infinity"},
+		{math.Inf(-1), 64, "-Infinity"},
+	}
+
+	for _, test := range tests {
+		str := javaFloatToString(test.value, test.bitSize)
+		if str != test.expected {
+			t.Errorf("javaFloatToString: Expected %s, got: %s", test.expected, str)
+		}
+	}
+}
+
+// set up a class with a static method, sum(I)I, that recursively computes n + (n-1) + ... + 0,
+// and return a frame that calls sum(n). Used to test deep recursion and the frame limit.
+func recursionSetup(n int64) frames.Frame {
+	globals.InitGlobals("test")
+	log.Init()
+	classloader.InitMethodArea()
+
+	CP := classloader.CPool{}
+	CP.CpIndex = []classloader.CpEntry{
+		{Type: 0, Slot: 0},
+		{Type: classloader.MethodRef, Slot: 0},   // [1] test/Recursion.sum(I)I
+		{Type: classloader.ClassRef, Slot: 0},    // [2]
+		{Type: classloader.UTF8, Slot: 0},        // [3]
+		{Type: classloader.NameAndType, Slot: 0}, // [4]
+		{Type: classloader.UTF8, Slot: 1},        // [5]
+		{Type: classloader.UTF8, Slot: 2},        // [6]
+		{Type: classloader.ClassRef, Slot: 1},    // [7] java/lang/StackOverflowError
+		{Type: classloader.UTF8, Slot: 3},        // [8]
+	}
+	CP.MethodRefs = []classloader.MethodRefEntry{{ClassIndex: 2, NameAndType: 4}}
+	CP.ClassRefs = []uint16{3, 8}
+	CP.NameAndTypes = []classloader.NameAndTypeEntry{{NameIndex: 5, DescIndex: 6}}
+	CP.Utf8Refs = []string{"test/Recursion", "sum", "(I)I", "java/lang/StackOverflowError"}
+
+	// the classes of the StackOverflowError thrown when the recursion is too deep
+	for class, superclass := range map[string]string{
+		"java/lang/Throwable":           "java/lang/Object",
+		"java/lang/Error":               "java/lang/Throwable",
+		"java/lang/VirtualMachineError": "java/lang/Error",
+		"java/lang/StackOverflowError":  "java/lang/VirtualMachineError",
+	} {
+		classloader.MethAreaInsert(class, &(classloader.Klass{
+			Status: 'X', Loader: "bootstrap",
+			Data: &classloader.ClData{Name: class, Superclass: superclass}}))
+	}
+
+	sum := classloader.Method{
+		AccessFlags: 0x0009, // public static
+		CodeAttr: classloader.CodeAttrib{
+			MaxStack:  3,
+			MaxLocals: 1,
+			Code: []byte{
+				opcodes.ILOAD_0,          // 0:
+				opcodes.IFNE, 0x00, 0x05, // 1: if n != 0, go to 6
+				opcodes.ICONST_0,           // 4:
+				opcodes.IRETURN,            // 5: return 0
+				opcodes.ILOAD_0,            // 6:
+				opcodes.ILOAD_0,            // 7:
+				opcodes.ICONST_1,           // 8:
+				opcodes.ISUB,               // 9:
+				opcodes.INVOKESTATIC, 0, 1, // 10: sum(n-1)
+				opcodes.IADD,    // 13:
+				opcodes.IRETURN, // 14: return n + sum(n-1)
+			},
+		},
+	}
+	classloader.MethAreaInsert("test/Recursion", &(classloader.Klass{
+		Status: 'X', Loader: "app",
+		Data: &classloader.ClData{Name: "test/Recursion", Superclass: "java/lang/Object",
+			MethodTable: map[string]*classloader.Method{"sum(I)I": &sum}, CP: CP}}))
+
+	f := newFrame(opcodes.INVOKESTATIC)
+	f.Meth = append(f.Meth, 0x00, 0x01) // CP slot 1
+	f.ClName = "test/Recursion"
+	f.MethName = "main"
+	f.MethType = "()V"
+	f.CP = &classloader.MethAreaFetch("test/Recursion").Data.CP
+	push(&f, n)
+	return f
+}
+
+// Deep recursion is executed in a single loop, so the depth of the Java calls
+// does not add to the depth of the golang stack. When the outermost call returns,
+// every frame it pushed has been popped off the frame stack.
+func TestDeepRecursion(t *testing.T) {
+	f := recursionSetup(5000)
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+	if err != nil {
+		t.Fatalf("Deep recursion: Unexpected error: %s", err.Error())
+	}
+
+	if fs.Len() != 1 || fs.Front().Value.(*frames.Frame) != &f {
+		t.Errorf("Deep recursion: Expected only the calling frame on the frame stack, got %d frames", fs.Len())
+	}
+	if ret := pop(&f).(int64); ret != 12502500 { // 5000 * 5001 / 2
+		t.Errorf("Deep recursion: Expected a result of 12502500, got: %d", ret)
+	}
+}
+
+// Recursion deeper than the frame limit throws a StackOverflowError. Here, it's not
+// caught, so it's reported and the frame stack is left as it was when it was thrown.
+func TestRecursionExceedsFrameLimit(t *testing.T) {
+	f := recursionSetup(500)
+	globals.GetGlobalRef().MaxFrames = 100
+
+	normalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	_ = w.Close()
+	os.Stderr = normalStderr
+	msg, _ := io.ReadAll(r)
+	globals.GetGlobalRef().MaxFrames = globals.DefaultMaxFrames
+
+	if err == nil || !strings.Contains(err.Error(), "java/lang/StackOverflowError") {
+		t.Errorf("Frame limit: Expected an uncaught StackOverflowError, got: %v", err)
+	}
+	if !strings.Contains(string(msg), "Exception in thread \"main\" java.lang.StackOverflowError") {
+		t.Errorf("Frame limit: Expected the StackOverflowError to be reported, got: %s", string(msg))
+	}
+	if fs.Len() != 100 {
+		t.Errorf("Frame limit: Expected 100 frames on the frame stack, got: %d", fs.Len())
+	}
+}
+
+// A StackOverflowError can be caught like any other exception. Here, it's caught by
+// the method that began the recursion, so every frame of the recursion is popped off.
+func TestRecursionStackOverflowErrorCaught(t *testing.T) {
+	f := recursionSetup(500)
+	f.Meth = append(f.Meth, opcodes.NOP) // 3: the handler
+	classloader.MTable["test/Recursion.main()V"] = classloader.MTentry{
+		MType: 'J',
+		Meth: classloader.JmEntry{Cp: f.CP.(*classloader.CPool),
+			Exceptions: []classloader.CodeException{{StartPc: 0, EndPc: 3, HandlerPc: 3, CatchType: 7}}},
+	}
+	globals.GetGlobalRef().MaxFrames = 100
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+	globals.GetGlobalRef().MaxFrames = globals.DefaultMaxFrames
+	delete(classloader.MTable, "test/Recursion.main()V")
+
+	if err != nil {
+		t.Fatalf("Frame limit: Expected the StackOverflowError to be caught, got: %s", err.Error())
+	}
+	if fs.Len() != 1 {
+		t.Errorf("Frame limit: Expected only the catching frame on the frame stack, got %d frames", fs.Len())
+	}
+	if f.TOS != 0 {
+		t.Fatalf("Frame limit: Expected the exception alone on the operand stack, TOS is: %d", f.TOS)
+	}
+	exc, ok := peek(&f).(*object.Object)
+	if !ok || *exc.Klass != "java/lang/StackOverflowError" {
+		t.Errorf("Frame limit: Expected a StackOverflowError on the operand stack, got: %v", peek(&f))
+	}
+}
+
+// Pushing a value onto a full operand stack is an error in the method, which is
+// reported along with the location of the instruction that did the pushing
+func TestOperandStackOverflow(t *testing.T) {
+	globals.InitGlobals("test")
+	log.Init()
+
+	f := frames.CreateFrame(1)
+	f.Ftype = 'J'
+	f.ClName = "test/Overflow"
+	f.MethName = "main"
+	f.Meth = []byte{opcodes.ICONST_1, opcodes.ICONST_2, opcodes.RETURN}
+
+	normalStderr := os.Stderr
+	_, w, _ := os.Pipe()
+	os.Stderr = w
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(f) // push the new frame
+	err := runFrame(fs)
+
+	_ = w.Close()
+	os.Stderr = normalStderr
+
+	if err == nil {
+		t.Fatalf("Operand stack: Expected an overflow error, but got none")
+	}
+	if !strings.Contains(err.Error(), "operand stack overflow") ||
+		!strings.Contains(err.Error(), "test/Overflow.main") ||
+		!strings.Contains(err.Error(), "PC: 001") {
+		t.Errorf("Operand stack: Got unexpected message re overflow error: %s", err.Error())
+	}
+}
+
+// Popping a value off an empty operand stack is likewise an error in the method
+func TestOperandStackUnderflow(t *testing.T) {
+	globals.InitGlobals("test")
+	log.Init()
+
+	f := newFrame(opcodes.NOP)
+	f.ClName = "test/Underflow"
+	f.MethName = "main"
+	f.Meth = append(f.Meth, opcodes.POP, opcodes.RETURN)
+
+	normalStderr := os.Stderr
+	_, w, _ := os.Pipe()
+	os.Stderr = w
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	_ = w.Close()
+	os.Stderr = normalStderr
+
+	if err == nil {
+		t.Fatalf("Operand stack: Expected an underflow error, but got none")
+	}
+	if !strings.Contains(err.Error(), "operand stack underflow") ||
+		!strings.Contains(err.Error(), "PC: 001") {
+		t.Errorf("Operand stack: Got unexpected message re underflow error: %s", err.Error())
+	}
+}
+
+// A method's CP references are resolved on their first execution and later executions
+// use the result, so changing the CP entry after the first execution has no effect
+func TestQuickenedLdcSkipsResolution(t *testing.T) {
+	globals.InitGlobals("test")
+	log.Init()
+
+	cp := classloader.CPool{}
+	cp.IntConsts = []int32{25}
+	cp.CpIndex = []classloader.CpEntry{{}, {Type: classloader.IntConst, Slot: 0}}
+	code := []byte{opcodes.LDC, 0x01}
+
+	for i, expected := range []int64{25, 25} {
+		f := frames.CreateFrame(2)
+		f.Meth = code // the two frames share the bytecode, as frames of the same method do
+		f.CP = &cp
+		fs := frames.CreateFrameStack()
+		fs.PushFront(f)
+		if err := runFrame(fs); err != nil {
+			t.Fatalf("LDC: Unexpected error on execution %d: %s", i+1, err.Error())
+		}
+		if value := pop(f).(int64); value != expected {
+			t.Errorf("LDC: Expected %d on execution %d, got: %d", expected, i+1, value)
+		}
+		cp.IntConsts[0] = 99 // not seen by the second execution
+	}
+}
+
+// Resolution errors are raised when the instruction is first executed, not when its
+// method is first executed
+func TestQuickenedResolutionErrorIsLazy(t *testing.T) {
+	globals.InitGlobals("test")
+	log.Init()
+
+	cp := classloader.CPool{}
+	cp.CpIndex = []classloader.CpEntry{{}, {Type: classloader.IntConst, Slot: 0}} // not a field ref
+	cp.IntConsts = []int32{0}
+	code := []byte{
+		opcodes.ILOAD_0,          // 0:
+		opcodes.IFEQ, 0x00, 0x06, // 1: if local 0 is 0, skip the GETSTATIC
+		opcodes.GETSTATIC, 0x00, 0x01, // 4:
+		opcodes.RETURN, // 7:
+	}
+
+	run := func(local int64) error {
+		f := frames.CreateFrame(2)
+		f.Meth = code
+		f.CP = &cp
+		f.Locals = []interface{}{local}
+		fs := frames.CreateFrameStack()
+		fs.PushFront(frames.CreateFrame(1)) // the caller, to which RETURN returns
+		fs.PushFront(f)
+		return runFrame(fs)
+	}
+
+	if err := run(0); err != nil {
+		t.Errorf("GETSTATIC: Unexpected error when the instruction is not executed: %s", err.Error())
+	}
+	normalStderr := os.Stderr
+	_, w, _ := os.Pipe()
+	os.Stderr = w
+	err := run(1)
+	_ = w.Close()
+	os.Stderr = normalStderr
+
+	if err == nil || !strings.Contains(err.Error(), "GETSTATIC: Expected a field ref") {
+		t.Errorf("GETSTATIC: Expected a resolution error on first execution, got: %v", err)
+	}
+}
+
+// The instructions of the translated bytecode start at the PCs of the opcodes,
+// whatever the lengths of the instructions before them
+func TestTranslateFindsInstructionStarts(t *testing.T) {
+	code := []byte{
+		opcodes.NOP,                     // 0:
+		opcodes.TABLESWITCH, 0x00, 0x00, // 1: padded to 4
+		0x00, 0x00, 0x00, 0x10, // 4: default offset
+		0x00, 0x00, 0x00, 0x00, // 8: low
+		0x00, 0x00, 0x00, 0x00, // 12: high
+		0x00, 0x00, 0x00, 0x10, // 16: offset for 0
+		opcodes.WIDE, opcodes.IINC, 0x01, 0x00, 0x00, 0x01, // 20:
+		opcodes.LDC_W, 0x00, 0x01, // 26:
+		opcodes.RETURN, // 29:
+	}
+	q := translate(code)
+	starts := map[int]byte{0: opcodes.NOP, 1: opcodes.TABLESWITCH, 20: opcodes.WIDE,
+		26: opcodes.LDC_W, 29: opcodes.RETURN}
+	for pc := range q.instrs {
+		in := &q.instrs[pc]
+		expected, isStart := starts[pc]
+		if isStart && in.opcode != expected {
+			t.Errorf("translate: Expected opcode 0x%02X at %d, got: 0x%02X", expected, pc, in.opcode)
+		}
+		if !isStart && in.opcode != 0 {
+			t.Errorf("translate: Unexpected instruction 0x%02X at %d", in.opcode, pc)
+		}
+	}
+}
+
+// run frame f again, from its first instruction, on an object of class objClass
+func rerunOnObject(f *frames.Frame, objClass string) error {
+	f.PC = 0
+	f.TOS = -1
+	obj := object.MakeEmptyObject()
+	obj.Klass = &objClass
+	push(f, obj)
+	return invokeinterfaceRun(f)
+}
+
+// An INVOKEVIRTUAL site caches the method selected for each class of object it's called
+// on, and calls on objects of a class already seen hit the cache
+func TestInlineCacheVirtualPolymorphic(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/AnimalIC", "java/lang/Object", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(1)})
+	invokeinterfaceAddClass("test/DogIC", "test/AnimalIC", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(2)})
+
+	f := invokevirtualFrame("test/AnimalIC", "test/DogIC")
+	for i, objClass := range []string{"test/DogIC", "test/DogIC", "test/AnimalIC", "test/DogIC"} {
+		if err := rerunOnObject(&f, objClass); err != nil {
+			t.Fatalf("INVOKEVIRTUAL: Unexpected error on call %d: %s", i+1, err.Error())
+		}
+		expected := int64(2)
+		if objClass == "test/AnimalIC" {
+			expected = 1
+		}
+		if ret := pop(&f).(int64); ret != expected {
+			t.Errorf("INVOKEVIRTUAL: Expected call %d to return %d, got: %d", i+1, expected, ret)
+		}
+	}
+
+	ic := getQuickCode(&f).instrs[0].resolved.Load().ic
+	if ic.hits.Load() != 2 || ic.misses.Load() != 2 {
+		t.Errorf("INVOKEVIRTUAL: Expected 2 hits and 2 misses, got: %d hits, %d misses",
+			ic.hits.Load(), ic.misses.Load())
+	}
+	if s := ic.state.Load(); s == nil || len(s.entries) != 2 {
+		t.Errorf("INVOKEVIRTUAL: Expected the inline cache to hold 2 receiver classes")
+	}
+}
+
+// An inline cache tells apart the classes of the same name that two loaders define
+func TestInlineCacheSameClassNameInTwoLoaders(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/AnimalIC", "java/lang/Object", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(1)})
+	invokeinterfaceAddClass("test/DogIC", "test/AnimalIC", false, nil,
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(2)})
+
+	cl := classloader.LoaderNamed("test.ICLoader @1")
+	if cl == nil {
+		cl, _ = classloader.NewClassloader("test.ICLoader @1", classloader.AppCL.Name)
+	}
+	otherDog := classloader.Klass{Status: 'X', Loader: cl.Name, Data: &classloader.ClData{
+		Name: "test/DogIC", Superclass: "test/AnimalIC",
+		MethodTable: map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(3)}}}
+	classloader.MethAreaInsert("test/DogIC", &otherDog)
+	dogs := []*classloader.Klass{classloader.MethAreaFetch("test/DogIC"), &otherDog}
+
+	f := invokevirtualFrame("test/AnimalIC", "test/DogIC")
+	for i, dog := range []int{0, 1, 0, 1} {
+		f.PC = 0
+		f.TOS = -1
+		obj := object.MakeEmptyObject()
+		obj.Klass = &dogs[dog].Data.Name
+		push(&f, obj)
+		if err := invokeinterfaceRun(&f); err != nil {
+			t.Fatalf("INVOKEVIRTUAL: Unexpected error on call %d: %s", i+1, err.Error())
+		}
+		if ret := pop(&f).(int64); ret != int64(2+dog) {
+			t.Errorf("INVOKEVIRTUAL: Expected call %d to return %d, got: %d", i+1, 2+dog, ret)
+		}
+	}
+
+	ic := getQuickCode(&f).instrs[0].resolved.Load().ic
+	if ic.hits.Load() != 2 || ic.misses.Load() != 2 {
+		t.Errorf("INVOKEVIRTUAL: Expected 2 hits and 2 misses, got: %d hits, %d misses",
+			ic.hits.Load(), ic.misses.Load())
+	}
+}
+
+// Loading a class into the method area invalidates the inline caches
+func TestInlineCacheInvalidatedByClassLoad(t *testing.T) {
+	invokeinterfaceSetup()
+	invokeinterfaceAddClass("test/IntfIC", "java/lang/Object", true, nil,
+		map[string]*classloader.Method{"getValue()I": {AccessFlags: 0x0401}})
+	invokeinterfaceAddClass("test/ImplIC", "java/lang/Object", false, []string{"test/IntfIC"},
+		map[string]*classloader.Method{"getValue()I": invokeinterfaceMethod(7)})
+
+	f := invokeinterfaceFrame("test/IntfIC", "test/ImplIC")
+	if err := invokeinterfaceRun(&f); err != nil {
+		t.Fatalf("INVOKEINTERFACE: Unexpected error: %s", err.Error())
+	}
+	pop(&f)
+	if err := rerunOnObject(&f, "test/ImplIC"); err != nil {
+		t.Fatalf("INVOKEINTERFACE: Unexpected error: %s", err.Error())
+	}
+	pop(&f)
+
+	invokeinterfaceAddClass("test/OtherIC", "java/lang/Object", false, nil, nil)
+	if err := rerunOnObject(&f, "test/ImplIC"); err != nil {
+		t.Fatalf("INVOKEINTERFACE: Unexpected error: %s", err.Error())
+	}
+	if ret := pop(&f).(int64); ret != 7 {
+		t.Errorf("INVOKEINTERFACE: Expected the method to return 7, got: %d", ret)
+	}
+
+	ic := getQuickCode(&f).instrs[0].resolved.Load().ic
+	if ic.hits.Load() != 1 || ic.misses.Load() != 2 {
+		t.Errorf("INVOKEINTERFACE: Expected 1 hit and 2 misses, got: %d hits, %d misses",
+			ic.hits.Load(), ic.misses.Load())
+	}
+}
+
+// set the closure tier and its thresholds, returning a function that restores them
+func setClosureTier(enabled bool, invocations, backedges int32) func() {
+	savedTier, savedInvocations, savedBackedges := closureTier, tierInvocationThreshold, tierBackedgeThreshold
+	closureTier, tierInvocationThreshold, tierBackedgeThreshold = enabled, invocations, backedges
+	return func() {
+		closureTier, tierInvocationThreshold, tierBackedgeThreshold = savedTier, savedInvocations, savedBackedges
+	}
+}
+
+// run the int loop in run_bench_test.go, which sums the ints below n, in a new frame
+func runIntLoop(t *testing.T, code []byte, n int64) *frames.Frame {
+	f := frames.CreateFrame(8)
+	f.Ftype = 'J'
+	f.Meth = code
+	f.Locals = []interface{}{n, int64(0), int64(0)}
+	fs := frames.CreateFrameStack()
+	fs.PushFront(f)
+	if err := runFrame(fs); err != nil {
+		t.Fatalf("Int loop: Unexpected error: %s", err.Error())
+	}
+	if sum := pop(f).(int64); sum != n*(n-1)/2 {
+		t.Errorf("Int loop: Expected a sum of %d, got: %d", n*(n-1)/2, sum)
+	}
+	return f
+}
+
+// A method is compiled into closures when it has been invoked often enough
+func TestClosureTierCompilesOnInvocations(t *testing.T) {
+	globals.InitGlobals("test")
+	log.Init()
+	defer setClosureTier(true, 3, math.MaxInt32)()
+
+	code := append([]byte{}, intLoop...) // a method of its own, not yet compiled
+	for i := 1; i <= 3; i++ {
+		f := runIntLoop(t, code, 100)
+		compiled := getQuickCode(f).compiled.Load() != nil
+		if compiled != (i == 3) {
+			t.Errorf("Closure tier: After %d invocations, expected compiled to be %t", i, i == 3)
+		}
+	}
+}
+
+// A method is compiled into closures when it has looped often enough, and execution
+// continues in the compiled method from the point it was compiled
+func TestClosureTierCompilesOnBackedges(t *testing.T) {
+	globals.InitGlobals("test")
+	log.Init()
+	defer setClosureTier(true, math.MaxInt32, 10)()
+
+	code := append([]byte{}, intLoop...)
+	f := runIntLoop(t, code, 1000)
+	if getQuickCode(f).compiled.Load() == nil {
+		t.Errorf("Closure tier: Expected the loop to be compiled")
+	}
+}
+
+// Each statement is compiled to one closure, held at the PC of its first instruction
+func TestClosureTierStatements(t *testing.T) {
+	c := compileClosures(intLoop, translate(intLoop))
+	starts := map[int]bool{0: true, 2: true, 4: true, 9: true, 13: true, 16: true, 19: true}
+	for pc, op := range c.ops {
+		if (op != nil) != starts[pc] {
+			t.Errorf("Closure tier: Expected a statement at PC %d to be %t", pc, starts[pc])
+		}
+	}
+}
+
+// Instructions that the closure tier doesn't compile are interpreted, and the values
+// computed by a statement before one are pushed for it to use
+func TestClosureTierFallsBackToInterpreter(t *testing.T) {
+	globals.InitGlobals("test")
+	log.Init()
+	defer setClosureTier(true, 0, 0)()
+
+	code := []byte{
+		opcodes.ILOAD_0,  // 0:
+		opcodes.ICONST_2, // 1:
+		opcodes.IDIV,     // 2: interpreted, as it can throw an exception
+		opcodes.ICONST_1, // 3:
+		opcodes.IADD,     // 4:
+		opcodes.ISTORE_1, // 5: local 1 = local 0 / 2 + 1
+	}
+	f := frames.CreateFrame(4)
+	f.Meth = code
+	f.Locals = []interface{}{int64(10), int64(0)}
+	fs := frames.CreateFrameStack()
+	fs.PushFront(f)
+	if err := runFrame(fs); err != nil {
+		t.Fatalf("Closure tier: Unexpected error: %s", err.Error())
+	}
+	if result := getLocal(f, 1).(int64); result != 6 {
+		t.Errorf("Closure tier: Expected 6 in local 1, got: %d", result)
+	}
+	if f.TOS != -1 {
+		t.Errorf("Closure tier: Expected an empty operand stack, TOS is: %d", f.TOS)
+	}
+	c := getQuickCode(f).compiled.Load()
+	if c == nil || c.ops[0] == nil || c.ops[2] != nil || c.ops[3] == nil {
+		t.Errorf("Closure tier: Expected statements at PCs 0 and 3, with IDIV interpreted")
+	}
+}
+
+// floatCase is a float instruction and its operands, with the result Java gives
+type floatCase struct {
+	op       byte
+	operands []float64 // pushed as floats, or as doubles for D2F, D2I, and D2L
+	longIn   int64     // the operand of I2F and L2F
+	want     interface{}
+}
+
+// The float instructions compute the results of Java's 32-bit floats (IEEE binary32),
+// including the handling of NaN, the infinities, and -0. The results are those Java
+// gives for the same expressions: the floats are given as the bits that
+// Float.floatToIntBits() returns for them. The binary instructions are also executed
+// on locals, in a statement that the closure tier compiles when it's enabled.
+func TestFloatSemanticsMatchJava(t *testing.T) {
+	globals.InitGlobals("test")
+	log.Init()
+
+	f32 := func(bits uint32) float64 { return float64(math.Float32frombits(bits)) }
+	inf, negInf, negZero := math.Inf(1), math.Inf(-1), math.Copysign(0, -1)
+	nan := math.NaN()
+
+	cases := []floatCase{
+		{op: opcodes.FADD, operands: []float64{f32(0x3DCCCCCD), f32(0x3E4CCCCD)}, want: uint32(0x3E99999A)}, // 0.1f + 0.2f = 0.3f
+		{op: opcodes.FADD, operands: []float64{16777216, 1}, want: uint32(0x4B800000)},                      // 1.6777216E7
+		{op: opcodes.FADD, operands: []float64{inf, negInf}, want: uint32(0x7FC00000)},                      // NaN
+		{op: opcodes.FADD, operands: []float64{negZero, negZero}, want: uint32(0x80000000)},                 // -0.0
+		{op: opcodes.FADD, operands: []float64{negZero, 0}, want: uint32(0x00000000)},                       // 0.0
+		{op: opcodes.FSUB, operands: []float64{f32(0x3F8CCCCD), 1}, want: uint32(0x3DCCCCD0)},               // 1.1f - 1f = 0.100000024
+		{op: opcodes.FSUB, operands: []float64{0, 0}, want: uint32(0x00000000)},                             // 0.0
+		{op: opcodes.FMUL, operands: []float64{1e38, 10}, want: uint32(0x7F800000)},                         // Infinity
+		{op: opcodes.FMUL, operands: []float64{f32(0x3DCCCCCD), 3}, want: uint32(0x3E99999A)},               // 0.1f * 3 = 0.3f
+		{op: opcodes.FMUL, operands: []float64{-1, 0}, want: uint32(0x80000000)},                            // -0.0
+		{op: opcodes.FMUL, operands: []float64{inf, 0}, want: uint32(0x7FC00000)},                           // NaN
+		{op: opcodes.FMUL, operands: []float64{1e-30, 1e-30}, want: uint32(0x00000000)},                     // underflows to 0.0
+		{op: opcodes.FDIV, operands: []float64{1, 3}, want: uint32(0x3EAAAAAB)},                             // 0.33333334
+		{op: opcodes.FDIV, operands: []float64{2, 3}, want: uint32(0x3F2AAAAB)},                             // 0.6666667
+		{op: opcodes.FDIV, operands: []float64{1, 0}, want: uint32(0x7F800000)},                             // Infinity
+		{op: opcodes.FDIV, operands: []float64{-1, 0}, want: uint32(0xFF800000)},                            // -Infinity
+		{op: opcodes.FDIV, operands: []float64{1, negZero}, want: uint32(0xFF800000)},                       // -Infinity
+		{op: opcodes.FDIV, operands: []float64{-1, negZero}, want: uint32(0x7F800000)},                      // Infinity
+		{op: opcodes.FDIV, operands: []float64{0, 0}, want: uint32(0x7FC00000)},                             // NaN
+		{op: opcodes.FDIV, operands: []float64{0, -5}, want: uint32(0x80000000)},                            // -0.0
+		{op: opcodes.FDIV, operands: []float64{inf, inf}, want: uint32(0x7FC00000)},                         // NaN
+		{op: opcodes.FREM, operands: []float64{5.5, 2}, want: uint32(0x3FC00000)},                           // 1.5
+		{op: opcodes.FREM, operands: []float64{-5.5, 2}, want: uint32(0xBFC00000)},                          // -1.5
+		{op: opcodes.FREM, operands: []float64{5, -3}, want: uint32(0x40000000)},                            // 2.0
+		{op: opcodes.FREM, operands: []float64{7, 2}, want: uint32(0x3F800000)},                             // 1.0
+		{op: opcodes.FREM, operands: []float64{-4, 2}, want: uint32(0x80000000)},                            // -0.0
+		{op: opcodes.FREM, operands: []float64{1, 0}, want: uint32(0x7FC00000)},                             // NaN
+		{op: opcodes.FREM, operands: []float64{inf, 2}, want: uint32(0x7FC00000)},                           // NaN
+		{op: opcodes.FREM, operands: []float64{3, inf}, want: uint32(0x40400000)},                           // 3.0
+		{op: opcodes.FNEG, operands: []float64{0}, want: uint32(0x80000000)},                                // -0.0
+		{op: opcodes.FNEG, operands: []float64{negInf}, want: uint32(0x7F800000)},                           // Infinity
+		{op: opcodes.I2F, longIn: 16777217, want: uint32(0x4B800000)},                                       // 1.6777216E7
+		{op: opcodes.I2F, longIn: math.MaxInt32, want: uint32(0x4F000000)},                                  // 2.14748365E9
+		{op: opcodes.L2F, longIn: 9007199254740993, want: uint32(0x5A000000)},                               // 9.0071993E15
+		{op: opcodes.L2F, longIn: math.MinInt64, want: uint32(0xDF000000)},                                  // -9.223372E18
+		{op: opcodes.D2F, operands: []float64{0.1}, want: uint32(0x3DCCCCCD)},                               // 0.1f
+		{op: opcodes.D2F, operands: []float64{1e40}, want: uint32(0x7F800000)},                              // Infinity
+		{op: opcodes.D2F, operands: []float64{-1e-50}, want: uint32(0x80000000)},                            // -0.0
+		{op: opcodes.F2I, operands: []float64{nan}, want: int64(0)},
+		{op: opcodes.F2I, operands: []float64{3.9e9}, want: int64(math.MaxInt32)},
+		{op: opcodes.F2I, operands: []float64{-3.9e9}, want: int64(math.MinInt32)},
+		{op: opcodes.F2I, operands: []float64{inf}, want: int64(math.MaxInt32)},
+		{op: opcodes.F2I, operands: []float64{negInf}, want: int64(math.MinInt32)},
+		{op: opcodes.F2I, operands: []float64{-0.9}, want: int64(0)},
+		{op: opcodes.F2I, operands: []float64{2.5}, want: int64(2)},
+		{op: opcodes.F2I, operands: []float64{-2.5}, want: int64(-2)},
+		{op: opcodes.F2L, operands: []float64{nan}, want: int64(0)},
+		{op: opcodes.F2L, operands: []float64{1e20}, want: int64(math.MaxInt64)},
+		{op: opcodes.F2L, operands: []float64{-1e20}, want: int64(math.MinInt64)},
+		{op: opcodes.F2L, operands: []float64{negInf}, want: int64(math.MinInt64)},
+		{op: opcodes.F2L, operands: []float64{f32(0x4B800001)}, want: int64(16777218)},
+		{op: opcodes.D2I, operands: []float64{nan}, want: int64(0)},
+		{op: opcodes.D2I, operands: []float64{-1e10}, want: int64(math.MinInt32)},
+		{op: opcodes.D2L, operands: []float64{9.3e18}, want: int64(math.MaxInt64)},
+		{op: opcodes.D2L, operands: []float64{-123.99}, want: int64(-123)},
+		{op: opcodes.FCMPL, operands: []float64{nan, 1}, want: int64(-1)},
+		{op: opcodes.FCMPG, operands: []float64{nan, 1}, want: int64(1)},
+		{op: opcodes.FCMPL, operands: []float64{1, nan}, want: int64(-1)},
+		{op: opcodes.FCMPG, operands: []float64{nan, nan}, want: int64(1)},
+		{op: opcodes.FCMPL, operands: []float64{negZero, 0}, want: int64(0)},
+		{op: opcodes.FCMPG, operands: []float64{0, negZero}, want: int64(0)},
+		{op: opcodes.FCMPL, operands: []float64{negInf, inf}, want: int64(-1)},
+		{op: opcodes.FCMPG, operands: []float64{inf, f32(0x7F7FFFFF)}, want: int64(1)},
+	}
+
+	for _, c := range cases {
+		name := opcodes.BytecodeNames[int(c.op)]
+		f := newFrame(c.op)
+		switch {
+		case c.op == opcodes.I2F:
+			pushInt(&f, c.longIn)
+		case c.op == opcodes.L2F:
+			pushLong(&f, c.longIn)
+		case c.op == opcodes.D2F || c.op == opcodes.D2I || c.op == opcodes.D2L:
+			pushDouble(&f, c.operands[0])
+		default:
+			for _, v := range c.operands {
+				pushFloat(&f, v)
+			}
+		}
+		fs := frames.CreateFrameStack()
+		fs.PushFront(&f)
+		if err := runFrame(fs); err != nil {
+			t.Errorf("%s %v: Unexpected error: %s", name, c.operands, err.Error())
+			continue
+		}
+
+		switch want := c.want.(type) {
+		case uint32:
+			got := popFloat(&f)
+			if float64(float32(got)) != got && !math.IsNaN(got) {
+				t.Errorf("%s %v: Expected a 32-bit float, got: %g", name, c.operands, got)
+			}
+			bits := math.Float32bits(float32(got))
+			if math.IsNaN(got) {
+				bits = 0x7FC00000 // Java's canonical NaN
+			}
+			if bits != want {
+				t.Errorf("%s %v %d: Expected float bits 0x%08X, got: 0x%08X (%g)",
+					name, c.operands, c.longIn, want, bits, got)
+			}
+		case int64:
+			var got int64
+			if c.op == opcodes.F2L || c.op == opcodes.D2L {
+				got = popLong(&f)
+			} else {
+				got = popInt(&f)
+			}
+			if got != want {
+				t.Errorf("%s %v: Expected %d, got: %d", name, c.operands, want, got)
+			}
+		}
+		if f.TOS != -1 {
+			t.Errorf("%s %v: Expected an empty operand stack, TOS is: %d", name, c.operands, f.TOS)
+		}
+
+		if want, ok := c.want.(uint32); ok && len(c.operands) == 2 {
+			lf := frames.CreateFrame(2)
+			lf.Meth = []byte{opcodes.FLOAD_0, opcodes.FLOAD_1, c.op, opcodes.FSTORE_2, opcodes.RETURN}
+			lf.Locals = []interface{}{c.operands[0], c.operands[1], float64(0)}
+			fs = frames.CreateFrameStack()
+			fs.PushFront(lf)
+			if err := runFrame(fs); err != nil {
+				t.Errorf("%s %v on locals: Unexpected error: %s", name, c.operands, err.Error())
+				continue
+			}
+			got := getLocal(lf, 2).(float64)
+			bits := math.Float32bits(float32(got))
+			if math.IsNaN(got) {
+				bits = 0x7FC00000
+			}
+			if bits != want {
+				t.Errorf("%s %v on locals: Expected float bits 0x%08X, got: 0x%08X (%g)",
+					name, c.operands, want, bits, got)
+			}
+		}
+	}
+}
+
+// FASTORE and PUTSTATIC store floats rounded to 32 bits
+func TestFloatStoresRoundTo32Bits(t *testing.T) {
+	globals.InitGlobals("test")
+	log.Init()
+
+	o := object.Make1DimArray(object.FLOAT, 2)
+	f := newFrame(opcodes.FASTORE)
+	push(&f, o)
+	push(&f, int64(1))
+	push(&f, 0.1) // the double 0.1, which isn't a float
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f)
+	if err := runFrame(fs); err != nil {
+		t.Fatalf("FASTORE: Unexpected error: %s", err.Error())
+	}
+	array := *(o.Fields[0].Fvalue).(*[]float64)
+	if array[1] != float64(float32(0.1)) {
+		t.Errorf("FASTORE: Expected 0.10000000149011612, got: %.17f", array[1])
+	}
+
+	if r := toFloat32(1e39); !math.IsInf(r, 1) {
+		t.Errorf("toFloat32: Expected Infinity, got: %g", r)
+	}
+	if r := toFloat32(math.Copysign(1e-60, -1)); r != 0 || !math.Signbit(r) {
+		t.Errorf("toFloat32: Expected -0.0, got: %g", r)
+	}
+}
+
+// monitorSetup adds to the method area the classes of the exceptions thrown by
+// monitors, and the class of the synchronized methods that syncMethodFrame() creates
+func monitorSetup() {
+	globals.InitGlobals("test")
+	log.Init()
+	classloader.InitMethodArea()
+	for class, superclass := range map[string]string{
+		"java/lang/Throwable":                    "java/lang/Object",
+		"java/lang/Exception":                    "java/lang/Throwable",
+		"java/lang/RuntimeException":             "java/lang/Exception",
+		"java/lang/IllegalMonitorStateException": "java/lang/RuntimeException",
+		"test/SyncException":                     "java/lang/RuntimeException",
+		"test/Sync":                              "java/lang/Object",
+	} {
+		classloader.MethAreaInsert(class, &(classloader.Klass{
+			Status: 'X', Loader: "bootstrap",
+			Data: &classloader.ClData{Name: class, Superclass: superclass}}))
+	}
+}
+
+// syncMethodFrame returns the frame of a synchronized method of test/Sync with the code
+// code, called on obj (or if obj is nil, a static method) by the method in frame caller
+func syncMethodFrame(t *testing.T, obj *object.Object, code []byte, caller *frames.Frame) *frames.Frame {
+	m := classloader.JmEntry{AccessFlags: 0x0021, MaxStack: 2, MaxLocals: 2, Code: code} // public synchronized
+	if obj == nil {
+		m.AccessFlags |= 0x0008 // static
+	} else {
+		push(caller, obj)
+	}
+	fram, err := createAndInitNewFrame("test/Sync", "sync", "()V", &m, obj != nil, caller)
+	if err != nil {
+		t.Fatalf("Synchronized method: Unexpected error creating frame: %s", err.Error())
+	}
+	return fram
+}
+
+// A synchronized method holds the monitor of the object it's called on while it runs
+func TestSynchronizedMethod(t *testing.T) {
+	monitorSetup()
+	obj := object.MakeEmptyObject()
+	caller := newFrame(opcodes.RETURN)
+
+	// the method exits the monitor and enters it again, which works only if it's held
+	fram := syncMethodFrame(t, obj, []byte{
+		opcodes.ALOAD_0, opcodes.MONITOREXIT, opcodes.ALOAD_0, opcodes.MONITORENTER, opcodes.RETURN,
+	}, &caller)
+	if !object.HoldsMonitor(obj, fram.Thread) {
+		t.Errorf("Synchronized method: Expected the monitor to be held when the method is called")
+	}
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&caller)
+	fs.PushFront(fram)
+	if err := runFrame(fs); err != nil {
+		t.Fatalf("Synchronized method: Unexpected error: %s", err.Error())
+	}
+	if object.HoldsMonitor(obj, fram.Thread) {
+		t.Errorf("Synchronized method: Expected the monitor to be released when the method returns")
+	}
+}
+
+// A static synchronized method holds the monitor of its class while it runs
+func TestSynchronizedStaticMethod(t *testing.T) {
+	monitorSetup()
+	caller := newFrame(opcodes.RETURN)
+	fram := syncMethodFrame(t, nil, []byte{opcodes.RETURN}, &caller)
+	class := classloader.MethAreaFetch("test/Sync")
+	if !object.HoldsMonitor(class, fram.Thread) {
+		t.Errorf("Synchronized method: Expected the class's monitor to be held when the method is called")
+	}
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&caller)
+	fs.PushFront(fram)
+	if err := runFrame(fs); err != nil {
+		t.Fatalf("Synchronized method: Unexpected error: %s", err.Error())
+	}
+	if object.HoldsMonitor(class, fram.Thread) {
+		t.Errorf("Synchronized method: Expected the class's monitor to be released when the method returns")
+	}
+}
+
+// A synchronized method that exits by an exception releases its monitor
+func TestSynchronizedMethodExitsByException(t *testing.T) {
+	monitorSetup()
+	obj := object.MakeEmptyObject()
+	exc := object.MakeEmptyObject()
+	excClass := "test/SyncException"
+	exc.Klass = &excClass
+
+	// the caller catches every exception thrown in the invoke instruction at PC 0
+	caller := newFrame(opcodes.NOP)
+	caller.Meth = append(caller.Meth, opcodes.NOP, opcodes.NOP, opcodes.POP, opcodes.RETURN)
+	caller.PC = 3 // past the invoke instruction
+	caller.ClName, caller.MethName, caller.MethType = "test/Sync", "main", "()V"
+	caller.CP = &classloader.CPool{}
+	classloader.MTable["test/Sync.main()V"] = classloader.MTentry{
+		MType: 'J',
+		Meth: classloader.JmEntry{Cp: caller.CP.(*classloader.CPool),
+			Exceptions: []classloader.CodeException{{StartPc: 0, EndPc: 3, HandlerPc: 3, CatchType: 0}}},
+	}
+	defer delete(classloader.MTable, "test/Sync.main()V")
+
+	fram := syncMethodFrame(t, obj, []byte{opcodes.ALOAD_1, opcodes.ATHROW}, &caller)
+	fram.Locals[1] = exc
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&caller)
+	fs.PushFront(fram)
+	if err := runFrame(fs); err != nil {
+		t.Fatalf("Synchronized method: Expected the exception to be caught, got: %s", err.Error())
+	}
+	if fs.Len() != 1 {
+		t.Errorf("Synchronized method: Expected only the catching frame on the frame stack, got %d frames", fs.Len())
+	}
+	if object.HoldsMonitor(obj, fram.Thread) {
+		t.Errorf("Synchronized method: Expected the monitor to be released when the exception exits the method")
+	}
+}
+
+// A synchronized method that returns when its thread no longer holds its monitor
+// throws an IllegalMonitorStateException
+func TestSynchronizedMethodUnbalancedExit(t *testing.T) {
+	monitorSetup()
+	obj := object.MakeEmptyObject()
+	caller := newFrame(opcodes.RETURN)
+	fram := syncMethodFrame(t, obj, []byte{opcodes.ALOAD_0, opcodes.MONITOREXIT, opcodes.RETURN}, &caller)
+
+	normalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&caller)
+	fs.PushFront(fram)
+	err := runFrame(fs)
+
+	_ = w.Close()
+	os.Stderr = normalStderr
+	_, _ = io.ReadAll(r)
+
+	if err == nil || !strings.Contains(err.Error(), "java/lang/IllegalMonitorStateException") {
+		t.Errorf("Synchronized method: Expected an uncaught IllegalMonitorStateException, got: %v", err)
+	}
+	if object.HoldsMonitor(obj, fram.Thread) {
+		t.Errorf("Synchronized method: Expected the monitor not to be held")
+	}
+}
+
+// threadSetup places the golang methods of java.lang.Thread and java.lang.Object in the
+// MTable, along with test/Task.run(), which calls runTask with the frame stack it's called on
+func threadSetup(runTask func(fs *list.List)) {
+	globals.InitGlobals("test")
+	log.Init()
+	classloader.InitMethodArea()
+	for class, superclass := range map[string]string{
+		"java/lang/Thread":                       "java/lang/Object",
+		"test/Task":                              "java/lang/Object",
+		"java/lang/Throwable":                    "java/lang/Object",
+		"java/lang/Exception":                    "java/lang/Throwable",
+		"java/lang/InterruptedException":         "java/lang/Exception",
+		"java/lang/RuntimeException":             "java/lang/Exception",
+		"java/lang/IllegalArgumentException":     "java/lang/RuntimeException",
+		"java/lang/IllegalMonitorStateException": "java/lang/RuntimeException",
+	} {
+		classloader.MethAreaInsert(class, &(classloader.Klass{
+			Status: 'X', Loader: "bootstrap",
+			Data: &classloader.ClData{Name: class, Superclass: superclass}}))
+	}
+	MainThread = thread.CreateThread()
+	MainThread.Stack = frames.CreateFrameStack()
+	MainThread.AddThreadToTable(globals.GetGlobalRef())
+
+	loadThreadMethods()
+	classloader.MTable["test/Task.run()V"] = classloader.MTentry{
+		MType: 'G',
+		Meth: classloader.GMeth{ObjectRef: true, NeedsContext: true, GFunction: func(params []interface{}) interface{} {
+			runTask(params[1].(*list.List))
+			return nil
+		}},
+	}
+}
+
+// callThreadMethod calls the golang method of java.lang.Thread with the signature sig
+// with the arguments args, from the thread whose frame stack is fs
+func callThreadMethod(t *testing.T, fs *list.List, sig string, args ...interface{}) interface{} {
+	return callGMethod(t, fs, "java/lang/Thread."+sig, args...)
+}
+
+// callGMethod calls the golang method methFQN with the arguments args, from the thread
+// whose frame stack is fs
+func callGMethod(t *testing.T, fs *list.List, methFQN string, args ...interface{}) interface{} {
+	mte, ok := classloader.MTableFetch(methFQN)
+	if !ok {
+		t.Fatalf("Thread: Expected %s in the MTable", methFQN)
+	}
+	gmeth := mte.Meth.(classloader.GMeth)
+	if gmeth.NeedsContext {
+		args = append(args, fs)
+	}
+	return gmeth.GFunction(args)
+}
+
+// newThreadObject creates a Thread object and runs its constructor with args
+func newThreadObject(t *testing.T, fs *list.List, sig string, args ...interface{}) *object.Object {
+	thr, err := InstantiateClass("java/lang/Thread", frames.CreateFrameStack())
+	if err != nil {
+		t.Fatalf("Thread: Unexpected error instantiating a Thread: %s", err.Error())
+	}
+	callThreadMethod(t, fs, sig, append([]interface{}{thr}, args...)...)
+	return thr
+}
+
+// mainThreadStack returns a frame stack of the main thread
+func mainThreadStack() *list.List {
+	f := newFrame(opcodes.RETURN)
+	f.Thread = MainThread.ID
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f)
+	return fs
+}
+
+// Thread.start() runs the Runnable's run() method on a new thread, which is alive until
+// run() returns. Thread.join() waits for that.
+func TestThreadStartAndJoin(t *testing.T) {
+	release := make(chan bool)
+	ran := make(chan *list.List, 1)
+	threadSetup(func(fs *list.List) {
+		ran <- fs
+		<-release
+	})
+	fs := mainThreadStack()
+	task := object.MakeEmptyObject()
+	taskClass := "test/Task"
+	task.Klass = &taskClass
+
+	thr := newThreadObject(t, fs, "<init>(Ljava/lang/Runnable;)V", task)
+	if callThreadMethod(t, fs, "isAlive()Z", thr) != types.JavaBoolFalse {
+		t.Errorf("Thread: Expected a thread that's not started not to be alive")
+	}
+	callThreadMethod(t, fs, "start()V", thr)
+
+	var runStack *list.List
+	select {
+	case runStack = <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Thread: Expected the Runnable's run() to be called")
+	}
+	runThreadID := runStack.Front().Value.(*frames.Frame).Thread
+	if isMainThread(runThreadID) {
+		t.Errorf("Thread: Expected run() to be called on a new thread, got thread %d", runThreadID)
+	}
+	if callThreadMethod(t, runStack, "currentThread()Ljava/lang/Thread;") != thr {
+		t.Errorf("Thread: Expected Thread.currentThread() to return the running Thread object")
+	}
+	if callThreadMethod(t, fs, "isAlive()Z", thr) != types.JavaBoolTrue {
+		t.Errorf("Thread: Expected a running thread to be alive")
+	}
+
+	// join(long) gives up when the thread doesn't end in time
+	callThreadMethod(t, fs, "join(J)V", thr, int64(10), int64(10))
+	close(release)
+	callThreadMethod(t, fs, "join()V", thr)
+	if callThreadMethod(t, fs, "isAlive()Z", thr) != types.JavaBoolFalse {
+		t.Errorf("Thread: Expected a thread not to be alive after it's joined")
+	}
+	if _, ok := callThreadMethod(t, fs, "start()V", thr).(error); !ok {
+		t.Errorf("Thread: Expected a thread to be started only once")
+	}
+}
+
+// Threads are named Thread-0, Thread-1, etc., unless they're given a name. The main
+// thread is named main.
+func TestThreadNames(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+	threadInitNumber = 0
+	fs := mainThreadStack()
+
+	named := newThreadObject(t, fs, "<init>(Ljava/lang/String;)V", object.NewStringFromGoString("worker"))
+	unnamed := newThreadObject(t, fs, "<init>()V")
+	main := callThreadMethod(t, fs, "currentThread()Ljava/lang/Thread;")
+
+	for _, test := range []struct {
+		thr  interface{}
+		name string
+	}{{named, "worker"}, {unnamed, "Thread-0"}, {main, "main"}} {
+		name, _ := objectToString(callThreadMethod(t, fs, "getName()Ljava/lang/String;", test.thr).(*object.Object), nil)
+		if name != test.name {
+			t.Errorf("Thread: Expected the name %s, got: %s", test.name, name)
+		}
+	}
+
+	callThreadMethod(t, fs, "setName(Ljava/lang/String;)V", unnamed, object.NewStringFromGoString("renamed"))
+	name, _ := objectToString(callThreadMethod(t, fs, "getName()Ljava/lang/String;", unnamed).(*object.Object), nil)
+	if name != "renamed" {
+		t.Errorf("Thread: Expected the name renamed after setName(), got: %s", name)
+	}
+	if callThreadMethod(t, fs, "currentThread()Ljava/lang/Thread;") != main {
+		t.Errorf("Thread: Expected currentThread() to return the same main Thread object every time")
+	}
+}
+
+// Thread.sleep() suspends the calling thread for at least the given time
+func TestThreadSleep(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+	fs := mainThreadStack()
+
+	start := time.Now()
+	if ret := callThreadMethod(t, fs, "sleep(J)V", int64(20), int64(20)); ret != nil {
+		t.Fatalf("Thread: Unexpected error from sleep(): %v", ret)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Thread: Expected sleep(20) to take at least 20ms, took %v", elapsed)
+	}
+	if _, ok := callThreadMethod(t, fs, "sleep(J)V", int64(-1), int64(-1)).(error); !ok {
+		t.Errorf("Thread: Expected sleep() with a negative timeout to fail")
+	}
+}
+
+// waitForThreads() waits for the non-daemon threads to end, but not for daemon threads
+func TestWaitForNonDaemonThreads(t *testing.T) {
+	release := make(chan bool)
+	threadSetup(func(fs *list.List) { <-release })
+	fs := mainThreadStack()
+	task := object.MakeEmptyObject()
+	taskClass := "test/Task"
+	task.Klass = &taskClass
+
+	daemon := newThreadObject(t, fs, "<init>(Ljava/lang/Runnable;)V", task)
+	callThreadMethod(t, fs, "setDaemon(Z)V", daemon, types.JavaBoolTrue)
+	callThreadMethod(t, fs, "start()V", daemon)
+	if _, ok := callThreadMethod(t, fs, "setDaemon(Z)V", daemon, types.JavaBoolFalse).(error); !ok {
+		t.Errorf("Thread: Expected setDaemon() on a started thread to fail")
+	}
+
+	waited := make(chan bool)
+	go func() { waitForThreads(); waited <- true }()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Thread: Expected waitForThreads() not to wait for a daemon thread")
+	}
+
+	worker := newThreadObject(t, fs, "<init>(Ljava/lang/Runnable;)V", task)
+	callThreadMethod(t, fs, "start()V", worker)
+	go func() { waitForThreads(); waited <- true }()
+	select {
+	case <-waited:
+		t.Fatalf("Thread: Expected waitForThreads() to wait for a non-daemon thread")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Thread: Expected waitForThreads() to return once the non-daemon thread ended")
+	}
+	callThreadMethod(t, fs, "join()V", daemon)
+}
+
+// Tracing is set for each thread
+func TestTracingIsPerThread(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+	tracedThread := thread.CreateThread()
+	tracedThread.Trace = true
+	tracedThread.AddThreadToTable(globals.GetGlobalRef())
+	untracedThread := thread.CreateThread()
+	untracedThread.AddThreadToTable(globals.GetGlobalRef())
+	threadTracing.Store(true)
+	defer threadTracing.Store(false)
+
+	f := newFrame(opcodes.RETURN)
+	f.Thread = tracedThread.ID
+	if !traced(&f) {
+		t.Errorf("Thread: Expected the frame of a traced thread to be traced")
+	}
+	f.Thread = untracedThread.ID
+	if traced(&f) {
+		t.Errorf("Thread: Expected the frame of an untraced thread not to be traced")
+	}
+	f.Thread = MainThread.ID
+	if traced(&f) {
+		t.Errorf("Thread: Expected the frame of the untraced main thread not to be traced")
+	}
+}
+
+// Thread.run() passes on an exception that the Runnable's run() throws, so that it's
+// thrown in the method that called Thread.run(), such as the run() of a subclass of
+// Thread that calls super.run() in a try block
+func TestThreadRunPassesOnTargetException(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+	fs := mainThreadStack()
+
+	// test/Task.run() throws a new RuntimeException
+	CP := classloader.CPool{}
+	CP.CpIndex = []classloader.CpEntry{{Type: 0}, {Type: classloader.UTF8, Slot: 0}, {Type: classloader.ClassRef, Slot: 0}}
+	CP.ClassRefs = append(CP.ClassRefs, 1)
+	CP.Utf8Refs = append(CP.Utf8Refs, "java/lang/RuntimeException")
+	classloader.MTable["test/Task.run()V"] = classloader.MTentry{MType: 'J',
+		Meth: classloader.JmEntry{MaxStack: 1, MaxLocals: 1, Cp: &CP,
+			Code: []byte{opcodes.NEW, 0x00, 0x02, opcodes.ATHROW}}}
+	classloader.MethAreaFetch("test/Task").Data.MethodTable = map[string]*classloader.Method{
+		"run()V": {AccessFlags: 0x0001}}
+	task := object.MakeEmptyObject()
+	taskClass := "test/Task"
+	task.Klass = &taskClass
+
+	normalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	thr := newThreadObject(t, fs, "<init>(Ljava/lang/Runnable;)V", task)
+	ret := callThreadMethod(t, fs, "run()V", thr)
+	_ = w.Close()
+	os.Stderr = normalStderr
+	out, _ := io.ReadAll(r)
+
+	exc, ok := ret.(*gException)
+	if !ok || exc.excObj == nil || *exc.excObj.Klass != "java/lang/RuntimeException" {
+		t.Fatalf("Thread: Expected run() to pass on the RuntimeException, got: %v", ret)
+	}
+	if strings.Contains(string(out), "Exception in thread") {
+		t.Errorf("Thread: Expected the exception not to be reported as uncaught, got: %s", string(out))
+	}
+
+	// a Runnable whose class can't be found has no run() to select
+	lostClass := "test/Lost"
+	task.Klass = &lostClass
+	ret = callThreadMethod(t, fs, "run()V", thr)
+	if exc, ok = ret.(*gException); !ok || exc.className != "java/lang/AbstractMethodError" {
+		t.Errorf("Thread: Expected run() to throw an AbstractMethodError, got: %v", ret)
+	}
+}
+
+// An uncaught exception is reported with the name of the thread it ends
+func TestUncaughtExceptionShowsThreadName(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+	fs := mainThreadStack()
+	thr := newThreadObject(t, fs, "<init>(Ljava/lang/String;)V", object.NewStringFromGoString("worker"))
+
+	worker := thread.CreateThread()
+	javaThreadsMutex.Lock()
+	threadObjects[worker.ID] = thr
+	javaThreadsMutex.Unlock()
+	defer func() {
+		javaThreadsMutex.Lock()
+		delete(threadObjects, worker.ID)
+		javaThreadsMutex.Unlock()
+	}()
+
+	f := newFrame(opcodes.ATHROW)
+	f.Thread = worker.ID
+	f.ClName = "test/Task"
+	f.MethName = "run"
+	workerStack := frames.CreateFrameStack()
+	workerStack.PushFront(&f)
+	exc := object.MakeEmptyObject()
+	excClass := "java/lang/RuntimeException"
+	exc.Klass = &excClass
+
+	normalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	reportUncaughtException(workerStack, exc, []*frames.Frame{&f})
+	_ = w.Close()
+	os.Stderr = normalStderr
+	out, _ := io.ReadAll(r)
+
+	if !strings.Contains(string(out), "Exception in thread \"worker\" java.lang.RuntimeException") {
+		t.Errorf("Thread: Expected the uncaught exception to name the thread, got: %s", string(out))
+	}
+}
+
+// isGException reports whether ret is a gException that throws an exception of class className
+func isGException(ret interface{}, className string) bool {
+	exc, ok := ret.(*gException)
+	return ok && exc.className == className
+}
+
+// A producer and a consumer, each on its own thread, exchange values through a queue
+// guarded by an object's monitor, using wait() and notifyAll()
+func TestObjectWaitAndNotifyAll(t *testing.T) {
+	const count = 100
+	lock := object.MakeEmptyObject()
+	var queue, received []int64
+
+	threadSetup(func(fs *list.List) { // the consumer
+		id := currentThreadID(fs)
+		for len(received) < count {
+			object.MonitorEnter(lock, id)
+			for len(queue) == 0 {
+				if ret := callGMethod(t, fs, "java/lang/Object.wait()V", lock); ret != nil {
+					t.Errorf("Object.wait(): Unexpected result: %v", ret)
+				}
+			}
+			received = append(received, queue[0])
+			queue = queue[1:]
+			callGMethod(t, fs, "java/lang/Object.notifyAll()V", lock)
+			object.MonitorExit(lock, id)
+		}
+	})
+	fs := mainThreadStack()
+	task := object.MakeEmptyObject()
+	taskClass := "test/Task"
+	task.Klass = &taskClass
+	consumer := newThreadObject(t, fs, "<init>(Ljava/lang/Runnable;)V", task)
+	callThreadMethod(t, fs, "start()V", consumer)
+
+	for i := int64(0); i < count; i++ { // the producer
+		object.MonitorEnter(lock, MainThread.ID)
+		for len(queue) >= 2 {
+			callGMethod(t, fs, "java/lang/Object.wait(J)V", lock, int64(1000), int64(1000))
+		}
+		queue = append(queue, i)
+		callGMethod(t, fs, "java/lang/Object.notifyAll()V", lock)
+		object.MonitorExit(lock, MainThread.ID)
+	}
+	callThreadMethod(t, fs, "join()V", consumer)
+
+	if len(received) != count {
+		t.Fatalf("Object.wait(): Expected %d values to be received, got %d", count, len(received))
+	}
+	for i, value := range received {
+		if value != int64(i) {
+			t.Fatalf("Object.wait(): Expected value %d to be %d, got %d", i, i, value)
+		}
+	}
+}
+
+// Object.wait(long) returns when its timeout elapses, holding the monitor again
+func TestObjectWaitTimesOut(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+	fs := mainThreadStack()
+	lock := object.MakeEmptyObject()
+
+	object.MonitorEnter(lock, MainThread.ID)
+	start := time.Now()
+	if ret := callGMethod(t, fs, "java/lang/Object.wait(JI)V", lock, int64(20), int64(20), int64(500)); ret != nil {
+		t.Fatalf("Object.wait(): Unexpected result: %v", ret)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Object.wait(): Expected wait(20, 500) to take at least 20ms, took %v", elapsed)
+	}
+	if !object.MonitorExit(lock, MainThread.ID) {
+		t.Errorf("Object.wait(): Expected the monitor to be held after the wait")
+	}
+
+	ret := callGMethod(t, fs, "java/lang/Object.wait(J)V", lock, int64(-1), int64(-1))
+	if !isGException(ret, "java/lang/IllegalArgumentException") {
+		t.Errorf("Object.wait(): Expected an IllegalArgumentException for a negative timeout, got: %v", ret)
+	}
+}
+
+// wait(), notify(), and notifyAll() throw IllegalMonitorStateException if the calling
+// thread doesn't hold the object's monitor
+func TestObjectWaitAndNotifyNotOwner(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+	fs := mainThreadStack()
+	lock := object.MakeEmptyObject()
+
+	for _, sig := range []string{"wait()V", "notify()V", "notifyAll()V"} {
+		ret := callGMethod(t, fs, "java/lang/Object."+sig, lock)
+		if !isGException(ret, "java/lang/IllegalMonitorStateException") {
+			t.Errorf("Object.%s: Expected an IllegalMonitorStateException, got: %v", sig, ret)
+		}
+	}
+}
+
+// Thread.interrupt() wakes a thread that's waiting, which throws InterruptedException
+// and has its interrupt status cleared
+func TestInterruptWakesWaitingThread(t *testing.T) {
+	lock := object.MakeEmptyObject()
+	result := make(chan interface{}, 1)
+	threadSetup(func(fs *list.List) {
+		id := currentThreadID(fs)
+		object.MonitorEnter(lock, id)
+		result <- callGMethod(t, fs, "java/lang/Object.wait()V", lock)
+		if !object.MonitorExit(lock, id) {
+			t.Errorf("Thread.interrupt(): Expected the interrupted thread to hold the monitor again")
+		}
+	})
+	fs := mainThreadStack()
+	task := object.MakeEmptyObject()
+	taskClass := "test/Task"
+	task.Klass = &taskClass
+	waiter := newThreadObject(t, fs, "<init>(Ljava/lang/Runnable;)V", task)
+	callThreadMethod(t, fs, "start()V", waiter)
+
+	callThreadMethod(t, fs, "interrupt()V", waiter)
+	select {
+	case ret := <-result:
+		if !isGException(ret, "java/lang/InterruptedException") {
+			t.Errorf("Thread.interrupt(): Expected wait() to throw InterruptedException, got: %v", ret)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Thread.interrupt(): Expected the waiting thread to be woken up")
+	}
+	callThreadMethod(t, fs, "join()V", waiter)
+	if callThreadMethod(t, fs, "isInterrupted()Z", waiter) != types.JavaBoolFalse {
+		t.Errorf("Thread.interrupt(): Expected the interrupt status to be cleared by the InterruptedException")
+	}
+}
+
+// A thread with a pending interrupt doesn't sleep, but throws InterruptedException;
+// Thread.interrupted() returns and clears the interrupt status
+func TestInterruptBeforeSleep(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+	fs := mainThreadStack()
+	main := callThreadMethod(t, fs, "currentThread()Ljava/lang/Thread;")
+
+	callThreadMethod(t, fs, "interrupt()V", main)
+	start := time.Now()
+	ret := callThreadMethod(t, fs, "sleep(J)V", int64(5000), int64(5000))
+	if !isGException(ret, "java/lang/InterruptedException") || time.Since(start) > time.Second {
+		t.Errorf("Thread.sleep(): Expected an interrupted thread to throw InterruptedException at once, got: %v", ret)
+	}
+
+	callThreadMethod(t, fs, "interrupt()V", main)
+	if callThreadMethod(t, fs, "interrupted()Z") != types.JavaBoolTrue {
+		t.Errorf("Thread.interrupted(): Expected true for an interrupted thread")
+	}
+	if callThreadMethod(t, fs, "interrupted()Z") != types.JavaBoolFalse {
+		t.Errorf("Thread.interrupted(): Expected the interrupt status to be cleared")
+	}
+}
+
+// An exception thrown by a golang method can be caught by the method that called it
+func TestGoMethodExceptionIsCaught(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+
+	CP := classloader.CPool{}
+	CP.CpIndex = []classloader.CpEntry{
+		{Type: 0, Slot: 0},
+		{Type: classloader.MethodRef, Slot: 0},   // [1] java/lang/Thread.sleep(J)V
+		{Type: classloader.ClassRef, Slot: 0},    // [2]
+		{Type: classloader.UTF8, Slot: 0},        // [3]
+		{Type: classloader.NameAndType, Slot: 0}, // [4]
+		{Type: classloader.UTF8, Slot: 1},        // [5]
+		{Type: classloader.UTF8, Slot: 2},        // [6]
+		{Type: classloader.ClassRef, Slot: 1},    // [7] java/lang/IllegalArgumentException
+		{Type: classloader.UTF8, Slot: 3},        // [8]
+	}
+	CP.MethodRefs = []classloader.MethodRefEntry{{ClassIndex: 2, NameAndType: 4}}
+	CP.ClassRefs = []uint16{3, 8}
+	CP.NameAndTypes = []classloader.NameAndTypeEntry{{NameIndex: 5, DescIndex: 6}}
+	CP.Utf8Refs = []string{"java/lang/Thread", "sleep", "(J)V", "java/lang/IllegalArgumentException"}
+
+	f := newFrame(opcodes.LCONST_1)
+	f.Meth = append(f.Meth, opcodes.LNEG, opcodes.INVOKESTATIC, 0x00, 0x01, opcodes.RETURN, // 0-5: sleep(-1)
+		opcodes.ICONST_1) // 6: the handler
+	f.ClName, f.MethName, f.MethType = "test/Caller", "main", "()V"
+	f.CP = &CP
+	classloader.MTable["test/Caller.main()V"] = classloader.MTentry{
+		MType: 'J',
+		Meth: classloader.JmEntry{Cp: &CP,
+			Exceptions: []classloader.CodeException{{StartPc: 0, EndPc: 5, HandlerPc: 6, CatchType: 7}}},
+	}
+	defer delete(classloader.MTable, "test/Caller.main()V")
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f)
+	if err := runFrame(fs); err != nil {
+		t.Fatalf("Go method exception: Expected the exception to be caught, got: %s", err.Error())
+	}
+	if f.TOS != 1 || pop(&f).(int64) != 1 {
+		t.Errorf("Go method exception: Expected the handler to run, with the exception beneath its result")
+	}
+	if exc, ok := pop(&f).(*object.Object); !ok || *exc.Klass != "java/lang/IllegalArgumentException" {
+		t.Errorf("Go method exception: Expected an IllegalArgumentException, got: %v", exc)
+	}
+}
+
+// isParked reports whether the thread of the Thread object thr is waiting in park()
+func isParked(thr *object.Object) bool {
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+	return getJavaThread(thr).parked
+}
+
+// Unsafe.park() blocks a thread until Unsafe.unpark() makes its permit available; a
+// permit made available beforehand is consumed by the next park() without blocking
+func TestParkAndUnpark(t *testing.T) {
+	parks := make(chan interface{}, 1)
+	threadSetup(func(fs *list.List) {
+		parks <- callGMethod(t, fs, "jdk/internal/misc/Unsafe.park(ZJ)V", object.Null, types.JavaBoolFalse, int64(0), int64(0))
+	})
+	fs := mainThreadStack()
+	task := object.MakeEmptyObject()
+	taskClass := "test/Task"
+	task.Klass = &taskClass
+	parker := newThreadObject(t, fs, "<init>(Ljava/lang/Runnable;)V", task)
+	callThreadMethod(t, fs, "start()V", parker)
+
+	for !isParked(parker) {
+		time.Sleep(time.Millisecond)
+	}
+	callGMethod(t, fs, "jdk/internal/misc/Unsafe.unpark(Ljava/lang/Object;)V", object.Null, parker)
+	select {
+	case ret := <-parks:
+		if ret != nil {
+			t.Errorf("Unsafe.park(): Unexpected result: %v", ret)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Unsafe.unpark(): Expected the parked thread to be woken up")
+	}
+	callThreadMethod(t, fs, "join()V", parker)
+
+	main := callThreadMethod(t, fs, "currentThread()Ljava/lang/Thread;")
+	callGMethod(t, fs, "jdk/internal/misc/Unsafe.unpark(Ljava/lang/Object;)V", object.Null, main)
+	start := time.Now()
+	callGMethod(t, fs, "jdk/internal/misc/Unsafe.park(ZJ)V", object.Null, types.JavaBoolFalse, int64(0), int64(0))
+	if time.Since(start) > time.Second {
+		t.Errorf("Unsafe.park(): Expected a thread whose permit is available not to block")
+	}
+}
+
+// Unsafe.park() returns once its timeout elapses, or at once if its deadline has passed
+func TestParkTimesOut(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+	fs := mainThreadStack()
+
+	start := time.Now()
+	timeout := int64(20 * time.Millisecond)
+	callGMethod(t, fs, "jdk/internal/misc/Unsafe.park(ZJ)V", object.Null, types.JavaBoolFalse, timeout, timeout)
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("Unsafe.park(): Expected to be parked for 20ms, was parked for %v", elapsed)
+	}
+
+	start = time.Now()
+	deadline := time.Now().Add(-time.Second).UnixMilli()
+	callGMethod(t, fs, "jdk/internal/misc/Unsafe.park(ZJ)V", object.Null, types.JavaBoolTrue, deadline, deadline)
+	if time.Since(start) > time.Second {
+		t.Errorf("Unsafe.park(): Expected a deadline that has passed not to block")
 	}
 }
 
-// PUTFIELD: Error: attempt to update a non-static field
-func TestPutFieldErrorUpdatingStatic(t *testing.T) {
-	f := newFrame(opcodes.PUTFIELD)
-	f.Meth = append(f.Meth, 0x00)
-	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
+// An interrupted thread returns from Unsafe.park() without an exception, and its
+// interrupt status remains set
+func TestInterruptWakesParkedThread(t *testing.T) {
+	parks := make(chan interface{}, 1)
+	threadSetup(func(fs *list.List) {
+		parks <- callGMethod(t, fs, "jdk/internal/misc/Unsafe.park(ZJ)V", object.Null, types.JavaBoolFalse, int64(0), int64(0))
+	})
+	fs := mainThreadStack()
+	task := object.MakeEmptyObject()
+	taskClass := "test/Task"
+	task.Klass = &taskClass
+	parker := newThreadObject(t, fs, "<init>(Ljava/lang/Runnable;)V", task)
+	callThreadMethod(t, fs, "start()V", parker)
+
+	for !isParked(parker) {
+		time.Sleep(time.Millisecond)
+	}
+	callThreadMethod(t, fs, "interrupt()V", parker)
+	select {
+	case ret := <-parks:
+		if ret != nil {
+			t.Errorf("Unsafe.park(): Expected an interrupted park() to return normally, got: %v", ret)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Thread.interrupt(): Expected the parked thread to be woken up")
+	}
+	callThreadMethod(t, fs, "join()V", parker)
+	if callThreadMethod(t, fs, "isInterrupted()Z", parker) != types.JavaBoolTrue {
+		t.Errorf("Unsafe.park(): Expected the interrupt status to remain set")
+	}
+}
+
+// fieldAccessFrame returns a frame that executes the GETFIELD or PUTFIELD opcode on
+// the field "value" of an object, which is looked up by name
+func fieldAccessFrame(opcode byte) frames.Frame {
+	f := newFrame(opcode)
+	f.Meth = append(f.Meth, 0x00, 0x01)
 
 	CP := classloader.CPool{}
-	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
-	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
-	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.FieldRef, Slot: 0}
-	// now create the pointed-to FieldRef
-	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
-	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
+	CP.CpIndex = []classloader.CpEntry{
+		{Type: 0, Slot: 0},
+		{Type: classloader.FieldRef, Slot: 0},    // [1]
+		{Type: classloader.NameAndType, Slot: 0}, // [2]
+		{Type: classloader.UTF8, Slot: 0},        // [3] the field name
+	}
+	CP.FieldRefs = []classloader.FieldRefEntry{{ClassIndex: 0, NameAndType: 2}}
+	CP.NameAndTypes = []classloader.NameAndTypeEntry{{NameIndex: 3, DescIndex: 0}}
+	CP.Utf8Refs = []string{"value"}
 	f.CP = &CP
+	return f
+}
 
-	// now create the object we're updating, with one int field
+// Threads that read and write the same field, including a long, don't race (run with
+// -race), and each read sees one of the values written
+func TestFieldAccessFromThreads(t *testing.T) {
 	obj := object.MakeEmptyObject()
-	obj.Fields = make([]object.Field, 1, 1)
-	obj.Fields[0].Fvalue = int64(42) // set the field = 42
-	obj.Fields[0].Ftype = types.Static + types.Int
-	push(&f, obj)
-
-	push(&f, int64(26)) // update the field to 26
+	obj.FieldTable["value"] = &object.Field{Ftype: types.Long, Fvalue: int64(0)}
+
+	var wg sync.WaitGroup
+	for i := int64(1); i <= 4; i++ {
+		wg.Add(1)
+		go func(value int64) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				put := fieldAccessFrame(opcodes.PUTFIELD)
+				push(&put, obj)
+				push(&put, value)
+				push(&put, value)
+				fs := frames.CreateFrameStack()
+				fs.PushFront(&put)
+				if err := runFrame(fs); err != nil {
+					t.Errorf("PUTFIELD: Unexpected error: %s", err.Error())
+					return
+				}
+
+				get := fieldAccessFrame(opcodes.GETFIELD)
+				push(&get, obj)
+				fs = frames.CreateFrameStack()
+				fs.PushFront(&get)
+				if err := runFrame(fs); err != nil {
+					t.Errorf("GETFIELD: Unexpected error: %s", err.Error())
+					return
+				}
+				if v := pop(&get).(int64); v < 1 || v > 4 {
+					t.Errorf("GETFIELD: Expected one of the values written, got %d", v)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
 
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	err := runFrame(fs)
+// newTask returns a test/Task object, whose run() method calls the function passed to
+// threadSetup()
+func newTask() *object.Object {
+	task := object.MakeEmptyObject()
+	taskClass := "test/Task"
+	task.Klass = &taskClass
+	return task
+}
 
-	if err == nil {
-		t.Errorf("PUTFIELD: Expected error message but got none")
+// Virtual threads are cheap enough to start by the thousand; they're daemon threads
+// and have no name
+func TestVirtualThreads(t *testing.T) {
+	var ran atomic.Int64
+	threadSetup(func(fs *list.List) { ran.Add(1) })
+	fs := mainThreadStack()
+	task := newTask()
+
+	const count = 10000
+	threads := make([]*object.Object, count)
+	for i := range threads {
+		thr, ok := callThreadMethod(t, fs, "startVirtualThread(Ljava/lang/Runnable;)Ljava/lang/Thread;", task).(*object.Object)
+		if !ok {
+			t.Fatalf("Thread.startVirtualThread(): Expected a Thread")
+		}
+		threads[i] = thr
+	}
+	for _, thr := range threads {
+		callThreadMethod(t, fs, "join()V", thr)
+	}
+	if ran.Load() != count {
+		t.Errorf("Thread.startVirtualThread(): Expected %d tasks to run, %d did", count, ran.Load())
 	}
 
-	errMsg := err.Error()
-	if !strings.Contains(errMsg, "invalid attempt to update a static variable") {
-		t.Errorf("PUTFIELD: Did not get expected error message, got %s", errMsg)
+	thr := threads[0]
+	if *thr.Klass != "java/lang/VirtualThread" ||
+		callThreadMethod(t, fs, "isVirtual()Z", thr) != types.JavaBoolTrue ||
+		callThreadMethod(t, fs, "isDaemon()Z", thr) != types.JavaBoolTrue {
+		t.Errorf("Thread.startVirtualThread(): Expected a virtual daemon thread")
+	}
+	if name, _ := objectToString(callThreadMethod(t, fs, "getName()Ljava/lang/String;", thr).(*object.Object), nil); name != "" {
+		t.Errorf("Thread.startVirtualThread(): Expected a virtual thread to have no name")
+	}
+	main := callThreadMethod(t, fs, "currentThread()Ljava/lang/Thread;")
+	if callThreadMethod(t, fs, "isVirtual()Z", main) != types.JavaBoolFalse {
+		t.Errorf("Thread.isVirtual(): Expected the main thread not to be virtual")
+	}
+	if !isGException(callThreadMethod(t, fs, "setDaemon(Z)V", thr, types.JavaBoolFalse), "java/lang/IllegalArgumentException") {
+		t.Errorf("Thread.setDaemon(): Expected a virtual thread not to be made a non-daemon thread")
 	}
 }
 
-// PUTSTATIC: Update a static field -- invalid b/c does not point to a field ref in the CP
-func TestPutStaticInvalid(t *testing.T) {
-	f := newFrame(opcodes.PUTSTATIC)
-	f.Meth = append(f.Meth, 0x00)
-	f.Meth = append(f.Meth, 0x01) // Go to slot 0x0001 in the CP
+// the state of a thread is removed from the thread tables when it ends, so that they
+// don't grow with every thread started; what's left of it is kept in the Thread object
+func TestEndedThreadsAreRemoved(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+	fs := mainThreadStack()
+	task := newTask()
+	javaThreadsMutex.Lock()
+	before, runningBefore := len(javaThreads), len(threadObjects)
+	javaThreadsMutex.Unlock()
 
-	CP := classloader.CPool{}
-	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
-	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
-	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.ClassRef, Slot: 0} // should be a field ref
-	// now create the pointed-to FieldRef
-	CP.FieldRefs = make([]classloader.FieldRefEntry, 1, 1)
-	CP.FieldRefs[0] = classloader.FieldRefEntry{ClassIndex: 0, NameAndType: 0}
-	f.CP = &CP
+	const count = 1000
+	threads := make([]*object.Object, count)
+	for i := range threads {
+		threads[i] = callThreadMethod(t, fs, "startVirtualThread(Ljava/lang/Runnable;)Ljava/lang/Thread;", task).(*object.Object)
+	}
+	for _, thr := range threads {
+		callThreadMethod(t, fs, "join()V", thr)
+	}
 
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	err := runFrame(fs)
+	javaThreadsMutex.Lock()
+	after, running := len(javaThreads), len(threadObjects)
+	javaThreadsMutex.Unlock()
+	if after != before || running != runningBefore {
+		t.Errorf("Thread end: Expected %d Thread objects and %d running threads, got %d and %d",
+			before, runningBefore, after, running)
+	}
 
-	if err == nil {
-		t.Errorf("PUTSTATIC: Expected error but did not get one.")
-	} else {
-		errMsg := err.Error()
-		if !strings.Contains(errMsg, "Expected a field ref, but got") {
-			t.Errorf("PUTSTATIC: Did not get expected error message, got: %s", errMsg)
-		}
+	thr := threads[0]
+	if callThreadMethod(t, fs, "isAlive()Z", thr) != types.JavaBoolFalse ||
+		callThreadMethod(t, fs, "isVirtual()Z", thr) != types.JavaBoolTrue {
+		t.Errorf("Thread end: Expected an ended virtual thread not to be alive")
+	}
+	if !isGException(callThreadMethod(t, fs, "start()V", thr), "java/lang/IllegalThreadStateException") {
+		t.Errorf("Thread.start(): Expected an ended thread not to be started again")
+	}
+	callThreadMethod(t, fs, "setName(Ljava/lang/String;)V", thr, object.NewStringFromGoString("ended"))
+	if name, _ := objectToString(callThreadMethod(t, fs, "getName()Ljava/lang/String;", thr).(*object.Object), nil); name != "ended" {
+		t.Errorf("Thread.setName(): Expected an ended thread to be renamed, got %s", name)
+	}
+	javaThreadsMutex.Lock()
+	if len(javaThreads) != before {
+		t.Errorf("Thread end: Expected the methods of an ended thread not to add it to the thread table")
 	}
+	javaThreadsMutex.Unlock()
 }
 
-// RETURN: Does a function return correctly?
-func TestReturn(t *testing.T) {
-	f := newFrame(opcodes.RETURN)
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	ret := runFrame(fs)
-	if f.TOS != -1 {
-		t.Errorf("Top of stack, expected -1, got: %d", f.TOS)
+// the threads created by a builder, and by its factory, are numbered if the builder
+// is given a counter
+func TestVirtualThreadBuilder(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+	fs := mainThreadStack()
+	task := newTask()
+	builderClass := "java/lang/ThreadBuilders$VirtualThreadBuilder."
+
+	builder := callThreadMethod(t, fs, "ofVirtual()Ljava/lang/Thread$Builder$OfVirtual;")
+	prefix := "worker-"
+	callGMethod(t, fs, builderClass+"name(Ljava/lang/String;J)Ljava/lang/Thread$Builder$OfVirtual;",
+		builder, object.CreateCompactStringFromGoString(&prefix), int64(1), int64(1))
+	first := callGMethod(t, fs, builderClass+"unstarted(Ljava/lang/Runnable;)Ljava/lang/Thread;", builder, task)
+	second := callGMethod(t, fs, builderClass+"start(Ljava/lang/Runnable;)Ljava/lang/Thread;", builder, task)
+	factory := callGMethod(t, fs, builderClass+"factory()Ljava/util/concurrent/ThreadFactory;", builder)
+	third := callGMethod(t, fs, "java/lang/ThreadBuilders$VirtualThreadFactory.newThread(Ljava/lang/Runnable;)Ljava/lang/Thread;",
+		factory, task)
+
+	for i, thr := range []interface{}{first, second, third} {
+		expected := "worker-" + string(rune('1'+i))
+		name, _ := objectToString(callThreadMethod(t, fs, "getName()Ljava/lang/String;", thr).(*object.Object), nil)
+		if name != expected {
+			t.Errorf("Thread.Builder: Expected thread %d to be named %s, got %s", i, expected, name)
+		}
+	}
+	if callThreadMethod(t, fs, "isAlive()Z", first) != types.JavaBoolFalse {
+		t.Errorf("Thread.Builder.unstarted(): Expected the thread not to be started")
 	}
+	callThreadMethod(t, fs, "join()V", second)
+}
 
-	if ret != nil {
-		t.Error("RETURN: Expected popped value to be nil, got: " + ret.Error())
+// an executor runs each task on a virtual thread of its own; close() waits for them
+func TestVirtualThreadPerTaskExecutor(t *testing.T) {
+	var ran atomic.Int64
+	threadSetup(func(fs *list.List) { ran.Add(1) })
+	classloader.MethAreaInsert("test/Callable", &(classloader.Klass{
+		Status: 'X', Loader: "bootstrap",
+		Data: &classloader.ClData{Name: "test/Callable", Superclass: "java/lang/Object"}}))
+	answer := object.MakeEmptyObject()
+	classloader.MTable["test/Callable.call()Ljava/lang/Object;"] = classloader.MTentry{
+		MType: 'G',
+		Meth:  classloader.GMeth{ObjectRef: true, GFunction: func([]interface{}) interface{} { return answer }},
+	}
+	fs := mainThreadStack()
+	task := newTask()
+	callable := object.MakeEmptyObject()
+	callableClass := "test/Callable"
+	callable.Klass = &callableClass
+	executorClass := "java/util/concurrent/ThreadPerTaskExecutor."
+	futureClass := "java/util/concurrent/ThreadPerTaskExecutor$ThreadBoundFuture."
+
+	executor := callGMethod(t, fs, "java/util/concurrent/Executors.newVirtualThreadPerTaskExecutor()Ljava/util/concurrent/ExecutorService;")
+	const count = 100
+	for i := 0; i < count; i++ {
+		callGMethod(t, fs, executorClass+"execute(Ljava/lang/Runnable;)V", executor, task)
+	}
+	result := object.MakeEmptyObject()
+	runnableFuture := callGMethod(t, fs, executorClass+"submit(Ljava/lang/Runnable;Ljava/lang/Object;)Ljava/util/concurrent/Future;",
+		executor, task, result)
+	callableFuture := callGMethod(t, fs, executorClass+"submit(Ljava/util/concurrent/Callable;)Ljava/util/concurrent/Future;",
+		executor, callable)
+
+	if ret := callGMethod(t, fs, futureClass+"get()Ljava/lang/Object;", runnableFuture); ret != result {
+		t.Errorf("Future.get(): Expected the result passed to submit(), got %v", ret)
+	}
+	if ret := callGMethod(t, fs, futureClass+"get()Ljava/lang/Object;", callableFuture); ret != answer {
+		t.Errorf("Future.get(): Expected the result of call(), got %v", ret)
+	}
+	if callGMethod(t, fs, futureClass+"isDone()Z", callableFuture) != types.JavaBoolTrue {
+		t.Errorf("Future.isDone(): Expected the task to be done")
+	}
+
+	callGMethod(t, fs, executorClass+"close()V", executor)
+	if ran.Load() != count+1 {
+		t.Errorf("ExecutorService.close(): Expected %d tasks to have run, %d did", count+1, ran.Load())
+	}
+	if callGMethod(t, fs, executorClass+"isTerminated()Z", executor) != types.JavaBoolTrue {
+		t.Errorf("ExecutorService.close(): Expected the executor to be terminated")
+	}
+	ret := callGMethod(t, fs, executorClass+"execute(Ljava/lang/Runnable;)V", executor, task)
+	if !isGException(ret, "java/util/concurrent/RejectedExecutionException") {
+		t.Errorf("ExecutorService.execute(): Expected a task to be rejected after shutdown, got %v", ret)
 	}
 }
 
-// SIPUSH: create int from next two bytes and push the int
-func TestSipush(t *testing.T) {
-	f := newFrame(opcodes.SIPUSH)
-	f.Meth = append(f.Meth, 0x01)
-	f.Meth = append(f.Meth, 0x02)
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-	if f.TOS != 0 {
-		t.Errorf("BIPUSH: Top of stack, expected 0, got: %d", f.TOS)
+// Future.get() throws an ExecutionException whose cause is the exception the task threw,
+// which is not reported as uncaught
+func TestFutureGetOfFailedTask(t *testing.T) {
+	threadSetup(func(fs *list.List) {})
+	classloader.MethAreaInsert("java/util/concurrent/ExecutionException", &(classloader.Klass{
+		Status: 'X', Loader: "bootstrap",
+		Data: &classloader.ClData{Name: "java/util/concurrent/ExecutionException", Superclass: "java/lang/Exception"}}))
+
+	// test/Task.call() throws a new RuntimeException
+	CP := classloader.CPool{}
+	CP.CpIndex = []classloader.CpEntry{{Type: 0}, {Type: classloader.UTF8, Slot: 0}, {Type: classloader.ClassRef, Slot: 0}}
+	CP.ClassRefs = append(CP.ClassRefs, 1)
+	CP.Utf8Refs = append(CP.Utf8Refs, "java/lang/RuntimeException")
+	classloader.MTable["test/Task.call()Ljava/lang/Object;"] = classloader.MTentry{MType: 'J',
+		Meth: classloader.JmEntry{MaxStack: 1, MaxLocals: 1, Cp: &CP,
+			Code: []byte{opcodes.NEW, 0x00, 0x02, opcodes.ATHROW}}}
+	classloader.MethAreaFetch("test/Task").Data.MethodTable = map[string]*classloader.Method{
+		"call()Ljava/lang/Object;": {AccessFlags: 0x0001}}
+	fs := mainThreadStack()
+	executorClass := "java/util/concurrent/ThreadPerTaskExecutor."
+	futureClass := "java/util/concurrent/ThreadPerTaskExecutor$ThreadBoundFuture."
+
+	normalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	executor := callGMethod(t, fs, "java/util/concurrent/Executors.newVirtualThreadPerTaskExecutor()Ljava/util/concurrent/ExecutorService;")
+	future := callGMethod(t, fs, executorClass+"submit(Ljava/util/concurrent/Callable;)Ljava/util/concurrent/Future;",
+		executor, newTask())
+	first := callGMethod(t, fs, futureClass+"get()Ljava/lang/Object;", future)
+	second := callGMethod(t, fs, futureClass+"get()Ljava/lang/Object;", future)
+	callGMethod(t, fs, executorClass+"close()V", executor)
+	_ = w.Close()
+	os.Stderr = normalStderr
+	out, _ := io.ReadAll(r)
+
+	exc, ok := first.(*gException)
+	if !ok || exc.excObj == nil || *exc.excObj.Klass != "java/util/concurrent/ExecutionException" {
+		t.Fatalf("Future.get(): Expected an ExecutionException, got: %v", first)
 	}
-	value := pop(&f).(int64)
-	if value != 258 {
-		t.Errorf("SIPUSH: Expected popped value to be 258, got: %d", value)
+	if exc.msg != "java.lang.RuntimeException" {
+		t.Errorf("Future.get(): Expected the message to name the cause, got: %q", exc.msg)
 	}
+	cause, ok := exc.excObj.FieldTable["cause"].Fvalue.(*object.Object)
+	if !ok || *cause.Klass != "java/lang/RuntimeException" {
+		t.Fatalf("Future.get(): Expected the cause to be the task's RuntimeException")
+	}
+	if again, ok := second.(*gException); !ok || again.excObj.FieldTable["cause"].Fvalue != cause {
+		t.Errorf("Future.get(): Expected every get() to have the same cause")
+	}
+	if strings.Contains(string(out), "Exception in thread") {
+		t.Errorf("Future.get(): Expected the task's exception not to be reported, got: %s", string(out))
+	}
+}
 
-	if f.PC != 3 {
-		t.Errorf("SIPUSH: Expected PC to be 3, got: %d", f.PC)
+// a thread dump shows which threads are virtual
+func TestThreadDumpShowsVirtualThreads(t *testing.T) {
+	release := make(chan bool)
+	started := make(chan bool)
+	threadSetup(func(fs *list.List) {
+		started <- true
+		<-release
+	})
+	fs := mainThreadStack()
+	builder := callThreadMethod(t, fs, "ofVirtual()Ljava/lang/Thread$Builder$OfVirtual;")
+	name := "sleeper"
+	callGMethod(t, fs, "java/lang/ThreadBuilders$VirtualThreadBuilder.name(Ljava/lang/String;)Ljava/lang/Thread$Builder;",
+		builder, object.CreateCompactStringFromGoString(&name))
+	thr := callGMethod(t, fs, "java/lang/ThreadBuilders$VirtualThreadBuilder.start(Ljava/lang/Runnable;)Ljava/lang/Thread;",
+		builder, newTask())
+	<-started
+
+	var dump strings.Builder
+	threadDump(&dump)
+	close(release)
+	callThreadMethod(t, fs, "join()V", thr)
+
+	if !strings.Contains(dump.String(), "\"main\" #") {
+		t.Errorf("Thread dump: Expected the main thread to be shown, got:\n%s", dump.String())
+	}
+	if !strings.Contains(dump.String(), "\"sleeper\" #") || !strings.Contains(dump.String(), " virtual RUNNABLE") {
+		t.Errorf("Thread dump: Expected the virtual thread to be shown as virtual, got:\n%s", dump.String())
 	}
 }
 
-// SIPUSH: create a negative int from next two bytes and push the int
-func TestSipushNegative(t *testing.T) {
-	f := newFrame(opcodes.SIPUSH)
-	val := -1
-	f.Meth = append(f.Meth, byte(val))
-	f.Meth = append(f.Meth, 0x02)
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
-	if f.TOS != 0 {
-		t.Errorf("BIPUSH: Top of stack, expected 0, got: %d", f.TOS)
+// scheduledRun runs three threads, named a, b, and c, scheduled deterministically with
+// the given seed, and returns the order in which they ran. Each thread enters a monitor
+// and yields while it holds it, ten times over.
+func scheduledRun(t *testing.T, seed int64) string {
+	var order strings.Builder
+	lock := object.MakeEmptyObject()
+	threadSetup(func(fs *list.List) {
+		id := currentThreadID(fs)
+		for i := 0; i < 10; i++ {
+			object.MonitorEnter(lock, id)
+			order.WriteString(threadName(id))
+			scheduler.yield(id)
+			order.WriteString(threadName(id))
+			object.MonitorExit(lock, id)
+			scheduler.yield(id)
+		}
+	})
+	scheduler = newThreadScheduler(seed)
+	defer func() {
+		scheduler = nil
+		object.Yield = nil
+	}()
+	startScheduling()
+
+	fs := mainThreadStack()
+	var threads []*object.Object
+	for _, name := range []string{"a", "b", "c"} {
+		thr := newThreadObject(t, fs, "<init>(Ljava/lang/Runnable;Ljava/lang/String;)V",
+			newTask(), object.NewStringFromGoString(name))
+		callThreadMethod(t, fs, "start()V", thr)
+		threads = append(threads, thr)
+	}
+	for _, thr := range threads {
+		callThreadMethod(t, fs, "join()V", thr)
+	}
+	return order.String()
+}
+
+// threads scheduled deterministically interleave the same way every time they're run
+// with the same seed, and block on monitors as they otherwise do
+func TestDeterministicScheduling(t *testing.T) {
+	first := scheduledRun(t, 1)
+	if len(first) != 60 {
+		t.Fatalf("Scheduler: Expected each thread to run to its end, got: %s", first)
 	}
-	value := pop(&f).(int64)
-	if value >= 0 {
-		t.Errorf("SIPUSH: Expected popped value to be negative, got: %d", value)
+	for i := 0; i < len(first); i += 2 {
+		if first[i] != first[i+1] {
+			t.Fatalf("Scheduler: Expected a thread to run alone while it holds the monitor, got: %s", first)
+		}
 	}
-
-	if f.PC != 3 {
-		t.Errorf("SIPUSH: Expected PC to be 3, got: %d", f.PC)
+	if again := scheduledRun(t, 1); again != first {
+		t.Errorf("Scheduler: Expected the same order with the same seed, got %s and %s", first, again)
+	}
+	if other := scheduledRun(t, 2); other == first {
+		t.Errorf("Scheduler: Expected another order with another seed, got %s for both", first)
 	}
 }
 
-// SWAP: Swap top two items on stack
-func TestSwap(t *testing.T) {
-	// set the logger to low granularity, so that logging messages are not also captured in this test
-	_ = log.SetLogLevel(log.WARNING)
+// classLoaderSetup places the golang methods of java.lang.ClassLoader, URLClassLoader,
+// URL, and Class in the MTable, and returns the bytes of jacobin/HelloWorld.class
+func classLoaderSetup(t *testing.T) []byte {
+	globals.InitGlobals("test")
+	log.Init()
+	classloader.AppCL.Archives = make(map[string]*classloader.Archive)
+	classloader.InitMethodArea()
+	loadClassLoaderMethods()
 
-	f := newFrame(opcodes.SWAP)
-	push(&f, int64(34)) // push two different values
-	push(&f, int64(21)) // TOS now = 21
+	cwd, _ := os.Getwd()
+	jarName := filepath.Join(cwd, "..", "..", "testdata", "hello.jar")
+	jar, err := zip.OpenReader(jarName)
+	if err != nil {
+		t.Fatalf("ClassLoader: Error opening %s: %s", jarName, err.Error())
+	}
+	defer jar.Close()
+	class, _ := jar.Open("jacobin/HelloWorld.class")
+	classBytes, _ := io.ReadAll(class)
+	return classBytes
+}
 
-	fs := frames.CreateFrameStack()
-	fs.PushFront(&f) // push the new frame
-	_ = runFrame(fs)
+// newLoaderObject creates an object of the class className, which is a ClassLoader
+func newLoaderObject(className string) *object.Object {
+	obj := object.MakeEmptyObject()
+	obj.Klass = &className
+	return obj
+}
 
-	top := pop(&f).(int64)
-	next := pop(&f).(int64)
+// a subclass of ClassLoader defines a class from its bytes and is then its defining
+// loader, which loadClass() and findLoadedClass() return the class from
+func TestClassLoaderDefineClass(t *testing.T) {
+	classBytes := classLoaderSetup(t)
+	fs := mainThreadStack()
 
-	if top != 34 {
-		t.Errorf("SWAP: expected top's value to be 34, but got: %d", top)
+	loader := newLoaderObject("test/MyLoader")
+	if ret := callGMethod(t, fs, "java/lang/ClassLoader.<init>()V", loader); ret != nil {
+		t.Fatalf("ClassLoader: Unexpected error from <init>(): %v", ret)
 	}
-
-	if next != 21 {
-		t.Errorf("SWAP: expected next's value to be 21, but got: %d", next)
+	parent, _ := callGMethod(t, fs, "java/lang/ClassLoader.getParent()Ljava/lang/ClassLoader;", loader).(*object.Object)
+	parentName, _ := objectToString(
+		callGMethod(t, fs, "java/lang/ClassLoader.getName()Ljava/lang/String;", parent).(*object.Object), nil)
+	if parentName != "app" {
+		t.Errorf("ClassLoader: Expected the app loader to be the parent, got: %s", parentName)
 	}
 
-	if f.TOS != -1 {
-		t.Errorf("SWAP: Expected an empty stack, but got a tos of: %d", f.TOS)
+	bytes := object.Make1DimArray(object.BYTE, int64(len(classBytes)))
+	copy(*bytes.Fields[0].Fvalue.(*[]byte), classBytes)
+	name := object.NewStringFromGoString("jacobin.HelloWorld")
+	defineSig := "java/lang/ClassLoader.defineClass(Ljava/lang/String;[BII)Ljava/lang/Class;"
+	class, ok := callGMethod(t, fs, defineSig, loader, name, bytes, int64(0), int64(len(classBytes))).(*object.Object)
+	if !ok || classKlass(class) == nil {
+		t.Fatalf("ClassLoader: Expected defineClass to return a Class object")
+	}
+	if k := classKlass(class); k.Loader == classloader.AppCL.Name || k.Loader != getJavaLoader(loader).cl.Name {
+		t.Errorf("ClassLoader: Expected jacobin/HelloWorld to be defined by the loader, got: %s", k.Loader)
+	}
+	if ret := callGMethod(t, fs, "java/lang/Class.getClassLoader()Ljava/lang/ClassLoader;", class); ret != loader {
+		t.Errorf("ClassLoader: Expected getClassLoader() to return the defining loader, got: %v", ret)
+	}
+	className, _ := objectToString(callGMethod(t, fs, "java/lang/Class.getName()Ljava/lang/String;", class).(*object.Object), nil)
+	if className != "jacobin.HelloWorld" {
+		t.Errorf("ClassLoader: Expected the class to be named jacobin.HelloWorld, got: %s", className)
 	}
-}
 
-func TestInvalidInstruction(t *testing.T) {
-	// set the logger to low granularity, so that logging messages are not also captured in this test
-	Global := globals.InitGlobals("test")
-	_ = log.SetLogLevel(log.WARNING)
-	LoadOptionsTable(Global)
+	if ret := callGMethod(t, fs, "java/lang/ClassLoader.findLoadedClass(Ljava/lang/String;)Ljava/lang/Class;",
+		loader, name); ret != class {
+		t.Errorf("ClassLoader: Expected findLoadedClass to return the class defined, got: %v", ret)
+	}
+	if ret := callGMethod(t, fs, "java/lang/ClassLoader.loadClass(Ljava/lang/String;)Ljava/lang/Class;",
+		loader, name); ret != class {
+		t.Errorf("ClassLoader: Expected loadClass to return the class defined, got: %v", ret)
+	}
 
-	// to avoid cluttering the test results, redirect stdout
-	normalStdout := os.Stdout
-	_, wout, _ := os.Pipe()
-	os.Stdout = wout
+	// the loader can't define the class again, nor define a class with the wrong name
+	ret := callGMethod(t, fs, defineSig, loader, name, bytes, int64(0), int64(len(classBytes)))
+	if exc, ok := ret.(*gException); !ok || exc.className != "java/lang/LinkageError" {
+		t.Errorf("ClassLoader: Expected a LinkageError defining the class twice, got: %v", ret)
+	}
+	other := newLoaderObject("test/MyLoader")
+	callGMethod(t, fs, "java/lang/ClassLoader.<init>()V", other)
+	wrongName := object.NewStringFromGoString("HelloWorld")
+	ret = callGMethod(t, fs, defineSig, other, wrongName, bytes, int64(0), int64(len(classBytes)))
+	if exc, ok := ret.(*gException); !ok || exc.className != "java/lang/NoClassDefFoundError" {
+		t.Errorf("ClassLoader: Expected a NoClassDefFoundError for the wrong name, got: %v", ret)
+	}
+	ret = callGMethod(t, fs, defineSig, other, name, bytes, int64(1), int64(len(classBytes)))
+	if exc, ok := ret.(*gException); !ok || exc.className != "java/lang/IndexOutOfBoundsException" {
+		t.Errorf("ClassLoader: Expected an IndexOutOfBoundsException for the wrong length, got: %v", ret)
+	}
+}
 
-	// to inspect usage message, redirect stderr
+// loadClass() asks a loader's findClass(), written in Java, for a class its parent can't
+// find. If findClass() throws a ClassNotFoundException, or an exception of a subclass,
+// loadClass() throws ClassNotFoundException; any other exception is passed on.
+func TestClassLoaderJavaFindClassThrows(t *testing.T) {
+	classLoaderSetup(t)
+	fs := mainThreadStack()
+	invokeinterfaceAddClass("java/lang/Object", "", false, nil, nil)
+	invokeinterfaceAddClass("java/lang/ClassLoader", "java/lang/Object", false, nil, nil)
+	invokeinterfaceAddClass("java/lang/Throwable", "java/lang/Object", false, nil, nil)
+	invokeinterfaceAddClass("java/lang/Exception", "java/lang/Throwable", false, nil, nil)
+	invokeinterfaceAddClass("java/lang/RuntimeException", "java/lang/Exception", false, nil, nil)
+	invokeinterfaceAddClass("java/lang/ClassNotFoundException", "java/lang/Exception", false, nil, nil)
+	invokeinterfaceAddClass("test/MissingException", "java/lang/ClassNotFoundException", false, nil, nil)
+
+	// the findClass() of the loader class loaderClass throws a new excClass
+	addLoaderClass := func(loaderClass, excClass string) {
+		CP := classloader.CPool{}
+		CP.CpIndex = []classloader.CpEntry{{Type: 0}, {Type: classloader.UTF8, Slot: 0}, {Type: classloader.ClassRef, Slot: 0}}
+		CP.ClassRefs = append(CP.ClassRefs, 1)
+		CP.Utf8Refs = append(CP.Utf8Refs, excClass)
+		classloader.MethAreaInsert(loaderClass, &(classloader.Klass{
+			Status: 'X', Loader: "app",
+			Data: &classloader.ClData{Name: loaderClass, Superclass: "java/lang/ClassLoader", CP: CP,
+				MethodTable: map[string]*classloader.Method{
+					"findClass(Ljava/lang/String;)Ljava/lang/Class;": {
+						AccessFlags: 0x0004, // protected
+						CodeAttr: classloader.CodeAttrib{
+							MaxStack: 1, MaxLocals: 2,
+							Code: []byte{opcodes.NEW, 0x00, 0x02, opcodes.ATHROW},
+						},
+					},
+				}}}))
+	}
+	addLoaderClass("test/MissLoader", "test/MissingException")
+	addLoaderClass("test/BadLoader", "java/lang/RuntimeException")
+
+	loadSig := "java/lang/ClassLoader.loadClass(Ljava/lang/String;)Ljava/lang/Class;"
+	name := object.NewStringFromGoString("test.Nowhere")
 	normalStderr := os.Stderr
 	r, w, _ := os.Pipe()
 	os.Stderr = w
+	missLoader := newLoaderObject("test/MissLoader")
+	callGMethod(t, fs, "java/lang/ClassLoader.<init>()V", missLoader)
+	missRet := callGMethod(t, fs, loadSig, missLoader, name)
+	badLoader := newLoaderObject("test/BadLoader")
+	callGMethod(t, fs, "java/lang/ClassLoader.<init>()V", badLoader)
+	badRet := callGMethod(t, fs, loadSig, badLoader, name)
+	_ = w.Close()
+	os.Stderr = normalStderr
+	out, _ := io.ReadAll(r)
 
-	f := newFrame(252)
+	if !isGException(missRet, classNotFoundException) {
+		t.Errorf("ClassLoader: Expected a ClassNotFoundException from loadClass(), got: %v", missRet)
+	}
+	if exc, ok := badRet.(*gException); !ok || exc.excObj == nil || *exc.excObj.Klass != "java/lang/RuntimeException" {
+		t.Errorf("ClassLoader: Expected the RuntimeException of findClass() to be passed on, got: %v", badRet)
+	}
+	if strings.Contains(string(out), "Exception in thread") {
+		t.Errorf("ClassLoader: Expected no exception to be reported as uncaught, got: %s", string(out))
+	}
+}
 
-	MainThread = thread.CreateThread()
-	MainThread.Stack = frames.CreateFrameStack()
-	MainThread.Stack.PushFront(&f) // push the new frame
-	MainThread.Trace = false       // turn off tracing
-	ret := runFrame(MainThread.Stack)
+// testClassBytes returns the class file of the class name, whose static initializer
+// sets its static int field N to n, and whose instance method value()I returns N. Its
+// static method get()I creates an object of the class other, which can be the class
+// itself, and returns what the object's value()I does.
+func testClassBytes(name, other string, n byte) []byte {
+	utf8 := func(s string) []byte { return append([]byte{1, 0, byte(len(s))}, s...) }
+	code := func(maxStack, maxLocals byte, bytecode ...byte) []byte {
+		length := byte(12 + len(bytecode))
+		attr := []byte{0, 1, 0, 22, 0, 0, 0, length, 0, maxStack, 0, maxLocals, 0, 0, 0, byte(len(bytecode))}
+		return append(append(attr, bytecode...), 0, 0, 0, 0)
+	}
+
+	b := []byte{0xCA, 0xFE, 0xBA, 0xBE, 0x00, 0x00, 0x00, 0x37, 0x00, 23}
+	b = append(b, utf8(name)...)                      // [1]
+	b = append(b, 7, 0, 1)                            // [2] class name
+	b = append(b, utf8("java/lang/Object")...)        // [3]
+	b = append(b, 7, 0, 3)                            // [4] class java/lang/Object
+	b = append(b, utf8("N")...)                       // [5]
+	b = append(b, utf8("I")...)                       // [6]
+	b = append(b, 12, 0, 5, 0, 6)                     // [7] N:I
+	b = append(b, 9, 0, 2, 0, 7)                      // [8] name.N:I
+	b = append(b, utf8("<init>")...)                  // [9]
+	b = append(b, utf8("()V")...)                     // [10]
+	b = append(b, 12, 0, 9, 0, 10)                    // [11] <init>:()V
+	b = append(b, 10, 0, 4, 0, 11)                    // [12] java/lang/Object.<init>:()V
+	b = append(b, utf8(other)...)                     // [13]
+	b = append(b, 7, 0, 13)                           // [14] class other
+	b = append(b, 10, 0, 14, 0, 11)                   // [15] other.<init>:()V
+	b = append(b, utf8("value")...)                   // [16]
+	b = append(b, utf8("()I")...)                     // [17]
+	b = append(b, 12, 0, 16, 0, 17)                   // [18] value:()I
+	b = append(b, 10, 0, 14, 0, 18)                   // [19] other.value:()I
+	b = append(b, utf8("get")...)                     // [20]
+	b = append(b, utf8("<clinit>")...)                // [21]
+	b = append(b, utf8("Code")...)                    // [22]
+	b = append(b, 0x00, 0x21, 0, 2, 0, 4, 0, 0)       // public class name extends java/lang/Object
+	b = append(b, 0, 1, 0x00, 0x08, 0, 5, 0, 6, 0, 0) // static int N
+
+	b = append(b, 0, 4)
+	b = append(b, 0x00, 0x01, 0, 9, 0, 10) // public <init>()V
+	b = append(b, code(1, 1, opcodes.ALOAD_0, opcodes.INVOKESPECIAL, 0, 12, opcodes.RETURN)...)
+	b = append(b, 0x00, 0x01, 0, 16, 0, 17) // public value()I
+	b = append(b, code(1, 1, opcodes.GETSTATIC, 0, 8, opcodes.IRETURN)...)
+	b = append(b, 0x00, 0x09, 0, 20, 0, 17) // public static get()I
+	b = append(b, code(2, 0, opcodes.NEW, 0, 14, opcodes.DUP, opcodes.INVOKESPECIAL, 0, 15,
+		opcodes.INVOKEVIRTUAL, 0, 19, opcodes.IRETURN)...)
+	b = append(b, 0x00, 0x08, 0, 21, 0, 10) // static <clinit>()V
+	b = append(b, code(1, 0, opcodes.BIPUSH, n, opcodes.PUTSTATIC, 0, 8, opcodes.RETURN)...)
+	return append(b, 0, 0)
+}
 
-	if ret == nil {
-		t.Errorf("Invalid instruction: Expected an error returned, but got nil.")
+// two loaders each define a class named test/Dup from different bytes. The code of
+// each class runs with the class itself, its methods, and its statics, not those of
+// the other loader's class of the same name.
+func TestClassLoaderSameClassNameInTwoLoaders(t *testing.T) {
+	classLoaderSetup(t)
+	fs := mainThreadStack()
+	invokeinterfaceAddClass("java/lang/Object", "", false, nil, nil)
+	invokeinterfaceAddClass("java/lang/ClassLoader", "java/lang/Object", false, nil, nil)
+	invokeinterfaceAddClass("test/MyLoader", "java/lang/ClassLoader", false, nil, nil)
+
+	defineSig := "java/lang/ClassLoader.defineClass(Ljava/lang/String;[BII)Ljava/lang/Class;"
+	name := object.NewStringFromGoString("test.Dup")
+	var classes []*classloader.Klass
+	for _, n := range []byte{11, 22} {
+		loader := newLoaderObject("test/MyLoader")
+		if ret := callGMethod(t, fs, "java/lang/ClassLoader.<init>()V", loader); ret != nil {
+			t.Fatalf("ClassLoader: Unexpected error from <init>(): %v", ret)
+		}
+		classBytes := testClassBytes("test/Dup", "test/Dup", n)
+		bytes := object.Make1DimArray(object.BYTE, int64(len(classBytes)))
+		copy(*bytes.Fields[0].Fvalue.(*[]byte), classBytes)
+		class := callGMethod(t, fs, defineSig, loader, name, bytes, int64(0), int64(len(classBytes)))
+		if classKlass(class) == nil {
+			t.Fatalf("ClassLoader: Expected defineClass to return a Class object, got: %v", class)
+		}
+		classes = append(classes, classKlass(class))
+	}
+	if classes[0] == classes[1] || classes[0].Loader == classes[1].Loader {
+		t.Fatalf("ClassLoader: Expected each loader to define its own test/Dup")
 	}
 
-	// restore stderr to what it was before
-	_ = w.Close()
-	out, _ := io.ReadAll(r)
+	for i, want := range []int64{11, 22} {
+		mtEntry, err := classloader.FetchKlassMethod(classes[i], "get", "()I")
+		if err != nil {
+			t.Fatalf("ClassLoader: Unexpected error fetching test/Dup.get()I: %s", err.Error())
+		}
+		ret, err := runMethodFromGo(fs, mtEntry, "test/Dup", "get", "()I", nil)
+		if err != nil {
+			t.Fatalf("ClassLoader: Unexpected error running test/Dup.get()I: %s", err.Error())
+		}
+		if ret != want {
+			t.Errorf("ClassLoader: Expected test/Dup.get()I of loader %s to return %d, got: %v",
+				classes[i].Loader, want, ret)
+		}
+	}
+}
 
-	_ = wout.Close()
-	os.Stdout = normalStdout
-	os.Stderr = normalStderr
+// newURLClassLoader creates a URLClassLoader whose only URL is that of the directory dir
+func newURLClassLoader(t *testing.T, fs *list.List, dir string) *object.Object {
+	u := newLoaderObject("java/net/URL")
+	spec := "file:" + filepath.ToSlash(dir) + "/"
+	if ret := callGMethod(t, fs, "java/net/URL.<init>(Ljava/lang/String;)V", u,
+		object.CreateCompactStringFromGoString(&spec)); ret != nil {
+		t.Fatalf("URL: Unexpected error from <init>(%s): %v", spec, ret)
+	}
+	urls := object.Make1DimArray(object.REF, 1)
+	(*urls.Fields[0].Fvalue.(*[]*object.Object))[0] = u
 
-	msg := string(out[:])
+	loader := newLoaderObject("java/net/URLClassLoader")
+	if ret := callGMethod(t, fs, "java/net/URLClassLoader.<init>([Ljava/net/URL;)V", loader, urls); ret != nil {
+		t.Fatalf("URLClassLoader: Unexpected error from <init>: %v", ret)
+	}
+	return loader
+}
 
-	if !strings.Contains(msg, "Invalid bytecode") {
-		t.Errorf("Error message for invalid bytecode not as expected, got: %s", msg)
+// a URLClassLoader defines the classes it finds in the directories of its file: URLs
+func TestURLClassLoaderFindClass(t *testing.T) {
+	classBytes := classLoaderSetup(t)
+	fs := mainThreadStack()
+
+	dir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(dir, "jacobin"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, "jacobin", "HelloWorld.class"), classBytes, 0644)
+
+	loader := newURLClassLoader(t, fs, dir)
+	got := callGMethod(t, fs, "java/net/URLClassLoader.getURLs()[Ljava/net/URL;", loader).(*object.Object)
+	if gotURLs := *got.Fields[0].Fvalue.(*[]*object.Object); len(gotURLs) != 1 || urlSpec(gotURLs[0]) !=
+		"file:"+filepath.ToSlash(dir)+"/" {
+		t.Errorf("URLClassLoader: Expected getURLs() to return the URL given, got: %v", gotURLs)
+	}
+
+	findSig := "java/net/URLClassLoader.findClass(Ljava/lang/String;)Ljava/lang/Class;"
+	name := object.NewStringFromGoString("jacobin.HelloWorld")
+	class, ok := callGMethod(t, fs, findSig, loader, name).(*object.Object)
+	if !ok || classKlass(class) == nil || classKlass(class).Loader != getJavaLoader(loader).cl.Name {
+		t.Fatalf("URLClassLoader: Expected jacobin/HelloWorld to be defined by the loader, got: %v", class)
+	}
+	if ret := callGMethod(t, fs, "java/lang/Class.getClassLoader()Ljava/lang/ClassLoader;", class); ret != loader {
+		t.Errorf("URLClassLoader: Expected getClassLoader() to return the loader, got: %v", ret)
+	}
+
+	missing := object.NewStringFromGoString("jacobin.GoodbyeWorld")
+	ret := callGMethod(t, fs, findSig, loader, missing)
+	if exc, ok := ret.(*gException); !ok || exc.className != "java/lang/ClassNotFoundException" {
+		t.Errorf("URLClassLoader: Expected a ClassNotFoundException for jacobin.GoodbyeWorld, got: %v", ret)
 	}
 }
 
-func TestConvertInterfaceToUint64(t *testing.T) {
-	var i64 int64 = 200
-	var f64 float64 = 345.0
-	var ptr = unsafe.Pointer(&f64)
+// the code of a class that a URLClassLoader defines runs, and the classes it refers to
+// are loaded with that loader, which is the only one that can find them
+func TestURLClassLoaderRunsDefinedClass(t *testing.T) {
+	classLoaderSetup(t)
+	fs := mainThreadStack()
+	invokeinterfaceAddClass("java/lang/Object", "", false, nil, nil)
+	invokeinterfaceAddClass("java/lang/ClassLoader", "java/lang/Object", false, nil, nil)
+	invokeinterfaceAddClass("java/net/URLClassLoader", "java/lang/ClassLoader", false, nil, nil)
+
+	dir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(dir, "test"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, "test", "Main.class"), testClassBytes("test/Main", "test/Helper", 1), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "test", "Helper.class"), testClassBytes("test/Helper", "test/Helper", 42), 0644)
+	loader := newURLClassLoader(t, fs, dir)
+	loaderName := getJavaLoader(loader).cl.Name
+
+	loadSig := "java/lang/ClassLoader.loadClass(Ljava/lang/String;)Ljava/lang/Class;"
+	main := classKlass(callGMethod(t, fs, loadSig, loader, object.NewStringFromGoString("test.Main")))
+	if main == nil || main.Loader != loaderName {
+		t.Fatalf("URLClassLoader: Expected test/Main to be defined by %s, got: %v", loaderName, main)
+	}
+
+	mtEntry, err := classloader.FetchKlassMethod(main, "get", "()I")
+	if err != nil {
+		t.Fatalf("URLClassLoader: Unexpected error fetching test/Main.get()I: %s", err.Error())
+	}
+	ret, err := runMethodFromGo(fs, mtEntry, "test/Main", "get", "()I", nil)
+	if err != nil || ret != int64(42) {
+		t.Fatalf("URLClassLoader: Expected test/Main.get()I to return 42, got: %v (error: %v)", ret, err)
+	}
 
-	ret := convertInterfaceToUint64(i64)
-	if ret != 200 {
-		t.Errorf("Expected TestConvertInterfaceToUint64() to retun 200, got %d\n",
-			ret)
+	helper := classloader.MethAreaFetchFromLoader(loaderName, "test/Helper")
+	if helper == nil || helper.Loader != loaderName {
+		t.Errorf("URLClassLoader: Expected test/Helper to be defined by %s, got: %v", loaderName, helper)
 	}
+	if classloader.MethAreaFetch("test/Helper") != nil {
+		t.Errorf("URLClassLoader: Expected the app loader not to see test/Helper")
+	}
+}
 
-	ret = convertInterfaceToUint64(f64)
-	if ret != 345 {
-		t.Errorf("Expected TestConvertInterfaceToUint64() to retun 345, got %d\n",
-			ret)
+// newDiscardedLoader creates a ClassLoader object, which it doesn't keep, and returns
+// the name of its loader
+func newDiscardedLoader(t *testing.T, fs *list.List) string {
+	loader := newLoaderObject("test/MyLoader")
+	if ret := callGMethod(t, fs, "java/lang/ClassLoader.<init>()V", loader); ret != nil {
+		t.Fatalf("ClassLoader: Unexpected error from <init>(): %v", ret)
 	}
+	return getJavaLoader(loader).cl.Name
+}
 
-	ret = convertInterfaceToUint64(ptr)
-	if ret == 0 { // a minimal test
-		t.Error("Expected TestConvertInterfaceToUint64() to !=0, got 0\n")
+// once its object has been garbage collected, a loader that hasn't defined a class is
+// removed, while one that has stays with its class. Each loader has a name of its own.
+func TestClassLoaderReleasedWhenCollected(t *testing.T) {
+	classBytes := classLoaderSetup(t)
+	fs := mainThreadStack()
+
+	released := newDiscardedLoader(t, fs)
+	if newDiscardedLoader(t, fs) == released {
+		t.Errorf("ClassLoader: Expected each loader to have a name of its own, got %s twice", released)
+	}
+
+	kept := newLoaderObject("test/MyLoader")
+	if ret := callGMethod(t, fs, "java/lang/ClassLoader.<init>()V", kept); ret != nil {
+		t.Fatalf("ClassLoader: Unexpected error from <init>(): %v", ret)
+	}
+	keptName := getJavaLoader(kept).cl.Name
+	bytes := object.Make1DimArray(object.BYTE, int64(len(classBytes)))
+	copy(*bytes.Fields[0].Fvalue.(*[]byte), classBytes)
+	defineSig := "java/lang/ClassLoader.defineClass([BII)Ljava/lang/Class;"
+	if class := callGMethod(t, fs, defineSig, kept, bytes, int64(0), int64(len(classBytes))); classKlass(class) == nil {
+		t.Fatalf("ClassLoader: Expected defineClass to return a Class object, got: %v", class)
+	}
+
+	for i := 0; i < 100 && classloader.LoaderNamed(released) != nil; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if classloader.LoaderNamed(released) != nil {
+		t.Errorf("ClassLoader: Expected %s to be removed once its object was collected", released)
+	}
+	javaLoadersMutex.Lock()
+	for _, jl := range javaLoaders {
+		if jl.cl.Name == released {
+			t.Errorf("ClassLoader: Expected the state of %s to be released", released)
+		}
+	}
+	keptObj := loaderObjects[keptName]
+	javaLoadersMutex.Unlock()
+	if classloader.LoaderNamed(keptName) == nil || keptObj == nil {
+		t.Errorf("ClassLoader: Expected %s, which defined a class, to stay", keptName)
 	}
 }
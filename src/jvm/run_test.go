@@ -7,6 +7,7 @@
 package jvm
 
 import (
+	"container/list"
 	"io"
 	"jacobin/classloader"
 	"jacobin/frames"
@@ -20,6 +21,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 	"unsafe"
 )
 
@@ -29,6 +31,182 @@ import (
 // All other bytecodes that come after IFNULL are in run_part2_test.go *except
 // for array bytecodes*, which are located in arrays_test.go
 
+// runTestCases are the tests in this file, which are run by the interpreter and then,
+// in TestRunInClosureTier, by the closure tier as well. A test that's added to this
+// file should be added here too.
+var runTestCases = []struct {
+	name string
+	test func(*testing.T)
+}{
+	{"AconstNull", TestAconstNull},
+	{"Aload", TestAload},
+	{"Aload0", TestAload0},
+	{"Aload1", TestAload1},
+	{"Aload2", TestAload2},
+	{"Aload3", TestAload3},
+	{"Areturn", TestAreturn},
+	{"Astore", TestAstore},
+	{"Astore0", TestAstore0},
+	{"Astore1", TestAstore1},
+	{"Astore2", TestAstore2},
+	{"Astore3", TestAstore3},
+	{"AthrowCaughtInSameMethod", TestAthrowCaughtInSameMethod},
+	{"AthrowCaughtBySuperclass", TestAthrowCaughtBySuperclass},
+	{"AthrowCaughtInCallingMethod", TestAthrowCaughtInCallingMethod},
+	{"AthrowUncaught", TestAthrowUncaught},
+	{"AthrowOutOfStaticInitializer", TestAthrowOutOfStaticInitializer},
+	{"Bipush", TestBipush},
+	{"BipushNeg", TestBipushNeg},
+	{"CheckcastOfString", TestCheckcastOfString},
+	{"CheckcastOfNil", TestCheckcastOfNil},
+	{"CheckcastOfNull", TestCheckcastOfNull},
+	{"CheckcastOfInvalidReference", TestCheckcastOfInvalidReference},
+	{"D2f", TestD2f},
+	{"D2iPositive", TestD2iPositive},
+	{"D2iNegative", TestD2iNegative},
+	{"D2lPositive", TestD2lPositive},
+	{"D2lNegative", TestD2lNegative},
+	{"Dadd", TestDadd},
+	{"DaddNan", TestDaddNan},
+	{"DaddInf", TestDaddInf},
+	{"Dcmpg1", TestDcmpg1},
+	{"DcmpgMinus1", TestDcmpgMinus1},
+	{"Dcmpg0", TestDcmpg0},
+	{"DcmpgNan", TestDcmpgNan},
+	{"DcmplNan", TestDcmplNan},
+	{"Dconst0", TestDconst0},
+	{"Dconst1", TestDconst1},
+	{"Ddiv", TestDdiv},
+	{"DdivDivideZeroByZero", TestDdivDivideZeroByZero},
+	{"DdivDividePosNumberByZero", TestDdivDividePosNumberByZero},
+	{"Dload", TestDload},
+	{"Dload0", TestDload0},
+	{"Dload1", TestDload1},
+	{"Dload2", TestDload2},
+	{"Dload3", TestDload3},
+	{"Dmul", TestDmul},
+	{"Dneg", TestDneg},
+	{"DnegInf", TestDnegInf},
+	{"Drem", TestDrem},
+	{"Dreturn", TestDreturn},
+	{"Dstore", TestDstore},
+	{"Dstore0", TestDstore0},
+	{"Dstore1", TestDstore1},
+	{"Dstore2", TestDstore2},
+	{"Dstore3", TestDstore3},
+	{"Dsub", TestDsub},
+	{"Dup", TestDup},
+	{"Dup2", TestDup2},
+	{"DupX1", TestDupX1},
+	{"DupX2", TestDupX2},
+	{"Dup2X1", TestDup2X1},
+	{"Dup2X2", TestDup2X2},
+	{"F2d", TestF2d},
+	{"F2iPositive", TestF2iPositive},
+	{"F2iNegative", TestF2iNegative},
+	{"F2l", TestF2l},
+	{"Fadd", TestFadd},
+	{"Fcmpg1", TestFcmpg1},
+	{"FcmpgMinus1", TestFcmpgMinus1},
+	{"Fcmpg0", TestFcmpg0},
+	{"FcmpgNan", TestFcmpgNan},
+	{"FcmplNan", TestFcmplNan},
+	{"Fconst0", TestFconst0},
+	{"Fconst1", TestFconst1},
+	{"Fconst2", TestFconst2},
+	{"Fdiv", TestFdiv},
+	{"FdivDivideZeroByZero", TestFdivDivideZeroByZero},
+	{"FdivDividePosNumberByZero", TestFdivDividePosNumberByZero},
+	{"Fload", TestFload},
+	{"Fload0", TestFload0},
+	{"Fload1", TestFload1},
+	{"Fload2", TestFload2},
+	{"Fload3", TestFload3},
+	{"Fmul", TestFmul},
+	{"Fneg", TestFneg},
+	{"Frem", TestFrem},
+	{"Fstore", TestFstore},
+	{"Fstore0", TestFstore0},
+	{"Fstore1", TestFstore1},
+	{"Fstore2", TestFstore2},
+	{"Fstore3", TestFstore3},
+	{"Fsub", TestFsub},
+	{"GetField", TestGetField},
+	{"GetFieldWithLong", TestGetFieldWithLong},
+	{"GetFieldInvalidFieldEntry", TestGetFieldInvalidFieldEntry},
+	{"GetStaticInvalidFieldEntry", TestGetStaticInvalidFieldEntry},
+	{"GetStaticBoolean", TestGetStaticBoolean},
+	{"GotoForward", TestGotoForward},
+	{"GotoBackward", TestGotoBackward},
+	{"GotoWForward", TestGotoWForward},
+	{"GotoWBackward", TestGotoWBackward},
+	{"I2B", TestI2B},
+	{"I2Bneg", TestI2Bneg},
+	{"I2C", TestI2C},
+	{"I2D", TestI2D},
+	{"I2f", TestI2f},
+	{"I2l", TestI2l},
+	{"I2s", TestI2s},
+	{"Iadd", TestIadd},
+	{"Iand", TestIand},
+	{"Idiv", TestIdiv},
+	{"IdivDivideByZero", TestIdivDivideByZero},
+	{"IconstN1", TestIconstN1},
+	{"Iconst0", TestIconst0},
+	{"Iconst1", TestIconst1},
+	{"Iconst2", TestIconst2},
+	{"Iconst3", TestIconst3},
+	{"Iconst4", TestIconst4},
+	{"Iconst5", TestIconst5},
+	{"IfAcmpEq", TestIfAcmpEq},
+	{"IfAcmpeqFail", TestIfAcmpeqFail},
+	{"IfAcmpNe", TestIfAcmpNe},
+	{"IfAcmpneFail", TestIfAcmpneFail},
+	{"IfIcmpeq", TestIfIcmpeq},
+	{"IfIcmpeqUnequal", TestIfIcmpeqUnequal},
+	{"IfIcmpge1", TestIfIcmpge1},
+	{"IfIcmpge2", TestIfIcmpge2},
+	{"IfIcmgetFail", TestIfIcmgetFail},
+	{"IfIcmple2", TestIfIcmple2},
+	{"IfIcmpgt", TestIfIcmpgt},
+	{"IfIcmpletFail", TestIfIcmpletFail},
+	{"IfIcmple1", TestIfIcmple1},
+	{"IfIcmplt", TestIfIcmplt},
+	{"IfIcmpltFail", TestIfIcmpltFail},
+	{"IfIcmpne", TestIfIcmpne},
+	{"IfIcmpneAreEqual", TestIfIcmpneAreEqual},
+	{"Ifeq", TestIfeq},
+	{"IfeqFallThrough", TestIfeqFallThrough},
+	{"Ifge", TestIfge},
+	{"IfgeEqual0", TestIfgeEqual0},
+	{"IfgeFallThrough", TestIfgeFallThrough},
+	{"Ifgt", TestIfgt},
+	{"IfgtFallThrough", TestIfgtFallThrough},
+	{"Ifle", TestIfle},
+	{"IfleTest0", TestIfleTest0},
+	{"IfleFallThrough", TestIfleFallThrough},
+	{"Iflt", TestIflt},
+	{"IfltFallThrough", TestIfltFallThrough},
+	{"Ifne", TestIfne},
+	{"IfneFallThrough", TestIfneFallThrough},
+	{"Ifn0nnull", TestIfn0nnull},
+	{"IfnonnullFallThrough", TestIfnonnullFallThrough},
+	{"Ifnull", TestIfnull},
+	{"IfnullFallThrough", TestIfnullFallThrough},
+}
+
+// TestRunInClosureTier runs the tests in this file with the closure tier enabled and
+// compiling every method when it's first executed (see closures.go), so that both
+// tiers are tested on every instruction
+func TestRunInClosureTier(t *testing.T) {
+	t.Run("closures", func(t *testing.T) {
+		t.Cleanup(setClosureTier(true, 0, 0))
+		for _, tc := range runTestCases {
+			t.Run(tc.name, tc.test)
+		}
+	})
+}
+
 // set up function to create a frame with a method with the single instruction
 // that's being tested
 func newFrame(code byte) frames.Frame {
@@ -205,8 +383,8 @@ func TestAstore(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.Locals[3] != int64(0x22223) {
-		t.Errorf("ASTORE: Expecting 0x22223 in locals[3], got: 0x%x", f.Locals[3])
+	if getLocal(&f, 3) != int64(0x22223) {
+		t.Errorf("ASTORE: Expecting 0x22223 in locals[3], got: 0x%x", getLocal(&f, 3))
 	}
 	if f.TOS != -1 {
 		t.Errorf("ASTORE: Expecting an empty stack, but tos points to item: %d", f.TOS)
@@ -223,8 +401,8 @@ func TestAstore0(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.Locals[0] != int64(0x22220) {
-		t.Errorf("ASTORE_0: Expecting 0x22220 on stack, got: 0x%x", f.Locals[0])
+	if getLocal(&f, 0) != int64(0x22220) {
+		t.Errorf("ASTORE_0: Expecting 0x22220 on stack, got: 0x%x", getLocal(&f, 0))
 	}
 	if f.TOS != -1 {
 		t.Errorf("ASTORE_0: Expecting an empty stack, but tos points to item: %d", f.TOS)
@@ -242,8 +420,8 @@ func TestAstore1(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.Locals[1] != int64(0x22221) {
-		t.Errorf("ASTORE_1: Expecting 0x22221 on stack, got: 0x%x", f.Locals[0])
+	if getLocal(&f, 1) != int64(0x22221) {
+		t.Errorf("ASTORE_1: Expecting 0x22221 on stack, got: 0x%x", getLocal(&f, 0))
 	}
 	if f.TOS != -1 {
 		t.Errorf("ASTORE_1: Expecting an empty stack, but tos points to item: %d", f.TOS)
@@ -262,8 +440,8 @@ func TestAstore2(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.Locals[2] != int64(0x22222) {
-		t.Errorf("ASTORE_2: Expecting 0x22222 on stack, got: 0x%x", f.Locals[0])
+	if getLocal(&f, 2) != int64(0x22222) {
+		t.Errorf("ASTORE_2: Expecting 0x22222 on stack, got: 0x%x", getLocal(&f, 0))
 	}
 	if f.TOS != -1 {
 		t.Errorf("ASTORE_2: Expecting an empty stack, but tos points to item: %d", f.TOS)
@@ -283,14 +461,466 @@ func TestAstore3(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.Locals[3] != int64(0x22223) {
-		t.Errorf("ASTORE_3: Expecting 0x22223 on stack, got: 0x%x", f.Locals[0])
+	if getLocal(&f, 3) != int64(0x22223) {
+		t.Errorf("ASTORE_3: Expecting 0x22223 on stack, got: 0x%x", getLocal(&f, 0))
 	}
 	if f.TOS != -1 {
 		t.Errorf("ASTORE_3: Expecting an empty stack, but tos points to item: %d", f.TOS)
 	}
 }
 
+// ATHROW: set up the method area and exception tables needed by the ATHROW tests.
+// The CP of the frames has a single ClassRef at [2], which names the catch type.
+func athrowSetup(catchType string, exceptions []classloader.CodeException) *classloader.CPool {
+	globals.InitGlobals("test")
+	log.Init()
+	classloader.InitMethodArea()
+
+	classloader.MethAreaInsert("java/lang/Throwable", &(classloader.Klass{
+		Status: 'X', Loader: "bootstrap",
+		Data: &classloader.ClData{Name: "java/lang/Throwable", Superclass: "java/lang/Object"}}))
+	classloader.MethAreaInsert("java/lang/Exception", &(classloader.Klass{
+		Status: 'X', Loader: "bootstrap",
+		Data: &classloader.ClData{Name: "java/lang/Exception", Superclass: "java/lang/Throwable"}}))
+	classloader.MethAreaInsert("java/lang/RuntimeException", &(classloader.Klass{
+		Status: 'X', Loader: "bootstrap",
+		Data: &classloader.ClData{Name: "java/lang/RuntimeException", Superclass: "java/lang/Exception"}}))
+
+	CP := classloader.CPool{}
+	CP.CpIndex = make([]classloader.CpEntry, 10, 10)
+	CP.CpIndex[0] = classloader.CpEntry{Type: 0, Slot: 0}
+	CP.CpIndex[1] = classloader.CpEntry{Type: classloader.UTF8, Slot: 0}
+	CP.CpIndex[2] = classloader.CpEntry{Type: classloader.ClassRef, Slot: 0}
+	CP.ClassRefs = append(CP.ClassRefs, 1) // point to record 1 in CP: Utf8 for class name
+	CP.Utf8Refs = append(CP.Utf8Refs, catchType)
+
+	classloader.MTable["athrowTest.catcher()V"] = classloader.MTentry{
+		MType: 'J',
+		Meth:  classloader.JmEntry{Exceptions: exceptions, Cp: &CP},
+	}
+	return &CP
+}
+
+// create an exception object of the given class
+func athrowException(className string) *object.Object {
+	exc := object.MakeEmptyObject()
+	exc.Klass = &className
+	return exc
+}
+
+// ATHROW: exception caught by a handler in the same method
+func TestAthrowCaughtInSameMethod(t *testing.T) {
+	CP := athrowSetup("java/lang/Exception",
+		[]classloader.CodeException{{StartPc: 0, EndPc: 1, HandlerPc: 2, CatchType: 2}})
+
+	f := newFrame(opcodes.ATHROW)
+	f.ClName = "athrowTest"
+	f.MethName = "catcher"
+	f.MethType = "()V"
+	f.CP = CP
+	f.Meth = append(f.Meth, opcodes.RETURN)
+	f.Meth = append(f.Meth, opcodes.NOP) // the handler
+
+	exc := athrowException("java/lang/Exception")
+	push(&f, int64(42)) // this should be cleared from the stack when the exception is caught
+	push(&f, exc)
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	if err != nil {
+		t.Errorf("ATHROW: Expected no error, got: %s", err.Error())
+	}
+	if f.TOS != 0 {
+		t.Errorf("ATHROW: Expected TOS to be 0, got: %d", f.TOS)
+	}
+	if peek(&f) != exc {
+		t.Errorf("ATHROW: Expected the exception at the top of the stack, got: %v", peek(&f))
+	}
+}
+
+// ATHROW: exception caught by a handler whose catch type is a superclass of the exception
+func TestAthrowCaughtBySuperclass(t *testing.T) {
+	CP := athrowSetup("java/lang/Throwable",
+		[]classloader.CodeException{{StartPc: 0, EndPc: 1, HandlerPc: 2, CatchType: 2}})
+
+	f := newFrame(opcodes.ATHROW)
+	f.ClName = "athrowTest"
+	f.MethName = "catcher"
+	f.MethType = "()V"
+	f.CP = CP
+	f.Meth = append(f.Meth, opcodes.RETURN)
+	f.Meth = append(f.Meth, opcodes.NOP) // the handler
+
+	exc := athrowException("java/lang/RuntimeException")
+	push(&f, exc)
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	if err != nil {
+		t.Errorf("ATHROW: Expected no error, got: %s", err.Error())
+	}
+	if f.TOS != 0 || peek(&f) != exc {
+		t.Errorf("ATHROW: Expected the exception to be caught by its superclass")
+	}
+}
+
+// ATHROW: exception not caught in the throwing method, but in the calling method.
+// The frame of the throwing method should be popped off the frame stack.
+func TestAthrowCaughtInCallingMethod(t *testing.T) {
+	CP := athrowSetup("java/lang/Exception",
+		[]classloader.CodeException{{StartPc: 0, EndPc: 3, HandlerPc: 3, CatchType: 0}})
+
+	// the calling method, which has executed a 3-byte invoke instruction at PC 0
+	caller := frames.CreateFrame(6)
+	caller.Ftype = 'J'
+	caller.ClName = "athrowTest"
+	caller.MethName = "catcher"
+	caller.MethType = "()V"
+	caller.CP = CP
+	caller.Meth = []byte{opcodes.INVOKESTATIC, 0x00, 0x01, opcodes.NOP}
+	caller.PC = 3
+
+	f := newFrame(opcodes.ATHROW)
+	f.ClName = "athrowTest"
+	f.MethName = "thrower"
+	f.MethType = "()V"
+	f.CP = CP
+
+	exc := athrowException("java/lang/Exception")
+	push(&f, exc)
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(caller)
+	fs.PushFront(&f)
+	err := runFrame(fs)
+
+	if err != nil {
+		t.Errorf("ATHROW: Expected no error, got: %s", err.Error())
+	}
+	if fs.Len() != 1 {
+		t.Errorf("ATHROW: Expected the throwing frame to be popped, frame stack size is: %d", fs.Len())
+	}
+	if caller.TOS != 0 || peek(caller) != exc {
+		t.Errorf("ATHROW: Expected the exception at the top of the caller's stack")
+	}
+	if caller.PC != 4 { // the handler (NOP) at 3 has been executed
+		t.Errorf("ATHROW: Expected caller's PC to be 4, got: %d", caller.PC)
+	}
+}
+
+// ATHROW: an exception outside the range of the exception table is not caught
+func TestAthrowUncaught(t *testing.T) {
+	CP := athrowSetup("java/lang/RuntimeException",
+		[]classloader.CodeException{{StartPc: 0, EndPc: 1, HandlerPc: 2, CatchType: 2}})
+
+	normalStderr := os.Stderr
+	_, w, _ := os.Pipe()
+	os.Stderr = w
+
+	f := newFrame(opcodes.ATHROW)
+	f.ClName = "athrowTest"
+	f.MethName = "catcher"
+	f.MethType = "()V"
+	f.CP = CP
+	f.Meth = append(f.Meth, opcodes.RETURN)
+	f.Meth = append(f.Meth, opcodes.NOP)
+
+	exc := athrowException("java/lang/Exception") // not a subclass of the catch type
+	push(&f, exc)
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	err := runFrame(fs)
+
+	_ = w.Close()
+	os.Stderr = normalStderr
+
+	if err == nil {
+		t.Errorf("ATHROW: Expected an error for an uncaught exception, but got none")
+	} else if !strings.Contains(err.Error(), "java/lang/Exception") {
+		t.Errorf("ATHROW: Expected error to name the exception, got: %s", err.Error())
+	}
+}
+
+// ATHROW: an exception thrown out of a static initializer is wrapped in an
+// ExceptionInInitializerError, which the code that triggered the initialization can
+// catch. The class is then erroneous, and using it again throws NoClassDefFoundError.
+func TestAthrowOutOfStaticInitializer(t *testing.T) {
+	CP := athrowSetup("java/lang/Error",
+		[]classloader.CodeException{{StartPc: 0, EndPc: 3, HandlerPc: 4, CatchType: 2}})
+	for class, superclass := range map[string]string{
+		"java/lang/Error":                       "java/lang/Throwable",
+		"java/lang/LinkageError":                "java/lang/Error",
+		"java/lang/ExceptionInInitializerError": "java/lang/LinkageError",
+		"java/lang/NoClassDefFoundError":        "java/lang/LinkageError",
+		"java/lang/NullPointerException":        "java/lang/RuntimeException",
+	} {
+		classloader.MethAreaInsert(class, &(classloader.Klass{
+			Status: 'X', Loader: "bootstrap",
+			Data: &classloader.ClData{Name: class, Superclass: superclass}}))
+	}
+
+	// the class athrowTest/Init, whose <clinit> throws a NullPointerException
+	initClass := &classloader.Klass{Status: 'X', Loader: "bootstrap", Data: &classloader.ClData{
+		Name: "athrowTest/Init", Superclass: "java/lang/Object", ClInit: types.ClInitNotRun,
+		MethodTable: map[string]*classloader.Method{"<clinit>()V": {}}}}
+	classloader.MethAreaInsert("athrowTest/Init", initClass)
+	classloader.MTable["athrowTest/Init.<clinit>()V"] = classloader.MTentry{
+		MType: 'J',
+		Meth: classloader.JmEntry{MaxStack: 2, Cp: CP,
+			Code: []byte{opcodes.ACONST_NULL, opcodes.MONITORENTER, opcodes.RETURN}},
+	}
+	CP.CpIndex[3] = classloader.CpEntry{Type: classloader.UTF8, Slot: 1}
+	CP.CpIndex[4] = classloader.CpEntry{Type: classloader.ClassRef, Slot: 1}
+	CP.ClassRefs = append(CP.ClassRefs, 3)
+	CP.Utf8Refs = append(CP.Utf8Refs, "athrowTest/Init")
+
+	f := newFrame(opcodes.NEW)
+	f.ClName = "athrowTest"
+	f.MethName = "catcher"
+	f.MethType = "()V"
+	f.CP = CP
+	f.Meth = append(f.Meth, 0x00, 0x04, opcodes.RETURN, opcodes.NOP) // the handler is the NOP
+
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f)
+	if err := runFrame(fs); err != nil {
+		t.Fatalf("ATHROW: Expected the ExceptionInInitializerError to be caught, got: %s", err.Error())
+	}
+	exc := peek(&f).(*object.Object)
+	if *exc.Klass != "java/lang/ExceptionInInitializerError" {
+		t.Fatalf("ATHROW: Expected an ExceptionInInitializerError, got: %s", *exc.Klass)
+	}
+	if cause := exc.FieldTable["cause"].Fvalue.(*object.Object); *cause.Klass != "java/lang/NullPointerException" {
+		t.Errorf("ATHROW: Expected the NullPointerException to be the cause, got: %s", *cause.Klass)
+	}
+	if initClass.Data.ClInit != types.ClInitFailed || fs.Len() != 1 {
+		t.Errorf("ATHROW: Expected athrowTest/Init to be erroneous and its <clinit> frame popped")
+	}
+
+	// the class's initializer isn't run again
+	f.PC, f.TOS = 0, -1
+	if err := runFrame(fs); err != nil {
+		t.Fatalf("ATHROW: Expected the NoClassDefFoundError to be caught, got: %s", err.Error())
+	}
+	exc = peek(&f).(*object.Object)
+	if *exc.Klass != "java/lang/NoClassDefFoundError" ||
+		getExceptionMessage(exc) != "Could not initialize class athrowTest.Init" {
+		t.Errorf("ATHROW: Expected a NoClassDefFoundError, got: %s: %s", *exc.Klass, getExceptionMessage(exc))
+	}
+}
+
+// initializerSetup posts the class athrowTest/Super, whose <clinit> executes code with
+// the exception table exceptions, and its subclass athrowTest/Sub, whose <clinit> is a
+// golang function that counts how often it's run. It returns the two classes.
+func initializerSetup(code []byte, exceptions []classloader.CodeException, subRuns *int) (
+	*classloader.Klass, *classloader.Klass) {
+	CP := athrowSetup("java/lang/Exception", nil)
+	classloader.MethAreaInsert("java/lang/NullPointerException", &(classloader.Klass{
+		Status: 'X', Loader: "bootstrap",
+		Data: &classloader.ClData{Name: "java/lang/NullPointerException", Superclass: "java/lang/RuntimeException"}}))
+
+	super := &classloader.Klass{Status: 'X', Loader: "bootstrap", Data: &classloader.ClData{
+		Name: "athrowTest/Super", Superclass: "java/lang/Object", ClInit: types.ClInitNotRun,
+		MethodTable: map[string]*classloader.Method{"<clinit>()V": {}}}}
+	classloader.MethAreaInsert("athrowTest/Super", super)
+	classloader.MTable["athrowTest/Super.<clinit>()V"] = classloader.MTentry{
+		MType: 'J',
+		Meth:  classloader.JmEntry{MaxStack: 2, Cp: CP, Code: code, Exceptions: exceptions},
+	}
+
+	sub := &classloader.Klass{Status: 'X', Loader: "bootstrap", Data: &classloader.ClData{
+		Name: "athrowTest/Sub", Superclass: "athrowTest/Super", ClInit: types.ClInitNotRun,
+		MethodTable: map[string]*classloader.Method{"<clinit>()V": {}}}}
+	classloader.MethAreaInsert("athrowTest/Sub", sub)
+	classloader.MTable["athrowTest/Sub.<clinit>()V"] = classloader.MTentry{
+		MType: 'G',
+		Meth: classloader.GMeth{GFunction: func([]interface{}) interface{} {
+			*subRuns += 1
+			return nil
+		}},
+	}
+	return super, sub
+}
+
+// a superclass's static initializer runs as part of the superclass, so the handler in
+// it catches the exception it throws, after which the subclass is initialized
+func TestSuperclassInitializerCatchesOwnException(t *testing.T) {
+	subRuns := 0
+	super, sub := initializerSetup( // null.monitorenter throws a NullPointerException
+		[]byte{opcodes.ACONST_NULL, opcodes.MONITORENTER, opcodes.RETURN, opcodes.POP, opcodes.RETURN},
+		[]classloader.CodeException{{StartPc: 0, EndPc: 2, HandlerPc: 3, CatchType: 0}}, &subRuns)
+
+	caller := newFrame(opcodes.NOP) // the frame of the code that uses the subclass
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&caller)
+	if err := runInitializationBlock(sub, nil, fs); err != nil {
+		t.Fatalf("<clinit>: Expected the superclass to catch its exception, got: %s", err.Error())
+	}
+	if super.Data.ClInit != types.ClInitRun || sub.Data.ClInit != types.ClInitRun {
+		t.Errorf("<clinit>: Expected both classes to be initialized, got: %d and %d",
+			super.Data.ClInit, sub.Data.ClInit)
+	}
+	if subRuns != 1 || fs.Len() != 1 {
+		t.Errorf("<clinit>: Expected the subclass's initializer to run once and its frames to be popped")
+	}
+}
+
+// an exception thrown out of a superclass's static initializer makes both the superclass
+// and its subclass erroneous. The superclass's initializer isn't run again, nor is the
+// subclass's run at all.
+func TestSuperclassInitializerThrows(t *testing.T) {
+	subRuns := 0
+	super, sub := initializerSetup([]byte{opcodes.ACONST_NULL, opcodes.MONITORENTER, opcodes.RETURN},
+		nil, &subRuns)
+
+	caller := newFrame(opcodes.NOP) // the frame of the code that uses the subclass
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&caller)
+	err := runInitializationBlock(sub, nil, fs)
+	if initErr, ok := err.(*initializerError); !ok || *initErr.excObj.Klass != "java/lang/NullPointerException" {
+		t.Fatalf("<clinit>: Expected the superclass's NullPointerException, got: %v", err)
+	}
+	if super.Data.ClInit != types.ClInitFailed || sub.Data.ClInit != types.ClInitFailed {
+		t.Errorf("<clinit>: Expected both classes to be erroneous, got: %d and %d",
+			super.Data.ClInit, sub.Data.ClInit)
+	}
+	if subRuns != 0 || fs.Len() != 1 {
+		t.Errorf("<clinit>: Expected the subclass's initializer not to run and the frames to be popped")
+	}
+
+	// another subclass of the superclass can't be initialized either
+	other := &classloader.Klass{Status: 'X', Loader: "bootstrap", Data: &classloader.ClData{
+		Name: "athrowTest/Other", Superclass: "athrowTest/Super", ClInit: types.ClInitNotRun}}
+	err = runInitializationBlock(other, nil, fs)
+	if exc, ok := err.(*gException); !ok || exc.className != "java/lang/NoClassDefFoundError" ||
+		exc.msg != "Could not initialize class athrowTest.Super" {
+		t.Errorf("<clinit>: Expected a NoClassDefFoundError for the superclass, got: %v", err)
+	}
+	if other.Data.ClInit != types.ClInitFailed {
+		t.Errorf("<clinit>: Expected the other subclass to be erroneous, got: %d", other.Data.ClInit)
+	}
+}
+
+// a class is initialized by one thread: another thread that uses the class waits until
+// the initialization ends, while the initializing thread can use the class at once
+func TestClassInitializedByOneThread(t *testing.T) {
+	globals.InitGlobals("test")
+	log.Init()
+	classloader.InitMethodArea()
+
+	started, release := make(chan bool), make(chan bool)
+	runs := 0
+	k := &classloader.Klass{Status: 'X', Loader: "bootstrap", Data: &classloader.ClData{
+		Name: "test/Slow", Superclass: "java/lang/Object", ClInit: types.ClInitNotRun,
+		MethodTable: map[string]*classloader.Method{"<clinit>()V": {}}}}
+	classloader.MethAreaInsert("test/Slow", k)
+	classloader.MTable["test/Slow.<clinit>()V"] = classloader.MTentry{
+		MType: 'G',
+		Meth: classloader.GMeth{NeedsContext: true, GFunction: func(params []interface{}) interface{} {
+			runs += 1
+			// the initializer uses its own class, which the thread goes on to do
+			if err := runInitializationBlock(k, nil, params[0].(*list.List)); err != nil {
+				t.Errorf("<clinit>: Unexpected error using the class in its initializer: %s", err.Error())
+			}
+			started <- true
+			<-release
+			return nil
+		}},
+	}
+
+	// initialize runs the initialization of test/Slow on the thread whose ID is thread
+	initialize := func(thread int, done chan error) {
+		caller := newFrame(opcodes.NOP)
+		caller.Thread = thread
+		fs := frames.CreateFrameStack()
+		fs.PushFront(&caller)
+		done <- runInitializationBlock(k, nil, fs)
+	}
+	first, second := make(chan error, 1), make(chan error, 1)
+	go initialize(1, first)
+	<-started
+	go initialize(2, second)
+
+	select {
+	case <-second:
+		t.Fatalf("<clinit>: Expected the second thread to wait for the initialization to end")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-first; err != nil {
+		t.Errorf("<clinit>: Unexpected error initializing the class: %s", err.Error())
+	}
+	if err := <-second; err != nil {
+		t.Errorf("<clinit>: Unexpected error for the waiting thread: %s", err.Error())
+	}
+	if runs != 1 || classInitState(k) != types.ClInitRun {
+		t.Errorf("<clinit>: Expected the initializer to run once, ran %d times, state %d", runs, classInitState(k))
+	}
+}
+
+// ATHROW: an exception that a method run from golang code doesn't catch is not reported,
+// but returned to the golang code, which throws it in the Java method that called it,
+// where it can be caught. (This is how an exception thrown by a lambda reaches the
+// try/catch around, for instance, the call of forEach() that runs the lambda.)
+func TestAthrowThroughGolangCaller(t *testing.T) {
+	CP := athrowSetup("java/lang/Exception",
+		[]classloader.CodeException{{StartPc: 0, EndPc: 3, HandlerPc: 3, CatchType: 2}})
+	classloader.MTable["athrowTest.thrower(Ljava/lang/Throwable;)V"] = classloader.MTentry{
+		MType: 'J',
+		Meth: classloader.JmEntry{MaxStack: 1, MaxLocals: 1, Cp: CP,
+			Code: []byte{opcodes.ALOAD_0, opcodes.ATHROW}},
+	}
+
+	normalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	// the golang code runs the method, which throws the exception it's passed
+	caller := frames.CreateFrame(6)
+	caller.Ftype = 'J'
+	caller.ClName = "athrowTest"
+	caller.MethName = "catcher"
+	caller.MethType = "()V"
+	caller.CP = CP
+	caller.Meth = []byte{opcodes.INVOKESTATIC, 0x00, 0x01, opcodes.NOP}
+	caller.PC = 0 // at the invoke instruction, which calls the golang code
+	fs := frames.CreateFrameStack()
+	fs.PushFront(caller)
+
+	exc := athrowException("java/lang/RuntimeException")
+	mtEntry, _ := classloader.MTableFetch("athrowTest.thrower(Ljava/lang/Throwable;)V")
+	_, err := runMethodFromGo(fs, mtEntry, "athrowTest", "thrower", "(Ljava/lang/Throwable;)V", nil, exc)
+
+	_ = w.Close()
+	os.Stderr = normalStderr
+	out, _ := io.ReadAll(r)
+
+	gexc, ok := err.(*gException)
+	if !ok || gexc.excObj != exc {
+		t.Fatalf("ATHROW: Expected the exception to be returned to the golang code, got: %v", err)
+	}
+	if len(gexc.frames) != 1 || gexc.frames[0].MethName != "thrower" {
+		t.Errorf("ATHROW: Expected the exception to record the frame it was thrown from")
+	}
+	if len(out) != 0 {
+		t.Errorf("ATHROW: Expected the exception not to be reported, got: %s", string(out))
+	}
+
+	// the golang code passes it on to the Java method that called it, which catches it
+	catchFrame, err := throwGException(fs, gexc)
+	if err != nil || catchFrame != caller {
+		t.Fatalf("ATHROW: Expected the exception to be caught by the calling method, got: %v", err)
+	}
+	if caller.TOS != 0 || peek(caller) != exc || caller.PC != 3 {
+		t.Errorf("ATHROW: Expected the calling method to resume at its handler with the exception")
+	}
+}
+
 // BIPUSH
 func TestBipush(t *testing.T) {
 	f := newFrame(opcodes.BIPUSH)
@@ -1062,12 +1692,12 @@ func TestDstore(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.Locals[2] != float64(0x22223) {
-		t.Errorf("DSTORE: Expecting 0x22223 in locals[2], got: 0x%x", f.Locals[2])
+	if getLocal(&f, 2) != float64(0x22223) {
+		t.Errorf("DSTORE: Expecting 0x22223 in locals[2], got: 0x%x", getLocal(&f, 2))
 	}
 
-	if f.Locals[3] != float64(0x22223) {
-		t.Errorf("DSTORE: Expecting 0x22223 in locals[3], got: 0x%x", f.Locals[3])
+	if getLocal(&f, 3) != float64(0x22223) {
+		t.Errorf("DSTORE: Expecting 0x22223 in locals[3], got: 0x%x", getLocal(&f, 3))
 	}
 
 	if f.TOS != -1 {
@@ -1087,8 +1717,8 @@ func TestDstore0(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.Locals[0].(float64) != 1.0 {
-		t.Errorf("DSTORE_0: expected locals[0] to be 1.0, got: %f", f.Locals[0].(float64))
+	if getLocal(&f, 0).(float64) != 1.0 {
+		t.Errorf("DSTORE_0: expected locals[0] to be 1.0, got: %f", getLocal(&f, 0).(float64))
 	}
 
 	if f.TOS != -1 {
@@ -1109,8 +1739,8 @@ func TestDstore1(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.Locals[1].(float64) != 1.0 {
-		t.Errorf("DSTORE_1: expected locals[1] to be 1.0, got: %f", f.Locals[1].(float64))
+	if getLocal(&f, 1).(float64) != 1.0 {
+		t.Errorf("DSTORE_1: expected locals[1] to be 1.0, got: %f", getLocal(&f, 1).(float64))
 	}
 
 	if f.TOS != -1 {
@@ -1132,8 +1762,8 @@ func TestDstore2(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.Locals[2].(float64) != 1.0 {
-		t.Errorf("DSTORE_2: expected locals[2] to be 1.0, got: %f", f.Locals[2].(float64))
+	if getLocal(&f, 2).(float64) != 1.0 {
+		t.Errorf("DSTORE_2: expected locals[2] to be 1.0, got: %f", getLocal(&f, 2).(float64))
 	}
 
 	if f.TOS != -1 {
@@ -1156,8 +1786,8 @@ func TestDstore3(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.Locals[3].(float64) != 1.0 {
-		t.Errorf("DSTORE_3: expected locals[3] to be 1.0, got: %f", f.Locals[3].(float64))
+	if getLocal(&f, 3).(float64) != 1.0 {
+		t.Errorf("DSTORE_3: expected locals[3] to be 1.0, got: %f", getLocal(&f, 3).(float64))
 	}
 
 	if f.TOS != -1 {
@@ -1784,8 +2414,8 @@ func TestFstore(t *testing.T) {
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
 
-	if f.Locals[2] != float64(0x22223) {
-		t.Errorf("FSTORE: Expecting 0x22223 in locals[2], got: 0x%x", f.Locals[2])
+	if getLocal(&f, 2) != float64(0x22223) {
+		t.Errorf("FSTORE: Expecting 0x22223 in locals[2], got: 0x%x", getLocal(&f, 2))
 	}
 
 	if f.TOS != -1 {
@@ -1801,8 +2431,8 @@ func TestFstore0(t *testing.T) {
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	if f.Locals[0].(float64) != 1.0 {
-		t.Errorf("FSTORE_0: expected lcoals[0] to be 1.0, got: %f", f.Locals[0].(float64))
+	if getLocal(&f, 0).(float64) != 1.0 {
+		t.Errorf("FSTORE_0: expected lcoals[0] to be 1.0, got: %f", getLocal(&f, 0).(float64))
 	}
 	if f.TOS != -1 {
 		t.Errorf("FSTORE_0: Expected op stack to be empty, got tos: %d", f.TOS)
@@ -1818,8 +2448,8 @@ func TestFstore1(t *testing.T) {
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	if f.Locals[1].(float64) != 1.0 {
-		t.Errorf("FSTORE_1: expected lcoals[1] to be 1.0, got: %f", f.Locals[1].(float64))
+	if getLocal(&f, 1).(float64) != 1.0 {
+		t.Errorf("FSTORE_1: expected lcoals[1] to be 1.0, got: %f", getLocal(&f, 1).(float64))
 	}
 	if f.TOS != -1 {
 		t.Errorf("FSTORE_1: Expected op stack to be empty, got tos: %d", f.TOS)
@@ -1836,8 +2466,8 @@ func TestFstore2(t *testing.T) {
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	if f.Locals[2].(float64) != 1.0 {
-		t.Errorf("FSTORE_2: expected lcoals[2] to be 1.0, got: %f", f.Locals[2].(float64))
+	if getLocal(&f, 2).(float64) != 1.0 {
+		t.Errorf("FSTORE_2: expected lcoals[2] to be 1.0, got: %f", getLocal(&f, 2).(float64))
 	}
 	if f.TOS != -1 {
 		t.Errorf("FSTORE_2: Expected op stack to be empty, got tos: %d", f.TOS)
@@ -1856,8 +2486,8 @@ func TestFstore3(t *testing.T) {
 	fs := frames.CreateFrameStack()
 	fs.PushFront(&f) // push the new frame
 	_ = runFrame(fs)
-	if f.Locals[3].(float64) != 1.0 {
-		t.Errorf("FSTORE_3: expected lcoals[3] to be 1.0, got: %f", f.Locals[3].(float64))
+	if getLocal(&f, 3).(float64) != 1.0 {
+		t.Errorf("FSTORE_3: expected lcoals[3] to be 1.0, got: %f", getLocal(&f, 3).(float64))
 	}
 	if f.TOS != -1 {
 		t.Errorf("FSTORE_3: Expected op stack to be empty, got tos: %d", f.TOS)
@@ -2077,6 +2707,36 @@ func TestGotoBackward(t *testing.T) {
 	}
 }
 
+// GOTO_W: in forward direction, using a four-byte offset
+func TestGotoWForward(t *testing.T) {
+	f := newFrame(opcodes.GOTO_W)
+	f.Meth = append(f.Meth, 0x00, 0x00, 0x00, 0x07)
+	f.Meth = append(f.Meth, opcodes.NOP)
+	f.Meth = append(f.Meth, opcodes.NOP)
+	f.Meth = append(f.Meth, opcodes.RETURN)
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+	if f.Meth[f.PC] != opcodes.RETURN {
+		t.Errorf("GOTO_W forward: Expected pc to point to RETURN, but instead it points to : %s", opcodes.BytecodeNames[f.Meth[f.PC]])
+	}
+}
+
+// GOTO_W: go to instruction in backward direction, using a four-byte offset
+func TestGotoWBackward(t *testing.T) {
+	f := newFrame(opcodes.RETURN)
+	f.Meth = append(f.Meth, opcodes.GOTO_W)
+	f.Meth = append(f.Meth, 0xFF, 0xFF, 0xFF, 0xFF) // should be -1
+	f.Meth = append(f.Meth, opcodes.BIPUSH)
+	f.PC = 1 // skip over the return instruction to start, catch it on the backward goto
+	fs := frames.CreateFrameStack()
+	fs.PushFront(&f) // push the new frame
+	_ = runFrame(fs)
+	if f.Meth[f.PC] != opcodes.RETURN {
+		t.Errorf("GOTO_W backward: Expected pc to point to RETURN, but instead it points to : %s", opcodes.BytecodeNames[f.Meth[f.PC]])
+	}
+}
+
 // I2B: convert int to Java char (16-bit value)
 func TestI2B(t *testing.T) {
 	f := newFrame(opcodes.I2B)
@@ -0,0 +1,183 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"jacobin/object"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Jacobin's threads run on goroutines, so the way the instructions of different threads
+// interleave is chosen by the Go runtime, and differs from run to run, which makes races
+// in Java code hard to reproduce. With -XX:DeterministicScheduling=<seed>, threads are
+// instead run one at a time by a cooperative scheduler: a thread runs only while it has
+// the turn, which it gives up at yield points to a thread chosen by a pseudo-random
+// number generator seeded with <seed>. So the interleaving is the same every time the
+// program is run with the same seed (and the same input).
+//
+// The yield points are the boundaries between bytecodes (which include MONITORENTER,
+// MONITOREXIT, and the invocation of synchronized methods) and the points where a
+// thread would block: entering a monitor that another thread holds, wait(), sleep(),
+// join(), and park(). A thread that would block polls instead: it checks whether it can
+// go on and, if it can't, passes the turn to the next thread in the order they were
+// started. It draws no number to do so, so the draws don't depend on how long it polls.
+//
+// Only timeouts depend on the clock, so the interleaving of a program whose threads
+// time out (in sleep(), or in a timed wait(), join(), or park()) can differ from run to
+// run, as the timeout can elapse at a different point. The closure tier, which runs
+// many bytecodes at a time, is not used while scheduling is deterministic.
+
+// threadScheduler is the state of the deterministic scheduler. The thread that has the
+// turn is the only one that's not waiting on its channel in turns.
+type threadScheduler struct {
+	mutex   sync.Mutex
+	random  *rand.Rand
+	threads []int                 // the IDs of the scheduled threads, in the order they were started
+	turns   map[int]chan struct{} // a thread is given the turn by a send on its channel
+}
+
+// scheduler is the deterministic scheduler, which is nil unless -XX:DeterministicScheduling is specified
+var scheduler *threadScheduler
+
+// newThreadScheduler returns a scheduler whose choices are determined by seed
+func newThreadScheduler(seed int64) *threadScheduler {
+	return &threadScheduler{
+		random: rand.New(rand.NewSource(seed)),
+		turns:  make(map[int]chan struct{}),
+	}
+}
+
+// startScheduling schedules the main thread, which has the turn, if scheduling is
+// deterministic. It's called before execution begins.
+func startScheduling() {
+	if scheduler == nil {
+		return
+	}
+	scheduler.addThread(MainThread.ID)
+	object.Yield = func(thread int) { scheduler.pause(schedulingID(thread)) }
+}
+
+// schedulingID returns the ID under which the thread whose ID is id is scheduled.
+// Frames created outside of a thread have an ID of 0, and run on the main thread.
+func schedulingID(id int) int {
+	if isMainThread(id) {
+		return MainThread.ID
+	}
+	return id
+}
+
+// addThread schedules the thread whose ID is id. It's called before the thread is
+// started, by the thread that starts it, which has the turn; the first thread to be
+// scheduled is given the turn.
+func (s *threadScheduler) addThread(id int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.threads = append(s.threads, id)
+	s.turns[id] = make(chan struct{}, 1)
+}
+
+// awaitTurn is called by a thread when it starts, and returns when it has the turn
+func (s *threadScheduler) awaitTurn(id int) {
+	s.mutex.Lock()
+	turn := s.turns[id]
+	s.mutex.Unlock()
+	<-turn
+}
+
+// removeThread is called by the thread whose ID is id, which has the turn, when it
+// ends. It gives the turn to a thread chosen at random.
+func (s *threadScheduler) removeThread(id int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, thread := range s.threads {
+		if thread == id {
+			s.threads = append(s.threads[:i], s.threads[i+1:]...)
+			break
+		}
+	}
+	delete(s.turns, id)
+	if len(s.threads) > 0 {
+		s.turns[s.threads[s.random.Intn(len(s.threads))]] <- struct{}{}
+	}
+}
+
+// yield is called by the thread whose ID is id, which has the turn, at a yield point.
+// The turn is given to a thread chosen at random, which might be the same thread; if
+// it's another, yield returns when the thread has the turn again.
+func (s *threadScheduler) yield(id int) {
+	s.mutex.Lock()
+	if _, ok := s.turns[id]; !ok || len(s.threads) < 2 {
+		s.mutex.Unlock()
+		return
+	}
+	next := s.threads[s.random.Intn(len(s.threads))]
+	s.handOver(id, next)
+}
+
+// pause is called, in place of blocking, by the thread whose ID is id, which has the
+// turn. The turn is given to the next thread, in the order they were started, and
+// pause returns when the thread has the turn again. If it's the only thread, it sleeps
+// briefly instead, as only a timeout can then end its wait.
+func (s *threadScheduler) pause(id int) {
+	s.mutex.Lock()
+	if _, ok := s.turns[id]; !ok || len(s.threads) < 2 {
+		s.mutex.Unlock()
+		time.Sleep(time.Millisecond)
+		return
+	}
+	next := s.threads[0]
+	for i, thread := range s.threads[:len(s.threads)-1] {
+		if thread == id {
+			next = s.threads[i+1]
+		}
+	}
+	s.handOver(id, next)
+}
+
+// handOver gives the turn of the thread whose ID is id to the thread whose ID is next,
+// and returns when the thread has the turn again. Must be called with s.mutex held,
+// which it unlocks.
+func (s *threadScheduler) handOver(id, next int) {
+	if next == id {
+		s.mutex.Unlock()
+		return
+	}
+	turn := s.turns[id]
+	s.turns[next] <- struct{}{}
+	s.mutex.Unlock()
+	<-turn
+}
+
+// block blocks the thread whose ID is id until channel a or b is closed, or timer
+// fires. Any of them can be nil. If scheduling is deterministic, the thread polls them,
+// pausing between polls, rather than blocking.
+func block(id int, timer <-chan time.Time, a, b <-chan struct{}) {
+	if scheduler == nil {
+		select {
+		case <-a:
+		case <-b:
+		case <-timer:
+		}
+		return
+	}
+
+	for {
+		select {
+		case <-a:
+			return
+		case <-b:
+			return
+		case <-timer:
+			return
+		default:
+			scheduler.pause(schedulingID(id))
+		}
+	}
+}
@@ -0,0 +1,270 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"jacobin/frames"
+	"math"
+)
+
+// The operand stack and the local variables of a frame hold primitive values unboxed,
+// in the parallel arrays OpPrims and LocalPrims (see frames.Frame). The functions here
+// move values in and out of them. The typed functions (pushInt(), popDouble(), etc.)
+// are used by the instructions that know the type of the value they handle, such as
+// IADD or DLOAD, and they never box the value. push(), pop(), and peek() in run.go
+// handle values of any type, and so box and unbox primitives as needed. As these
+// functions are run by nearly every instruction, each checks only once whether the
+// frame's thread is being traced.
+//
+// Longs and doubles occupy two slots on the operand stack and in the local variables,
+// and both slots hold the value.
+//
+// Local variables can also be set up with boxed int64 and float64 values (as the code
+// that creates frames, and many tests, do), so the functions that load primitives from
+// the local variables accept those as well.
+
+// slot is the contents of one slot of the operand stack or of the local variables:
+// value is the entry in OpStack or Locals and prim is the entry in OpPrims or LocalPrims.
+// It's used to move values whose type is not known, without boxing primitives.
+type slot struct {
+	value interface{}
+	prim  int64
+}
+
+// slotValue returns the value held in a slot, boxing it if it's a primitive
+func slotValue(value interface{}, prim int64) interface{} {
+	switch value {
+	case frames.PrimInt:
+		return prim
+	case frames.PrimFloat:
+		return math.Float64frombits(uint64(prim))
+	}
+	return value
+}
+
+// toSlot converts a value of any type into the slot that holds it, unboxing it if it's
+// an int64 or a float64.
+func toSlot(x interface{}) slot {
+	switch v := x.(type) {
+	case int64:
+		return slot{frames.PrimInt, v}
+	case float64:
+		return slot{frames.PrimFloat, int64(math.Float64bits(v))}
+	}
+	return slot{x, 0}
+}
+
+// ---- the operand stack ----
+
+// pushSlot pushes the contents of a slot onto the operand stack
+func pushSlot(f *frames.Frame, s slot) {
+	if s.value != frames.PrimInt && s.value != frames.PrimFloat {
+		s = toSlot(s.value) // a boxed primitive is unboxed
+	}
+	if f.TOS == len(f.OpStack)-1 {
+		panic(errOperandStackOverflow)
+	}
+	trace := traced(f)
+	if trace {
+		tracePush(f, slotValue(s.value, s.prim))
+	}
+	f.TOS += 1
+	f.OpStack[f.TOS] = s.value
+	f.OpPrims[f.TOS] = s.prim
+	if trace {
+		logTraceStack(f)
+	}
+}
+
+// popSlot pops the slot at the top of the operand stack
+func popSlot(f *frames.Frame) slot {
+	if f.TOS == -1 {
+		panic(errOperandStackUnderflow)
+	}
+	trace := traced(f)
+	s := slot{f.OpStack[f.TOS], f.OpPrims[f.TOS]}
+	if trace {
+		tracePop(f, slotValue(s.value, s.prim))
+	}
+	f.TOS -= 1
+	if trace {
+		logTraceStack(f)
+	}
+	return s
+}
+
+// peekSlot returns the slot at the top of the operand stack without popping it
+func peekSlot(f *frames.Frame) slot {
+	if f.TOS == -1 {
+		panic(errOperandStackUnderflow)
+	}
+	return slot{f.OpStack[f.TOS], f.OpPrims[f.TOS]}
+}
+
+// pushPrim pushes a primitive value of the kind given by prim
+func pushPrim(f *frames.Frame, kind frames.PrimSlot, v int64) {
+	if f.TOS == len(f.OpStack)-1 {
+		panic(errOperandStackOverflow)
+	}
+	trace := traced(f)
+	if trace {
+		tracePush(f, slotValue(kind, v))
+	}
+	f.TOS += 1
+	f.OpStack[f.TOS] = kind
+	f.OpPrims[f.TOS] = v
+	if trace {
+		logTraceStack(f)
+	}
+}
+
+// popPrim pops a primitive value, which is returned as held in the slot
+func popPrim(f *frames.Frame) int64 {
+	if f.TOS == -1 {
+		panic(errOperandStackUnderflow)
+	}
+	trace := traced(f)
+	v := f.OpPrims[f.TOS]
+	if trace {
+		tracePop(f, slotValue(f.OpStack[f.TOS], v))
+	}
+	f.TOS -= 1
+	if trace {
+		logTraceStack(f)
+	}
+	return v
+}
+
+// pushInt pushes an int (or a boolean, byte, char, or short)
+func pushInt(f *frames.Frame, v int64) {
+	pushPrim(f, frames.PrimInt, v)
+}
+
+// popInt pops an int (or a boolean, byte, char, or short)
+func popInt(f *frames.Frame) int64 {
+	return popPrim(f)
+}
+
+// pushFloat pushes a float
+func pushFloat(f *frames.Frame, v float64) {
+	pushPrim(f, frames.PrimFloat, int64(math.Float64bits(v)))
+}
+
+// popFloat pops a float
+func popFloat(f *frames.Frame) float64 {
+	return math.Float64frombits(uint64(popPrim(f)))
+}
+
+// pushLong pushes a long, which occupies two slots
+func pushLong(f *frames.Frame, v int64) {
+	pushPrim(f, frames.PrimInt, v)
+	pushPrim(f, frames.PrimInt, v)
+}
+
+// popLong pops a long, which occupies two slots
+func popLong(f *frames.Frame) int64 {
+	popPrim(f)
+	return popPrim(f)
+}
+
+// pushDouble pushes a double, which occupies two slots
+func pushDouble(f *frames.Frame, v float64) {
+	bits := int64(math.Float64bits(v))
+	pushPrim(f, frames.PrimFloat, bits)
+	pushPrim(f, frames.PrimFloat, bits)
+}
+
+// popDouble pops a double, which occupies two slots
+func popDouble(f *frames.Frame) float64 {
+	popPrim(f)
+	return math.Float64frombits(uint64(popPrim(f)))
+}
+
+// ---- the local variables ----
+
+// getLocal returns the value of local variable index, boxing it if it's a primitive
+func getLocal(f *frames.Frame, index int) interface{} {
+	return slotValue(f.Locals[index], localPrim(f, index))
+}
+
+// localPrim returns the primitive slot of local variable index. The frame's locals
+// might have been set up without primitive slots, in which case it's 0.
+func localPrim(f *frames.Frame, index int) int64 {
+	if index < len(f.LocalPrims) {
+		return f.LocalPrims[index]
+	}
+	return 0
+}
+
+// loadSlot returns the slot of local variable index
+func loadSlot(f *frames.Frame, index int) slot {
+	return slot{f.Locals[index], localPrim(f, index)}
+}
+
+// storeSlot stores the contents of a slot in local variable index
+func storeSlot(f *frames.Frame, index int, s slot) {
+	if len(f.LocalPrims) < len(f.Locals) {
+		growLocalPrims(f)
+	}
+	f.Locals[index] = s.value
+	f.LocalPrims[index] = s.prim
+}
+
+// growLocalPrims makes LocalPrims as long as Locals, for frames whose local variables
+// were set up (or extended) without their primitive slots
+func growLocalPrims(f *frames.Frame) {
+	prims := make([]int64, len(f.Locals))
+	copy(prims, f.LocalPrims)
+	f.LocalPrims = prims
+}
+
+// loadInt returns the int (or long) in local variable index
+func loadInt(f *frames.Frame, index int) int64 {
+	if f.Locals[index] == frames.PrimInt {
+		return f.LocalPrims[index]
+	}
+	return f.Locals[index].(int64) // a boxed value
+}
+
+// storeInt stores an int in local variable index
+func storeInt(f *frames.Frame, index int, v int64) {
+	storePrim(f, index, frames.PrimInt, v)
+}
+
+// storePrim stores a primitive value of the kind given by kind in local variable index
+func storePrim(f *frames.Frame, index int, kind frames.PrimSlot, v int64) {
+	if len(f.LocalPrims) < len(f.Locals) {
+		growLocalPrims(f)
+	}
+	f.Locals[index] = kind
+	f.LocalPrims[index] = v
+}
+
+// loadFloat returns the float (or double) in local variable index
+func loadFloat(f *frames.Frame, index int) float64 {
+	if f.Locals[index] == frames.PrimFloat {
+		return math.Float64frombits(uint64(f.LocalPrims[index]))
+	}
+	return f.Locals[index].(float64) // a boxed value
+}
+
+// storeFloat stores a float in local variable index
+func storeFloat(f *frames.Frame, index int, v float64) {
+	storePrim(f, index, frames.PrimFloat, int64(math.Float64bits(v)))
+}
+
+// storeLong stores a long in local variables index and index+1
+func storeLong(f *frames.Frame, index int, v int64) {
+	storeInt(f, index, v)
+	storeInt(f, index+1, v)
+}
+
+// storeDouble stores a double in local variables index and index+1
+func storeDouble(f *frames.Frame, index int, v float64) {
+	storeFloat(f, index, v)
+	storeFloat(f, index+1, v)
+}
@@ -0,0 +1,846 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"container/list"
+	"jacobin/classloader"
+	"jacobin/exceptions"
+	"jacobin/frames"
+	"jacobin/globals"
+	"jacobin/log"
+	"jacobin/object"
+	"jacobin/shutdown"
+	"jacobin/thread"
+	"jacobin/types"
+	"math"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Java threads are run on goroutines. Thread.start() creates an ExecThread, with its
+// own frame stack, and runs the thread's run() method on it in a new goroutine. The
+// methods of java.lang.Thread that create, start, and wait for threads are implemented
+// here in golang; they're placed in the MTable by loadThreadMethods(), so they take
+// the place of the JDK's implementation.
+//
+// The state of each Thread object is kept here, in a javaThread, rather than in the
+// object's fields. The main thread's Thread object is created the first time it's asked
+// for (by Thread.currentThread()).
+//
+// As in the JDK, the VM exits when the main thread and every non-daemon thread have
+// ended (see waitForThreads()). A thread is a daemon thread if the thread that created
+// it is, unless Thread.setDaemon() is called before it's started.
+//
+// Object.wait(), notify(), and notifyAll() are implemented here too, using the wait
+// sets of the object monitors (see object/monitor.go). Thread.interrupt() sets the
+// thread's interrupt status and wakes the thread if it's in wait(), sleep(), or join(),
+// which then throw InterruptedException.
+//
+// LockSupport.park() and unpark(), which the locks and other classes of
+// java.util.concurrent block and wake threads with, go through Unsafe.park() and
+// unpark(), which are implemented here too: each thread has a permit, which unpark()
+// makes available, and park() waits for and consumes.
+
+// javaThread is the state of a java.lang.Thread object
+type javaThread struct {
+	exec    *thread.ExecThread // the thread running the Thread, nil until it's started
+	target  interface{}        // the Runnable passed to the constructor, if any
+	name    string
+	daemon  bool
+	virtual bool // a virtual thread (see virtualThreads.go)
+	started bool
+	done    chan struct{} // closed when the thread ends
+
+	interrupted bool          // the interrupt status
+	wakeup      chan struct{} // while the thread waits, closed to interrupt it (or, if it's parked, to unpark it)
+	permit      bool          // the permit that park() consumes, made available by unpark()
+	parked      bool          // whether the thread is waiting in park()
+
+	onEnd func() // if set, called once the thread has ended
+}
+
+// javaThreads holds the state of every Thread object whose thread has not ended, and
+// threadObjects the Thread object of every running thread, by thread ID. javaThreadsMutex
+// guards both, as well as the fields of the javaThreads and threadInitNumber. When a
+// thread ends, its Thread object is removed from both, so that it can be collected once
+// the program no longer uses it: what's left of its state is kept in its own fields.
+var javaThreads = make(map[*object.Object]*javaThread)
+var threadObjects = make(map[int]*object.Object)
+var javaThreadsMutex sync.Mutex
+
+// threadInitNumber numbers the threads that are not given a name, as Thread-0, Thread-1, etc.
+var threadInitNumber int
+
+// nonDaemonThreads counts the non-daemon threads that are running, other than main
+var nonDaemonThreads sync.WaitGroup
+
+// threadTracing is set once a thread other than the main thread is started with
+// tracing on, so that traced() needs to look up the thread only in that case.
+var threadTracing atomic.Bool
+
+// loadThreadMethods places the golang implementations of the methods of java.lang.Thread,
+// of the methods of java.lang.Object that wait on and notify its monitor, and of
+// Unsafe.park() and unpark() in the MTable, along with those that create virtual threads.
+// It's called after the MTable is loaded with the other native methods.
+func loadThreadMethods() {
+	objectMethods := map[string]classloader.GMeth{
+		"notify()V":    {ParamSlots: 0, ObjectRef: true, NeedsContext: true, GFunction: objectNotify},
+		"notifyAll()V": {ParamSlots: 0, ObjectRef: true, NeedsContext: true, GFunction: objectNotifyAll},
+		"wait()V":      {ParamSlots: 0, ObjectRef: true, NeedsContext: true, GFunction: objectWait},
+		"wait(J)V":     {ParamSlots: 2, ObjectRef: true, NeedsContext: true, GFunction: objectWait},
+		"wait(JI)V":    {ParamSlots: 3, ObjectRef: true, NeedsContext: true, GFunction: objectWait},
+	}
+	threadMethods := map[string]classloader.GMeth{
+		"<init>()V":                                       {ParamSlots: 0, ObjectRef: true, NeedsContext: true, GFunction: threadInit},
+		"<init>(Ljava/lang/Runnable;)V":                   {ParamSlots: 1, ObjectRef: true, NeedsContext: true, GFunction: threadInit},
+		"<init>(Ljava/lang/String;)V":                     {ParamSlots: 1, ObjectRef: true, NeedsContext: true, GFunction: threadInit},
+		"<init>(Ljava/lang/Runnable;Ljava/lang/String;)V": {ParamSlots: 2, ObjectRef: true, NeedsContext: true, GFunction: threadInit},
+		"currentThread()Ljava/lang/Thread;":               {ParamSlots: 0, NeedsContext: true, GFunction: threadCurrentThread},
+		"getName()Ljava/lang/String;":                     {ParamSlots: 0, ObjectRef: true, GFunction: threadGetName},
+		"interrupt()V":                                    {ParamSlots: 0, ObjectRef: true, GFunction: threadInterrupt},
+		"interrupted()Z":                                  {ParamSlots: 0, NeedsContext: true, GFunction: threadInterrupted},
+		"isAlive()Z":                                      {ParamSlots: 0, ObjectRef: true, GFunction: threadIsAlive},
+		"isDaemon()Z":                                     {ParamSlots: 0, ObjectRef: true, GFunction: threadIsDaemon},
+		"isInterrupted()Z":                                {ParamSlots: 0, ObjectRef: true, GFunction: threadIsInterrupted},
+		"join()V":                                         {ParamSlots: 0, ObjectRef: true, NeedsContext: true, GFunction: threadJoin},
+		"join(J)V":                                        {ParamSlots: 2, ObjectRef: true, NeedsContext: true, GFunction: threadJoin},
+		"run()V":                                          {ParamSlots: 0, ObjectRef: true, NeedsContext: true, GFunction: threadRun},
+		"setDaemon(Z)V":                                   {ParamSlots: 1, ObjectRef: true, GFunction: threadSetDaemon},
+		"setName(Ljava/lang/String;)V":                    {ParamSlots: 1, ObjectRef: true, GFunction: threadSetName},
+		"sleep(J)V":                                       {ParamSlots: 2, NeedsContext: true, GFunction: threadSleep},
+		"start()V":                                        {ParamSlots: 0, ObjectRef: true, NeedsContext: true, GFunction: threadStart},
+	}
+	unsafeMethods := map[string]classloader.GMeth{
+		"park(ZJ)V":                   {ParamSlots: 3, ObjectRef: true, NeedsContext: true, GFunction: unsafePark},
+		"unpark(Ljava/lang/Object;)V": {ParamSlots: 1, ObjectRef: true, GFunction: unsafeUnpark},
+	}
+
+	classloader.MTmutex.Lock()
+	for sig, gmeth := range objectMethods {
+		classloader.MTable["java/lang/Object."+sig] = classloader.MTentry{MType: 'G', Meth: gmeth}
+	}
+	for sig, gmeth := range threadMethods {
+		classloader.MTable["java/lang/Thread."+sig] = classloader.MTentry{MType: 'G', Meth: gmeth}
+	}
+	for sig, gmeth := range unsafeMethods {
+		classloader.MTable["jdk/internal/misc/Unsafe."+sig] = classloader.MTentry{MType: 'G', Meth: gmeth}
+	}
+	classloader.MTmutex.Unlock()
+
+	loadVirtualThreadMethods()
+}
+
+// threadTerminated is the threadStatus of a Thread object whose thread has ended, as in
+// HotSpot (JVMTI_THREAD_STATE_TERMINATED)
+const threadTerminated = int64(0x0002)
+
+// getJavaThread returns the state of the Thread object obj, creating it if obj has
+// none, which is the case for objects whose constructor has not run. Must be called
+// with javaThreadsMutex held.
+func getJavaThread(obj *object.Object) *javaThread {
+	jt := javaThreads[obj]
+	if jt == nil {
+		if jt = endedJavaThread(obj); jt != nil {
+			return jt
+		}
+		jt = &javaThread{name: nextThreadName(), done: make(chan struct{})}
+		javaThreads[obj] = jt
+	}
+	return jt
+}
+
+// saveEndedThread stores the state of the Thread object obj, whose thread has ended, in
+// the fields of obj that hold it in the JDK: its name, whether it's a daemon, its
+// interrupt status, and its status. Must be called with javaThreadsMutex held.
+func saveEndedThread(obj *object.Object, jt *javaThread) {
+	lock := object.FieldLock(obj)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if obj.FieldTable == nil {
+		obj.FieldTable = make(map[string]*object.Field)
+	}
+	obj.FieldTable["name"] = &object.Field{Ftype: "Ljava/lang/String;",
+		Fvalue: object.CreateCompactStringFromGoString(&jt.name)}
+	obj.FieldTable["daemon"] = &object.Field{Ftype: types.Bool,
+		Fvalue: types.ConvertGoBoolToJavaBool(jt.daemon)}
+	obj.FieldTable["interrupted"] = &object.Field{Ftype: types.Bool,
+		Fvalue: types.ConvertGoBoolToJavaBool(jt.interrupted)}
+	obj.FieldTable["threadStatus"] = &object.Field{Ftype: types.Int, Fvalue: threadTerminated}
+}
+
+// endedJavaThread returns the state of the Thread object obj as saved by
+// saveEndedThread(), or nil if its thread has not ended. The state is not added to
+// javaThreads. Must be called with javaThreadsMutex held.
+func endedJavaThread(obj *object.Object) *javaThread {
+	lock := object.FieldLock(obj)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	status, ok := obj.FieldTable["threadStatus"]
+	if !ok || status.Fvalue != threadTerminated {
+		return nil
+	}
+	jt := &javaThread{started: true, done: make(chan struct{})}
+	close(jt.done)
+	jt.name, _ = objectToString(obj.FieldTable["name"].Fvalue.(*object.Object), nil)
+	jt.daemon = obj.FieldTable["daemon"].Fvalue == types.JavaBoolTrue
+	jt.interrupted = obj.FieldTable["interrupted"].Fvalue == types.JavaBoolTrue
+	jt.virtual = *obj.Klass == virtualThreadClass
+	return jt
+}
+
+// nextThreadName returns the name given to a thread that's not named by its creator.
+// Must be called with javaThreadsMutex held.
+func nextThreadName() string {
+	name := "Thread-" + strconv.Itoa(threadInitNumber)
+	threadInitNumber += 1
+	return name
+}
+
+// currentThreadID returns the ID of the thread that's running the frame stack fs
+func currentThreadID(fs *list.List) int {
+	if fs == nil || fs.Len() == 0 {
+		return MainThread.ID
+	}
+	return fs.Front().Value.(*frames.Frame).Thread
+}
+
+// isMainThread reports whether the thread whose ID is id is the main thread. Frames
+// created outside of a thread (such as in unit tests) have an ID of 0 and are treated
+// as running on the main thread.
+func isMainThread(id int) bool {
+	return id == MainThread.ID || id == 0
+}
+
+// traced reports whether the instructions executed in frame f are traced. Tracing is
+// set for each thread: the main thread is traced if -trace is specified, and every
+// other thread is traced if the thread that started it is.
+func traced(f *frames.Frame) bool {
+	if isMainThread(f.Thread) {
+		return MainThread.Trace
+	}
+	if !threadTracing.Load() {
+		return false
+	}
+
+	glob := globals.GetGlobalRef()
+	glob.ThreadLock.Lock()
+	t, ok := glob.Threads[f.Thread].(*thread.ExecThread)
+	glob.ThreadLock.Unlock()
+	return ok && t.Trace
+}
+
+// threadName returns the name of the thread whose ID is id
+func threadName(id int) string {
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+
+	if obj, ok := threadObjects[id]; ok {
+		return javaThreads[obj].name
+	}
+	return "main"
+}
+
+// java/lang/Thread.<init>(), <init>(Runnable), <init>(String), and <init>(Runnable, String).
+// The arguments, if any, follow the Thread object and precede the frame stack.
+func threadInit(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	fs := params[len(params)-1].(*list.List)
+
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+
+	jt := javaThreads[obj]
+	if jt == nil {
+		jt = &javaThread{done: make(chan struct{})}
+		javaThreads[obj] = jt
+	}
+	for _, arg := range params[1 : len(params)-1] {
+		argObj, ok := arg.(*object.Object)
+		if !ok || object.IsNull(argObj) {
+			continue
+		}
+		if *argObj.Klass == "java/lang/String" {
+			jt.name, _ = objectToString(argObj, nil)
+		} else {
+			jt.target = argObj
+		}
+	}
+	if jt.name == "" {
+		jt.name = nextThreadName()
+	}
+
+	// a new thread is a daemon thread if the thread that creates it is
+	if creator, ok := threadObjects[currentThreadID(fs)]; ok {
+		jt.daemon = javaThreads[creator].daemon
+	}
+	return nil
+}
+
+// java/lang/Thread.start() starts the thread: its run() method is executed on a new
+// ExecThread in a goroutine of its own
+func threadStart(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	fs := params[1].(*list.List)
+	return startThread(obj, traced(fs.Front().Value.(*frames.Frame))) // a thread is traced if its starter is
+}
+
+// startThread starts the thread of the Thread object obj, which is traced if trace is
+// true. It returns the IllegalThreadStateException to throw if it's already started.
+func startThread(obj *object.Object, trace bool) interface{} {
+	javaThreadsMutex.Lock()
+	jt := getJavaThread(obj)
+	if jt.started {
+		javaThreadsMutex.Unlock()
+		return newGException("java/lang/IllegalThreadStateException", "")
+	}
+	jt.started = true
+
+	t := thread.CreateThread()
+	t.Stack = frames.CreateFrameStack()
+	t.Trace = trace
+	t.Virtual = jt.virtual
+	jt.exec = &t
+	threadObjects[t.ID] = obj
+	javaThreadsMutex.Unlock()
+
+	if t.Trace {
+		threadTracing.Store(true)
+	}
+	t.AddThreadToTable(globals.GetGlobalRef())
+	if !jt.daemon {
+		nonDaemonThreads.Add(1)
+	}
+	if scheduler != nil {
+		scheduler.addThread(t.ID)
+	}
+
+	go runJavaThread(obj, jt)
+	return nil
+}
+
+// runJavaThread runs the run() method of the Thread object obj on its ExecThread. It's
+// the body of the goroutine started by Thread.start().
+func runJavaThread(obj *object.Object, jt *javaThread) {
+	t := jt.exec
+
+	defer func() {
+		// only an untrapped panic gets us here, as in runThread()
+		if r := recover(); r != nil {
+			glob := globals.GetGlobalRef()
+			glob.ErrorGoStack = string(debug.Stack())
+			exceptions.ShowPanicCause(r)
+			exceptions.ShowFrameStack(t)
+			exceptions.ShowGoStackTrace(nil)
+			shutdown.Exit(shutdown.APP_EXCEPTION)
+		}
+		endJavaThread(obj, jt)
+	}()
+
+	if scheduler != nil {
+		scheduler.awaitTurn(t.ID)
+	}
+
+	// the bottom frame of the thread's frame stack stands for start(), which calls run()
+	base := frames.CreateFrame(1)
+	base.Thread = t.ID
+	base.Ftype = 'J'
+	base.ClName = "java/lang/Thread"
+	base.MethName = "start"
+	base.MethType = "()V"
+	t.Stack.PushFront(base)
+
+	// an exception that's not caught by the thread is reported, and ends only this
+	// thread, so the error is not passed on.
+	entry, excType, err := selectMethod(classloader.ObjectKlass(obj), "run", "()V")
+	if err != nil {
+		err = newGException(selectionErrorClass(excType), err.Error())
+	} else {
+		_, err = runMethodFromGo(t.Stack, entry.Meth, entry.ClName, "run", "()V", obj)
+	}
+	if exc, ok := err.(*gException); ok {
+		_, err = throwGException(t.Stack, exc)
+	}
+	if err != nil {
+		if traced(base) {
+			_ = log.Log("Thread "+jt.name+" ended with error: "+err.Error(), log.TRACE_INST)
+		}
+	}
+}
+
+// endJavaThread marks the thread running the Thread object obj as ended: it's removed
+// from the thread tables, and the threads waiting for it to end are woken up.
+func endJavaThread(obj *object.Object, jt *javaThread) {
+	sched := scheduler // read before the thread is seen to have ended
+
+	glob := globals.GetGlobalRef()
+	glob.ThreadLock.Lock()
+	delete(glob.Threads, jt.exec.ID)
+	glob.ThreadLock.Unlock()
+
+	// once obj is out of javaThreads, it's seen to have ended, as it is once done is closed
+	javaThreadsMutex.Lock()
+	delete(threadObjects, jt.exec.ID)
+	delete(javaThreads, obj)
+	saveEndedThread(obj, jt)
+	javaThreadsMutex.Unlock()
+
+	close(jt.done)
+	if !jt.daemon {
+		nonDaemonThreads.Done()
+	}
+	if jt.onEnd != nil {
+		jt.onEnd()
+	}
+	if sched != nil { // last, as the other threads run once the turn is given up
+		sched.removeThread(jt.exec.ID)
+	}
+}
+
+// waitForThreads returns when every non-daemon thread has ended. The VM exits only then.
+func waitForThreads() {
+	if scheduler != nil { // the main thread has ended
+		scheduler.removeThread(MainThread.ID)
+	}
+	nonDaemonThreads.Wait()
+}
+
+// java/lang/Thread.run() calls the run() method of the Runnable the Thread was created
+// with. If there's none, it does nothing.
+func threadRun(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	fs := params[1].(*list.List)
+
+	javaThreadsMutex.Lock()
+	target, _ := getJavaThread(obj).target.(*object.Object)
+	javaThreadsMutex.Unlock()
+	if target == nil {
+		return nil
+	}
+
+	// an exception thrown by the target is thrown in the caller of run()
+	entry, excType, err := selectMethod(classloader.ObjectKlass(target), "run", "()V")
+	if err != nil {
+		return newGException(selectionErrorClass(excType), err.Error())
+	}
+	if _, err = runMethodFromGo(fs, entry.Meth, entry.ClName, "run", "()V", target); err != nil {
+		return err
+	}
+	return nil
+}
+
+// java/lang/Thread.currentThread() returns the Thread object of the thread that calls it
+func threadCurrentThread(params []interface{}) interface{} {
+	obj, err := currentThreadObject(params[len(params)-1].(*list.List))
+	if err != nil {
+		return err
+	}
+	return obj
+}
+
+// currentThreadObject returns the Thread object of the thread running the frame stack fs
+func currentThreadObject(fs *list.List) (*object.Object, error) {
+	id := currentThreadID(fs)
+
+	javaThreadsMutex.Lock()
+	obj, ok := threadObjects[id]
+	javaThreadsMutex.Unlock()
+	if ok {
+		return obj, nil
+	}
+
+	// the main thread's Thread object is created the first time it's needed
+	obj, err := InstantiateClass("java/lang/Thread", frames.CreateFrameStack())
+	if err != nil {
+		return nil, err
+	}
+
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+	if existing, ok := threadObjects[id]; ok { // created by another caller in the meantime
+		return existing, nil
+	}
+	done := make(chan struct{})
+	javaThreads[obj] = &javaThread{exec: &MainThread, name: "main", started: true, done: done}
+	threadObjects[id] = obj
+	return obj, nil
+}
+
+// currentJavaThread returns the state of the Thread object of the thread running the
+// frame stack fs
+func currentJavaThread(fs *list.List) (*javaThread, error) {
+	obj, err := currentThreadObject(fs)
+	if err != nil {
+		return nil, err
+	}
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+	return getJavaThread(obj), nil
+}
+
+// java/lang/Thread.getName()
+func threadGetName(params []interface{}) interface{} {
+	javaThreadsMutex.Lock()
+	name := getJavaThread(params[0].(*object.Object)).name
+	javaThreadsMutex.Unlock()
+	return object.CreateCompactStringFromGoString(&name)
+}
+
+// java/lang/Thread.setName(String)
+func threadSetName(params []interface{}) interface{} {
+	nameObj, ok := params[1].(*object.Object)
+	if !ok || object.IsNull(nameObj) {
+		return newGException("java/lang/NullPointerException", "name cannot be null")
+	}
+	name, _ := objectToString(nameObj, nil)
+
+	obj := params[0].(*object.Object)
+	javaThreadsMutex.Lock()
+	jt := getJavaThread(obj)
+	jt.name = name
+	if javaThreads[obj] != jt { // the thread has ended
+		saveEndedThread(obj, jt)
+	}
+	javaThreadsMutex.Unlock()
+	return nil
+}
+
+// java/lang/Thread.isAlive() returns whether the thread has been started and has not ended
+func threadIsAlive(params []interface{}) interface{} {
+	javaThreadsMutex.Lock()
+	jt := getJavaThread(params[0].(*object.Object))
+	started := jt.started
+	javaThreadsMutex.Unlock()
+
+	if !started {
+		return types.JavaBoolFalse
+	}
+	select {
+	case <-jt.done:
+		return types.JavaBoolFalse
+	default:
+		return types.JavaBoolTrue
+	}
+}
+
+// java/lang/Thread.isDaemon()
+func threadIsDaemon(params []interface{}) interface{} {
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+	return types.ConvertGoBoolToJavaBool(getJavaThread(params[0].(*object.Object)).daemon)
+}
+
+// java/lang/Thread.setDaemon(boolean), which can be called only before the thread is
+// started. Virtual threads are always daemon threads.
+func threadSetDaemon(params []interface{}) interface{} {
+	javaThreadsMutex.Lock()
+	jt := getJavaThread(params[0].(*object.Object))
+	daemon := params[1].(int64) != types.JavaBoolFalse
+	if jt.virtual && !daemon {
+		javaThreadsMutex.Unlock()
+		return newGException("java/lang/IllegalArgumentException", "'false' not legal for virtual threads")
+	}
+	if jt.started {
+		javaThreadsMutex.Unlock()
+		return newGException("java/lang/IllegalThreadStateException", "")
+	}
+	jt.daemon = daemon
+	javaThreadsMutex.Unlock()
+	return nil
+}
+
+// java/lang/Thread.join() and join(long) wait for the thread to end; join(long) waits
+// for at most the given number of milliseconds, unless that's 0, which means forever.
+// Joining a thread that hasn't been started returns at once.
+func threadJoin(params []interface{}) interface{} {
+	fs := params[len(params)-1].(*list.List)
+	var millis int64
+	if len(params) > 2 {
+		millis = params[1].(int64)
+	}
+	if millis < 0 {
+		return newGException("java/lang/IllegalArgumentException", "timeout value is negative")
+	}
+
+	javaThreadsMutex.Lock()
+	jt := getJavaThread(params[0].(*object.Object))
+	started := jt.started
+	javaThreadsMutex.Unlock()
+	if !started {
+		return nil
+	}
+
+	return waitInterruptibly(fs, millis, jt.done)
+}
+
+// java/lang/Thread.sleep(long) suspends the calling thread for the given number of milliseconds
+func threadSleep(params []interface{}) interface{} {
+	fs := params[len(params)-1].(*list.List)
+	millis := params[0].(int64)
+	if millis < 0 {
+		return newGException("java/lang/IllegalArgumentException", "timeout value is negative")
+	}
+	if millis == 0 {
+		millis = -1 // sleep(0) doesn't wait, but does check for an interrupt
+	}
+	return waitInterruptibly(fs, millis, nil)
+}
+
+// waitInterruptibly waits, on behalf of the thread running the frame stack fs, until the
+// channel done is closed, millis milliseconds have passed (0 means no limit, and a
+// negative value, no wait at all), or the thread is interrupted. If it's interrupted,
+// the InterruptedException to throw is returned.
+func waitInterruptibly(fs *list.List, millis int64, done <-chan struct{}) interface{} {
+	jt, err := currentJavaThread(fs)
+	if err != nil {
+		return err
+	}
+	interrupt := startWaiting(jt)
+	if interrupt != nil && millis >= 0 {
+		var timer <-chan time.Time
+		if timeout := millisToDuration(millis); timeout > 0 {
+			t := time.NewTimer(timeout)
+			defer t.Stop()
+			timer = t.C
+		}
+		block(currentThreadID(fs), timer, done, interrupt)
+	}
+	if stopWaiting(jt, true) {
+		return newGException("java/lang/InterruptedException", "")
+	}
+	return nil
+}
+
+// millisToDuration converts a timeout in milliseconds to a Duration. A timeout too long
+// for a Duration is treated as none (0).
+func millisToDuration(millis int64) time.Duration {
+	if millis > int64(math.MaxInt64/time.Millisecond) {
+		return 0
+	}
+	return time.Duration(millis) * time.Millisecond
+}
+
+// startWaiting is called by the thread jt before it waits. It returns the channel that's
+// closed if the thread is interrupted while it waits, or nil if it has already been
+// interrupted, in which case it should not wait.
+func startWaiting(jt *javaThread) <-chan struct{} {
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+
+	if jt.interrupted {
+		return nil
+	}
+	jt.wakeup = make(chan struct{})
+	return jt.wakeup
+}
+
+// stopWaiting is called by the thread jt after it waits. It reports whether the wait
+// ends by throwing InterruptedException, which is the case if the thread was interrupted
+// and throw is true. The thread's interrupt status is then cleared.
+func stopWaiting(jt *javaThread, throw bool) bool {
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+
+	jt.wakeup = nil
+	if throw && jt.interrupted {
+		jt.interrupted = false
+		return true
+	}
+	return false
+}
+
+// java/lang/Thread.interrupt() sets the thread's interrupt status and wakes it up if
+// it's waiting in wait(), sleep(), or join()
+func threadInterrupt(params []interface{}) interface{} {
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+
+	obj := params[0].(*object.Object)
+	jt := getJavaThread(obj)
+	jt.interrupted = true
+	if javaThreads[obj] != jt { // the thread has ended
+		saveEndedThread(obj, jt)
+	}
+	if jt.wakeup != nil { // a parked thread is woken too, without throwing an exception
+		close(jt.wakeup)
+		jt.wakeup = nil
+	}
+	return nil
+}
+
+// java/lang/Thread.isInterrupted() returns the thread's interrupt status
+func threadIsInterrupted(params []interface{}) interface{} {
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+	return types.ConvertGoBoolToJavaBool(getJavaThread(params[0].(*object.Object)).interrupted)
+}
+
+// java/lang/Thread.interrupted() returns the interrupt status of the calling thread,
+// which it clears
+func threadInterrupted(params []interface{}) interface{} {
+	jt, err := currentJavaThread(params[len(params)-1].(*list.List))
+	if err != nil {
+		return err
+	}
+
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+	interrupted := jt.interrupted
+	jt.interrupted = false
+	return types.ConvertGoBoolToJavaBool(interrupted)
+}
+
+// java/lang/Object.wait(), wait(long), and wait(long, int) wait on the object's monitor,
+// which the calling thread must hold, until the object is notified, the timeout (if
+// any) elapses, or the thread is interrupted
+func objectWait(params []interface{}) interface{} {
+	obj := params[0]
+	fs := params[len(params)-1].(*list.List)
+	threadID := currentThreadID(fs)
+
+	var millis, nanos int64
+	if len(params) > 2 {
+		millis = params[1].(int64)
+	}
+	if len(params) > 4 {
+		nanos = params[3].(int64)
+	}
+	if millis < 0 {
+		return newGException("java/lang/IllegalArgumentException", "timeout value is negative")
+	}
+	if nanos < 0 || nanos > 999999 {
+		return newGException("java/lang/IllegalArgumentException", "nanosecond timeout value out of range")
+	}
+	if nanos > 0 && millis < math.MaxInt64 { // as in the JDK, nanoseconds round up to a millisecond
+		millis += 1
+	}
+
+	if !object.HoldsMonitor(obj, threadID) {
+		return newGException("java/lang/IllegalMonitorStateException", "current thread is not owner")
+	}
+
+	jt, err := currentJavaThread(fs)
+	if err != nil {
+		return err
+	}
+	interrupt := startWaiting(jt)
+	notified := false
+	if interrupt != nil {
+		_, notified = object.MonitorWait(obj, threadID, millisToDuration(millis), interrupt)
+	}
+
+	// a notified thread returns normally, leaving any interrupt pending
+	if stopWaiting(jt, !notified) {
+		return newGException("java/lang/InterruptedException", "")
+	}
+	return nil
+}
+
+// java/lang/Object.notify() wakes one of the threads waiting on the object's monitor,
+// which the calling thread must hold
+func objectNotify(params []interface{}) interface{} {
+	fs := params[len(params)-1].(*list.List)
+	if !object.MonitorNotify(params[0], currentThreadID(fs)) {
+		return newGException("java/lang/IllegalMonitorStateException", "current thread is not owner")
+	}
+	return nil
+}
+
+// java/lang/Object.notifyAll() wakes all the threads waiting on the object's monitor,
+// which the calling thread must hold
+func objectNotifyAll(params []interface{}) interface{} {
+	fs := params[len(params)-1].(*list.List)
+	if !object.MonitorNotifyAll(params[0], currentThreadID(fs)) {
+		return newGException("java/lang/IllegalMonitorStateException", "current thread is not owner")
+	}
+	return nil
+}
+
+// jdk/internal/misc/Unsafe.park(boolean, long) blocks the calling thread until its
+// permit is available, which it consumes. If isAbsolute is false, time is a timeout in
+// nanoseconds, where 0 means none; otherwise, it's a deadline in milliseconds since the
+// epoch. The thread also returns, without an exception, if it's interrupted (or has
+// been), and it may return for no reason at all, so callers check their condition again.
+func unsafePark(params []interface{}) interface{} {
+	absolute := params[1].(int64) != types.JavaBoolFalse
+	t := params[2].(int64)
+	fs := params[len(params)-1].(*list.List)
+
+	var timeout time.Duration
+	if absolute {
+		timeout = time.Until(time.UnixMilli(t))
+		if timeout <= 0 {
+			return nil
+		}
+	} else if t < 0 {
+		return nil
+	} else {
+		timeout = time.Duration(t)
+	}
+
+	jt, err := currentJavaThread(fs)
+	if err != nil {
+		return err
+	}
+	unparked := startParking(jt)
+	if unparked != nil {
+		var timer <-chan time.Time
+		if timeout > 0 {
+			tm := time.NewTimer(timeout)
+			defer tm.Stop()
+			timer = tm.C
+		}
+		block(currentThreadID(fs), timer, unparked, nil)
+	}
+
+	javaThreadsMutex.Lock()
+	jt.parked = false
+	jt.wakeup = nil
+	jt.permit = false
+	javaThreadsMutex.Unlock()
+	return nil
+}
+
+// startParking is called by the thread jt before it parks. It returns the channel that's
+// closed when the thread is unparked or interrupted, or nil if its permit is available
+// or it's been interrupted, in which case it should not wait.
+func startParking(jt *javaThread) <-chan struct{} {
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+
+	if jt.permit || jt.interrupted {
+		return nil
+	}
+	jt.parked = true
+	jt.wakeup = make(chan struct{})
+	return jt.wakeup
+}
+
+// jdk/internal/misc/Unsafe.unpark(Object) makes the permit of the given thread available,
+// waking the thread if it's parked. Unparking a null thread does nothing.
+func unsafeUnpark(params []interface{}) interface{} {
+	obj, ok := params[1].(*object.Object)
+	if !ok || object.IsNull(obj) {
+		return nil
+	}
+
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+
+	jt := getJavaThread(obj)
+	jt.permit = true
+	if jt.parked && jt.wakeup != nil {
+		close(jt.wakeup)
+		jt.wakeup = nil
+	}
+	return nil
+}
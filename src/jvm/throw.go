@@ -0,0 +1,357 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"jacobin/classloader"
+	"jacobin/frames"
+	"jacobin/globals"
+	"jacobin/log"
+	"jacobin/object"
+	"strings"
+)
+
+// Throwing an exception (whether via ATHROW or from within the JVM) works as follows:
+// the exception table of the method in the current frame is searched for an entry
+// whose range covers the PC of the throwing instruction and whose catch type is the
+// class of the exception or one of its superclasses. (A catch type of 0 catches all
+// exceptions; it's how javac implements finally blocks.) If no such entry is found,
+// the frame is popped and the search continues in the calling method, using the PC
+// of the invoke instruction. When a handler is found, the operand stack of its frame
+// is cleared, the exception is pushed onto it, and execution resumes at the handler.
+// If no handler is found on the frame stack, the exception is uncaught and the thread
+// dies after reporting the exception. Either way, the synchronized methods that the
+// exception exits release their monitors.
+//
+// A method that golang code runs with runMethodFromGo() runs on a frame stack of its
+// own, whose bottom frame stands for the golang code. An exception that's not caught on
+// that stack is not reported; it's returned to the golang code as a gException, which
+// passes it on to be thrown in the Java method that called that code.
+//
+// The search stops at the frame of a static initializer (<clinit>), as an exception
+// thrown out of it is not passed on as is to the code that triggered the class's
+// initialization. Instead, the class is marked as erroneous, and that code throws a
+// java/lang/ExceptionInInitializerError whose cause is the exception (or the exception
+// itself, if it's an Error). Later uses of the class throw NoClassDefFoundError.
+// (See JVMS 5.5: https://docs.oracle.com/javase/specs/jvms/se17/html/jvms-5.html#jvms-5.5)
+
+// throwException looks for a handler for excObj on the frame stack fs. If one is found,
+// the frames above the handler's frame are popped off, the handler's frame is set up to
+// resume execution at the handler, and that frame is returned. If no handler is found,
+// nil is returned and the frame stack is left unchanged, so that the full stack can be
+// reported.
+func throwException(fs *list.List, excObj *object.Object) *frames.Frame {
+	excClassName := *excObj.Klass
+	excClass := classloader.ObjectKlass(excObj)
+	framesToPop := 0
+	handlerPC := -1
+
+	for e := fs.Front(); e != nil; e = e.Next() {
+		f := e.Value.(*frames.Frame)
+		if f.Ftype == 'G' { // golang methods have no exception tables
+			framesToPop += 1
+			continue
+		}
+
+		// the top frame is at the throwing instruction. Frames below it have had their
+		// PC moved past the invoke instruction, so we step back into that instruction.
+		pc := f.PC
+		if framesToPop > 0 {
+			pc = f.PC - 1
+		}
+
+		handlerPC = findExceptionHandler(f, pc, excClass)
+		if handlerPC >= 0 {
+			break
+		}
+
+		// exceptions thrown out of a static initializer are not passed on
+		// to the code that triggered the initialization
+		if f.MethName == "<clinit>" {
+			break
+		}
+		framesToPop += 1
+	}
+
+	e := fs.Front()
+	for i := 0; i < framesToPop; i++ {
+		exitMethodMonitor(e.Value.(*frames.Frame))
+		e = e.Next()
+	}
+
+	if handlerPC < 0 {
+		return nil
+	}
+
+	for i := 0; i < framesToPop; i++ {
+		fs.Remove(fs.Front())
+	}
+
+	f := fs.Front().Value.(*frames.Frame)
+	f.TOS = -1 // the operand stack is cleared before the exception is pushed
+	push(f, excObj)
+	f.PC = handlerPC
+
+	if traced(f) {
+		traceInfo := fmt.Sprintf("throwException: %s caught in %s.%s, handler at PC: %d",
+			excClassName, f.ClName, f.MethName, handlerPC)
+		_ = log.Log(traceInfo, log.TRACE_INST)
+	}
+	return f
+}
+
+// throwJVMexception throws an exception of class className that's raised by the JVM
+// itself, rather than by ATHROW, in the method running in the frame at the head of fs.
+// msg, if not empty, is the exception's detail message. The frame of the handler that
+// catches the exception, in which execution resumes, is returned. If the exception is
+// not caught, it's reported and an error is returned.
+func throwJVMexception(fs *list.List, className, msg string) (*frames.Frame, error) {
+	excObj, err := newExceptionObject(className, msg)
+	if err != nil {
+		return nil, err
+	}
+	return throwObject(fs, excObj)
+}
+
+// newExceptionObject creates an exception of class className whose detail message,
+// if msg is not empty, is msg
+func newExceptionObject(className, msg string) (*object.Object, error) {
+	// the exception is instantiated on a frame stack of its own, as the caller's might be full
+	excObj, err := InstantiateClass(className, frames.CreateFrameStack())
+	if err != nil {
+		return nil, err
+	}
+
+	if msg != "" {
+		if excObj.FieldTable == nil {
+			excObj.FieldTable = make(map[string]*object.Field)
+		}
+		excObj.FieldTable["detailMessage"] = &object.Field{
+			Ftype: "Ljava/lang/String;", Fvalue: object.NewStringFromGoString(msg)}
+	}
+	return excObj, nil
+}
+
+// throwObject throws the exception excObj in the method running in the frame at the
+// head of fs. The frame of the handler that catches it, in which execution resumes, is
+// returned. If the exception is not caught, an error is returned (see uncaughtException()).
+func throwObject(fs *list.List, excObj *object.Object) (*frames.Frame, error) {
+	catchFrame := throwException(fs, excObj)
+	if catchFrame == nil {
+		return nil, uncaughtException(fs, excObj, nil)
+	}
+	return catchFrame, nil
+}
+
+// initializerError is the error returned by runFrame() when an exception is thrown out
+// of a static initializer, whose frame is left at the head of the frame stack. The code
+// that triggered the class's initialization throws an ExceptionInInitializerError in
+// its place (see throwInitializationError()).
+type initializerError struct {
+	excObj *object.Object // the exception thrown out of <clinit>
+}
+
+func (e *initializerError) Error() string {
+	return "exception in static initializer: " + *e.excObj.Klass
+}
+
+// uncaughtException is called when no handler for excObj is found on the frame stack
+// fs. thrownFrom holds the frames of other stacks that the exception was thrown through
+// before it reached fs, if any. If the search for a handler stopped at a static
+// initializer, the frames above the initializer's are popped off and an
+// initializerError is returned. If fs is the stack of a method that golang code runs,
+// a gException is returned to that code. Otherwise, the exception is reported and an
+// error is returned, which ends the thread.
+func uncaughtException(fs *list.List, excObj *object.Object, thrownFrom []*frames.Frame) error {
+	for e := fs.Front(); e != nil; e = e.Next() {
+		f := e.Value.(*frames.Frame)
+		if f.Ftype != 'G' && f.MethName == "<clinit>" {
+			for fs.Front() != e {
+				fs.Remove(fs.Front())
+			}
+			return &initializerError{excObj: excObj}
+		}
+	}
+
+	stack := append([]*frames.Frame(nil), thrownFrom...)
+	for e := fs.Front(); e != nil; e = e.Next() {
+		stack = append(stack, e.Value.(*frames.Frame))
+	}
+	if bottom := fs.Back(); bottom != nil && bottom.Value.(*frames.Frame).Ftype == 'G' {
+		return &gException{className: *excObj.Klass, msg: getExceptionMessage(excObj),
+			excObj: excObj, frames: stack[:len(stack)-1]}
+	}
+	reportUncaughtException(fs, excObj, stack)
+	return errors.New("uncaught exception: " + *excObj.Klass)
+}
+
+// isInitializationError reports whether err, returned when a class was initialized,
+// stands for a Java exception that the code that triggered the initialization throws:
+// an exception thrown out of the class's static initializer (an initializerError) or
+// the NoClassDefFoundError of a class whose initialization failed earlier (a gException).
+func isInitializationError(err error) bool {
+	switch err.(type) {
+	case *initializerError, *gException:
+		return true
+	}
+	return false
+}
+
+// throwInitializationError throws the exception that err stands for (see
+// isInitializationError()) in the method running in the frame at the head of fs, and
+// returns the frame in which execution resumes. An exception thrown out of a static
+// initializer is wrapped in an ExceptionInInitializerError, unless it's an Error.
+func throwInitializationError(fs *list.List, err error) (*frames.Frame, error) {
+	switch err := err.(type) {
+	case *gException:
+		return throwGException(fs, err)
+	case *initializerError:
+		excObj := err.excObj
+		if !isSubclassOf(classloader.ObjectKlass(excObj), fetchClass("java/lang/Error")) {
+			wrapper, instErr := InstantiateClass("java/lang/ExceptionInInitializerError", frames.CreateFrameStack())
+			if instErr != nil {
+				return nil, instErr
+			}
+			if wrapper.FieldTable == nil {
+				wrapper.FieldTable = make(map[string]*object.Field)
+			}
+			wrapper.FieldTable["cause"] = &object.Field{Ftype: "Ljava/lang/Throwable;", Fvalue: excObj}
+			excObj = wrapper
+		}
+		return throwObject(fs, excObj)
+	}
+	return nil, err
+}
+
+// classInitFailedError returns the error for the NoClassDefFoundError thrown by the use
+// of the class k, whose static initializer threw an exception
+func classInitFailedError(k *classloader.Klass) error {
+	return newGException("java/lang/NoClassDefFoundError",
+		"Could not initialize class "+strings.ReplaceAll(k.Data.Name, "/", "."))
+}
+
+// findExceptionHandler searches the exception table of the method running in frame f
+// for an entry that covers pc and catches exceptions of class excClass. It returns
+// the PC of the handler, or -1 if no entry applies. Entries are checked in the order
+// they appear in the table, as required by the JVM spec. The catch types are the
+// classes of their names as the defining loader of the method's class sees them.
+func findExceptionHandler(f *frames.Frame, pc int, excClass *classloader.Klass) int {
+	methFQN := classloader.QualifiedName(f.Loader, f.ClName) + "." + f.MethName + f.MethType
+	mtEntry, _ := classloader.MTableFetch(methFQN)
+	if mtEntry.Meth == nil || mtEntry.MType != 'J' {
+		return -1
+	}
+
+	m := mtEntry.Meth.(classloader.JmEntry)
+	for _, entry := range m.Exceptions {
+		if pc < entry.StartPc || pc >= entry.EndPc { // EndPc is exclusive
+			continue
+		}
+
+		if entry.CatchType == 0 { // catch-all entry, used for finally blocks
+			return entry.HandlerPc
+		}
+
+		catchType := FetchCPentry(f.CP.(*classloader.CPool), int(entry.CatchType))
+		if catchType.retType != IS_STRING_ADDR {
+			continue
+		}
+
+		if isSubclassOf(excClass, fetchClassFor(f.Loader, *catchType.stringVal)) {
+			return entry.HandlerPc
+		}
+	}
+	return -1
+}
+
+// maxStackTraceDepth is the largest number of frames shown for an uncaught exception.
+// It's the default value of the JDK's -XX:MaxJavaStackTraceDepth.
+const maxStackTraceDepth = 1024
+
+// reportUncaughtException shows the user an exception that no method on the frame
+// stack caught, in the same format as the JDK, followed by the Java call stack, whose
+// frames are in stack, from the top. The exception ends the thread whose frame stack
+// is fs.
+func reportUncaughtException(fs *list.List, excObj *object.Object, stack []*frames.Frame) {
+	excName := strings.ReplaceAll(*excObj.Klass, "/", ".")
+	msg := fmt.Sprintf("Exception in thread \"%s\" %s", threadName(currentThreadID(fs)), excName)
+
+	detailMessage := getExceptionMessage(excObj)
+	if detailMessage != "" {
+		msg += ": " + detailMessage
+	}
+	_ = log.Log(msg, log.SEVERE)
+
+	// like the JDK, show no more than maxStackTraceDepth frames, as a stack overflow
+	// can leave thousands of them on the frame stack
+	for depth, f := range stack {
+		if depth == maxStackTraceDepth {
+			break
+		}
+		className := strings.ReplaceAll(f.ClName, "/", ".")
+		sourceFile := "Unknown Source"
+		k := classloader.MethAreaFetchFor(f.Loader, f.ClName)
+		if k != nil && k.Data != nil && k.Data.SourceFile != "" {
+			sourceFile = k.Data.SourceFile
+		}
+		_ = log.Log(fmt.Sprintf("\tat %s.%s(%s)", className, f.MethName, sourceFile), log.SEVERE)
+	}
+	reportCause(excObj)
+
+	// the Java stack is the information the user needs, so don't follow it
+	// with the JVM frame stack and the golang stack.
+	glob := globals.GetGlobalRef()
+	glob.JvmFrameStackShown = true
+	glob.GoStackShown = true
+}
+
+// reportCause shows the user the cause of an uncaught exception, if it has one, as the
+// JDK does after the exception's stack trace
+func reportCause(excObj *object.Object) {
+	if excObj.FieldTable == nil || excObj.FieldTable["cause"] == nil {
+		return
+	}
+	cause, ok := excObj.FieldTable["cause"].Fvalue.(*object.Object)
+	if !ok || object.IsNull(cause) || cause == excObj {
+		return
+	}
+
+	msg := "Caused by: " + strings.ReplaceAll(*cause.Klass, "/", ".")
+	if detailMessage := getExceptionMessage(cause); detailMessage != "" {
+		msg += ": " + detailMessage
+	}
+	_ = log.Log(msg, log.SEVERE)
+}
+
+// getExceptionMessage returns the detail message of a Throwable as a Go
+// string, or "" if there is no message.
+func getExceptionMessage(excObj *object.Object) string {
+	if excObj.FieldTable == nil {
+		return ""
+	}
+
+	field, ok := excObj.FieldTable["detailMessage"]
+	if !ok || field.Fvalue == nil {
+		return ""
+	}
+
+	str, ok := field.Fvalue.(*object.Object)
+	if !ok || object.IsNull(str) || len(str.Fields) == 0 {
+		return ""
+	}
+
+	switch value := str.Fields[0].Fvalue.(type) {
+	case *[]byte:
+		return string(*value)
+	case string:
+		return value
+	}
+	return ""
+}
@@ -0,0 +1,722 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package jvm
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"jacobin/classloader"
+	"jacobin/frames"
+	"jacobin/object"
+	"jacobin/types"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Virtual threads (JEP 444) are threads that are scheduled by the JVM rather than by
+// the OS, so they're cheap enough to create one per task. In Jacobin, every thread runs
+// on a goroutine, which is scheduled by the Go runtime, so a virtual thread is simply a
+// thread that's started like any other (see startThread()), except that it's always a
+// daemon thread and is not given a name unless its builder names it.
+//
+// The JDK implements virtual threads with continuations that are mounted on carrier
+// threads, none of which is needed here. So Thread.ofVirtual(), Thread.startVirtualThread(),
+// and Executors.newVirtualThreadPerTaskExecutor() are implemented in golang and return
+// objects of synthetic classes, named like the JDK classes they stand for, whose methods
+// are golang methods too. The state of a builder, thread factory, executor, or future
+// is kept in golang, in the first (and only) field of the object.
+//
+// Exceptions thrown by the tasks of an executor are reported as uncaught exceptions of
+// the thread that runs them, as they can't be passed to golang code as objects, before
+// Future.get() throws the ExecutionException.
+
+// the synthetic classes for virtual threads and the objects that create them
+const (
+	virtualThreadClass  = "java/lang/VirtualThread"
+	virtualBuilderClass = "java/lang/ThreadBuilders$VirtualThreadBuilder"
+	virtualFactoryClass = "java/lang/ThreadBuilders$VirtualThreadFactory"
+	taskExecutorClass   = "java/util/concurrent/ThreadPerTaskExecutor"
+	taskFutureClass     = "java/util/concurrent/ThreadPerTaskExecutor$ThreadBoundFuture"
+)
+
+// threadNamer is the state of a virtual thread builder or factory: the name it gives the
+// threads it creates, followed by a number if counter is not negative. The number is
+// incremented for each thread, under the object's field lock.
+type threadNamer struct {
+	name    string
+	counter int64
+}
+
+// taskExecutor is the state of an executor that starts a virtual thread for each task.
+// It's terminated when it's shut down and all its tasks have ended.
+type taskExecutor struct {
+	mutex      sync.Mutex
+	running    int  // the number of tasks that have not ended
+	shutdown   bool // whether new tasks are rejected
+	terminated chan struct{}
+}
+
+// taskFuture is the state of the Future of a task submitted to a taskExecutor
+type taskFuture struct {
+	task     *object.Object
+	callable bool        // whether the task is a Callable rather than a Runnable
+	result   interface{} // the value get() returns for a Runnable
+	report   bool        // whether the task was passed to execute(), so a failure is reported as uncaught
+
+	thread *object.Object // the virtual thread that runs the task
+
+	mutex     sync.Mutex
+	cancelled bool
+	failure   *gException   // the exception the task ended with, if any
+	done      chan struct{} // closed when the task ends or is cancelled
+}
+
+// loadVirtualThreadMethods posts the synthetic classes for virtual threads to the method
+// area and places their methods, and the methods of Thread and Executors that create
+// virtual threads, in the MTable
+func loadVirtualThreadMethods() {
+	postSyntheticClass(virtualThreadClass, "java/lang/Thread")
+	postSyntheticClass(virtualBuilderClass, "java/lang/Object",
+		"java/lang/Thread$Builder$OfVirtual", "java/lang/Thread$Builder")
+	postSyntheticClass(virtualFactoryClass, "java/lang/Object", "java/util/concurrent/ThreadFactory")
+	postSyntheticClass(taskExecutorClass, "java/lang/Object",
+		"java/util/concurrent/ExecutorService", "java/util/concurrent/Executor", "java/lang/AutoCloseable")
+	postSyntheticClass(taskFutureClass, "java/lang/Object",
+		"java/util/concurrent/Future", "java/lang/Runnable", "java/util/concurrent/RunnableFuture")
+
+	methods := map[string]classloader.GMeth{
+		"java/lang/Thread.isVirtual()Z":                                                                          {ParamSlots: 0, ObjectRef: true, GFunction: threadIsVirtual},
+		"java/lang/Thread.ofVirtual()Ljava/lang/Thread$Builder$OfVirtual;":                                       {ParamSlots: 0, GFunction: threadOfVirtual},
+		"java/lang/Thread.startVirtualThread(Ljava/lang/Runnable;)Ljava/lang/Thread;":                            {ParamSlots: 1, NeedsContext: true, GFunction: threadStartVirtualThread},
+		"java/util/concurrent/Executors.newVirtualThreadPerTaskExecutor()Ljava/util/concurrent/ExecutorService;": {ParamSlots: 0, GFunction: newVirtualThreadPerTaskExecutor},
+
+		// LockSupport parks and unparks virtual threads through VirtualThreads
+		"jdk/internal/misc/VirtualThreads.park()V":                     {ParamSlots: 0, NeedsContext: true, GFunction: virtualThreadsPark},
+		"jdk/internal/misc/VirtualThreads.park(J)V":                    {ParamSlots: 2, NeedsContext: true, GFunction: virtualThreadsPark},
+		"jdk/internal/misc/VirtualThreads.parkUntil(J)V":               {ParamSlots: 2, NeedsContext: true, GFunction: virtualThreadsParkUntil},
+		"jdk/internal/misc/VirtualThreads.unpark(Ljava/lang/Thread;)V": {ParamSlots: 1, GFunction: virtualThreadsUnpark},
+
+		virtualFactoryClass + ".newThread(Ljava/lang/Runnable;)Ljava/lang/Thread;": {ParamSlots: 1, ObjectRef: true, GFunction: builderUnstarted},
+
+		taskExecutorClass + ".execute(Ljava/lang/Runnable;)V":                                              {ParamSlots: 1, ObjectRef: true, NeedsContext: true, GFunction: executorExecute},
+		taskExecutorClass + ".submit(Ljava/lang/Runnable;)Ljava/util/concurrent/Future;":                   {ParamSlots: 1, ObjectRef: true, NeedsContext: true, GFunction: executorSubmit(false)},
+		taskExecutorClass + ".submit(Ljava/util/concurrent/Callable;)Ljava/util/concurrent/Future;":        {ParamSlots: 1, ObjectRef: true, NeedsContext: true, GFunction: executorSubmit(true)},
+		taskExecutorClass + ".submit(Ljava/lang/Runnable;Ljava/lang/Object;)Ljava/util/concurrent/Future;": {ParamSlots: 2, ObjectRef: true, NeedsContext: true, GFunction: executorSubmit(false)},
+		taskExecutorClass + ".shutdown()V":                                                                 {ParamSlots: 0, ObjectRef: true, GFunction: executorShutdown},
+		taskExecutorClass + ".isShutdown()Z":                                                               {ParamSlots: 0, ObjectRef: true, GFunction: executorIsShutdown},
+		taskExecutorClass + ".isTerminated()Z":                                                             {ParamSlots: 0, ObjectRef: true, GFunction: executorIsTerminated},
+		taskExecutorClass + ".awaitTermination(JLjava/util/concurrent/TimeUnit;)Z":                         {ParamSlots: 3, ObjectRef: true, NeedsContext: true, GFunction: executorAwaitTermination},
+		taskExecutorClass + ".close()V":                                                                    {ParamSlots: 0, ObjectRef: true, NeedsContext: true, GFunction: executorClose},
+
+		taskFutureClass + ".run()V":                                                  {ParamSlots: 0, ObjectRef: true, NeedsContext: true, GFunction: futureRun},
+		taskFutureClass + ".get()Ljava/lang/Object;":                                 {ParamSlots: 0, ObjectRef: true, NeedsContext: true, GFunction: futureGet},
+		taskFutureClass + ".get(JLjava/util/concurrent/TimeUnit;)Ljava/lang/Object;": {ParamSlots: 3, ObjectRef: true, NeedsContext: true, GFunction: futureGet},
+		taskFutureClass + ".isDone()Z":                                               {ParamSlots: 0, ObjectRef: true, GFunction: futureIsDone},
+		taskFutureClass + ".isCancelled()Z":                                          {ParamSlots: 0, ObjectRef: true, GFunction: futureIsCancelled},
+		taskFutureClass + ".cancel(Z)Z":                                              {ParamSlots: 1, ObjectRef: true, GFunction: futureCancel},
+	}
+
+	// the builder's methods that return the builder are declared in both Thread.Builder
+	// and Thread.Builder.OfVirtual, with different return types
+	for _, ret := range []string{"Ljava/lang/Thread$Builder;", "Ljava/lang/Thread$Builder$OfVirtual;"} {
+		methods[virtualBuilderClass+".name(Ljava/lang/String;)"+ret] =
+			classloader.GMeth{ParamSlots: 1, ObjectRef: true, GFunction: builderName}
+		methods[virtualBuilderClass+".name(Ljava/lang/String;J)"+ret] =
+			classloader.GMeth{ParamSlots: 3, ObjectRef: true, GFunction: builderName}
+		methods[virtualBuilderClass+".inheritInheritableThreadLocals(Z)"+ret] =
+			classloader.GMeth{ParamSlots: 1, ObjectRef: true, GFunction: builderItself}
+	}
+	methods[virtualBuilderClass+".start(Ljava/lang/Runnable;)Ljava/lang/Thread;"] =
+		classloader.GMeth{ParamSlots: 1, ObjectRef: true, NeedsContext: true, GFunction: builderStart}
+	methods[virtualBuilderClass+".unstarted(Ljava/lang/Runnable;)Ljava/lang/Thread;"] =
+		classloader.GMeth{ParamSlots: 1, ObjectRef: true, GFunction: builderUnstarted}
+	methods[virtualBuilderClass+".factory()Ljava/util/concurrent/ThreadFactory;"] =
+		classloader.GMeth{ParamSlots: 0, ObjectRef: true, GFunction: builderFactory}
+
+	classloader.MTmutex.Lock()
+	for methFQN, gmeth := range methods {
+		classloader.MTable[methFQN] = classloader.MTentry{MType: 'G', Meth: gmeth}
+	}
+	classloader.MTmutex.Unlock()
+}
+
+// postSyntheticClass posts a class with the given superclass and interfaces, whose
+// methods are all golang methods, to the method area
+func postSyntheticClass(className, superclass string, interfaces ...string) {
+	klass := classloader.ClData{
+		Name:        className,
+		Superclass:  superclass,
+		MethodTable: make(map[string]*classloader.Method),
+		ClInit:      types.ClInitRun,
+	}
+	for i, intf := range interfaces {
+		klass.CP.Utf8Refs = append(klass.CP.Utf8Refs, intf)
+		klass.Interfaces = append(klass.Interfaces, uint16(i))
+	}
+	klass.Access.ClassIsFinal = true
+	classloader.MethAreaInsert(className, &classloader.Klass{Status: 'N', Loader: "bootstrap", Data: &klass})
+}
+
+// newSyntheticObject returns an object of the synthetic class className, whose state is
+// the golang value state
+func newSyntheticObject(className string, state interface{}) *object.Object {
+	obj := object.MakeEmptyObject()
+	obj.Klass = &className
+	obj.Fields = []object.Field{{Ftype: types.Struct, Fvalue: state}}
+	return obj
+}
+
+// newVirtualThread returns a virtual thread, not yet started, that runs task and is
+// named name
+func newVirtualThread(task *object.Object, name string) (*object.Object, error) {
+	obj, err := InstantiateClass(virtualThreadClass, frames.CreateFrameStack())
+	if err != nil {
+		return nil, err
+	}
+
+	javaThreadsMutex.Lock()
+	javaThreads[obj] = &javaThread{target: task, name: name, daemon: true, virtual: true,
+		done: make(chan struct{})}
+	javaThreadsMutex.Unlock()
+	return obj, nil
+}
+
+// startVirtualThread starts a virtual thread that runs task and is named name. The thread
+// is traced if the thread running the frame stack fs is.
+func startVirtualThread(fs *list.List, task *object.Object, name string) (*object.Object, interface{}) {
+	thr, err := newVirtualThread(task, name)
+	if err != nil {
+		return nil, err
+	}
+	if ret := startThread(thr, traced(fs.Front().Value.(*frames.Frame))); ret != nil {
+		return nil, ret
+	}
+	return thr, nil
+}
+
+// java/lang/Thread.isVirtual()
+func threadIsVirtual(params []interface{}) interface{} {
+	javaThreadsMutex.Lock()
+	defer javaThreadsMutex.Unlock()
+	return types.ConvertGoBoolToJavaBool(getJavaThread(params[0].(*object.Object)).virtual)
+}
+
+// java/lang/Thread.ofVirtual() returns a builder of virtual threads, which are not named
+func threadOfVirtual(_ []interface{}) interface{} {
+	return newSyntheticObject(virtualBuilderClass, &threadNamer{counter: -1})
+}
+
+// java/lang/Thread.startVirtualThread(Runnable) starts a virtual thread that runs the task
+func threadStartVirtualThread(params []interface{}) interface{} {
+	task, ok := params[0].(*object.Object)
+	if !ok || object.IsNull(task) {
+		return newGException("java/lang/NullPointerException", "")
+	}
+	thr, ret := startVirtualThread(params[1].(*list.List), task, "")
+	if ret != nil {
+		return ret
+	}
+	return thr
+}
+
+// nextName returns the name of the next thread created by the builder or factory obj
+func nextName(obj *object.Object) string {
+	lock := object.FieldLock(obj)
+	lock.Lock()
+	defer lock.Unlock()
+
+	namer := obj.Fields[0].Fvalue.(*threadNamer)
+	if namer.counter < 0 {
+		return namer.name
+	}
+	name := namer.name + strconv.FormatInt(namer.counter, 10)
+	namer.counter += 1
+	return name
+}
+
+// java/lang/Thread$Builder.name(String) and name(String, long) set the name of the
+// threads the builder creates, which, in the latter case, is the given prefix followed
+// by a number, starting at the given value and incremented for each thread
+func builderName(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	nameObj, ok := params[1].(*object.Object)
+	if !ok || object.IsNull(nameObj) {
+		return newGException("java/lang/NullPointerException", "")
+	}
+	name, _ := objectToString(nameObj, nil)
+
+	counter := int64(-1)
+	if len(params) > 2 {
+		counter = params[2].(int64)
+		if counter < 0 {
+			return newGException("java/lang/IllegalArgumentException", "'start' is negative")
+		}
+	}
+
+	lock := object.FieldLock(obj)
+	lock.Lock()
+	namer := obj.Fields[0].Fvalue.(*threadNamer)
+	namer.name = name
+	namer.counter = counter
+	lock.Unlock()
+	return obj
+}
+
+// builderItself implements the builder methods that have no effect on virtual threads,
+// such as inheritInheritableThreadLocals(boolean), which return the builder
+func builderItself(params []interface{}) interface{} {
+	return params[0]
+}
+
+// java/lang/Thread$Builder.start(Runnable) starts a virtual thread that runs the task
+func builderStart(params []interface{}) interface{} {
+	task, ok := params[1].(*object.Object)
+	if !ok || object.IsNull(task) {
+		return newGException("java/lang/NullPointerException", "")
+	}
+	thr, ret := startVirtualThread(params[2].(*list.List), task, nextName(params[0].(*object.Object)))
+	if ret != nil {
+		return ret
+	}
+	return thr
+}
+
+// java/lang/Thread$Builder.unstarted(Runnable) and ThreadFactory.newThread(Runnable)
+// return a virtual thread that runs the task, which is not started
+func builderUnstarted(params []interface{}) interface{} {
+	task, ok := params[1].(*object.Object)
+	if !ok || object.IsNull(task) {
+		return newGException("java/lang/NullPointerException", "")
+	}
+	thr, err := newVirtualThread(task, nextName(params[0].(*object.Object)))
+	if err != nil {
+		return err
+	}
+	return thr
+}
+
+// java/lang/Thread$Builder.factory() returns a ThreadFactory that creates virtual threads
+// named as the builder names them. The factory has a counter of its own.
+func builderFactory(params []interface{}) interface{} {
+	obj := params[0].(*object.Object)
+	lock := object.FieldLock(obj)
+	lock.RLock()
+	namer := *obj.Fields[0].Fvalue.(*threadNamer)
+	lock.RUnlock()
+	return newSyntheticObject(virtualFactoryClass, &namer)
+}
+
+// java/util/concurrent/Executors.newVirtualThreadPerTaskExecutor() returns an executor
+// that starts a new virtual thread for each task
+func newVirtualThreadPerTaskExecutor(_ []interface{}) interface{} {
+	return newSyntheticObject(taskExecutorClass, &taskExecutor{terminated: make(chan struct{})})
+}
+
+// java/util/concurrent/ExecutorService.execute(Runnable) runs the task on a new virtual thread
+func executorExecute(params []interface{}) interface{} {
+	state := &taskFuture{report: true}
+	if _, ret := startTask(params[0].(*object.Object), params[1], state, params[2].(*list.List)); ret != nil {
+		return ret
+	}
+	return nil
+}
+
+// executorSubmit returns the golang method that implements ExecutorService.submit(Callable),
+// if callable is true, or submit(Runnable) and submit(Runnable, Object), which run the
+// task on a new virtual thread and return its Future. The Future of a Runnable returns
+// null, or the given result.
+func executorSubmit(callable bool) func([]interface{}) interface{} {
+	return func(params []interface{}) interface{} {
+		state := &taskFuture{callable: callable, result: object.Null}
+		if len(params) > 3 {
+			state.result = params[2]
+		}
+		future, ret := startTask(params[0].(*object.Object), params[1], state, params[len(params)-1].(*list.List))
+		if ret != nil {
+			return ret
+		}
+		return future
+	}
+}
+
+// startTask starts a virtual thread that runs the task for the executor obj and returns
+// the task's Future, whose state is state, or the exception to throw if the task is null
+// or the executor is shut down
+func startTask(obj *object.Object, taskParam interface{}, state *taskFuture, fs *list.List) (*object.Object, interface{}) {
+	task, ok := taskParam.(*object.Object)
+	if !ok || object.IsNull(task) {
+		return nil, newGException("java/lang/NullPointerException", "")
+	}
+
+	exec := obj.Fields[0].Fvalue.(*taskExecutor)
+	exec.mutex.Lock()
+	if exec.shutdown {
+		exec.mutex.Unlock()
+		return nil, newGException("java/util/concurrent/RejectedExecutionException", "Executor is shut down")
+	}
+	exec.running += 1
+	exec.mutex.Unlock()
+
+	state.task = task
+	state.done = make(chan struct{})
+	future := newSyntheticObject(taskFutureClass, state)
+	thr, err := newVirtualThread(future, "")
+	if err != nil {
+		exec.taskEnded()
+		return nil, err
+	}
+	state.thread = thr // before the thread starts, so no lock is needed
+	javaThreadsMutex.Lock()
+	javaThreads[thr].onEnd = exec.taskEnded
+	javaThreadsMutex.Unlock()
+	if ret := startThread(thr, traced(fs.Front().Value.(*frames.Frame))); ret != nil {
+		exec.taskEnded()
+		return nil, ret
+	}
+	return future, nil
+}
+
+// taskEnded is called when the thread running a task of the executor has ended
+func (exec *taskExecutor) taskEnded() {
+	exec.mutex.Lock()
+	defer exec.mutex.Unlock()
+	exec.running -= 1
+	if exec.shutdown && exec.running == 0 {
+		close(exec.terminated)
+	}
+}
+
+// java/util/concurrent/ExecutorService.shutdown() stops the executor from accepting new
+// tasks. The tasks already submitted run to completion.
+func executorShutdown(params []interface{}) interface{} {
+	exec := params[0].(*object.Object).Fields[0].Fvalue.(*taskExecutor)
+	exec.mutex.Lock()
+	defer exec.mutex.Unlock()
+	if !exec.shutdown {
+		exec.shutdown = true
+		if exec.running == 0 {
+			close(exec.terminated)
+		}
+	}
+	return nil
+}
+
+// java/util/concurrent/ExecutorService.isShutdown()
+func executorIsShutdown(params []interface{}) interface{} {
+	exec := params[0].(*object.Object).Fields[0].Fvalue.(*taskExecutor)
+	exec.mutex.Lock()
+	defer exec.mutex.Unlock()
+	return types.ConvertGoBoolToJavaBool(exec.shutdown)
+}
+
+// java/util/concurrent/ExecutorService.isTerminated() returns whether the executor is
+// shut down and all its tasks have ended
+func executorIsTerminated(params []interface{}) interface{} {
+	exec := params[0].(*object.Object).Fields[0].Fvalue.(*taskExecutor)
+	select {
+	case <-exec.terminated:
+		return types.JavaBoolTrue
+	default:
+		return types.JavaBoolFalse
+	}
+}
+
+// java/util/concurrent/ExecutorService.awaitTermination(long, TimeUnit) waits for the
+// executor to terminate, for at most the given time, and returns whether it did
+func executorAwaitTermination(params []interface{}) interface{} {
+	exec := params[0].(*object.Object).Fields[0].Fvalue.(*taskExecutor)
+	fs := params[len(params)-1].(*list.List)
+
+	millis, ret := timeUnitToMillis(fs, params[1].(int64), params[3])
+	if ret != nil {
+		return ret
+	}
+	if ret = waitInterruptibly(fs, millis, exec.terminated); ret != nil {
+		return ret
+	}
+	return executorIsTerminated(params)
+}
+
+// java/util/concurrent/ExecutorService.close() shuts the executor down and waits for its
+// tasks to end. If the calling thread is interrupted while it waits, it keeps waiting,
+// and its interrupt status is set again when close() returns.
+func executorClose(params []interface{}) interface{} {
+	executorShutdown(params)
+	exec := params[0].(*object.Object).Fields[0].Fvalue.(*taskExecutor)
+	fs := params[len(params)-1].(*list.List)
+
+	interrupted := false
+	for {
+		ret := waitInterruptibly(fs, 0, exec.terminated)
+		if ret == nil {
+			break
+		}
+		if _, ok := ret.(*gException); !ok {
+			return ret
+		}
+		interrupted = true
+	}
+	if interrupted {
+		jt, err := currentJavaThread(fs)
+		if err != nil {
+			return err
+		}
+		javaThreadsMutex.Lock()
+		jt.interrupted = true
+		javaThreadsMutex.Unlock()
+	}
+	return nil
+}
+
+// timeUnitToMillis converts a duration in the TimeUnit unit to milliseconds, rounding
+// up, as the timeout for waitInterruptibly(): a duration that's not positive is returned
+// as -1, which means not to wait. It calls TimeUnit.toNanos() on the thread running fs.
+func timeUnitToMillis(fs *list.List, duration int64, unitParam interface{}) (int64, interface{}) {
+	unit, ok := unitParam.(*object.Object)
+	if !ok || object.IsNull(unit) {
+		return 0, newGException("java/lang/NullPointerException", "")
+	}
+	entry, _, err := selectMethod(classloader.ObjectKlass(unit), "toNanos", "(J)J")
+	if err != nil {
+		return 0, err
+	}
+	ret, err := runMethodFromGo(fs, entry.Meth, entry.ClName, "toNanos", "(J)J", unit, duration)
+	if err != nil {
+		return 0, err
+	}
+
+	nanos := ret.(int64)
+	if nanos <= 0 {
+		return -1, nil
+	}
+	millis := nanos / int64(time.Millisecond)
+	if nanos%int64(time.Millisecond) != 0 {
+		millis += 1
+	}
+	return millis, nil
+}
+
+// java/util/concurrent/Future.run() runs the task on the task's virtual thread, and
+// records its result or the exception it ended with
+func futureRun(params []interface{}) interface{} {
+	future := params[0].(*object.Object).Fields[0].Fvalue.(*taskFuture)
+	fs := params[1].(*list.List)
+
+	methName, methType := "run", "()V"
+	if future.callable {
+		methName, methType = "call", "()Ljava/lang/Object;"
+	}
+	entry, _, err := selectMethod(classloader.ObjectKlass(future.task), methName, methType)
+	var ret interface{}
+	if err == nil {
+		ret, err = runMethodFromGo(fs, entry.Meth, entry.ClName, methName, methType, future.task)
+	}
+
+	future.mutex.Lock()
+	defer future.mutex.Unlock()
+	if future.cancelled {
+		return nil
+	}
+	if exc, ok := err.(*gException); ok {
+		future.failure = exc
+	} else if err != nil { // an error in the JVM, rather than an exception
+		future.failure = newGException("java/lang/InternalError", err.Error())
+	} else if future.callable {
+		future.result = ret
+	}
+	close(future.done)
+
+	if future.report { // a task passed to execute() has no Future to report its failure
+		return err
+	}
+	return nil
+}
+
+// java/util/concurrent/Future.get() and get(long, TimeUnit) wait for the task to end
+// and return its result. If the task failed, ExecutionException is thrown; if it was
+// cancelled, CancellationException; and if get(long, TimeUnit) times out, TimeoutException.
+func futureGet(params []interface{}) interface{} {
+	future := params[0].(*object.Object).Fields[0].Fvalue.(*taskFuture)
+	fs := params[len(params)-1].(*list.List)
+
+	var millis int64
+	if len(params) > 2 {
+		var ret interface{}
+		if millis, ret = timeUnitToMillis(fs, params[1].(int64), params[3]); ret != nil {
+			return ret
+		}
+	}
+	if ret := waitInterruptibly(fs, millis, future.done); ret != nil {
+		return ret
+	}
+
+	future.mutex.Lock()
+	defer future.mutex.Unlock()
+	select {
+	case <-future.done:
+	default:
+		return newGException("java/util/concurrent/TimeoutException", "")
+	}
+	if future.cancelled {
+		return newGException("java/util/concurrent/CancellationException", "")
+	}
+	if future.failure != nil {
+		return executionException(future.failure)
+	}
+	return future.result
+}
+
+// executionException returns the ExecutionException that Future.get() throws for a task
+// that ended with the exception exc. exc is the ExecutionException's cause.
+func executionException(exc *gException) interface{} {
+	if exc.excObj == nil { // thrown by golang code, so there's no exception object yet
+		cause, err := newExceptionObject(exc.className, exc.msg)
+		if err != nil {
+			return err
+		}
+		exc.excObj = cause
+	}
+
+	// as in ExecutionException(Throwable), the message is the cause's toString()
+	msg := strings.ReplaceAll(*exc.excObj.Klass, "/", ".")
+	if causeMsg := getExceptionMessage(exc.excObj); causeMsg != "" {
+		msg += ": " + causeMsg
+	}
+	excObj, err := newExceptionObject("java/util/concurrent/ExecutionException", msg)
+	if err != nil {
+		return err
+	}
+	excObj.FieldTable["cause"] = &object.Field{Ftype: "Ljava/lang/Throwable;", Fvalue: exc.excObj}
+	return &gException{className: "java/util/concurrent/ExecutionException", msg: msg, excObj: excObj}
+}
+
+// java/util/concurrent/Future.isDone() returns whether the task has ended or been cancelled
+func futureIsDone(params []interface{}) interface{} {
+	future := params[0].(*object.Object).Fields[0].Fvalue.(*taskFuture)
+	select {
+	case <-future.done:
+		return types.JavaBoolTrue
+	default:
+		return types.JavaBoolFalse
+	}
+}
+
+// java/util/concurrent/Future.isCancelled()
+func futureIsCancelled(params []interface{}) interface{} {
+	future := params[0].(*object.Object).Fields[0].Fvalue.(*taskFuture)
+	future.mutex.Lock()
+	defer future.mutex.Unlock()
+	return types.ConvertGoBoolToJavaBool(future.cancelled)
+}
+
+// java/util/concurrent/Future.cancel(boolean) cancels the task, unless it has ended, and
+// interrupts its thread if asked to. It returns whether the task was cancelled.
+func futureCancel(params []interface{}) interface{} {
+	future := params[0].(*object.Object).Fields[0].Fvalue.(*taskFuture)
+	future.mutex.Lock()
+	defer future.mutex.Unlock()
+
+	select {
+	case <-future.done:
+		return types.JavaBoolFalse
+	default:
+	}
+	future.cancelled = true
+	close(future.done)
+	if params[1].(int64) != types.JavaBoolFalse && future.thread != nil {
+		threadInterrupt([]interface{}{future.thread})
+	}
+	return types.JavaBoolTrue
+}
+
+// jdk/internal/misc/VirtualThreads.park() and park(long), which parks the calling virtual
+// thread for at most the given number of nanoseconds, as Unsafe.park() does
+func virtualThreadsPark(params []interface{}) interface{} {
+	nanos := int64(0)
+	if len(params) > 1 {
+		if nanos = params[0].(int64); nanos <= 0 {
+			return nil
+		}
+	}
+	return unsafePark([]interface{}{nil, types.JavaBoolFalse, nanos, params[len(params)-1]})
+}
+
+// jdk/internal/misc/VirtualThreads.parkUntil(long) parks the calling virtual thread
+// until the given time, in milliseconds since the epoch, at the latest
+func virtualThreadsParkUntil(params []interface{}) interface{} {
+	return unsafePark([]interface{}{nil, types.JavaBoolTrue, params[0].(int64), params[len(params)-1]})
+}
+
+// jdk/internal/misc/VirtualThreads.unpark(Thread) unparks the virtual thread
+func virtualThreadsUnpark(params []interface{}) interface{} {
+	return unsafeUnpark([]interface{}{nil, params[0]})
+}
+
+// threadDump writes a line for each live thread to w, as the JDK does on SIGQUIT: its
+// name, its ID, whether it's a daemon or virtual thread, and its state. The frame
+// stacks of the threads are not shown, as they're changed by the running threads.
+func threadDump(w io.Writer) {
+	javaThreadsMutex.Lock()
+	ids := make([]int, 0, len(threadObjects)+1)
+	for id := range threadObjects {
+		ids = append(ids, id)
+	}
+	if _, ok := threadObjects[MainThread.ID]; !ok {
+		ids = append(ids, MainThread.ID)
+	}
+	sort.Ints(ids)
+
+	lines := make([]string, 0, len(ids))
+	for _, id := range ids {
+		jt, ok := javaThreads[threadObjects[id]]
+		if !ok { // the main thread, whose Thread object has not been created
+			jt = &javaThread{name: "main"}
+		}
+		line := fmt.Sprintf("\"%s\" #%d", jt.name, id)
+		if jt.virtual {
+			line += " virtual"
+		} else if jt.daemon {
+			line += " daemon"
+		}
+		switch {
+		case jt.parked:
+			line += " WAITING (parking)"
+		case jt.wakeup != nil:
+			line += " WAITING"
+		default:
+			line += " RUNNABLE"
+		}
+		lines = append(lines, line)
+	}
+	javaThreadsMutex.Unlock()
+
+	_, _ = fmt.Fprintln(w, "Full thread dump Jacobin:")
+	for _, line := range lines {
+		_, _ = fmt.Fprintln(w, "\n"+line)
+	}
+	_, _ = fmt.Fprintln(w)
+}
+
+// dumpThreadsOnSignal writes a thread dump to stdout each time the JVM receives SIGQUIT
+// (Ctrl-\, or Ctrl-Break on Windows), which otherwise makes golang dump its goroutines
+// and exit
+func dumpThreadsOnSignal() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGQUIT)
+	go func() {
+		for range sigs {
+			threadDump(os.Stdout)
+		}
+	}()
+}
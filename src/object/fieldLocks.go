@@ -0,0 +1,42 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package object
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// Java lets the threads of a program read and write the same field without
+// synchronizing; the Java memory model defines what they can then see. Go doesn't: a
+// field written by one goroutine while another reads or writes it is a data race, and
+// since a field's value is an interface (Field.Fvalue), the reader can see half of the
+// write. So GETFIELD, PUTFIELD, and Unsafe read and write the fields of an object only
+// while holding the object's field lock.
+//
+// That gives volatile fields (ACC_VOLATILE) everything the JLS requires of them: reads
+// and writes of 64-bit values are atomic, and since Go's locks are sequentially
+// consistent, so are volatile accesses. It also gives final fields their freeze
+// semantics: what a constructor writes to the fields of the object it constructs is
+// seen by any thread that obtains the object after the constructor ends, because the
+// reference is read from a field, or passed to the thread, only after it's written
+// under a lock. (Plain fields get the same guarantees, which Java permits.)
+//
+// Rather than give every object a lock of its own, objects share a fixed set of locks,
+// chosen by their address.
+
+// fieldLockCount is the number of field locks, a power of two
+const fieldLockCount = 256
+
+var fieldLocks [fieldLockCount]sync.RWMutex
+
+// FieldLock returns the lock that guards the fields of obj
+func FieldLock(obj *Object) *sync.RWMutex {
+	// objects are 8-byte aligned at least, so the low bits of the address are dropped
+	addr := uintptr(unsafe.Pointer(obj)) >> 4
+	return &fieldLocks[addr&(fieldLockCount-1)]
+}
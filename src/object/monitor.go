@@ -0,0 +1,228 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package object
+
+import (
+	"sync"
+	"time"
+)
+
+// Every Java object has a monitor, which MONITORENTER and MONITOREXIT (the bytecodes of
+// synchronized blocks) and synchronized methods enter and exit. A monitor is held by at
+// most one thread at a time, and that thread can enter it again (monitors are
+// reentrant): the monitor is released when the thread has exited it as many times as
+// it entered it. A thread that enters a monitor held by another thread blocks until
+// it's released.
+//
+// A thread that holds a monitor can wait on it (Object.wait()): it releases the monitor
+// and joins the monitor's wait set, until another thread that holds the monitor notifies
+// it (Object.notify() or notifyAll()), its timeout elapses, or it's interrupted. It then
+// enters the monitor again, as many times as it had entered it before waiting.
+//
+// Few objects are ever synchronized on, so rather than taking room in every object,
+// monitors are kept in a side table, keyed by the object. (A static synchronized
+// method synchronizes on its class, so the key is then the class.) A monitor is in the
+// table only while it's held, a thread is blocked entering it, or a thread is waiting on it.
+
+// monitor is the lock state of one object's monitor
+type monitor struct {
+	owner    int        // the ID of the thread that holds the monitor
+	count    int        // the number of times the owner has entered it; 0 if it's not held
+	blocked  int        // the number of threads blocked entering it
+	released *sync.Cond // signalled when the monitor is released
+
+	// the wait set: the channels of the waiting threads, in the order they began
+	// waiting. A thread is notified by closing its channel.
+	waitSet []chan struct{}
+}
+
+// Yield, if set, is called by a thread that would otherwise block on a monitor, in
+// place of blocking, until the monitor is available or the wait ends. It's set when
+// threads are scheduled deterministically (see jvm/scheduler.go), in which case only
+// the thread that has the turn runs, so the others must be given the turn to run.
+var Yield func(thread int)
+
+// monitors holds the monitors that are in use. monitorsMutex guards it and every
+// monitor in it.
+var monitors = make(map[any]*monitor)
+var monitorsMutex sync.Mutex
+
+// MonitorEnter enters the monitor of obj for the thread whose ID is thread, blocking
+// until it's available if another thread holds it
+func MonitorEnter(obj any, thread int) {
+	monitorsMutex.Lock()
+	defer monitorsMutex.Unlock()
+	enter(obj, thread)
+}
+
+// enter enters the monitor of obj, as MonitorEnter() does, and returns it. Must be
+// called with monitorsMutex held.
+func enter(obj any, thread int) *monitor {
+	m := monitors[obj]
+	if m == nil {
+		m = &monitor{released: sync.NewCond(&monitorsMutex)}
+		monitors[obj] = m
+	}
+	m.blocked += 1
+	for m.count > 0 && m.owner != thread {
+		if Yield != nil {
+			monitorsMutex.Unlock()
+			Yield(thread)
+			monitorsMutex.Lock()
+			continue
+		}
+		m.released.Wait()
+	}
+	m.blocked -= 1
+	m.owner = thread
+	m.count += 1
+	return m
+}
+
+// MonitorExit exits the monitor of obj for the thread whose ID is thread. It returns
+// false, leaving the monitor as is, if the thread doesn't hold the monitor, in which
+// case the caller throws an IllegalMonitorStateException.
+func MonitorExit(obj any, thread int) bool {
+	monitorsMutex.Lock()
+	defer monitorsMutex.Unlock()
+
+	m := monitors[obj]
+	if m == nil || m.count == 0 || m.owner != thread {
+		return false
+	}
+	m.count -= 1
+	if m.count == 0 {
+		release(obj, m)
+	}
+	return true
+}
+
+// release removes the released monitor m of obj from the table if no thread is blocked
+// entering it or waiting on it, and otherwise wakes a blocked thread. Must be called
+// with monitorsMutex held.
+func release(obj any, m *monitor) {
+	if m.blocked == 0 && len(m.waitSet) == 0 {
+		delete(monitors, obj)
+	} else if m.blocked > 0 {
+		m.released.Signal()
+	}
+}
+
+// MonitorWait waits on the monitor of obj for the thread whose ID is thread, which must
+// hold it. The monitor is released until the thread is notified, timeout elapses (a
+// timeout of 0 means no timeout), or the channel interrupt is closed, after which the
+// monitor is entered again. held is false, and the thread does not wait, if the thread
+// doesn't hold the monitor. notified reports whether the wait ended by notification;
+// per the JLS, a notified thread returns normally from wait() even if it's also been
+// interrupted, so that the notification is not lost.
+func MonitorWait(obj any, thread int, timeout time.Duration, interrupt <-chan struct{}) (held bool, notified bool) {
+	monitorsMutex.Lock()
+	m := monitors[obj]
+	if m == nil || m.count == 0 || m.owner != thread {
+		monitorsMutex.Unlock()
+		return false, false
+	}
+
+	count := m.count
+	wakeup := make(chan struct{})
+	m.waitSet = append(m.waitSet, wakeup)
+	m.count = 0
+	release(obj, m)
+	monitorsMutex.Unlock()
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+	if Yield == nil {
+		select {
+		case <-wakeup:
+		case <-timer:
+		case <-interrupt:
+		}
+	} else {
+		pollWait(thread, wakeup, timer, interrupt)
+	}
+
+	monitorsMutex.Lock()
+	defer monitorsMutex.Unlock()
+
+	// a thread that's not been notified is still in the wait set, which keeps the
+	// monitor in the table. A notified thread might find it's been removed.
+	notified = true
+	for i, ch := range m.waitSet {
+		if ch == wakeup {
+			m.waitSet = append(m.waitSet[:i], m.waitSet[i+1:]...)
+			notified = false
+			break
+		}
+	}
+	m = enter(obj, thread)
+	m.count = count
+	return true, notified
+}
+
+// pollWait is called by a waiting thread in place of blocking when Yield is set. It
+// yields until the thread is notified, the timer fires, or it's interrupted.
+func pollWait(thread int, wakeup chan struct{}, timer <-chan time.Time, interrupt <-chan struct{}) {
+	for {
+		select {
+		case <-wakeup:
+			return
+		case <-timer:
+			return
+		case <-interrupt:
+			return
+		default:
+			Yield(thread)
+		}
+	}
+}
+
+// MonitorNotify wakes the thread that has waited longest on the monitor of obj, if any.
+// It returns false if the thread whose ID is thread doesn't hold the monitor, in which
+// case the caller throws an IllegalMonitorStateException.
+func MonitorNotify(obj any, thread int) bool {
+	return notify(obj, thread, false)
+}
+
+// MonitorNotifyAll wakes all the threads waiting on the monitor of obj. It returns
+// false if the thread whose ID is thread doesn't hold the monitor.
+func MonitorNotifyAll(obj any, thread int) bool {
+	return notify(obj, thread, true)
+}
+
+// notify wakes the first thread, or if all is true, every thread, in the wait set of the
+// monitor of obj, which the thread whose ID is thread must hold
+func notify(obj any, thread int, all bool) bool {
+	monitorsMutex.Lock()
+	defer monitorsMutex.Unlock()
+
+	m := monitors[obj]
+	if m == nil || m.count == 0 || m.owner != thread {
+		return false
+	}
+	for len(m.waitSet) > 0 {
+		close(m.waitSet[0])
+		m.waitSet = m.waitSet[1:]
+		if !all {
+			break
+		}
+	}
+	return true
+}
+
+// HoldsMonitor reports whether the thread whose ID is thread holds the monitor of obj
+func HoldsMonitor(obj any, thread int) bool {
+	monitorsMutex.Lock()
+	defer monitorsMutex.Unlock()
+
+	m := monitors[obj]
+	return m != nil && m.count > 0 && m.owner == thread
+}
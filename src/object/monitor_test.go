@@ -0,0 +1,192 @@
+/*
+ * Jacobin VM - A Java virtual machine
+ * Copyright (c) 2023 by the Jacobin authors. All rights reserved.
+ * Licensed under Mozilla Public License 2.0 (MPL 2.0)
+ */
+
+package object
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonitorIsReentrant(t *testing.T) {
+	obj := MakeEmptyObject()
+	MonitorEnter(obj, 1)
+	MonitorEnter(obj, 1)
+	if !MonitorExit(obj, 1) || !HoldsMonitor(obj, 1) {
+		t.Errorf("Expected the monitor to be held after one of two exits")
+	}
+	if !MonitorExit(obj, 1) || HoldsMonitor(obj, 1) {
+		t.Errorf("Expected the monitor to be released after two exits")
+	}
+	if len(monitors) != 0 {
+		t.Errorf("Expected the released monitor to be removed from the table, found %d", len(monitors))
+	}
+}
+
+func TestMonitorExitByNonOwnerFails(t *testing.T) {
+	obj := MakeEmptyObject()
+	if MonitorExit(obj, 1) {
+		t.Errorf("Expected the exit of a monitor that's not held to fail")
+	}
+	MonitorEnter(obj, 1)
+	if MonitorExit(obj, 2) {
+		t.Errorf("Expected the exit of a monitor held by another thread to fail")
+	}
+	if !HoldsMonitor(obj, 1) {
+		t.Errorf("Expected the monitor to still be held by its owner")
+	}
+	MonitorExit(obj, 1)
+}
+
+func TestMonitorBlocksOtherThreads(t *testing.T) {
+	obj := MakeEmptyObject()
+	MonitorEnter(obj, 1)
+
+	entered := make(chan bool)
+	go func() {
+		MonitorEnter(obj, 2)
+		entered <- true
+		MonitorExit(obj, 2)
+	}()
+
+	select {
+	case <-entered:
+		t.Fatalf("Expected the second thread to block while the monitor is held")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	MonitorExit(obj, 1)
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the second thread to enter the monitor once it was released")
+	}
+}
+
+func TestMonitorWaitAndNotify(t *testing.T) {
+	obj := MakeEmptyObject()
+	done := make(chan bool)
+	go func() {
+		MonitorEnter(obj, 2)
+		MonitorEnter(obj, 2)
+		held, notified := MonitorWait(obj, 2, 0, nil)
+		if !held || !notified {
+			t.Errorf("Expected the wait to end by notification, got held: %v, notified: %v", held, notified)
+		}
+		if !HoldsMonitor(obj, 2) || !MonitorExit(obj, 2) || !MonitorExit(obj, 2) {
+			t.Errorf("Expected the monitor to be entered again as many times as before the wait")
+		}
+		done <- true
+	}()
+
+	// the waiting thread releases the monitor, so it can be entered
+	for {
+		MonitorEnter(obj, 1)
+		monitorsMutex.Lock()
+		waiting := len(monitors[obj].waitSet)
+		monitorsMutex.Unlock()
+		if waiting == 1 {
+			break
+		}
+		MonitorExit(obj, 1)
+		time.Sleep(time.Millisecond)
+	}
+	MonitorNotify(obj, 1)
+	select {
+	case <-done:
+		t.Fatalf("Expected the notified thread to wait until the monitor is released")
+	case <-time.After(20 * time.Millisecond):
+	}
+	MonitorExit(obj, 1)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the notified thread to return from the wait")
+	}
+	if len(monitors) != 0 {
+		t.Errorf("Expected the released monitor to be removed from the table, found %d", len(monitors))
+	}
+}
+
+func TestMonitorNotifyAll(t *testing.T) {
+	obj := MakeEmptyObject()
+	done := make(chan bool)
+	for thread := 2; thread < 5; thread++ {
+		go func(thread int) {
+			MonitorEnter(obj, thread)
+			_, notified := MonitorWait(obj, thread, 0, nil)
+			MonitorExit(obj, thread)
+			done <- notified
+		}(thread)
+	}
+
+	for {
+		MonitorEnter(obj, 1)
+		monitorsMutex.Lock()
+		waiting := len(monitors[obj].waitSet)
+		monitorsMutex.Unlock()
+		if waiting == 3 {
+			break
+		}
+		MonitorExit(obj, 1)
+		time.Sleep(time.Millisecond)
+	}
+	MonitorNotifyAll(obj, 1)
+	MonitorExit(obj, 1)
+	for i := 0; i < 3; i++ {
+		select {
+		case notified := <-done:
+			if !notified {
+				t.Errorf("Expected every waiting thread to be notified")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected every waiting thread to return from the wait")
+		}
+	}
+}
+
+func TestMonitorWaitTimesOut(t *testing.T) {
+	obj := MakeEmptyObject()
+	MonitorEnter(obj, 1)
+	start := time.Now()
+	held, notified := MonitorWait(obj, 1, 20*time.Millisecond, nil)
+	if !held || notified {
+		t.Errorf("Expected the wait to time out, got held: %v, notified: %v", held, notified)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected the wait to last at least 20ms, it lasted %v", elapsed)
+	}
+	if !MonitorExit(obj, 1) {
+		t.Errorf("Expected the monitor to be held after the wait")
+	}
+}
+
+func TestMonitorWaitInterrupted(t *testing.T) {
+	obj := MakeEmptyObject()
+	interrupt := make(chan struct{})
+	close(interrupt)
+	MonitorEnter(obj, 1)
+	held, notified := MonitorWait(obj, 1, 0, interrupt)
+	if !held || notified {
+		t.Errorf("Expected the wait to end by interruption, got held: %v, notified: %v", held, notified)
+	}
+	MonitorExit(obj, 1)
+	if len(monitors) != 0 {
+		t.Errorf("Expected the released monitor to be removed from the table, found %d", len(monitors))
+	}
+}
+
+func TestMonitorWaitAndNotifyByNonOwner(t *testing.T) {
+	obj := MakeEmptyObject()
+	if held, _ := MonitorWait(obj, 1, 0, nil); held {
+		t.Errorf("Expected a wait on a monitor that's not held to fail")
+	}
+	MonitorEnter(obj, 1)
+	if MonitorNotify(obj, 2) || MonitorNotifyAll(obj, 2) {
+		t.Errorf("Expected notification by a thread that doesn't hold the monitor to fail")
+	}
+	MonitorExit(obj, 1)
+}
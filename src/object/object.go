@@ -28,7 +28,8 @@ type Object struct {
 // These mark word contains values for different purposes. Here,
 // we use the first four bytes for a hash value, which is taken
 // from the address of the object. The 'misc' field will eventually
-// contain other values, such as locking and monitoring items.
+// contain other values. (Objects' monitors are kept in a side table:
+// see monitor.go.)
 type MarkWord struct {
 	Hash uint32 // contains hash code which is the lower 32 bits of the address
 	Misc uint32 // at present unused
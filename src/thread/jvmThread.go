@@ -19,6 +19,10 @@ type ExecThread struct {
 	ID    int        // the thread ID
 	Stack *list.List // the JVM Stack (frame stack, that is) for this thread
 	Trace bool       // do we trace instructions?
+
+	// Virtual is set for virtual threads, which, like all Jacobin threads, run on
+	// goroutines, but are not counted among the threads the JVM waits for at exit.
+	Virtual bool
 }
 
 // CreateThread creates an execution thread and initializes it with default values
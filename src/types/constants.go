@@ -13,3 +13,4 @@ const NoClinit byte = 0x00
 const ClInitNotRun byte = 0x01
 const ClInitInProgress byte = 0x02
 const ClInitRun byte = 0x03
+const ClInitFailed byte = 0x04 // <clinit> threw an exception, so the class can't be used